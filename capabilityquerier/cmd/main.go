@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"os"
 	"strings"
@@ -10,8 +9,11 @@ import (
 
 	"github.com/onc-healthit/lantern-back-end/capabilityquerier/pkg/capabilityquerier"
 	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/config"
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
 	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager/postgresql"
 	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/helpers"
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/hostingprovider"
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/queuemessage"
 	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/workers"
 	"github.com/onc-healthit/lantern-back-end/lanternmq"
 	aq "github.com/onc-healthit/lantern-back-end/lanternmq/pkg/accessqueue"
@@ -33,11 +35,18 @@ type queryArgs struct {
 	qName       string
 	userAgent   string
 	store       *postgresql.Store
+	scheduler   *capabilityquerier.HostScheduler
+	breaker     *capabilityquerier.CircuitBreaker
+	resolver    capabilityquerier.DNSResolver
+	// bulkDataKickoff is whether to send unauthenticated Bulk Data $export kickoff requests
+	bulkDataKickoff bool
+	// dataExposureProbe is whether to search for patient data without authorization
+	dataExposureProbe bool
 }
 
 // queryEndpointsCapabilityStatement gets an endpoint from the queue message and queries it to get the Capability Statement.
 // This function is expected to be called by the lanternmq ProcessMessages function.
-// parameter message:  the queue message that is being processed by this function, which is just an endpoint.
+// parameter message:  the queue message that is being processed by this function, which is a capability query.
 // parameter args:     expected to be a map of the string "queryArgs" to the above queryArgs struct. It is formatted
 // this way because queue processing is generalized.
 func queryEndpointsCapabilityStatement(message []byte, args *map[string]interface{}) error {
@@ -47,32 +56,42 @@ func queryEndpointsCapabilityStatement(message []byte, args *map[string]interfac
 		return fmt.Errorf("unable to cast queryArgs from arguments")
 	}
 
-	var msgJSON map[string]string
-	err := json.Unmarshal(message, &msgJSON)
+	env, err := queuemessage.Decode(message, queuemessage.TypeCapabilityQuery)
 	if err != nil {
-		return fmt.Errorf("error parsing queryEndpointsCapabilityStatement message JSON: %s", err.Error())
+		return fmt.Errorf("error parsing queryEndpointsCapabilityStatement message: %s", err.Error())
 	}
 
-	urlString := msgJSON["url"]
-	requestVersion := msgJSON["requestVersion"]
-	defaultVersion := msgJSON["defaultVersion"]
-
-	if urlString == "FINISHED" {
+	// The run ends with the capability statement queries
+	if env.Type == queuemessage.TypeRunFinished {
+		log.Infof("all of the endpoints of run %s have been queued for querying", env.RunID)
 		return nil
 	}
 
+	var query queuemessage.CapabilityQuery
+	err = env.DecodePayload(&query)
+	if err != nil {
+		return fmt.Errorf("error parsing queryEndpointsCapabilityStatement message: %s", err.Error())
+	}
+
 	jobArgs := make(map[string]interface{})
 
 	jobArgs["querierArgs"] = capabilityquerier.QuerierArgs{
-		FhirURL:        urlString,
-		RequestVersion: requestVersion,
-		DefaultVersion: defaultVersion,
+		FhirURL:        query.URL,
+		RequestVersion: query.RequestVersion,
+		DefaultVersion: query.DefaultVersion,
+		RunID:          env.RunID,
 		//Client:         qa.client,
 		MessageQueue: qa.mq,
 		ChannelID:    qa.ch,
 		QueueName:    qa.qName,
 		UserAgent:    qa.userAgent,
 		Store:        qa.store,
+		Scheduler:    qa.scheduler,
+		Breaker:      qa.breaker,
+
+		BulkDataKickoff:   qa.bulkDataKickoff,
+		DataExposureProbe: qa.dataExposureProbe,
+		Resolver:          qa.resolver,
 	}
 
 	job := workers.Job{
@@ -92,7 +111,7 @@ func queryEndpointsCapabilityStatement(message []byte, args *map[string]interfac
 
 // queryEndpointsVersionsOperation gets an endpoint from the queue message and queries it to get supported versions
 // This function is expected to be called by the lanternmq ProcessMessages function.
-// parameter message:  the queue message that is being processed by this function, which is just an endpoint.
+// parameter message:  the queue message that is being processed by this function, which is an endpoint or the end of a run.
 // parameter args:     expected to be a map of the string "queryArgs" to the above queryArgs struct. It is formatted
 // this way because queue processing is generalized.
 func queryEndpointsVersionsOperation(message []byte, args *map[string]interface{}) error {
@@ -102,28 +121,45 @@ func queryEndpointsVersionsOperation(message []byte, args *map[string]interface{
 		return fmt.Errorf("unable to cast queryArgs from arguments")
 	}
 
-	urlString := string(message)
+	env, err := queuemessage.Decode(message, queuemessage.TypeEndpoint)
+	if err != nil {
+		return fmt.Errorf("error parsing queryEndpointsVersionsOperation message: %s", err.Error())
+	}
+
+	// The end of the run is passed on to the versions response queue
+	handler := capabilityquerier.SendRunFinished
+	var endpt queuemessage.Endpoint
+	if env.Type != queuemessage.TypeRunFinished {
+		err = env.DecodePayload(&endpt)
+		if err != nil {
+			return fmt.Errorf("error parsing queryEndpointsVersionsOperation message: %s", err.Error())
+		}
+		handler = capabilityquerier.GetAndSendVersionsResponse
+	}
 
 	jobArgs := make(map[string]interface{})
 
 	jobArgs["querierArgs"] = capabilityquerier.QuerierArgs{
-		FhirURL: urlString,
+		FhirURL: endpt.URL,
+		RunID:   env.RunID,
 		//Client:       qa.client,
 		MessageQueue: qa.mq,
 		ChannelID:    qa.ch,
 		QueueName:    qa.qName,
 		UserAgent:    qa.userAgent,
 		Store:        qa.store,
+		Scheduler:    qa.scheduler,
+		Breaker:      qa.breaker,
 	}
 
 	job := workers.Job{
 		Context:     qa.ctx,
 		Duration:    qa.jobDuration,
-		Handler:     (capabilityquerier.GetAndSendVersionsResponse),
+		Handler:     handler,
 		HandlerArgs: &jobArgs,
 	}
 
-	err := qa.workers.Add(&job)
+	err = qa.workers.Add(&job)
 	if err != nil {
 		return fmt.Errorf("error adding job to workers: %s", err.Error())
 	}
@@ -131,7 +167,7 @@ func queryEndpointsVersionsOperation(message []byte, args *map[string]interface{
 	return nil
 }
 
-func setupQueue(store *postgresql.Store, userAgent string, ctx context.Context, qName string, endptQName string, processFunc lanternmq.MessageHandler) {
+func setupQueue(store *postgresql.Store, userAgent string, scheduler *capabilityquerier.HostScheduler, breaker *capabilityquerier.CircuitBreaker, resolver capabilityquerier.DNSResolver, ctx context.Context, qName string, endptQName string, processFunc lanternmq.MessageHandler) {
 	// Set up the queue for sending messages
 	qUser := viper.GetString("quser")
 	qPassword := viper.GetString("qpassword")
@@ -159,12 +195,18 @@ func setupQueue(store *postgresql.Store, userAgent string, ctx context.Context,
 		workers: workers,
 		ctx:     ctx,
 		//client:      client,
-		jobDuration: 30 * time.Second,
+		jobDuration: capabilityquerier.CapabilityStatementBudget + capabilityquerier.ProbeBudget,
 		mq:          &mq,
 		ch:          &ch,
 		qName:       qName,
 		userAgent:   userAgent,
 		store:       store,
+		scheduler:   scheduler,
+		breaker:     breaker,
+		resolver:    resolver,
+
+		bulkDataKickoff:   viper.GetBool("query_bulkdata_kickoff"),
+		dataExposureProbe: viper.GetBool("query_data_exposure_probe"),
 	}
 
 	messages, err := mq.ConsumeFromQueue(ch, endptQName)
@@ -177,6 +219,34 @@ func setupQueue(store *postgresql.Store, userAgent string, ctx context.Context,
 	}
 }
 
+// setupDNSResolver returns the resolver that endpoint hosts are looked up with, or nil if no DNS server could be
+// found. The addresses it finds are attributed to the hosting providers of the IP ranges files in the configured
+// directory.
+func setupDNSResolver() capabilityquerier.DNSResolver {
+	server := viper.GetString("query_dns_server")
+	if server == "" {
+		var err error
+		server, err = capabilityquerier.SystemDNSServer("/etc/resolv.conf")
+		if err != nil {
+			log.Warnf("unable to find a DNS server, endpoint hosts will not be resolved: %s", err)
+			return nil
+		}
+	}
+
+	var ranges *hostingprovider.Ranges
+	if rangesDir := viper.GetString("query_cloud_ip_ranges_dir"); rangesDir != "" {
+		var err error
+		ranges, err = hostingprovider.LoadRangesDir(rangesDir)
+		if err != nil {
+			log.Warnf("unable to load the hosting provider IP ranges, addresses will not be attributed to hosting providers: %s", err)
+		} else {
+			log.Infof("loaded %d hosting provider IP ranges", ranges.Len())
+		}
+	}
+
+	return capabilityquerier.NewDNSResolver(server, ranges)
+}
+
 func main() {
 	err := config.SetupConfig()
 	helpers.FailOnError("", err)
@@ -199,11 +269,27 @@ func main() {
 
 	ctx := context.Background()
 
+	// The scheduler is shared by the capability statement and versions workers so that the limits apply to all
+	// of the requests made to a host
+	scheduler := capabilityquerier.NewHostScheduler(viper.GetInt("query_host_maxconcurrent"), viper.GetFloat64("query_host_qps"))
+	// The circuit breaker is shared in the same way, and its transitions are saved so that host outages can be
+	// reported as single events
+	breakerCooldown := time.Duration(viper.GetInt("query_host_breaker_cooldown")) * time.Second
+	breaker := capabilityquerier.NewCircuitBreaker(viper.GetInt("query_host_breaker_failures"), breakerCooldown, func(event endpointmanager.HostCircuitEvent) {
+		log.Infof("circuit breaker for %s changed from %s to %s after %d consecutive failures", event.Host, event.FromState, event.ToState, event.ConsecutiveFailures)
+		err := store.AddHostCircuitEvent(ctx, &event)
+		if err != nil {
+			log.Warnf("saving the circuit breaker event for %s failed: %s", event.Host, err)
+		}
+	})
+
+	resolver := setupDNSResolver()
+
 	versionResponseQName := viper.GetString("versionsquery_response_qname")
 	versionEndptQName := viper.GetString("versionsquery_qname")
-	go setupQueue(store, userAgent, ctx, versionResponseQName, versionEndptQName, queryEndpointsVersionsOperation)
+	go setupQueue(store, userAgent, scheduler, breaker, resolver, ctx, versionResponseQName, versionEndptQName, queryEndpointsVersionsOperation)
 	capQName := viper.GetString("capquery_qname")
 	capQueryEndptQName := viper.GetString("endptinfo_capquery_qname")
-	setupQueue(store, userAgent, ctx, capQName, capQueryEndptQName, queryEndpointsCapabilityStatement)
+	setupQueue(store, userAgent, scheduler, breaker, resolver, ctx, capQName, capQueryEndptQName, queryEndpointsCapabilityStatement)
 
 }
@@ -9,4 +9,5 @@ require (
 	github.com/sirupsen/logrus v1.8.1
 	github.com/spf13/viper v1.10.1
 	github.com/streadway/amqp v0.0.0-20200108173154-1c71cc93ed71
+	golang.org/x/net v0.0.0-20211206223403-eba003a116a9
 )
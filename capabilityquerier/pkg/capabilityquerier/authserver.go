@@ -0,0 +1,128 @@
+package capabilityquerier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+)
+
+// maxAuthServerMetadataSize is the most of an authorization server metadata response that is read
+var maxAuthServerMetadataSize int64 = 1 << 20
+
+// authServerIssuer returns the issuer listed in the SMART configuration in smartResp. Issuer is only required for
+// servers that support OpenID Connect, so if it is not listed the FHIR base URL is used, which is where the SMART
+// configuration itself is published.
+func authServerIssuer(smartResp interface{}, fhirURL string) string {
+	if smartMap, ok := smartResp.(map[string]interface{}); ok {
+		if issuer, ok := smartMap["issuer"].(string); ok && strings.TrimSpace(issuer) != "" {
+			return strings.TrimSpace(issuer)
+		}
+	}
+	issuer := strings.TrimSuffix(endpointmanager.NormalizeURL(fhirURL), "/")
+	return strings.TrimSuffix(issuer, "/metadata")
+}
+
+// authServerMetadataURL returns the URL of the metadata document of the given type for issuer. OpenID Connect
+// appends the well-known path to the issuer, while RFC 8414 inserts it between the host and the issuer's path.
+func authServerMetadataURL(issuer string, endptType EndpointType) (string, error) {
+	issuerURL, err := url.Parse(issuer)
+	if err != nil {
+		return "", err
+	}
+	issuerURL.RawQuery = ""
+	issuerURL.Fragment = ""
+	path := strings.TrimSuffix(issuerURL.Path, "/")
+
+	switch endptType {
+	case openidconfiguration:
+		issuerURL.Path = path + "/.well-known/openid-configuration"
+	case oauthauthorizationserver:
+		issuerURL.Path = "/.well-known/oauth-authorization-server" + path
+	default:
+		return "", fmt.Errorf("%s is not an authorization server metadata endpoint type", endptType)
+	}
+	issuerURL.RawPath = ""
+	return issuerURL.String(), nil
+}
+
+// fetchAuthServerMetadata requests the OpenID Connect metadata of issuer, and the OAuth 2.0 authorization server
+// metadata if the OpenID Connect metadata could not be retrieved. It returns the first document that was retrieved,
+// or the last attempt if neither was.
+func fetchAuthServerMetadata(ctx context.Context, client *http.Client, issuer string, userAgent string) *endpointmanager.AuthServerMetadata {
+	var authServer *endpointmanager.AuthServerMetadata
+	for _, endptType := range []EndpointType{openidconfiguration, oauthauthorizationserver} {
+		authServer = requestAuthServerMetadata(ctx, client, issuer, endptType, userAgent)
+		if authServer.Error == "" {
+			break
+		}
+	}
+	return authServer
+}
+
+// requestAuthServerMetadata requests the metadata document of the given type for issuer and records the endpoints
+// that it lists. Problems retrieving or parsing the document are recorded in the returned AuthServerMetadata's Error
+// rather than returned.
+func requestAuthServerMetadata(ctx context.Context, client *http.Client, issuer string, endptType EndpointType, userAgent string) *endpointmanager.AuthServerMetadata {
+	authServer := &endpointmanager.AuthServerMetadata{
+		DocumentType:    string(endptType),
+		RequestedIssuer: issuer,
+	}
+
+	metadataURL, err := authServerMetadataURL(issuer, endptType)
+	if err != nil {
+		authServer.Error = "unable to build the metadata URL from the issuer: " + err.Error()
+		return authServer
+	}
+	authServer.URL = metadataURL
+
+	req, err := http.NewRequestWithContext(ctx, "GET", metadataURL, nil)
+	if err != nil {
+		authServer.Error = "unable to create new GET request from metadata URL: " + err.Error()
+		return authServer
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		authServer.Error = fmt.Sprintf("making the GET request to %s failed: %s", metadataURL, err.Error())
+		return authServer
+	}
+	defer resp.Body.Close()
+
+	authServer.HTTPResponse = resp.StatusCode
+	if resp.StatusCode != http.StatusOK {
+		authServer.Error = fmt.Sprintf("the metadata URL returned HTTP status %d", resp.StatusCode)
+		return authServer
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxAuthServerMetadataSize))
+	if err != nil {
+		authServer.Error = "reading the metadata response failed: " + err.Error()
+		return authServer
+	}
+
+	var document map[string]interface{}
+	err = json.Unmarshal(body, &document)
+	if err != nil {
+		authServer.Error = "the metadata response is not a JSON object: " + err.Error()
+		return authServer
+	}
+
+	stringField := func(name string) string {
+		value, _ := document[name].(string)
+		return strings.TrimSpace(value)
+	}
+	authServer.Issuer = stringField("issuer")
+	authServer.AuthorizationEndpoint = stringField("authorization_endpoint")
+	authServer.TokenEndpoint = stringField("token_endpoint")
+	authServer.JWKSURI = stringField("jwks_uri")
+
+	return authServer
+}
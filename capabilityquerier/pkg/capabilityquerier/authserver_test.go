@@ -0,0 +1,87 @@
+package capabilityquerier
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	th "github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/testhelper"
+)
+
+func Test_authServerIssuer(t *testing.T) {
+	issuer := authServerIssuer(map[string]interface{}{"issuer": " https://auth.example.com/oauth2 "}, "https://example.com/fhir")
+	th.Assert(t, issuer == "https://auth.example.com/oauth2", fmt.Sprintf("expected https://auth.example.com/oauth2, got %s", issuer))
+
+	// the FHIR base URL is used without an issuer
+	issuer = authServerIssuer(map[string]interface{}{"token_endpoint": "https://example.com/token"}, "https://example.com/fhir/")
+	th.Assert(t, issuer == "https://example.com/fhir", fmt.Sprintf("expected https://example.com/fhir, got %s", issuer))
+
+	issuer = authServerIssuer(map[string]interface{}{"issuer": 1}, "example.com/fhir/metadata")
+	th.Assert(t, issuer == "https://example.com/fhir", fmt.Sprintf("expected https://example.com/fhir, got %s", issuer))
+}
+
+func Test_authServerMetadataURL(t *testing.T) {
+	metadataURL, err := authServerMetadataURL("https://example.com/tenant/", openidconfiguration)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, metadataURL == "https://example.com/tenant/.well-known/openid-configuration", fmt.Sprintf("unexpected OpenID Connect metadata URL %s", metadataURL))
+
+	metadataURL, err = authServerMetadataURL("https://example.com/tenant", oauthauthorizationserver)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, metadataURL == "https://example.com/.well-known/oauth-authorization-server/tenant", fmt.Sprintf("unexpected OAuth metadata URL %s", metadataURL))
+
+	metadataURL, err = authServerMetadataURL("https://example.com", oauthauthorizationserver)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, metadataURL == "https://example.com/.well-known/oauth-authorization-server", fmt.Sprintf("unexpected OAuth metadata URL %s", metadataURL))
+
+	_, err = authServerMetadataURL("https://example.com", wellknown)
+	th.Assert(t, err != nil, "expected an error for an endpoint type that is not an authorization server metadata document")
+
+	_, err = authServerMetadataURL("://example.com", openidconfiguration)
+	th.Assert(t, err != nil, "expected an error for an issuer that is not a URL")
+}
+
+func Test_fetchAuthServerMetadata(t *testing.T) {
+	ctx := context.Background()
+	client := createHTTPClient(nil, nil)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/openid/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"issuer": "https://example.com/openid", "authorization_endpoint": "https://example.com/authorize", "token_endpoint": "https://example.com/token", "jwks_uri": "https://example.com/jwks"}`)
+	})
+	mux.HandleFunc("/.well-known/oauth-authorization-server/oauth", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"issuer": "https://example.com/oauth", "token_endpoint": "https://example.com/token"}`)
+	})
+	mux.HandleFunc("/html/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html></html>`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// OpenID Connect metadata
+	authServer := fetchAuthServerMetadata(ctx, client, server.URL+"/openid", "LANTERN")
+	th.Assert(t, authServer.Error == "", fmt.Sprintf("expected no error, got %s", authServer.Error))
+	th.Assert(t, authServer.DocumentType == "openid-configuration", fmt.Sprintf("expected the openid-configuration document, got %s", authServer.DocumentType))
+	th.Assert(t, authServer.RequestedIssuer == server.URL+"/openid", fmt.Sprintf("unexpected requested issuer %s", authServer.RequestedIssuer))
+	th.Assert(t, authServer.HTTPResponse == 200, fmt.Sprintf("expected HTTP response 200, got %d", authServer.HTTPResponse))
+	th.Assert(t, authServer.AuthorizationEndpoint == "https://example.com/authorize", fmt.Sprintf("unexpected authorization endpoint %s", authServer.AuthorizationEndpoint))
+	th.Assert(t, authServer.TokenEndpoint == "https://example.com/token", fmt.Sprintf("unexpected token endpoint %s", authServer.TokenEndpoint))
+	th.Assert(t, authServer.JWKSURI == "https://example.com/jwks", fmt.Sprintf("unexpected JWKS URI %s", authServer.JWKSURI))
+
+	// falls back to the OAuth 2.0 metadata
+	authServer = fetchAuthServerMetadata(ctx, client, server.URL+"/oauth", "LANTERN")
+	th.Assert(t, authServer.Error == "", fmt.Sprintf("expected no error, got %s", authServer.Error))
+	th.Assert(t, authServer.DocumentType == "oauth-authorization-server", fmt.Sprintf("expected the oauth-authorization-server document, got %s", authServer.DocumentType))
+	th.Assert(t, authServer.URL == server.URL+"/.well-known/oauth-authorization-server/oauth", fmt.Sprintf("unexpected metadata URL %s", authServer.URL))
+	th.Assert(t, authServer.Issuer == "https://example.com/oauth", fmt.Sprintf("unexpected issuer %s", authServer.Issuer))
+
+	// neither document is published
+	authServer = fetchAuthServerMetadata(ctx, client, server.URL+"/missing", "LANTERN")
+	th.Assert(t, authServer.HTTPResponse == 404, fmt.Sprintf("expected HTTP response 404, got %d", authServer.HTTPResponse))
+	th.Assert(t, authServer.Error != "", "expected an error when neither metadata document is published")
+
+	// a response that is not JSON
+	authServer = requestAuthServerMetadata(ctx, client, server.URL+"/html", openidconfiguration, "LANTERN")
+	th.Assert(t, authServer.Error != "", "expected an error for a response that is not JSON")
+}
@@ -0,0 +1,67 @@
+package capabilityquerier
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+)
+
+// requestBulkDataKickoff sends an unauthenticated Bulk Data $export kickoff request to exportURL and records the
+// response status. If the server accepts the export, the job is cancelled using the status URL in the response's
+// Content-Location header; the status URL is never polled and the exported files are never requested.
+// Problems making the request are recorded in the returned BulkDataKickoff's Error rather than returned.
+func requestBulkDataKickoff(ctx context.Context, client *http.Client, exportURL string, userAgent string) *endpointmanager.BulkDataKickoff {
+	kickoff := &endpointmanager.BulkDataKickoff{
+		URL: exportURL,
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", exportURL, nil)
+	if err != nil {
+		kickoff.Error = "unable to create new GET request from $export URL: " + err.Error()
+		return kickoff
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "application/fhir+json")
+	req.Header.Set("Prefer", "respond-async")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		kickoff.Error = fmt.Sprintf("making the GET request to %s failed: %s", exportURL, err.Error())
+		return kickoff
+	}
+	resp.Body.Close()
+
+	kickoff.HTTPResponse = resp.StatusCode
+	if resp.StatusCode == http.StatusAccepted {
+		cancelBulkDataExport(ctx, client, resp, userAgent)
+	}
+
+	return kickoff
+}
+
+// cancelBulkDataExport asks the server to cancel the export job that it accepted in kickoffResp. Servers are not
+// required to support cancelling, so the result is ignored.
+func cancelBulkDataExport(ctx context.Context, client *http.Client, kickoffResp *http.Response, userAgent string) {
+	location := kickoffResp.Header.Get("Content-Location")
+	if location == "" {
+		return
+	}
+	statusURL, err := kickoffResp.Request.URL.Parse(location)
+	if err != nil || (statusURL.Scheme != "https" && statusURL.Scheme != "http") {
+		return
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "DELETE", statusURL.String(), nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+}
@@ -0,0 +1,57 @@
+package capabilityquerier
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	th "github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/testhelper"
+)
+
+func Test_requestBulkDataKickoff(t *testing.T) {
+	ctx := context.Background()
+	client := createHTTPClient(nil, nil)
+
+	cancelled := false
+	var prefer string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/open/$export", func(w http.ResponseWriter, r *http.Request) {
+		prefer = r.Header.Get("Prefer")
+		w.Header().Set("Content-Location", "/open/status/123")
+		w.WriteHeader(http.StatusAccepted)
+	})
+	mux.HandleFunc("/open/status/123", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "DELETE" {
+			cancelled = true
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+	mux.HandleFunc("/protected/$export", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// accepted without authorization, and cancelled
+	kickoff := requestBulkDataKickoff(ctx, client, server.URL+"/open/$export", "LANTERN")
+	th.Assert(t, kickoff.Error == "", fmt.Sprintf("expected no error, got %s", kickoff.Error))
+	th.Assert(t, kickoff.HTTPResponse == http.StatusAccepted, fmt.Sprintf("expected HTTP response 202, got %d", kickoff.HTTPResponse))
+	th.Assert(t, prefer == "respond-async", fmt.Sprintf("expected the Prefer header to be respond-async, got %s", prefer))
+	th.Assert(t, cancelled, "expected the accepted export to be cancelled")
+
+	// protected
+	kickoff = requestBulkDataKickoff(ctx, client, server.URL+"/protected/$export", "LANTERN")
+	th.Assert(t, kickoff.HTTPResponse == http.StatusUnauthorized, fmt.Sprintf("expected HTTP response 401, got %d", kickoff.HTTPResponse))
+	th.Assert(t, kickoff.Error == "", fmt.Sprintf("expected no error for a response, got %s", kickoff.Error))
+
+	// not supported
+	kickoff = requestBulkDataKickoff(ctx, client, server.URL+"/missing/$export", "LANTERN")
+	th.Assert(t, kickoff.HTTPResponse == http.StatusNotFound, fmt.Sprintf("expected HTTP response 404, got %d", kickoff.HTTPResponse))
+
+	// no server
+	kickoff = requestBulkDataKickoff(ctx, client, "http://127.0.0.1:1/$export", "LANTERN")
+	th.Assert(t, kickoff.Error != "", "expected an error when the request could not be made")
+	th.Assert(t, kickoff.HTTPResponse == 0, fmt.Sprintf("expected no HTTP response, got %d", kickoff.HTTPResponse))
+}
@@ -15,6 +15,8 @@ import (
 
 	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
 	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager/postgresql"
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/fhirxml"
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/queuemessage"
 	"github.com/onc-healthit/lantern-back-end/lanternmq"
 	aq "github.com/onc-healthit/lantern-back-end/lanternmq/pkg/accessqueue"
 	"github.com/pkg/errors"
@@ -26,8 +28,19 @@ type EndpointType string
 const (
 	metadata  EndpointType = "metadata"
 	wellknown EndpointType = "well-known"
+	// the OpenID Connect and OAuth 2.0 authorization server metadata documents, which are requested from the issuer
+	// of the endpoint's authorization server rather than the FHIR base URL
+	openidconfiguration      EndpointType = "openid-configuration"
+	oauthauthorizationserver EndpointType = "oauth-authorization-server"
 )
 
+// CapabilityStatementBudget is how long the capability statement and SMART configuration requests of an endpoint may
+// take. ProbeBudget is how much longer the other requests made for the endpoint, such as the UDAP metadata, CDS Hooks
+// discovery and data exposure requests, may take. A job querying an endpoint should be given their sum so that the
+// other requests, which share the host's request limits, do not use up the time the capability statement needs.
+var CapabilityStatementBudget = 30 * time.Second
+var ProbeBudget = 30 * time.Second
+
 var fhir3PlusJSONMIMEType = "application/fhir+json"
 var fhir2LessJSONMIMEType = "application/json+fhir"
 var fhir2LessXMLMIMEType = "application/xml+fhir"
@@ -42,50 +55,73 @@ var tlsUnknown = "TLS version unknown"
 var tlsNone = "No TLS"
 
 // Message is the structure that gets sent on the queue with capability statement inforation. It includes the URL of
-// the FHIR API, any errors from making the FHIR API request, the MIME type, the TLS version, and the capability
-// statement itself.
-type Message struct {
-	URL                      string      `json:"url"`
-	Err                      string      `json:"err"`
-	MIMETypes                []string    `json:"mimeTypes"`
-	TLSVersion               string      `json:"tlsVersion"`
-	HTTPResponse             int         `json:"httpResponse"`
-	CapabilityStatement      interface{} `json:"capabilityStatement"`
-	CapabilityStatementBytes []byte      `json:"capabilityStatementBytes"`
-	SMARTHTTPResponse        int         `json:"smarthttpResponse"`
-	SMARTResp                interface{} `json:"smartResp"`
-	SMARTRespBytes           []byte      `json:"smartRespBytes"`
-	ResponseTime             float64     `json:"responseTime"`
-	RequestedFhirVersion     string      `json:"requestedFhirVersion"`
-	DefaultFhirVersion       string      `json:"defaultFhirVersion"`
-}
+// the FHIR API, any errors from making the FHIR API request along with their classification, the MIME type, the
+// TLS version, and the capability statement itself.
+type Message = queuemessage.CapabilityResponse
 
-// VersionMessage is the structure that gets sent on the queue with $versions response inforation. It includes the URL of
-// the FHIR API, any errors from making the FHIR $versions request, and the $versions response itself.
-type VersionsMessage struct {
-	URL              string      `json:"url"`
-	Err              string      `json:"err"`
-	VersionsResponse interface{} `json:"versionsResponse"`
-}
+// VersionsMessage is the structure that gets sent on the queue with $versions response inforation. It includes the
+// URL of the FHIR API, any errors from making the FHIR $versions request, and the $versions response itself.
+type VersionsMessage = queuemessage.VersionsResponse
 
 // QuerierArgs is a struct of the queue connection information (MessageQueue, ChannelID, and QueueName) as well as
-// the Client and FhirURL for querying
+// the Client and FhirURL for querying. Scheduler is shared by all of the workers to limit the requests made to each
+// host; if it is nil, requests are not limited. Breaker is likewise shared to stop requests to failing hosts; if it
+// is nil, requests are always made.
 type QuerierArgs struct {
 	FhirURL        string
 	RequestVersion string
 	DefaultVersion string
+	// RunID is the run of the message that the query was made for, which is copied to the message sent
+	RunID string
 	//Client         *http.Client
 	MessageQueue *lanternmq.MessageQueue
 	ChannelID    *lanternmq.ChannelID
 	QueueName    string
 	UserAgent    string
 	Store        *postgresql.Store
+	Scheduler    *HostScheduler
+	Breaker      *CircuitBreaker
+	// BulkDataKickoff is whether to send an unauthenticated Bulk Data $export kickoff request to the endpoint
+	BulkDataKickoff bool
+	// DataExposureProbe is whether to search the endpoint for patient data without authorization
+	DataExposureProbe bool
+	// Resolver looks up the endpoint's host before its capability statement is requested. If it is nil, the host
+	// is not looked up.
+	Resolver DNSResolver
+}
+
+// optionalQueries are the requests to an endpoint that are only made when they are turned on
+type optionalQueries struct {
+	bulkDataKickoff bool
+	dataExposure    bool
+	resolver        DNSResolver
+	// scheduler and breaker limit the TLS handshakes made to inspect an endpoint's certificate chain when it
+	// could not be taken from the capability statement response. If they are nil, the handshakes are not limited.
+	scheduler *HostScheduler
+	breaker   *CircuitBreaker
 }
 
-func createHTTPClient() *http.Client {
-	return &http.Client{
-		Timeout: time.Second * 35,
+func createHTTPClient(scheduler *HostScheduler, breaker *CircuitBreaker) *http.Client {
+	client := &http.Client{
+		Timeout:       time.Second * 35,
+		CheckRedirect: checkRedirect,
+	}
+	transport := http.DefaultTransport
+	if scheduler != nil {
+		transport = &scheduledTransport{
+			base:      transport,
+			scheduler: scheduler,
+		}
 	}
+	// The breaker is checked first so that requests to a failing host do not wait on the scheduler
+	if breaker != nil {
+		transport = &breakerTransport{
+			base:    transport,
+			breaker: breaker,
+		}
+	}
+	client.Transport = transport
+	return client
 }
 
 // GetAndSendVersionsResponse gets a $versions response from a FHIR API endpoint and then puts the versions
@@ -99,47 +135,43 @@ func GetAndSendVersionsResponse(ctx context.Context, args *map[string]interface{
 	}
 
 	// create HTTP client for this goroutine
-	client := createHTTPClient()
+	client := createHTTPClient(qa.Scheduler, qa.Breaker)
 
 	message := VersionsMessage{
 		URL: qa.FhirURL,
 	}
 
-	// If Finished message, pass on to versions response queue
-	if qa.FhirURL != "FINISHED" {
-		// Cast string url to type url then cast back to string to ensure url string in correct url format
-		castURL, err := url.Parse(qa.FhirURL)
-		if err != nil {
-			return fmt.Errorf("endpoint URL parsing error: %s", err.Error())
-		}
-		versionsURL := endpointmanager.NormalizeVersionsURL(castURL.String())
-		// Add a short time buffer before sending HTTP request to reduce burden on servers hosting multiple endpoints
-		time.Sleep(time.Duration(500 * time.Millisecond))
-		req, err := http.NewRequest("GET", versionsURL, nil)
+	// Cast string url to type url then cast back to string to ensure url string in correct url format
+	castURL, err := url.Parse(qa.FhirURL)
+	if err != nil {
+		return fmt.Errorf("endpoint URL parsing error: %s", err.Error())
+	}
+	versionsURL := endpointmanager.NormalizeVersionsURL(castURL.String())
+	req, err := http.NewRequest("GET", versionsURL, nil)
+	if err != nil {
+		log.Errorf("unable to create new GET request from URL: %s", versionsURL)
+	} else {
+		req.Header.Set("User-Agent", qa.UserAgent)
+		trace := &httptrace.ClientTrace{}
+		req = req.WithContext(httptrace.WithClientTrace(ctx, trace))
+
+		httpResponseCode, _, _, versionsResponse, _, _, err := requestWithMimeType(req, "application/json", client)
+		// If an error occurs with the version request we still want to proceed with the capability request
 		if err != nil {
-			log.Errorf("unable to create new GET request from URL: %s", versionsURL)
+			log.Infof("Error requesting versions response: %s", err.Error())
 		} else {
-			req.Header.Set("User-Agent", qa.UserAgent)
-			trace := &httptrace.ClientTrace{}
-			req = req.WithContext(httptrace.WithClientTrace(ctx, trace))
-
-			httpResponseCode, _, _, versionsResponse, _, err := requestWithMimeType(req, "application/json", client)
-			// If an error occurs with the version request we still want to proceed with the capability request
-			if err != nil {
-				log.Infof("Error requesting versions response: %s", err.Error())
-			} else {
-				if httpResponseCode == 200 && versionsResponse != nil {
-					err = json.Unmarshal(versionsResponse, &(jsonResponse))
-					if err != nil {
-						log.Errorf("Error unmarshalling versions response: %s", err.Error())
-					}
+			if httpResponseCode == 200 && versionsResponse != nil {
+				err = json.Unmarshal(versionsResponse, &(jsonResponse))
+				if err != nil {
+					log.Errorf("Error unmarshalling versions response: %s", err.Error())
 				}
 			}
 		}
-
-		message.VersionsResponse = jsonResponse
 	}
-	msgBytes, err := json.Marshal(message)
+
+	message.VersionsResponse = jsonResponse
+
+	msgBytes, err := queuemessage.Encode(queuemessage.TypeVersionsResponse, queuemessage.ProducerCapabilityQuerier, qa.RunID, message)
 	if err != nil {
 		return errors.Wrapf(err, "error marshalling json message for request to %s", qa.FhirURL)
 	}
@@ -153,6 +185,26 @@ func GetAndSendVersionsResponse(ctx context.Context, args *map[string]interface{
 	return nil
 }
 
+// SendRunFinished puts a message on the receiving queue that marks the end of the run of the querier args. It is
+// run by a worker so that it is sent after the jobs that were added before it have been started.
+// The args are expected to be a map of the string "querierArgs" to the above QuerierArgs struct.
+func SendRunFinished(ctx context.Context, args *map[string]interface{}) error {
+	qa, ok := (*args)["querierArgs"].(QuerierArgs)
+	if !ok {
+		return fmt.Errorf("unable to cast querierArgs to type QuerierArgs from arguments")
+	}
+
+	msgBytes, err := queuemessage.EncodeRunFinished(queuemessage.ProducerCapabilityQuerier, qa.RunID)
+	if err != nil {
+		return errors.Wrapf(err, "error marshalling run finished message for run %s", qa.RunID)
+	}
+	err = aq.SendToQueue(context.Background(), string(msgBytes), qa.MessageQueue, qa.ChannelID, qa.QueueName)
+	if err != nil {
+		return errors.Wrapf(err, "error sending run finished message for run %s to queue '%s'", qa.RunID, qa.QueueName)
+	}
+	return nil
+}
+
 // GetAndSendCapabilityStatement gets a capability statement from a FHIR API endpoint and then puts the capability
 // statement and accompanying data on a receiving queue.
 // The args are expected to be a map of the string "querierArgs" to the above QuerierArgs struct. It is formatted
@@ -166,12 +218,13 @@ func GetAndSendCapabilityStatement(ctx context.Context, args *map[string]interfa
 	}
 
 	// create HTTP client for this goroutine
-	client := createHTTPClient()
+	client := createHTTPClient(qa.Scheduler, qa.Breaker)
 
 	var err error
 
 	endpt, err := qa.Store.GetFHIREndpointInfoUsingURLAndRequestedVersion(ctx, qa.FhirURL, qa.RequestVersion)
 	var mimeTypes []string
+	var validators *cacheValidators
 	if err == sql.ErrNoRows {
 		mimeTypes = []string{}
 	} else if err != nil {
@@ -185,58 +238,210 @@ func GetAndSendCapabilityStatement(ctx context.Context, args *map[string]interfa
 		}
 	} else {
 		mimeTypes = endpt.MIMETypes
+		validators = cacheValidatorsFor(endpt)
+	}
+
+	message, err := queryCapabilityStatement(ctx, client, qa.FhirURL, qa.RequestVersion, qa.DefaultVersion, qa.UserAgent, mimeTypes, validators, optionalQueries{bulkDataKickoff: qa.BulkDataKickoff, dataExposure: qa.DataExposureProbe, resolver: qa.Resolver, scheduler: qa.Scheduler, breaker: qa.Breaker})
+	if err != nil {
+		return err
+	}
+
+	msgBytes, err := queuemessage.Encode(queuemessage.TypeCapabilityResponse, queuemessage.ProducerCapabilityQuerier, qa.RunID, message)
+	if err != nil {
+		return errors.Wrapf(err, "error marshalling json message for request to %s", qa.FhirURL)
+	}
+	msgStr := string(msgBytes)
+	// Blank context passed in to SendToQueue to prevent terminating error due to an endpoint timeout
+	tempCtx := context.Background()
+	err = aq.SendToQueue(tempCtx, msgStr, qa.MessageQueue, qa.ChannelID, qa.QueueName)
+	if err != nil {
+		return errors.Wrapf(err, "error sending capability statement for FHIR endpoint %s to queue '%s'", qa.FhirURL, qa.QueueName)
 	}
 
-	userAgent := qa.UserAgent
+	return nil
+}
+
+// QueryCapabilityStatement queries the capability statement and SMART configuration of a FHIR API endpoint and
+// inspects its TLS handshake without using the queue or the database. It returns the Message that
+// GetAndSendCapabilityStatement would put on the receiving queue for an endpoint that has not been queried before.
+func QueryCapabilityStatement(ctx context.Context, fhirURL string, requestVersion string, userAgent string) (Message, error) {
+	return queryCapabilityStatement(ctx, createHTTPClient(nil, nil), fhirURL, requestVersion, "", userAgent, []string{}, nil, optionalQueries{})
+}
+
+// queryCapabilityStatement makes the requests for a FHIR API endpoint and fills out the Message with their results.
+// mimeTypes and validators are the MIME types and cache validators saved for the endpoint, and optional is which
+// of the optional requests to make.
+func queryCapabilityStatement(ctx context.Context, client *http.Client, fhirURL string, requestVersion string, defaultVersion string, userAgent string, mimeTypes []string, validators *cacheValidators, optional optionalQueries) (Message, error) {
 	message := Message{
-		URL:                  qa.FhirURL,
-		RequestedFhirVersion: qa.RequestVersion,
-		DefaultFhirVersion:   qa.DefaultVersion,
+		URL:                  fhirURL,
+		RequestedFhirVersion: requestVersion,
+		DefaultFhirVersion:   defaultVersion,
 		MIMETypes:            mimeTypes,
 	}
 	// Cast string url to type url then cast back to string to ensure url string in correct url format
-	castURL, err := url.Parse(qa.FhirURL)
+	castURL, err := url.Parse(fhirURL)
 	if err != nil {
-		return fmt.Errorf("endpoint URL parsing error: %s", err.Error())
+		return message, fmt.Errorf("endpoint URL parsing error: %s", err.Error())
 	}
 	metadataURL := endpointmanager.NormalizeEndpointURL(castURL.String())
-	// Query fhir endpoint
-	err = requestCapabilityStatementAndSmartOnFhir(ctx, metadataURL, metadata, client, userAgent, &message)
-	if err != nil {
+
+	// The capability statement and SMART configuration are requested within their own budget. The other requests use
+	// what is left of the job's time.
+	capabilityCtx, cancel := context.WithTimeout(ctx, CapabilityStatementBudget)
+	defer cancel()
+
+	// Look up the host before it is requested so that the records the request was made with are recorded
+	if optional.resolver != nil {
+		message.DNSInfo = optional.resolver.Resolve(capabilityCtx, castURL.Hostname())
+		if message.DNSInfo.Error != "" {
+			log.Warnf("Got error:\n%s\n\nfrom DNS lookup of URL: %s", message.DNSInfo.Error, fhirURL)
+		}
+	}
+
+	// Query fhir endpoint, keeping the TLS connection state of the response so that the certificate chain can be
+	// inspected without making another TLS handshake
+	tlsStates := &tlsStateRecorder{}
+	err = requestCapabilityStatementAndSmartOnFhir(withTLSStateRecorder(capabilityCtx, tlsStates), metadataURL, metadata, client, userAgent, validators, &message)
+	var waitErr *schedulerWaitError
+	if errors.As(err, &waitErr) {
+		// the request ran out of time while queued behind the other requests to the host, which is not a fault of
+		// the endpoint
+		log.Warnf("Got error:\n%s\n\nfrom URL: %s", err.Error(), fhirURL)
+		message.Err = err.Error()
+		message.ErrorCode = endpointmanager.SchedulerTimeoutCode
+	} else if err != nil {
 		select {
-		case <-ctx.Done():
-			log.Warnf("Got error: server could not be reached from URL: %s", qa.FhirURL)
+		case <-capabilityCtx.Done():
+			log.Warnf("Got error: server could not be reached from URL: %s", fhirURL)
 			message.Err = "server could not be reached from URL: " + metadataURL
+			message.ErrorCode = endpointmanager.TimeoutCode
 		default:
-			log.Warnf("Got error:\n%s\n\nfrom URL: %s", err.Error(), qa.FhirURL)
+			log.Warnf("Got error:\n%s\n\nfrom URL: %s", err.Error(), fhirURL)
 			message.Err = err.Error()
+			message.ErrorCode = classifyError(err)
+		}
+	} else if message.HTTPResponse != http.StatusOK && message.HTTPResponse != http.StatusNotModified {
+		message.ErrorCode = endpointmanager.HTTPStatusCode
+	}
+
+	// Record the TLS handshake and certificate chain of the endpoint. They are taken from the response when there
+	// is one from the endpoint's host. Otherwise another handshake is only made if the chain could not be verified
+	// or the response came from another host, since other failures would fail the handshake as well.
+	tlsState := tlsStates.stateFor(castURL.Hostname())
+	if tlsState != nil || message.ErrorCode == endpointmanager.BadCertificateCode || message.HTTPResponse != 0 {
+		message.TLSInfo, err = inspectTLS(ctx, metadataURL, tlsState, optional.scheduler, optional.breaker)
+		if err != nil {
+			log.Warnf("Got error:\n%s\n\nfrom TLS inspection of URL: %s", err.Error(), metadataURL)
 		}
 	}
 
 	wellKnownURL := endpointmanager.NormalizeWellKnownURL(castURL.String())
 	// Query well known endpoint
-	err = requestCapabilityStatementAndSmartOnFhir(ctx, wellKnownURL, wellknown, client, userAgent, &message)
+	err = requestCapabilityStatementAndSmartOnFhir(capabilityCtx, wellKnownURL, wellknown, client, userAgent, nil, &message)
 	if err != nil {
 		log.Warnf("Got error:\n%s\n\nfrom wellknown URL: %s", err.Error(), wellKnownURL)
 	}
 
-	msgBytes, err := json.Marshal(message)
-	if err != nil {
-		return errors.Wrapf(err, "error marshalling json message for request to %s", qa.FhirURL)
+	// The other requests are only made to endpoints that responded to the capability statement request, since they
+	// would fail in the same way for the rest. A request cut short by the end of the job is left out rather than
+	// recorded as a failure of the endpoint, and the requests after it are not made.
+	if message.HTTPResponse == 0 {
+		return message, nil
 	}
-	msgStr := string(msgBytes)
-	// Blank context passed in to SendToQueue to prevent terminating error due to an endpoint timeout
-	tempCtx := context.Background()
-	err = aq.SendToQueue(tempCtx, msgStr, qa.MessageQueue, qa.ChannelID, qa.QueueName)
-	if err != nil {
-		return errors.Wrapf(err, "error sending capability statement for FHIR endpoint %s to queue '%s'", qa.FhirURL, qa.QueueName)
+
+	// Fetch the key set that the SMART configuration advertises for verifying the server's signatures
+	jwksURI := advertisedJWKSURI(message.SMARTResp)
+	if jwksURI != "" {
+		message.JWKSInfo = fetchJWKS(ctx, client, jwksURI, userAgent)
+		if probeCutShort(ctx, "JWKS", jwksURI) {
+			message.JWKSInfo = nil
+			return message, nil
+		}
+		if message.JWKSInfo.Error != "" {
+			log.Warnf("Got error:\n%s\n\nfrom JWKS URI: %s", message.JWKSInfo.Error, jwksURI)
+		}
 	}
 
-	return nil
+	// Request the metadata of the authorization server so that it can be compared with the SMART configuration
+	if message.SMARTResp != nil {
+		issuer := authServerIssuer(message.SMARTResp, castURL.String())
+		message.AuthServerMetadata = fetchAuthServerMetadata(ctx, client, issuer, userAgent)
+		if probeCutShort(ctx, "authorization server metadata", issuer) {
+			message.AuthServerMetadata = nil
+			return message, nil
+		}
+		if message.AuthServerMetadata.Error != "" {
+			log.Warnf("Got error:\n%s\n\nfrom authorization server metadata URL: %s", message.AuthServerMetadata.Error, message.AuthServerMetadata.URL)
+		}
+	}
+
+	// Request the UDAP metadata, which payer and TEFCA-facing endpoints publish next to or in place of the SMART
+	// configuration. Most endpoints do not publish it, so only problems with published metadata are logged.
+	udapURL := endpointmanager.NormalizeUDAPURL(castURL.String())
+	message.UDAPInfo = fetchUDAPMetadata(ctx, client, udapURL, userAgent)
+	if probeCutShort(ctx, "UDAP metadata", udapURL) {
+		message.UDAPInfo = nil
+		return message, nil
+	}
+	if message.UDAPInfo.HTTPResponse == http.StatusOK && message.UDAPInfo.Error != "" {
+		log.Warnf("Got error:\n%s\n\nfrom UDAP metadata URL: %s", message.UDAPInfo.Error, udapURL)
+	}
+
+	// Request the CDS Hooks discovery document to track clinical decision support adoption. As with the UDAP
+	// metadata, most endpoints do not publish it, so only problems with published documents are logged.
+	cdsHooksURL := endpointmanager.NormalizeCDSHooksURL(castURL.String())
+	message.CDSHooksInfo = fetchCDSHooksDiscovery(ctx, client, cdsHooksURL, userAgent)
+	if probeCutShort(ctx, "CDS Hooks discovery", cdsHooksURL) {
+		message.CDSHooksInfo = nil
+		return message, nil
+	}
+	if message.CDSHooksInfo.HTTPResponse == http.StatusOK && message.CDSHooksInfo.Error != "" {
+		log.Warnf("Got error:\n%s\n\nfrom CDS Hooks discovery URL: %s", message.CDSHooksInfo.Error, cdsHooksURL)
+	}
+
+	// Send an unauthenticated Bulk Data $export kickoff request to find endpoints that accept exports without
+	// authorization. This starts a job on servers that accept it, so it is only sent when turned on.
+	if optional.bulkDataKickoff {
+		exportURL := endpointmanager.NormalizeExportURL(castURL.String())
+		message.BulkDataKickoff = requestBulkDataKickoff(ctx, client, exportURL, userAgent)
+		if probeCutShort(ctx, "Bulk Data kickoff", exportURL) {
+			message.BulkDataKickoff = nil
+			return message, nil
+		}
+		if message.BulkDataKickoff.HTTPResponse == http.StatusAccepted {
+			log.Warnf("Bulk Data $export URL accepted an unauthenticated kickoff request: %s", exportURL)
+		}
+	}
+
+	// Search for patient data without authorization. Only the shape of each response is kept.
+	if optional.dataExposure {
+		message.DataExposureChecks = probeDataExposure(ctx, client, castURL.String(), userAgent)
+		if probeCutShort(ctx, "data exposure", castURL.String()) {
+			message.DataExposureChecks = nil
+			return message, nil
+		}
+		for _, search := range endpointmanager.ExposedSearches(message.DataExposureChecks) {
+			log.Errorf("FHIR endpoint %s returned patient data without authorization for the search %s", fhirURL, search)
+		}
+	}
+
+	return message, nil
 }
 
-// fills out message with http response code, tls version, capability statement, and supported mime types
-func requestCapabilityStatementAndSmartOnFhir(ctx context.Context, fhirURL string, endptType EndpointType, client *http.Client, userAgent string, message *Message) error {
+// probeCutShort checks whether the job's context ended while a request was being made, in which case the request's
+// result says nothing about the endpoint
+func probeCutShort(ctx context.Context, probe string, probeURL string) bool {
+	if ctx.Err() == nil {
+		return false
+	}
+	log.Warnf("The %s request to %s did not finish before the end of the job and was not recorded", probe, probeURL)
+	return true
+}
+
+// fills out message with http response code, tls version, capability statement, and supported mime types.
+// If validators is not nil, the request with the saved MIME type is conditional, and a 304 response is recorded
+// in message without a capability statement.
+func requestCapabilityStatementAndSmartOnFhir(ctx context.Context, fhirURL string, endptType EndpointType, client *http.Client, userAgent string, validators *cacheValidators, message *Message) error {
 	var err error
 	var httpErr error
 	var httpResponseCode int
@@ -246,16 +451,20 @@ func requestCapabilityStatementAndSmartOnFhir(ctx context.Context, fhirURL strin
 	var jsonResponse interface{}
 	var responseTime float64
 	var triedMIMEType string
+	var respHeaders http.Header
 
-	// Add a short time buffer before sending HTTP request to reduce burden on servers hosting multiple endpoints
-	time.Sleep(time.Duration(500 * time.Millisecond))
 	req, err := http.NewRequest("GET", fhirURL, nil)
 	if err != nil {
 		return errors.Wrap(err, "unable to create new GET request from URL: "+fhirURL)
 	}
 	req.Header.Set("User-Agent", userAgent)
-	trace := &httptrace.ClientTrace{}
-	req = req.WithContext(httptrace.WithClientTrace(ctx, trace))
+	req.Header.Set("Origin", corsOrigin)
+	timer := &requestTimer{}
+	wait := &schedulerWait{}
+	redirects := &redirectRecorder{}
+	errorResponses := &errorResponseRecorder{}
+	ctx = withErrorResponseRecorder(withRedirectRecorder(withSchedulerWait(ctx, wait), redirects), errorResponses)
+	req = req.WithContext(httptrace.WithClientTrace(ctx, timer.clientTrace()))
 
 	// If there is a requested fhir version, set the fhirVersion in the request header
 	if message.RequestedFhirVersion != "None" {
@@ -265,18 +474,25 @@ func requestCapabilityStatementAndSmartOnFhir(ctx context.Context, fhirURL strin
 	// If there is a mime type saved in the database for this URL, try those ones first when requesting the capability statement
 	if len(message.MIMETypes) == 1 {
 		savedMIME := message.MIMETypes[0]
-		httpResponseCode, tlsVersion, mimeTypeWorked, capResp, responseTime, httpErr = requestWithMimeType(req, savedMIME, client)
+		if validators != nil {
+			validators.setHeaders(req)
+		}
+		httpResponseCode, tlsVersion, mimeTypeWorked, capResp, responseTime, respHeaders, httpErr = requestWithMimeType(req, savedMIME, client)
+		// The other MIME types are requested unconditionally since the validators belong to the saved MIME type
+		clearCacheValidators(req)
 		if httpErr != nil && httpResponseCode != 0 {
 			return err
 		}
 	}
+	notModified := httpResponseCode == http.StatusNotModified
 
-	// If there was no MIME type saved in the database, or the saved MIME type did not work, go through process of trying others
-	if len(message.MIMETypes) != 1 || httpResponseCode != http.StatusOK || !mimeTypeWorked {
+	// If there was no MIME type saved in the database, or the saved MIME type did not work, go through process of trying others.
+	// A 304 response means the saved MIME type worked and the saved capability statement is still current.
+	if !notModified && (len(message.MIMETypes) != 1 || httpResponseCode != http.StatusOK || !mimeTypeWorked) {
 		// If the endpoint is a well known endpoint and it did not already have MIME type saved, try the fhir3PlusJSONMIMEType
 		if endptType == wellknown {
 			if len(message.MIMETypes) == 0 {
-				httpResponseCode, _, _, capResp, _, httpErr = requestWithMimeType(req, fhir3PlusJSONMIMEType, client)
+				httpResponseCode, _, _, capResp, _, _, httpErr = requestWithMimeType(req, fhir3PlusJSONMIMEType, client)
 				if httpErr != nil && httpResponseCode != 0 {
 					return err
 				}
@@ -294,7 +510,7 @@ func requestCapabilityStatementAndSmartOnFhir(ctx context.Context, fhirURL strin
 
 			// Try fhir3PlusJSONMIMEType first if it was not the MIME type saved in the database
 			if oldMIMEType != fhir3PlusJSONMIMEType {
-				httpResponseCode, tlsVersion, mimeTypeWorked, capResp, responseTime, httpErr = requestWithMimeType(req, fhir3PlusJSONMIMEType, client)
+				httpResponseCode, tlsVersion, mimeTypeWorked, capResp, responseTime, respHeaders, httpErr = requestWithMimeType(req, fhir3PlusJSONMIMEType, client)
 				if httpErr != nil && httpResponseCode != 0 {
 					return err
 				}
@@ -302,7 +518,7 @@ func requestCapabilityStatementAndSmartOnFhir(ctx context.Context, fhirURL strin
 			}
 			// Try fhir2LessJSONMIMEType second if it was not the MIME type saved in the database and the first MIME type did not work
 			if oldMIMEType != fhir2LessJSONMIMEType && (!mimeTypeWorked || httpResponseCode != http.StatusOK) {
-				httpResponseCode, tlsVersion, mimeTypeWorked, capResp, responseTime, httpErr = requestWithMimeType(req, fhir2LessJSONMIMEType, client)
+				httpResponseCode, tlsVersion, mimeTypeWorked, capResp, responseTime, respHeaders, httpErr = requestWithMimeType(req, fhir2LessJSONMIMEType, client)
 				if httpErr != nil && httpResponseCode != 0 {
 					return err
 				}
@@ -310,7 +526,7 @@ func requestCapabilityStatementAndSmartOnFhir(ctx context.Context, fhirURL strin
 			}
 			// Try fhir3PlusXMLMIMEType third if it was not the MIME type saved in the database and the first two MIME types did not work
 			if oldMIMEType != fhir3PlusXMLMIMEType && (!mimeTypeWorked || httpResponseCode != http.StatusOK) {
-				httpResponseCode, tlsVersion, mimeTypeWorked, capResp, responseTime, httpErr = requestWithMimeType(req, fhir3PlusXMLMIMEType, client)
+				httpResponseCode, tlsVersion, mimeTypeWorked, capResp, responseTime, respHeaders, httpErr = requestWithMimeType(req, fhir3PlusXMLMIMEType, client)
 				if httpErr != nil && httpResponseCode != 0 {
 					return err
 				}
@@ -318,7 +534,7 @@ func requestCapabilityStatementAndSmartOnFhir(ctx context.Context, fhirURL strin
 			}
 			// Try fhir2LessXMLMIMEType last if it was not the MIME type saved in the database and the first three MIME types did not work
 			if oldMIMEType != fhir2LessXMLMIMEType && (!mimeTypeWorked || httpResponseCode != http.StatusOK) {
-				httpResponseCode, tlsVersion, mimeTypeWorked, capResp, responseTime, httpErr = requestWithMimeType(req, fhir2LessXMLMIMEType, client)
+				httpResponseCode, tlsVersion, mimeTypeWorked, capResp, responseTime, respHeaders, httpErr = requestWithMimeType(req, fhir2LessXMLMIMEType, client)
 				if httpErr != nil && httpResponseCode != 0 {
 					return err
 				}
@@ -332,6 +548,29 @@ func requestCapabilityStatementAndSmartOnFhir(ctx context.Context, fhirURL strin
 		}
 	}
 
+	// The timer holds the timings of the last request made, which is the one whose response is used
+	responseTimings := timer.finish()
+	// The scheduler wait covers all of the requests made, since each one may have been held back
+	responseTimings.SchedulerWait = wait.seconds()
+
+	// XML capability statements are converted to the FHIR JSON format so that they can be parsed, validated
+	// and stored in the same way as JSON capability statements
+	if capResp != nil && endptType == metadata {
+		if isHTML(capResp) {
+			if httpErr == nil {
+				httpErr = withErrorCode(errHTMLResponse, endpointmanager.HTMLResponseCode)
+			}
+		} else if fhirxml.IsXML(capResp) {
+			message.CapabilityStatementFormat = "xml"
+			capResp, err = fhirxml.ToJSON(capResp)
+			if err != nil && httpErr == nil {
+				httpErr = withErrorCode(err, endpointmanager.XMLParseCode)
+			}
+		} else {
+			message.CapabilityStatementFormat = "json"
+		}
+	}
+
 	if capResp != nil {
 		if endptType == metadata {
 			message.CapabilityStatementBytes = capResp
@@ -357,6 +596,10 @@ func requestCapabilityStatementAndSmartOnFhir(ctx context.Context, fhirURL strin
 		message.TLSVersion = tlsVersion
 		message.HTTPResponse = httpResponseCode
 		message.ResponseTime = responseTime
+		message.ResponseTimings = responseTimings
+		message.ResponseHeaders = curateResponseHeaders(respHeaders)
+		message.RedirectChain = redirects.chain()
+		message.ErrorResponse = errorResponses.response()
 	case wellknown:
 		message.SMARTHTTPResponse = httpResponseCode
 	}
@@ -366,24 +609,28 @@ func requestCapabilityStatementAndSmartOnFhir(ctx context.Context, fhirURL strin
 
 func getTLSVersion(resp *http.Response) string {
 	if resp.TLS != nil {
-		switch resp.TLS.Version {
-		case tls.VersionSSL30: //nolint
-			return ssl30
-		case tls.VersionTLS10:
-			return tls10
-		case tls.VersionTLS11:
-			return tls11
-		case tls.VersionTLS12:
-			return tls12
-		case tls.VersionTLS13:
-			return tls13
-		default:
-			return tlsUnknown
-		}
+		return tlsVersionName(resp.TLS.Version)
 	}
 	return tlsNone
 }
 
+func tlsVersionName(version uint16) string {
+	switch version {
+	case tls.VersionSSL30: //nolint
+		return ssl30
+	case tls.VersionTLS10:
+		return tls10
+	case tls.VersionTLS11:
+		return tls11
+	case tls.VersionTLS12:
+		return tls12
+	case tls.VersionTLS13:
+		return tls13
+	default:
+		return tlsUnknown
+	}
+}
+
 func mimeTypesMatch(reqMimeType string, respMimeType string) bool {
 	respMimeTypes := strings.Split(respMimeType, "; ")
 	for _, rmt := range respMimeTypes {
@@ -399,8 +646,10 @@ func mimeTypesMatch(reqMimeType string, respMimeType string) bool {
 // tls version
 // mime type match
 // capability statement
+// response time
+// response headers
 // error
-func requestWithMimeType(req *http.Request, mimeType string, client *http.Client) (int, string, bool, []byte, float64, error) {
+func requestWithMimeType(req *http.Request, mimeType string, client *http.Client) (int, string, bool, []byte, float64, http.Header, error) {
 	var httpResponseCode int
 	var tlsVersion string
 	var capStat []byte
@@ -408,13 +657,28 @@ func requestWithMimeType(req *http.Request, mimeType string, client *http.Client
 	mimeMatches := false
 
 	req.Header.Set("Accept", mimeType)
+	if redirects, ok := redirectRecorderFrom(req.Context()); ok {
+		redirects.reset()
+	}
+	errorResponses, recordErrorResponse := errorResponseRecorderFrom(req.Context())
+	if recordErrorResponse {
+		errorResponses.reset()
+	}
+	tlsStates, recordTLSState := tlsStateRecorderFrom(req.Context())
+	if recordTLSState {
+		tlsStates.reset()
+	}
 
 	start := time.Now()
 
 	resp, err := client.Do(req)
 	if err != nil {
 		// Return http status code 0 on failure
-		return 0, "", false, nil, -1, errors.Wrapf(err, "making the GET request to %s failed", req.URL.String())
+		return 0, "", false, nil, -1, nil, errors.Wrapf(err, "making the GET request to %s failed", req.URL.String())
+	}
+	defer resp.Body.Close()
+	if recordTLSState {
+		tlsStates.record(resp)
 	}
 
 	var responseTime = float64(time.Since(start).Seconds())
@@ -424,16 +688,18 @@ func requestWithMimeType(req *http.Request, mimeType string, client *http.Client
 		// LANTERN-990: Removed the if statement that checks whether the response header "Content-Type" value
 		// contains the term "json" or not. It was skipping valid JSON responses if those did not have this header value set.
 
-		defer resp.Body.Close()
 		mimeMatches = true
 
 		capStat, err = io.ReadAll(resp.Body)
 		if err != nil {
-			return -1, "", false, nil, -1, errors.Wrapf(err, "reading the response from %s failed", req.URL.String())
+			return -1, "", false, nil, -1, resp.Header, errors.Wrapf(err, "reading the response from %s failed", req.URL.String())
 		}
+	} else if httpResponseCode >= 400 && recordErrorResponse {
+		// The body of an error response is kept so that the reason for the failure can be reported
+		errorResponses.errorResponse = readErrorResponse(resp)
 	}
 
 	tlsVersion = getTLSVersion(resp)
 
-	return httpResponseCode, tlsVersion, mimeMatches, capStat, responseTime, nil
+	return httpResponseCode, tlsVersion, mimeMatches, capStat, responseTime, resp.Header, nil
 }
@@ -12,7 +12,10 @@ import (
 	"time"
 
 	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"strings"
+	"sync/atomic"
 
 	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
 	th "github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/testhelper"
@@ -49,7 +52,7 @@ func Test_requestCapabilityStatementAndSmartOnFhir(t *testing.T) {
 	th.Assert(t, err == nil, err)
 	defer tc.Close()
 
-	err = requestCapabilityStatementAndSmartOnFhir(ctx, metadataURL, "metadata", &(tc.Client), "", &message)
+	err = requestCapabilityStatementAndSmartOnFhir(ctx, metadataURL, "metadata", &(tc.Client), "", nil, &message)
 	th.Assert(t, err == nil, err)
 	capStat, err = json.Marshal(message.CapabilityStatement)
 	th.Assert(t, err == nil, err)
@@ -64,7 +67,7 @@ func Test_requestCapabilityStatementAndSmartOnFhir(t *testing.T) {
 
 	// check that response from well known endpt is null and that MIME type is not affected
 	wellKnownURL := endpointmanager.NormalizeWellKnownURL(sampleURL)
-	err = requestCapabilityStatementAndSmartOnFhir(ctx, wellKnownURL, "well-known", client, "", &message)
+	err = requestCapabilityStatementAndSmartOnFhir(ctx, wellKnownURL, "well-known", client, "", nil, &message)
 	th.Assert(t, err == nil, err)
 	smartResp, err = json.Marshal(message.SMARTResp)
 	th.Assert(t, err == nil, err)
@@ -90,7 +93,7 @@ func Test_requestCapabilityStatementAndSmartOnFhir(t *testing.T) {
 	th.Assert(t, err == nil, err)
 	defer tc.Close()
 
-	err = requestCapabilityStatementAndSmartOnFhir(ctx, metadataURL, "metadata", &(tc.Client), "", &message)
+	err = requestCapabilityStatementAndSmartOnFhir(ctx, metadataURL, "metadata", &(tc.Client), "", nil, &message)
 	th.Assert(t, err == nil, err)
 	capStat, err = json.Marshal(message.CapabilityStatement)
 	th.Assert(t, err == nil, err)
@@ -107,7 +110,7 @@ func Test_requestCapabilityStatementAndSmartOnFhir(t *testing.T) {
 	th.Assert(t, err == nil, err)
 	tc.Close() // makes request fail
 
-	err = requestCapabilityStatementAndSmartOnFhir(ctx, metadataURL, "metadata", &(tc.Client), "", &message)
+	err = requestCapabilityStatementAndSmartOnFhir(ctx, metadataURL, "metadata", &(tc.Client), "", nil, &message)
 	switch errors.Cause(err).(type) {
 	case *url.Error:
 		// expect url.Error because we closed the connection that we're querying.
@@ -127,7 +130,7 @@ func Test_requestCapabilityStatementAndSmartOnFhir(t *testing.T) {
 	th.Assert(t, err == nil, err)
 	defer tc.Close()
 
-	err = requestCapabilityStatementAndSmartOnFhir(ctx, metadataURL, "metadata", &(tc.Client), "", &message)
+	err = requestCapabilityStatementAndSmartOnFhir(ctx, metadataURL, "metadata", &(tc.Client), "", nil, &message)
 	th.Assert(t, err == nil, err)
 	capStat, err = json.Marshal(message.CapabilityStatement)
 	th.Assert(t, err == nil, err)
@@ -149,7 +152,7 @@ func Test_requestCapabilityStatementAndSmartOnFhir(t *testing.T) {
 	th.Assert(t, err == nil, err)
 	defer tc.Close()
 
-	err = requestCapabilityStatementAndSmartOnFhir(ctx, metadataURL, "metadata", &(tc.Client), "", &message)
+	err = requestCapabilityStatementAndSmartOnFhir(ctx, metadataURL, "metadata", &(tc.Client), "", nil, &message)
 	th.Assert(t, err == nil, err)
 	capStat, err = json.Marshal(message.CapabilityStatement)
 	th.Assert(t, err == nil, err)
@@ -172,7 +175,7 @@ func Test_requestCapabilityStatementAndSmartOnFhir(t *testing.T) {
 	th.Assert(t, err == nil, err)
 	defer tc.Close()
 
-	err = requestCapabilityStatementAndSmartOnFhir(ctx, metadataURL, "metadata", &(tc.Client), "", &message)
+	err = requestCapabilityStatementAndSmartOnFhir(ctx, metadataURL, "metadata", &(tc.Client), "", nil, &message)
 	th.Assert(t, err == nil, err)
 	capStat, err = json.Marshal(message.CapabilityStatement)
 	th.Assert(t, err == nil, err)
@@ -191,12 +194,51 @@ func Test_requestCapabilityStatementAndSmartOnFhir(t *testing.T) {
 	defer tc.Close()
 	ctx = context.Background()
 
-	err = requestCapabilityStatementAndSmartOnFhir(ctx, metadataURL, "metadata", &(tc.Client), "", &message)
+	err = requestCapabilityStatementAndSmartOnFhir(ctx, metadataURL, "metadata", &(tc.Client), "", nil, &message)
 	th.Assert(t, err == nil, err)
 	th.Assert(t, len(message.MIMETypes) == 1, fmt.Sprintf("expected one matched mime types, got %d", len(message.MIMETypes)))
 	th.Assert(t, message.MIMETypes[0] == expectedMimeType, fmt.Sprintf("mismatched: expected mimeType %s; received mimeType %s", expectedMimeType, message.MIMETypes[0]))
 }
 
+func Test_requestCapabilityStatementAndSmartOnFhirXML(t *testing.T) {
+	ctx := context.Background()
+	metadataURL := endpointmanager.NormalizeEndpointURL(sampleURLNoTLS)
+
+	// server that only returns XML capability statements
+	message := Message{}
+	message.RequestedFhirVersion = "None"
+	tc, err := testClientWithXMLContentType(fhir3PlusXMLMIMEType)
+	th.Assert(t, err == nil, err)
+	defer tc.Close()
+
+	err = requestCapabilityStatementAndSmartOnFhir(ctx, metadataURL, "metadata", &(tc.Client), "", nil, &message)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, message.CapabilityStatementFormat == "xml", fmt.Sprintf("expected capability statement format xml, got %s", message.CapabilityStatementFormat))
+	th.Assert(t, len(message.MIMETypes) == 1, fmt.Sprintf("expected one matched mime type. Got %d.", len(message.MIMETypes)))
+	th.Assert(t, message.MIMETypes[0] == fhir3PlusXMLMIMEType, fmt.Sprintf("expected mimeType %s; received mimeType %s", fhir3PlusXMLMIMEType, message.MIMETypes[0]))
+
+	capStat, ok := message.CapabilityStatement.(map[string]interface{})
+	th.Assert(t, ok, "expected the XML capability statement to be converted to a JSON object")
+	th.Assert(t, capStat["resourceType"] == "CapabilityStatement", fmt.Sprintf("expected resourceType CapabilityStatement, got %v", capStat["resourceType"]))
+	th.Assert(t, capStat["fhirVersion"] == "4.0.1", fmt.Sprintf("expected fhirVersion 4.0.1, got %v", capStat["fhirVersion"]))
+
+	var capStatBytesInt map[string]interface{}
+	err = json.Unmarshal(message.CapabilityStatementBytes, &capStatBytesInt)
+	th.Assert(t, err == nil, "expected the capability statement bytes to be JSON")
+	th.Assert(t, message.ResponseTimings.TimeToFirstByte > 0, "expected the time to first byte to be recorded")
+
+	// JSON capability statements are recorded as JSON
+	message = Message{}
+	message.RequestedFhirVersion = "None"
+	tc, err = testClientWithNoTLS()
+	th.Assert(t, err == nil, err)
+	defer tc.Close()
+
+	err = requestCapabilityStatementAndSmartOnFhir(ctx, metadataURL, "metadata", &(tc.Client), "", nil, &message)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, message.CapabilityStatementFormat == "json", fmt.Sprintf("expected capability statement format json, got %s", message.CapabilityStatementFormat))
+}
+
 func Test_getTLSVersion(t *testing.T) {
 	var tc *th.TestClient
 	var resp *http.Response
@@ -308,7 +350,7 @@ func Test_requestWithMimeType(t *testing.T) {
 	th.Assert(t, err == nil, err)
 	defer tc.Close()
 
-	httpCode, tlsVersion, mimeMatch, capStat, _, err := requestWithMimeType(req, fhir2LessJSONMIMEType, &(tc.Client))
+	httpCode, tlsVersion, mimeMatch, capStat, _, _, err := requestWithMimeType(req, fhir2LessJSONMIMEType, &(tc.Client))
 	th.Assert(t, err == nil, err)
 	th.Assert(t, httpCode == 200, "expected 200 response")
 	th.Assert(t, tlsVersion == "TLS 1.0", fmt.Sprintf("expected TLS 1.0. got %s", tlsVersion))
@@ -321,7 +363,7 @@ func Test_requestWithMimeType(t *testing.T) {
 	th.Assert(t, err == nil, err)
 	tc.Close() // makes request fail
 
-	_, _, _, _, _, err = requestWithMimeType(req, fhir2LessJSONMIMEType, &(tc.Client))
+	_, _, _, _, _, _, err = requestWithMimeType(req, fhir2LessJSONMIMEType, &(tc.Client))
 	switch errors.Cause(err).(type) {
 	case *url.Error:
 		// expect url.Error because we closed the connection that we're querying.
@@ -333,7 +375,7 @@ func Test_requestWithMimeType(t *testing.T) {
 	tc = th.NewTestClientWith404()
 	defer tc.Close()
 
-	httpCode, _, _, _, _, err = requestWithMimeType(req, fhir2LessJSONMIMEType, &(tc.Client))
+	httpCode, _, _, _, _, _, err = requestWithMimeType(req, fhir2LessJSONMIMEType, &(tc.Client))
 	th.Assert(t, err == nil, err)
 	th.Assert(t, httpCode == 404, fmt.Sprintf("expected 404 response code. Got %d", httpCode))
 }
@@ -364,6 +406,28 @@ func testClientWithContentType(contentType string) (*th.TestClient, error) {
 	return tc, nil
 }
 
+func testClientWithXMLContentType(contentType string) (*th.TestClient, error) {
+	path := filepath.Join("testdata", "metadata.xml")
+	okResponse, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType+"; charset=utf-8")
+
+		if r.Header.Get("Accept") != fhir2LessXMLMIMEType && r.Header.Get("Accept") != fhir3PlusXMLMIMEType {
+			http.Error(w, "sample 406 error", http.StatusNotAcceptable)
+		} else {
+			_, _ = w.Write(okResponse)
+		}
+	})
+
+	tc := th.NewTestClientNoTLS(h)
+
+	return tc, nil
+}
+
 func testClientOnlyAcceptGivenType(contentType string) (*th.TestClient, error) {
 	path := filepath.Join("testdata", "metadata.json")
 	okResponse, err := os.ReadFile(path)
@@ -416,6 +480,65 @@ func testClientWithNoTLS() (*th.TestClient, error) {
 	return tc, nil
 }
 
+func Test_queryCapabilityStatementBudget(t *testing.T) {
+	var blockMetadata, blockUDAP bool
+	var probes int32
+	fhirServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/metadata"):
+			if blockMetadata {
+				<-r.Context().Done()
+				return
+			}
+			w.Header().Set("Content-Type", fhir3PlusJSONMIMEType)
+			_, _ = w.Write([]byte("{\"resourceType\": \"CapabilityStatement\"}"))
+		case strings.HasSuffix(r.URL.Path, "/.well-known/smart-configuration"):
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			atomic.AddInt32(&probes, 1)
+			if blockUDAP && strings.HasSuffix(r.URL.Path, "/.well-known/udap") {
+				<-r.Context().Done()
+				return
+			}
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer fhirServer.Close()
+
+	defaultBudget := CapabilityStatementBudget
+	defer func() { CapabilityStatementBudget = defaultBudget }()
+	CapabilityStatementBudget = 200 * time.Millisecond
+
+	// the other requests are made to endpoints that responded
+	message, err := queryCapabilityStatement(context.Background(), fhirServer.Client(), fhirServer.URL+"/", "None", "", "", []string{fhir3PlusJSONMIMEType}, nil, optionalQueries{})
+	th.Assert(t, err == nil, err)
+	th.Assert(t, message.HTTPResponse == http.StatusOK, fmt.Sprintf("expected the capability statement to be returned, got %d", message.HTTPResponse))
+	th.Assert(t, message.UDAPInfo != nil && message.UDAPInfo.HTTPResponse == http.StatusNotFound, fmt.Sprintf("expected the UDAP metadata to be requested, got %+v", message.UDAPInfo))
+	th.Assert(t, message.CDSHooksInfo != nil && message.CDSHooksInfo.HTTPResponse == http.StatusNotFound, fmt.Sprintf("expected the CDS Hooks discovery document to be requested, got %+v", message.CDSHooksInfo))
+
+	// a request cut short by the end of the job is not recorded, and the requests after it are not made
+	blockUDAP = true
+	atomic.StoreInt32(&probes, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	message, err = queryCapabilityStatement(ctx, fhirServer.Client(), fhirServer.URL+"/", "None", "", "", []string{fhir3PlusJSONMIMEType}, nil, optionalQueries{})
+	th.Assert(t, err == nil, err)
+	th.Assert(t, message.HTTPResponse == http.StatusOK, fmt.Sprintf("expected the capability statement to be returned, got %d", message.HTTPResponse))
+	th.Assert(t, message.ErrorCode == "", fmt.Sprintf("did not expect an error code, got %s", message.ErrorCode))
+	th.Assert(t, message.UDAPInfo == nil, fmt.Sprintf("did not expect the UDAP metadata request that was cut short to be recorded, got %+v", message.UDAPInfo))
+	th.Assert(t, message.CDSHooksInfo == nil, "did not expect the CDS Hooks discovery document to be requested after the end of the job")
+	th.Assert(t, atomic.LoadInt32(&probes) == 1, fmt.Sprintf("expected only the UDAP metadata to be requested, got %d requests", probes))
+
+	// the capability statement request has its own budget, and the other requests are not made when it times out
+	blockMetadata = true
+	atomic.StoreInt32(&probes, 0)
+	message, err = queryCapabilityStatement(context.Background(), fhirServer.Client(), fhirServer.URL+"/", "None", "", "", []string{fhir3PlusJSONMIMEType}, nil, optionalQueries{})
+	th.Assert(t, err == nil, err)
+	th.Assert(t, message.ErrorCode == endpointmanager.TimeoutCode, fmt.Sprintf("expected error code %s, got %s", endpointmanager.TimeoutCode, message.ErrorCode))
+	th.Assert(t, message.UDAPInfo == nil && message.CDSHooksInfo == nil, "did not expect the other requests to be made to an endpoint that did not respond")
+	th.Assert(t, atomic.LoadInt32(&probes) == 0, fmt.Sprintf("did not expect any other requests, got %d", probes))
+}
+
 func capabilityStatement() ([]byte, error) {
 	path := filepath.Join("testdata", "metadata.json")
 	expectedCapStat, err := os.ReadFile(path)
@@ -0,0 +1,56 @@
+package capabilityquerier
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/cdshooksparser"
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+)
+
+// maxCDSHooksDiscoverySize is the most of a CDS Hooks discovery response that is read
+var maxCDSHooksDiscoverySize int64 = 1 << 20
+
+// fetchCDSHooksDiscovery requests the CDS Hooks discovery document at discoveryURL and records the services it lists.
+// Problems retrieving or parsing the document are recorded in the returned CDSHooksInfo's Error rather than returned.
+func fetchCDSHooksDiscovery(ctx context.Context, client *http.Client, discoveryURL string, userAgent string) *endpointmanager.CDSHooksInfo {
+	cdsHooksInfo := &endpointmanager.CDSHooksInfo{
+		URL: discoveryURL,
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", discoveryURL, nil)
+	if err != nil {
+		cdsHooksInfo.Error = "unable to create new GET request from CDS Hooks discovery URL: " + err.Error()
+		return cdsHooksInfo
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		cdsHooksInfo.Error = fmt.Sprintf("making the GET request to %s failed: %s", discoveryURL, err.Error())
+		return cdsHooksInfo
+	}
+	defer resp.Body.Close()
+
+	cdsHooksInfo.HTTPResponse = resp.StatusCode
+	if resp.StatusCode != http.StatusOK {
+		cdsHooksInfo.Error = fmt.Sprintf("the CDS Hooks discovery URL returned HTTP status %d", resp.StatusCode)
+		return cdsHooksInfo
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxCDSHooksDiscoverySize))
+	if err != nil {
+		cdsHooksInfo.Error = "reading the CDS Hooks discovery response failed: " + err.Error()
+		return cdsHooksInfo
+	}
+
+	cdsHooksInfo.Services, err = cdshooksparser.ParseDiscovery(body)
+	if err != nil {
+		cdsHooksInfo.Error = err.Error()
+	}
+
+	return cdsHooksInfo
+}
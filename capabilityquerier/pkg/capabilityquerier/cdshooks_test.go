@@ -0,0 +1,45 @@
+package capabilityquerier
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	th "github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/testhelper"
+)
+
+func Test_fetchCDSHooksDiscovery(t *testing.T) {
+	ctx := context.Background()
+	client := createHTTPClient(nil, nil)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/fhir/cds-services", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"services": [
+			{"hook": "patient-view", "id": "static-patient-view", "title": "Static CDS Service", "prefetch": {"patient": "Patient/{{context.patientId}}"}},
+			{"hook": "order-select", "id": "order-echo"}
+		]}`)
+	})
+	mux.HandleFunc("/html/cds-services", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html></html>`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	cdsHooksInfo := fetchCDSHooksDiscovery(ctx, client, server.URL+"/fhir/cds-services", "LANTERN")
+	th.Assert(t, cdsHooksInfo.Error == "", fmt.Sprintf("expected no error, got %s", cdsHooksInfo.Error))
+	th.Assert(t, cdsHooksInfo.HTTPResponse == 200, fmt.Sprintf("expected HTTP response 200, got %d", cdsHooksInfo.HTTPResponse))
+	th.Assert(t, len(cdsHooksInfo.Services) == 2, fmt.Sprintf("expected 2 services, got %v", cdsHooksInfo.Services))
+	th.Assert(t, cdsHooksInfo.Services[0].Prefetch["patient"] == "Patient/{{context.patientId}}", fmt.Sprintf("unexpected prefetch templates %v", cdsHooksInfo.Services[0].Prefetch))
+
+	// not published
+	cdsHooksInfo = fetchCDSHooksDiscovery(ctx, client, server.URL+"/missing/cds-services", "LANTERN")
+	th.Assert(t, cdsHooksInfo.HTTPResponse == 404, fmt.Sprintf("expected HTTP response 404, got %d", cdsHooksInfo.HTTPResponse))
+	th.Assert(t, cdsHooksInfo.Error != "", "expected an error for a discovery document that is not published")
+
+	// not JSON
+	cdsHooksInfo = fetchCDSHooksDiscovery(ctx, client, server.URL+"/html/cds-services", "LANTERN")
+	th.Assert(t, cdsHooksInfo.Error != "", "expected an error for a response that is not JSON")
+	th.Assert(t, cdsHooksInfo.Services == nil, "expected no services for a response that is not JSON")
+}
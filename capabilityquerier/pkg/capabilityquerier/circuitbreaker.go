@@ -0,0 +1,212 @@
+package capabilityquerier
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+	"github.com/pkg/errors"
+)
+
+// CircuitBreaker stops requests to hosts that are failing, so that when a vendor's platform is down the workers
+// do not each wait out the request timeout for every one of the host's endpoints. A host's circuit opens after
+// failureThreshold consecutive failed requests. While it is open, requests to the host fail immediately with the
+// CircuitOpenCode error code. Once the cooldown has passed, the circuit is half-open and a single trial request is
+// made: the circuit closes if it succeeds and opens again if it fails. A single CircuitBreaker is meant to be
+// shared by all of the workers making requests.
+type CircuitBreaker struct {
+	failureThreshold int
+	cooldown         time.Duration
+	onTransition     func(endpointmanager.HostCircuitEvent)
+	now              func() time.Time
+
+	mu    sync.Mutex
+	hosts map[string]*hostCircuit
+}
+
+type hostCircuit struct {
+	state         endpointmanager.CircuitState
+	failures      int
+	openedAt      time.Time
+	trialInFlight bool
+}
+
+// requestOutcome is the result of a request as far as the CircuitBreaker is concerned
+type requestOutcome int
+
+const (
+	requestSucceeded requestOutcome = iota
+	requestFailed
+	// requestAbandoned is a request that was canceled by the caller, which says nothing about the host
+	requestAbandoned
+)
+
+// NewCircuitBreaker creates a CircuitBreaker that opens a host's circuit after failureThreshold consecutive
+// failures and makes a trial request once cooldown has passed. A failureThreshold less than or equal to 0 leaves
+// the circuits closed. onTransition, if it is not nil, is called with each change of a host's circuit state.
+func NewCircuitBreaker(failureThreshold int, cooldown time.Duration, onTransition func(endpointmanager.HostCircuitEvent)) *CircuitBreaker {
+	return &CircuitBreaker{
+		failureThreshold: failureThreshold,
+		cooldown:         cooldown,
+		onTransition:     onTransition,
+		now:              time.Now,
+		hosts:            make(map[string]*hostCircuit),
+	}
+}
+
+// State returns the current state of the host's circuit
+func (cb *CircuitBreaker) State(host string) endpointmanager.CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.hostCircuit(host).state
+}
+
+// Allow checks whether a request can be made to the host. It returns an error with the CircuitOpenCode error
+// code if the host's circuit is open. Every allowed request must be followed by a call to record.
+func (cb *CircuitBreaker) Allow(host string) error {
+	if cb.failureThreshold <= 0 {
+		return nil
+	}
+
+	var events []endpointmanager.HostCircuitEvent
+	err := func() error {
+		cb.mu.Lock()
+		defer cb.mu.Unlock()
+
+		circuit := cb.hostCircuit(host)
+		switch circuit.state {
+		case endpointmanager.CircuitOpen:
+			if cb.now().Sub(circuit.openedAt) < cb.cooldown {
+				return circuitOpenError(host)
+			}
+			events = append(events, cb.transition(host, circuit, endpointmanager.CircuitHalfOpen))
+			circuit.trialInFlight = true
+		case endpointmanager.CircuitHalfOpen:
+			if circuit.trialInFlight {
+				return circuitOpenError(host)
+			}
+			circuit.trialInFlight = true
+		}
+		return nil
+	}()
+
+	cb.notify(events)
+	return err
+}
+
+// record updates the host's circuit with the outcome of a request that Allow allowed
+func (cb *CircuitBreaker) record(host string, outcome requestOutcome) {
+	if cb.failureThreshold <= 0 {
+		return
+	}
+
+	var events []endpointmanager.HostCircuitEvent
+	func() {
+		cb.mu.Lock()
+		defer cb.mu.Unlock()
+
+		circuit := cb.hostCircuit(host)
+		switch outcome {
+		case requestSucceeded:
+			if circuit.state != endpointmanager.CircuitClosed {
+				events = append(events, cb.transition(host, circuit, endpointmanager.CircuitClosed))
+			}
+			circuit.failures = 0
+			circuit.trialInFlight = false
+		case requestFailed:
+			circuit.failures++
+			if circuit.state == endpointmanager.CircuitHalfOpen ||
+				(circuit.state == endpointmanager.CircuitClosed && circuit.failures >= cb.failureThreshold) {
+				events = append(events, cb.transition(host, circuit, endpointmanager.CircuitOpen))
+				circuit.openedAt = cb.now()
+			}
+			circuit.trialInFlight = false
+		case requestAbandoned:
+			// a canceled trial request lets the next request to the host be the trial instead
+			circuit.trialInFlight = false
+		}
+	}()
+
+	cb.notify(events)
+}
+
+// hostCircuit must be called with cb.mu held
+func (cb *CircuitBreaker) hostCircuit(host string) *hostCircuit {
+	circuit, ok := cb.hosts[host]
+	if !ok {
+		circuit = &hostCircuit{state: endpointmanager.CircuitClosed}
+		cb.hosts[host] = circuit
+	}
+	return circuit
+}
+
+// transition must be called with cb.mu held
+func (cb *CircuitBreaker) transition(host string, circuit *hostCircuit, to endpointmanager.CircuitState) endpointmanager.HostCircuitEvent {
+	event := endpointmanager.HostCircuitEvent{
+		Host:                host,
+		FromState:           circuit.state,
+		ToState:             to,
+		ConsecutiveFailures: circuit.failures,
+	}
+	circuit.state = to
+	return event
+}
+
+// notify calls onTransition outside of the lock, since it may be slow, such as saving the event to the database
+func (cb *CircuitBreaker) notify(events []endpointmanager.HostCircuitEvent) {
+	if cb.onTransition == nil {
+		return
+	}
+	for _, event := range events {
+		cb.onTransition(event)
+	}
+}
+
+func circuitOpenError(host string) error {
+	return withErrorCode(errors.Errorf("the circuit breaker for %s is open after repeated failures", host), endpointmanager.CircuitOpenCode)
+}
+
+// isHostFailureStatus checks whether a response status means that the host, rather than the endpoint, is failing
+func isHostFailureStatus(statusCode int) bool {
+	return statusCode == http.StatusBadGateway || statusCode == http.StatusServiceUnavailable || statusCode == http.StatusGatewayTimeout
+}
+
+// breakerTransport is an http.RoundTripper that checks a CircuitBreaker before each request and records the
+// outcome of each request with it. Errors making the request and 502, 503 and 504 responses are failures. Errors
+// from before a connection to the host was attempted, such as running out of time while waiting on the
+// HostScheduler, and requests that were canceled say nothing about the host and are recorded as abandoned.
+type breakerTransport struct {
+	base    http.RoundTripper
+	breaker *CircuitBreaker
+}
+
+func (bt *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Hostname()
+	err := bt.breaker.Allow(host)
+	if err != nil {
+		return nil, err
+	}
+
+	var connAttempted int32
+	trace := &httptrace.ClientTrace{
+		GetConn: func(hostPort string) {
+			atomic.StoreInt32(&connAttempted, 1)
+		},
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+
+	resp, err := bt.base.RoundTrip(req)
+	switch {
+	case err != nil && (atomic.LoadInt32(&connAttempted) == 0 || req.Context().Err() == context.Canceled):
+		bt.breaker.record(host, requestAbandoned)
+	case err != nil || isHostFailureStatus(resp.StatusCode):
+		bt.breaker.record(host, requestFailed)
+	default:
+		bt.breaker.record(host, requestSucceeded)
+	}
+	return resp, err
+}
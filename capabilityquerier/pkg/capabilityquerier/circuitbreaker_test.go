@@ -0,0 +1,155 @@
+package capabilityquerier
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+	th "github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/testhelper"
+	"github.com/pkg/errors"
+)
+
+func Test_CircuitBreaker(t *testing.T) {
+	now := time.Date(2026, time.October, 1, 0, 0, 0, 0, time.UTC)
+	var events []endpointmanager.HostCircuitEvent
+	cb := NewCircuitBreaker(3, time.Minute, func(event endpointmanager.HostCircuitEvent) {
+		events = append(events, event)
+	})
+	cb.now = func() time.Time { return now }
+	host := "fhir.example.com"
+
+	// failures below the threshold, and failures that are not consecutive, leave the circuit closed
+	for i := 0; i < 2; i++ {
+		th.Assert(t, cb.Allow(host) == nil, "expected requests to be allowed while the circuit is closed")
+		cb.record(host, requestFailed)
+	}
+	th.Assert(t, cb.Allow(host) == nil, "expected requests to be allowed while the circuit is closed")
+	cb.record(host, requestSucceeded)
+	for i := 0; i < 2; i++ {
+		th.Assert(t, cb.Allow(host) == nil, "expected requests to be allowed while the circuit is closed")
+		cb.record(host, requestFailed)
+	}
+	th.Assert(t, cb.State(host) == endpointmanager.CircuitClosed, fmt.Sprintf("expected the circuit to be closed, got %s", cb.State(host)))
+	th.Assert(t, len(events) == 0, fmt.Sprintf("did not expect any transitions, got %v", events))
+
+	// the third consecutive failure opens the circuit
+	th.Assert(t, cb.Allow(host) == nil, "expected requests to be allowed while the circuit is closed")
+	cb.record(host, requestFailed)
+	th.Assert(t, cb.State(host) == endpointmanager.CircuitOpen, fmt.Sprintf("expected the circuit to be open, got %s", cb.State(host)))
+	th.Assert(t, len(events) == 1, fmt.Sprintf("expected 1 transition, got %v", events))
+	th.Assert(t, events[0].FromState == endpointmanager.CircuitClosed && events[0].ToState == endpointmanager.CircuitOpen, fmt.Sprintf("expected the circuit to open, got %+v", events[0]))
+	th.Assert(t, events[0].ConsecutiveFailures == 3, fmt.Sprintf("expected 3 consecutive failures, got %d", events[0].ConsecutiveFailures))
+
+	// requests short-circuit while the circuit is open, and other hosts are not affected
+	err := cb.Allow(host)
+	th.Assert(t, err != nil, "expected requests to be short-circuited while the circuit is open")
+	code := classifyError(err)
+	th.Assert(t, code == endpointmanager.CircuitOpenCode, fmt.Sprintf("expected error code %s, got %s", endpointmanager.CircuitOpenCode, code))
+	th.Assert(t, cb.Allow("other.example.com") == nil, "expected requests to other hosts to be allowed")
+	cb.record("other.example.com", requestSucceeded)
+
+	// after the cooldown a single trial request is allowed, and a failed trial opens the circuit again
+	now = now.Add(time.Minute)
+	th.Assert(t, cb.Allow(host) == nil, "expected a trial request after the cooldown")
+	th.Assert(t, cb.State(host) == endpointmanager.CircuitHalfOpen, fmt.Sprintf("expected the circuit to be half-open, got %s", cb.State(host)))
+	th.Assert(t, cb.Allow(host) != nil, "expected only one trial request while the circuit is half-open")
+	cb.record(host, requestFailed)
+	th.Assert(t, cb.State(host) == endpointmanager.CircuitOpen, fmt.Sprintf("expected the circuit to be open, got %s", cb.State(host)))
+	th.Assert(t, cb.Allow(host) != nil, "expected the cooldown to restart after a failed trial")
+
+	// an abandoned trial lets the next request be the trial, and a successful trial closes the circuit
+	now = now.Add(time.Minute)
+	th.Assert(t, cb.Allow(host) == nil, "expected a trial request after the cooldown")
+	cb.record(host, requestAbandoned)
+	th.Assert(t, cb.Allow(host) == nil, "expected another trial request after an abandoned trial")
+	cb.record(host, requestSucceeded)
+	th.Assert(t, cb.State(host) == endpointmanager.CircuitClosed, fmt.Sprintf("expected the circuit to be closed, got %s", cb.State(host)))
+
+	expected := []endpointmanager.CircuitState{
+		endpointmanager.CircuitOpen,
+		endpointmanager.CircuitHalfOpen,
+		endpointmanager.CircuitOpen,
+		endpointmanager.CircuitHalfOpen,
+		endpointmanager.CircuitClosed,
+	}
+	th.Assert(t, len(events) == len(expected), fmt.Sprintf("expected %d transitions, got %v", len(expected), events))
+	for i, state := range expected {
+		th.Assert(t, events[i].ToState == state, fmt.Sprintf("expected transition %d to be to %s, got %s", i, state, events[i].ToState))
+	}
+}
+
+func Test_CircuitBreakerDisabled(t *testing.T) {
+	cb := NewCircuitBreaker(0, time.Minute, nil)
+	for i := 0; i < 10; i++ {
+		th.Assert(t, cb.Allow("fhir.example.com") == nil, "expected requests to always be allowed when the breaker is disabled")
+		cb.record("fhir.example.com", requestFailed)
+	}
+	th.Assert(t, cb.State("fhir.example.com") == endpointmanager.CircuitClosed, "expected the circuit to stay closed when the breaker is disabled")
+}
+
+func Test_breakerTransport(t *testing.T) {
+	requests := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer s.Close()
+	serverURL, err := url.Parse(s.URL)
+	th.Assert(t, err == nil, err)
+
+	cb := NewCircuitBreaker(2, time.Hour, nil)
+	client := createHTTPClient(nil, cb)
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(s.URL)
+		th.Assert(t, err == nil, err)
+		resp.Body.Close()
+	}
+	th.Assert(t, cb.State(serverURL.Hostname()) == endpointmanager.CircuitOpen, fmt.Sprintf("expected 502 responses to open the circuit, got %s", cb.State(serverURL.Hostname())))
+
+	_, err = client.Get(s.URL)
+	th.Assert(t, err != nil, "expected the request to be short-circuited")
+	code := classifyError(err)
+	th.Assert(t, code == endpointmanager.CircuitOpenCode, fmt.Sprintf("expected error code %s, got %s", endpointmanager.CircuitOpenCode, code))
+	th.Assert(t, requests == 2, fmt.Sprintf("expected the short-circuited request not to reach the server, got %d requests", requests))
+}
+
+func Test_breakerTransportSchedulerTimeout(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	serverURL, err := url.Parse(s.URL)
+	th.Assert(t, err == nil, err)
+
+	hs := NewHostScheduler(1, 0)
+	cb := NewCircuitBreaker(2, time.Hour, nil)
+	client := createHTTPClient(hs, cb)
+
+	// requests that run out of time while queued behind another request to the host were never sent
+	release, _, err := hs.Wait(context.Background(), serverURL.Hostname())
+	th.Assert(t, err == nil, err)
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+		th.Assert(t, err == nil, err)
+		_, err = client.Do(req)
+		cancel()
+		var waitErr *schedulerWaitError
+		th.Assert(t, errors.As(err, &waitErr), fmt.Sprintf("expected the request to time out waiting on the scheduler, got %v", err))
+	}
+	th.Assert(t, cb.State(serverURL.Hostname()) == endpointmanager.CircuitClosed, fmt.Sprintf("expected the circuit to stay closed when requests time out in the scheduler, got %s", cb.State(serverURL.Hostname())))
+	release()
+
+	// requests that could not connect to the host are still failures
+	s.Close()
+	for i := 0; i < 2; i++ {
+		_, err = client.Get(s.URL)
+		th.Assert(t, err != nil, "expected the request to a closed server to fail")
+	}
+	th.Assert(t, cb.State(serverURL.Hostname()) == endpointmanager.CircuitOpen, fmt.Sprintf("expected failed connections to open the circuit, got %s", cb.State(serverURL.Hostname())))
+}
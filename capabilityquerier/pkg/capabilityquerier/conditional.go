@@ -0,0 +1,52 @@
+package capabilityquerier
+
+import (
+	"net/http"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+)
+
+// cacheValidators are the ETag and Last-Modified of the capability statement last received from an endpoint. They
+// are sent with the next request so that the endpoint can respond with 304 Not Modified if the capability
+// statement has not changed, rather than sending it again.
+type cacheValidators struct {
+	ETag         string
+	LastModified string
+}
+
+// cacheValidatorsFor returns the cache validators of the endpoint's saved capability statement, which are kept
+// with the response headers of the endpoint's latest metadata. nil is returned if there are none. Conditional
+// requests are only made when the capability statement and its MIME type are saved, since a 304 response
+// includes neither.
+func cacheValidatorsFor(endpt *endpointmanager.FHIREndpointInfo) *cacheValidators {
+	if endpt == nil || endpt.Metadata == nil || endpt.CapabilityStatement == nil || len(endpt.MIMETypes) != 1 {
+		return nil
+	}
+	if endpt.Metadata.HTTPResponse != http.StatusOK {
+		return nil
+	}
+	validators := cacheValidators{
+		ETag:         endpt.Metadata.ResponseHeaders["ETag"],
+		LastModified: endpt.Metadata.ResponseHeaders["Last-Modified"],
+	}
+	if validators.ETag == "" && validators.LastModified == "" {
+		return nil
+	}
+	return &validators
+}
+
+// setHeaders makes req a conditional request using the cache validators
+func (cv *cacheValidators) setHeaders(req *http.Request) {
+	if cv.ETag != "" {
+		req.Header.Set("If-None-Match", cv.ETag)
+	}
+	if cv.LastModified != "" {
+		req.Header.Set("If-Modified-Since", cv.LastModified)
+	}
+}
+
+// clearCacheValidators removes the conditional request headers from req
+func clearCacheValidators(req *http.Request) {
+	req.Header.Del("If-None-Match")
+	req.Header.Del("If-Modified-Since")
+}
@@ -0,0 +1,102 @@
+package capabilityquerier
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/capabilityparser"
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+	th "github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/testhelper"
+)
+
+func Test_cacheValidatorsFor(t *testing.T) {
+	csJSON, err := os.ReadFile(filepath.Join("testdata", "metadata.json"))
+	th.Assert(t, err == nil, err)
+	cs, err := capabilityparser.NewCapabilityStatement(csJSON)
+	th.Assert(t, err == nil, err)
+
+	endpt := &endpointmanager.FHIREndpointInfo{
+		CapabilityStatement: cs,
+		MIMETypes:           []string{fhir3PlusJSONMIMEType},
+		Metadata: &endpointmanager.FHIREndpointMetadata{
+			HTTPResponse:    http.StatusOK,
+			ResponseHeaders: map[string]string{"ETag": "W/\"1\"", "Last-Modified": "Mon, 05 Oct 2026 10:00:00 GMT"},
+		},
+	}
+	validators := cacheValidatorsFor(endpt)
+	th.Assert(t, validators != nil, "expected cache validators")
+	th.Assert(t, validators.ETag == "W/\"1\"", fmt.Sprintf("expected ETag W/\"1\", got %s", validators.ETag))
+	th.Assert(t, validators.LastModified == "Mon, 05 Oct 2026 10:00:00 GMT", fmt.Sprintf("expected Last-Modified Mon, 05 Oct 2026 10:00:00 GMT, got %s", validators.LastModified))
+
+	endpt.Metadata.NotModified = true
+	th.Assert(t, cacheValidatorsFor(endpt) != nil, "expected cache validators after a 304 response")
+	endpt.Metadata.NotModified = false
+
+	endpt.Metadata.HTTPResponse = http.StatusInternalServerError
+	th.Assert(t, cacheValidatorsFor(endpt) == nil, "did not expect cache validators after an error response")
+	endpt.Metadata.HTTPResponse = http.StatusOK
+
+	endpt.MIMETypes = []string{}
+	th.Assert(t, cacheValidatorsFor(endpt) == nil, "did not expect cache validators without a saved MIME type")
+	endpt.MIMETypes = []string{fhir3PlusJSONMIMEType}
+
+	endpt.CapabilityStatement = nil
+	th.Assert(t, cacheValidatorsFor(endpt) == nil, "did not expect cache validators without a saved capability statement")
+	endpt.CapabilityStatement = cs
+
+	endpt.Metadata.ResponseHeaders = map[string]string{"Server": "test"}
+	th.Assert(t, cacheValidatorsFor(endpt) == nil, "did not expect cache validators without an ETag or Last-Modified header")
+
+	th.Assert(t, cacheValidatorsFor(nil) == nil, "did not expect cache validators for an endpoint that has not been queried")
+}
+
+func Test_requestCapabilityStatementAndSmartOnFhirNotModified(t *testing.T) {
+	ctx := context.Background()
+	metadataURL := endpointmanager.NormalizeEndpointURL(sampleURLNoTLS)
+
+	requests := 0
+	var ifNoneMatch []string
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		ifNoneMatch = append(ifNoneMatch, r.Header.Get("If-None-Match"))
+		if r.Header.Get("If-None-Match") == "\"v1\"" {
+			w.Header().Set("ETag", "\"v1\"")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", fhir3PlusJSONMIMEType)
+		w.Header().Set("ETag", "\"v2\"")
+		_, _ = w.Write([]byte("{\"resourceType\": \"CapabilityStatement\"}"))
+	})
+	tc := th.NewTestClientNoTLS(h)
+	defer tc.Close()
+
+	// the capability statement has not changed
+	message := Message{}
+	message.RequestedFhirVersion = "None"
+	message.MIMETypes = []string{fhir3PlusJSONMIMEType}
+	err := requestCapabilityStatementAndSmartOnFhir(ctx, metadataURL, "metadata", &(tc.Client), "", &cacheValidators{ETag: "\"v1\""}, &message)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, requests == 1, fmt.Sprintf("expected the other MIME types not to be tried after a 304 response, got %d requests", requests))
+	th.Assert(t, message.HTTPResponse == http.StatusNotModified, fmt.Sprintf("expected HTTP response 304, got %d", message.HTTPResponse))
+	th.Assert(t, message.CapabilityStatement == nil, "did not expect a capability statement for a 304 response")
+	th.Assert(t, len(message.MIMETypes) == 1 && message.MIMETypes[0] == fhir3PlusJSONMIMEType, fmt.Sprintf("expected the saved MIME type to be kept, got %v", message.MIMETypes))
+	th.Assert(t, message.ResponseHeaders["ETag"] == "\"v1\"", fmt.Sprintf("expected ETag \"v1\", got %s", message.ResponseHeaders["ETag"]))
+
+	// the capability statement has changed
+	requests = 0
+	ifNoneMatch = nil
+	message = Message{}
+	message.RequestedFhirVersion = "None"
+	message.MIMETypes = []string{fhir2LessJSONMIMEType}
+	err = requestCapabilityStatementAndSmartOnFhir(ctx, metadataURL, "metadata", &(tc.Client), "", &cacheValidators{ETag: "\"v0\""}, &message)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, message.HTTPResponse == http.StatusOK, fmt.Sprintf("expected HTTP response 200, got %d", message.HTTPResponse))
+	th.Assert(t, message.CapabilityStatement != nil, "expected a capability statement")
+	th.Assert(t, message.ResponseHeaders["ETag"] == "\"v2\"", fmt.Sprintf("expected ETag \"v2\", got %s", message.ResponseHeaders["ETag"]))
+	th.Assert(t, ifNoneMatch[0] == "\"v0\"", fmt.Sprintf("expected the first request to be conditional, got If-None-Match %s", ifNoneMatch[0]))
+}
@@ -0,0 +1,223 @@
+package capabilityquerier
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+	"github.com/pkg/errors"
+)
+
+// dataExposureSearches are the searches for patient data made without authorization. Each asks for a single
+// resource so that as little data as possible is returned by an endpoint that does not protect it.
+var dataExposureSearches = []string{
+	"Patient?_count=1",
+	"Observation?_count=1",
+	"Condition?_count=1",
+	"MedicationRequest?_count=1",
+	"Encounter?_count=1",
+}
+
+// maxDataExposureSize is the most of a search response that is read. Servers that ignore _count can return much
+// more than a single resource. The entries are counted as the response is read, so a response that is cut off at
+// this size still counts every entry that it started.
+var maxDataExposureSize int64 = 4 << 20
+
+// fhirNamespace is the XML namespace of FHIR resources
+const fhirNamespace = "http://hl7.org/fhir"
+
+// searchBundle is the part of a search response that is kept. The entries are counted without holding on to their
+// content.
+type searchBundle struct {
+	ResourceType string
+	Total        *int
+	EntryCount   int
+}
+
+// probeDataExposure makes each of the dataExposureSearches against the FHIR endpoint at baseURL without any
+// authorization and records the shape of each response
+func probeDataExposure(ctx context.Context, client *http.Client, baseURL string, userAgent string) []endpointmanager.DataExposureCheck {
+	checks := make([]endpointmanager.DataExposureCheck, 0, len(dataExposureSearches))
+	for _, search := range dataExposureSearches {
+		checks = append(checks, requestDataExposureCheck(ctx, client, baseURL, search, userAgent))
+	}
+	return checks
+}
+
+// requestDataExposureCheck makes a single search against the FHIR endpoint at baseURL without any authorization.
+// Problems making the search or parsing its response are recorded in the returned DataExposureCheck's Error.
+func requestDataExposureCheck(ctx context.Context, client *http.Client, baseURL string, search string, userAgent string) endpointmanager.DataExposureCheck {
+	check := endpointmanager.DataExposureCheck{
+		Search: search,
+	}
+
+	searchURL := endpointmanager.NormalizeURL(strings.TrimSuffix(baseURL, "/") + "/" + search)
+	req, err := http.NewRequestWithContext(ctx, "GET", searchURL, nil)
+	if err != nil {
+		check.Error = "unable to create new GET request from search URL: " + err.Error()
+		return check
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "application/fhir+json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		check.Error = fmt.Sprintf("making the GET request to %s failed: %s", searchURL, err.Error())
+		return check
+	}
+	defer resp.Body.Close()
+
+	check.HTTPResponse = resp.StatusCode
+
+	reader := bufio.NewReader(io.LimitReader(resp.Body, maxDataExposureSize))
+	bundle, err := decodeSearchBundle(reader)
+	check.ResourceType = bundle.ResourceType
+	check.Total = bundle.Total
+	check.EntryCount = bundle.EntryCount
+	if err != nil {
+		// Responses to searches that were refused are often not FHIR resources, so only a 200 response that could
+		// not be read is an error. The entries found before the error are kept, since a server that returns more
+		// than the size limit is the one exposing the most data.
+		if resp.StatusCode == http.StatusOK && bundle.EntryCount > 0 {
+			check.Error = fmt.Sprintf("the search response could only be read up to entry %d: %s", bundle.EntryCount, err.Error())
+		} else if resp.StatusCode == http.StatusOK {
+			check.Error = "the search response is not a FHIR resource: " + err.Error()
+		}
+	}
+
+	return check
+}
+
+// decodeSearchBundle reads a search response in either the JSON or the XML format, depending on its first
+// character. A partial searchBundle is returned along with the error if the response could not be read to the end.
+func decodeSearchBundle(reader *bufio.Reader) (searchBundle, error) {
+	for {
+		c, err := reader.ReadByte()
+		if err != nil {
+			return searchBundle{}, errors.Wrap(err, "the response is empty")
+		}
+		switch c {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		err = reader.UnreadByte()
+		if err != nil {
+			return searchBundle{}, err
+		}
+		switch c {
+		case '{':
+			return decodeJSONSearchBundle(reader)
+		case '<':
+			return decodeXMLSearchBundle(reader)
+		default:
+			return searchBundle{}, errors.New("the response is neither JSON nor XML")
+		}
+	}
+}
+
+// decodeJSONSearchBundle reads a JSON search response a token at a time, counting the entries as they are read
+func decodeJSONSearchBundle(r io.Reader) (searchBundle, error) {
+	var bundle searchBundle
+	dec := json.NewDecoder(r)
+
+	_, err := dec.Token() // the opening {
+	if err != nil {
+		return bundle, err
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return bundle, err
+		}
+		switch key {
+		case "resourceType":
+			err = dec.Decode(&bundle.ResourceType)
+		case "total":
+			err = dec.Decode(&bundle.Total)
+		case "entry":
+			err = countJSONEntries(dec, &bundle)
+		default:
+			var skipped json.RawMessage
+			err = dec.Decode(&skipped)
+		}
+		if err != nil {
+			return bundle, err
+		}
+	}
+	return bundle, nil
+}
+
+// countJSONEntries counts the elements of the entry array that dec is at. An entry is counted as soon as it starts.
+func countJSONEntries(dec *json.Decoder, bundle *searchBundle) error {
+	token, err := dec.Token()
+	if err != nil || token == nil {
+		return err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return errors.New("the Bundle's entry is not an array")
+	}
+	for dec.More() {
+		bundle.EntryCount++
+		var skipped json.RawMessage
+		err = dec.Decode(&skipped)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = dec.Token() // the closing ]
+	return err
+}
+
+// decodeXMLSearchBundle reads an XML search response an element at a time, counting the Bundle's entry elements as
+// they start
+func decodeXMLSearchBundle(r io.Reader) (searchBundle, error) {
+	var bundle searchBundle
+	dec := xml.NewDecoder(r)
+
+	depth := 0
+	for {
+		token, err := dec.Token()
+		if err == io.EOF {
+			return bundle, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return bundle, err
+		}
+
+		switch element := token.(type) {
+		case xml.StartElement:
+			depth++
+			switch {
+			case depth == 1:
+				if element.Name.Space != fhirNamespace {
+					return bundle, errors.Errorf("the root element %s is not in the FHIR namespace", element.Name.Local)
+				}
+				bundle.ResourceType = element.Name.Local
+			case depth == 2 && element.Name.Local == "total":
+				for _, attr := range element.Attr {
+					if attr.Name.Local != "value" {
+						continue
+					}
+					total, err := strconv.Atoi(attr.Value)
+					if err == nil {
+						bundle.Total = &total
+					}
+				}
+			case depth == 2 && element.Name.Local == "entry":
+				bundle.EntryCount++
+			}
+		case xml.EndElement:
+			depth--
+			if depth == 0 {
+				return bundle, nil
+			}
+		}
+	}
+}
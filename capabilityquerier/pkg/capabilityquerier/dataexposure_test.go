@@ -0,0 +1,121 @@
+package capabilityquerier
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	th "github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/testhelper"
+)
+
+func Test_probeDataExposure(t *testing.T) {
+	ctx := context.Background()
+	client := createHTTPClient(nil, nil)
+
+	var authorization []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/fhir/Patient", func(w http.ResponseWriter, r *http.Request) {
+		authorization = append(authorization, r.Header.Get("Authorization"))
+		fmt.Fprint(w, `{"resourceType": "Bundle", "type": "searchset", "total": 1200, "entry": [{"resource": {"resourceType": "Patient", "id": "1", "name": [{"family": "Smith"}]}}]}`)
+	})
+	mux.HandleFunc("/fhir/Observation", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"resourceType": "Bundle", "type": "searchset", "total": 0}`)
+	})
+	mux.HandleFunc("/fhir/Condition", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"resourceType": "OperationOutcome", "issue": [{"severity": "error", "code": "login"}]}`)
+	})
+	mux.HandleFunc("/fhir/MedicationRequest", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `<html>Forbidden</html>`)
+	})
+	mux.HandleFunc("/fhir/Encounter", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html>Login</html>`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	checks := probeDataExposure(ctx, client, server.URL+"/fhir/", "LANTERN")
+	th.Assert(t, len(checks) == len(dataExposureSearches), fmt.Sprintf("expected %d searches, got %d", len(dataExposureSearches), len(checks)))
+	th.Assert(t, len(authorization) == 1 && authorization[0] == "", fmt.Sprintf("expected the search to be made without authorization, got %v", authorization))
+
+	// returns patient data
+	patient := checks[0]
+	th.Assert(t, patient.Search == "Patient?_count=1", fmt.Sprintf("expected the Patient search first, got %s", patient.Search))
+	th.Assert(t, patient.HTTPResponse == 200, fmt.Sprintf("expected HTTP response 200, got %d", patient.HTTPResponse))
+	th.Assert(t, patient.ResourceType == "Bundle", fmt.Sprintf("expected a Bundle, got %s", patient.ResourceType))
+	th.Assert(t, patient.Total != nil && *patient.Total == 1200, fmt.Sprintf("expected a total of 1200, got %v", patient.Total))
+	th.Assert(t, patient.EntryCount == 1, fmt.Sprintf("expected 1 entry, got %d", patient.EntryCount))
+	th.Assert(t, patient.Exposed(), "expected the Patient search to expose data")
+
+	// empty Bundle
+	th.Assert(t, checks[1].HTTPResponse == 200 && checks[1].EntryCount == 0, fmt.Sprintf("expected an empty Bundle, got %+v", checks[1]))
+	th.Assert(t, checks[1].Total != nil && *checks[1].Total == 0, fmt.Sprintf("expected a total of 0, got %v", checks[1].Total))
+
+	// refused with an OperationOutcome
+	th.Assert(t, checks[2].HTTPResponse == 401 && checks[2].ResourceType == "OperationOutcome", fmt.Sprintf("expected a 401 OperationOutcome, got %+v", checks[2]))
+	th.Assert(t, checks[2].Total == nil, fmt.Sprintf("expected no total, got %v", checks[2].Total))
+
+	// refused with a response that is not a FHIR resource
+	th.Assert(t, checks[3].HTTPResponse == 403 && checks[3].Error == "", fmt.Sprintf("expected a 403 without an error, got %+v", checks[3]))
+
+	// 200 response that is not a FHIR resource
+	th.Assert(t, checks[4].HTTPResponse == 200 && checks[4].Error != "", fmt.Sprintf("expected a 200 with an error, got %+v", checks[4]))
+	th.Assert(t, !checks[4].Exposed(), "did not expect a response that is not a FHIR resource to expose data")
+}
+
+func Test_probeDataExposureLargeAndXMLResponses(t *testing.T) {
+	defaultMaxDataExposureSize := maxDataExposureSize
+	defer func() { maxDataExposureSize = defaultMaxDataExposureSize }()
+	maxDataExposureSize = 1024
+
+	ctx := context.Background()
+	client := createHTTPClient(nil, nil)
+
+	entry := `{"resource": {"resourceType": "Patient", "id": "1", "name": [{"family": "Smith"}]}}`
+	mux := http.NewServeMux()
+	mux.HandleFunc("/fhir/Patient", func(w http.ResponseWriter, r *http.Request) {
+		// ignores _count and returns more than the size limit
+		entries := strings.TrimSuffix(strings.Repeat(entry+",", 100), ",")
+		fmt.Fprint(w, `{"resourceType": "Bundle", "type": "searchset", "total": 100, "entry": [`+entries+`]}`)
+	})
+	mux.HandleFunc("/fhir/Observation", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/fhir+xml")
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<Bundle xmlns="http://hl7.org/fhir">
+	<type value="searchset"/>
+	<total value="5"/>
+	<entry><resource><Observation><id value="1"/></Observation></resource></entry>
+	<entry><resource><Observation><id value="2"/></Observation></resource></entry>
+</Bundle>`)
+	})
+	mux.HandleFunc("/fhir/Condition", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><html><body>Login</body></html>`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	checks := probeDataExposure(ctx, client, server.URL+"/fhir/", "LANTERN")
+
+	// cut off at the size limit
+	patient := checks[0]
+	th.Assert(t, patient.HTTPResponse == 200 && patient.ResourceType == "Bundle", fmt.Sprintf("expected a 200 Bundle, got %+v", patient))
+	th.Assert(t, patient.EntryCount > 0 && patient.EntryCount < 100, fmt.Sprintf("expected the entries before the size limit to be counted, got %d", patient.EntryCount))
+	th.Assert(t, patient.Error != "", "expected an error saying the response was cut off")
+	th.Assert(t, patient.Exposed(), "expected a response over the size limit to expose data")
+
+	// XML Bundle
+	observation := checks[1]
+	th.Assert(t, observation.HTTPResponse == 200 && observation.ResourceType == "Bundle", fmt.Sprintf("expected a 200 Bundle, got %+v", observation))
+	th.Assert(t, observation.Total != nil && *observation.Total == 5, fmt.Sprintf("expected a total of 5, got %v", observation.Total))
+	th.Assert(t, observation.EntryCount == 2, fmt.Sprintf("expected 2 entries, got %d", observation.EntryCount))
+	th.Assert(t, observation.Error == "", fmt.Sprintf("did not expect an error, got %s", observation.Error))
+	th.Assert(t, observation.Exposed(), "expected the XML Bundle to expose data")
+
+	// XML that is not a FHIR resource
+	condition := checks[2]
+	th.Assert(t, condition.Error != "" && !condition.Exposed(), fmt.Sprintf("expected XML outside the FHIR namespace to be an error, got %+v", condition))
+}
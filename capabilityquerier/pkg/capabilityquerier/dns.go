@@ -0,0 +1,310 @@
+package capabilityquerier
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/hostingprovider"
+	"github.com/pkg/errors"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// maxCNAMEChain is the most canonical names that are followed before a lookup is given up on
+var maxCNAMEChain = 8
+
+// dnsTimeout is how long each DNS query waits for an answer
+var dnsTimeout = 5 * time.Second
+
+// maxUDPSize is the largest DNS response that can be received over UDP without EDNS. Larger responses are
+// truncated by the server and the query is made again over TCP.
+const maxUDPSize = 512
+
+// DNSResolver looks up the DNS records of a FHIR endpoint's host. The querier's resolver can be replaced so that
+// tests resolve hosts against a fake DNS server.
+type DNSResolver interface {
+	// Resolve returns the DNS records of host. Problems resolving the host are recorded in the returned
+	// DNSInfo's Error.
+	Resolve(ctx context.Context, host string) *endpointmanager.DNSInfo
+}
+
+// dnsResolver sends A and AAAA queries to a single recursive DNS server. It is used instead of the resolver in
+// the net package because that one does not return the CNAME chain or the TTLs of the records.
+type dnsResolver struct {
+	server string
+	ranges *hostingprovider.Ranges
+}
+
+// NewDNSResolver returns a DNSResolver that sends its queries to the recursive DNS server at server, given as
+// host:port, and attributes the addresses it finds to the hosting providers of ranges. ranges may be nil, in which
+// case no addresses are attributed.
+func NewDNSResolver(server string, ranges *hostingprovider.Ranges) DNSResolver {
+	return &dnsResolver{server: server, ranges: ranges}
+}
+
+// SystemDNSServer returns the first nameserver in the resolv.conf file at path as host:port
+func SystemDNSServer(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			return net.JoinHostPort(fields[1], "53"), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("no nameserver in %s", path)
+}
+
+func (r *dnsResolver) Resolve(ctx context.Context, host string) *endpointmanager.DNSInfo {
+	info := &endpointmanager.DNSInfo{
+		Host:       host,
+		CNAMEChain: []string{},
+		Addresses:  []endpointmanager.DNSAddress{},
+	}
+
+	// A host that is an IP address is not looked up, but its address is still attributed
+	if ip := net.ParseIP(host); ip != nil {
+		info.Addresses = append(info.Addresses, r.attribute(ip))
+		return info
+	}
+
+	name, err := dnsmessage.NewName(strings.TrimSuffix(host, ".") + ".")
+	if err != nil {
+		info.Error = "invalid host name: " + err.Error()
+		return info
+	}
+
+	ttl := -1
+	var lookupErr error
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		ips, chain, recordsTTL, err := r.lookup(ctx, name, qtype)
+		if err != nil {
+			// Only the first error is kept, since a server that cannot find the A records cannot find the AAAA
+			// records either
+			if lookupErr == nil {
+				lookupErr = err
+			}
+			continue
+		}
+		if len(chain) > len(info.CNAMEChain) {
+			info.CNAMEChain = chain
+		}
+		for _, ip := range ips {
+			info.Addresses = append(info.Addresses, r.attribute(ip))
+		}
+		if recordsTTL >= 0 && (ttl < 0 || recordsTTL < ttl) {
+			ttl = recordsTTL
+		}
+	}
+
+	// Some DNS servers fail AAAA queries for hosts that only have A records, so an error is only recorded when
+	// no addresses were found
+	if len(info.Addresses) == 0 && lookupErr != nil {
+		info.Error = lookupErr.Error()
+	}
+	if ttl >= 0 {
+		info.TTL = ttl
+	}
+	return info
+}
+
+// attribute returns the address of ip with the hosting provider whose range it is in
+func (r *dnsResolver) attribute(ip net.IP) endpointmanager.DNSAddress {
+	address := endpointmanager.DNSAddress{IP: ip.String()}
+	if ipRange, ok := r.ranges.Lookup(ip); ok {
+		address.Provider = ipRange.Provider
+		address.Region = ipRange.Region
+		address.Service = ipRange.Service
+	}
+	return address
+}
+
+// lookup returns the addresses of the qtype records of name, the canonical names that were followed to find
+// them and the smallest TTL of those records. The TTL is -1 if no records were found. Recursive servers usually
+// answer with the whole CNAME chain, but if they only return part of it the rest is queried.
+func (r *dnsResolver) lookup(ctx context.Context, name dnsmessage.Name, qtype dnsmessage.Type) ([]net.IP, []string, int, error) {
+	var chain []string
+	ttl := -1
+	updateTTL := func(recordTTL uint32) {
+		if ttl < 0 || int(recordTTL) < ttl {
+			ttl = int(recordTTL)
+		}
+	}
+
+	for len(chain) <= maxCNAMEChain {
+		resp, err := r.exchange(ctx, name, qtype)
+		if err != nil {
+			return nil, nil, -1, err
+		}
+		if resp.RCode == dnsmessage.RCodeNameError {
+			return nil, nil, -1, fmt.Errorf("no such host %s", strings.TrimSuffix(name.String(), "."))
+		}
+		if resp.RCode != dnsmessage.RCodeSuccess {
+			return nil, nil, -1, fmt.Errorf("the DNS server answered the %s query for %s with %s", qtype, name, resp.RCode)
+		}
+
+		// Follow the canonical names in the answer, which are not necessarily in order
+		target := name
+		for followed := true; followed && len(chain) <= maxCNAMEChain; {
+			followed = false
+			for _, answer := range resp.Answers {
+				cname, ok := answer.Body.(*dnsmessage.CNAMEResource)
+				if ok && strings.EqualFold(answer.Header.Name.String(), target.String()) {
+					target = cname.CNAME
+					chain = append(chain, strings.TrimSuffix(target.String(), "."))
+					updateTTL(answer.Header.TTL)
+					followed = true
+					break
+				}
+			}
+		}
+
+		var ips []net.IP
+		for _, answer := range resp.Answers {
+			if !strings.EqualFold(answer.Header.Name.String(), target.String()) {
+				continue
+			}
+			switch body := answer.Body.(type) {
+			case *dnsmessage.AResource:
+				if qtype == dnsmessage.TypeA {
+					ips = append(ips, net.IP(body.A[:]))
+					updateTTL(answer.Header.TTL)
+				}
+			case *dnsmessage.AAAAResource:
+				if qtype == dnsmessage.TypeAAAA {
+					ips = append(ips, net.IP(body.AAAA[:]))
+					updateTTL(answer.Header.TTL)
+				}
+			}
+		}
+
+		// The answer ended at a name that has no records of the type, or it is complete
+		if len(ips) > 0 || target == name {
+			return ips, chain, ttl, nil
+		}
+		name = target
+	}
+
+	return nil, nil, -1, fmt.Errorf("the CNAME chain of %s is longer than %d names", chain[0], maxCNAMEChain)
+}
+
+// exchange sends a query for the qtype records of name to the resolver's server and returns its response. The
+// query is sent over UDP and sent again over TCP if the response was truncated.
+func (r *dnsResolver) exchange(ctx context.Context, name dnsmessage.Name, qtype dnsmessage.Type) (*dnsmessage.Message, error) {
+	id := uint16(rand.Intn(1 << 16))
+	query := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{
+			{Name: name, Type: qtype, Class: dnsmessage.ClassINET},
+		},
+	}
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create DNS query")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, dnsTimeout)
+	defer cancel()
+
+	resp, err := r.exchangeUDP(ctx, packed, id)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Truncated {
+		resp, err = r.exchangeTCP(ctx, packed, id)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+func (r *dnsResolver) exchangeUDP(ctx context.Context, packed []byte, id uint16) (*dnsmessage.Message, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", r.server)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to connect to the DNS server")
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	_, err = conn.Write(packed)
+	if err != nil {
+		return nil, errors.Wrap(err, "sending the DNS query failed")
+	}
+
+	buf := make([]byte, maxUDPSize)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, errors.Wrap(err, "reading the DNS response failed")
+		}
+		var resp dnsmessage.Message
+		err = resp.Unpack(buf[:n])
+		// Responses that cannot be parsed or that answer another query are ignored, as they may be spoofed
+		if err != nil || resp.ID != id || !resp.Response {
+			continue
+		}
+		return &resp, nil
+	}
+}
+
+func (r *dnsResolver) exchangeTCP(ctx context.Context, packed []byte, id uint16) (*dnsmessage.Message, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", r.server)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to connect to the DNS server over TCP")
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	// DNS messages sent over TCP are prefixed with their length
+	query := make([]byte, 2+len(packed))
+	binary.BigEndian.PutUint16(query, uint16(len(packed)))
+	copy(query[2:], packed)
+	_, err = conn.Write(query)
+	if err != nil {
+		return nil, errors.Wrap(err, "sending the DNS query over TCP failed")
+	}
+
+	var length uint16
+	err = binary.Read(conn, binary.BigEndian, &length)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading the DNS response over TCP failed")
+	}
+	buf := make([]byte, length)
+	_, err = io.ReadFull(conn, buf)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading the DNS response over TCP failed")
+	}
+
+	var resp dnsmessage.Message
+	err = resp.Unpack(buf)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse the DNS response")
+	}
+	if resp.ID != id {
+		return nil, errors.New("the DNS response over TCP does not answer the query")
+	}
+	return &resp, nil
+}
@@ -0,0 +1,271 @@
+package capabilityquerier
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/hostingprovider"
+	th "github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/testhelper"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// fakeDNSServer answers DNS queries over UDP and TCP from a fixed set of records in the way a recursive server
+// does, with the whole CNAME chain in the answer
+type fakeDNSServer struct {
+	addr    string
+	records map[string][]dnsmessage.Resource
+	// truncated names are answered with an empty, truncated response over UDP
+	truncated map[string]bool
+	// partial names are answered with only the first CNAME record of their chain
+	partial map[string]bool
+}
+
+func newFakeDNSServer(t *testing.T, records []dnsmessage.Resource) *fakeDNSServer {
+	server := &fakeDNSServer{
+		records:   make(map[string][]dnsmessage.Resource),
+		truncated: make(map[string]bool),
+		partial:   make(map[string]bool),
+	}
+	for _, record := range records {
+		name := strings.ToLower(record.Header.Name.String())
+		server.records[name] = append(server.records[name], record)
+	}
+
+	udpConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	th.Assert(t, err == nil, err)
+	server.addr = udpConn.LocalAddr().String()
+	tcpListener, err := net.Listen("tcp", server.addr)
+	th.Assert(t, err == nil, err)
+	t.Cleanup(func() {
+		udpConn.Close()
+		tcpListener.Close()
+	})
+
+	go func() {
+		buf := make([]byte, maxUDPSize)
+		for {
+			n, addr, err := udpConn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			resp, err := server.answer(buf[:n], true)
+			if err == nil {
+				_, _ = udpConn.WriteTo(resp, addr)
+			}
+		}
+	}()
+	go func() {
+		for {
+			conn, err := tcpListener.Accept()
+			if err != nil {
+				return
+			}
+			var length uint16
+			err = binary.Read(conn, binary.BigEndian, &length)
+			if err == nil {
+				query := make([]byte, length)
+				_, err = io.ReadFull(conn, query)
+				if err == nil {
+					resp, err := server.answer(query, false)
+					if err == nil {
+						packed := make([]byte, 2+len(resp))
+						binary.BigEndian.PutUint16(packed, uint16(len(resp)))
+						copy(packed[2:], resp)
+						_, _ = conn.Write(packed)
+					}
+				}
+			}
+			conn.Close()
+		}
+	}()
+
+	return server
+}
+
+func (s *fakeDNSServer) answer(packed []byte, udp bool) ([]byte, error) {
+	var query dnsmessage.Message
+	err := query.Unpack(packed)
+	if err != nil {
+		return nil, err
+	}
+	question := query.Questions[0]
+	resp := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: query.ID, Response: true, RecursionAvailable: true},
+		Questions: query.Questions,
+	}
+
+	name := strings.ToLower(question.Name.String())
+	if udp && s.truncated[name] {
+		resp.Truncated = true
+		return resp.Pack()
+	}
+	if _, ok := s.records[name]; !ok {
+		resp.RCode = dnsmessage.RCodeNameError
+		return resp.Pack()
+	}
+
+	for followed := 0; followed <= maxCNAMEChain; followed++ {
+		var next string
+		for _, record := range s.records[name] {
+			if cname, ok := record.Body.(*dnsmessage.CNAMEResource); ok {
+				resp.Answers = append(resp.Answers, record)
+				next = strings.ToLower(cname.CNAME.String())
+			} else if record.Header.Type == question.Type {
+				resp.Answers = append(resp.Answers, record)
+			}
+		}
+		if next == "" || s.partial[strings.ToLower(question.Name.String())] {
+			break
+		}
+		name = next
+	}
+	return resp.Pack()
+}
+
+func dnsHeader(name string, rrType dnsmessage.Type, ttl uint32) dnsmessage.ResourceHeader {
+	return dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Type: rrType, Class: dnsmessage.ClassINET, TTL: ttl}
+}
+
+func aRecord(name string, ttl uint32, ip string) dnsmessage.Resource {
+	var a [4]byte
+	copy(a[:], net.ParseIP(ip).To4())
+	return dnsmessage.Resource{Header: dnsHeader(name, dnsmessage.TypeA, ttl), Body: &dnsmessage.AResource{A: a}}
+}
+
+func aaaaRecord(name string, ttl uint32, ip string) dnsmessage.Resource {
+	var aaaa [16]byte
+	copy(aaaa[:], net.ParseIP(ip).To16())
+	return dnsmessage.Resource{Header: dnsHeader(name, dnsmessage.TypeAAAA, ttl), Body: &dnsmessage.AAAAResource{AAAA: aaaa}}
+}
+
+func cnameRecord(name string, ttl uint32, target string) dnsmessage.Resource {
+	return dnsmessage.Resource{Header: dnsHeader(name, dnsmessage.TypeCNAME, ttl), Body: &dnsmessage.CNAMEResource{CNAME: dnsmessage.MustNewName(target)}}
+}
+
+func testRanges(t *testing.T) *hostingprovider.Ranges {
+	ranges, err := hostingprovider.ParseRanges([]byte(`{
+		"prefixes": [{"ip_prefix": "3.5.140.0/22", "region": "us-east-1", "service": "AMAZON"}],
+		"ipv6_prefixes": [{"ipv6_prefix": "2600:1f18::/33", "region": "us-east-1", "service": "EC2"}]
+	}`))
+	th.Assert(t, err == nil, err)
+	return hostingprovider.NewRanges(ranges)
+}
+
+func Test_dnsResolverResolve(t *testing.T) {
+	ctx := context.Background()
+
+	server := newFakeDNSServer(t, []dnsmessage.Resource{
+		cnameRecord("fhir.example.com.", 300, "fhir.example.com.edge.example.net."),
+		cnameRecord("fhir.example.com.edge.example.net.", 60, "lb.example.net."),
+		aRecord("lb.example.net.", 120, "3.5.140.10"),
+		aRecord("lb.example.net.", 120, "192.0.2.1"),
+		aaaaRecord("lb.example.net.", 30, "2600:1f18::1"),
+		aRecord("v4only.example.com.", 600, "192.0.2.2"),
+		cnameRecord("partial.example.com.", 300, "target.example.net."),
+		aRecord("target.example.net.", 90, "192.0.2.3"),
+		aRecord("large.example.com.", 100, "192.0.2.4"),
+	})
+	server.partial["partial.example.com."] = true
+	server.truncated["large.example.com."] = true
+	resolver := NewDNSResolver(server.addr, testRanges(t))
+
+	// the CNAME chain is followed and the addresses are attributed to their hosting providers
+	info := resolver.Resolve(ctx, "fhir.example.com")
+	expected := &endpointmanager.DNSInfo{
+		Host:       "fhir.example.com",
+		CNAMEChain: []string{"fhir.example.com.edge.example.net", "lb.example.net"},
+		Addresses: []endpointmanager.DNSAddress{
+			{IP: "3.5.140.10", Provider: hostingprovider.AWS, Region: "us-east-1", Service: "AMAZON"},
+			{IP: "192.0.2.1"},
+			{IP: "2600:1f18::1", Provider: hostingprovider.AWS, Region: "us-east-1", Service: "EC2"},
+		},
+		TTL: 30,
+	}
+	th.Assert(t, info.Equal(expected), fmt.Sprintf("expected DNS info %+v, got %+v", expected, info))
+	th.Assert(t, info.SupportsIPv6(), "expected the host to support IPv6")
+
+	// a host without AAAA records
+	info = resolver.Resolve(ctx, "v4only.example.com")
+	th.Assert(t, info.Error == "", fmt.Sprintf("expected no error, got %s", info.Error))
+	th.Assert(t, len(info.Addresses) == 1 && info.Addresses[0].IP == "192.0.2.2", fmt.Sprintf("expected the address 192.0.2.2, got %v", info.Addresses))
+	th.Assert(t, len(info.CNAMEChain) == 0, fmt.Sprintf("expected no CNAME chain, got %v", info.CNAMEChain))
+	th.Assert(t, info.TTL == 600, fmt.Sprintf("expected a TTL of 600, got %d", info.TTL))
+	th.Assert(t, !info.SupportsIPv6(), "did not expect the host to support IPv6")
+
+	// the rest of a partial CNAME chain is queried
+	info = resolver.Resolve(ctx, "partial.example.com")
+	th.Assert(t, len(info.CNAMEChain) == 1 && info.CNAMEChain[0] == "target.example.net", fmt.Sprintf("expected the CNAME chain [target.example.net], got %v", info.CNAMEChain))
+	th.Assert(t, len(info.Addresses) == 1 && info.Addresses[0].IP == "192.0.2.3", fmt.Sprintf("expected the address 192.0.2.3, got %v", info.Addresses))
+	th.Assert(t, info.TTL == 90, fmt.Sprintf("expected a TTL of 90, got %d", info.TTL))
+
+	// truncated responses are queried again over TCP
+	info = resolver.Resolve(ctx, "large.example.com")
+	th.Assert(t, len(info.Addresses) == 1 && info.Addresses[0].IP == "192.0.2.4", fmt.Sprintf("expected the address 192.0.2.4, got %v", info.Addresses))
+
+	// a host that does not exist
+	info = resolver.Resolve(ctx, "missing.example.com")
+	th.Assert(t, info.Error == "no such host missing.example.com", fmt.Sprintf("expected a no such host error, got %s", info.Error))
+	th.Assert(t, len(info.Addresses) == 0, fmt.Sprintf("expected no addresses, got %v", info.Addresses))
+
+	// an IP address is attributed without being looked up
+	info = resolver.Resolve(ctx, "2600:1f18::2")
+	th.Assert(t, info.Error == "", fmt.Sprintf("expected no error, got %s", info.Error))
+	th.Assert(t, len(info.Addresses) == 1 && info.Addresses[0].Provider == hostingprovider.AWS, fmt.Sprintf("expected an AWS address, got %v", info.Addresses))
+
+	// a server that cannot be reached
+	closedConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	th.Assert(t, err == nil, err)
+	closedAddr := closedConn.LocalAddr().String()
+	closedConn.Close()
+	info = NewDNSResolver(closedAddr, nil).Resolve(ctx, "fhir.example.com")
+	th.Assert(t, info.Error != "", "expected an error for a DNS server that cannot be reached")
+}
+
+func Test_SystemDNSServer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resolv.conf")
+	err := os.WriteFile(path, []byte("# generated\nsearch example.com\nnameserver 10.0.0.2\nnameserver 10.0.0.3\n"), 0644)
+	th.Assert(t, err == nil, err)
+
+	server, err := SystemDNSServer(path)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, server == "10.0.0.2:53", fmt.Sprintf("expected the server 10.0.0.2:53, got %s", server))
+
+	err = os.WriteFile(path, []byte("search example.com\n"), 0644)
+	th.Assert(t, err == nil, err)
+	_, err = SystemDNSServer(path)
+	th.Assert(t, err != nil, "expected an error for a resolv.conf file without a nameserver")
+
+	_, err = SystemDNSServer(filepath.Join(t.TempDir(), "missing"))
+	th.Assert(t, err != nil, "expected an error for a resolv.conf file that does not exist")
+}
+
+func Test_queryCapabilityStatementDNS(t *testing.T) {
+	ctx := context.Background()
+
+	fhirServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", fhir3PlusJSONMIMEType)
+		_, _ = w.Write([]byte("{\"resourceType\": \"CapabilityStatement\"}"))
+	}))
+	defer fhirServer.Close()
+
+	resolver := NewDNSResolver("127.0.0.1:0", testRanges(t))
+	message, err := queryCapabilityStatement(ctx, fhirServer.Client(), fhirServer.URL+"/", "None", "", "", []string{fhir3PlusJSONMIMEType}, nil, optionalQueries{resolver: resolver})
+	th.Assert(t, err == nil, err)
+	th.Assert(t, message.DNSInfo != nil, "expected the DNS info to be set when a resolver is given")
+	th.Assert(t, message.DNSInfo.Host == "127.0.0.1", fmt.Sprintf("expected the host 127.0.0.1, got %s", message.DNSInfo.Host))
+	th.Assert(t, len(message.DNSInfo.Addresses) == 1 && message.DNSInfo.Addresses[0].IP == "127.0.0.1", fmt.Sprintf("expected the address 127.0.0.1, got %v", message.DNSInfo.Addresses))
+
+	message, err = queryCapabilityStatement(ctx, fhirServer.Client(), fhirServer.URL+"/", "None", "", "", []string{fhir3PlusJSONMIMEType}, nil, optionalQueries{})
+	th.Assert(t, err == nil, err)
+	th.Assert(t, message.DNSInfo == nil, "did not expect the DNS info to be set without a resolver")
+}
@@ -0,0 +1,123 @@
+package capabilityquerier
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net"
+	"strings"
+	"syscall"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+	"github.com/pkg/errors"
+)
+
+var errHTMLResponse = errors.New("the response is an HTML page rather than a FHIR resource")
+
+// codedError attaches a QueryErrorCode to an error whose code cannot be determined from the error's type,
+// such as an XML capability statement that could not be converted to JSON
+type codedError struct {
+	code endpointmanager.QueryErrorCode
+	err  error
+}
+
+func (ce *codedError) Error() string {
+	return ce.err.Error()
+}
+
+func (ce *codedError) Unwrap() error {
+	return ce.err
+}
+
+func withErrorCode(err error, code endpointmanager.QueryErrorCode) error {
+	return &codedError{code: code, err: err}
+}
+
+// classifyError classifies an error returned while requesting a FHIR endpoint into a QueryErrorCode. An empty
+// code is returned for a nil error.
+func classifyError(err error) endpointmanager.QueryErrorCode {
+	if err == nil {
+		return ""
+	}
+
+	var ce *codedError
+	if errors.As(err, &ce) {
+		return ce.code
+	}
+
+	// a request that ran out of time while waiting on the host scheduler was never sent, so it is not a timeout of
+	// the endpoint
+	var waitErr *schedulerWaitError
+	if errors.As(err, &waitErr) {
+		return endpointmanager.SchedulerTimeoutCode
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		if dnsErr.IsNotFound {
+			return endpointmanager.DNSNotFoundCode
+		}
+		if dnsErr.IsTimeout {
+			return endpointmanager.TimeoutCode
+		}
+		return endpointmanager.DNSFailureCode
+	}
+
+	// certificate errors are checked before timeouts and connection errors because they are the more specific cause
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var certInvalidErr x509.CertificateInvalidError
+	var systemRootsErr x509.SystemRootsError
+	if errors.As(err, &unknownAuthorityErr) || errors.As(err, &hostnameErr) || errors.As(err, &certInvalidErr) || errors.As(err, &systemRootsErr) {
+		return endpointmanager.BadCertificateCode
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return endpointmanager.TimeoutCode
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return endpointmanager.TimeoutCode
+	}
+
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return endpointmanager.ConnectionRefusedCode
+	}
+	if errors.Is(err, syscall.ECONNRESET) {
+		return endpointmanager.ConnectionResetCode
+	}
+
+	var recordHeaderErr tls.RecordHeaderError
+	if errors.As(err, &recordHeaderErr) {
+		return endpointmanager.TLSHandshakeCode
+	}
+	// TLS alerts sent by the server are reported as remote errors, and the remaining handshake errors are not
+	// exported by crypto/tls, so they are recognized by the package's message prefix
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "remote error" {
+		return endpointmanager.TLSHandshakeCode
+	}
+	if strings.Contains(err.Error(), "tls: ") {
+		return endpointmanager.TLSHandshakeCode
+	}
+
+	var syntaxErr *json.SyntaxError
+	var unmarshalTypeErr *json.UnmarshalTypeError
+	if errors.As(err, &syntaxErr) || errors.As(err, &unmarshalTypeErr) {
+		return endpointmanager.JSONParseCode
+	}
+
+	return endpointmanager.UnknownErrorCode
+}
+
+// isHTML checks whether a response body is an HTML page, which servers commonly return from error and login
+// pages instead of a FHIR resource
+func isHTML(body []byte) bool {
+	start := bytes.ToLower(bytes.TrimSpace(body))
+	if len(start) > 100 {
+		start = start[:100]
+	}
+	return bytes.HasPrefix(start, []byte("<!doctype html")) || bytes.HasPrefix(start, []byte("<html"))
+}
@@ -0,0 +1,116 @@
+package capabilityquerier
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+	th "github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/testhelper"
+	"github.com/pkg/errors"
+)
+
+func Test_classifyError(t *testing.T) {
+	var jsonErr error
+	var jsonResponse interface{}
+	jsonErr = json.Unmarshal([]byte("{not json"), &jsonResponse)
+
+	cases := []struct {
+		name     string
+		err      error
+		expected endpointmanager.QueryErrorCode
+	}{
+		{"no error", nil, ""},
+		{"dns not found", &net.DNSError{Err: "no such host", Name: "example.invalid", IsNotFound: true}, endpointmanager.DNSNotFoundCode},
+		{"dns timeout", &net.DNSError{Err: "i/o timeout", Name: "example.com", IsTimeout: true}, endpointmanager.TimeoutCode},
+		{"dns failure", &net.DNSError{Err: "server misbehaving", Name: "example.com"}, endpointmanager.DNSFailureCode},
+		{"connection refused", &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, endpointmanager.ConnectionRefusedCode},
+		{"connection reset", &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, endpointmanager.ConnectionResetCode},
+		{"deadline exceeded", context.DeadlineExceeded, endpointmanager.TimeoutCode},
+		{"unknown authority", x509.UnknownAuthorityError{}, endpointmanager.BadCertificateCode},
+		{"hostname mismatch", x509.HostnameError{Certificate: &x509.Certificate{}, Host: "example.com"}, endpointmanager.BadCertificateCode},
+		{"expired certificate", x509.CertificateInvalidError{Cert: &x509.Certificate{}, Reason: x509.Expired}, endpointmanager.BadCertificateCode},
+		{"tls alert", &net.OpError{Op: "remote error", Err: errors.New("tls: handshake failure")}, endpointmanager.TLSHandshakeCode},
+		{"json parse failure", jsonErr, endpointmanager.JSONParseCode},
+		{"html response", withErrorCode(errHTMLResponse, endpointmanager.HTMLResponseCode), endpointmanager.HTMLResponseCode},
+		{"unknown", errors.New("something went wrong"), endpointmanager.UnknownErrorCode},
+	}
+
+	for _, c := range cases {
+		// the querier wraps errors with context, which must not change the classification
+		err := c.err
+		if err != nil {
+			err = errors.Wrapf(err, "making the GET request to %s failed", "https://example.com")
+		}
+		code := classifyError(err)
+		th.Assert(t, code == c.expected, fmt.Sprintf("%s: expected error code %s, got %s", c.name, c.expected, code))
+	}
+}
+
+func Test_classifyErrorFromRequests(t *testing.T) {
+	client := &http.Client{Timeout: 100 * time.Millisecond}
+
+	// the test server's certificate is not trusted by the client
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer tlsServer.Close()
+	_, err := client.Get(tlsServer.URL)
+	th.Assert(t, err != nil, "expected an error requesting a server with an untrusted certificate")
+	code := classifyError(err)
+	th.Assert(t, code == endpointmanager.BadCertificateCode, fmt.Sprintf("expected error code %s, got %s", endpointmanager.BadCertificateCode, code))
+
+	// server that does not respond in time
+	done := make(chan struct{})
+	slowServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer slowServer.Close()
+	defer close(done)
+	_, err = client.Get(slowServer.URL)
+	th.Assert(t, err != nil, "expected an error requesting a server that does not respond")
+	code = classifyError(err)
+	th.Assert(t, code == endpointmanager.TimeoutCode, fmt.Sprintf("expected error code %s, got %s", endpointmanager.TimeoutCode, code))
+
+	// closed server
+	closedServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	closedURL := closedServer.URL
+	closedServer.Close()
+	_, err = client.Get(closedURL)
+	th.Assert(t, err != nil, "expected an error requesting a closed server")
+	code = classifyError(err)
+	th.Assert(t, code == endpointmanager.ConnectionRefusedCode, fmt.Sprintf("expected error code %s, got %s", endpointmanager.ConnectionRefusedCode, code))
+}
+
+func Test_requestCapabilityStatementAndSmartOnFhirHTML(t *testing.T) {
+	ctx := context.Background()
+	metadataURL := endpointmanager.NormalizeEndpointURL(sampleURLNoTLS)
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("\n<!DOCTYPE html>\n<html><body>Sign in</body></html>"))
+	})
+	tc := th.NewTestClientNoTLS(h)
+	defer tc.Close()
+
+	message := Message{}
+	message.RequestedFhirVersion = "None"
+	err := requestCapabilityStatementAndSmartOnFhir(ctx, metadataURL, "metadata", &(tc.Client), "", nil, &message)
+	th.Assert(t, err != nil, "expected an error for an HTML response")
+	code := classifyError(err)
+	th.Assert(t, code == endpointmanager.HTMLResponseCode, fmt.Sprintf("expected error code %s, got %s", endpointmanager.HTMLResponseCode, code))
+	th.Assert(t, message.CapabilityStatement == nil, "did not expect a capability statement for an HTML response")
+}
+
+func Test_isHTML(t *testing.T) {
+	th.Assert(t, isHTML([]byte("<!DOCTYPE html><html></html>")), "expected a doctype to be HTML")
+	th.Assert(t, isHTML([]byte("  <html lang=\"en\"></html>")), "expected an html element to be HTML")
+	th.Assert(t, !isHTML([]byte("<CapabilityStatement xmlns=\"http://hl7.org/fhir\"></CapabilityStatement>")), "did not expect an XML capability statement to be HTML")
+	th.Assert(t, !isHTML([]byte("{\"resourceType\": \"CapabilityStatement\"}")), "did not expect a JSON capability statement to be HTML")
+}
@@ -0,0 +1,151 @@
+package capabilityquerier
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+)
+
+// maxErrorBodySize is the most of a 4xx or 5xx response body that is read and kept
+var maxErrorBodySize int64 = 4096
+
+type errorResponseRecorderKey struct{}
+
+// errorResponseRecorder records the 4xx or 5xx response of the most recent request made with its context
+type errorResponseRecorder struct {
+	errorResponse *endpointmanager.ErrorResponse
+}
+
+// reset clears the error response of a previous request
+func (er *errorResponseRecorder) reset() {
+	er.errorResponse = nil
+}
+
+// response returns the error response of the most recent request. nil if it did not get a 4xx or 5xx response.
+func (er *errorResponseRecorder) response() *endpointmanager.ErrorResponse {
+	return er.errorResponse
+}
+
+// withErrorResponseRecorder returns a context that records the 4xx and 5xx responses of requests made with it
+func withErrorResponseRecorder(ctx context.Context, er *errorResponseRecorder) context.Context {
+	return context.WithValue(ctx, errorResponseRecorderKey{}, er)
+}
+
+func errorResponseRecorderFrom(ctx context.Context) (*errorResponseRecorder, bool) {
+	er, ok := ctx.Value(errorResponseRecorderKey{}).(*errorResponseRecorder)
+	return er, ok
+}
+
+// readErrorResponse reads the start of the body of a 4xx or 5xx response and parses it and the response's
+// WWW-Authenticate header
+func readErrorResponse(resp *http.Response) *endpointmanager.ErrorResponse {
+	errorResponse := &endpointmanager.ErrorResponse{
+		AuthChallenges: parseWWWAuthenticate(strings.Join(resp.Header.Values("WWW-Authenticate"), ", ")),
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	if err == nil {
+		errorResponse.Body = strings.ToValidUTF8(string(body), string(utf8.RuneError))
+		errorResponse.Issues = parseOperationOutcome(body)
+	}
+	errorResponse.Kind = endpointmanager.ClassifyErrorResponse(resp.StatusCode, errorResponse)
+
+	return errorResponse
+}
+
+// parseOperationOutcome returns the issues of body if it is a JSON OperationOutcome, and nil if it is not
+func parseOperationOutcome(body []byte) []endpointmanager.OutcomeIssue {
+	var outcome struct {
+		ResourceType string                         `json:"resourceType"`
+		Issue        []endpointmanager.OutcomeIssue `json:"issue"`
+	}
+	err := json.Unmarshal(body, &outcome)
+	if err != nil || outcome.ResourceType != "OperationOutcome" {
+		return nil
+	}
+	if outcome.Issue == nil {
+		return []endpointmanager.OutcomeIssue{}
+	}
+	return outcome.Issue
+}
+
+// parseWWWAuthenticate returns the challenges of a WWW-Authenticate header as described in RFC 7235. Each
+// challenge is an auth scheme followed by comma separated parameters, and challenges are also separated by
+// commas, so a token that is not followed by "=" starts a new challenge. nil is returned for an empty header.
+func parseWWWAuthenticate(header string) []endpointmanager.AuthChallenge {
+	var challenges []endpointmanager.AuthChallenge
+	current := -1
+
+	rest := strings.TrimSpace(header)
+	for rest != "" {
+		rest = strings.TrimLeft(rest, ", \t")
+		if rest == "" {
+			break
+		}
+		token, remaining := readToken(rest)
+		if token == "" {
+			// skip a character that cannot start a token, such as a stray quote
+			rest = rest[1:]
+			continue
+		}
+		remaining = strings.TrimLeft(remaining, " \t")
+
+		if strings.HasPrefix(remaining, "=") && current != -1 {
+			var value string
+			value, rest = readParamValue(strings.TrimLeft(remaining[1:], " \t"))
+			switch strings.ToLower(token) {
+			case "realm":
+				challenges[current].Realm = value
+			case "error":
+				challenges[current].Error = value
+			}
+			continue
+		}
+
+		// a token that is not a parameter name is the scheme of a new challenge
+		challenges = append(challenges, endpointmanager.AuthChallenge{Scheme: token})
+		current = len(challenges) - 1
+		rest = remaining
+	}
+
+	return challenges
+}
+
+// readToken returns the RFC 7230 token at the start of str and the rest of str
+func readToken(str string) (string, string) {
+	end := strings.IndexAny(str, " \t,=\"")
+	if end == -1 {
+		return str, ""
+	}
+	return str[:end], str[end:]
+}
+
+// readParamValue returns the token or quoted string at the start of str, with any quoting removed, and the rest
+// of str
+func readParamValue(str string) (string, string) {
+	if !strings.HasPrefix(str, "\"") {
+		value, rest := readToken(str)
+		return value, rest
+	}
+
+	var value strings.Builder
+	for i := 1; i < len(str); i++ {
+		switch str[i] {
+		case '\\':
+			if i+1 < len(str) {
+				i++
+				value.WriteByte(str[i])
+			}
+		case '"':
+			return value.String(), str[i+1:]
+		default:
+			value.WriteByte(str[i])
+		}
+	}
+	return value.String(), ""
+}
@@ -0,0 +1,101 @@
+package capabilityquerier
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+	th "github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/testhelper"
+)
+
+func Test_parseWWWAuthenticate(t *testing.T) {
+	cases := []struct {
+		header   string
+		expected []endpointmanager.AuthChallenge
+	}{
+		{"", nil},
+		{"Basic", []endpointmanager.AuthChallenge{{Scheme: "Basic"}}},
+		{`Bearer realm="example", error="invalid_token", error_description="The access token expired"`,
+			[]endpointmanager.AuthChallenge{{Scheme: "Bearer", Realm: "example", Error: "invalid_token"}}},
+		{`Bearer realm=fhir, Basic realm="fhir server"`,
+			[]endpointmanager.AuthChallenge{{Scheme: "Bearer", Realm: "fhir"}, {Scheme: "Basic", Realm: "fhir server"}}},
+		{`Bearer realm="a \"quoted\" realm, with a comma", Negotiate, Basic`,
+			[]endpointmanager.AuthChallenge{{Scheme: "Bearer", Realm: `a "quoted" realm, with a comma`}, {Scheme: "Negotiate"}, {Scheme: "Basic"}}},
+	}
+
+	for _, c := range cases {
+		challenges := parseWWWAuthenticate(c.header)
+		th.Assert(t, reflect.DeepEqual(challenges, c.expected), fmt.Sprintf("expected %q to have challenges %v, got %v", c.header, c.expected, challenges))
+	}
+}
+
+func Test_parseOperationOutcome(t *testing.T) {
+	issues := parseOperationOutcome([]byte(`{"resourceType": "OperationOutcome", "issue": [{"severity": "error", "code": "login", "diagnostics": "Authentication is required"}]}`))
+	expected := []endpointmanager.OutcomeIssue{{Severity: "error", Code: "login", Diagnostics: "Authentication is required"}}
+	th.Assert(t, reflect.DeepEqual(issues, expected), fmt.Sprintf("expected issues %v, got %v", expected, issues))
+
+	issues = parseOperationOutcome([]byte(`{"resourceType": "OperationOutcome"}`))
+	th.Assert(t, issues != nil && len(issues) == 0, fmt.Sprintf("expected no issues for an OperationOutcome without any, got %v", issues))
+
+	issues = parseOperationOutcome([]byte(`{"resourceType": "Bundle"}`))
+	th.Assert(t, issues == nil, fmt.Sprintf("expected nil for a resource that is not an OperationOutcome, got %v", issues))
+
+	issues = parseOperationOutcome([]byte(`<html>Not Found</html>`))
+	th.Assert(t, issues == nil, fmt.Sprintf("expected nil for a body that is not JSON, got %v", issues))
+}
+
+func Test_requestCapabilityStatementAndSmartOnFhirErrorResponse(t *testing.T) {
+	ctx := context.Background()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/protected/metadata", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="fhir", error="invalid_token"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"resourceType": "OperationOutcome", "issue": [{"severity": "error", "code": "login"}]}`)
+	})
+	mux.HandleFunc("/failing/metadata", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, strings.Repeat("a", int(maxErrorBodySize)+100))
+	})
+	mux.HandleFunc("/ok/metadata", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", fhir3PlusJSONMIMEType)
+		fmt.Fprint(w, `{"resourceType": "CapabilityStatement"}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	client := createHTTPClient(nil, nil)
+
+	// requires authorization
+	message := Message{}
+	message.RequestedFhirVersion = "None"
+	err := requestCapabilityStatementAndSmartOnFhir(ctx, server.URL+"/protected/metadata", "metadata", client, "", nil, &message)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, message.HTTPResponse == http.StatusUnauthorized, fmt.Sprintf("expected HTTP response 401, got %d", message.HTTPResponse))
+	th.Assert(t, message.ErrorResponse != nil, "expected the error response to be kept")
+	th.Assert(t, message.ErrorResponse.Kind == endpointmanager.AuthRequiredKind, fmt.Sprintf("expected kind %s, got %s", endpointmanager.AuthRequiredKind, message.ErrorResponse.Kind))
+	expectedChallenges := []endpointmanager.AuthChallenge{{Scheme: "Bearer", Realm: "fhir", Error: "invalid_token"}}
+	th.Assert(t, reflect.DeepEqual(message.ErrorResponse.AuthChallenges, expectedChallenges), fmt.Sprintf("expected challenges %v, got %v", expectedChallenges, message.ErrorResponse.AuthChallenges))
+	th.Assert(t, len(message.ErrorResponse.Issues) == 1 && message.ErrorResponse.Issues[0].Code == "login", fmt.Sprintf("expected a login issue, got %v", message.ErrorResponse.Issues))
+
+	// server error with a body longer than what is kept
+	message = Message{}
+	message.RequestedFhirVersion = "None"
+	err = requestCapabilityStatementAndSmartOnFhir(ctx, server.URL+"/failing/metadata", "metadata", client, "", nil, &message)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, message.ErrorResponse != nil, "expected the error response to be kept")
+	th.Assert(t, message.ErrorResponse.Kind == endpointmanager.ServerErrorKind, fmt.Sprintf("expected kind %s, got %s", endpointmanager.ServerErrorKind, message.ErrorResponse.Kind))
+	th.Assert(t, int64(len(message.ErrorResponse.Body)) == maxErrorBodySize, fmt.Sprintf("expected the body to be truncated to %d bytes, got %d", maxErrorBodySize, len(message.ErrorResponse.Body)))
+	th.Assert(t, message.ErrorResponse.Issues == nil, fmt.Sprintf("expected no issues, got %v", message.ErrorResponse.Issues))
+
+	// successful response
+	message = Message{}
+	message.RequestedFhirVersion = "None"
+	err = requestCapabilityStatementAndSmartOnFhir(ctx, server.URL+"/ok/metadata", "metadata", client, "", nil, &message)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, message.ErrorResponse == nil, fmt.Sprintf("expected no error response, got %+v", message.ErrorResponse))
+}
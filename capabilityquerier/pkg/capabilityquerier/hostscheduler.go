@@ -0,0 +1,268 @@
+package capabilityquerier
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultRetryBackoff is how long requests to a host are held back after a 429 or 503 response that does not
+// include a Retry-After header
+var defaultRetryBackoff = 10 * time.Second
+
+// maxRetryBackoff caps the Retry-After value honored from a host so that a single response cannot stall the
+// workers indefinitely
+var maxRetryBackoff = 5 * time.Minute
+
+// schedulerWaitError is returned when a request's context is done while the request is waiting on the
+// HostScheduler. The request was never sent, so the error says nothing about the host.
+type schedulerWaitError struct {
+	host   string
+	waited time.Duration
+	err    error
+}
+
+func (swe *schedulerWaitError) Error() string {
+	return fmt.Sprintf("the request to %s was not sent after waiting %s on the host scheduler: %s", swe.host, swe.waited.Round(time.Millisecond), swe.err)
+}
+
+func (swe *schedulerWaitError) Unwrap() error {
+	return swe.err
+}
+
+// HostScheduler limits the number of concurrent requests and the rate of requests made to each host. A single
+// HostScheduler is meant to be shared by all of the workers making requests so that many workers do not query
+// the same host at once. Each host has a token bucket that refills at the configured QPS and holds at most one
+// token, so requests to a host are spaced evenly. Hosts that respond with 429 or 503 are not queried again until
+// the time given in the response's Retry-After header has passed.
+type HostScheduler struct {
+	maxConcurrent int
+	qps           float64
+	now           func() time.Time
+
+	mu    sync.Mutex
+	hosts map[string]*hostState
+}
+
+type hostState struct {
+	slots        chan struct{}
+	tokens       float64
+	lastRefill   time.Time
+	blockedUntil time.Time
+}
+
+// NewHostScheduler creates a HostScheduler that allows at most maxConcurrent concurrent requests and at most
+// qps requests per second to each host. A maxConcurrent or qps less than or equal to 0 leaves that limit off.
+func NewHostScheduler(maxConcurrent int, qps float64) *HostScheduler {
+	return &HostScheduler{
+		maxConcurrent: maxConcurrent,
+		qps:           qps,
+		now:           time.Now,
+		hosts:         make(map[string]*hostState),
+	}
+}
+
+func (hs *HostScheduler) hostState(host string) *hostState {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	state, ok := hs.hosts[host]
+	if !ok {
+		state = &hostState{
+			tokens:     1,
+			lastRefill: hs.now(),
+		}
+		if hs.maxConcurrent > 0 {
+			state.slots = make(chan struct{}, hs.maxConcurrent)
+		}
+		hs.hosts[host] = state
+	}
+	return state
+}
+
+// Wait blocks until a request may be made to the given host and returns a function that must be called once the
+// request is complete along with how long the request waited. A schedulerWaitError is returned if the context is
+// done before the request may be made.
+func (hs *HostScheduler) Wait(ctx context.Context, host string) (func(), time.Duration, error) {
+	start := hs.now()
+	state := hs.hostState(host)
+
+	if state.slots != nil {
+		select {
+		case state.slots <- struct{}{}:
+		case <-ctx.Done():
+			waited := hs.now().Sub(start)
+			return nil, waited, &schedulerWaitError{host: host, waited: waited, err: ctx.Err()}
+		}
+	}
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			if state.slots != nil {
+				<-state.slots
+			}
+		})
+	}
+
+	for {
+		delay := hs.reserve(state)
+		if delay <= 0 {
+			break
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			release()
+			waited := hs.now().Sub(start)
+			return nil, waited, &schedulerWaitError{host: host, waited: waited, err: ctx.Err()}
+		}
+	}
+
+	return release, hs.now().Sub(start), nil
+}
+
+// reserve takes a token from the host's bucket if one is available and the host is not being backed off.
+// Otherwise it returns how long to wait before trying again.
+func (hs *HostScheduler) reserve(state *hostState) time.Duration {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	now := hs.now()
+	if now.Before(state.blockedUntil) {
+		return state.blockedUntil.Sub(now)
+	}
+	if hs.qps <= 0 {
+		return 0
+	}
+
+	state.tokens += now.Sub(state.lastRefill).Seconds() * hs.qps
+	if state.tokens > 1 {
+		state.tokens = 1
+	}
+	state.lastRefill = now
+
+	if state.tokens >= 1 {
+		state.tokens--
+		return 0
+	}
+	return time.Duration((1 - state.tokens) / hs.qps * float64(time.Second))
+}
+
+// Observe holds back further requests to the host if the response indicates that the host is overloaded or is
+// rate limiting requests.
+func (hs *HostScheduler) Observe(host string, resp *http.Response) {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return
+	}
+
+	backoff, ok := parseRetryAfter(resp.Header.Get("Retry-After"), hs.now())
+	if !ok {
+		backoff = defaultRetryBackoff
+	}
+	if backoff > maxRetryBackoff {
+		backoff = maxRetryBackoff
+	}
+
+	state := hs.hostState(host)
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	blockedUntil := hs.now().Add(backoff)
+	if blockedUntil.After(state.blockedUntil) {
+		state.blockedUntil = blockedUntil
+	}
+	log.Infof("host %s responded with %d, holding back requests for %s", host, resp.StatusCode, backoff)
+}
+
+// parseRetryAfter parses a Retry-After header value, which is either a number of seconds or an HTTP date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		backoff := date.Sub(now)
+		if backoff < 0 {
+			backoff = 0
+		}
+		return backoff, true
+	}
+	return 0, false
+}
+
+type schedulerWaitKey struct{}
+
+// schedulerWait accumulates the time the requests made with a context spent waiting on the HostScheduler
+type schedulerWait struct {
+	nanoseconds int64
+}
+
+func (sw *schedulerWait) add(d time.Duration) {
+	atomic.AddInt64(&sw.nanoseconds, int64(d))
+}
+
+func (sw *schedulerWait) seconds() float64 {
+	return time.Duration(atomic.LoadInt64(&sw.nanoseconds)).Seconds()
+}
+
+// withSchedulerWait returns a context that records how long requests made with it waited on the HostScheduler
+func withSchedulerWait(ctx context.Context, sw *schedulerWait) context.Context {
+	return context.WithValue(ctx, schedulerWaitKey{}, sw)
+}
+
+// scheduledTransport is an http.RoundTripper that waits on a HostScheduler before each request. The host's
+// concurrency slot is held until the response body is closed.
+type scheduledTransport struct {
+	base      http.RoundTripper
+	scheduler *HostScheduler
+}
+
+func (st *scheduledTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Hostname()
+	release, waited, err := st.scheduler.Wait(req.Context(), host)
+	if sw, ok := req.Context().Value(schedulerWaitKey{}).(*schedulerWait); ok {
+		sw.add(waited)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if waited > 0 {
+		log.Debugf("request to %s waited %s on the host scheduler", req.URL.String(), waited)
+	}
+
+	resp, err := st.base.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	st.scheduler.Observe(host, resp)
+	resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+type releaseOnClose struct {
+	io.ReadCloser
+	release func()
+}
+
+func (r *releaseOnClose) Close() error {
+	err := r.ReadCloser.Close()
+	r.release()
+	return err
+}
@@ -0,0 +1,169 @@
+package capabilityquerier
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+	th "github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/testhelper"
+	"github.com/pkg/errors"
+)
+
+func Test_HostSchedulerRate(t *testing.T) {
+	ctx := context.Background()
+	hs := NewHostScheduler(0, 20)
+
+	// the first request to a host does not wait
+	release, waited, err := hs.Wait(ctx, "example.com")
+	th.Assert(t, err == nil, err)
+	th.Assert(t, waited < 10*time.Millisecond, fmt.Sprintf("expected the first request not to wait, waited %s", waited))
+	release()
+
+	// the second request waits for the bucket to refill
+	release, waited, err = hs.Wait(ctx, "example.com")
+	th.Assert(t, err == nil, err)
+	th.Assert(t, waited >= 40*time.Millisecond, fmt.Sprintf("expected the second request to wait about 50ms, waited %s", waited))
+	release()
+
+	// other hosts have their own buckets
+	release, waited, err = hs.Wait(ctx, "example.org")
+	th.Assert(t, err == nil, err)
+	th.Assert(t, waited < 10*time.Millisecond, fmt.Sprintf("expected the first request to another host not to wait, waited %s", waited))
+	release()
+}
+
+func Test_HostSchedulerConcurrency(t *testing.T) {
+	ctx := context.Background()
+	hs := NewHostScheduler(1, 0)
+
+	release, _, err := hs.Wait(ctx, "example.com")
+	th.Assert(t, err == nil, err)
+
+	// a second request to the host cannot start until the first is released
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, _, err = hs.Wait(timeoutCtx, "example.com")
+	var waitErr *schedulerWaitError
+	th.Assert(t, errors.As(err, &waitErr) && errors.Is(err, context.DeadlineExceeded), fmt.Sprintf("expected the request to time out waiting, got %v", err))
+	th.Assert(t, classifyError(err) == endpointmanager.SchedulerTimeoutCode, fmt.Sprintf("expected error code %s, got %s", endpointmanager.SchedulerTimeoutCode, classifyError(err)))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		release2, waited, err := hs.Wait(ctx, "example.com")
+		th.Assert(t, err == nil, err)
+		th.Assert(t, waited >= 40*time.Millisecond, fmt.Sprintf("expected the request to wait for the first to be released, waited %s", waited))
+		release2()
+	}()
+	time.Sleep(50 * time.Millisecond)
+	release()
+	// calling release more than once does not free another slot
+	release()
+	wg.Wait()
+}
+
+func Test_HostSchedulerObserve(t *testing.T) {
+	ctx := context.Background()
+	hs := NewHostScheduler(0, 0)
+
+	resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+	resp.Header.Set("Retry-After", "1")
+	hs.Observe("example.com", resp)
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, _, err := hs.Wait(timeoutCtx, "example.com")
+	th.Assert(t, errors.Is(err, context.DeadlineExceeded), fmt.Sprintf("expected the host to be held back, got %v", err))
+
+	// successful responses do not hold back the host
+	hs.Observe("example.org", &http.Response{StatusCode: http.StatusOK, Header: http.Header{}})
+	release, waited, err := hs.Wait(ctx, "example.org")
+	th.Assert(t, err == nil, err)
+	th.Assert(t, waited < 10*time.Millisecond, fmt.Sprintf("expected the request not to wait, waited %s", waited))
+	release()
+}
+
+func Test_parseRetryAfter(t *testing.T) {
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	backoff, ok := parseRetryAfter("120", now)
+	th.Assert(t, ok, "expected a number of seconds to parse")
+	th.Assert(t, backoff == 2*time.Minute, fmt.Sprintf("expected 2m, got %s", backoff))
+
+	backoff, ok = parseRetryAfter("Wed, 01 Jan 2020 00:00:30 GMT", now)
+	th.Assert(t, ok, "expected an HTTP date to parse")
+	th.Assert(t, backoff == 30*time.Second, fmt.Sprintf("expected 30s, got %s", backoff))
+
+	backoff, ok = parseRetryAfter("Tue, 31 Dec 2019 00:00:00 GMT", now)
+	th.Assert(t, ok, "expected an HTTP date in the past to parse")
+	th.Assert(t, backoff == 0, fmt.Sprintf("expected 0, got %s", backoff))
+
+	_, ok = parseRetryAfter("", now)
+	th.Assert(t, !ok, "did not expect an empty value to parse")
+	_, ok = parseRetryAfter("-1", now)
+	th.Assert(t, !ok, "did not expect a negative value to parse")
+	_, ok = parseRetryAfter("soon", now)
+	th.Assert(t, !ok, "did not expect an invalid value to parse")
+}
+
+func Test_scheduledTransport(t *testing.T) {
+	requests := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer s.Close()
+
+	client := createHTTPClient(NewHostScheduler(1, 20), nil)
+	wait := &schedulerWait{}
+	ctx := withSchedulerWait(context.Background(), wait)
+
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequestWithContext(ctx, "GET", s.URL, nil)
+		th.Assert(t, err == nil, err)
+		resp, err := client.Do(req)
+		th.Assert(t, err == nil, err)
+		resp.Body.Close()
+	}
+
+	th.Assert(t, requests == 2, fmt.Sprintf("expected 2 requests, got %d", requests))
+	th.Assert(t, wait.seconds() >= 0.04, fmt.Sprintf("expected the second request to wait on the scheduler, waited %f", wait.seconds()))
+}
+
+func Test_queryCapabilityStatementSchedulerTimeout(t *testing.T) {
+	fhirServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", fhir3PlusJSONMIMEType)
+		_, _ = w.Write([]byte("{\"resourceType\": \"CapabilityStatement\"}"))
+	}))
+	defer fhirServer.Close()
+	serverURL, err := url.Parse(fhirServer.URL)
+	th.Assert(t, err == nil, err)
+
+	defaultBudget := CapabilityStatementBudget
+	defer func() { CapabilityStatementBudget = defaultBudget }()
+	CapabilityStatementBudget = 100 * time.Millisecond
+
+	// the capability statement request waits behind another request to the host until the budget runs out
+	hs := NewHostScheduler(1, 0)
+	release, _, err := hs.Wait(context.Background(), serverURL.Hostname())
+	th.Assert(t, err == nil, err)
+	defer release()
+
+	client := createHTTPClient(hs, nil)
+	message, err := queryCapabilityStatement(context.Background(), client, fhirServer.URL+"/", "None", "", "", []string{fhir3PlusJSONMIMEType}, nil, optionalQueries{})
+	th.Assert(t, err == nil, err)
+	th.Assert(t, message.ErrorCode == endpointmanager.SchedulerTimeoutCode, fmt.Sprintf("expected error code %s, got %s", endpointmanager.SchedulerTimeoutCode, message.ErrorCode))
+	th.Assert(t, message.HTTPResponse == 0, fmt.Sprintf("did not expect a response, got %d", message.HTTPResponse))
+}
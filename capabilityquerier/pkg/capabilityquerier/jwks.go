@@ -0,0 +1,151 @@
+package capabilityquerier
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+)
+
+// maxJWKSSize is the most of a JWKS response that is read. Key sets are small, so a larger response is not a key set.
+var maxJWKSSize int64 = 1 << 20
+
+// curveSizes are the key sizes in bits of the named curves used by EC and OKP keys
+var curveSizes = map[string]int{
+	"P-256":     256,
+	"P-384":     384,
+	"P-521":     521,
+	"secp256k1": 256,
+	"Ed25519":   256,
+	"Ed448":     456,
+	"X25519":    256,
+	"X448":      448,
+}
+
+// privateKeyParams are the JWK parameters that hold private or symmetric key material, by key type
+var privateKeyParams = map[string][]string{
+	"RSA": {"d", "p", "q", "dp", "dq", "qi"},
+	"EC":  {"d"},
+	"OKP": {"d"},
+	"oct": {"k"},
+}
+
+// advertisedJWKSURI returns the jwks_uri of the SMART configuration in smartResp, or an empty string if there is none
+func advertisedJWKSURI(smartResp interface{}) string {
+	smartMap, ok := smartResp.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	jwksURI, _ := smartMap["jwks_uri"].(string)
+	return strings.TrimSpace(jwksURI)
+}
+
+// fetchJWKS requests the JSON Web Key Set at jwksURI and records the public information about each of its keys.
+// Problems retrieving or parsing the key set are recorded in the returned JWKSInfo's Error rather than returned.
+func fetchJWKS(ctx context.Context, client *http.Client, jwksURI string, userAgent string) *endpointmanager.JWKSInfo {
+	jwksInfo := &endpointmanager.JWKSInfo{
+		URL: jwksURI,
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", jwksURI, nil)
+	if err != nil {
+		jwksInfo.Error = "unable to create new GET request from JWKS URI: " + err.Error()
+		return jwksInfo
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "application/jwk-set+json, application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		jwksInfo.Error = fmt.Sprintf("making the GET request to %s failed: %s", jwksURI, err.Error())
+		return jwksInfo
+	}
+	defer resp.Body.Close()
+
+	jwksInfo.HTTPResponse = resp.StatusCode
+	if resp.StatusCode != http.StatusOK {
+		jwksInfo.Error = fmt.Sprintf("the JWKS URI returned HTTP status %d", resp.StatusCode)
+		return jwksInfo
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize))
+	if err != nil {
+		jwksInfo.Error = "reading the JWKS response failed: " + err.Error()
+		return jwksInfo
+	}
+
+	jwksInfo.Keys, err = parseJWKS(body)
+	if err != nil {
+		jwksInfo.Error = err.Error()
+	}
+
+	return jwksInfo
+}
+
+// parseJWKS returns the public information about each key in the JSON Web Key Set
+func parseJWKS(body []byte) ([]endpointmanager.JWK, error) {
+	var keySet struct {
+		Keys []map[string]interface{} `json:"keys"`
+	}
+	err := json.Unmarshal(body, &keySet)
+	if err != nil {
+		return nil, fmt.Errorf("the JWKS response is not a JSON Web Key Set: %s", err.Error())
+	}
+	if keySet.Keys == nil {
+		return nil, fmt.Errorf("the JWKS response does not include a keys array")
+	}
+
+	keys := make([]endpointmanager.JWK, 0, len(keySet.Keys))
+	for _, keyParams := range keySet.Keys {
+		keys = append(keys, parseJWK(keyParams))
+	}
+	return keys, nil
+}
+
+// parseJWK returns the public information about a single key
+func parseJWK(keyParams map[string]interface{}) endpointmanager.JWK {
+	stringParam := func(name string) string {
+		value, _ := keyParams[name].(string)
+		return value
+	}
+
+	key := endpointmanager.JWK{
+		KeyType:   stringParam("kty"),
+		Algorithm: stringParam("alg"),
+		Use:       stringParam("use"),
+		KeyID:     stringParam("kid"),
+		Curve:     stringParam("crv"),
+	}
+
+	switch key.KeyType {
+	case "RSA":
+		if modulus, err := decodeKeyParam(stringParam("n")); err == nil {
+			key.KeySize = new(big.Int).SetBytes(modulus).BitLen()
+		}
+	case "EC", "OKP":
+		key.KeySize = curveSizes[key.Curve]
+	case "oct":
+		if secret, err := decodeKeyParam(stringParam("k")); err == nil {
+			key.KeySize = len(secret) * 8
+		}
+	}
+
+	for _, param := range privateKeyParams[key.KeyType] {
+		if _, ok := keyParams[param]; ok {
+			key.HasPrivateKey = true
+		}
+	}
+
+	return key
+}
+
+// decodeKeyParam decodes a base64url encoded JWK parameter, allowing the padding that some servers include
+func decodeKeyParam(param string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(param, "="))
+}
@@ -0,0 +1,110 @@
+package capabilityquerier
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+	th "github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/testhelper"
+)
+
+func Test_advertisedJWKSURI(t *testing.T) {
+	jwksURI := advertisedJWKSURI(map[string]interface{}{"jwks_uri": " https://example.com/jwks "})
+	th.Assert(t, jwksURI == "https://example.com/jwks", fmt.Sprintf("expected https://example.com/jwks, got %s", jwksURI))
+
+	jwksURI = advertisedJWKSURI(map[string]interface{}{"token_endpoint": "https://example.com/token"})
+	th.Assert(t, jwksURI == "", fmt.Sprintf("expected no JWKS URI, got %s", jwksURI))
+
+	jwksURI = advertisedJWKSURI(map[string]interface{}{"jwks_uri": 1})
+	th.Assert(t, jwksURI == "", fmt.Sprintf("expected no JWKS URI for a jwks_uri that is not a string, got %s", jwksURI))
+
+	jwksURI = advertisedJWKSURI(nil)
+	th.Assert(t, jwksURI == "", fmt.Sprintf("expected no JWKS URI without a SMART response, got %s", jwksURI))
+}
+
+func Test_parseJWK(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	th.Assert(t, err == nil, err)
+	modulus := base64.RawURLEncoding.EncodeToString(privateKey.N.Bytes())
+
+	// RSA public key
+	key := parseJWK(map[string]interface{}{"kty": "RSA", "alg": "RS384", "use": "sig", "kid": "key-1", "n": modulus, "e": "AQAB"})
+	expected := endpointmanager.JWK{KeyType: "RSA", Algorithm: "RS384", Use: "sig", KeyID: "key-1", KeySize: 2048}
+	th.Assert(t, key == expected, fmt.Sprintf("expected %+v, got %+v", expected, key))
+
+	// padded RSA modulus
+	key = parseJWK(map[string]interface{}{"kty": "RSA", "n": base64.URLEncoding.EncodeToString(big.NewInt(1<<20 - 1).Bytes())})
+	th.Assert(t, key.KeySize == 20, fmt.Sprintf("expected key size 20, got %d", key.KeySize))
+
+	// RSA private key
+	key = parseJWK(map[string]interface{}{"kty": "RSA", "n": modulus, "e": "AQAB", "d": "secret"})
+	th.Assert(t, key.HasPrivateKey, "expected an RSA key with d to have private key material")
+
+	// EC public and private keys
+	key = parseJWK(map[string]interface{}{"kty": "EC", "crv": "P-384", "x": "x", "y": "y"})
+	th.Assert(t, key.KeySize == 384, fmt.Sprintf("expected key size 384, got %d", key.KeySize))
+	th.Assert(t, !key.HasPrivateKey, "did not expect an EC key without d to have private key material")
+	key = parseJWK(map[string]interface{}{"kty": "EC", "crv": "P-256", "x": "x", "y": "y", "d": "secret"})
+	th.Assert(t, key.HasPrivateKey, "expected an EC key with d to have private key material")
+
+	// symmetric keys are always secret
+	key = parseJWK(map[string]interface{}{"kty": "oct", "k": base64.RawURLEncoding.EncodeToString(make([]byte, 32))})
+	th.Assert(t, key.KeySize == 256, fmt.Sprintf("expected key size 256, got %d", key.KeySize))
+	th.Assert(t, key.HasPrivateKey, "expected a symmetric key to have private key material")
+
+	// unknown key type
+	key = parseJWK(map[string]interface{}{"kty": "unknown", "kid": 1})
+	th.Assert(t, key.KeySize == 0, fmt.Sprintf("expected key size 0, got %d", key.KeySize))
+	th.Assert(t, key.KeyID == "", fmt.Sprintf("expected no key ID for a kid that is not a string, got %s", key.KeyID))
+}
+
+func Test_fetchJWKS(t *testing.T) {
+	ctx := context.Background()
+	client := createHTTPClient(nil, nil)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"keys": [{"kty": "EC", "crv": "P-256", "kid": "key-1", "use": "sig", "alg": "ES256", "x": "x", "y": "y"}, {"kty": "EC", "crv": "P-384", "x": "x", "y": "y", "d": "secret"}]}`)
+	})
+	mux.HandleFunc("/notjwks", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"issuer": "https://example.com"}`)
+	})
+	mux.HandleFunc("/html", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html></html>`)
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	// key set
+	jwksInfo := fetchJWKS(ctx, client, s.URL+"/jwks", "LANTERN")
+	th.Assert(t, jwksInfo.Error == "", fmt.Sprintf("expected no error, got %s", jwksInfo.Error))
+	th.Assert(t, jwksInfo.HTTPResponse == http.StatusOK, fmt.Sprintf("expected HTTP response 200, got %d", jwksInfo.HTTPResponse))
+	th.Assert(t, len(jwksInfo.Keys) == 2, fmt.Sprintf("expected 2 keys, got %d", len(jwksInfo.Keys)))
+	th.Assert(t, jwksInfo.Keys[0].KeyID == "key-1", fmt.Sprintf("expected key ID key-1, got %s", jwksInfo.Keys[0].KeyID))
+	th.Assert(t, jwksInfo.Keys[1].HasPrivateKey, "expected the second key to have private key material")
+
+	// JSON that is not a key set
+	jwksInfo = fetchJWKS(ctx, client, s.URL+"/notjwks", "LANTERN")
+	th.Assert(t, jwksInfo.Error == "the JWKS response does not include a keys array", fmt.Sprintf("unexpected error %s", jwksInfo.Error))
+
+	// not JSON
+	jwksInfo = fetchJWKS(ctx, client, s.URL+"/html", "LANTERN")
+	th.Assert(t, jwksInfo.Error != "", "expected an error for a response that is not JSON")
+
+	// not found
+	jwksInfo = fetchJWKS(ctx, client, s.URL+"/missing", "LANTERN")
+	th.Assert(t, jwksInfo.HTTPResponse == http.StatusNotFound, fmt.Sprintf("expected HTTP response 404, got %d", jwksInfo.HTTPResponse))
+	th.Assert(t, jwksInfo.Error == "the JWKS URI returned HTTP status 404", fmt.Sprintf("unexpected error %s", jwksInfo.Error))
+
+	// unreachable
+	jwksInfo = fetchJWKS(ctx, client, "http://127.0.0.1:9/jwks", "LANTERN")
+	th.Assert(t, jwksInfo.HTTPResponse == 0, fmt.Sprintf("expected no HTTP response, got %d", jwksInfo.HTTPResponse))
+	th.Assert(t, jwksInfo.Error != "", "expected an error for an unreachable JWKS URI")
+}
@@ -0,0 +1,70 @@
+package capabilityquerier
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+	"github.com/pkg/errors"
+)
+
+// maxRedirects is the number of redirects followed before a request is stopped, which is the http.Client default
+const maxRedirects = 10
+
+var errRedirectLoop = errors.New("the server redirected to a URL that was already requested")
+
+type redirectRecorderKey struct{}
+
+// redirectRecorder records the redirects followed by the most recent request made with its context
+type redirectRecorder struct {
+	hops []endpointmanager.RedirectHop
+}
+
+// reset clears the redirects of a previous request
+func (rr *redirectRecorder) reset() {
+	rr.hops = []endpointmanager.RedirectHop{}
+}
+
+// chain returns the redirects followed by the most recent request. It is empty rather than nil when no redirects
+// were followed so that the receiver can tell that the redirects were recorded.
+func (rr *redirectRecorder) chain() []endpointmanager.RedirectHop {
+	if rr.hops == nil {
+		return []endpointmanager.RedirectHop{}
+	}
+	return rr.hops
+}
+
+// withRedirectRecorder returns a context that records the redirects followed by requests made with it
+func withRedirectRecorder(ctx context.Context, rr *redirectRecorder) context.Context {
+	return context.WithValue(ctx, redirectRecorderKey{}, rr)
+}
+
+func redirectRecorderFrom(ctx context.Context) (*redirectRecorder, bool) {
+	rr, ok := ctx.Value(redirectRecorderKey{}).(*redirectRecorder)
+	return rr, ok
+}
+
+// checkRedirect is the http.Client CheckRedirect policy. It records each redirect response on the request's
+// redirectRecorder and stops requests that redirect to a URL that was already requested, rather than following
+// the loop until the redirect limit is reached.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if rr, ok := redirectRecorderFrom(req.Context()); ok && req.Response != nil {
+		from := req.Response.Request.URL
+		rr.hops = append(rr.hops, endpointmanager.RedirectHop{
+			URL:        from.String(),
+			Scheme:     from.Scheme,
+			StatusCode: req.Response.StatusCode,
+			Location:   req.Response.Header.Get("Location"),
+		})
+	}
+
+	for _, prev := range via {
+		if prev.URL.String() == req.URL.String() {
+			return withErrorCode(errRedirectLoop, endpointmanager.RedirectLoopCode)
+		}
+	}
+	if len(via) >= maxRedirects {
+		return errors.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package capabilityquerier
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+	th "github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/testhelper"
+)
+
+func Test_requestCapabilityStatementAndSmartOnFhirRedirects(t *testing.T) {
+	ctx := context.Background()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/old/metadata", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/moved/metadata", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/moved/metadata", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/new/metadata", http.StatusFound)
+	})
+	mux.HandleFunc("/new/metadata", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", fhir3PlusJSONMIMEType)
+		_, _ = w.Write([]byte("{\"resourceType\": \"CapabilityStatement\"}"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	client := createHTTPClient(nil, nil)
+
+	message := Message{}
+	message.RequestedFhirVersion = "None"
+	err := requestCapabilityStatementAndSmartOnFhir(ctx, server.URL+"/old/metadata", "metadata", client, "", nil, &message)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, message.HTTPResponse == http.StatusOK, fmt.Sprintf("expected HTTP response 200, got %d", message.HTTPResponse))
+
+	expected := []endpointmanager.RedirectHop{
+		{URL: server.URL + "/old/metadata", Scheme: "http", StatusCode: http.StatusMovedPermanently, Location: "/moved/metadata"},
+		{URL: server.URL + "/moved/metadata", Scheme: "http", StatusCode: http.StatusFound, Location: "/new/metadata"},
+	}
+	th.Assert(t, len(message.RedirectChain) == len(expected), fmt.Sprintf("expected %d redirects, got %v", len(expected), message.RedirectChain))
+	for i, hop := range expected {
+		th.Assert(t, message.RedirectChain[i] == hop, fmt.Sprintf("expected redirect %d to be %v, got %v", i, hop, message.RedirectChain[i]))
+	}
+
+	// an endpoint without redirects has an empty chain
+	message = Message{}
+	message.RequestedFhirVersion = "None"
+	err = requestCapabilityStatementAndSmartOnFhir(ctx, server.URL+"/new/metadata", "metadata", client, "", nil, &message)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, message.RedirectChain != nil && len(message.RedirectChain) == 0, fmt.Sprintf("expected an empty redirect chain, got %v", message.RedirectChain))
+}
+
+func Test_requestCapabilityStatementAndSmartOnFhirRedirectLoop(t *testing.T) {
+	ctx := context.Background()
+
+	requests := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/a/metadata", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Redirect(w, r, "/b/metadata", http.StatusFound)
+	})
+	mux.HandleFunc("/b/metadata", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Redirect(w, r, "/a/metadata", http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	redirects := &redirectRecorder{}
+	req, err := http.NewRequest("GET", server.URL+"/a/metadata", nil)
+	th.Assert(t, err == nil, err)
+	req = req.WithContext(withRedirectRecorder(ctx, redirects))
+	_, _, _, _, _, _, err = requestWithMimeType(req, fhir3PlusJSONMIMEType, createHTTPClient(nil, nil))
+	th.Assert(t, err != nil, "expected an error for a redirect loop")
+	code := classifyError(err)
+	th.Assert(t, code == endpointmanager.RedirectLoopCode, fmt.Sprintf("expected error code %s, got %s", endpointmanager.RedirectLoopCode, code))
+	th.Assert(t, requests == 2, fmt.Sprintf("expected the loop to be stopped after 2 requests, got %d", requests))
+	th.Assert(t, len(redirects.chain()) == 2, fmt.Sprintf("expected 2 redirects, got %v", redirects.chain()))
+}
@@ -0,0 +1,104 @@
+package capabilityquerier
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/queuemessage"
+)
+
+// ResponseTimings is the breakdown of the time spent in each phase of an HTTP request, in seconds. Phases that did
+// not happen, such as DNS lookup and TLS handshake on a reused connection, are 0.
+type ResponseTimings = queuemessage.ResponseTimings
+
+// requestTimer records the timings of the most recent request made with its client trace. The trace callbacks
+// can be called from different goroutines, so access to the timings is guarded by a mutex.
+type requestTimer struct {
+	mu           sync.Mutex
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+	timings      ResponseTimings
+}
+
+// clientTrace returns the httptrace hooks that populate the timer
+func (rt *requestTimer) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		// GetConn is called at the start of every request, so the timings of a previous request are cleared
+		GetConn: func(_ string) {
+			rt.mu.Lock()
+			defer rt.mu.Unlock()
+			rt.dnsStart = time.Time{}
+			rt.connectStart = time.Time{}
+			rt.tlsStart = time.Time{}
+			rt.wroteRequest = time.Time{}
+			rt.firstByte = time.Time{}
+			rt.timings = ResponseTimings{}
+		},
+		DNSStart: func(_ httptrace.DNSStartInfo) {
+			rt.mu.Lock()
+			defer rt.mu.Unlock()
+			rt.dnsStart = time.Now()
+		},
+		DNSDone: func(_ httptrace.DNSDoneInfo) {
+			rt.mu.Lock()
+			defer rt.mu.Unlock()
+			rt.timings.DNSLookup = secondsSince(rt.dnsStart)
+		},
+		ConnectStart: func(_, _ string) {
+			rt.mu.Lock()
+			defer rt.mu.Unlock()
+			rt.connectStart = time.Now()
+		},
+		ConnectDone: func(_, _ string, err error) {
+			rt.mu.Lock()
+			defer rt.mu.Unlock()
+			if err == nil {
+				rt.timings.TCPConnect = secondsSince(rt.connectStart)
+			}
+		},
+		TLSHandshakeStart: func() {
+			rt.mu.Lock()
+			defer rt.mu.Unlock()
+			rt.tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, _ error) {
+			rt.mu.Lock()
+			defer rt.mu.Unlock()
+			rt.timings.TLSHandshake = secondsSince(rt.tlsStart)
+		},
+		WroteRequest: func(_ httptrace.WroteRequestInfo) {
+			rt.mu.Lock()
+			defer rt.mu.Unlock()
+			rt.wroteRequest = time.Now()
+		},
+		GotFirstResponseByte: func() {
+			rt.mu.Lock()
+			defer rt.mu.Unlock()
+			rt.firstByte = time.Now()
+			rt.timings.TimeToFirstByte = secondsSince(rt.wroteRequest)
+		},
+	}
+}
+
+// finish records the body transfer time as the time since the first byte of the response was received and
+// returns the timings of the request. It should be called once the response body has been read.
+func (rt *requestTimer) finish() ResponseTimings {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if !rt.firstByte.IsZero() {
+		rt.timings.BodyTransfer = secondsSince(rt.firstByte)
+	}
+	return rt.timings
+}
+
+func secondsSince(start time.Time) float64 {
+	if start.IsZero() {
+		return 0
+	}
+	return time.Since(start).Seconds()
+}
@@ -0,0 +1,53 @@
+package capabilityquerier
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"testing"
+	"time"
+
+	th "github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/testhelper"
+)
+
+func Test_requestTimer(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.(http.Flusher).Flush()
+		time.Sleep(50 * time.Millisecond)
+		_, _ = w.Write([]byte("{}"))
+	})
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	client := &http.Client{}
+	timer := &requestTimer{}
+	req, err := http.NewRequest("GET", s.URL, nil)
+	th.Assert(t, err == nil, err)
+	req = req.WithContext(httptrace.WithClientTrace(context.Background(), timer.clientTrace()))
+
+	doRequest := func() ResponseTimings {
+		resp, err := client.Do(req)
+		th.Assert(t, err == nil, err)
+		defer resp.Body.Close()
+		_, err = io.ReadAll(resp.Body)
+		th.Assert(t, err == nil, err)
+		return timer.finish()
+	}
+
+	// first request opens a new connection to the server
+	timings := doRequest()
+	th.Assert(t, timings.TCPConnect > 0, fmt.Sprintf("expected TCP connect time to be recorded, got %f", timings.TCPConnect))
+	th.Assert(t, timings.TLSHandshake == 0, fmt.Sprintf("expected no TLS handshake time for an http server, got %f", timings.TLSHandshake))
+	th.Assert(t, timings.DNSLookup == 0, fmt.Sprintf("expected no DNS lookup time for an IP address, got %f", timings.DNSLookup))
+	th.Assert(t, timings.TimeToFirstByte >= 0.05, fmt.Sprintf("expected time to first byte of at least 0.05 seconds, got %f", timings.TimeToFirstByte))
+	th.Assert(t, timings.BodyTransfer >= 0.05, fmt.Sprintf("expected body transfer time of at least 0.05 seconds, got %f", timings.BodyTransfer))
+
+	// second request reuses the connection, so the connection timings of the first request are cleared
+	timings = doRequest()
+	th.Assert(t, timings.TCPConnect == 0, fmt.Sprintf("expected no TCP connect time for a reused connection, got %f", timings.TCPConnect))
+	th.Assert(t, timings.TimeToFirstByte >= 0.05, fmt.Sprintf("expected time to first byte of at least 0.05 seconds, got %f", timings.TimeToFirstByte))
+}
@@ -0,0 +1,44 @@
+package capabilityquerier
+
+import (
+	"net/http"
+	"strings"
+)
+
+// corsOrigin is sent as the Origin of capability statement requests so that servers that support CORS for
+// browser-based SMART apps include their CORS headers in the response
+var corsOrigin = "https://lantern.healthit.gov"
+
+// curatedHeaders are the response headers that are kept for each capability statement request
+var curatedHeaders = []string{
+	"Content-Type",
+	"Server",
+	"Strict-Transport-Security",
+	"Access-Control-Allow-Origin",
+	"Access-Control-Allow-Credentials",
+	"Access-Control-Allow-Methods",
+	"Access-Control-Allow-Headers",
+	"Access-Control-Expose-Headers",
+	"Cache-Control",
+	"ETag",
+	"Last-Modified",
+	"WWW-Authenticate",
+	"X-Powered-By",
+}
+
+// curateResponseHeaders returns the curated headers that are present in the response headers, keyed by the
+// names in curatedHeaders. Headers with multiple values have their values joined with ", ". nil is returned
+// if there was no response.
+func curateResponseHeaders(header http.Header) map[string]string {
+	if header == nil {
+		return nil
+	}
+	curated := make(map[string]string)
+	for _, name := range curatedHeaders {
+		values := header.Values(name)
+		if len(values) > 0 {
+			curated[name] = strings.Join(values, ", ")
+		}
+	}
+	return curated
+}
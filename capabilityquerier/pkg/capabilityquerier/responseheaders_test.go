@@ -0,0 +1,55 @@
+package capabilityquerier
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+	th "github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/testhelper"
+)
+
+func Test_curateResponseHeaders(t *testing.T) {
+	header := http.Header{}
+	header.Set("Content-Type", "application/fhir+json")
+	header.Set("Etag", "W/\"1\"")
+	header.Add("Www-Authenticate", "Bearer realm=\"fhir\"")
+	header.Add("Www-Authenticate", "Basic")
+	header.Set("Set-Cookie", "session=1")
+
+	curated := curateResponseHeaders(header)
+	th.Assert(t, len(curated) == 3, fmt.Sprintf("expected 3 curated headers, got %v", curated))
+	th.Assert(t, curated["Content-Type"] == "application/fhir+json", fmt.Sprintf("expected Content-Type application/fhir+json, got %s", curated["Content-Type"]))
+	th.Assert(t, curated["ETag"] == "W/\"1\"", fmt.Sprintf("expected ETag W/\"1\", got %s", curated["ETag"]))
+	th.Assert(t, curated["WWW-Authenticate"] == "Bearer realm=\"fhir\", Basic", fmt.Sprintf("expected both WWW-Authenticate values, got %s", curated["WWW-Authenticate"]))
+	_, ok := curated["Set-Cookie"]
+	th.Assert(t, !ok, "did not expect headers outside of the curated set")
+
+	th.Assert(t, curateResponseHeaders(nil) == nil, "expected nil headers when there was no response")
+}
+
+func Test_requestCapabilityStatementAndSmartOnFhirHeaders(t *testing.T) {
+	ctx := context.Background()
+	metadataURL := endpointmanager.NormalizeEndpointURL(sampleURLNoTLS)
+
+	var origin string
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin = r.Header.Get("Origin")
+		w.Header().Set("Content-Type", fhir3PlusJSONMIMEType)
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Server", "test")
+		_, _ = w.Write([]byte("{\"resourceType\": \"CapabilityStatement\"}"))
+	})
+	tc := th.NewTestClientNoTLS(h)
+	defer tc.Close()
+
+	message := Message{}
+	message.RequestedFhirVersion = "None"
+	err := requestCapabilityStatementAndSmartOnFhir(ctx, metadataURL, "metadata", &(tc.Client), "", nil, &message)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, origin == corsOrigin, fmt.Sprintf("expected the request to have Origin %s, got %s", corsOrigin, origin))
+	th.Assert(t, message.ResponseHeaders["Content-Type"] == fhir3PlusJSONMIMEType, fmt.Sprintf("expected Content-Type %s, got %s", fhir3PlusJSONMIMEType, message.ResponseHeaders["Content-Type"]))
+	th.Assert(t, message.ResponseHeaders["Access-Control-Allow-Origin"] == "*", fmt.Sprintf("expected Access-Control-Allow-Origin *, got %s", message.ResponseHeaders["Access-Control-Allow-Origin"]))
+	th.Assert(t, message.ResponseHeaders["Server"] == "test", fmt.Sprintf("expected Server test, got %s", message.ResponseHeaders["Server"]))
+}
@@ -0,0 +1,208 @@
+package capabilityquerier
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+	"github.com/pkg/errors"
+)
+
+var tlsInspectionTimeout = 10 * time.Second
+
+// tlsRootCAs is the pool of root certificates that certificate chains are verified against. A nil pool
+// uses the system roots.
+var tlsRootCAs *x509.CertPool
+
+type tlsStateRecorderKey struct{}
+
+// tlsStateRecorder records the TLS connection state of the most recent response to a request made with its context
+type tlsStateRecorder struct {
+	host  string
+	state *tls.ConnectionState
+}
+
+// reset clears the connection state of a previous request
+func (tr *tlsStateRecorder) reset() {
+	tr.host = ""
+	tr.state = nil
+}
+
+// record keeps the connection state of resp along with the host that sent it, which is not the requested host
+// if the request was redirected
+func (tr *tlsStateRecorder) record(resp *http.Response) {
+	tr.host = resp.Request.URL.Hostname()
+	tr.state = resp.TLS
+}
+
+// stateFor returns the connection state of the most recent response if it was sent by host, and nil otherwise
+func (tr *tlsStateRecorder) stateFor(host string) *tls.ConnectionState {
+	if tr.host != host {
+		return nil
+	}
+	return tr.state
+}
+
+// withTLSStateRecorder returns a context that records the TLS connection state of the responses to requests made
+// with it
+func withTLSStateRecorder(ctx context.Context, tr *tlsStateRecorder) context.Context {
+	return context.WithValue(ctx, tlsStateRecorderKey{}, tr)
+}
+
+func tlsStateRecorderFrom(ctx context.Context) (*tlsStateRecorder, bool) {
+	tr, ok := ctx.Value(tlsStateRecorderKey{}).(*tlsStateRecorder)
+	return tr, ok
+}
+
+// inspectTLS returns information about the TLS handshake with the host of the given URL and the certificate
+// chain presented by the host. If state is the connection state of a response from the host, the information is
+// taken from it. Otherwise a TLS handshake is made with the host without verifying the chain so that the
+// certificate information is recorded even when the chain is not valid. The handshake waits on the scheduler and
+// is recorded with the breaker like any other request to the host; either may be nil. The chain is then verified
+// separately. nil is returned for URLs that do not use TLS.
+func inspectTLS(ctx context.Context, fhirURL string, state *tls.ConnectionState, scheduler *HostScheduler, breaker *CircuitBreaker) (*endpointmanager.TLSInfo, error) {
+	parsedURL, err := url.Parse(fhirURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to parse URL %s", fhirURL)
+	}
+	if parsedURL.Scheme != "https" {
+		return nil, nil
+	}
+
+	host := parsedURL.Hostname()
+	if state == nil {
+		state, err = dialTLS(ctx, parsedURL, scheduler, breaker)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(state.PeerCertificates) == 0 {
+		return nil, errors.Errorf("%s did not present a certificate", host)
+	}
+	leaf := state.PeerCertificates[0]
+
+	tlsInfo := endpointmanager.TLSInfo{
+		TLSVersion:   tlsVersionName(state.Version),
+		CipherSuite:  tls.CipherSuiteName(state.CipherSuite),
+		ALPNProtocol: state.NegotiatedProtocol,
+		LeafSubject:  leaf.Subject.String(),
+		LeafSANs:     certificateSANs(leaf),
+		LeafIssuer:   leaf.Issuer.String(),
+		NotBefore:    leaf.NotBefore,
+		NotAfter:     leaf.NotAfter,
+		ChainLength:  len(state.PeerCertificates),
+		SelfSigned:   isSelfSigned(leaf),
+	}
+	tlsInfo.KeyType, tlsInfo.KeySize = publicKeyTypeAndSize(leaf)
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err = leaf.Verify(x509.VerifyOptions{
+		Roots:         tlsRootCAs,
+		Intermediates: intermediates,
+	})
+	if err != nil {
+		tlsInfo.VerificationError = err.Error()
+	} else {
+		tlsInfo.ChainVerified = true
+	}
+	tlsInfo.HostnameMatch = leaf.VerifyHostname(host) == nil
+
+	return &tlsInfo, nil
+}
+
+// dialTLS makes a TLS handshake with the host of hostURL without verifying its certificate chain and returns the
+// connection state
+func dialTLS(ctx context.Context, hostURL *url.URL, scheduler *HostScheduler, breaker *CircuitBreaker) (*tls.ConnectionState, error) {
+	host := hostURL.Hostname()
+	port := hostURL.Port()
+	if port == "" {
+		port = "443"
+	}
+
+	if breaker != nil {
+		err := breaker.Allow(host)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if scheduler != nil {
+		release, _, err := scheduler.Wait(ctx, host)
+		if err != nil {
+			if breaker != nil {
+				breaker.record(host, requestAbandoned)
+			}
+			return nil, err
+		}
+		defer release()
+	}
+
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: tlsInspectionTimeout},
+		Config: &tls.Config{
+			ServerName:         host,
+			NextProtos:         []string{"h2", "http/1.1"},
+			InsecureSkipVerify: true, //nolint:gosec // the chain is verified by inspectTLS so that invalid chains can be recorded
+		},
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	if breaker != nil {
+		switch {
+		case err != nil && ctx.Err() == context.Canceled:
+			breaker.record(host, requestAbandoned)
+		case err != nil:
+			breaker.record(host, requestFailed)
+		default:
+			breaker.record(host, requestSucceeded)
+		}
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "TLS handshake with %s failed", host)
+	}
+	defer conn.Close()
+
+	state := conn.(*tls.Conn).ConnectionState()
+	return &state, nil
+}
+
+func certificateSANs(cert *x509.Certificate) []string {
+	sans := append([]string{}, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	return sans
+}
+
+// isSelfSigned checks whether the certificate is signed by its own key. The signature is checked directly
+// rather than with CheckSignatureFrom because self-signed leaf certificates are often not marked as CAs.
+func isSelfSigned(cert *x509.Certificate) bool {
+	if !bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+		return false
+	}
+	return cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+}
+
+func publicKeyTypeAndSize(cert *x509.Certificate) (string, int) {
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return "RSA", key.N.BitLen()
+	case *ecdsa.PublicKey:
+		return "ECDSA", key.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		return "Ed25519", 256
+	default:
+		return cert.PublicKeyAlgorithm.String(), 0
+	}
+}
@@ -0,0 +1,114 @@
+package capabilityquerier
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/helpers"
+	th "github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/testhelper"
+)
+
+func Test_inspectTLS(t *testing.T) {
+	ctx := context.Background()
+
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer s.Close()
+
+	// the test server's self-signed certificate does not verify against the system roots
+	tlsInfo, err := inspectTLS(ctx, s.URL, nil, nil, nil)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, tlsInfo != nil, "expected TLS info for an https URL")
+	th.Assert(t, tlsInfo.TLSVersion == tls13, fmt.Sprintf("expected TLS version %s, got %s", tls13, tlsInfo.TLSVersion))
+	th.Assert(t, tlsInfo.CipherSuite != "", "expected the cipher suite to be recorded")
+	th.Assert(t, tlsInfo.ALPNProtocol == "http/1.1", fmt.Sprintf("expected ALPN protocol http/1.1, got %s", tlsInfo.ALPNProtocol))
+	th.Assert(t, tlsInfo.KeyType == "RSA", fmt.Sprintf("expected key type RSA, got %s", tlsInfo.KeyType))
+	th.Assert(t, tlsInfo.KeySize > 0, "expected the key size to be recorded")
+	th.Assert(t, tlsInfo.ChainLength == 1, fmt.Sprintf("expected chain length 1, got %d", tlsInfo.ChainLength))
+	th.Assert(t, tlsInfo.SelfSigned, "expected the test server certificate to be self-signed")
+	th.Assert(t, !tlsInfo.ChainVerified, "did not expect the test server certificate to verify against the system roots")
+	th.Assert(t, tlsInfo.VerificationError != "", "expected the verification error to be recorded")
+	th.Assert(t, tlsInfo.HostnameMatch, "expected the test server certificate to be valid for 127.0.0.1")
+	th.Assert(t, helpers.StringArrayContains(tlsInfo.LeafSANs, "127.0.0.1"), fmt.Sprintf("expected 127.0.0.1 in the SANs, got %v", tlsInfo.LeafSANs))
+	th.Assert(t, tlsInfo.NotAfter.After(tlsInfo.NotBefore), "expected the validity period to be recorded")
+
+	// the chain verifies when the test server certificate is trusted
+	tlsRootCAs = x509.NewCertPool()
+	tlsRootCAs.AddCert(s.Certificate())
+	defer func() { tlsRootCAs = nil }()
+
+	tlsInfo, err = inspectTLS(ctx, s.URL, nil, nil, nil)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, tlsInfo.ChainVerified, fmt.Sprintf("expected the chain to verify, got error %s", tlsInfo.VerificationError))
+	th.Assert(t, tlsInfo.VerificationError == "", "did not expect a verification error")
+
+	// URLs that do not use TLS are not inspected
+	tlsInfo, err = inspectTLS(ctx, sampleURLNoTLS, nil, nil, nil)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, tlsInfo == nil, "did not expect TLS info for an http URL")
+
+	// unreachable host
+	s.Close()
+	_, err = inspectTLS(ctx, s.URL, nil, nil, nil)
+	th.Assert(t, err != nil, "expected an error for a closed server")
+}
+
+func Test_inspectTLSConnectionState(t *testing.T) {
+	ctx := context.Background()
+
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer s.Close()
+
+	// the connection state of a response is inspected without making another handshake
+	tlsStates := &tlsStateRecorder{}
+	req, err := http.NewRequestWithContext(withTLSStateRecorder(ctx, tlsStates), "GET", s.URL, nil)
+	th.Assert(t, err == nil, err)
+	_, _, _, _, _, _, err = requestWithMimeType(req, fhir3PlusJSONMIMEType, s.Client())
+	th.Assert(t, err == nil, err)
+	state := tlsStates.stateFor("127.0.0.1")
+	th.Assert(t, state != nil, "expected the connection state of the response to be recorded")
+	th.Assert(t, tlsStates.stateFor("example.com") == nil, "did not expect a connection state for another host")
+	s.Close()
+
+	tlsInfo, err := inspectTLS(ctx, s.URL, state, nil, nil)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, tlsInfo.TLSVersion == tls13, fmt.Sprintf("expected TLS version %s, got %s", tls13, tlsInfo.TLSVersion))
+	th.Assert(t, tlsInfo.SelfSigned, "expected the test server certificate to be self-signed")
+	th.Assert(t, !tlsInfo.ChainVerified, "did not expect the test server certificate to verify against the system roots")
+	th.Assert(t, tlsInfo.HostnameMatch, "expected the test server certificate to be valid for 127.0.0.1")
+}
+
+func Test_inspectTLSLimits(t *testing.T) {
+	ctx := context.Background()
+
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer s.Close()
+
+	// the handshake waits on the scheduler and is recorded with the breaker
+	scheduler := NewHostScheduler(1, 0)
+	breaker := NewCircuitBreaker(1, time.Hour, nil)
+	_, err := inspectTLS(ctx, s.URL, nil, scheduler, breaker)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, breaker.State("127.0.0.1") == endpointmanager.CircuitClosed, "expected the circuit to stay closed after a successful handshake")
+
+	release, _, err := scheduler.Wait(ctx, "127.0.0.1")
+	th.Assert(t, err == nil, err)
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = inspectTLS(timeoutCtx, s.URL, nil, scheduler, breaker)
+	th.Assert(t, err != nil, "expected an error while the host's only slot is taken")
+	release()
+
+	// a failed handshake opens the circuit, after which no handshake is made
+	s.Close()
+	_, err = inspectTLS(ctx, s.URL, nil, scheduler, breaker)
+	th.Assert(t, err != nil, "expected an error for a closed server")
+	th.Assert(t, breaker.State("127.0.0.1") == endpointmanager.CircuitOpen, "expected the failed handshake to open the circuit")
+	_, err = inspectTLS(ctx, s.URL, nil, scheduler, breaker)
+	th.Assert(t, classifyError(err) == endpointmanager.CircuitOpenCode, fmt.Sprintf("expected a circuit open error, got %v", err))
+}
@@ -0,0 +1,267 @@
+package capabilityquerier
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	_ "crypto/sha256" // registers the SHA-256 hash used by the RS256, PS256 and ES256 algorithms
+	_ "crypto/sha512" // registers the SHA-384 and SHA-512 hashes used by the other algorithms
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+)
+
+// maxUDAPMetadataSize is the most of a UDAP metadata response that is read
+var maxUDAPMetadataSize int64 = 1 << 20
+
+// jwsHashes are the hashes used by the JWS algorithms whose signatures can be verified
+var jwsHashes = map[string]crypto.Hash{
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+	"PS256": crypto.SHA256,
+	"PS384": crypto.SHA384,
+	"PS512": crypto.SHA512,
+	"ES256": crypto.SHA256,
+	"ES384": crypto.SHA384,
+	"ES512": crypto.SHA512,
+}
+
+// fetchUDAPMetadata requests the UDAP metadata at udapURL and records what it advertises. Problems retrieving or
+// parsing the metadata are recorded in the returned UDAPInfo's Error rather than returned.
+func fetchUDAPMetadata(ctx context.Context, client *http.Client, udapURL string, userAgent string) *endpointmanager.UDAPInfo {
+	udapInfo := &endpointmanager.UDAPInfo{
+		URL: udapURL,
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", udapURL, nil)
+	if err != nil {
+		udapInfo.Error = "unable to create new GET request from UDAP metadata URL: " + err.Error()
+		return udapInfo
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		udapInfo.Error = fmt.Sprintf("making the GET request to %s failed: %s", udapURL, err.Error())
+		return udapInfo
+	}
+	defer resp.Body.Close()
+
+	udapInfo.HTTPResponse = resp.StatusCode
+	if resp.StatusCode != http.StatusOK {
+		udapInfo.Error = fmt.Sprintf("the UDAP metadata URL returned HTTP status %d", resp.StatusCode)
+		return udapInfo
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxUDAPMetadataSize))
+	if err != nil {
+		udapInfo.Error = "reading the UDAP metadata response failed: " + err.Error()
+		return udapInfo
+	}
+
+	err = parseUDAPMetadata(body, udapInfo)
+	if err != nil {
+		udapInfo.Error = err.Error()
+	}
+
+	return udapInfo
+}
+
+// parseUDAPMetadata fills out udapInfo with the fields of the UDAP metadata document in body
+func parseUDAPMetadata(body []byte, udapInfo *endpointmanager.UDAPInfo) error {
+	var document map[string]interface{}
+	err := json.Unmarshal(body, &document)
+	if err != nil {
+		return fmt.Errorf("the UDAP metadata response is not a JSON object: %s", err.Error())
+	}
+
+	stringField := func(name string) string {
+		value, _ := document[name].(string)
+		return strings.TrimSpace(value)
+	}
+
+	udapInfo.VersionsSupported = stringList(document["udap_versions_supported"])
+	udapInfo.ProfilesSupported = stringList(document["udap_profiles_supported"])
+	udapInfo.AuthorizationExtensionsSupported = stringList(document["udap_authorization_extensions_supported"])
+	udapInfo.AuthorizationExtensionsRequired = stringList(document["udap_authorization_extensions_required"])
+	udapInfo.CertificationsSupported = stringList(document["udap_certifications_supported"])
+	udapInfo.CertificationsRequired = stringList(document["udap_certifications_required"])
+	udapInfo.GrantTypesSupported = stringList(document["grant_types_supported"])
+	udapInfo.ScopesSupported = stringList(document["scopes_supported"])
+	udapInfo.TokenEndpointAuthMethodsSupported = stringList(document["token_endpoint_auth_methods_supported"])
+	udapInfo.TokenEndpointAuthSigningAlgs = stringList(document["token_endpoint_auth_signing_alg_values_supported"])
+	udapInfo.RegistrationSigningAlgs = stringList(document["registration_endpoint_jwt_signing_alg_values_supported"])
+	udapInfo.AuthorizationEndpoint = stringField("authorization_endpoint")
+	udapInfo.TokenEndpoint = stringField("token_endpoint")
+	udapInfo.RegistrationEndpoint = stringField("registration_endpoint")
+
+	if signedMetadata := stringField("signed_metadata"); signedMetadata != "" {
+		udapInfo.SignedMetadata = parseSignedMetadata(signedMetadata)
+	}
+
+	return nil
+}
+
+// stringList returns the strings in a JSON array. It returns nil if value is not an array, so that a missing field
+// can be told apart from an empty one.
+func stringList(value interface{}) []string {
+	values, ok := value.([]interface{})
+	if !ok {
+		return nil
+	}
+	list := make([]string, 0, len(values))
+	for _, v := range values {
+		if str, ok := v.(string); ok {
+			list = append(list, str)
+		}
+	}
+	return list
+}
+
+// parseSignedMetadata parses the signed_metadata JWT and verifies its signature with the key of the first
+// certificate in its x5c header. The certificate chain is not checked against a trust anchor. Problems parsing or
+// verifying the JWT are recorded in the returned UDAPSignedMetadata's Error.
+func parseSignedMetadata(token string) *endpointmanager.UDAPSignedMetadata {
+	signedMetadata := &endpointmanager.UDAPSignedMetadata{}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		signedMetadata.Error = "signed_metadata is not a JWT"
+		return signedMetadata
+	}
+
+	var header struct {
+		Algorithm string   `json:"alg"`
+		X5C       []string `json:"x5c"`
+	}
+	err := decodeJWTPart(parts[0], &header)
+	if err != nil {
+		signedMetadata.Error = "unable to parse the signed_metadata header: " + err.Error()
+		return signedMetadata
+	}
+	signedMetadata.Algorithm = header.Algorithm
+	signedMetadata.ChainLength = len(header.X5C)
+
+	var claims struct {
+		Issuer                string      `json:"iss"`
+		Subject               string      `json:"sub"`
+		IssuedAt              json.Number `json:"iat"`
+		ExpiresAt             json.Number `json:"exp"`
+		AuthorizationEndpoint string      `json:"authorization_endpoint"`
+		TokenEndpoint         string      `json:"token_endpoint"`
+		RegistrationEndpoint  string      `json:"registration_endpoint"`
+	}
+	err = decodeJWTPart(parts[1], &claims)
+	if err != nil {
+		signedMetadata.Error = "unable to parse the signed_metadata claims: " + err.Error()
+		return signedMetadata
+	}
+	signedMetadata.Issuer = claims.Issuer
+	signedMetadata.Subject = claims.Subject
+	signedMetadata.IssuedAt = numericDate(claims.IssuedAt)
+	signedMetadata.ExpiresAt = numericDate(claims.ExpiresAt)
+	signedMetadata.AuthorizationEndpoint = claims.AuthorizationEndpoint
+	signedMetadata.TokenEndpoint = claims.TokenEndpoint
+	signedMetadata.RegistrationEndpoint = claims.RegistrationEndpoint
+
+	if len(header.X5C) == 0 {
+		signedMetadata.Error = "the signed_metadata header does not include an x5c certificate chain"
+		return signedMetadata
+	}
+	der, err := base64.StdEncoding.DecodeString(header.X5C[0])
+	if err != nil {
+		signedMetadata.Error = "unable to decode the signed_metadata signing certificate: " + err.Error()
+		return signedMetadata
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		signedMetadata.Error = "unable to parse the signed_metadata signing certificate: " + err.Error()
+		return signedMetadata
+	}
+	signedMetadata.LeafSubject = leaf.Subject.String()
+	signedMetadata.LeafIssuer = leaf.Issuer.String()
+	signedMetadata.LeafNotAfter = leaf.NotAfter
+	for _, uri := range leaf.URIs {
+		signedMetadata.LeafSANURIs = append(signedMetadata.LeafSANURIs, uri.String())
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		signedMetadata.Error = "unable to decode the signed_metadata signature: " + err.Error()
+		return signedMetadata
+	}
+	err = verifyJWSSignature(header.Algorithm, parts[0]+"."+parts[1], signature, leaf.PublicKey)
+	if err != nil {
+		signedMetadata.Error = "the signed_metadata signature is not valid: " + err.Error()
+		return signedMetadata
+	}
+	signedMetadata.SignatureValid = true
+
+	return signedMetadata
+}
+
+// decodeJWTPart decodes a base64url encoded JWT header or claims set into v
+func decodeJWTPart(part string, v interface{}) error {
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(part, "="))
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(strings.NewReader(string(decoded)))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// numericDate returns the time of a JWT NumericDate, or the zero time if the claim is missing or not a number
+func numericDate(value json.Number) time.Time {
+	seconds, err := value.Float64()
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(int64(seconds), 0).UTC()
+}
+
+// verifyJWSSignature checks that signature is the signature of signingInput by publicKey using the JWS algorithm alg
+func verifyJWSSignature(alg string, signingInput string, signature []byte, publicKey interface{}) error {
+	hash, ok := jwsHashes[alg]
+	if !ok {
+		return fmt.Errorf("the %s algorithm is not supported", alg)
+	}
+	hasher := hash.New()
+	hasher.Write([]byte(signingInput))
+	digest := hasher.Sum(nil)
+
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		if strings.HasPrefix(alg, "RS") {
+			return rsa.VerifyPKCS1v15(key, hash, digest, signature)
+		}
+		if strings.HasPrefix(alg, "PS") {
+			return rsa.VerifyPSS(key, hash, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		}
+	case *ecdsa.PublicKey:
+		if strings.HasPrefix(alg, "ES") {
+			keyBytes := (key.Curve.Params().BitSize + 7) / 8
+			if len(signature) != 2*keyBytes {
+				return fmt.Errorf("the signature is %d bytes instead of %d", len(signature), 2*keyBytes)
+			}
+			r := new(big.Int).SetBytes(signature[:keyBytes])
+			s := new(big.Int).SetBytes(signature[keyBytes:])
+			if !ecdsa.Verify(key, digest, r, s) {
+				return fmt.Errorf("the ECDSA signature does not verify")
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("the %s algorithm does not match the signing certificate's %T key", alg, publicKey)
+}
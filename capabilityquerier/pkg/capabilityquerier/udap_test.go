@@ -0,0 +1,165 @@
+package capabilityquerier
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	th "github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/testhelper"
+)
+
+func Test_parseSignedMetadata(t *testing.T) {
+	issuedAt := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	claims := map[string]interface{}{
+		"iss":            "https://example.com/fhir",
+		"sub":            "https://example.com/fhir",
+		"iat":            issuedAt.Unix(),
+		"exp":            issuedAt.Add(time.Hour).Unix(),
+		"token_endpoint": "https://example.com/token",
+	}
+
+	// RS256
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	th.Assert(t, err == nil, err)
+	token := signTestJWT(t, "RS256", rsaKey, claims)
+	signedMetadata := parseSignedMetadata(token)
+	th.Assert(t, signedMetadata.Error == "", fmt.Sprintf("expected no error, got %s", signedMetadata.Error))
+	th.Assert(t, signedMetadata.SignatureValid, "expected the RS256 signature to be valid")
+	th.Assert(t, signedMetadata.Algorithm == "RS256", fmt.Sprintf("expected algorithm RS256, got %s", signedMetadata.Algorithm))
+	th.Assert(t, signedMetadata.Issuer == "https://example.com/fhir", fmt.Sprintf("unexpected issuer %s", signedMetadata.Issuer))
+	th.Assert(t, signedMetadata.IssuedAt.Equal(issuedAt), fmt.Sprintf("unexpected issued at %s", signedMetadata.IssuedAt))
+	th.Assert(t, signedMetadata.ExpiresAt.Equal(issuedAt.Add(time.Hour)), fmt.Sprintf("unexpected expiration %s", signedMetadata.ExpiresAt))
+	th.Assert(t, signedMetadata.TokenEndpoint == "https://example.com/token", fmt.Sprintf("unexpected token endpoint %s", signedMetadata.TokenEndpoint))
+	th.Assert(t, signedMetadata.ChainLength == 1, fmt.Sprintf("expected a chain length of 1, got %d", signedMetadata.ChainLength))
+	th.Assert(t, len(signedMetadata.LeafSANURIs) == 1 && signedMetadata.LeafSANURIs[0] == "https://example.com/fhir", fmt.Sprintf("unexpected SAN URIs %v", signedMetadata.LeafSANURIs))
+
+	// ES256
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	th.Assert(t, err == nil, err)
+	signedMetadata = parseSignedMetadata(signTestJWT(t, "ES256", ecKey, claims))
+	th.Assert(t, signedMetadata.SignatureValid, fmt.Sprintf("expected the ES256 signature to be valid, got error %s", signedMetadata.Error))
+
+	// tampered claims
+	otherToken := signTestJWT(t, "RS256", rsaKey, map[string]interface{}{"iss": "https://attacker.example.com"})
+	parts := strings.Split(token, ".")
+	otherParts := strings.Split(otherToken, ".")
+	signedMetadata = parseSignedMetadata(parts[0] + "." + otherParts[1] + "." + parts[2])
+	th.Assert(t, !signedMetadata.SignatureValid, "expected the signature of tampered claims to be invalid")
+	th.Assert(t, signedMetadata.Issuer == "https://attacker.example.com", "expected the tampered claims to still be recorded")
+	th.Assert(t, signedMetadata.Error != "", "expected an error for an invalid signature")
+
+	// not a JWT
+	signedMetadata = parseSignedMetadata("not-a-jwt")
+	th.Assert(t, signedMetadata.Error != "", "expected an error for a value that is not a JWT")
+
+	// no x5c chain
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256"}`))
+	signedMetadata = parseSignedMetadata(header + "." + parts[1] + "." + parts[2])
+	th.Assert(t, signedMetadata.Error != "", "expected an error without an x5c chain")
+	th.Assert(t, signedMetadata.Issuer == "https://example.com/fhir", "expected the claims to be recorded without an x5c chain")
+}
+
+func Test_fetchUDAPMetadata(t *testing.T) {
+	ctx := context.Background()
+	client := createHTTPClient(nil, nil)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	th.Assert(t, err == nil, err)
+	token := signTestJWT(t, "RS256", rsaKey, map[string]interface{}{"iss": "https://example.com/fhir", "sub": "https://example.com/fhir"})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/fhir/.well-known/udap", func(w http.ResponseWriter, r *http.Request) {
+		document := map[string]interface{}{
+			"udap_versions_supported":                          []string{"1"},
+			"udap_profiles_supported":                          []string{"udap_dcr", "udap_authn", "udap_authz"},
+			"udap_authorization_extensions_supported":          []string{"hl7-b2b"},
+			"udap_certifications_supported":                    []string{},
+			"grant_types_supported":                            []string{"authorization_code", "refresh_token", "client_credentials"},
+			"token_endpoint_auth_methods_supported":            []string{"private_key_jwt"},
+			"token_endpoint_auth_signing_alg_values_supported": []string{"RS256", "ES256"},
+			"authorization_endpoint":                           "https://example.com/authorize",
+			"token_endpoint":                                   "https://example.com/token",
+			"registration_endpoint":                            "https://example.com/register",
+			"signed_metadata":                                  token,
+		}
+		err := json.NewEncoder(w).Encode(document)
+		th.Assert(t, err == nil, err)
+	})
+	mux.HandleFunc("/html/.well-known/udap", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html></html>`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	udapInfo := fetchUDAPMetadata(ctx, client, server.URL+"/fhir/.well-known/udap", "LANTERN")
+	th.Assert(t, udapInfo.Error == "", fmt.Sprintf("expected no error, got %s", udapInfo.Error))
+	th.Assert(t, udapInfo.HTTPResponse == 200, fmt.Sprintf("expected HTTP response 200, got %d", udapInfo.HTTPResponse))
+	th.Assert(t, len(udapInfo.ProfilesSupported) == 3, fmt.Sprintf("expected 3 profiles, got %v", udapInfo.ProfilesSupported))
+	th.Assert(t, len(udapInfo.GrantTypesSupported) == 3, fmt.Sprintf("expected 3 grant types, got %v", udapInfo.GrantTypesSupported))
+	th.Assert(t, udapInfo.CertificationsSupported != nil && len(udapInfo.CertificationsSupported) == 0, fmt.Sprintf("expected an empty list of certifications, got %v", udapInfo.CertificationsSupported))
+	th.Assert(t, udapInfo.CertificationsRequired == nil, fmt.Sprintf("expected no list for a missing field, got %v", udapInfo.CertificationsRequired))
+	th.Assert(t, udapInfo.RegistrationEndpoint == "https://example.com/register", fmt.Sprintf("unexpected registration endpoint %s", udapInfo.RegistrationEndpoint))
+	th.Assert(t, udapInfo.SignedMetadata != nil && udapInfo.SignedMetadata.SignatureValid, fmt.Sprintf("expected valid signed metadata, got %+v", udapInfo.SignedMetadata))
+
+	// not published
+	udapInfo = fetchUDAPMetadata(ctx, client, server.URL+"/missing/.well-known/udap", "LANTERN")
+	th.Assert(t, udapInfo.HTTPResponse == 404, fmt.Sprintf("expected HTTP response 404, got %d", udapInfo.HTTPResponse))
+	th.Assert(t, udapInfo.Error != "", "expected an error for metadata that is not published")
+
+	// not JSON
+	udapInfo = fetchUDAPMetadata(ctx, client, server.URL+"/html/.well-known/udap", "LANTERN")
+	th.Assert(t, udapInfo.Error != "", "expected an error for a response that is not JSON")
+}
+
+// signTestJWT signs claims with key and includes a self-signed certificate for the key, with a URI subject
+// alternative name of https://example.com/fhir, in the x5c header
+func signTestJWT(t *testing.T, alg string, key crypto.Signer, claims map[string]interface{}) string {
+	sanURI, err := url.Parse("https://example.com/fhir")
+	th.Assert(t, err == nil, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		URIs:         []*url.URL{sanURI},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	th.Assert(t, err == nil, err)
+
+	header, err := json.Marshal(map[string]interface{}{"alg": alg, "x5c": []string{base64.StdEncoding.EncodeToString(der)}})
+	th.Assert(t, err == nil, err)
+	payload, err := json.Marshal(claims)
+	th.Assert(t, err == nil, err)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	digest := sha256.Sum256([]byte(signingInput))
+	var signature []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		th.Assert(t, err == nil, err)
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		th.Assert(t, err == nil, err)
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/onc-healthit/lantern-back-end/capabilityquerier/pkg/capabilityquerier"
+	"github.com/onc-healthit/lantern-back-end/capabilityreceiver/pkg/capabilityhandler"
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/queuemessage"
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/smartparser"
+	log "github.com/sirupsen/logrus"
+)
+
+// report is the result of probing a single FHIR endpoint
+type report struct {
+	URL                       string                             `json:"url"`
+	RequestedFhirVersion      string                             `json:"requestedFhirVersion"`
+	HTTPResponse              int                                `json:"httpResponse"`
+	Error                     string                             `json:"error"`
+	ErrorCode                 endpointmanager.QueryErrorCode     `json:"errorCode"`
+	ResponseTime              float64                            `json:"responseTime"`
+	MIMETypes                 []string                           `json:"mimeTypes"`
+	CapabilityStatementFormat string                             `json:"capabilityStatementFormat"`
+	CapabilityFhirVersion     string                             `json:"capabilityFhirVersion"`
+	TLSVersion                string                             `json:"tlsVersion"`
+	TLSInfo                   *endpointmanager.TLSInfo           `json:"tlsInfo"`
+	RedirectChain             []endpointmanager.RedirectHop      `json:"redirectChain"`
+	ErrorResponse             *endpointmanager.ErrorResponse     `json:"errorResponse"`
+	SMARTHTTPResponse         int                                `json:"smartHttpResponse"`
+	SMARTResponse             json.RawMessage                    `json:"smartResponse"`
+	UDAPInfo                  *endpointmanager.UDAPInfo          `json:"udapInfo"`
+	CDSHooksInfo              *endpointmanager.CDSHooksInfo      `json:"cdsHooksInfo"`
+	BulkData                  *endpointmanager.BulkDataSupport   `json:"bulkData"`
+	Audience                  endpointmanager.Audience           `json:"audience"`
+	AudienceConfidence        float64                            `json:"audienceConfidence"`
+	Vendor                    string                             `json:"vendor"`
+	Rules                     []endpointmanager.Rule             `json:"rules"`
+	IncludedFields            []endpointmanager.IncludedField    `json:"includedFields"`
+	SupportedProfiles         []endpointmanager.SupportedProfile `json:"supportedProfiles"`
+}
+
+func failOnError(err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "probe: %s\n", err.Error())
+		os.Exit(1)
+	}
+}
+
+// readVendors reads a file with one vendor name per line, ignoring blank lines
+func readVendors(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var vendors []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		name := strings.TrimSpace(scanner.Text())
+		if name != "" {
+			vendors = append(vendors, name)
+		}
+	}
+	return vendors, scanner.Err()
+}
+
+// buildReport runs the capability receiver's processing on the querier message and collects the results
+func buildReport(message capabilityquerier.Message, vendors []string) (report, error) {
+	r := report{
+		URL:                  message.URL,
+		RequestedFhirVersion: message.RequestedFhirVersion,
+		HTTPResponse:         message.HTTPResponse,
+		Error:                message.Err,
+		ErrorCode:            message.ErrorCode,
+		ResponseTime:         message.ResponseTime,
+		TLSInfo:              message.TLSInfo,
+		RedirectChain:        message.RedirectChain,
+		ErrorResponse:        message.ErrorResponse,
+		SMARTHTTPResponse:    message.SMARTHTTPResponse,
+		UDAPInfo:             message.UDAPInfo,
+		CDSHooksInfo:         message.CDSHooksInfo,
+	}
+
+	// The message is encoded the way the querier puts it on the queue
+	msgBytes, err := queuemessage.Encode(queuemessage.TypeCapabilityResponse, queuemessage.ProducerCapabilityQuerier, "", message)
+	if err != nil {
+		return r, err
+	}
+	fhirEndpoint, validation, err := capabilityhandler.ProcessMessage(msgBytes)
+	if err != nil {
+		return r, err
+	}
+
+	r.MIMETypes = fhirEndpoint.MIMETypes
+	r.CapabilityStatementFormat = fhirEndpoint.CapabilityStatementFormat
+	r.CapabilityFhirVersion = fhirEndpoint.CapabilityFhirVersion
+	r.TLSVersion = fhirEndpoint.TLSVersion
+	r.IncludedFields = fhirEndpoint.IncludedFields
+	r.SupportedProfiles = fhirEndpoint.SupportedProfiles
+	r.BulkData = fhirEndpoint.BulkData
+	// The probe does not read the database, so the audience is classified without the endpoint's list sources
+	var smartConfig *smartparser.SMARTConfiguration
+	if fhirEndpoint.SMARTResponse != nil {
+		smartConfig, _ = fhirEndpoint.SMARTResponse.GetConfiguration()
+	}
+	audience := endpointmanager.ClassifyAudience(nil, smartConfig, fhirEndpoint.SupportedProfiles)
+	r.Audience = audience.Audience
+	r.AudienceConfidence = audience.Confidence
+	if validation != nil {
+		r.Rules = validation.Results
+	}
+	if fhirEndpoint.SMARTResponse != nil {
+		r.SMARTResponse, err = fhirEndpoint.SMARTResponse.GetJSON()
+		if err != nil {
+			return r, err
+		}
+	}
+	if fhirEndpoint.CapabilityStatement != nil && len(vendors) > 0 {
+		r.Vendor, err = capabilityhandler.MatchVendor(fhirEndpoint.CapabilityStatement, vendors)
+		if err != nil {
+			return r, err
+		}
+	}
+
+	return r, nil
+}
+
+// printReport writes a human readable version of the report to w
+func printReport(w io.Writer, r report) {
+	fmt.Fprintf(w, "URL:                  %s\n", r.URL)
+	if r.RequestedFhirVersion != "None" {
+		fmt.Fprintf(w, "Requested version:    %s\n", r.RequestedFhirVersion)
+	}
+	fmt.Fprintf(w, "HTTP response:        %d\n", r.HTTPResponse)
+	if r.Error != "" {
+		fmt.Fprintf(w, "Error:                %s (%s)\n", r.Error, r.ErrorCode)
+	} else if r.ErrorCode != "" {
+		fmt.Fprintf(w, "Error code:           %s\n", r.ErrorCode)
+	}
+	if r.ErrorResponse != nil {
+		fmt.Fprintf(w, "Error response:       %s\n", r.ErrorResponse.Kind)
+		for _, challenge := range r.ErrorResponse.AuthChallenges {
+			fmt.Fprintf(w, "  challenge:          %s realm=%q error=%q\n", challenge.Scheme, challenge.Realm, challenge.Error)
+		}
+		for _, issue := range r.ErrorResponse.Issues {
+			fmt.Fprintf(w, "  issue:              %s %s %s\n", issue.Severity, issue.Code, issue.Diagnostics)
+		}
+	}
+	fmt.Fprintf(w, "Response time:        %.3fs\n", r.ResponseTime)
+	fmt.Fprintf(w, "MIME types:           %s\n", strings.Join(r.MIMETypes, ", "))
+	fmt.Fprintf(w, "Statement format:     %s\n", r.CapabilityStatementFormat)
+	fmt.Fprintf(w, "FHIR version:         %s\n", r.CapabilityFhirVersion)
+	if r.Vendor != "" {
+		fmt.Fprintf(w, "Vendor:               %s\n", r.Vendor)
+	}
+	fmt.Fprintf(w, "Audience:             %s (confidence %.3f)\n", r.Audience, r.AudienceConfidence)
+	for _, hop := range r.RedirectChain {
+		fmt.Fprintf(w, "Redirect:             %d %s -> %s\n", hop.StatusCode, hop.URL, hop.Location)
+	}
+
+	fmt.Fprintf(w, "\nTLS\n")
+	if r.TLSInfo == nil {
+		fmt.Fprintf(w, "  version:            %s\n", r.TLSVersion)
+	} else {
+		fmt.Fprintf(w, "  version:            %s\n", r.TLSInfo.TLSVersion)
+		fmt.Fprintf(w, "  cipher suite:       %s\n", r.TLSInfo.CipherSuite)
+		fmt.Fprintf(w, "  subject:            %s\n", r.TLSInfo.LeafSubject)
+		fmt.Fprintf(w, "  issuer:             %s\n", r.TLSInfo.LeafIssuer)
+		fmt.Fprintf(w, "  expires:            %s\n", r.TLSInfo.NotAfter.Format(time.RFC3339))
+		fmt.Fprintf(w, "  chain verified:     %t\n", r.TLSInfo.ChainVerified)
+		fmt.Fprintf(w, "  hostname match:     %t\n", r.TLSInfo.HostnameMatch)
+	}
+
+	fmt.Fprintf(w, "\nSMART configuration\n")
+	fmt.Fprintf(w, "  HTTP response:      %d\n", r.SMARTHTTPResponse)
+	if r.SMARTResponse != nil {
+		var smartJSON bytes.Buffer
+		if json.Indent(&smartJSON, r.SMARTResponse, "  ", "  ") == nil {
+			fmt.Fprintf(w, "  %s\n", smartJSON.String())
+		}
+	}
+
+	if r.UDAPInfo != nil {
+		fmt.Fprintf(w, "\nUDAP metadata\n")
+		fmt.Fprintf(w, "  HTTP response:      %d\n", r.UDAPInfo.HTTPResponse)
+		if r.UDAPInfo.Error != "" {
+			fmt.Fprintf(w, "  error:              %s\n", r.UDAPInfo.Error)
+		}
+		if r.UDAPInfo.HTTPResponse == http.StatusOK {
+			fmt.Fprintf(w, "  profiles:           %s\n", strings.Join(r.UDAPInfo.ProfilesSupported, ", "))
+			fmt.Fprintf(w, "  grant types:        %s\n", strings.Join(r.UDAPInfo.GrantTypesSupported, ", "))
+			fmt.Fprintf(w, "  token endpoint:     %s\n", r.UDAPInfo.TokenEndpoint)
+			if r.UDAPInfo.SignedMetadata != nil {
+				fmt.Fprintf(w, "  signature valid:    %t\n", r.UDAPInfo.SignedMetadata.SignatureValid)
+			}
+		}
+	}
+
+	if r.CDSHooksInfo != nil && r.CDSHooksInfo.HTTPResponse == http.StatusOK {
+		fmt.Fprintf(w, "\nCDS Hooks services\n")
+		if r.CDSHooksInfo.Error != "" {
+			fmt.Fprintf(w, "  error:              %s\n", r.CDSHooksInfo.Error)
+		}
+		for _, service := range r.CDSHooksInfo.Services {
+			fmt.Fprintf(w, "  %-20s%s\n", service.Hook+":", service.ID)
+		}
+	}
+
+	if r.BulkData.Supported() {
+		fmt.Fprintf(w, "\nBulk Data export\n")
+		fmt.Fprintf(w, "  levels:             %s\n", strings.Join(r.BulkData.ExportLevels, ", "))
+		fmt.Fprintf(w, "  instantiates:       %s\n", strings.Join(r.BulkData.Instantiates, ", "))
+	}
+
+	passed := 0
+	for _, rule := range r.Rules {
+		if rule.Valid {
+			passed++
+		}
+	}
+	fmt.Fprintf(w, "\nRules (%d passed, %d failed)\n", passed, len(r.Rules)-passed)
+	for _, rule := range r.Rules {
+		result := "PASS"
+		if !rule.Valid {
+			result = "FAIL"
+		}
+		fmt.Fprintf(w, "  %s %s", result, rule.RuleName)
+		if !rule.Valid {
+			fmt.Fprintf(w, ": expected %q, got %q", rule.Expected, rule.Actual)
+		}
+		fmt.Fprintf(w, "\n")
+	}
+
+	fmt.Fprintf(w, "\nIncluded fields\n")
+	for _, field := range r.IncludedFields {
+		if field.Exists {
+			fmt.Fprintf(w, "  %s\n", field.Field)
+		}
+	}
+
+	fmt.Fprintf(w, "\nSupported profiles\n")
+	for _, profile := range r.SupportedProfiles {
+		fmt.Fprintf(w, "  %s (%s)\n", profile.ProfileURL, profile.Resource)
+	}
+}
+
+func main() {
+	jsonOutput := flag.Bool("json", false, "print the report as JSON")
+	version := flag.String("version", "None", "the FHIR version to request using the fhirVersion MIME type parameter")
+	vendorsFile := flag.String("vendors", "", "a file of vendor names, one per line, to match the endpoint against")
+	userAgent := flag.String("useragent", "LANTERN", "the User-Agent header sent with each request")
+	timeout := flag.Duration("timeout", 2*time.Minute, "the time allowed for all of the requests to the endpoint")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: probe [flags] <FHIR endpoint URL>\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// Keep the querier's per-request logging out of the report
+	log.SetOutput(io.Discard)
+
+	var vendors []string
+	var err error
+	if *vendorsFile != "" {
+		vendors, err = readVendors(*vendorsFile)
+		failOnError(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	message, err := capabilityquerier.QueryCapabilityStatement(ctx, flag.Arg(0), *version, *userAgent)
+	failOnError(err)
+
+	r, err := buildReport(message, vendors)
+	failOnError(err)
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		failOnError(encoder.Encode(r))
+	} else {
+		printReport(os.Stdout, r)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/onc-healthit/lantern-back-end/capabilityquerier/pkg/capabilityquerier"
+	th "github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/testhelper"
+)
+
+func testMessage(t *testing.T) capabilityquerier.Message {
+	csJSON, err := os.ReadFile(filepath.Join("../../testdata", "cerner_capability_dstu2.json"))
+	th.Assert(t, err == nil, err)
+	var capStat map[string]interface{}
+	err = json.Unmarshal(csJSON, &capStat)
+	th.Assert(t, err == nil, err)
+
+	return capabilityquerier.Message{
+		URL:                       "http://example.com/DTSU2/",
+		MIMETypes:                 []string{"application/json+fhir"},
+		TLSVersion:                "TLS 1.2",
+		HTTPResponse:              200,
+		CapabilityStatement:       capStat,
+		CapabilityStatementBytes:  csJSON,
+		SMARTHTTPResponse:         404,
+		ResponseTime:              0.1234,
+		RequestedFhirVersion:      "None",
+		CapabilityStatementFormat: "json",
+	}
+}
+
+func Test_buildReport(t *testing.T) {
+	message := testMessage(t)
+
+	r, err := buildReport(message, []string{"Epic Systems Corporation", "Cerner Corporation"})
+	th.Assert(t, err == nil, err)
+	th.Assert(t, r.HTTPResponse == 200, fmt.Sprintf("expected HTTP response 200, got %d", r.HTTPResponse))
+	th.Assert(t, r.CapabilityFhirVersion == "1.0.2", fmt.Sprintf("expected FHIR version 1.0.2, got %s", r.CapabilityFhirVersion))
+	th.Assert(t, r.Vendor == "Cerner Corporation", fmt.Sprintf("expected vendor Cerner Corporation, got %s", r.Vendor))
+	th.Assert(t, len(r.Rules) > 0, "expected validation rules to be run")
+	th.Assert(t, len(r.IncludedFields) > 0, "expected included fields to be checked")
+	th.Assert(t, r.SMARTResponse == nil, "expected no SMART response")
+
+	// without a vendor list the endpoint is not matched to a vendor
+	r, err = buildReport(message, nil)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, r.Vendor == "", fmt.Sprintf("expected no vendor, got %s", r.Vendor))
+
+	// a failed request still produces a report
+	message = capabilityquerier.Message{
+		URL:                  "http://example.com/DTSU2/",
+		Err:                  "server could not be reached from URL: http://example.com/DTSU2/metadata",
+		ErrorCode:            "timeout",
+		RequestedFhirVersion: "None",
+	}
+	r, err = buildReport(message, nil)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, r.ErrorCode == "timeout", fmt.Sprintf("expected error code timeout, got %s", r.ErrorCode))
+	th.Assert(t, r.CapabilityFhirVersion == "", fmt.Sprintf("expected no FHIR version, got %s", r.CapabilityFhirVersion))
+}
+
+func Test_printReport(t *testing.T) {
+	r, err := buildReport(testMessage(t), []string{"Cerner Corporation"})
+	th.Assert(t, err == nil, err)
+
+	var out bytes.Buffer
+	printReport(&out, r)
+	report := out.String()
+
+	th.Assert(t, strings.Contains(report, "URL:                  http://example.com/DTSU2/"), fmt.Sprintf("expected URL in report, got %s", report))
+	th.Assert(t, strings.Contains(report, "Vendor:               Cerner Corporation"), fmt.Sprintf("expected vendor in report, got %s", report))
+	th.Assert(t, strings.Contains(report, "PASS capStatExist"), fmt.Sprintf("expected passing capability statement rule in report, got %s", report))
+	th.Assert(t, !strings.Contains(report, "Requested version"), fmt.Sprintf("expected no requested version in report, got %s", report))
+}
@@ -4,9 +4,11 @@ go 1.16
 
 require (
 	github.com/lib/pq v1.3.0
+	github.com/onc-healthit/lantern-back-end/capabilityquerier v0.0.0-20260416181110-f059836a2ec1
 	github.com/onc-healthit/lantern-back-end/endpointmanager v0.0.0-20260416181110-f059836a2ec1
 	github.com/onc-healthit/lantern-back-end/lanternmq v0.0.0-20260416181110-f059836a2ec1
 	github.com/pkg/errors v0.9.1
 	github.com/sirupsen/logrus v1.8.1
 	github.com/spf13/viper v1.10.1
+	golang.org/x/net v0.0.0-20211206223403-eba003a116a9
 )
@@ -0,0 +1,32 @@
+package capabilityhandler
+
+import (
+	"context"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager/postgresql"
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/smartparser"
+	"github.com/pkg/errors"
+)
+
+// saveEndpointAudience classifies the audience of the endpoint using the list sources it was found on and the
+// SMART configuration and supported profiles that were just saved for it, and saves the classification
+func saveEndpointAudience(ctx context.Context, store *postgresql.Store, endpt *endpointmanager.FHIREndpointInfo) error {
+	listSourceCategories, err := store.GetListSourceCategoriesUsingURL(ctx, endpt.URL)
+	if err != nil {
+		return errors.Wrap(err, "error getting list source categories from DB")
+	}
+
+	// A SMART configuration with fields of the wrong type is classified as if it was not served
+	var smartConfig *smartparser.SMARTConfiguration
+	if endpt.SMARTResponse != nil {
+		smartConfig, _ = endpt.SMARTResponse.GetConfiguration()
+	}
+
+	classification := endpointmanager.ClassifyAudience(listSourceCategories, smartConfig, endpt.SupportedProfiles)
+	err = store.UpsertEndpointAudience(ctx, endpt.URL, endpt.RequestedFhirVersion, classification)
+	if err != nil {
+		return errors.Wrap(err, "error saving endpoint audience")
+	}
+	return nil
+}
@@ -3,9 +3,8 @@ package capabilityhandler
 import (
 	"context"
 	"database/sql"
-	"encoding/base64"
-	"encoding/json"
 	"fmt"
+	"net/http"
 
 	"github.com/lib/pq"
 	"github.com/onc-healthit/lantern-back-end/lanternmq/pkg/accessqueue"
@@ -14,6 +13,7 @@ import (
 	"github.com/onc-healthit/lantern-back-end/capabilityreceiver/pkg/capabilityhandler/validation"
 	"github.com/onc-healthit/lantern-back-end/capabilityreceiver/pkg/chplmapper"
 	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager/postgresql"
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/queuemessage"
 	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/versionsoperatorparser"
 
 	"github.com/onc-healthit/lantern-back-end/lanternmq"
@@ -43,164 +43,219 @@ type capStatQueryArgs struct {
 	chplEndpointListInfoFile string
 }
 
-func formatMessage(message []byte) (*endpointmanager.FHIREndpointInfo, *endpointmanager.Validation, error) {
-	var msgJSON map[string]interface{}
+// ProcessMessage parses a message sent by the capability querier into the endpoint info and validation results
+// that would be saved for it, without using the database.
+func ProcessMessage(message []byte) (*endpointmanager.FHIREndpointInfo, *endpointmanager.Validation, error) {
+	return formatMessage(message)
+}
 
-	err := json.Unmarshal(message, &msgJSON)
-	if err != nil {
+// formatMessage parses a capability response message into the endpoint info and validation results that are
+// saved for it. Nothing is returned for a run finished message. A 304 response has no capability statement, so only
+// the rules run on the endpoint's metadata are returned for it.
+func formatMessage(message []byte) (*endpointmanager.FHIREndpointInfo, *endpointmanager.Validation, error) {
+	fhirEndpoint, defaultFhirVersion, err := parseMessage(message)
+	if err != nil || fhirEndpoint == nil {
 		return nil, nil, err
 	}
 
-	url, ok := msgJSON["url"].(string)
-	if !ok {
-		return nil, nil, fmt.Errorf("unable to cast message URL to string")
-	}
-
-	errs, ok := msgJSON["err"].(string)
-	if !ok {
-		return nil, nil, fmt.Errorf("%s: unable to cast message Error to string", url)
-	}
-
-	tlsVersion, ok := msgJSON["tlsVersion"].(string)
-	if !ok {
-		return nil, nil, fmt.Errorf("%s: unable to cast TLS Version to string", url)
-	}
-
-	requestedFhirVersion, ok := msgJSON["requestedFhirVersion"].(string)
-	if !ok {
-		return nil, nil, fmt.Errorf("%s: unable to cast Requested Fhir Version to string", url)
-	}
-
-	defaultFhirVersion, ok := msgJSON["defaultFhirVersion"].(string)
-	if !ok {
-		return nil, nil, fmt.Errorf("%s: unable to cast Default Fhir Version to string", url)
+	var validationObj endpointmanager.Validation
+	if fhirEndpoint.Metadata.NotModified {
+		validationObj = validateMetadata(fhirEndpoint)
+	} else {
+		validationObj = validateEndpoint(fhirEndpoint, defaultFhirVersion)
 	}
+	return fhirEndpoint, &validationObj, nil
+}
 
-	var mimeTypes []string
-	if msgJSON["mimeTypes"] != nil {
-		mimeTypesInt, ok := msgJSON["mimeTypes"].([]interface{})
-		if !ok {
-			return nil, nil, fmt.Errorf("%s: unable to cast MIME Types to []interface{}", url)
-		}
-		for _, mimeTypeInt := range mimeTypesInt {
-			mimeType, ok := mimeTypeInt.(string)
-			if !ok {
-				return nil, nil, fmt.Errorf("unable to cast mime type to string")
-			}
-			mimeTypes = append(mimeTypes, mimeType)
-		}
+// parseMessage parses a capability response message into the endpoint info that is saved for it, and returns it
+// along with the FHIR version that the endpoint's $versions operation gave as its default, which the endpoint is
+// validated against. nil is returned for a run finished message.
+func parseMessage(message []byte) (*endpointmanager.FHIREndpointInfo, string, error) {
+	env, err := queuemessage.Decode(message, queuemessage.TypeCapabilityResponse)
+	if err != nil {
+		return nil, "", err
 	}
-
-	// JSON numbers are golang float64s
-	httpResponseFloat, ok := msgJSON["httpResponse"].(float64)
-	if !ok {
-		return nil, nil, fmt.Errorf("unable to cast http response to int")
+	if env.Type == queuemessage.TypeRunFinished {
+		return nil, "", nil
 	}
-	httpResponse := int(httpResponseFloat)
 
-	smarthttpResponseFloat, ok := msgJSON["smarthttpResponse"].(float64)
-	if !ok {
-		return nil, nil, fmt.Errorf("unable to cast smart http response to int")
+	// Fields that messages from older queriers do not include are left empty
+	var msg queuemessage.CapabilityResponse
+	err = env.DecodePayload(&msg)
+	if err != nil {
+		return nil, "", err
 	}
-	smarthttpResponse := int(smarthttpResponseFloat)
+	url := msg.URL
 
 	var capStat capabilityparser.CapabilityStatement
 	var capInt map[string]interface{}
-	if msgJSON["capabilityStatement"] != nil {
-		capInt, ok = msgJSON["capabilityStatement"].(map[string]interface{})
-
+	if msg.CapabilityStatement != nil {
+		var ok bool
+		capInt, ok = msg.CapabilityStatement.(map[string]interface{})
 		if !ok {
-			return nil, nil, fmt.Errorf("%s: unable to cast capability statement to map[string]interface{}", url)
+			return nil, "", fmt.Errorf("%s: unable to cast capability statement to map[string]interface{}", url)
 		}
 
 		capStat, err = capabilityparser.NewCapabilityStatementFromInterface(capInt)
 		if err != nil {
-			return nil, nil, errors.Wrap(err, fmt.Sprintf("%s: unable to parse CapabilityStatement out of message", url))
+			return nil, "", errors.Wrap(err, fmt.Sprintf("%s: unable to parse CapabilityStatement out of message", url))
 		}
 	}
 
-	var capStatBytes []byte
-	if msgJSON["capabilityStatementBytes"] != nil {
-		capStatStringBytes, ok := msgJSON["capabilityStatementBytes"].(string)
-		if !ok {
-			return nil, nil, fmt.Errorf("unable to cast capStatBytes to string")
-		}
-
-		rawDecodedCapStat, err := base64.StdEncoding.DecodeString(capStatStringBytes)
-		if err != nil {
-			return nil, nil, fmt.Errorf("unable to cast capStatBytes to decoded string")
-		}
-
-		capStatBytes = []byte(rawDecodedCapStat)
-	}
-
-	var smartResponseBytes []byte
-	if msgJSON["smartRespBytes"] != nil {
-		smartRespStringBytes, ok := msgJSON["smartRespBytes"].(string)
-		if !ok {
-			return nil, nil, fmt.Errorf("unable to cast smartRespBytes to string")
-		}
-
-		rawDecodedSmartResp, err := base64.StdEncoding.DecodeString(smartRespStringBytes)
-		if err != nil {
-			return nil, nil, fmt.Errorf("unable to cast smartRespBytes to decoded string")
-		}
-
-		smartResponseBytes = []byte(rawDecodedSmartResp)
-	}
-
 	var smartResponse smartparser.SMARTResponse
-	if msgJSON["smartResp"] != nil {
-		smartInt, ok := msgJSON["smartResp"].(map[string]interface{})
+	if msg.SMARTResp != nil {
+		smartInt, ok := msg.SMARTResp.(map[string]interface{})
 		if !ok {
-			return nil, nil, fmt.Errorf("%s: unable to cast smart response body to map[string]interface{}", url)
+			return nil, "", fmt.Errorf("%s: unable to cast smart response body to map[string]interface{}", url)
 		}
 		smartResponse = smartparser.NewSMARTRespFromInterface(smartInt)
 	}
 
-	responseTime, ok := msgJSON["responseTime"].(float64)
-	if !ok {
-		return nil, nil, fmt.Errorf("response time is not a float")
-	}
-
 	fhirVersion := ""
 	if capStat != nil {
 		fhirVersion, _ = capStat.GetFHIRVersion()
 	}
 
-	validator := validation.ValidatorForFHIRVersion(fhirVersion)
+	var bulkData *endpointmanager.BulkDataSupport
+	if capStat != nil || msg.BulkDataKickoff != nil {
+		bulkData = &endpointmanager.BulkDataSupport{
+			Kickoff: msg.BulkDataKickoff,
+		}
+		// A capability statement that is not structured as expected is recorded as not listing the export operation
+		if capStat != nil {
+			bulkData.ExportLevels, _ = capStat.GetExportLevels()
+			bulkData.Instantiates, _ = capStat.GetBulkDataInstantiates()
+		}
+	}
 
-	validationObj := validator.RunValidation(capStat, fhirVersion, tlsVersion, smartResponse, requestedFhirVersion, defaultFhirVersion)
 	includedFields := RunIncludedFieldsAndExtensionsChecks(capInt, fhirVersion)
 	operationResource := RunSupportedResourcesChecks(capInt)
 	supportedProfiles := RunSupportedProfilesCheck(capInt, fhirVersion)
 
+	// A 304 response is recorded as a 200 response that was not modified, since the endpoint's saved capability
+	// statement is still its current one
+	httpResponse := msg.HTTPResponse
+	notModified := httpResponse == http.StatusNotModified
+	if notModified {
+		httpResponse = http.StatusOK
+	}
+
 	FHIREndpointMetadata := &endpointmanager.FHIREndpointMetadata{
 		URL:                  url,
 		HTTPResponse:         httpResponse,
-		Errors:               errs,
-		SMARTHTTPResponse:    smarthttpResponse,
-		ResponseTime:         responseTime,
-		RequestedFhirVersion: requestedFhirVersion,
+		NotModified:          notModified,
+		Errors:               msg.Err,
+		ErrorCode:            msg.ErrorCode,
+		SMARTHTTPResponse:    msg.SMARTHTTPResponse,
+		ResponseTime:         msg.ResponseTime,
+		RequestedFhirVersion: msg.RequestedFhirVersion,
+		DNSLookupTime:        msg.ResponseTimings.DNSLookup,
+		TCPConnectTime:       msg.ResponseTimings.TCPConnect,
+		TLSHandshakeTime:     msg.ResponseTimings.TLSHandshake,
+		TimeToFirstByte:      msg.ResponseTimings.TimeToFirstByte,
+		BodyTransferTime:     msg.ResponseTimings.BodyTransfer,
+		SchedulerWaitTime:    msg.ResponseTimings.SchedulerWait,
+		TLSInfo:              msg.TLSInfo,
+		ResponseHeaders:      msg.ResponseHeaders,
+		RedirectChain:        msg.RedirectChain,
+		ErrorResponse:        msg.ErrorResponse,
+		JWKSInfo:             msg.JWKSInfo,
+		AuthServerMetadata:   msg.AuthServerMetadata,
+		UDAPInfo:             msg.UDAPInfo,
+		CDSHooksInfo:         msg.CDSHooksInfo,
+		DataExposureChecks:   msg.DataExposureChecks,
+		DNSInfo:              msg.DNSInfo,
 	}
 
 	fhirEndpoint := endpointmanager.FHIREndpointInfo{
-		URL:                      url,
-		TLSVersion:               tlsVersion,
-		MIMETypes:                mimeTypes,
-		CapabilityStatement:      capStat,
-		SMARTResponse:            smartResponse,
-		IncludedFields:           includedFields,
-		OperationResource:        operationResource,
-		Metadata:                 FHIREndpointMetadata,
-		RequestedFhirVersion:     requestedFhirVersion,
-		CapabilityFhirVersion:    fhirVersion,
-		SupportedProfiles:        supportedProfiles,
-		CapabilityStatementBytes: capStatBytes,
-		SMARTResponseBytes:       smartResponseBytes,
-	}
-
-	return &fhirEndpoint, &validationObj, nil
+		URL:                       url,
+		TLSVersion:                msg.TLSVersion,
+		MIMETypes:                 msg.MIMETypes,
+		CapabilityStatement:       capStat,
+		SMARTResponse:             smartResponse,
+		IncludedFields:            includedFields,
+		OperationResource:         operationResource,
+		Metadata:                  FHIREndpointMetadata,
+		RequestedFhirVersion:      msg.RequestedFhirVersion,
+		CapabilityFhirVersion:     fhirVersion,
+		SupportedProfiles:         supportedProfiles,
+		CapabilityStatementBytes:  msg.CapabilityStatementBytes,
+		SMARTResponseBytes:        msg.SMARTRespBytes,
+		CapabilityStatementFormat: msg.CapabilityStatementFormat,
+		BulkData:                  bulkData,
+	}
+
+	return &fhirEndpoint, msg.DefaultFhirVersion, nil
+}
+
+// validateEndpoint runs the validation rules on the endpoint's capability statement followed by the rules run on its
+// metadata
+func validateEndpoint(fhirEndpoint *endpointmanager.FHIREndpointInfo, defaultFhirVersion string) endpointmanager.Validation {
+	validator := validation.ValidatorForFHIRVersion(fhirEndpoint.CapabilityFhirVersion)
+	validationObj := validator.RunValidation(fhirEndpoint.CapabilityStatement, fhirEndpoint.CapabilityFhirVersion, fhirEndpoint.TLSVersion,
+		fhirEndpoint.SMARTResponse, fhirEndpoint.RequestedFhirVersion, defaultFhirVersion)
+	validationObj.Results = append(validationObj.Results, validateMetadata(fhirEndpoint).Results...)
+	return validationObj
+}
+
+// validateMetadata runs the validation rules on the endpoint's metadata: its certificate, response headers,
+// redirects, SMART configuration, key set, authorization server, UDAP metadata, data exposure searches and
+// error response
+func validateMetadata(fhirEndpoint *endpointmanager.FHIREndpointInfo) endpointmanager.Validation {
+	validator := validation.ValidatorForFHIRVersion(fhirEndpoint.CapabilityFhirVersion)
+	metadata := fhirEndpoint.Metadata
+	validationObj := endpointmanager.Validation{Results: []endpointmanager.Rule{}}
+
+	if metadata.TLSInfo != nil {
+		validationObj.Results = append(validationObj.Results, validator.RunTLSValidation(metadata.TLSInfo)...)
+	}
+	if metadata.ResponseHeaders != nil {
+		validationObj.Results = append(validationObj.Results, validator.RunHeaderValidation(metadata.ResponseHeaders, fhirEndpoint.TLSVersion, fhirEndpoint.MIMETypes)...)
+	}
+	if metadata.RedirectChain != nil {
+		validationObj.Results = append(validationObj.Results, validator.RunRedirectValidation(metadata.RedirectChain)...)
+	}
+	if fhirEndpoint.SMARTResponse != nil {
+		validationObj.Results = append(validationObj.Results, validator.RunSMARTValidation(fhirEndpoint.SMARTResponse)...)
+	}
+	if metadata.JWKSInfo != nil {
+		validationObj.Results = append(validationObj.Results, validator.RunJWKSValidation(metadata.JWKSInfo)...)
+	}
+	if metadata.AuthServerMetadata != nil {
+		validationObj.Results = append(validationObj.Results, validator.RunAuthServerValidation(metadata.AuthServerMetadata, fhirEndpoint.CapabilityStatement, fhirEndpoint.SMARTResponse)...)
+	}
+	// Most endpoints do not publish UDAP metadata, so it is only validated when it is published
+	if metadata.UDAPInfo != nil && metadata.UDAPInfo.HTTPResponse == http.StatusOK {
+		validationObj.Results = append(validationObj.Results, validator.RunUDAPValidation(metadata.UDAPInfo)...)
+	}
+	if metadata.DataExposureChecks != nil {
+		validationObj.Results = append(validationObj.Results, validator.RunDataExposureValidation(metadata.DataExposureChecks)...)
+	}
+	if metadata.ErrorResponse != nil {
+		validationObj.Results = append(validationObj.Results, validator.RunErrorResponseValidation(metadata.HTTPResponse, metadata.ErrorResponse)...)
+	}
+
+	return validationObj
+}
+
+// keepSavedHeaders copies the headers of the saved metadata that a 304 response did not include, such as the
+// Content-Type and the cache validators, to the metadata of the 304 response. A 304 response only carries some of the
+// headers of the response it stands for, so without them the header rules would fail for the saved capability
+// statement and the next request for the endpoint would not be conditional. The headers of the 304 response replace
+// the saved ones.
+func keepSavedHeaders(metadata *endpointmanager.FHIREndpointMetadata, savedMetadata *endpointmanager.FHIREndpointMetadata) {
+	if savedMetadata == nil || savedMetadata.ResponseHeaders == nil {
+		return
+	}
+	for name, value := range savedMetadata.ResponseHeaders {
+		if _, ok := metadata.ResponseHeaders[name]; ok {
+			continue
+		}
+		if metadata.ResponseHeaders == nil {
+			metadata.ResponseHeaders = make(map[string]string)
+		}
+		metadata.ResponseHeaders[name] = value
+	}
 }
 
 // saveMsgInDB formats the message data for the database and either adds a new entry to the database or
@@ -209,7 +264,6 @@ func saveMsgInDB(message []byte, args *map[string]interface{}) error {
 	var err error
 	var fhirEndpoint *endpointmanager.FHIREndpointInfo
 	var existingEndpt *endpointmanager.FHIREndpointInfo
-	var validation *endpointmanager.Validation
 
 	// Get arguments
 	qa, ok := (*args)["queryArgs"].(capStatQueryArgs)
@@ -217,10 +271,15 @@ func saveMsgInDB(message []byte, args *map[string]interface{}) error {
 		return fmt.Errorf("unable to parse args into capStatQueryArgs")
 	}
 
-	fhirEndpoint, validation, err = formatMessage(message)
+	fhirEndpoint, defaultFhirVersion, err := parseMessage(message)
 	if err != nil {
 		return err
 	}
+	// The querier does not pass on the end of a run, so there is nothing to save for it
+	if fhirEndpoint == nil {
+		return nil
+	}
+	validation := validateEndpoint(fhirEndpoint, defaultFhirVersion)
 
 	// This is a safety check to make sure the RequestedFhirVersion will always be populated
 	if fhirEndpoint.RequestedFhirVersion == "" {
@@ -255,7 +314,7 @@ func saveMsgInDB(message []byte, args *map[string]interface{}) error {
 		}
 		fhirEndpoint.ValidationID = valResID
 
-		err = store.AddValidation(ctx, validation, valResID)
+		err = store.AddValidation(ctx, &validation, valResID)
 		if err != nil {
 			return fmt.Errorf("error adding validation rows to table, %s", err)
 		}
@@ -279,6 +338,11 @@ func saveMsgInDB(message []byte, args *map[string]interface{}) error {
 			return err
 		}
 
+		err = saveEndpointAudience(ctx, store, fhirEndpoint)
+		if err != nil {
+			return err
+		}
+
 	} else if err != nil {
 		// CASE 2: A different DB error occurred
 		log.Errorf("[saveMsgInDB] CASE 2: DB error looking up endpoint url=%s err=%s", fhirEndpoint.URL, err)
@@ -290,13 +354,38 @@ func saveMsgInDB(message []byte, args *map[string]interface{}) error {
 		fhirEndpoint.VendorID = existingEndpt.VendorID
 		fhirEndpoint.HealthITProductID = existingEndpt.HealthITProductID
 
+		// A 304 response means the endpoint's capability statement is unchanged, so the saved capability
+		// statement and the headers of the response that returned it are kept
+		notModified := fhirEndpoint.Metadata.NotModified
+		if notModified {
+			keepSavedHeaders(fhirEndpoint.Metadata, existingEndpt.Metadata)
+		}
+
 		// Sync metadata
 		existingEndpt.Metadata.URL = fhirEndpoint.Metadata.URL
 		existingEndpt.Metadata.HTTPResponse = fhirEndpoint.Metadata.HTTPResponse
+		existingEndpt.Metadata.NotModified = fhirEndpoint.Metadata.NotModified
 		existingEndpt.Metadata.Errors = fhirEndpoint.Metadata.Errors
+		existingEndpt.Metadata.ErrorCode = fhirEndpoint.Metadata.ErrorCode
 		existingEndpt.Metadata.ResponseTime = fhirEndpoint.Metadata.ResponseTime
 		existingEndpt.Metadata.SMARTHTTPResponse = fhirEndpoint.Metadata.SMARTHTTPResponse
 		existingEndpt.Metadata.RequestedFhirVersion = fhirEndpoint.Metadata.RequestedFhirVersion
+		existingEndpt.Metadata.DNSLookupTime = fhirEndpoint.Metadata.DNSLookupTime
+		existingEndpt.Metadata.TCPConnectTime = fhirEndpoint.Metadata.TCPConnectTime
+		existingEndpt.Metadata.TLSHandshakeTime = fhirEndpoint.Metadata.TLSHandshakeTime
+		existingEndpt.Metadata.TimeToFirstByte = fhirEndpoint.Metadata.TimeToFirstByte
+		existingEndpt.Metadata.BodyTransferTime = fhirEndpoint.Metadata.BodyTransferTime
+		existingEndpt.Metadata.SchedulerWaitTime = fhirEndpoint.Metadata.SchedulerWaitTime
+		existingEndpt.Metadata.TLSInfo = fhirEndpoint.Metadata.TLSInfo
+		existingEndpt.Metadata.ResponseHeaders = fhirEndpoint.Metadata.ResponseHeaders
+		existingEndpt.Metadata.RedirectChain = fhirEndpoint.Metadata.RedirectChain
+		existingEndpt.Metadata.ErrorResponse = fhirEndpoint.Metadata.ErrorResponse
+		existingEndpt.Metadata.JWKSInfo = fhirEndpoint.Metadata.JWKSInfo
+		existingEndpt.Metadata.AuthServerMetadata = fhirEndpoint.Metadata.AuthServerMetadata
+		existingEndpt.Metadata.UDAPInfo = fhirEndpoint.Metadata.UDAPInfo
+		existingEndpt.Metadata.CDSHooksInfo = fhirEndpoint.Metadata.CDSHooksInfo
+		existingEndpt.Metadata.DataExposureChecks = fhirEndpoint.Metadata.DataExposureChecks
+		existingEndpt.Metadata.DNSInfo = fhirEndpoint.Metadata.DNSInfo
 
 		// Set fhirEndpoint.ValidationID to existingEndpt value because they should have the same ValidationID
 		// until there's a reason to update it
@@ -304,9 +393,26 @@ func saveMsgInDB(message []byte, args *map[string]interface{}) error {
 
 		// Check whether capability fields changed. Vendor/product IDs are carried forward above so
 		// they do not affect this check; they are re-resolved by updateOrInsertEndpointRows below.
-		capabilityChanged := !existingEndpt.EqualExcludeMetadata(fhirEndpoint)
+		capabilityChanged := !notModified && !existingEndpt.EqualExcludeMetadata(fhirEndpoint)
 
-		if capabilityChanged {
+		if notModified {
+			// The SMART response and TLS version are not part of the conditional request, so they are still updated
+			existingEndpt.TLSVersion = fhirEndpoint.TLSVersion
+			existingEndpt.SMARTResponse = fhirEndpoint.SMARTResponse
+			existingEndpt.SMARTResponseBytes = fhirEndpoint.SMARTResponseBytes
+			// The export levels come from the saved capability statement, but the kickoff request is sent again
+			if fhirEndpoint.BulkData != nil && fhirEndpoint.BulkData.Kickoff != nil {
+				if existingEndpt.BulkData == nil {
+					existingEndpt.BulkData = &endpointmanager.BulkDataSupport{}
+				} else {
+					bulkData := *existingEndpt.BulkData
+					existingEndpt.BulkData = &bulkData
+				}
+				existingEndpt.BulkData.Kickoff = fhirEndpoint.BulkData.Kickoff
+			}
+			// The saved capability statement is validated along with the metadata of the 304 response
+			validation = validateEndpoint(existingEndpt, defaultFhirVersion)
+		} else if capabilityChanged {
 			// Copy capability fields into existingEndpt for use by updateOrInsertEndpointRows.
 			existingEndpt.CapabilityStatement = fhirEndpoint.CapabilityStatement
 			existingEndpt.CapabilityStatementBytes = fhirEndpoint.CapabilityStatementBytes
@@ -318,14 +424,29 @@ func saveMsgInDB(message []byte, args *map[string]interface{}) error {
 			existingEndpt.OperationResource = fhirEndpoint.OperationResource
 			existingEndpt.SupportedProfiles = fhirEndpoint.SupportedProfiles
 			existingEndpt.CapabilityFhirVersion = fhirEndpoint.CapabilityFhirVersion
+			existingEndpt.CapabilityStatementFormat = fhirEndpoint.CapabilityStatementFormat
+			existingEndpt.BulkData = fhirEndpoint.BulkData
+		}
 
-			valResID, err := store.AddValidationResult(ctx)
+		// Most of the rules are run on the endpoint's metadata, such as its certificate, SMART configuration and
+		// responses to the data exposure searches, which can change without the capability statement changing.
+		// A new validation is saved whenever any rule's result differs from the saved validation.
+		savedValidation, err := store.GetFHIREndpointInfoValidation(ctx, existingEndpt)
+		if err != nil {
+			return fmt.Errorf("getting saved validation failed, %s", err)
+		}
+		validationChanged := !validation.Equal(savedValidation)
+
+		// 0 keeps the validation of each of the endpoint's rows
+		newValidationID := 0
+		if capabilityChanged || validationChanged {
+			newValidationID, err = store.AddValidationResult(ctx)
 			if err != nil {
 				return fmt.Errorf("adding new validation result ID failed, %s", err)
 			}
-			existingEndpt.ValidationID = valResID
+			existingEndpt.ValidationID = newValidationID
 
-			err = store.AddValidation(ctx, validation, valResID)
+			err = store.AddValidation(ctx, &validation, newValidationID)
 			if err != nil {
 				return fmt.Errorf("error adding validation rows to table, %s", err)
 			}
@@ -353,10 +474,16 @@ func saveMsgInDB(message []byte, args *map[string]interface{}) error {
 			softwareListMap,
 			fmt.Sprintf("%v", qa.chplMatchFile),
 			metadataID,
+			newValidationID,
 		)
 		if err != nil {
 			return err
 		}
+
+		err = saveEndpointAudience(ctx, store, existingEndpt)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -475,6 +602,8 @@ func insertEndpointRows(
 	return nil
 }
 
+// updateOrInsertEndpointRows updates the endpoint's row for each of its vendors, adding the rows that do not exist
+// yet. If validationID is not 0, it is a new validation of the endpoint that replaces the validation of every row.
 func updateOrInsertEndpointRows(
 	ctx context.Context,
 	store *postgresql.Store,
@@ -483,6 +612,7 @@ func updateOrInsertEndpointRows(
 	softwareListMap map[string]chplmapper.ChplMapResults,
 	matchFile string,
 	metadataID int,
+	validationID int,
 ) error {
 	log.Infof("[updateOrInsertEndpointRows] START url=%s requestedVersion=%s metadataID=%d fhirEndpointList count=%d",
 		baseEndpoint.URL, baseEndpoint.RequestedFhirVersion, metadataID, len(fhirEndpointList))
@@ -535,6 +665,9 @@ func updateOrInsertEndpointRows(
 			if existingRow, exists := currentRowByVendorID[vm.VendorID]; exists {
 				epRow.ID = existingRow.ID
 				epRow.ValidationID = existingRow.ValidationID
+				if validationID != 0 {
+					epRow.ValidationID = validationID
+				}
 				if existingRow.EqualExcludeMetadata(&epRow) {
 					err = store.UpdateMetadataIDInfo(ctx, metadataID, existingRow.ID)
 					if err != nil {
@@ -604,6 +737,9 @@ func updateOrInsertEndpointRows(
 			if existingRow, exists := currentRowByVendorID[vm.VendorID]; exists {
 				epRow.ID = existingRow.ID
 				epRow.ValidationID = existingRow.ValidationID
+				if validationID != 0 {
+					epRow.ValidationID = validationID
+				}
 
 				if existingRow.EqualExcludeMetadata(&epRow) {
 					err = store.UpdateMetadataIDInfo(ctx, metadataID, existingRow.ID)
@@ -667,6 +803,10 @@ func removeNoLongerExistingVersionsInfos(ctx context.Context, store *postgresql.
 		if err != nil {
 			return err
 		}
+		err = store.DeleteEndpointAudience(ctx, infoEntry.URL, infoEntry.RequestedFhirVersion)
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -674,32 +814,48 @@ func removeNoLongerExistingVersionsInfos(ctx context.Context, store *postgresql.
 func saveVersionResponseMsgInDB(message []byte, args *map[string]interface{}) error {
 	var err error
 	var existingEndpts []*endpointmanager.FHIREndpoint
-	var msgJSON map[string]interface{}
 	// Get arguments
 	qa, ok := (*args)["queryArgs"].(versionsQueryArgs)
 	if !ok {
 		return fmt.Errorf("unable to parse args into versionsQueryArgs")
 	}
 
-	err = json.Unmarshal(message, &msgJSON)
+	env, err := queuemessage.Decode(message, queuemessage.TypeVersionsResponse)
 	if err != nil {
 		return err
 	}
 
-	url, ok := msgJSON["url"].(string)
-	if !ok {
-		return fmt.Errorf("unable to cast message URL to string")
-	}
-
 	store := qa.store
 	ctx := qa.ctx
 
+	// Set up the queue for sending messages to capabilityquerier
+	mq := qa.capQueryQueue
+	channelID := qa.capQueryChannelID
+	capQueryEndptQName := viper.GetString("endptinfo_capquery_qname")
+
+	// The end of the run is passed on to the capability querier
+	if env.Type == queuemessage.TypeRunFinished {
+		var msgBytes []byte
+		msgBytes, err = queuemessage.EncodeRunFinished(queuemessage.ProducerCapabilityReceiver, env.RunID)
+		if err != nil {
+			return err
+		}
+		return accessqueue.SendToQueue(ctx, string(msgBytes), &mq, &channelID, capQueryEndptQName)
+	}
+
+	var versionsMsg queuemessage.VersionsResponse
+	err = env.DecodePayload(&versionsMsg)
+	if err != nil {
+		return err
+	}
+	url := versionsMsg.URL
+
 	existingEndpts, err = store.GetFHIREndpointUsingURL(ctx, url)
 	if err != nil {
 		return err
 	}
 
-	resp, _ := msgJSON["versionsResponse"].(map[string]interface{})
+	resp, _ := versionsMsg.VersionsResponse.(map[string]interface{})
 	var vsr versionsoperatorparser.VersionsResponse
 	vsr.Response = resp
 	for _, endpt := range existingEndpts {
@@ -714,10 +870,6 @@ func saveVersionResponseMsgInDB(message []byte, args *map[string]interface{}) er
 	}
 
 	// Dispatch query for CapabilityStatement here
-	// Set up the queue for sending messages to capabilityquerier
-	mq := qa.capQueryQueue
-	channelID := qa.capQueryChannelID
-	capQueryEndptQName := viper.GetString("endptinfo_capquery_qname")
 	var supportedVersions []string
 	supportedVersions = vsr.GetSupportedVersions()
 
@@ -732,12 +884,13 @@ func saveVersionResponseMsgInDB(message []byte, args *map[string]interface{}) er
 
 	for _, version := range supportedVersions {
 		// send URL and version of FHIR version to request
-		var message map[string]string = make(map[string]string)
-		message["url"] = url
-		message["requestVersion"] = version
-		message["defaultVersion"] = defaultVersion
+		query := queuemessage.CapabilityQuery{
+			URL:            url,
+			RequestVersion: version,
+			DefaultVersion: defaultVersion,
+		}
 		var msgBytes []byte
-		msgBytes, err = json.Marshal(message)
+		msgBytes, err = queuemessage.Encode(queuemessage.TypeCapabilityQuery, queuemessage.ProducerCapabilityReceiver, env.RunID, query)
 		if err != nil {
 			return err
 		}
@@ -356,6 +356,11 @@ func Test_saveMsgInDB(t *testing.T) {
 	th.Assert(t, err == nil, err)
 	th.Assert(t, validationCount == 7, fmt.Sprintf("Should be 7 validation entries for ID %d, is instead %d", valID1, validationCount))
 
+	// check that the endpoint's audience was classified
+	audience, err := store.GetEndpointAudience(ctx, testFhirEndpoint1.URL, "None")
+	th.Assert(t, err == nil, err)
+	th.Assert(t, audience.Audience != "", "the endpoint's audience should have been saved")
+
 	// check that a second new item is stored
 	queueTmp["url"] = "https://test-two.com"
 	expectedEndpt.URL = testFhirEndpoint2.URL
@@ -531,6 +536,123 @@ func Test_saveMsgInDB(t *testing.T) {
 
 	queueTmp["responseTime"] = 0.1234
 
+	// check that a change to only the data exposure searches saves a new validation
+
+	storedEndpt, err = store.GetFHIREndpointInfoUsingURLAndRequestedVersion(ctx, testFhirEndpoint1.URL, "None")
+	th.Assert(t, err == nil, err)
+	oldValidationID = storedEndpt.ValidationID
+
+	queueTmp["dataExposureChecks"] = []map[string]interface{}{{"search": "Patient?_count=1", "httpResponse": 200, "resourceType": "Bundle", "total": 1, "entryCount": 1}}
+	queueMsg, err = convertInterfaceToBytes(queueTmp)
+	th.Assert(t, err == nil, err)
+	err = saveMsgInDB(queueMsg, &args)
+	th.Assert(t, err == nil, err)
+
+	storedEndpt, err = store.GetFHIREndpointInfoUsingURLAndRequestedVersion(ctx, testFhirEndpoint1.URL, "None")
+	th.Assert(t, err == nil, err)
+	th.Assert(t, storedEndpt.ValidationID != oldValidationID, "The validation id should have been updated when only the data exposure searches changed")
+	storedValidation, err := store.GetFHIREndpointInfoValidation(ctx, storedEndpt)
+	th.Assert(t, err == nil, err)
+	dataExposureRuleFound := false
+	for _, rule := range storedValidation.Results {
+		if rule.RuleName == endpointmanager.DataExposureRule {
+			dataExposureRuleFound = true
+			th.Assert(t, !rule.Valid, "The data exposure rule should have failed for a search that returned patient data")
+		}
+	}
+	th.Assert(t, dataExposureRuleFound, "The data exposure rule should have been saved")
+
+	// the same searches again keep the validation
+	oldValidationID = storedEndpt.ValidationID
+	err = saveMsgInDB(queueMsg, &args)
+	th.Assert(t, err == nil, err)
+	storedEndpt, err = store.GetFHIREndpointInfoUsingURLAndRequestedVersion(ctx, testFhirEndpoint1.URL, "None")
+	th.Assert(t, err == nil, err)
+	th.Assert(t, storedEndpt.ValidationID == oldValidationID, "The validation id should not have been updated when the rules did not change")
+	delete(queueTmp, "dataExposureChecks")
+
+	// check that a 304 response keeps the saved capability statement, its validation and the saved response headers
+
+	queueTmp["responseHeaders"] = map[string]interface{}{"ETag": "\"v1\"", "Content-Type": "application/json+fhir", "Access-Control-Allow-Origin": "*"}
+	queueMsg, err = convertInterfaceToBytes(queueTmp)
+	th.Assert(t, err == nil, err)
+	err = saveMsgInDB(queueMsg, &args)
+	th.Assert(t, err == nil, err)
+
+	storedEndpt, err = store.GetFHIREndpointInfoUsingURLAndRequestedVersion(ctx, testFhirEndpoint1.URL, "None")
+	th.Assert(t, err == nil, err)
+	oldMetadataID = storedEndpt.Metadata.ID
+	oldValidationID = storedEndpt.ValidationID
+	err = store.DB.QueryRow(query_str, testFhirEndpoint1.URL).Scan(&http_200_ct, &http_all_ct)
+	th.Assert(t, err == nil, err)
+	old200Count := http_200_ct
+
+	capStat := queueTmp["capabilityStatement"]
+	capStatBytes := queueTmp["capabilityStatementBytes"]
+	queueTmp["httpResponse"] = 304
+	queueTmp["capabilityStatement"] = nil
+	queueTmp["capabilityStatementBytes"] = nil
+	queueTmp["responseHeaders"] = map[string]interface{}{"Server": "test"}
+	queueMsg, err = convertInterfaceToBytes(queueTmp)
+	th.Assert(t, err == nil, err)
+	err = saveMsgInDB(queueMsg, &args)
+	th.Assert(t, err == nil, err)
+
+	storedEndpt, err = store.GetFHIREndpointInfoUsingURLAndRequestedVersion(ctx, testFhirEndpoint1.URL, "None")
+	th.Assert(t, err == nil, err)
+	th.Assert(t, storedEndpt.CapabilityStatement != nil, "The capability statement should have been kept for a 304 response")
+	th.Assert(t, storedEndpt.ValidationID == oldValidationID, "The validation id should not have been updated for a 304 response whose rules did not change")
+	th.Assert(t, storedEndpt.Metadata.ID != oldMetadataID, "The metadata should have been added for a 304 response")
+	th.Assert(t, storedEndpt.Metadata.HTTPResponse == 200, fmt.Sprintf("The http response of a 304 response should have been stored as 200, was %d", storedEndpt.Metadata.HTTPResponse))
+	th.Assert(t, storedEndpt.Metadata.NotModified, "The 304 response should have been stored as not modified")
+	th.Assert(t, storedEndpt.Metadata.ResponseHeaders["ETag"] == "\"v1\"", fmt.Sprintf("The ETag should have been kept for a 304 response, was %s", storedEndpt.Metadata.ResponseHeaders["ETag"]))
+	th.Assert(t, storedEndpt.Metadata.ResponseHeaders["Content-Type"] == "application/json+fhir", fmt.Sprintf("The Content-Type should have been kept for a 304 response, was %s", storedEndpt.Metadata.ResponseHeaders["Content-Type"]))
+	th.Assert(t, storedEndpt.Metadata.ResponseHeaders["Server"] == "test", "The response headers of the 304 response should have been stored")
+
+	err = store.DB.QueryRow(query_str, testFhirEndpoint1.URL).Scan(&http_200_ct, &http_all_ct)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, http_200_ct == old200Count+1, fmt.Sprintf("A 304 response should count towards availability, http 200 count was %d", http_200_ct))
+
+	// a second 304 response in a row also keeps the validation
+	err = saveMsgInDB(queueMsg, &args)
+	th.Assert(t, err == nil, err)
+	storedEndpt, err = store.GetFHIREndpointInfoUsingURLAndRequestedVersion(ctx, testFhirEndpoint1.URL, "None")
+	th.Assert(t, err == nil, err)
+	th.Assert(t, storedEndpt.ValidationID == oldValidationID, "The validation id should not have been updated for a second 304 response whose rules did not change")
+	th.Assert(t, storedEndpt.Metadata.ResponseHeaders["Access-Control-Allow-Origin"] == "*", "The saved response headers should have been kept for a second 304 response")
+
+	// the metadata of a 304 response is validated along with the saved capability statement
+	queueTmp["dataExposureChecks"] = []map[string]interface{}{{"search": "Patient?_count=1", "httpResponse": 200, "resourceType": "Bundle", "total": 1, "entryCount": 1}}
+	queueMsg, err = convertInterfaceToBytes(queueTmp)
+	th.Assert(t, err == nil, err)
+	err = saveMsgInDB(queueMsg, &args)
+	th.Assert(t, err == nil, err)
+	delete(queueTmp, "dataExposureChecks")
+
+	storedEndpt, err = store.GetFHIREndpointInfoUsingURLAndRequestedVersion(ctx, testFhirEndpoint1.URL, "None")
+	th.Assert(t, err == nil, err)
+	th.Assert(t, storedEndpt.ValidationID != oldValidationID, "The validation id should have been updated for a 304 response whose rules changed")
+	storedValidation, err = store.GetFHIREndpointInfoValidation(ctx, storedEndpt)
+	th.Assert(t, err == nil, err)
+	capStatExistFound := false
+	dataExposureRuleFound = false
+	for _, rule := range storedValidation.Results {
+		if rule.RuleName == endpointmanager.CapStatExistRule {
+			capStatExistFound = true
+			th.Assert(t, rule.Valid, "The saved capability statement should have been validated for a 304 response")
+		}
+		if rule.RuleName == endpointmanager.DataExposureRule {
+			dataExposureRuleFound = true
+			th.Assert(t, !rule.Valid, "The data exposure rule should have failed for a search that returned patient data")
+		}
+	}
+	th.Assert(t, capStatExistFound, "The capability statement rules should have been saved for a 304 response")
+	th.Assert(t, dataExposureRuleFound, "The data exposure rule should have been saved for a 304 response")
+
+	queueTmp["httpResponse"] = 200
+	queueTmp["capabilityStatement"] = capStat
+	queueTmp["capabilityStatementBytes"] = capStatBytes
+	delete(queueTmp, "responseHeaders")
 }
 
 func setup() error {
@@ -9,6 +9,7 @@ import (
 
 	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/capabilityparser"
 	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/queuemessage"
 	th "github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/testhelper"
 )
 
@@ -243,6 +244,7 @@ var testFhirEndpointInfo = endpointmanager.FHIREndpointInfo{
 	IncludedFields:        testIncludedFields,
 	OperationResource:     testOperations,
 	ValidationID:          1,
+	BulkData:              &endpointmanager.BulkDataSupport{},
 }
 
 // Convert the test Queue Message into []byte format for testing purposes
@@ -373,6 +375,340 @@ func Test_formatMessage(t *testing.T) {
 	th.Assert(t, returnErr != nil, "Expected an error to be thrown due to an incorrect defaultFhirVersion")
 	tmpMessage["defaultFhirVersion"] = ""
 
+	// test error code
+	tmpMessage["errorCode"] = "connection_refused"
+	message, err = convertInterfaceToBytes(tmpMessage)
+	th.Assert(t, err == nil, err)
+	endpt, _, returnErr = formatMessage(message)
+	th.Assert(t, returnErr == nil, returnErr)
+	th.Assert(t, endpt.Metadata.ErrorCode == endpointmanager.ConnectionRefusedCode, fmt.Sprintf("Expected error code to be connection_refused, got %s", endpt.Metadata.ErrorCode))
+
+	// test incorrect error code
+	tmpMessage["errorCode"] = 1
+	message, err = convertInterfaceToBytes(tmpMessage)
+	th.Assert(t, err == nil, err)
+	_, _, returnErr = formatMessage(message)
+	th.Assert(t, returnErr != nil, "Expected an error to be thrown due to an incorrect errorCode")
+	delete(tmpMessage, "errorCode")
+
+	// test capability statement format
+	tmpMessage["capabilityStatementFormat"] = "xml"
+	message, err = convertInterfaceToBytes(tmpMessage)
+	th.Assert(t, err == nil, err)
+	endpt, _, returnErr = formatMessage(message)
+	th.Assert(t, returnErr == nil, returnErr)
+	th.Assert(t, endpt.CapabilityStatementFormat == "xml", fmt.Sprintf("Expected capability statement format to be xml, got %s", endpt.CapabilityStatementFormat))
+
+	// test response timings
+	tmpMessage["responseTimings"] = map[string]interface{}{"dnsLookup": 0.01, "tcpConnect": 0.02, "tlsHandshake": 0.03, "timeToFirstByte": 0.04, "bodyTransfer": 0.05, "schedulerWait": 1.5}
+	message, err = convertInterfaceToBytes(tmpMessage)
+	th.Assert(t, err == nil, err)
+	endpt, _, returnErr = formatMessage(message)
+	th.Assert(t, returnErr == nil, returnErr)
+	th.Assert(t, endpt.Metadata.DNSLookupTime == 0.01, fmt.Sprintf("Expected DNS lookup time to be 0.01, got %f", endpt.Metadata.DNSLookupTime))
+	th.Assert(t, endpt.Metadata.TLSHandshakeTime == 0.03, fmt.Sprintf("Expected TLS handshake time to be 0.03, got %f", endpt.Metadata.TLSHandshakeTime))
+	th.Assert(t, endpt.Metadata.BodyTransferTime == 0.05, fmt.Sprintf("Expected body transfer time to be 0.05, got %f", endpt.Metadata.BodyTransferTime))
+	th.Assert(t, endpt.Metadata.SchedulerWaitTime == 1.5, fmt.Sprintf("Expected scheduler wait time to be 1.5, got %f", endpt.Metadata.SchedulerWaitTime))
+
+	// test incorrect response timings
+	tmpMessage["responseTimings"] = map[string]interface{}{"dnsLookup": "0.01"}
+	message, err = convertInterfaceToBytes(tmpMessage)
+	th.Assert(t, err == nil, err)
+	_, _, returnErr = formatMessage(message)
+	th.Assert(t, returnErr != nil, "Expected an error to be thrown due to an incorrect response timing")
+	delete(tmpMessage, "responseTimings")
+
+	// test TLS info
+	tmpMessage["tlsInfo"] = map[string]interface{}{"tlsVersion": "TLS 1.2", "keyType": "RSA", "keySize": 1024, "hostnameMatch": true, "leafSANs": []string{"example.com"}}
+	message, err = convertInterfaceToBytes(tmpMessage)
+	th.Assert(t, err == nil, err)
+	endpt, validation, returnErr = formatMessage(message)
+	th.Assert(t, returnErr == nil, returnErr)
+	th.Assert(t, endpt.Metadata.TLSInfo != nil, "Expected TLS info to be set")
+	th.Assert(t, endpt.Metadata.TLSInfo.KeySize == 1024, fmt.Sprintf("Expected key size to be 1024, got %d", endpt.Metadata.TLSInfo.KeySize))
+	foundKeyStrengthRule := false
+	for _, rule := range validation.Results {
+		if rule.RuleName == endpointmanager.CertKeyStrengthRule {
+			foundKeyStrengthRule = true
+			th.Assert(t, !rule.Valid, "Expected the key strength rule to be invalid for a 1024 bit RSA key")
+		}
+	}
+	th.Assert(t, foundKeyStrengthRule, "Expected the certificate rules to be added to the validation results")
+
+	// test incorrect TLS info
+	tmpMessage["tlsInfo"] = map[string]interface{}{"keySize": "1024"}
+	message, err = convertInterfaceToBytes(tmpMessage)
+	th.Assert(t, err == nil, err)
+	_, _, returnErr = formatMessage(message)
+	th.Assert(t, returnErr != nil, "Expected an error to be thrown due to incorrect TLS info")
+	delete(tmpMessage, "tlsInfo")
+
+	// test response headers
+	tmpMessage["responseHeaders"] = map[string]interface{}{"Content-Type": "application/json+fhir; charset=utf-8", "Strict-Transport-Security": "max-age=31536000"}
+	message, err = convertInterfaceToBytes(tmpMessage)
+	th.Assert(t, err == nil, err)
+	endpt, validation, returnErr = formatMessage(message)
+	th.Assert(t, returnErr == nil, returnErr)
+	th.Assert(t, endpt.Metadata.ResponseHeaders["Strict-Transport-Security"] == "max-age=31536000", fmt.Sprintf("Expected the Strict-Transport-Security header to be max-age=31536000, got %s", endpt.Metadata.ResponseHeaders["Strict-Transport-Security"]))
+	foundCORSRule := false
+	for _, rule := range validation.Results {
+		if rule.RuleName == endpointmanager.CORSRule {
+			foundCORSRule = true
+			th.Assert(t, !rule.Valid, "Expected the CORS rule to be invalid without an Access-Control-Allow-Origin header")
+		}
+	}
+	th.Assert(t, foundCORSRule, "Expected the header rules to be added to the validation results")
+
+	// test incorrect response headers
+	tmpMessage["responseHeaders"] = map[string]interface{}{"Content-Type": 1}
+	message, err = convertInterfaceToBytes(tmpMessage)
+	th.Assert(t, err == nil, err)
+	_, _, returnErr = formatMessage(message)
+	th.Assert(t, returnErr != nil, "Expected an error to be thrown due to an incorrect response header")
+	delete(tmpMessage, "responseHeaders")
+
+	// test redirect chain
+	tmpMessage["redirectChain"] = []map[string]interface{}{{"url": "https://example.com/metadata", "scheme": "https", "statusCode": 301, "location": "http://example.com/metadata"}}
+	message, err = convertInterfaceToBytes(tmpMessage)
+	th.Assert(t, err == nil, err)
+	endpt, validation, returnErr = formatMessage(message)
+	th.Assert(t, returnErr == nil, returnErr)
+	th.Assert(t, len(endpt.Metadata.RedirectChain) == 1, fmt.Sprintf("Expected 1 redirect, got %v", endpt.Metadata.RedirectChain))
+	th.Assert(t, endpt.Metadata.RedirectChain[0].StatusCode == 301, fmt.Sprintf("Expected the redirect status to be 301, got %d", endpt.Metadata.RedirectChain[0].StatusCode))
+	foundDowngradeRule := false
+	for _, rule := range validation.Results {
+		if rule.RuleName == endpointmanager.RedirectDowngradeRule {
+			foundDowngradeRule = true
+			th.Assert(t, !rule.Valid, "Expected the redirect downgrade rule to be invalid for a redirect from https to http")
+		}
+	}
+	th.Assert(t, foundDowngradeRule, "Expected the redirect rules to be added to the validation results")
+
+	// test incorrect redirect chain
+	tmpMessage["redirectChain"] = []map[string]interface{}{{"statusCode": "301"}}
+	message, err = convertInterfaceToBytes(tmpMessage)
+	th.Assert(t, err == nil, err)
+	_, _, returnErr = formatMessage(message)
+	th.Assert(t, returnErr != nil, "Expected an error to be thrown due to an incorrect redirect chain")
+	delete(tmpMessage, "redirectChain")
+
+	// test SMART response
+	tmpMessage["smartResp"] = map[string]interface{}{"token_endpoint": "http://example.com/token", "capabilities": []string{"launch-standalone"}}
+	message, err = convertInterfaceToBytes(tmpMessage)
+	th.Assert(t, err == nil, err)
+	_, validation, returnErr = formatMessage(message)
+	th.Assert(t, returnErr == nil, returnErr)
+	foundSMARTRule := false
+	for _, rule := range validation.Results {
+		if rule.RuleName == endpointmanager.SMARTEndpointsHTTPSRule {
+			foundSMARTRule = true
+			th.Assert(t, !rule.Valid, "Expected the SMART endpoints rule to be invalid for an http token endpoint")
+		}
+	}
+	th.Assert(t, foundSMARTRule, "Expected the SMART rules to be added to the validation results")
+	tmpMessage["smartResp"] = nil
+
+	// test JWKS info
+	tmpMessage["jwksInfo"] = map[string]interface{}{"url": "https://example.com/jwks", "httpResponse": 200, "keys": []map[string]interface{}{{"kty": "RSA", "kid": "key-1", "keySize": 2048, "hasPrivateKey": true}}}
+	message, err = convertInterfaceToBytes(tmpMessage)
+	th.Assert(t, err == nil, err)
+	endpt, validation, returnErr = formatMessage(message)
+	th.Assert(t, returnErr == nil, returnErr)
+	th.Assert(t, endpt.Metadata.JWKSInfo != nil, "Expected JWKS info to be set")
+	th.Assert(t, len(endpt.Metadata.JWKSInfo.Keys) == 1, fmt.Sprintf("Expected 1 key, got %v", endpt.Metadata.JWKSInfo.Keys))
+	foundPrivateKeyRule := false
+	for _, rule := range validation.Results {
+		if rule.RuleName == endpointmanager.JWKSPrivateKeyRule {
+			foundPrivateKeyRule = true
+			th.Assert(t, !rule.Valid, "Expected the JWKS private key rule to be invalid for a key with private key material")
+		}
+	}
+	th.Assert(t, foundPrivateKeyRule, "Expected the JWKS rules to be added to the validation results")
+
+	// test incorrect JWKS info
+	tmpMessage["jwksInfo"] = map[string]interface{}{"keys": "key-1"}
+	message, err = convertInterfaceToBytes(tmpMessage)
+	th.Assert(t, err == nil, err)
+	_, _, returnErr = formatMessage(message)
+	th.Assert(t, returnErr != nil, "Expected an error to be thrown due to incorrect JWKS info")
+	delete(tmpMessage, "jwksInfo")
+
+	// test auth server metadata
+	tmpMessage["authServerMetadata"] = map[string]interface{}{"documentType": "openid-configuration", "url": "https://example.com/.well-known/openid-configuration", "httpResponse": 200, "tokenEndpoint": "https://auth.example.com/token"}
+	message, err = convertInterfaceToBytes(tmpMessage)
+	th.Assert(t, err == nil, err)
+	endpt, validation, returnErr = formatMessage(message)
+	th.Assert(t, returnErr == nil, returnErr)
+	th.Assert(t, endpt.Metadata.AuthServerMetadata != nil, "Expected auth server metadata to be set")
+	th.Assert(t, endpt.Metadata.AuthServerMetadata.TokenEndpoint == "https://auth.example.com/token", fmt.Sprintf("Expected the token endpoint to be https://auth.example.com/token, got %s", endpt.Metadata.AuthServerMetadata.TokenEndpoint))
+	foundTokenEndpointRule := false
+	for _, rule := range validation.Results {
+		if rule.RuleName == endpointmanager.TokenEndpointRule {
+			foundTokenEndpointRule = true
+		}
+	}
+	th.Assert(t, foundTokenEndpointRule, "Expected the auth server rules to be added to the validation results")
+
+	// test incorrect auth server metadata
+	tmpMessage["authServerMetadata"] = map[string]interface{}{"httpResponse": "200"}
+	message, err = convertInterfaceToBytes(tmpMessage)
+	th.Assert(t, err == nil, err)
+	_, _, returnErr = formatMessage(message)
+	th.Assert(t, returnErr != nil, "Expected an error to be thrown due to incorrect auth server metadata")
+	delete(tmpMessage, "authServerMetadata")
+
+	// test UDAP info
+	tmpMessage["udapInfo"] = map[string]interface{}{"url": "https://example.com/.well-known/udap", "httpResponse": 200, "profilesSupported": []string{"udap_dcr", "udap_authn"}, "tokenEndpoint": "https://example.com/token"}
+	message, err = convertInterfaceToBytes(tmpMessage)
+	th.Assert(t, err == nil, err)
+	endpt, validation, returnErr = formatMessage(message)
+	th.Assert(t, returnErr == nil, returnErr)
+	th.Assert(t, endpt.Metadata.UDAPInfo != nil, "Expected UDAP info to be set")
+	th.Assert(t, len(endpt.Metadata.UDAPInfo.ProfilesSupported) == 2, fmt.Sprintf("Expected 2 UDAP profiles, got %v", endpt.Metadata.UDAPInfo.ProfilesSupported))
+	foundUDAPRule := false
+	for _, rule := range validation.Results {
+		if rule.RuleName == endpointmanager.UDAPRequiredFieldsRule {
+			foundUDAPRule = true
+			th.Assert(t, !rule.Valid, "Expected the UDAP required fields rule to be invalid for metadata missing required fields")
+		}
+	}
+	th.Assert(t, foundUDAPRule, "Expected the UDAP rules to be added to the validation results")
+
+	// test UDAP metadata that is not published, which is not validated
+	tmpMessage["udapInfo"] = map[string]interface{}{"url": "https://example.com/.well-known/udap", "httpResponse": 404, "error": "the UDAP metadata URL returned HTTP status 404"}
+	message, err = convertInterfaceToBytes(tmpMessage)
+	th.Assert(t, err == nil, err)
+	endpt, validation, returnErr = formatMessage(message)
+	th.Assert(t, returnErr == nil, returnErr)
+	th.Assert(t, endpt.Metadata.UDAPInfo.HTTPResponse == 404, fmt.Sprintf("Expected the UDAP HTTP response to be 404, got %d", endpt.Metadata.UDAPInfo.HTTPResponse))
+	for _, rule := range validation.Results {
+		th.Assert(t, rule.RuleName != endpointmanager.UDAPRequiredFieldsRule, "Did not expect UDAP rules for metadata that is not published")
+	}
+
+	// test incorrect UDAP info
+	tmpMessage["udapInfo"] = map[string]interface{}{"profilesSupported": "udap_dcr"}
+	message, err = convertInterfaceToBytes(tmpMessage)
+	th.Assert(t, err == nil, err)
+	_, _, returnErr = formatMessage(message)
+	th.Assert(t, returnErr != nil, "Expected an error to be thrown due to incorrect UDAP info")
+	delete(tmpMessage, "udapInfo")
+
+	// test CDS Hooks info
+	tmpMessage["cdsHooksInfo"] = map[string]interface{}{"url": "https://example.com/cds-services", "httpResponse": 200, "services": []map[string]interface{}{{"id": "static-patient-view", "hook": "patient-view", "prefetch": map[string]string{"patient": "Patient/{{context.patientId}}"}}}}
+	message, err = convertInterfaceToBytes(tmpMessage)
+	th.Assert(t, err == nil, err)
+	endpt, _, returnErr = formatMessage(message)
+	th.Assert(t, returnErr == nil, returnErr)
+	th.Assert(t, endpt.Metadata.CDSHooksInfo != nil, "Expected CDS Hooks info to be set")
+	th.Assert(t, len(endpt.Metadata.CDSHooksInfo.Services) == 1, fmt.Sprintf("Expected 1 CDS service, got %v", endpt.Metadata.CDSHooksInfo.Services))
+	th.Assert(t, endpt.Metadata.CDSHooksInfo.Services[0].Hook == "patient-view", fmt.Sprintf("Expected the patient-view hook, got %s", endpt.Metadata.CDSHooksInfo.Services[0].Hook))
+
+	// test incorrect CDS Hooks info
+	tmpMessage["cdsHooksInfo"] = map[string]interface{}{"services": "static-patient-view"}
+	message, err = convertInterfaceToBytes(tmpMessage)
+	th.Assert(t, err == nil, err)
+	_, _, returnErr = formatMessage(message)
+	th.Assert(t, returnErr != nil, "Expected an error to be thrown due to incorrect CDS Hooks info")
+	delete(tmpMessage, "cdsHooksInfo")
+
+	// test DNS info
+	tmpMessage["dnsInfo"] = map[string]interface{}{"host": "example.com", "cnameChain": []string{"example.com.edge.example.net"}, "addresses": []map[string]interface{}{{"ip": "2600:1f18::1", "provider": "AWS", "region": "us-east-1", "service": "EC2"}}, "ttl": 60}
+	message, err = convertInterfaceToBytes(tmpMessage)
+	th.Assert(t, err == nil, err)
+	endpt, _, returnErr = formatMessage(message)
+	th.Assert(t, returnErr == nil, returnErr)
+	th.Assert(t, endpt.Metadata.DNSInfo != nil, "Expected DNS info to be set")
+	th.Assert(t, endpt.Metadata.DNSInfo.TTL == 60, fmt.Sprintf("Expected a TTL of 60, got %d", endpt.Metadata.DNSInfo.TTL))
+	th.Assert(t, endpt.Metadata.DNSInfo.SupportsIPv6(), "Expected the host to support IPv6")
+
+	// test incorrect DNS info
+	tmpMessage["dnsInfo"] = map[string]interface{}{"addresses": "2600:1f18::1"}
+	message, err = convertInterfaceToBytes(tmpMessage)
+	th.Assert(t, err == nil, err)
+	_, _, returnErr = formatMessage(message)
+	th.Assert(t, returnErr != nil, "Expected an error to be thrown due to incorrect DNS info")
+	delete(tmpMessage, "dnsInfo")
+
+	// test Bulk Data kickoff
+	tmpMessage["bulkDataKickoff"] = map[string]interface{}{"url": "https://example.com/$export", "httpResponse": 401}
+	message, err = convertInterfaceToBytes(tmpMessage)
+	th.Assert(t, err == nil, err)
+	endpt, _, returnErr = formatMessage(message)
+	th.Assert(t, returnErr == nil, returnErr)
+	th.Assert(t, endpt.BulkData != nil && endpt.BulkData.Kickoff != nil, "Expected the Bulk Data kickoff to be set")
+	th.Assert(t, endpt.BulkData.Kickoff.HTTPResponse == 401, fmt.Sprintf("Expected the kickoff HTTP response to be 401, got %d", endpt.BulkData.Kickoff.HTTPResponse))
+	th.Assert(t, !endpt.BulkData.Supported(), "Expected Bulk Data not to be supported by a capability statement without the export operation")
+
+	// test incorrect Bulk Data kickoff
+	tmpMessage["bulkDataKickoff"] = map[string]interface{}{"httpResponse": "401"}
+	message, err = convertInterfaceToBytes(tmpMessage)
+	th.Assert(t, err == nil, err)
+	_, _, returnErr = formatMessage(message)
+	th.Assert(t, returnErr != nil, "Expected an error to be thrown due to incorrect Bulk Data kickoff")
+	delete(tmpMessage, "bulkDataKickoff")
+
+	// test data exposure checks
+	tmpMessage["dataExposureChecks"] = []map[string]interface{}{{"search": "Patient?_count=1", "httpResponse": 200, "resourceType": "Bundle", "total": 1200, "entryCount": 1}}
+	message, err = convertInterfaceToBytes(tmpMessage)
+	th.Assert(t, err == nil, err)
+	endpt, validation, returnErr = formatMessage(message)
+	th.Assert(t, returnErr == nil, returnErr)
+	th.Assert(t, len(endpt.Metadata.DataExposureChecks) == 1, fmt.Sprintf("Expected 1 data exposure check, got %v", endpt.Metadata.DataExposureChecks))
+	th.Assert(t, *endpt.Metadata.DataExposureChecks[0].Total == 1200, fmt.Sprintf("Expected a Bundle total of 1200, got %d", *endpt.Metadata.DataExposureChecks[0].Total))
+	dataExposureRule := validation.Results[len(validation.Results)-1]
+	th.Assert(t, dataExposureRule.RuleName == endpointmanager.DataExposureRule && !dataExposureRule.Valid, fmt.Sprintf("Expected the data exposure rule to fail, got %+v", dataExposureRule))
+
+	// test incorrect data exposure checks
+	tmpMessage["dataExposureChecks"] = map[string]interface{}{"search": "Patient?_count=1"}
+	message, err = convertInterfaceToBytes(tmpMessage)
+	th.Assert(t, err == nil, err)
+	_, _, returnErr = formatMessage(message)
+	th.Assert(t, returnErr != nil, "Expected an error to be thrown due to incorrect data exposure checks")
+	delete(tmpMessage, "dataExposureChecks")
+
+	// test error response
+	tmpMessage["errorResponse"] = map[string]interface{}{"kind": "auth_required", "body": "", "issues": nil, "authChallenges": []map[string]interface{}{{"scheme": "Bearer", "realm": "fhir", "error": ""}}}
+	message, err = convertInterfaceToBytes(tmpMessage)
+	th.Assert(t, err == nil, err)
+	endpt, validation, returnErr = formatMessage(message)
+	th.Assert(t, returnErr == nil, returnErr)
+	th.Assert(t, endpt.Metadata.ErrorResponse != nil && endpt.Metadata.ErrorResponse.Kind == endpointmanager.AuthRequiredKind, fmt.Sprintf("Expected an auth_required error response, got %+v", endpt.Metadata.ErrorResponse))
+	th.Assert(t, len(endpt.Metadata.ErrorResponse.AuthChallenges) == 1, fmt.Sprintf("Expected 1 auth challenge, got %v", endpt.Metadata.ErrorResponse.AuthChallenges))
+	metadataPublicRule := validation.Results[len(validation.Results)-1]
+	th.Assert(t, metadataPublicRule.RuleName == endpointmanager.MetadataPublicRule && !metadataPublicRule.Valid, fmt.Sprintf("Expected the metadata public rule to fail, got %+v", metadataPublicRule))
+
+	// test incorrect error response
+	tmpMessage["errorResponse"] = []interface{}{"auth_required"}
+	message, err = convertInterfaceToBytes(tmpMessage)
+	th.Assert(t, err == nil, err)
+	_, _, returnErr = formatMessage(message)
+	th.Assert(t, returnErr != nil, "Expected an error to be thrown due to incorrect error response")
+	delete(tmpMessage, "errorResponse")
+
+	// test not modified response, for which only the metadata is validated
+	tmpMessage["httpResponse"] = 304
+	tmpMessage["responseHeaders"] = map[string]interface{}{"ETag": "\"v1\""}
+	message, err = convertInterfaceToBytes(tmpMessage)
+	th.Assert(t, err == nil, err)
+	endpt, validation, returnErr = formatMessage(message)
+	th.Assert(t, returnErr == nil, returnErr)
+	th.Assert(t, endpt.Metadata.HTTPResponse == 200, fmt.Sprintf("Expected a 304 response to be recorded as 200, got %d", endpt.Metadata.HTTPResponse))
+	th.Assert(t, endpt.Metadata.NotModified, "Expected a 304 response to be recorded as not modified")
+	th.Assert(t, len(validation.Results) > 0, "Expected the metadata of a 304 response to be validated")
+	for _, rule := range validation.Results {
+		th.Assert(t, rule.RuleName != endpointmanager.CapStatExistRule, "Did not expect the missing capability statement of a 304 response to be validated")
+	}
+	tmpMessage["httpResponse"] = 200
+	delete(tmpMessage, "responseHeaders")
+
+	// test incorrect capability statement format
+	tmpMessage["capabilityStatementFormat"] = 1
+	message, err = convertInterfaceToBytes(tmpMessage)
+	th.Assert(t, err == nil, err)
+	_, _, returnErr = formatMessage(message)
+	th.Assert(t, returnErr != nil, "Expected an error to be thrown due to an incorrect capabilityStatementFormat")
+	delete(tmpMessage, "capabilityStatementFormat")
+
 	// test incorrect capability version
 	capStat, ok := tmpMessage["capabilityStatement"].(map[string]interface{})
 	th.Assert(t, ok, err)
@@ -435,6 +771,90 @@ func Test_formatMessage(t *testing.T) {
 	tmpMessage["defaultFhirVersion"] = "4.0"
 }
 
+func Test_formatMessageEnvelope(t *testing.T) {
+	msg := queuemessage.CapabilityResponse{
+		URL:                  "http://example.com/DTSU2/",
+		ErrorCode:            endpointmanager.ConnectionRefusedCode,
+		Err:                  "connection refused",
+		TLSVersion:           "TLS 1.2",
+		RequestedFhirVersion: "None",
+		ResponseTimings:      queuemessage.ResponseTimings{DNSLookup: 0.01, BodyTransfer: 0.05},
+	}
+	message, err := queuemessage.Encode(queuemessage.TypeCapabilityResponse, queuemessage.ProducerCapabilityQuerier, "run-1", msg)
+	th.Assert(t, err == nil, err)
+
+	endpt, validation, err := formatMessage(message)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, validation != nil, "Expected the message to be validated")
+	th.Assert(t, endpt.URL == msg.URL, fmt.Sprintf("Expected URL %s, got %s", msg.URL, endpt.URL))
+	th.Assert(t, endpt.Metadata.Errors == msg.Err, fmt.Sprintf("Expected error %s, got %s", msg.Err, endpt.Metadata.Errors))
+	th.Assert(t, endpt.Metadata.ErrorCode == endpointmanager.ConnectionRefusedCode, fmt.Sprintf("Expected error code to be connection_refused, got %s", endpt.Metadata.ErrorCode))
+	th.Assert(t, endpt.Metadata.BodyTransferTime == 0.05, fmt.Sprintf("Expected body transfer time to be 0.05, got %f", endpt.Metadata.BodyTransferTime))
+
+	// nothing is saved for the end of a run
+	message, err = queuemessage.EncodeRunFinished(queuemessage.ProducerCapabilityQuerier, "run-1")
+	th.Assert(t, err == nil, err)
+	endpt, _, err = formatMessage(message)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, endpt == nil, "Expected no endpoint info for a run finished message")
+
+	// a message from a newer querier
+	message = []byte(`{"schemaVersion":2,"type":"capability-response","messageId":"abc","producer":"capabilityquerier","payload":{}}`)
+	_, _, err = formatMessage(message)
+	_, ok := err.(*queuemessage.SchemaVersionError)
+	th.Assert(t, ok, fmt.Sprintf("Expected a schema version error, got %v", err))
+
+	// a message meant for another queue
+	message, err = queuemessage.Encode(queuemessage.TypeCapabilityQuery, queuemessage.ProducerCapabilityReceiver, "run-1", queuemessage.CapabilityQuery{URL: msg.URL})
+	th.Assert(t, err == nil, err)
+	_, _, err = formatMessage(message)
+	_, ok = err.(*queuemessage.MessageTypeError)
+	th.Assert(t, ok, fmt.Sprintf("Expected a message type error, got %v", err))
+}
+
+func Test_keepSavedHeaders(t *testing.T) {
+	savedMetadata := &endpointmanager.FHIREndpointMetadata{
+		ResponseHeaders: map[string]string{
+			"ETag":                        "\"v1\"",
+			"Last-Modified":               "Mon, 05 Oct 2026 10:00:00 GMT",
+			"Content-Type":                "application/fhir+json",
+			"Access-Control-Allow-Origin": "*",
+			"Date":                        "Mon, 05 Oct 2026 10:00:00 GMT",
+		},
+	}
+
+	// a 304 response keeps the saved headers that it does not include
+	metadata := &endpointmanager.FHIREndpointMetadata{ResponseHeaders: map[string]string{"Date": "Tue, 06 Oct 2026 10:00:00 GMT"}}
+	keepSavedHeaders(metadata, savedMetadata)
+	th.Assert(t, metadata.ResponseHeaders["ETag"] == "\"v1\"", fmt.Sprintf("Expected the ETag to be kept, got %s", metadata.ResponseHeaders["ETag"]))
+	th.Assert(t, metadata.ResponseHeaders["Last-Modified"] == "Mon, 05 Oct 2026 10:00:00 GMT", fmt.Sprintf("Expected the Last-Modified header to be kept, got %s", metadata.ResponseHeaders["Last-Modified"]))
+	th.Assert(t, metadata.ResponseHeaders["Content-Type"] == "application/fhir+json", fmt.Sprintf("Expected the Content-Type to be kept, got %s", metadata.ResponseHeaders["Content-Type"]))
+	th.Assert(t, metadata.ResponseHeaders["Access-Control-Allow-Origin"] == "*", fmt.Sprintf("Expected the Access-Control-Allow-Origin header to be kept, got %s", metadata.ResponseHeaders["Access-Control-Allow-Origin"]))
+	th.Assert(t, metadata.ResponseHeaders["Date"] == "Tue, 06 Oct 2026 10:00:00 GMT", fmt.Sprintf("Expected the Date of the 304 response, got %s", metadata.ResponseHeaders["Date"]))
+
+	// the headers of the 304 response are not replaced
+	metadata = &endpointmanager.FHIREndpointMetadata{ResponseHeaders: map[string]string{"ETag": "\"v2\""}}
+	keepSavedHeaders(metadata, savedMetadata)
+	th.Assert(t, metadata.ResponseHeaders["ETag"] == "\"v2\"", fmt.Sprintf("Expected the ETag of the 304 response, got %s", metadata.ResponseHeaders["ETag"]))
+
+	// a 304 response validates the same as the 200 response it stands for
+	fhirEndpoint := &endpointmanager.FHIREndpointInfo{
+		TLSVersion: "TLS 1.2",
+		MIMETypes:  []string{"application/fhir+json"},
+		Metadata:   &endpointmanager.FHIREndpointMetadata{ResponseHeaders: map[string]string{"ETag": "\"v1\""}},
+	}
+	keepSavedHeaders(fhirEndpoint.Metadata, savedMetadata)
+	notModifiedValidation := validateMetadata(fhirEndpoint)
+	fhirEndpoint.Metadata = savedMetadata
+	savedValidation := validateMetadata(fhirEndpoint)
+	th.Assert(t, notModifiedValidation.Equal(&savedValidation), "Expected the 304 response to have the same validation as the saved response")
+
+	// no saved headers
+	metadata = &endpointmanager.FHIREndpointMetadata{}
+	keepSavedHeaders(metadata, &endpointmanager.FHIREndpointMetadata{})
+	th.Assert(t, metadata.ResponseHeaders == nil, fmt.Sprintf("Did not expect response headers, got %v", metadata.ResponseHeaders))
+}
+
 func Test_RunIncludedFieldsAndExtensionsChecks(t *testing.T) {
 	setupCapabilityStatement(t, filepath.Join("../../testdata", "cerner_capability_dstu2.json"))
 	capInt := testQueueMsg["capabilityStatement"].(map[string]interface{})
@@ -0,0 +1,81 @@
+package capabilityhandler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/onc-healthit/lantern-back-end/capabilityquerier/pkg/capabilityquerier"
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/queuemessage"
+	th "github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/testhelper"
+	"github.com/onc-healthit/lantern-back-end/lanternmq/pkg/accessqueue"
+	"github.com/spf13/viper"
+)
+
+// Test_capabilityResponseRoundTrip sends the capability querier's response for an endpoint through the in-memory
+// queue driver to the capability receiver, the way the services pass it on through RabbitMQ
+func Test_capabilityResponseRoundTrip(t *testing.T) {
+	driver := viper.GetString("queue_driver")
+	defer viper.Set("queue_driver", driver)
+	viper.Set("queue_driver", "memory")
+	qName := "capability-statements-round-trip-test"
+
+	capStat, err := os.ReadFile(filepath.Join("../../testdata", "test_r4_capability_statement.json"))
+	th.Assert(t, err == nil, err)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/fhir/metadata", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/fhir+json")
+		_, _ = w.Write(capStat)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// the receiver is consuming from the queue before the querier sends to it
+	receiverMQ, receiverCh, err := accessqueue.ConnectToServerAndQueue("", "", "", "", qName)
+	th.Assert(t, err == nil, err)
+	defer receiverMQ.Close()
+	msgs, err := receiverMQ.ConsumeFromQueue(receiverCh, qName)
+	th.Assert(t, err == nil, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	received := make(chan *endpointmanager.FHIREndpointInfo, 1)
+	handler := func(message []byte, args *map[string]interface{}) error {
+		fhirEndpoint, _, err := ProcessMessage(message)
+		if err != nil {
+			return err
+		}
+		received <- fhirEndpoint
+		return nil
+	}
+	errs := make(chan error, 1)
+	go receiverMQ.ProcessMessages(ctx, msgs, handler, nil, errs)
+
+	querierMQ, querierCh, err := accessqueue.ConnectToServerAndQueue("", "", "", "", qName)
+	th.Assert(t, err == nil, err)
+	defer querierMQ.Close()
+	message, err := capabilityquerier.QueryCapabilityStatement(ctx, server.URL+"/fhir/", "None", "LANTERN")
+	th.Assert(t, err == nil, err)
+	msgBytes, err := queuemessage.Encode(queuemessage.TypeCapabilityResponse, queuemessage.ProducerCapabilityQuerier, "run-1", message)
+	th.Assert(t, err == nil, err)
+	err = accessqueue.SendToQueue(ctx, string(msgBytes), &querierMQ, &querierCh, qName)
+	th.Assert(t, err == nil, err)
+
+	select {
+	case fhirEndpoint := <-received:
+		th.Assert(t, fhirEndpoint.URL == message.URL, fmt.Sprintf("expected the URL %s, got %s", message.URL, fhirEndpoint.URL))
+		th.Assert(t, fhirEndpoint.Metadata.HTTPResponse == http.StatusOK, fmt.Sprintf("expected HTTP response 200, got %d", fhirEndpoint.Metadata.HTTPResponse))
+		th.Assert(t, fhirEndpoint.CapabilityStatement != nil, "expected the capability statement to be received")
+		th.Assert(t, fhirEndpoint.CapabilityFhirVersion == "4.0.1", fmt.Sprintf("expected FHIR version 4.0.1, got %s", fhirEndpoint.CapabilityFhirVersion))
+	case err := <-errs:
+		t.Fatalf("expected the capability response to be processed, got %s", err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected the capability response to be received")
+	}
+}
@@ -0,0 +1,170 @@
+package validation
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/capabilityparser"
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/smartparser"
+)
+
+// oauthEndpoint is an authorization server endpoint as listed by one of the documents that can list it
+type oauthEndpoint struct {
+	source string
+	value  string
+}
+
+// RunAuthServerValidation runs all of the checks comparing the authorization server endpoints listed in the
+// authorization server metadata, the SMART configuration and the capability statement's oauth-uris extension
+func (bv *baseVal) RunAuthServerValidation(authServer *endpointmanager.AuthServerMetadata, capStat capabilityparser.CapabilityStatement, smartRsp smartparser.SMARTResponse) []endpointmanager.Rule {
+	return []endpointmanager.Rule{
+		bv.TokenEndpointMatch(authServer, capStat, smartRsp),
+		bv.AuthorizeEndpointMatch(authServer, capStat, smartRsp),
+	}
+}
+
+// TokenEndpointMatch checks that the documents listing the token endpoint all list the same one
+func (bv *baseVal) TokenEndpointMatch(authServer *endpointmanager.AuthServerMetadata, capStat capabilityparser.CapabilityStatement, smartRsp smartparser.SMARTResponse) endpointmanager.Rule {
+	ruleError := endpointmanager.Rule{
+		RuleName:  endpointmanager.TokenEndpointRule,
+		Valid:     true,
+		Comment:   "The token endpoint in the SMART configuration, the capability statement's oauth-uris extension and the authorization server metadata should be the same.",
+		Reference: smartConformanceReference,
+		ImplGuide: smartImplGuide,
+	}
+
+	var endpoints []oauthEndpoint
+	if config := smartConfigurationOrNil(smartRsp); config != nil {
+		endpoints = append(endpoints, oauthEndpoint{"SMART configuration", config.TokenEndpoint})
+	}
+	endpoints = append(endpoints, oauthEndpoint{"oauth-uris extension", oauthURI(capStat, "token")})
+	if authServer != nil && authServer.Error == "" {
+		endpoints = append(endpoints, oauthEndpoint{authServer.DocumentType + " metadata", authServer.TokenEndpoint})
+	}
+
+	return compareOAuthEndpoints(ruleError, "token endpoint", endpoints)
+}
+
+// AuthorizeEndpointMatch checks that the documents listing the authorization endpoint all list the same one
+func (bv *baseVal) AuthorizeEndpointMatch(authServer *endpointmanager.AuthServerMetadata, capStat capabilityparser.CapabilityStatement, smartRsp smartparser.SMARTResponse) endpointmanager.Rule {
+	ruleError := endpointmanager.Rule{
+		RuleName:  endpointmanager.AuthorizeEndpointRule,
+		Valid:     true,
+		Comment:   "The authorization endpoint in the SMART configuration, the capability statement's oauth-uris extension and the authorization server metadata should be the same.",
+		Reference: smartConformanceReference,
+		ImplGuide: smartImplGuide,
+	}
+
+	var endpoints []oauthEndpoint
+	if config := smartConfigurationOrNil(smartRsp); config != nil {
+		endpoints = append(endpoints, oauthEndpoint{"SMART configuration", config.AuthorizationEndpoint})
+	}
+	endpoints = append(endpoints, oauthEndpoint{"oauth-uris extension", oauthURI(capStat, "authorize")})
+	if authServer != nil && authServer.Error == "" {
+		endpoints = append(endpoints, oauthEndpoint{authServer.DocumentType + " metadata", authServer.AuthorizationEndpoint})
+	}
+
+	return compareOAuthEndpoints(ruleError, "authorization endpoint", endpoints)
+}
+
+// compareOAuthEndpoints sets ruleError to invalid if the sources that list the endpoint do not all list the same
+// one. The first source that lists the endpoint is the expected value.
+func compareOAuthEndpoints(ruleError endpointmanager.Rule, name string, endpoints []oauthEndpoint) endpointmanager.Rule {
+	var listed []oauthEndpoint
+	for _, endpoint := range endpoints {
+		if endpoint.value != "" {
+			listed = append(listed, endpoint)
+		}
+	}
+	if len(listed) == 0 {
+		return ruleError
+	}
+
+	ruleError.Expected = listed[0].value
+	ruleError.Actual = listed[0].value
+	for _, endpoint := range listed[1:] {
+		if normalizeOAuthEndpoint(endpoint.value) != normalizeOAuthEndpoint(listed[0].value) {
+			ruleError.Valid = false
+			ruleError.Actual = endpoint.value
+			ruleError.Comment = fmt.Sprintf("The %s in the %s does not match the %s in the %s. ", name, endpoint.source, name, listed[0].source) + ruleError.Comment
+			return ruleError
+		}
+	}
+
+	return ruleError
+}
+
+// normalizeOAuthEndpoint returns the endpoint with a lower case scheme and host and without a trailing slash, so that
+// endpoints that only differ in those ways match
+func normalizeOAuthEndpoint(endpoint string) string {
+	endpoint = strings.TrimSuffix(strings.TrimSpace(endpoint), "/")
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return endpoint
+	}
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+	parsed.Host = strings.ToLower(parsed.Host)
+	return parsed.String()
+}
+
+// smartConfigurationOrNil returns the typed SMART configuration, or nil if there is no SMART response or it could
+// not be parsed
+func smartConfigurationOrNil(smartRsp smartparser.SMARTResponse) *smartparser.SMARTConfiguration {
+	if smartRsp == nil {
+		return nil
+	}
+	config, err := smartRsp.GetConfiguration()
+	if err != nil {
+		return nil
+	}
+	return config
+}
+
+// oauthURI returns the URI with the given name (authorize, token, register, manage, introspect or revoke) from the
+// oauth-uris extension in the security element of the capability statement's rest elements, or an empty string if
+// it is not listed
+func oauthURI(capStat capabilityparser.CapabilityStatement, name string) string {
+	if capStat == nil {
+		return ""
+	}
+	rest, err := capStat.GetRest()
+	if err != nil {
+		return ""
+	}
+	for _, restElem := range rest {
+		security, ok := restElem["security"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		extensions, ok := security["extension"].([]interface{})
+		if !ok {
+			continue
+		}
+		for _, extInt := range extensions {
+			ext, ok := extInt.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			extURL, _ := ext["url"].(string)
+			if !strings.HasSuffix(extURL, "StructureDefinition/oauth-uris") {
+				continue
+			}
+			uris, ok := ext["extension"].([]interface{})
+			if !ok {
+				continue
+			}
+			for _, uriInt := range uris {
+				uri, ok := uriInt.(map[string]interface{})
+				if !ok || uri["url"] != name {
+					continue
+				}
+				if value, ok := uri["valueUri"].(string); ok {
+					return strings.TrimSpace(value)
+				}
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,154 @@
+package validation
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+)
+
+// certExpirationWarning is how long before a certificate expires that it is considered to be expiring soon
+var certExpirationWarning = 30 * 24 * time.Hour
+
+// minimum key sizes in bits from NIST SP 800-57 for keys providing at least 112 bits of security
+var minRSAKeySize = 2048
+var minECDSAKeySize = 224
+
+var fhirSecurityReference = "https://www.hl7.org/fhir/security.html"
+
+// RunTLSValidation runs all of the certificate validation checks on the TLS handshake made with the endpoint
+func (bv *baseVal) RunTLSValidation(tlsInfo *endpointmanager.TLSInfo) []endpointmanager.Rule {
+	return []endpointmanager.Rule{
+		bv.CertificateExpiration(tlsInfo),
+		bv.CertificateHostname(tlsInfo),
+		bv.CertificateKeyStrength(tlsInfo),
+		bv.CertificateSelfSigned(tlsInfo),
+	}
+}
+
+// CertificateExpiration checks that the endpoint's certificate is currently valid and is not going to
+// expire soon
+func (bv *baseVal) CertificateExpiration(tlsInfo *endpointmanager.TLSInfo) endpointmanager.Rule {
+	baseComment := fmt.Sprintf("The server certificate should be valid and should not expire within %d days.", int(certExpirationWarning.Hours()/24))
+	ruleError := endpointmanager.Rule{
+		RuleName:  endpointmanager.CertExpirationRule,
+		Valid:     true,
+		Expected:  "valid",
+		Actual:    "valid",
+		Comment:   baseComment,
+		Reference: fhirSecurityReference,
+	}
+
+	if tlsInfo == nil {
+		ruleError.Valid = false
+		ruleError.Actual = ""
+		ruleError.Comment = "The TLS handshake information does not exist; cannot check the server certificate. " + baseComment
+		return ruleError
+	}
+
+	now := time.Now()
+	if now.Before(tlsInfo.NotBefore) {
+		ruleError.Valid = false
+		ruleError.Actual = "not yet valid"
+		ruleError.Comment = fmt.Sprintf("The server certificate is not valid until %s. ", tlsInfo.NotBefore.Format(time.RFC3339)) + baseComment
+	} else if now.After(tlsInfo.NotAfter) {
+		ruleError.Valid = false
+		ruleError.Actual = "expired"
+		ruleError.Comment = fmt.Sprintf("The server certificate expired on %s. ", tlsInfo.NotAfter.Format(time.RFC3339)) + baseComment
+	} else if now.Add(certExpirationWarning).After(tlsInfo.NotAfter) {
+		ruleError.Valid = false
+		ruleError.Actual = "expiring soon"
+		ruleError.Comment = fmt.Sprintf("The server certificate expires on %s. ", tlsInfo.NotAfter.Format(time.RFC3339)) + baseComment
+	}
+
+	return ruleError
+}
+
+// CertificateHostname checks that the endpoint's certificate is valid for the endpoint's host name
+func (bv *baseVal) CertificateHostname(tlsInfo *endpointmanager.TLSInfo) endpointmanager.Rule {
+	baseComment := "The server certificate must be issued for the host name of the endpoint."
+	ruleError := endpointmanager.Rule{
+		RuleName:  endpointmanager.CertHostnameRule,
+		Valid:     true,
+		Expected:  "true",
+		Actual:    "true",
+		Comment:   baseComment,
+		Reference: "https://www.rfc-editor.org/rfc/rfc6125",
+	}
+
+	if tlsInfo == nil {
+		ruleError.Valid = false
+		ruleError.Actual = ""
+		ruleError.Comment = "The TLS handshake information does not exist; cannot check the server certificate. " + baseComment
+		return ruleError
+	}
+
+	if !tlsInfo.HostnameMatch {
+		ruleError.Valid = false
+		ruleError.Actual = "false"
+		ruleError.Comment = fmt.Sprintf("The server certificate is issued for %v. ", tlsInfo.LeafSANs) + baseComment
+	}
+
+	return ruleError
+}
+
+// CertificateKeyStrength checks that the endpoint's certificate key is at least 2048 bits for RSA keys and
+// at least 224 bits for ECDSA keys
+func (bv *baseVal) CertificateKeyStrength(tlsInfo *endpointmanager.TLSInfo) endpointmanager.Rule {
+	baseComment := fmt.Sprintf("Server certificate keys should be at least %d bits for RSA keys and at least %d bits for ECDSA keys.", minRSAKeySize, minECDSAKeySize)
+	ruleError := endpointmanager.Rule{
+		RuleName:  endpointmanager.CertKeyStrengthRule,
+		Valid:     true,
+		Expected:  fmt.Sprintf("RSA %d, ECDSA %d, Ed25519", minRSAKeySize, minECDSAKeySize),
+		Comment:   baseComment,
+		Reference: "https://nvlpubs.nist.gov/nistpubs/SpecialPublications/NIST.SP.800-57pt1r5.pdf",
+	}
+
+	if tlsInfo == nil {
+		ruleError.Valid = false
+		ruleError.Comment = "The TLS handshake information does not exist; cannot check the server certificate. " + baseComment
+		return ruleError
+	}
+
+	ruleError.Actual = tlsInfo.KeyType + " " + strconv.Itoa(tlsInfo.KeySize)
+	switch tlsInfo.KeyType {
+	case "RSA":
+		ruleError.Valid = tlsInfo.KeySize >= minRSAKeySize
+	case "ECDSA":
+		ruleError.Valid = tlsInfo.KeySize >= minECDSAKeySize
+	case "Ed25519":
+		ruleError.Valid = true
+	default:
+		ruleError.Valid = false
+	}
+
+	return ruleError
+}
+
+// CertificateSelfSigned checks that the endpoint's certificate is not self-signed
+func (bv *baseVal) CertificateSelfSigned(tlsInfo *endpointmanager.TLSInfo) endpointmanager.Rule {
+	baseComment := "The server certificate should be issued by a trusted certificate authority rather than being self-signed."
+	ruleError := endpointmanager.Rule{
+		RuleName:  endpointmanager.CertSelfSignedRule,
+		Valid:     true,
+		Expected:  "false",
+		Actual:    "false",
+		Comment:   baseComment,
+		Reference: fhirSecurityReference,
+	}
+
+	if tlsInfo == nil {
+		ruleError.Valid = false
+		ruleError.Actual = ""
+		ruleError.Comment = "The TLS handshake information does not exist; cannot check the server certificate. " + baseComment
+		return ruleError
+	}
+
+	if tlsInfo.SelfSigned {
+		ruleError.Valid = false
+		ruleError.Actual = "true"
+	}
+
+	return ruleError
+}
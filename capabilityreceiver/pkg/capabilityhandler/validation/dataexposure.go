@@ -0,0 +1,38 @@
+package validation
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+)
+
+// RunDataExposureValidation runs the checks on the searches for patient data made without authorization
+func (bv *baseVal) RunDataExposureValidation(checks []endpointmanager.DataExposureCheck) []endpointmanager.Rule {
+	return []endpointmanager.Rule{
+		bv.DataExposure(checks),
+	}
+}
+
+// DataExposure checks that none of the searches for patient data made without authorization returned any entries.
+// This is a critical failure: the endpoint returns protected health information to anyone who asks for it.
+func (bv *baseVal) DataExposure(checks []endpointmanager.DataExposureCheck) endpointmanager.Rule {
+	baseComment := "Servers SHALL NOT return patient data to clients that have not been authorized. A search made without an access token should be refused with a 401 or 403 response."
+	ruleError := endpointmanager.Rule{
+		RuleName:  endpointmanager.DataExposureRule,
+		Valid:     true,
+		Expected:  "0",
+		Actual:    "0",
+		Comment:   baseComment,
+		Reference: fhirSecurityReference,
+	}
+
+	exposed := endpointmanager.ExposedSearches(checks)
+	ruleError.Actual = fmt.Sprintf("%d", len(exposed))
+	if len(exposed) > 0 {
+		ruleError.Valid = false
+		ruleError.Comment = fmt.Sprintf("CRITICAL: %d of the %d searches made without authorization returned patient data: %s. ", len(exposed), len(checks), strings.Join(exposed, ", ")) + baseComment
+	}
+
+	return ruleError
+}
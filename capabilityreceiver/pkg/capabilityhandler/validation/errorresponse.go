@@ -0,0 +1,53 @@
+package validation
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+)
+
+// RunErrorResponseValidation runs the checks on the response to the capability statement request when it failed
+func (bv *baseVal) RunErrorResponseValidation(httpResponse int, errorResponse *endpointmanager.ErrorResponse) []endpointmanager.Rule {
+	return []endpointmanager.Rule{
+		bv.MetadataPublic(httpResponse, errorResponse),
+	}
+}
+
+// MetadataPublic checks that the capability statement can be read without authorization. It only fails when the
+// request was refused for lack of authorization: other failures are reported by the capability statement checks.
+func (bv *baseVal) MetadataPublic(httpResponse int, errorResponse *endpointmanager.ErrorResponse) endpointmanager.Rule {
+	baseComment := "The capability statement at [base]/metadata SHALL be available to clients without authorization so that they can discover how to connect to the server."
+	ruleError := endpointmanager.Rule{
+		RuleName:  endpointmanager.MetadataPublicRule,
+		Valid:     true,
+		Expected:  "true",
+		Actual:    "true",
+		Comment:   baseComment,
+		Reference: "http://hl7.org/fhir/http.html#capabilities",
+	}
+
+	kind := endpointmanager.ErrorResponseKind("")
+	if errorResponse != nil {
+		kind = errorResponse.Kind
+	} else if httpResponse >= 400 {
+		kind = endpointmanager.ClassifyErrorResponse(httpResponse, nil)
+	}
+	if kind != endpointmanager.AuthRequiredKind {
+		return ruleError
+	}
+
+	ruleError.Valid = false
+	ruleError.Actual = "false"
+	comment := fmt.Sprintf("The capability statement request was refused with a %d response", httpResponse)
+	if errorResponse != nil && len(errorResponse.AuthChallenges) > 0 {
+		schemes := make([]string, 0, len(errorResponse.AuthChallenges))
+		for _, challenge := range errorResponse.AuthChallenges {
+			schemes = append(schemes, challenge.Scheme)
+		}
+		comment += " asking for " + strings.Join(schemes, ", ") + " authorization"
+	}
+	ruleError.Comment = comment + ". " + baseComment
+
+	return ruleError
+}
@@ -30,6 +30,41 @@ type Validator interface {
 	DocumentSetValid(capabilityparser.CapabilityStatement) endpointmanager.Rule
 	UniqueResources(capabilityparser.CapabilityStatement) endpointmanager.Rule
 	SearchParamsUnique(capabilityparser.CapabilityStatement) endpointmanager.Rule
+	RunTLSValidation(*endpointmanager.TLSInfo) []endpointmanager.Rule
+	CertificateExpiration(*endpointmanager.TLSInfo) endpointmanager.Rule
+	CertificateHostname(*endpointmanager.TLSInfo) endpointmanager.Rule
+	CertificateKeyStrength(*endpointmanager.TLSInfo) endpointmanager.Rule
+	CertificateSelfSigned(*endpointmanager.TLSInfo) endpointmanager.Rule
+	RunHeaderValidation(map[string]string, string, []string) []endpointmanager.Rule
+	HSTSHeader(map[string]string, string) endpointmanager.Rule
+	CORSHeader(map[string]string) endpointmanager.Rule
+	ContentTypeMatches(map[string]string, []string) endpointmanager.Rule
+	RunRedirectValidation([]endpointmanager.RedirectHop) []endpointmanager.Rule
+	RedirectDowngrade([]endpointmanager.RedirectHop) endpointmanager.Rule
+	RedirectCrossDomain([]endpointmanager.RedirectHop) endpointmanager.Rule
+	RedirectLoop([]endpointmanager.RedirectHop) endpointmanager.Rule
+	RunSMARTValidation(smartparser.SMARTResponse) []endpointmanager.Rule
+	SMARTRequiredFields(smartparser.SMARTResponse) endpointmanager.Rule
+	SMARTPKCE(smartparser.SMARTResponse) endpointmanager.Rule
+	SMARTLaunchContext(smartparser.SMARTResponse) endpointmanager.Rule
+	SMARTPermissionV2(smartparser.SMARTResponse) endpointmanager.Rule
+	SMARTEndpointsHTTPS(smartparser.SMARTResponse) endpointmanager.Rule
+	RunJWKSValidation(*endpointmanager.JWKSInfo) []endpointmanager.Rule
+	JWKSReachable(*endpointmanager.JWKSInfo) endpointmanager.Rule
+	JWKSKeyID(*endpointmanager.JWKSInfo) endpointmanager.Rule
+	JWKSKeyStrength(*endpointmanager.JWKSInfo) endpointmanager.Rule
+	JWKSPrivateKey(*endpointmanager.JWKSInfo) endpointmanager.Rule
+	RunAuthServerValidation(*endpointmanager.AuthServerMetadata, capabilityparser.CapabilityStatement, smartparser.SMARTResponse) []endpointmanager.Rule
+	TokenEndpointMatch(*endpointmanager.AuthServerMetadata, capabilityparser.CapabilityStatement, smartparser.SMARTResponse) endpointmanager.Rule
+	AuthorizeEndpointMatch(*endpointmanager.AuthServerMetadata, capabilityparser.CapabilityStatement, smartparser.SMARTResponse) endpointmanager.Rule
+	RunUDAPValidation(*endpointmanager.UDAPInfo) []endpointmanager.Rule
+	UDAPRequiredFields(*endpointmanager.UDAPInfo) endpointmanager.Rule
+	UDAPSignedMetadata(*endpointmanager.UDAPInfo) endpointmanager.Rule
+	UDAPSignedEndpoints(*endpointmanager.UDAPInfo) endpointmanager.Rule
+	RunDataExposureValidation([]endpointmanager.DataExposureCheck) []endpointmanager.Rule
+	DataExposure([]endpointmanager.DataExposureCheck) endpointmanager.Rule
+	RunErrorResponseValidation(int, *endpointmanager.ErrorResponse) []endpointmanager.Rule
+	MetadataPublic(int, *endpointmanager.ErrorResponse) endpointmanager.Rule
 }
 
 // ValidatorForFHIRVersion checks the given fhir version and returns the specific validator
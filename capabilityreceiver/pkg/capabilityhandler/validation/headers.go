@@ -0,0 +1,125 @@
+package validation
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+)
+
+// noTLS is the TLS version the capability querier records for endpoints that do not use TLS
+var noTLS = "No TLS"
+
+// RunHeaderValidation runs all of the checks on the headers of the endpoint's capability statement response
+func (bv *baseVal) RunHeaderValidation(headers map[string]string, tlsVersion string, mimeTypes []string) []endpointmanager.Rule {
+	return []endpointmanager.Rule{
+		bv.HSTSHeader(headers, tlsVersion),
+		bv.CORSHeader(headers),
+		bv.ContentTypeMatches(headers, mimeTypes),
+	}
+}
+
+// HSTSHeader checks that the endpoint's response includes a Strict-Transport-Security header with a max-age
+// greater than 0, which tells clients to only connect to the endpoint's host using TLS
+func (bv *baseVal) HSTSHeader(headers map[string]string, tlsVersion string) endpointmanager.Rule {
+	baseComment := "Servers should send a Strict-Transport-Security header with a max-age greater than 0 so that clients only connect to the server using TLS."
+	ruleError := endpointmanager.Rule{
+		RuleName:  endpointmanager.HSTSRule,
+		Valid:     true,
+		Expected:  "max-age > 0",
+		Comment:   baseComment,
+		Reference: "https://www.rfc-editor.org/rfc/rfc6797",
+	}
+
+	if tlsVersion == noTLS {
+		ruleError.Valid = false
+		ruleError.Comment = "The endpoint does not use TLS. " + baseComment
+		return ruleError
+	}
+
+	hsts := headers["Strict-Transport-Security"]
+	ruleError.Actual = hsts
+	if hsts == "" {
+		ruleError.Valid = false
+		ruleError.Comment = "The Strict-Transport-Security header does not exist. " + baseComment
+		return ruleError
+	}
+
+	if hstsMaxAge(hsts) <= 0 {
+		ruleError.Valid = false
+	}
+
+	return ruleError
+}
+
+// hstsMaxAge returns the max-age directive of a Strict-Transport-Security header value, or -1 if the directive
+// does not exist or is not valid
+func hstsMaxAge(hsts string) int {
+	for _, directive := range strings.Split(hsts, ";") {
+		nameValue := strings.SplitN(strings.TrimSpace(directive), "=", 2)
+		if len(nameValue) != 2 || !strings.EqualFold(nameValue[0], "max-age") {
+			continue
+		}
+		maxAge, err := strconv.Atoi(strings.Trim(strings.TrimSpace(nameValue[1]), "\""))
+		if err != nil {
+			return -1
+		}
+		return maxAge
+	}
+	return -1
+}
+
+// CORSHeader checks that the endpoint's response includes an Access-Control-Allow-Origin header, which browser-based
+// SMART apps need in order to read the response
+func (bv *baseVal) CORSHeader(headers map[string]string) endpointmanager.Rule {
+	baseComment := "Servers should support CORS so that browser-based SMART apps can make requests to the server."
+	ruleError := endpointmanager.Rule{
+		RuleName:  endpointmanager.CORSRule,
+		Valid:     true,
+		Expected:  "Access-Control-Allow-Origin",
+		Comment:   baseComment,
+		Reference: "https://fetch.spec.whatwg.org/#http-cors-protocol",
+	}
+
+	allowOrigin := headers["Access-Control-Allow-Origin"]
+	ruleError.Actual = allowOrigin
+	if allowOrigin == "" {
+		ruleError.Valid = false
+		ruleError.Comment = "The Access-Control-Allow-Origin header does not exist. " + baseComment
+	}
+
+	return ruleError
+}
+
+// ContentTypeMatches checks that the Content-Type of the endpoint's response is the FHIR MIME type that was
+// negotiated with the endpoint
+func (bv *baseVal) ContentTypeMatches(headers map[string]string, mimeTypes []string) endpointmanager.Rule {
+	baseComment := "The Content-Type of the response should be the FHIR MIME type that was requested in the Accept header."
+	ruleError := endpointmanager.Rule{
+		RuleName:  endpointmanager.ContentTypeRule,
+		Valid:     true,
+		Comment:   baseComment,
+		Reference: "http://hl7.org/fhir/http.html#mime-type",
+	}
+
+	if len(mimeTypes) != 1 {
+		ruleError.Valid = false
+		ruleError.Comment = "A FHIR MIME type was not negotiated with the endpoint. " + baseComment
+		return ruleError
+	}
+	ruleError.Expected = mimeTypes[0]
+
+	contentType := headers["Content-Type"]
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	ruleError.Actual = mediaType
+	if contentType == "" {
+		ruleError.Valid = false
+		ruleError.Comment = "The Content-Type header does not exist. " + baseComment
+	} else if mediaType != mimeTypes[0] {
+		ruleError.Valid = false
+		ruleError.Comment = fmt.Sprintf("The Content-Type of the response is %s. ", mediaType) + baseComment
+	}
+
+	return ruleError
+}
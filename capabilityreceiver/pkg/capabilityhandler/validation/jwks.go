@@ -0,0 +1,156 @@
+package validation
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+)
+
+var jwksReference = "https://www.rfc-editor.org/rfc/rfc7517"
+
+// RunJWKSValidation runs all of the checks on the key set published at the jwks_uri of the endpoint's SMART
+// configuration
+func (bv *baseVal) RunJWKSValidation(jwksInfo *endpointmanager.JWKSInfo) []endpointmanager.Rule {
+	return []endpointmanager.Rule{
+		bv.JWKSReachable(jwksInfo),
+		bv.JWKSKeyID(jwksInfo),
+		bv.JWKSKeyStrength(jwksInfo),
+		bv.JWKSPrivateKey(jwksInfo),
+	}
+}
+
+// jwksKeys returns whether the key set was retrieved, and sets ruleError to invalid with a comment explaining why
+// the keys could not be checked if it was not
+func jwksKeys(jwksInfo *endpointmanager.JWKSInfo, ruleError *endpointmanager.Rule) bool {
+	if jwksInfo == nil || jwksInfo.Error != "" {
+		ruleError.Valid = false
+		ruleError.Comment = "The JWKS could not be retrieved; cannot check its keys. " + ruleError.Comment
+		return false
+	}
+	return true
+}
+
+// JWKSReachable checks that the jwks_uri advertised in the SMART configuration returns a key set with at least one key
+func (bv *baseVal) JWKSReachable(jwksInfo *endpointmanager.JWKSInfo) endpointmanager.Rule {
+	baseComment := "The jwks_uri in the SMART configuration should return a JSON Web Key Set with the server's public keys."
+	ruleError := endpointmanager.Rule{
+		RuleName:  endpointmanager.JWKSReachableRule,
+		Valid:     true,
+		Expected:  "true",
+		Actual:    "true",
+		Comment:   baseComment,
+		Reference: smartConformanceReference,
+		ImplGuide: smartImplGuide,
+	}
+
+	if jwksInfo == nil {
+		ruleError.Valid = false
+		ruleError.Actual = "false"
+		ruleError.Comment = "The JWKS information does not exist. " + baseComment
+		return ruleError
+	}
+	if jwksInfo.Error != "" {
+		ruleError.Valid = false
+		ruleError.Actual = "false"
+		ruleError.Comment = "The JWKS could not be retrieved. " + baseComment
+	} else if len(jwksInfo.Keys) == 0 {
+		ruleError.Valid = false
+		ruleError.Actual = "false"
+		ruleError.Comment = "The JWKS does not include any keys. " + baseComment
+	}
+
+	return ruleError
+}
+
+// JWKSKeyID checks that every key in the key set has a kid, which clients need in order to pick the key that
+// verifies a signature when the set has more than one key or when keys are rotated
+func (bv *baseVal) JWKSKeyID(jwksInfo *endpointmanager.JWKSInfo) endpointmanager.Rule {
+	baseComment := "Each key in the JWKS should include a kid so that clients can select the key that verifies a signature."
+	ruleError := endpointmanager.Rule{
+		RuleName:  endpointmanager.JWKSKeyIDRule,
+		Valid:     true,
+		Expected:  "0",
+		Actual:    "0",
+		Comment:   baseComment,
+		Reference: jwksReference,
+	}
+	if !jwksKeys(jwksInfo, &ruleError) {
+		return ruleError
+	}
+
+	missing := 0
+	for _, key := range jwksInfo.Keys {
+		if key.KeyID == "" {
+			missing++
+		}
+	}
+	ruleError.Actual = fmt.Sprintf("%d", missing)
+	if missing > 0 {
+		ruleError.Valid = false
+		ruleError.Comment = fmt.Sprintf("%d of the %d keys in the JWKS do not include a kid. ", missing, len(jwksInfo.Keys)) + baseComment
+	}
+
+	return ruleError
+}
+
+// JWKSKeyStrength checks that the RSA and EC keys in the key set are at least as strong as the keys required for
+// server certificates
+func (bv *baseVal) JWKSKeyStrength(jwksInfo *endpointmanager.JWKSInfo) endpointmanager.Rule {
+	baseComment := fmt.Sprintf("Keys in the JWKS should be at least %d bits for RSA keys and at least %d bits for EC keys.", minRSAKeySize, minECDSAKeySize)
+	ruleError := endpointmanager.Rule{
+		RuleName:  endpointmanager.JWKSKeyStrengthRule,
+		Valid:     true,
+		Expected:  fmt.Sprintf("RSA %d, EC %d", minRSAKeySize, minECDSAKeySize),
+		Comment:   baseComment,
+		Reference: fhirSecurityReference,
+	}
+	if !jwksKeys(jwksInfo, &ruleError) {
+		return ruleError
+	}
+
+	var weak []string
+	for _, key := range jwksInfo.Keys {
+		if (key.KeyType == "RSA" && key.KeySize < minRSAKeySize) || (key.KeyType == "EC" && key.KeySize < minECDSAKeySize) {
+			weak = append(weak, fmt.Sprintf("%s %d", key.KeyType, key.KeySize))
+		}
+	}
+	if len(weak) > 0 {
+		ruleError.Valid = false
+		ruleError.Actual = strings.Join(weak, ",")
+		ruleError.Comment = fmt.Sprintf("The JWKS includes %d keys that are too small: %s. ", len(weak), strings.Join(weak, ", ")) + baseComment
+	}
+
+	return ruleError
+}
+
+// JWKSPrivateKey checks that the key set only includes public keys. A private or symmetric key in the published
+// set lets anyone sign as the server.
+func (bv *baseVal) JWKSPrivateKey(jwksInfo *endpointmanager.JWKSInfo) endpointmanager.Rule {
+	baseComment := "The JWKS SHALL NOT include private or symmetric key material."
+	ruleError := endpointmanager.Rule{
+		RuleName:  endpointmanager.JWKSPrivateKeyRule,
+		Valid:     true,
+		Expected:  "0",
+		Actual:    "0",
+		Comment:   baseComment,
+		Reference: jwksReference,
+	}
+	if !jwksKeys(jwksInfo, &ruleError) {
+		return ruleError
+	}
+
+	leaked := 0
+	for _, key := range jwksInfo.Keys {
+		if key.HasPrivateKey {
+			leaked++
+		}
+	}
+	ruleError.Actual = fmt.Sprintf("%d", leaked)
+	if leaked > 0 {
+		ruleError.Valid = false
+		ruleError.Comment = fmt.Sprintf("%d of the %d keys in the JWKS include private or symmetric key material. ", leaked, len(jwksInfo.Keys)) + baseComment
+	}
+
+	return ruleError
+}
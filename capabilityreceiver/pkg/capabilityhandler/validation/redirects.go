@@ -0,0 +1,150 @@
+package validation
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+	"golang.org/x/net/publicsuffix"
+)
+
+// RunRedirectValidation runs all of the checks on the redirects followed while requesting the endpoint's
+// capability statement
+func (bv *baseVal) RunRedirectValidation(hops []endpointmanager.RedirectHop) []endpointmanager.Rule {
+	return []endpointmanager.Rule{
+		bv.RedirectDowngrade(hops),
+		bv.RedirectCrossDomain(hops),
+		bv.RedirectLoop(hops),
+	}
+}
+
+// RedirectDowngrade checks that none of the endpoint's redirects send the client from https to http, which would
+// expose the request and response to anyone on the network
+func (bv *baseVal) RedirectDowngrade(hops []endpointmanager.RedirectHop) endpointmanager.Rule {
+	baseComment := "Servers should not redirect requests from HTTPS to HTTP."
+	ruleError := endpointmanager.Rule{
+		RuleName:  endpointmanager.RedirectDowngradeRule,
+		Valid:     true,
+		Expected:  "https",
+		Comment:   baseComment,
+		Reference: "https://www.rfc-editor.org/rfc/rfc9110#section-17.3",
+	}
+
+	for _, hop := range hops {
+		target := redirectTarget(hop)
+		if target == nil {
+			continue
+		}
+		if strings.EqualFold(hop.Scheme, "https") && strings.EqualFold(target.Scheme, "http") {
+			ruleError.Valid = false
+			ruleError.Actual = target.String()
+			ruleError.Comment = fmt.Sprintf("%s redirects to %s. ", hop.URL, target.String()) + baseComment
+			return ruleError
+		}
+	}
+
+	return ruleError
+}
+
+// RedirectCrossDomain checks that the endpoint's redirects stay within the endpoint's domain. A redirect to another
+// domain sends the client, and any credentials it includes, to a server that was not listed for the endpoint.
+func (bv *baseVal) RedirectCrossDomain(hops []endpointmanager.RedirectHop) endpointmanager.Rule {
+	baseComment := "Servers should not redirect requests for the FHIR endpoint to a different domain."
+	ruleError := endpointmanager.Rule{
+		RuleName: endpointmanager.RedirectCrossDomainRule,
+		Valid:    true,
+		Comment:  baseComment,
+	}
+	if len(hops) == 0 {
+		return ruleError
+	}
+
+	start, err := url.Parse(hops[0].URL)
+	if err != nil {
+		return ruleError
+	}
+	ruleError.Expected = start.Hostname()
+
+	for _, hop := range hops {
+		target := redirectTarget(hop)
+		if target == nil {
+			continue
+		}
+		if !sameDomain(start.Hostname(), target.Hostname()) {
+			ruleError.Valid = false
+			ruleError.Actual = target.Hostname()
+			ruleError.Comment = fmt.Sprintf("%s redirects to %s. ", hop.URL, target.String()) + baseComment
+			return ruleError
+		}
+	}
+
+	return ruleError
+}
+
+// RedirectLoop checks that none of the endpoint's redirects send the client back to a URL it already requested
+func (bv *baseVal) RedirectLoop(hops []endpointmanager.RedirectHop) endpointmanager.Rule {
+	baseComment := "Servers should not redirect requests back to a URL that was already requested."
+	ruleError := endpointmanager.Rule{
+		RuleName: endpointmanager.RedirectLoopRule,
+		Valid:    true,
+		Comment:  baseComment,
+	}
+
+	visited := make(map[string]bool)
+	for _, hop := range hops {
+		visited[hop.URL] = true
+		target := redirectTarget(hop)
+		if target == nil {
+			continue
+		}
+		if visited[target.String()] {
+			ruleError.Valid = false
+			ruleError.Actual = target.String()
+			ruleError.Comment = fmt.Sprintf("%s redirects to %s, which was already requested. ", hop.URL, target.String()) + baseComment
+			return ruleError
+		}
+	}
+
+	return ruleError
+}
+
+// redirectTarget resolves a redirect's Location, which may be relative, against the URL that sent it. It returns
+// nil if either URL is not valid.
+func redirectTarget(hop endpointmanager.RedirectHop) *url.URL {
+	from, err := url.Parse(hop.URL)
+	if err != nil {
+		return nil
+	}
+	location, err := url.Parse(hop.Location)
+	if err != nil {
+		return nil
+	}
+	return from.ResolveReference(location)
+}
+
+// sameDomain checks whether two hosts belong to the same domain. The domain is the host's public suffix plus one
+// label, so www.example.com and fhir.example.com are the same domain but a.example.co.uk and b.other.co.uk are
+// not; IP addresses must match exactly.
+func sameDomain(host1 string, host2 string) bool {
+	host1 = strings.TrimSuffix(strings.ToLower(host1), ".")
+	host2 = strings.TrimSuffix(strings.ToLower(host2), ".")
+	if host1 == host2 {
+		return true
+	}
+	if net.ParseIP(host1) != nil || net.ParseIP(host2) != nil {
+		return false
+	}
+	return baseDomain(host1) == baseDomain(host2)
+}
+
+// baseDomain returns the registrable domain of host. A host that is itself a public suffix, or that is not
+// a domain name, is its own domain.
+func baseDomain(host string) string {
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return domain
+}
@@ -0,0 +1,260 @@
+package validation
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/smartparser"
+)
+
+var smartConformanceReference = "https://hl7.org/fhir/smart-app-launch/conformance.html"
+var smartScopesReference = "https://hl7.org/fhir/smart-app-launch/scopes-and-launch-context.html"
+var smartImplGuide = "SMART App Launch 2.0"
+
+// v2ScopePattern matches SMART v2 clinical data scopes such as patient/Observation.rs, which use the c, r, u, d,
+// and s permissions in place of the v1 read and write permissions
+var v2ScopePattern = regexp.MustCompile(`^(patient|user|system)/(\*|[A-Za-z]+)\.(c?r?u?d?s?)(\?.*)?$`)
+
+// isV2Scope returns whether the scope is a SMART v2 clinical data scope
+func isV2Scope(scope string) bool {
+	match := v2ScopePattern.FindStringSubmatch(scope)
+	return match != nil && match[3] != ""
+}
+
+// RunSMARTValidation runs all of the SMART App Launch 2.x checks on the endpoint's SMART configuration
+func (bv *baseVal) RunSMARTValidation(smartRsp smartparser.SMARTResponse) []endpointmanager.Rule {
+	return []endpointmanager.Rule{
+		bv.SMARTRequiredFields(smartRsp),
+		bv.SMARTPKCE(smartRsp),
+		bv.SMARTLaunchContext(smartRsp),
+		bv.SMARTPermissionV2(smartRsp),
+		bv.SMARTEndpointsHTTPS(smartRsp),
+	}
+}
+
+// smartConfiguration returns the typed SMART configuration, or sets ruleError to invalid with a comment explaining
+// why the configuration could not be checked
+func smartConfiguration(smartRsp smartparser.SMARTResponse, ruleError *endpointmanager.Rule) *smartparser.SMARTConfiguration {
+	if smartRsp == nil {
+		ruleError.Valid = false
+		ruleError.Comment = "The SMART Response does not exist; cannot check the SMART configuration. " + ruleError.Comment
+		return nil
+	}
+	config, err := smartRsp.GetConfiguration()
+	if err != nil {
+		ruleError.Valid = false
+		ruleError.Comment = "The SMART Response could not be parsed; cannot check the SMART configuration. " + ruleError.Comment
+		return nil
+	}
+	return config
+}
+
+// SMARTRequiredFields checks that the SMART configuration includes the fields that SMART App Launch 2.x requires,
+// including the fields that are only required when a capability is listed
+func (bv *baseVal) SMARTRequiredFields(smartRsp smartparser.SMARTResponse) endpointmanager.Rule {
+	baseComment := "The SMART configuration SHALL include token_endpoint, capabilities, grant_types_supported, and code_challenge_methods_supported, as well as authorization_endpoint when a launch capability is listed and issuer and jwks_uri when sso-openid-connect is listed."
+	ruleError := endpointmanager.Rule{
+		RuleName:  endpointmanager.SMARTRequiredFieldsRule,
+		Valid:     true,
+		Comment:   baseComment,
+		Reference: smartConformanceReference,
+		ImplGuide: smartImplGuide,
+	}
+	config := smartConfiguration(smartRsp, &ruleError)
+	if config == nil {
+		return ruleError
+	}
+
+	required := []string{"token_endpoint", "capabilities", "grant_types_supported", "code_challenge_methods_supported"}
+	var missing []string
+	if config.TokenEndpoint == "" {
+		missing = append(missing, "token_endpoint")
+	}
+	if config.Capabilities == nil {
+		missing = append(missing, "capabilities")
+	}
+	if config.GrantTypesSupported == nil {
+		missing = append(missing, "grant_types_supported")
+	}
+	if config.CodeChallengeMethodsSupported == nil {
+		missing = append(missing, "code_challenge_methods_supported")
+	}
+	if config.HasCapability("launch-ehr") || config.HasCapability("launch-standalone") {
+		required = append(required, "authorization_endpoint")
+		if config.AuthorizationEndpoint == "" {
+			missing = append(missing, "authorization_endpoint")
+		}
+	}
+	if config.HasCapability("sso-openid-connect") {
+		required = append(required, "issuer", "jwks_uri")
+		if config.Issuer == "" {
+			missing = append(missing, "issuer")
+		}
+		if config.JWKSURI == "" {
+			missing = append(missing, "jwks_uri")
+		}
+	}
+
+	ruleError.Expected = strings.Join(required, ",")
+	if len(missing) > 0 {
+		ruleError.Valid = false
+		ruleError.Actual = strings.Join(missing, ",")
+		ruleError.Comment = fmt.Sprintf("The SMART configuration is missing %s. ", strings.Join(missing, ", ")) + baseComment
+	}
+
+	return ruleError
+}
+
+// SMARTPKCE checks that the server supports PKCE with the S256 code challenge method and does not allow the plain
+// method, which offers no protection against an intercepted authorization code
+func (bv *baseVal) SMARTPKCE(smartRsp smartparser.SMARTResponse) endpointmanager.Rule {
+	baseComment := "Servers SHALL support the S256 code_challenge_method and SHALL NOT support the plain method."
+	ruleError := endpointmanager.Rule{
+		RuleName:  endpointmanager.SMARTPKCERule,
+		Valid:     true,
+		Expected:  "S256",
+		Comment:   baseComment,
+		Reference: smartConformanceReference,
+		ImplGuide: smartImplGuide,
+	}
+	config := smartConfiguration(smartRsp, &ruleError)
+	if config == nil {
+		return ruleError
+	}
+
+	ruleError.Actual = strings.Join(config.CodeChallengeMethodsSupported, ",")
+	if !config.SupportsCodeChallengeMethod("S256") || config.SupportsCodeChallengeMethod("plain") {
+		ruleError.Valid = false
+	}
+
+	return ruleError
+}
+
+// SMARTLaunchContext checks that the launch capabilities are consistent with each other and with the rest of the
+// SMART configuration. Launch context capabilities require the matching launch capability, and the launch
+// capabilities require the authorization code grant.
+func (bv *baseVal) SMARTLaunchContext(smartRsp smartparser.SMARTResponse) endpointmanager.Rule {
+	baseComment := "The context-ehr capabilities require launch-ehr, the context-standalone capabilities require launch-standalone, and both launch capabilities require an authorization_endpoint and the authorization_code grant type."
+	ruleError := endpointmanager.Rule{
+		RuleName:  endpointmanager.SMARTLaunchContextRule,
+		Valid:     true,
+		Comment:   baseComment,
+		Reference: smartScopesReference,
+		ImplGuide: smartImplGuide,
+	}
+	config := smartConfiguration(smartRsp, &ruleError)
+	if config == nil {
+		return ruleError
+	}
+
+	var problems []string
+	for _, capability := range config.Capabilities {
+		if strings.HasPrefix(capability, "context-ehr-") && !config.HasCapability("launch-ehr") {
+			problems = append(problems, capability+" without launch-ehr")
+		}
+		if strings.HasPrefix(capability, "context-standalone-") && !config.HasCapability("launch-standalone") {
+			problems = append(problems, capability+" without launch-standalone")
+		}
+	}
+	if config.HasCapability("launch-ehr") || config.HasCapability("launch-standalone") {
+		if config.AuthorizationEndpoint == "" {
+			problems = append(problems, "launch without authorization_endpoint")
+		}
+		if config.GrantTypesSupported != nil && !config.SupportsGrantType("authorization_code") {
+			problems = append(problems, "launch without authorization_code grant type")
+		}
+	}
+
+	if len(problems) > 0 {
+		ruleError.Valid = false
+		ruleError.Actual = strings.Join(problems, ",")
+		ruleError.Comment = fmt.Sprintf("The SMART configuration lists %s. ", strings.Join(problems, ", ")) + baseComment
+	}
+
+	return ruleError
+}
+
+// SMARTPermissionV2 checks that servers listing the permission-v2 capability advertise v2 scopes, and that servers
+// advertising v2 scopes list the permission-v2 capability
+func (bv *baseVal) SMARTPermissionV2(smartRsp smartparser.SMARTResponse) endpointmanager.Rule {
+	baseComment := "Servers that support SMART v2 scopes SHALL list the permission-v2 capability, and servers listing permission-v2 should include v2 scopes in scopes_supported."
+	ruleError := endpointmanager.Rule{
+		RuleName:  endpointmanager.SMARTPermissionV2Rule,
+		Valid:     true,
+		Comment:   baseComment,
+		Reference: smartScopesReference,
+		ImplGuide: smartImplGuide,
+	}
+	config := smartConfiguration(smartRsp, &ruleError)
+	if config == nil {
+		return ruleError
+	}
+
+	v2Scopes := 0
+	for _, scope := range config.ScopesSupported {
+		if isV2Scope(scope) {
+			v2Scopes++
+		}
+	}
+	permissionV2 := config.HasCapability("permission-v2")
+
+	ruleError.Expected = fmt.Sprintf("%t", v2Scopes > 0)
+	ruleError.Actual = fmt.Sprintf("%t", permissionV2)
+	if permissionV2 && config.ScopesSupported != nil && v2Scopes == 0 {
+		ruleError.Valid = false
+		ruleError.Expected = "v2 scopes"
+		ruleError.Actual = "no v2 scopes"
+		ruleError.Comment = "The SMART configuration lists permission-v2 but scopes_supported does not include any v2 scopes. " + baseComment
+	} else if !permissionV2 && v2Scopes > 0 {
+		ruleError.Valid = false
+		ruleError.Comment = fmt.Sprintf("The SMART configuration includes %d v2 scopes but does not list permission-v2. ", v2Scopes) + baseComment
+	}
+
+	return ruleError
+}
+
+// SMARTEndpointsHTTPS checks that every endpoint listed in the SMART configuration is an absolute https URL
+func (bv *baseVal) SMARTEndpointsHTTPS(smartRsp smartparser.SMARTResponse) endpointmanager.Rule {
+	baseComment := "The endpoints in the SMART configuration SHALL be absolute URLs that use TLS."
+	ruleError := endpointmanager.Rule{
+		RuleName:  endpointmanager.SMARTEndpointsHTTPSRule,
+		Valid:     true,
+		Expected:  "https",
+		Comment:   baseComment,
+		Reference: smartConformanceReference,
+		ImplGuide: smartImplGuide,
+	}
+	config := smartConfiguration(smartRsp, &ruleError)
+	if config == nil {
+		return ruleError
+	}
+
+	endpoints := []struct {
+		name  string
+		value string
+	}{
+		{"jwks_uri", config.JWKSURI},
+		{"authorization_endpoint", config.AuthorizationEndpoint},
+		{"token_endpoint", config.TokenEndpoint},
+		{"registration_endpoint", config.RegistrationEndpoint},
+		{"introspection_endpoint", config.IntrospectionEndpoint},
+		{"revocation_endpoint", config.RevocationEndpoint},
+	}
+	for _, endpoint := range endpoints {
+		if endpoint.value == "" {
+			continue
+		}
+		parsed, err := url.Parse(endpoint.value)
+		if err != nil || !strings.EqualFold(parsed.Scheme, "https") || parsed.Host == "" {
+			ruleError.Valid = false
+			ruleError.Actual = endpoint.value
+			ruleError.Comment = fmt.Sprintf("The %s %s is not an absolute https URL. ", endpoint.name, endpoint.value) + baseComment
+			return ruleError
+		}
+	}
+
+	return ruleError
+}
@@ -0,0 +1,214 @@
+package validation
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+)
+
+var udapDiscoveryReference = "https://hl7.org/fhir/us/udap-security/STU1/discovery.html"
+var udapImplGuide = "UDAP Security STU1"
+
+// maxSignedMetadataLifetime is the longest that signed_metadata may be valid for after it is issued
+var maxSignedMetadataLifetime = 365 * 24 * time.Hour
+
+// RunUDAPValidation runs all of the checks on the UDAP metadata published at /.well-known/udap
+func (bv *baseVal) RunUDAPValidation(udapInfo *endpointmanager.UDAPInfo) []endpointmanager.Rule {
+	return []endpointmanager.Rule{
+		bv.UDAPRequiredFields(udapInfo),
+		bv.UDAPSignedMetadata(udapInfo),
+		bv.UDAPSignedEndpoints(udapInfo),
+	}
+}
+
+// udapMetadata returns whether the UDAP metadata was retrieved, and sets ruleError to invalid with a comment
+// explaining why the metadata could not be checked if it was not
+func udapMetadata(udapInfo *endpointmanager.UDAPInfo, ruleError *endpointmanager.Rule) bool {
+	if udapInfo == nil || udapInfo.Error != "" {
+		ruleError.Valid = false
+		ruleError.Comment = "The UDAP metadata could not be retrieved; cannot check it. " + ruleError.Comment
+		return false
+	}
+	return true
+}
+
+// UDAPRequiredFields checks that the UDAP metadata includes the fields that are required for all servers, as well as
+// the fields that are required by the grant types, authorization extensions and certifications it lists
+func (bv *baseVal) UDAPRequiredFields(udapInfo *endpointmanager.UDAPInfo) endpointmanager.Rule {
+	baseComment := "The UDAP metadata SHALL include udap_versions_supported with version 1, udap_profiles_supported, udap_authorization_extensions_supported, udap_certifications_supported, grant_types_supported, token_endpoint, token_endpoint_auth_methods_supported with private_key_jwt, token_endpoint_auth_signing_alg_values_supported, registration_endpoint, registration_endpoint_jwt_signing_alg_values_supported and signed_metadata."
+	ruleError := endpointmanager.Rule{
+		RuleName:  endpointmanager.UDAPRequiredFieldsRule,
+		Valid:     true,
+		Comment:   baseComment,
+		Reference: udapDiscoveryReference,
+		ImplGuide: udapImplGuide,
+	}
+	if !udapMetadata(udapInfo, &ruleError) {
+		return ruleError
+	}
+
+	var missing []string
+	listFields := []struct {
+		name  string
+		value []string
+	}{
+		{"udap_versions_supported", udapInfo.VersionsSupported},
+		{"udap_profiles_supported", udapInfo.ProfilesSupported},
+		{"udap_authorization_extensions_supported", udapInfo.AuthorizationExtensionsSupported},
+		{"udap_certifications_supported", udapInfo.CertificationsSupported},
+		{"grant_types_supported", udapInfo.GrantTypesSupported},
+		{"token_endpoint_auth_methods_supported", udapInfo.TokenEndpointAuthMethodsSupported},
+		{"token_endpoint_auth_signing_alg_values_supported", udapInfo.TokenEndpointAuthSigningAlgs},
+		{"registration_endpoint_jwt_signing_alg_values_supported", udapInfo.RegistrationSigningAlgs},
+	}
+	for _, field := range listFields {
+		if field.value == nil {
+			missing = append(missing, field.name)
+		}
+	}
+	if udapInfo.TokenEndpoint == "" {
+		missing = append(missing, "token_endpoint")
+	}
+	if udapInfo.RegistrationEndpoint == "" {
+		missing = append(missing, "registration_endpoint")
+	}
+	if udapInfo.SignedMetadata == nil {
+		missing = append(missing, "signed_metadata")
+	}
+	if stringInList("authorization_code", udapInfo.GrantTypesSupported) && udapInfo.AuthorizationEndpoint == "" {
+		missing = append(missing, "authorization_endpoint")
+	}
+	if len(udapInfo.AuthorizationExtensionsSupported) > 0 && udapInfo.AuthorizationExtensionsRequired == nil {
+		missing = append(missing, "udap_authorization_extensions_required")
+	}
+	if len(udapInfo.CertificationsSupported) > 0 && udapInfo.CertificationsRequired == nil {
+		missing = append(missing, "udap_certifications_required")
+	}
+
+	var problems []string
+	if len(missing) > 0 {
+		problems = append(problems, "missing "+strings.Join(missing, ", "))
+	}
+	if udapInfo.VersionsSupported != nil && !stringInList("1", udapInfo.VersionsSupported) {
+		problems = append(problems, "udap_versions_supported without version 1")
+	}
+	if udapInfo.TokenEndpointAuthMethodsSupported != nil && !stringInList("private_key_jwt", udapInfo.TokenEndpointAuthMethodsSupported) {
+		problems = append(problems, "token_endpoint_auth_methods_supported without private_key_jwt")
+	}
+
+	ruleError.Actual = strings.Join(missing, ",")
+	if len(problems) > 0 {
+		ruleError.Valid = false
+		ruleError.Comment = fmt.Sprintf("The UDAP metadata has %s. ", strings.Join(problems, "; ")) + baseComment
+	}
+
+	return ruleError
+}
+
+// UDAPSignedMetadata checks that the signed_metadata JWT is signed by its certificate, identifies the FHIR server
+// as both its issuer and subject, is issued for a URI in its certificate's subject alternative names, and has not
+// expired. The certificate chain is not checked against a trust anchor.
+func (bv *baseVal) UDAPSignedMetadata(udapInfo *endpointmanager.UDAPInfo) endpointmanager.Rule {
+	baseComment := "The signed_metadata SHALL be a JWT signed by the first certificate in its x5c header, with iss and sub set to the FHIR server's base URL, an iss that matches a URI subject alternative name of the certificate, and an exp no more than a year after its iat."
+	ruleError := endpointmanager.Rule{
+		RuleName:  endpointmanager.UDAPSignedMetadataRule,
+		Valid:     true,
+		Expected:  "valid",
+		Actual:    "valid",
+		Comment:   baseComment,
+		Reference: udapDiscoveryReference,
+		ImplGuide: udapImplGuide,
+	}
+	if !udapMetadata(udapInfo, &ruleError) {
+		return ruleError
+	}
+
+	signedMetadata := udapInfo.SignedMetadata
+	if signedMetadata == nil {
+		ruleError.Valid = false
+		ruleError.Actual = "missing"
+		ruleError.Comment = "The UDAP metadata does not include signed_metadata. " + baseComment
+		return ruleError
+	}
+
+	var problems []string
+	if !signedMetadata.SignatureValid {
+		problems = append(problems, "a signature that could not be verified")
+	}
+	baseURL := strings.TrimSuffix(strings.TrimSuffix(udapInfo.URL, "/"), "/.well-known/udap")
+	if strings.TrimSuffix(signedMetadata.Issuer, "/") != strings.TrimSuffix(baseURL, "/") {
+		problems = append(problems, "an iss that is not the FHIR server's base URL")
+	}
+	if signedMetadata.Subject != signedMetadata.Issuer {
+		problems = append(problems, "a sub that does not match its iss")
+	}
+	if signedMetadata.SignatureValid && !stringInList(signedMetadata.Issuer, signedMetadata.LeafSANURIs) {
+		problems = append(problems, "an iss that is not a URI subject alternative name of its certificate")
+	}
+	if signedMetadata.IssuedAt.IsZero() || signedMetadata.ExpiresAt.IsZero() {
+		problems = append(problems, "a missing iat or exp")
+	} else {
+		if signedMetadata.ExpiresAt.Before(time.Now()) {
+			problems = append(problems, "an exp that has passed")
+		}
+		if signedMetadata.ExpiresAt.Sub(signedMetadata.IssuedAt) > maxSignedMetadataLifetime {
+			problems = append(problems, "an exp more than a year after its iat")
+		}
+	}
+
+	if len(problems) > 0 {
+		ruleError.Valid = false
+		ruleError.Actual = "invalid"
+		ruleError.Comment = fmt.Sprintf("The signed_metadata has %s. ", strings.Join(problems, ", ")) + baseComment
+	}
+
+	return ruleError
+}
+
+// UDAPSignedEndpoints checks that the endpoints in the signed_metadata claims match the endpoints in the
+// unsigned UDAP metadata, since clients are required to use the signed values
+func (bv *baseVal) UDAPSignedEndpoints(udapInfo *endpointmanager.UDAPInfo) endpointmanager.Rule {
+	baseComment := "The authorization_endpoint, token_endpoint and registration_endpoint in the signed_metadata SHALL match the values in the UDAP metadata."
+	ruleError := endpointmanager.Rule{
+		RuleName:  endpointmanager.UDAPSignedEndpointsRule,
+		Valid:     true,
+		Comment:   baseComment,
+		Reference: udapDiscoveryReference,
+		ImplGuide: udapImplGuide,
+	}
+	if !udapMetadata(udapInfo, &ruleError) {
+		return ruleError
+	}
+	signedMetadata := udapInfo.SignedMetadata
+	if signedMetadata == nil {
+		ruleError.Valid = false
+		ruleError.Comment = "The UDAP metadata does not include signed_metadata. " + baseComment
+		return ruleError
+	}
+
+	endpoints := []struct {
+		name     string
+		unsigned string
+		signed   string
+	}{
+		{"authorization_endpoint", udapInfo.AuthorizationEndpoint, signedMetadata.AuthorizationEndpoint},
+		{"token_endpoint", udapInfo.TokenEndpoint, signedMetadata.TokenEndpoint},
+		{"registration_endpoint", udapInfo.RegistrationEndpoint, signedMetadata.RegistrationEndpoint},
+	}
+	var mismatched []string
+	for _, endpoint := range endpoints {
+		if endpoint.unsigned != endpoint.signed {
+			mismatched = append(mismatched, endpoint.name)
+		}
+	}
+
+	ruleError.Actual = strings.Join(mismatched, ",")
+	if len(mismatched) > 0 {
+		ruleError.Valid = false
+		ruleError.Comment = fmt.Sprintf("The signed_metadata %s does not match the UDAP metadata. ", strings.Join(mismatched, ", ")) + baseComment
+	}
+
+	return ruleError
+}
@@ -7,7 +7,9 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/helpers"
 	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/smartparser"
@@ -938,6 +940,989 @@ func Test_VersionResponseValid(t *testing.T) {
 }
 
 // getDSTU2CapStat gets a DSTU2 Capability Statement
+func Test_RunTLSValidation(t *testing.T) {
+	validator := ValidatorForFHIRVersion("4.0.1")
+
+	tlsInfo := getTLSInfo()
+	rules := validator.RunTLSValidation(tlsInfo)
+	th.Assert(t, len(rules) == 4, fmt.Sprintf("expected 4 certificate rules, got %d", len(rules)))
+	for _, rule := range rules {
+		th.Assert(t, rule.Valid, fmt.Sprintf("expected %s to be valid, returned value is instead %+v", rule.RuleName, rule))
+	}
+
+	// the certificate rules do not depend on the FHIR version
+	validator = ValidatorForFHIRVersion("")
+	rules = validator.RunTLSValidation(tlsInfo)
+	th.Assert(t, len(rules) == 4, fmt.Sprintf("expected 4 certificate rules, got %d", len(rules)))
+}
+
+func Test_CertificateExpiration(t *testing.T) {
+	validator := ValidatorForFHIRVersion("4.0.1")
+
+	// base test
+
+	tlsInfo := getTLSInfo()
+	actualVal := validator.CertificateExpiration(tlsInfo)
+	th.Assert(t, actualVal.RuleName == endpointmanager.CertExpirationRule, fmt.Sprintf("expected rule name %s, got %s", endpointmanager.CertExpirationRule, actualVal.RuleName))
+	th.Assert(t, actualVal.Valid, fmt.Sprintf("CertificateExpiration check should be valid, returned value is instead %+v", actualVal))
+	th.Assert(t, actualVal.Actual == "valid", fmt.Sprintf("expected actual value valid, got %s", actualVal.Actual))
+
+	// certificate expires soon
+
+	tlsInfo.NotAfter = time.Now().Add(10 * 24 * time.Hour)
+	actualVal = validator.CertificateExpiration(tlsInfo)
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("CertificateExpiration check should be invalid, returned value is instead %+v", actualVal))
+	th.Assert(t, actualVal.Actual == "expiring soon", fmt.Sprintf("expected actual value expiring soon, got %s", actualVal.Actual))
+
+	// certificate has expired
+
+	tlsInfo.NotAfter = time.Now().Add(-24 * time.Hour)
+	actualVal = validator.CertificateExpiration(tlsInfo)
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("CertificateExpiration check should be invalid, returned value is instead %+v", actualVal))
+	th.Assert(t, actualVal.Actual == "expired", fmt.Sprintf("expected actual value expired, got %s", actualVal.Actual))
+
+	// certificate is not valid yet
+
+	tlsInfo = getTLSInfo()
+	tlsInfo.NotBefore = time.Now().Add(24 * time.Hour)
+	actualVal = validator.CertificateExpiration(tlsInfo)
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("CertificateExpiration check should be invalid, returned value is instead %+v", actualVal))
+	th.Assert(t, actualVal.Actual == "not yet valid", fmt.Sprintf("expected actual value not yet valid, got %s", actualVal.Actual))
+
+	// no TLS info
+
+	actualVal = validator.CertificateExpiration(nil)
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("CertificateExpiration check should be invalid, returned value is instead %+v", actualVal))
+}
+
+func Test_CertificateHostname(t *testing.T) {
+	validator := ValidatorForFHIRVersion("4.0.1")
+
+	// base test
+
+	tlsInfo := getTLSInfo()
+	expectedVal := endpointmanager.Rule{
+		RuleName:  endpointmanager.CertHostnameRule,
+		Valid:     true,
+		Expected:  "true",
+		Actual:    "true",
+		Comment:   "The server certificate must be issued for the host name of the endpoint.",
+		Reference: "https://www.rfc-editor.org/rfc/rfc6125",
+	}
+	actualVal := validator.CertificateHostname(tlsInfo)
+	eq := reflect.DeepEqual(actualVal, expectedVal)
+	th.Assert(t, eq == true, fmt.Sprintf("CertificateHostname check should be valid, returned value is instead %+v", actualVal))
+
+	// hostname does not match
+
+	tlsInfo.HostnameMatch = false
+	expectedVal.Valid = false
+	expectedVal.Actual = "false"
+	expectedVal.Comment = "The server certificate is issued for [example.com www.example.com]. The server certificate must be issued for the host name of the endpoint."
+	actualVal = validator.CertificateHostname(tlsInfo)
+	eq = reflect.DeepEqual(actualVal, expectedVal)
+	th.Assert(t, eq == true, fmt.Sprintf("CertificateHostname check should be invalid, returned value is instead %+v", actualVal))
+}
+
+func Test_CertificateKeyStrength(t *testing.T) {
+	validator := ValidatorForFHIRVersion("4.0.1")
+
+	// base test
+
+	tlsInfo := getTLSInfo()
+	actualVal := validator.CertificateKeyStrength(tlsInfo)
+	th.Assert(t, actualVal.Valid, fmt.Sprintf("CertificateKeyStrength check should be valid, returned value is instead %+v", actualVal))
+	th.Assert(t, actualVal.Actual == "RSA 2048", fmt.Sprintf("expected actual value RSA 2048, got %s", actualVal.Actual))
+
+	// weak RSA key
+
+	tlsInfo.KeySize = 1024
+	actualVal = validator.CertificateKeyStrength(tlsInfo)
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("CertificateKeyStrength check should be invalid, returned value is instead %+v", actualVal))
+
+	// ECDSA keys
+
+	tlsInfo.KeyType = "ECDSA"
+	tlsInfo.KeySize = 256
+	actualVal = validator.CertificateKeyStrength(tlsInfo)
+	th.Assert(t, actualVal.Valid, fmt.Sprintf("CertificateKeyStrength check should be valid, returned value is instead %+v", actualVal))
+
+	tlsInfo.KeySize = 192
+	actualVal = validator.CertificateKeyStrength(tlsInfo)
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("CertificateKeyStrength check should be invalid, returned value is instead %+v", actualVal))
+
+	// unknown key type
+
+	tlsInfo.KeyType = "DSA"
+	actualVal = validator.CertificateKeyStrength(tlsInfo)
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("CertificateKeyStrength check should be invalid, returned value is instead %+v", actualVal))
+}
+
+func Test_CertificateSelfSigned(t *testing.T) {
+	validator := ValidatorForFHIRVersion("4.0.1")
+
+	// base test
+
+	tlsInfo := getTLSInfo()
+	actualVal := validator.CertificateSelfSigned(tlsInfo)
+	th.Assert(t, actualVal.Valid, fmt.Sprintf("CertificateSelfSigned check should be valid, returned value is instead %+v", actualVal))
+
+	// self-signed certificate
+
+	tlsInfo.SelfSigned = true
+	actualVal = validator.CertificateSelfSigned(tlsInfo)
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("CertificateSelfSigned check should be invalid, returned value is instead %+v", actualVal))
+	th.Assert(t, actualVal.Actual == "true", fmt.Sprintf("expected actual value true, got %s", actualVal.Actual))
+}
+
+func Test_RunHeaderValidation(t *testing.T) {
+	validator := ValidatorForFHIRVersion("4.0.1")
+
+	rules := validator.RunHeaderValidation(getResponseHeaders(), "TLS 1.2", []string{"application/fhir+json"})
+	th.Assert(t, len(rules) == 3, fmt.Sprintf("expected 3 header rules, got %d", len(rules)))
+	for _, rule := range rules {
+		th.Assert(t, rule.Valid, fmt.Sprintf("expected %s to be valid, returned value is instead %+v", rule.RuleName, rule))
+	}
+}
+
+func Test_HSTSHeader(t *testing.T) {
+	validator := ValidatorForFHIRVersion("4.0.1")
+
+	// base test
+
+	headers := getResponseHeaders()
+	expectedVal := endpointmanager.Rule{
+		RuleName:  endpointmanager.HSTSRule,
+		Valid:     true,
+		Expected:  "max-age > 0",
+		Actual:    "max-age=31536000; includeSubDomains",
+		Comment:   "Servers should send a Strict-Transport-Security header with a max-age greater than 0 so that clients only connect to the server using TLS.",
+		Reference: "https://www.rfc-editor.org/rfc/rfc6797",
+	}
+	actualVal := validator.HSTSHeader(headers, "TLS 1.2")
+	eq := reflect.DeepEqual(actualVal, expectedVal)
+	th.Assert(t, eq == true, fmt.Sprintf("HSTSHeader check should be valid, returned value is instead %+v", actualVal))
+
+	// max-age of 0 turns HSTS off
+
+	headers["Strict-Transport-Security"] = "max-age=0"
+	actualVal = validator.HSTSHeader(headers, "TLS 1.2")
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("HSTSHeader check should be invalid, returned value is instead %+v", actualVal))
+
+	// no max-age
+
+	headers["Strict-Transport-Security"] = "includeSubDomains"
+	actualVal = validator.HSTSHeader(headers, "TLS 1.2")
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("HSTSHeader check should be invalid, returned value is instead %+v", actualVal))
+
+	// no header
+
+	delete(headers, "Strict-Transport-Security")
+	actualVal = validator.HSTSHeader(headers, "TLS 1.2")
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("HSTSHeader check should be invalid, returned value is instead %+v", actualVal))
+
+	// endpoint does not use TLS
+
+	headers = getResponseHeaders()
+	actualVal = validator.HSTSHeader(headers, "No TLS")
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("HSTSHeader check should be invalid, returned value is instead %+v", actualVal))
+}
+
+func Test_CORSHeader(t *testing.T) {
+	validator := ValidatorForFHIRVersion("4.0.1")
+
+	// base test
+
+	headers := getResponseHeaders()
+	actualVal := validator.CORSHeader(headers)
+	th.Assert(t, actualVal.Valid, fmt.Sprintf("CORSHeader check should be valid, returned value is instead %+v", actualVal))
+	th.Assert(t, actualVal.Actual == "*", fmt.Sprintf("expected actual value *, got %s", actualVal.Actual))
+
+	// no header
+
+	delete(headers, "Access-Control-Allow-Origin")
+	actualVal = validator.CORSHeader(headers)
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("CORSHeader check should be invalid, returned value is instead %+v", actualVal))
+}
+
+func Test_ContentTypeMatches(t *testing.T) {
+	validator := ValidatorForFHIRVersion("4.0.1")
+
+	// base test
+
+	headers := getResponseHeaders()
+	actualVal := validator.ContentTypeMatches(headers, []string{"application/fhir+json"})
+	th.Assert(t, actualVal.Valid, fmt.Sprintf("ContentTypeMatches check should be valid, returned value is instead %+v", actualVal))
+	th.Assert(t, actualVal.Actual == "application/fhir+json", fmt.Sprintf("expected actual value application/fhir+json, got %s", actualVal.Actual))
+
+	// content type does not match the negotiated MIME type
+
+	actualVal = validator.ContentTypeMatches(headers, []string{"application/json+fhir"})
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("ContentTypeMatches check should be invalid, returned value is instead %+v", actualVal))
+
+	// no negotiated MIME type
+
+	actualVal = validator.ContentTypeMatches(headers, []string{})
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("ContentTypeMatches check should be invalid, returned value is instead %+v", actualVal))
+
+	// no header
+
+	delete(headers, "Content-Type")
+	actualVal = validator.ContentTypeMatches(headers, []string{"application/fhir+json"})
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("ContentTypeMatches check should be invalid, returned value is instead %+v", actualVal))
+}
+
+func Test_RunRedirectValidation(t *testing.T) {
+	validator := ValidatorForFHIRVersion("4.0.1")
+
+	rules := validator.RunRedirectValidation(getRedirectChain())
+	th.Assert(t, len(rules) == 3, fmt.Sprintf("expected 3 redirect rules, got %d", len(rules)))
+	for _, rule := range rules {
+		th.Assert(t, rule.Valid, fmt.Sprintf("expected %s to be valid, returned value is instead %+v", rule.RuleName, rule))
+	}
+
+	// no redirects
+
+	rules = validator.RunRedirectValidation([]endpointmanager.RedirectHop{})
+	for _, rule := range rules {
+		th.Assert(t, rule.Valid, fmt.Sprintf("expected %s to be valid without redirects, returned value is instead %+v", rule.RuleName, rule))
+	}
+}
+
+func Test_RedirectDowngrade(t *testing.T) {
+	validator := ValidatorForFHIRVersion("4.0.1")
+
+	// base test
+
+	hops := getRedirectChain()
+	expectedVal := endpointmanager.Rule{
+		RuleName:  endpointmanager.RedirectDowngradeRule,
+		Valid:     true,
+		Expected:  "https",
+		Comment:   "Servers should not redirect requests from HTTPS to HTTP.",
+		Reference: "https://www.rfc-editor.org/rfc/rfc9110#section-17.3",
+	}
+	actualVal := validator.RedirectDowngrade(hops)
+	eq := reflect.DeepEqual(actualVal, expectedVal)
+	th.Assert(t, eq == true, fmt.Sprintf("RedirectDowngrade check should be valid, returned value is instead %+v", actualVal))
+
+	// https to http
+
+	hops[1].Location = "http://fhir.example.com/r4/metadata"
+	actualVal = validator.RedirectDowngrade(hops)
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("RedirectDowngrade check should be invalid, returned value is instead %+v", actualVal))
+	th.Assert(t, actualVal.Actual == "http://fhir.example.com/r4/metadata", fmt.Sprintf("expected actual value http://fhir.example.com/r4/metadata, got %s", actualVal.Actual))
+}
+
+func Test_RedirectCrossDomain(t *testing.T) {
+	validator := ValidatorForFHIRVersion("4.0.1")
+
+	// base test, which redirects to another host in the same domain
+
+	hops := getRedirectChain()
+	actualVal := validator.RedirectCrossDomain(hops)
+	th.Assert(t, actualVal.Valid, fmt.Sprintf("RedirectCrossDomain check should be valid, returned value is instead %+v", actualVal))
+	th.Assert(t, actualVal.Expected == "example.com", fmt.Sprintf("expected expected value example.com, got %s", actualVal.Expected))
+
+	// another domain
+
+	hops[1].Location = "https://fhir.example.org/r4/metadata"
+	actualVal = validator.RedirectCrossDomain(hops)
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("RedirectCrossDomain check should be invalid, returned value is instead %+v", actualVal))
+	th.Assert(t, actualVal.Actual == "fhir.example.org", fmt.Sprintf("expected actual value fhir.example.org, got %s", actualVal.Actual))
+
+	// the domain includes the whole public suffix
+
+	hops = []endpointmanager.RedirectHop{{URL: "https://fhir.example.co.uk/metadata", Scheme: "https", StatusCode: 302, Location: "https://www.example.co.uk/metadata"}}
+	actualVal = validator.RedirectCrossDomain(hops)
+	th.Assert(t, actualVal.Valid, fmt.Sprintf("RedirectCrossDomain check should be valid, returned value is instead %+v", actualVal))
+
+	hops[0].Location = "https://fhir.other.co.uk/metadata"
+	actualVal = validator.RedirectCrossDomain(hops)
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("RedirectCrossDomain check should be invalid, returned value is instead %+v", actualVal))
+
+	// IP addresses must match exactly
+
+	hops = []endpointmanager.RedirectHop{{URL: "http://10.0.0.1/metadata", Scheme: "http", StatusCode: 302, Location: "http://10.0.0.2/metadata"}}
+	actualVal = validator.RedirectCrossDomain(hops)
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("RedirectCrossDomain check should be invalid, returned value is instead %+v", actualVal))
+}
+
+func Test_RedirectLoop(t *testing.T) {
+	validator := ValidatorForFHIRVersion("4.0.1")
+
+	// base test
+
+	hops := getRedirectChain()
+	actualVal := validator.RedirectLoop(hops)
+	th.Assert(t, actualVal.Valid, fmt.Sprintf("RedirectLoop check should be valid, returned value is instead %+v", actualVal))
+
+	// redirect back to the first URL, using a relative Location
+
+	hops[1].Location = "/metadata"
+	hops[1].URL = "https://example.com/r4/metadata"
+	actualVal = validator.RedirectLoop(hops)
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("RedirectLoop check should be invalid, returned value is instead %+v", actualVal))
+	th.Assert(t, actualVal.Actual == "https://example.com/metadata", fmt.Sprintf("expected actual value https://example.com/metadata, got %s", actualVal.Actual))
+}
+
+func Test_RunSMARTValidation(t *testing.T) {
+	validator := ValidatorForFHIRVersion("4.0.1")
+
+	sr, err := getSmartResponse()
+	th.Assert(t, err == nil, err)
+	rules := validator.RunSMARTValidation(sr)
+	th.Assert(t, len(rules) == 5, fmt.Sprintf("expected 5 SMART rules, got %d", len(rules)))
+
+	// the SMART response does not exist
+
+	rules = validator.RunSMARTValidation(nil)
+	for _, rule := range rules {
+		th.Assert(t, !rule.Valid, fmt.Sprintf("expected %s to be invalid without a SMART response, returned value is instead %+v", rule.RuleName, rule))
+	}
+
+	// the SMART response can not be parsed
+
+	rules = validator.RunSMARTValidation(smartparser.NewSMARTRespFromInterface(map[string]interface{}{"capabilities": "launch-ehr"}))
+	for _, rule := range rules {
+		th.Assert(t, !rule.Valid, fmt.Sprintf("expected %s to be invalid for an unparseable SMART response, returned value is instead %+v", rule.RuleName, rule))
+	}
+}
+
+func Test_SMARTRequiredFields(t *testing.T) {
+	validator := ValidatorForFHIRVersion("4.0.1")
+
+	// base test, which is missing grant_types_supported and the jwks_uri required by sso-openid-connect
+
+	srInt := getSmartResponseMap(t)
+	actualVal := validator.SMARTRequiredFields(smartparser.NewSMARTRespFromInterface(srInt))
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("SMARTRequiredFields check should be invalid, returned value is instead %+v", actualVal))
+	th.Assert(t, actualVal.Actual == "grant_types_supported,jwks_uri", fmt.Sprintf("expected actual value grant_types_supported,jwks_uri, got %s", actualVal.Actual))
+	th.Assert(t, actualVal.Expected == "token_endpoint,capabilities,grant_types_supported,code_challenge_methods_supported,authorization_endpoint,issuer,jwks_uri", fmt.Sprintf("unexpected expected value %s", actualVal.Expected))
+
+	// all required fields
+
+	srInt["grant_types_supported"] = []interface{}{"authorization_code"}
+	srInt["jwks_uri"] = "https://authorization.example.com/jwks"
+	actualVal = validator.SMARTRequiredFields(smartparser.NewSMARTRespFromInterface(srInt))
+	th.Assert(t, actualVal.Valid, fmt.Sprintf("SMARTRequiredFields check should be valid, returned value is instead %+v", actualVal))
+
+	// without sso-openid-connect, issuer and jwks_uri are not required
+
+	srInt["capabilities"] = []interface{}{"launch-standalone"}
+	delete(srInt, "issuer")
+	delete(srInt, "jwks_uri")
+	actualVal = validator.SMARTRequiredFields(smartparser.NewSMARTRespFromInterface(srInt))
+	th.Assert(t, actualVal.Valid, fmt.Sprintf("SMARTRequiredFields check should be valid, returned value is instead %+v", actualVal))
+}
+
+func Test_SMARTPKCE(t *testing.T) {
+	validator := ValidatorForFHIRVersion("4.0.1")
+
+	// base test
+
+	srInt := getSmartResponseMap(t)
+	expectedVal := endpointmanager.Rule{
+		RuleName:  endpointmanager.SMARTPKCERule,
+		Valid:     true,
+		Expected:  "S256",
+		Actual:    "S256",
+		Comment:   "Servers SHALL support the S256 code_challenge_method and SHALL NOT support the plain method.",
+		Reference: "https://hl7.org/fhir/smart-app-launch/conformance.html",
+		ImplGuide: "SMART App Launch 2.0",
+	}
+	actualVal := validator.SMARTPKCE(smartparser.NewSMARTRespFromInterface(srInt))
+	eq := reflect.DeepEqual(actualVal, expectedVal)
+	th.Assert(t, eq == true, fmt.Sprintf("SMARTPKCE check should be valid, returned value is instead %+v", actualVal))
+
+	// plain is allowed
+
+	srInt["code_challenge_methods_supported"] = []interface{}{"S256", "plain"}
+	actualVal = validator.SMARTPKCE(smartparser.NewSMARTRespFromInterface(srInt))
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("SMARTPKCE check should be invalid, returned value is instead %+v", actualVal))
+
+	// no code challenge methods
+
+	delete(srInt, "code_challenge_methods_supported")
+	actualVal = validator.SMARTPKCE(smartparser.NewSMARTRespFromInterface(srInt))
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("SMARTPKCE check should be invalid, returned value is instead %+v", actualVal))
+}
+
+func Test_SMARTLaunchContext(t *testing.T) {
+	validator := ValidatorForFHIRVersion("4.0.1")
+
+	// base test
+
+	srInt := getSmartResponseMap(t)
+	actualVal := validator.SMARTLaunchContext(smartparser.NewSMARTRespFromInterface(srInt))
+	th.Assert(t, actualVal.Valid, fmt.Sprintf("SMARTLaunchContext check should be valid, returned value is instead %+v", actualVal))
+
+	// EHR launch context without EHR launch
+
+	srInt["capabilities"] = []interface{}{"launch-standalone", "context-ehr-patient", "context-standalone-patient"}
+	actualVal = validator.SMARTLaunchContext(smartparser.NewSMARTRespFromInterface(srInt))
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("SMARTLaunchContext check should be invalid, returned value is instead %+v", actualVal))
+	th.Assert(t, actualVal.Actual == "context-ehr-patient without launch-ehr", fmt.Sprintf("expected actual value context-ehr-patient without launch-ehr, got %s", actualVal.Actual))
+
+	// launch without the authorization code grant
+
+	srInt["capabilities"] = []interface{}{"launch-standalone"}
+	srInt["grant_types_supported"] = []interface{}{"client_credentials"}
+	actualVal = validator.SMARTLaunchContext(smartparser.NewSMARTRespFromInterface(srInt))
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("SMARTLaunchContext check should be invalid, returned value is instead %+v", actualVal))
+	th.Assert(t, actualVal.Actual == "launch without authorization_code grant type", fmt.Sprintf("expected actual value launch without authorization_code grant type, got %s", actualVal.Actual))
+}
+
+func Test_SMARTPermissionV2(t *testing.T) {
+	validator := ValidatorForFHIRVersion("4.0.1")
+
+	// base test, which lists permission-v2 and includes v2 scopes
+
+	srInt := getSmartResponseMap(t)
+	actualVal := validator.SMARTPermissionV2(smartparser.NewSMARTRespFromInterface(srInt))
+	th.Assert(t, actualVal.Valid, fmt.Sprintf("SMARTPermissionV2 check should be valid, returned value is instead %+v", actualVal))
+
+	// permission-v2 with only v1 scopes
+
+	srInt["scopes_supported"] = []interface{}{"launch", "patient/Observation.read", "patient/*.*"}
+	actualVal = validator.SMARTPermissionV2(smartparser.NewSMARTRespFromInterface(srInt))
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("SMARTPermissionV2 check should be invalid, returned value is instead %+v", actualVal))
+
+	// v2 scopes without permission-v2
+
+	srInt["scopes_supported"] = []interface{}{"patient/Observation.rs", "user/*.cruds"}
+	srInt["capabilities"] = []interface{}{"launch-ehr"}
+	actualVal = validator.SMARTPermissionV2(smartparser.NewSMARTRespFromInterface(srInt))
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("SMARTPermissionV2 check should be invalid, returned value is instead %+v", actualVal))
+}
+
+func Test_isV2Scope(t *testing.T) {
+	v2Scopes := []string{"patient/Observation.rs", "user/*.cruds", "system/Patient.r", "patient/Observation.rs?category=http://terminology.hl7.org/CodeSystem/observation-category|vital-signs"}
+	for _, scope := range v2Scopes {
+		th.Assert(t, isV2Scope(scope), fmt.Sprintf("expected %s to be a v2 scope", scope))
+	}
+	otherScopes := []string{"launch", "openid", "patient/Observation.read", "user/*.*", "patient/Observation.", "patient/Observation.sr"}
+	for _, scope := range otherScopes {
+		th.Assert(t, !isV2Scope(scope), fmt.Sprintf("expected %s not to be a v2 scope", scope))
+	}
+}
+
+func Test_SMARTEndpointsHTTPS(t *testing.T) {
+	validator := ValidatorForFHIRVersion("4.0.1")
+
+	// base test
+
+	srInt := getSmartResponseMap(t)
+	actualVal := validator.SMARTEndpointsHTTPS(smartparser.NewSMARTRespFromInterface(srInt))
+	th.Assert(t, actualVal.Valid, fmt.Sprintf("SMARTEndpointsHTTPS check should be valid, returned value is instead %+v", actualVal))
+
+	// http endpoint
+
+	srInt["token_endpoint"] = "http://authorization.example.com/token"
+	actualVal = validator.SMARTEndpointsHTTPS(smartparser.NewSMARTRespFromInterface(srInt))
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("SMARTEndpointsHTTPS check should be invalid, returned value is instead %+v", actualVal))
+	th.Assert(t, actualVal.Actual == "http://authorization.example.com/token", fmt.Sprintf("expected actual value http://authorization.example.com/token, got %s", actualVal.Actual))
+
+	// relative endpoint
+
+	srInt["token_endpoint"] = "/token"
+	actualVal = validator.SMARTEndpointsHTTPS(smartparser.NewSMARTRespFromInterface(srInt))
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("SMARTEndpointsHTTPS check should be invalid, returned value is instead %+v", actualVal))
+}
+
+// getSmartResponseMap gets the test SMART response as a map so that tests can change its fields
+func getSmartResponseMap(t *testing.T) map[string]interface{} {
+	sr, err := getSmartResponse()
+	th.Assert(t, err == nil, err)
+	srJSON, err := sr.GetJSON()
+	th.Assert(t, err == nil, err)
+	var srInt map[string]interface{}
+	err = json.Unmarshal(srJSON, &srInt)
+	th.Assert(t, err == nil, err)
+	return srInt
+}
+
+func Test_RunJWKSValidation(t *testing.T) {
+	validator := ValidatorForFHIRVersion("4.0.1")
+
+	rules := validator.RunJWKSValidation(getJWKSInfo())
+	th.Assert(t, len(rules) == 4, fmt.Sprintf("expected 4 JWKS rules, got %d", len(rules)))
+	for _, rule := range rules {
+		th.Assert(t, rule.Valid, fmt.Sprintf("expected %s to be valid, returned value is instead %+v", rule.RuleName, rule))
+	}
+
+	// the key set could not be retrieved
+
+	jwksInfo := &endpointmanager.JWKSInfo{URL: "https://example.com/jwks", HTTPResponse: 404, Error: "the JWKS URI returned HTTP status 404"}
+	rules = validator.RunJWKSValidation(jwksInfo)
+	for _, rule := range rules {
+		th.Assert(t, !rule.Valid, fmt.Sprintf("expected %s to be invalid for an unreachable JWKS, returned value is instead %+v", rule.RuleName, rule))
+	}
+}
+
+func Test_JWKSReachable(t *testing.T) {
+	validator := ValidatorForFHIRVersion("4.0.1")
+
+	// base test
+
+	expectedVal := endpointmanager.Rule{
+		RuleName:  endpointmanager.JWKSReachableRule,
+		Valid:     true,
+		Expected:  "true",
+		Actual:    "true",
+		Comment:   "The jwks_uri in the SMART configuration should return a JSON Web Key Set with the server's public keys.",
+		Reference: "https://hl7.org/fhir/smart-app-launch/conformance.html",
+		ImplGuide: "SMART App Launch 2.0",
+	}
+	actualVal := validator.JWKSReachable(getJWKSInfo())
+	eq := reflect.DeepEqual(actualVal, expectedVal)
+	th.Assert(t, eq == true, fmt.Sprintf("JWKSReachable check should be valid, returned value is instead %+v", actualVal))
+
+	// no keys
+
+	jwksInfo := getJWKSInfo()
+	jwksInfo.Keys = []endpointmanager.JWK{}
+	actualVal = validator.JWKSReachable(jwksInfo)
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("JWKSReachable check should be invalid, returned value is instead %+v", actualVal))
+
+	// unreachable
+
+	jwksInfo = &endpointmanager.JWKSInfo{URL: "https://example.com/jwks", Error: "making the GET request to https://example.com/jwks failed"}
+	actualVal = validator.JWKSReachable(jwksInfo)
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("JWKSReachable check should be invalid, returned value is instead %+v", actualVal))
+	th.Assert(t, actualVal.Actual == "false", fmt.Sprintf("expected actual value false, got %s", actualVal.Actual))
+}
+
+func Test_JWKSKeyID(t *testing.T) {
+	validator := ValidatorForFHIRVersion("4.0.1")
+
+	jwksInfo := getJWKSInfo()
+	actualVal := validator.JWKSKeyID(jwksInfo)
+	th.Assert(t, actualVal.Valid, fmt.Sprintf("JWKSKeyID check should be valid, returned value is instead %+v", actualVal))
+
+	jwksInfo.Keys[1].KeyID = ""
+	actualVal = validator.JWKSKeyID(jwksInfo)
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("JWKSKeyID check should be invalid, returned value is instead %+v", actualVal))
+	th.Assert(t, actualVal.Actual == "1", fmt.Sprintf("expected actual value 1, got %s", actualVal.Actual))
+}
+
+func Test_JWKSKeyStrength(t *testing.T) {
+	validator := ValidatorForFHIRVersion("4.0.1")
+
+	jwksInfo := getJWKSInfo()
+	actualVal := validator.JWKSKeyStrength(jwksInfo)
+	th.Assert(t, actualVal.Valid, fmt.Sprintf("JWKSKeyStrength check should be valid, returned value is instead %+v", actualVal))
+
+	jwksInfo.Keys[0].KeySize = 1024
+	actualVal = validator.JWKSKeyStrength(jwksInfo)
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("JWKSKeyStrength check should be invalid, returned value is instead %+v", actualVal))
+	th.Assert(t, actualVal.Actual == "RSA 1024", fmt.Sprintf("expected actual value RSA 1024, got %s", actualVal.Actual))
+}
+
+func Test_JWKSPrivateKey(t *testing.T) {
+	validator := ValidatorForFHIRVersion("4.0.1")
+
+	jwksInfo := getJWKSInfo()
+	actualVal := validator.JWKSPrivateKey(jwksInfo)
+	th.Assert(t, actualVal.Valid, fmt.Sprintf("JWKSPrivateKey check should be valid, returned value is instead %+v", actualVal))
+
+	jwksInfo.Keys = append(jwksInfo.Keys, endpointmanager.JWK{KeyType: "oct", KeyID: "key-3", KeySize: 256, HasPrivateKey: true})
+	actualVal = validator.JWKSPrivateKey(jwksInfo)
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("JWKSPrivateKey check should be invalid, returned value is instead %+v", actualVal))
+	th.Assert(t, actualVal.Actual == "1", fmt.Sprintf("expected actual value 1, got %s", actualVal.Actual))
+}
+
+func getJWKSInfo() *endpointmanager.JWKSInfo {
+	return &endpointmanager.JWKSInfo{
+		URL:          "https://example.com/jwks",
+		HTTPResponse: 200,
+		Keys: []endpointmanager.JWK{
+			{KeyType: "RSA", Algorithm: "RS384", Use: "sig", KeyID: "key-1", KeySize: 2048},
+			{KeyType: "EC", Algorithm: "ES384", Use: "sig", KeyID: "key-2", Curve: "P-384", KeySize: 384},
+		},
+	}
+}
+
+func Test_RunAuthServerValidation(t *testing.T) {
+	validator := ValidatorForFHIRVersion("4.0.1")
+
+	capStat := getOAuthURIsCapStat(t, "https://example.com/token", "https://example.com/authorize")
+	smartRsp := smartparser.NewSMARTRespFromInterface(map[string]interface{}{
+		"token_endpoint":         "https://example.com/token",
+		"authorization_endpoint": "https://example.com/authorize"})
+
+	rules := validator.RunAuthServerValidation(getAuthServerMetadata(), capStat, smartRsp)
+	th.Assert(t, len(rules) == 2, fmt.Sprintf("expected 2 auth server rules, got %d", len(rules)))
+	for _, rule := range rules {
+		th.Assert(t, rule.Valid, fmt.Sprintf("expected %s to be valid, returned value is instead %+v", rule.RuleName, rule))
+	}
+}
+
+func Test_TokenEndpointMatch(t *testing.T) {
+	validator := ValidatorForFHIRVersion("4.0.1")
+
+	capStat := getOAuthURIsCapStat(t, "https://example.com/token", "https://example.com/authorize")
+	smartRsp := smartparser.NewSMARTRespFromInterface(map[string]interface{}{"token_endpoint": "https://EXAMPLE.com/token/"})
+
+	// base test
+
+	expectedVal := endpointmanager.Rule{
+		RuleName:  endpointmanager.TokenEndpointRule,
+		Valid:     true,
+		Expected:  "https://EXAMPLE.com/token/",
+		Actual:    "https://EXAMPLE.com/token/",
+		Comment:   "The token endpoint in the SMART configuration, the capability statement's oauth-uris extension and the authorization server metadata should be the same.",
+		Reference: "https://hl7.org/fhir/smart-app-launch/conformance.html",
+		ImplGuide: "SMART App Launch 2.0",
+	}
+	actualVal := validator.TokenEndpointMatch(getAuthServerMetadata(), capStat, smartRsp)
+	eq := reflect.DeepEqual(actualVal, expectedVal)
+	th.Assert(t, eq == true, fmt.Sprintf("TokenEndpointMatch check should be valid, returned value is instead %+v", actualVal))
+
+	// auth server metadata lists a different token endpoint
+
+	authServer := getAuthServerMetadata()
+	authServer.TokenEndpoint = "https://auth.example.com/token"
+	actualVal = validator.TokenEndpointMatch(authServer, capStat, smartRsp)
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("TokenEndpointMatch check should be invalid, returned value is instead %+v", actualVal))
+	th.Assert(t, actualVal.Actual == "https://auth.example.com/token", fmt.Sprintf("expected actual value https://auth.example.com/token, got %s", actualVal.Actual))
+
+	// auth server metadata that could not be retrieved is not compared
+
+	authServer.Error = "the metadata URL returned HTTP status 404"
+	actualVal = validator.TokenEndpointMatch(authServer, capStat, smartRsp)
+	th.Assert(t, actualVal.Valid, fmt.Sprintf("TokenEndpointMatch check should be valid, returned value is instead %+v", actualVal))
+
+	// capability statement lists a different token endpoint
+
+	capStat = getOAuthURIsCapStat(t, "https://other.example.com/token", "https://example.com/authorize")
+	actualVal = validator.TokenEndpointMatch(nil, capStat, smartRsp)
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("TokenEndpointMatch check should be invalid, returned value is instead %+v", actualVal))
+
+	// nothing to compare
+
+	actualVal = validator.TokenEndpointMatch(nil, nil, nil)
+	th.Assert(t, actualVal.Valid, fmt.Sprintf("TokenEndpointMatch check should be valid without any token endpoints, returned value is instead %+v", actualVal))
+}
+
+func Test_AuthorizeEndpointMatch(t *testing.T) {
+	validator := ValidatorForFHIRVersion("4.0.1")
+
+	capStat := getOAuthURIsCapStat(t, "https://example.com/token", "https://example.com/authorize")
+	smartRsp := smartparser.NewSMARTRespFromInterface(map[string]interface{}{"authorization_endpoint": "https://example.com/authorize"})
+
+	actualVal := validator.AuthorizeEndpointMatch(getAuthServerMetadata(), capStat, smartRsp)
+	th.Assert(t, actualVal.Valid, fmt.Sprintf("AuthorizeEndpointMatch check should be valid, returned value is instead %+v", actualVal))
+
+	smartRsp = smartparser.NewSMARTRespFromInterface(map[string]interface{}{"authorization_endpoint": "https://example.com/oauth2/authorize"})
+	actualVal = validator.AuthorizeEndpointMatch(getAuthServerMetadata(), capStat, smartRsp)
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("AuthorizeEndpointMatch check should be invalid, returned value is instead %+v", actualVal))
+	th.Assert(t, actualVal.Expected == "https://example.com/oauth2/authorize", fmt.Sprintf("expected the SMART configuration's endpoint as the expected value, got %s", actualVal.Expected))
+}
+
+func getAuthServerMetadata() *endpointmanager.AuthServerMetadata {
+	return &endpointmanager.AuthServerMetadata{
+		DocumentType:          "openid-configuration",
+		URL:                   "https://example.com/.well-known/openid-configuration",
+		RequestedIssuer:       "https://example.com",
+		HTTPResponse:          200,
+		Issuer:                "https://example.com",
+		AuthorizationEndpoint: "https://example.com/authorize",
+		TokenEndpoint:         "https://example.com/token",
+		JWKSURI:               "https://example.com/jwks",
+	}
+}
+
+// getOAuthURIsCapStat gets a capability statement whose oauth-uris extension lists the given token and
+// authorize endpoints
+func getOAuthURIsCapStat(t *testing.T, token string, authorize string) capabilityparser.CapabilityStatement {
+	csInt := map[string]interface{}{
+		"resourceType": "CapabilityStatement",
+		"fhirVersion":  "4.0.1",
+		"rest": []interface{}{
+			map[string]interface{}{
+				"mode": "server",
+				"security": map[string]interface{}{
+					"extension": []interface{}{
+						map[string]interface{}{
+							"url": "http://fhir-registry.smarthealthit.org/StructureDefinition/oauth-uris",
+							"extension": []interface{}{
+								map[string]interface{}{"url": "token", "valueUri": token},
+								map[string]interface{}{"url": "authorize", "valueUri": authorize},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	cs, err := capabilityparser.NewCapabilityStatementFromInterface(csInt)
+	th.Assert(t, err == nil, err)
+	return cs
+}
+
+func Test_RunUDAPValidation(t *testing.T) {
+	validator := ValidatorForFHIRVersion("4.0.1")
+
+	rules := validator.RunUDAPValidation(getUDAPInfo())
+	th.Assert(t, len(rules) == 3, fmt.Sprintf("expected 3 UDAP rules, got %d", len(rules)))
+	for _, rule := range rules {
+		th.Assert(t, rule.Valid, fmt.Sprintf("expected %s to be valid, returned value is instead %+v", rule.RuleName, rule))
+	}
+
+	// the metadata could not be parsed
+
+	udapInfo := &endpointmanager.UDAPInfo{URL: "https://example.com/fhir/.well-known/udap", HTTPResponse: 200, Error: "the UDAP metadata response is not a JSON object"}
+	rules = validator.RunUDAPValidation(udapInfo)
+	for _, rule := range rules {
+		th.Assert(t, !rule.Valid, fmt.Sprintf("expected %s to be invalid for UDAP metadata that could not be parsed, returned value is instead %+v", rule.RuleName, rule))
+	}
+}
+
+func Test_UDAPRequiredFields(t *testing.T) {
+	validator := ValidatorForFHIRVersion("4.0.1")
+
+	// base test
+
+	expectedVal := endpointmanager.Rule{
+		RuleName:  endpointmanager.UDAPRequiredFieldsRule,
+		Valid:     true,
+		Comment:   "The UDAP metadata SHALL include udap_versions_supported with version 1, udap_profiles_supported, udap_authorization_extensions_supported, udap_certifications_supported, grant_types_supported, token_endpoint, token_endpoint_auth_methods_supported with private_key_jwt, token_endpoint_auth_signing_alg_values_supported, registration_endpoint, registration_endpoint_jwt_signing_alg_values_supported and signed_metadata.",
+		Reference: "https://hl7.org/fhir/us/udap-security/STU1/discovery.html",
+		ImplGuide: "UDAP Security STU1",
+	}
+	actualVal := validator.UDAPRequiredFields(getUDAPInfo())
+	eq := reflect.DeepEqual(actualVal, expectedVal)
+	th.Assert(t, eq == true, fmt.Sprintf("UDAPRequiredFields check should be valid, returned value is instead %+v", actualVal))
+
+	// missing fields
+
+	udapInfo := getUDAPInfo()
+	udapInfo.CertificationsSupported = nil
+	udapInfo.RegistrationEndpoint = ""
+	actualVal = validator.UDAPRequiredFields(udapInfo)
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("UDAPRequiredFields check should be invalid, returned value is instead %+v", actualVal))
+	th.Assert(t, actualVal.Actual == "udap_certifications_supported,registration_endpoint", fmt.Sprintf("unexpected missing fields %s", actualVal.Actual))
+
+	// an empty list is not missing
+
+	udapInfo = getUDAPInfo()
+	udapInfo.AuthorizationExtensionsSupported = []string{}
+	udapInfo.AuthorizationExtensionsRequired = nil
+	actualVal = validator.UDAPRequiredFields(udapInfo)
+	th.Assert(t, actualVal.Valid, fmt.Sprintf("UDAPRequiredFields check should be valid, returned value is instead %+v", actualVal))
+
+	// conditionally required fields
+
+	udapInfo.AuthorizationExtensionsSupported = []string{"hl7-b2b"}
+	udapInfo.AuthorizationEndpoint = ""
+	actualVal = validator.UDAPRequiredFields(udapInfo)
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("UDAPRequiredFields check should be invalid, returned value is instead %+v", actualVal))
+	th.Assert(t, actualVal.Actual == "authorization_endpoint,udap_authorization_extensions_required", fmt.Sprintf("unexpected missing fields %s", actualVal.Actual))
+
+	// fixed values
+
+	udapInfo = getUDAPInfo()
+	udapInfo.TokenEndpointAuthMethodsSupported = []string{"client_secret_basic"}
+	actualVal = validator.UDAPRequiredFields(udapInfo)
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("UDAPRequiredFields check should be invalid without private_key_jwt, returned value is instead %+v", actualVal))
+
+	udapInfo = getUDAPInfo()
+	udapInfo.VersionsSupported = []string{"2"}
+	actualVal = validator.UDAPRequiredFields(udapInfo)
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("UDAPRequiredFields check should be invalid without version 1, returned value is instead %+v", actualVal))
+}
+
+func Test_UDAPSignedMetadata(t *testing.T) {
+	validator := ValidatorForFHIRVersion("4.0.1")
+
+	actualVal := validator.UDAPSignedMetadata(getUDAPInfo())
+	th.Assert(t, actualVal.Valid, fmt.Sprintf("UDAPSignedMetadata check should be valid, returned value is instead %+v", actualVal))
+
+	// signature
+
+	udapInfo := getUDAPInfo()
+	udapInfo.SignedMetadata.SignatureValid = false
+	actualVal = validator.UDAPSignedMetadata(udapInfo)
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("UDAPSignedMetadata check should be invalid, returned value is instead %+v", actualVal))
+
+	// issuer
+
+	udapInfo = getUDAPInfo()
+	udapInfo.SignedMetadata.Issuer = "https://other.example.com/fhir"
+	udapInfo.SignedMetadata.Subject = "https://other.example.com/fhir"
+	udapInfo.SignedMetadata.LeafSANURIs = []string{"https://other.example.com/fhir"}
+	actualVal = validator.UDAPSignedMetadata(udapInfo)
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("UDAPSignedMetadata check should be invalid for another server's iss, returned value is instead %+v", actualVal))
+
+	udapInfo = getUDAPInfo()
+	udapInfo.SignedMetadata.LeafSANURIs = []string{"https://other.example.com/fhir"}
+	actualVal = validator.UDAPSignedMetadata(udapInfo)
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("UDAPSignedMetadata check should be invalid for an iss that is not in the certificate, returned value is instead %+v", actualVal))
+
+	// expiration
+
+	udapInfo = getUDAPInfo()
+	udapInfo.SignedMetadata.IssuedAt = time.Now().Add(-2 * time.Hour)
+	udapInfo.SignedMetadata.ExpiresAt = time.Now().Add(-time.Hour)
+	actualVal = validator.UDAPSignedMetadata(udapInfo)
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("UDAPSignedMetadata check should be invalid for expired metadata, returned value is instead %+v", actualVal))
+
+	udapInfo = getUDAPInfo()
+	udapInfo.SignedMetadata.ExpiresAt = udapInfo.SignedMetadata.IssuedAt.AddDate(2, 0, 0)
+	actualVal = validator.UDAPSignedMetadata(udapInfo)
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("UDAPSignedMetadata check should be invalid for metadata valid for more than a year, returned value is instead %+v", actualVal))
+
+	// missing
+
+	udapInfo = getUDAPInfo()
+	udapInfo.SignedMetadata = nil
+	actualVal = validator.UDAPSignedMetadata(udapInfo)
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("UDAPSignedMetadata check should be invalid, returned value is instead %+v", actualVal))
+	th.Assert(t, actualVal.Actual == "missing", fmt.Sprintf("expected actual value missing, got %s", actualVal.Actual))
+}
+
+func Test_UDAPSignedEndpoints(t *testing.T) {
+	validator := ValidatorForFHIRVersion("4.0.1")
+
+	actualVal := validator.UDAPSignedEndpoints(getUDAPInfo())
+	th.Assert(t, actualVal.Valid, fmt.Sprintf("UDAPSignedEndpoints check should be valid, returned value is instead %+v", actualVal))
+
+	udapInfo := getUDAPInfo()
+	udapInfo.SignedMetadata.TokenEndpoint = "https://other.example.com/token"
+	actualVal = validator.UDAPSignedEndpoints(udapInfo)
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("UDAPSignedEndpoints check should be invalid, returned value is instead %+v", actualVal))
+	th.Assert(t, actualVal.Actual == "token_endpoint", fmt.Sprintf("expected actual value token_endpoint, got %s", actualVal.Actual))
+}
+
+func Test_DataExposure(t *testing.T) {
+	validator := ValidatorForFHIRVersion("4.0.1")
+	total := 0
+
+	// base test
+
+	checks := []endpointmanager.DataExposureCheck{
+		{Search: "Patient?_count=1", HTTPResponse: 401, ResourceType: "OperationOutcome"},
+		{Search: "Observation?_count=1", HTTPResponse: 200, ResourceType: "Bundle", Total: &total},
+	}
+	rules := validator.RunDataExposureValidation(checks)
+	th.Assert(t, len(rules) == 1, fmt.Sprintf("expected 1 data exposure rule, got %d", len(rules)))
+	th.Assert(t, rules[0].Valid, fmt.Sprintf("expected searches that returned no data to be valid, returned value is instead %+v", rules[0]))
+	th.Assert(t, rules[0].RuleName == endpointmanager.DataExposureRule, fmt.Sprintf("expected the data exposure rule, got %s", rules[0].RuleName))
+
+	// patient data returned without authorization
+
+	checks = append(checks, endpointmanager.DataExposureCheck{Search: "Condition?_count=1", HTTPResponse: 200, ResourceType: "Bundle", EntryCount: 1})
+	actualVal := validator.DataExposure(checks)
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("expected a search that returned data to be invalid, returned value is instead %+v", actualVal))
+	th.Assert(t, actualVal.Actual == "1", fmt.Sprintf("expected 1 exposed search, got %s", actualVal.Actual))
+	th.Assert(t, strings.HasPrefix(actualVal.Comment, "CRITICAL:"), fmt.Sprintf("expected the comment to mark the failure as critical, got %s", actualVal.Comment))
+	th.Assert(t, strings.Contains(actualVal.Comment, "Condition?_count=1"), fmt.Sprintf("expected the comment to name the search, got %s", actualVal.Comment))
+}
+
+func Test_MetadataPublic(t *testing.T) {
+	validator := ValidatorForFHIRVersion("4.0.1")
+
+	// base test
+
+	rules := validator.RunErrorResponseValidation(200, nil)
+	th.Assert(t, len(rules) == 1, fmt.Sprintf("expected 1 error response rule, got %d", len(rules)))
+	th.Assert(t, rules[0].Valid, fmt.Sprintf("expected a successful request to be valid, returned value is instead %+v", rules[0]))
+	th.Assert(t, rules[0].RuleName == endpointmanager.MetadataPublicRule, fmt.Sprintf("expected the metadata public rule, got %s", rules[0].RuleName))
+
+	// failures that are not about authorization
+
+	errorResponse := &endpointmanager.ErrorResponse{Kind: endpointmanager.NotFoundKind}
+	actualVal := validator.MetadataPublic(404, errorResponse)
+	th.Assert(t, actualVal.Valid, fmt.Sprintf("expected a 404 response to be valid, returned value is instead %+v", actualVal))
+
+	errorResponse = &endpointmanager.ErrorResponse{Kind: endpointmanager.ServerErrorKind}
+	actualVal = validator.MetadataPublic(500, errorResponse)
+	th.Assert(t, actualVal.Valid, fmt.Sprintf("expected a 500 response to be valid, returned value is instead %+v", actualVal))
+
+	// authorization required
+
+	errorResponse = &endpointmanager.ErrorResponse{
+		Kind:           endpointmanager.AuthRequiredKind,
+		AuthChallenges: []endpointmanager.AuthChallenge{{Scheme: "Bearer", Realm: "fhir"}},
+	}
+	actualVal = validator.MetadataPublic(401, errorResponse)
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("expected a response that requires authorization to be invalid, returned value is instead %+v", actualVal))
+	th.Assert(t, actualVal.Actual == "false", fmt.Sprintf("expected actual to be false, got %s", actualVal.Actual))
+	th.Assert(t, strings.Contains(actualVal.Comment, "Bearer"), fmt.Sprintf("expected the comment to name the auth scheme, got %s", actualVal.Comment))
+
+	// a 403 response without a kept error response
+	actualVal = validator.MetadataPublic(403, nil)
+	th.Assert(t, !actualVal.Valid, fmt.Sprintf("expected a 403 response to be invalid, returned value is instead %+v", actualVal))
+}
+
+func getUDAPInfo() *endpointmanager.UDAPInfo {
+	issuedAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+	return &endpointmanager.UDAPInfo{
+		URL:                               "https://example.com/fhir/.well-known/udap",
+		HTTPResponse:                      200,
+		VersionsSupported:                 []string{"1"},
+		ProfilesSupported:                 []string{"udap_dcr", "udap_authn", "udap_authz"},
+		AuthorizationExtensionsSupported:  []string{"hl7-b2b"},
+		AuthorizationExtensionsRequired:   []string{},
+		CertificationsSupported:           []string{},
+		GrantTypesSupported:               []string{"authorization_code", "client_credentials"},
+		TokenEndpointAuthMethodsSupported: []string{"private_key_jwt"},
+		TokenEndpointAuthSigningAlgs:      []string{"RS256"},
+		RegistrationSigningAlgs:           []string{"RS256"},
+		AuthorizationEndpoint:             "https://example.com/authorize",
+		TokenEndpoint:                     "https://example.com/token",
+		RegistrationEndpoint:              "https://example.com/register",
+		SignedMetadata: &endpointmanager.UDAPSignedMetadata{
+			Algorithm:             "RS256",
+			Issuer:                "https://example.com/fhir",
+			Subject:               "https://example.com/fhir",
+			IssuedAt:              issuedAt,
+			ExpiresAt:             issuedAt.Add(24 * time.Hour),
+			AuthorizationEndpoint: "https://example.com/authorize",
+			TokenEndpoint:         "https://example.com/token",
+			RegistrationEndpoint:  "https://example.com/register",
+			ChainLength:           2,
+			LeafSANURIs:           []string{"https://example.com/fhir"},
+			SignatureValid:        true,
+		},
+	}
+}
+
+func getRedirectChain() []endpointmanager.RedirectHop {
+	return []endpointmanager.RedirectHop{
+		{URL: "https://example.com/metadata", Scheme: "https", StatusCode: 301, Location: "/r4/metadata"},
+		{URL: "https://example.com/r4/metadata", Scheme: "https", StatusCode: 302, Location: "https://fhir.example.com/r4/metadata"},
+	}
+}
+
+func getResponseHeaders() map[string]string {
+	return map[string]string{
+		"Content-Type":                "application/fhir+json; charset=utf-8",
+		"Strict-Transport-Security":   "max-age=31536000; includeSubDomains",
+		"Access-Control-Allow-Origin": "*",
+		"Server":                      "Example",
+	}
+}
+
+func getTLSInfo() *endpointmanager.TLSInfo {
+	return &endpointmanager.TLSInfo{
+		TLSVersion:    "TLS 1.2",
+		CipherSuite:   "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+		LeafSubject:   "CN=example.com",
+		LeafSANs:      []string{"example.com", "www.example.com"},
+		LeafIssuer:    "CN=Example CA",
+		NotBefore:     time.Now().Add(-24 * time.Hour),
+		NotAfter:      time.Now().Add(365 * 24 * time.Hour),
+		KeyType:       "RSA",
+		KeySize:       2048,
+		ChainLength:   2,
+		ChainVerified: true,
+		HostnameMatch: true,
+		SelfSigned:    false,
+	}
+}
+
 func getDSTU2CapStat() (capabilityparser.CapabilityStatement, error) {
 	path := filepath.Join("../../../testdata", "test_dstu2_capability_statement.json")
 	csJSON, err := os.ReadFile(path)
@@ -255,22 +255,10 @@ func getVendorMatch(ctx context.Context, capStat capabilityparser.CapabilityStat
 	if err != nil {
 		return 0, errors.Wrap(err, "error retrieving vendor list from database")
 	}
-	vendorsNorm := normalizeList(vendorsRaw)
-
-	match, err := publisherMatch(capStat, vendorsNorm, vendorsRaw)
-	log.Infof("[getVendorMatch] publisherMatch result: %s", match)
 
+	match, err := MatchVendor(capStat, vendorsRaw)
 	if err != nil {
-		return 0, errors.Wrap(err, "error matching vendors in database using capability statement publisher")
-	}
-
-	if match == "" {
-		match, err = hackMatch(capStat, vendorsNorm, vendorsRaw)
-		log.Infof("[getVendorMatch] hackMatch result: %s", match)
-
-		if err != nil {
-			return 0, errors.Wrap(err, "error matching via hackMatch")
-		}
+		return 0, err
 	}
 
 	if match == "" {
@@ -289,6 +277,30 @@ func getVendorMatch(ctx context.Context, capStat capabilityparser.CapabilityStat
 	return vendorID, nil
 }
 
+// MatchVendor returns the name in vendorsRaw that matches the publisher of the capability statement, falling back
+// to the vendor specific matching in hackMatch. It returns an empty string if no vendor matches.
+func MatchVendor(capStat capabilityparser.CapabilityStatement, vendorsRaw []string) (string, error) {
+	vendorsNorm := normalizeList(vendorsRaw)
+
+	match, err := publisherMatch(capStat, vendorsNorm, vendorsRaw)
+	log.Infof("[MatchVendor] publisherMatch result: %s", match)
+
+	if err != nil {
+		return "", errors.Wrap(err, "error matching vendors in database using capability statement publisher")
+	}
+
+	if match == "" {
+		match, err = hackMatch(capStat, vendorsNorm, vendorsRaw)
+		log.Infof("[MatchVendor] hackMatch result: %s", match)
+
+		if err != nil {
+			return "", errors.Wrap(err, "error matching via hackMatch")
+		}
+	}
+
+	return match, nil
+}
+
 func publisherMatch(capStat capabilityparser.CapabilityStatement, vendorsNorm []string, vendorsRaw []string) (string, error) {
 	log.Infof("[publisherMatch] Attempting publisher-based match")
 
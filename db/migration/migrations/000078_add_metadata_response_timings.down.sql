@@ -0,0 +1,9 @@
+BEGIN;
+
+ALTER TABLE fhir_endpoints_metadata DROP COLUMN IF EXISTS dns_lookup_seconds;
+ALTER TABLE fhir_endpoints_metadata DROP COLUMN IF EXISTS tcp_connect_seconds;
+ALTER TABLE fhir_endpoints_metadata DROP COLUMN IF EXISTS tls_handshake_seconds;
+ALTER TABLE fhir_endpoints_metadata DROP COLUMN IF EXISTS time_to_first_byte_seconds;
+ALTER TABLE fhir_endpoints_metadata DROP COLUMN IF EXISTS body_transfer_seconds;
+
+COMMIT;
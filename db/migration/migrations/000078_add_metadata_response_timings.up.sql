@@ -0,0 +1,9 @@
+BEGIN;
+
+ALTER TABLE fhir_endpoints_metadata ADD COLUMN IF NOT EXISTS dns_lookup_seconds DECIMAL(7,4);
+ALTER TABLE fhir_endpoints_metadata ADD COLUMN IF NOT EXISTS tcp_connect_seconds DECIMAL(7,4);
+ALTER TABLE fhir_endpoints_metadata ADD COLUMN IF NOT EXISTS tls_handshake_seconds DECIMAL(7,4);
+ALTER TABLE fhir_endpoints_metadata ADD COLUMN IF NOT EXISTS time_to_first_byte_seconds DECIMAL(7,4);
+ALTER TABLE fhir_endpoints_metadata ADD COLUMN IF NOT EXISTS body_transfer_seconds DECIMAL(7,4);
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP INDEX IF EXISTS fhir_endpoints_tls_info_metadata_id_idx;
+DROP TABLE IF EXISTS fhir_endpoints_tls_info;
+
+COMMIT;
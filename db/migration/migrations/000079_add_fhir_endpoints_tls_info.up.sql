@@ -0,0 +1,26 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS fhir_endpoints_tls_info (
+    id                      SERIAL PRIMARY KEY,
+    metadata_id             INT REFERENCES fhir_endpoints_metadata(id) ON DELETE CASCADE,
+    tls_version             VARCHAR(500),
+    cipher_suite            VARCHAR(500),
+    alpn_protocol           VARCHAR(500),
+    leaf_subject            VARCHAR(500),
+    leaf_sans               VARCHAR(500)[],
+    leaf_issuer             VARCHAR(500),
+    not_before              TIMESTAMPTZ,
+    not_after               TIMESTAMPTZ,
+    key_type                VARCHAR(500),
+    key_size                INTEGER,
+    chain_length            INTEGER,
+    chain_verified          BOOLEAN,
+    verification_error      VARCHAR(500),
+    hostname_match          BOOLEAN,
+    self_signed             BOOLEAN,
+    created_at              TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS fhir_endpoints_tls_info_metadata_id_idx ON fhir_endpoints_tls_info (metadata_id);
+
+COMMIT;
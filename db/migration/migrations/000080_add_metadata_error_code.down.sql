@@ -0,0 +1,5 @@
+BEGIN;
+
+ALTER TABLE fhir_endpoints_metadata DROP COLUMN IF EXISTS error_code;
+
+COMMIT;
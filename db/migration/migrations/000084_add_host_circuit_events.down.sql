@@ -0,0 +1,5 @@
+BEGIN;
+
+DROP TABLE IF EXISTS host_circuit_events;
+
+COMMIT;
@@ -0,0 +1,14 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS host_circuit_events (
+    id                      SERIAL PRIMARY KEY,
+    host                    VARCHAR(500),
+    from_state              VARCHAR(20),
+    to_state                VARCHAR(20),
+    consecutive_failures    INTEGER,
+    created_at              TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS host_circuit_events_host_idx ON host_circuit_events (host);
+
+COMMIT;
@@ -0,0 +1,15 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS fhir_endpoints_jwks (
+    id                      SERIAL PRIMARY KEY,
+    metadata_id             INT REFERENCES fhir_endpoints_metadata(id) ON DELETE CASCADE,
+    url                     VARCHAR(500),
+    http_response           INTEGER,
+    error                   VARCHAR(500),
+    keys                    JSONB,
+    created_at              TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS fhir_endpoints_jwks_metadata_id_idx ON fhir_endpoints_jwks (metadata_id);
+
+COMMIT;
@@ -0,0 +1,20 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS fhir_endpoints_auth_server (
+    id                      SERIAL PRIMARY KEY,
+    metadata_id             INT REFERENCES fhir_endpoints_metadata(id) ON DELETE CASCADE,
+    document_type           VARCHAR(50),
+    url                     VARCHAR(500),
+    requested_issuer        VARCHAR(500),
+    http_response           INTEGER,
+    error                   VARCHAR(500),
+    issuer                  VARCHAR(500),
+    authorization_endpoint  VARCHAR(500),
+    token_endpoint          VARCHAR(500),
+    jwks_uri                VARCHAR(500),
+    created_at              TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS fhir_endpoints_auth_server_metadata_id_idx ON fhir_endpoints_auth_server (metadata_id);
+
+COMMIT;
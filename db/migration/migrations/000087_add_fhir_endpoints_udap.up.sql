@@ -0,0 +1,29 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS fhir_endpoints_udap (
+    id                                    SERIAL PRIMARY KEY,
+    metadata_id                           INT REFERENCES fhir_endpoints_metadata(id) ON DELETE CASCADE,
+    url                                   VARCHAR(500),
+    http_response                         INTEGER,
+    error                                 VARCHAR(500),
+    versions_supported                    VARCHAR(500)[],
+    profiles_supported                    VARCHAR(500)[],
+    authorization_extensions_supported    VARCHAR(500)[],
+    authorization_extensions_required     VARCHAR(500)[],
+    certifications_supported              VARCHAR(500)[],
+    certifications_required               VARCHAR(500)[],
+    grant_types_supported                 VARCHAR(500)[],
+    scopes_supported                      VARCHAR(500)[],
+    token_endpoint_auth_methods_supported VARCHAR(500)[],
+    token_endpoint_auth_signing_algs      VARCHAR(500)[],
+    registration_signing_algs             VARCHAR(500)[],
+    authorization_endpoint                VARCHAR(500),
+    token_endpoint                        VARCHAR(500),
+    registration_endpoint                 VARCHAR(500),
+    signed_metadata                       JSONB,
+    created_at                            TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS fhir_endpoints_udap_metadata_id_idx ON fhir_endpoints_udap (metadata_id);
+
+COMMIT;
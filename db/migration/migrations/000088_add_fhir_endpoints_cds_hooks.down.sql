@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP VIEW IF EXISTS cds_hooks_export;
+DROP INDEX IF EXISTS fhir_endpoints_cds_hooks_metadata_id_idx;
+DROP TABLE IF EXISTS fhir_endpoints_cds_hooks;
+
+COMMIT;
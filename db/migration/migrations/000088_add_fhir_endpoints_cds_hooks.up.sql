@@ -0,0 +1,29 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS fhir_endpoints_cds_hooks (
+    id                      SERIAL PRIMARY KEY,
+    metadata_id             INT REFERENCES fhir_endpoints_metadata(id) ON DELETE CASCADE,
+    url                     VARCHAR(500),
+    http_response           INTEGER,
+    error                   VARCHAR(500),
+    service_ids             VARCHAR(500)[],
+    hook_types              VARCHAR(500)[],
+    services                JSONB,
+    created_at              TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS fhir_endpoints_cds_hooks_metadata_id_idx ON fhir_endpoints_cds_hooks (metadata_id);
+
+-- The developer of each endpoint is the vendor that the capability receiver attributed it to
+CREATE or REPLACE VIEW cds_hooks_export AS
+SELECT endpts_info.url, endpts_info.requested_fhir_version, vendors.name AS vendor_name,
+    cds_hooks.http_response AS cds_hooks_http_response,
+    cds_hooks.error AS cds_hooks_error,
+    COALESCE(jsonb_array_length(cds_hooks.services), 0) AS cds_service_count,
+    cds_hooks.service_ids, cds_hooks.hook_types,
+    cds_hooks.created_at AS cds_hooks_updated
+FROM fhir_endpoints_info AS endpts_info
+LEFT JOIN vendors ON endpts_info.vendor_id = vendors.id
+LEFT JOIN fhir_endpoints_cds_hooks AS cds_hooks ON endpts_info.metadata_id = cds_hooks.metadata_id;
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP INDEX IF EXISTS fhir_endpoints_data_exposure_created_at_idx;
+DROP INDEX IF EXISTS fhir_endpoints_data_exposure_metadata_id_idx;
+DROP TABLE IF EXISTS fhir_endpoints_data_exposure;
+
+COMMIT;
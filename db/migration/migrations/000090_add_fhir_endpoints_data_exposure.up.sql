@@ -0,0 +1,25 @@
+BEGIN;
+
+-- The searches are kept after the request's metadata is pruned and are removed separately once they are older
+-- than the data exposure retention period
+CREATE TABLE IF NOT EXISTS fhir_endpoints_data_exposure (
+    id                      SERIAL PRIMARY KEY,
+    metadata_id             INT REFERENCES fhir_endpoints_metadata(id) ON DELETE SET NULL,
+    url                     VARCHAR(500),
+    search                  VARCHAR(500),
+    http_response           INTEGER,
+    resource_type           VARCHAR(500),
+    bundle_total            INTEGER,
+    entry_count             INTEGER,
+    error                   VARCHAR(500),
+    created_at              TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS fhir_endpoints_data_exposure_metadata_id_idx ON fhir_endpoints_data_exposure (metadata_id);
+CREATE INDEX IF NOT EXISTS fhir_endpoints_data_exposure_created_at_idx ON fhir_endpoints_data_exposure (created_at);
+
+-- The table identifies endpoints that expose patient data, so it is not included in any view or export and is only
+-- readable by the owner of the schema
+REVOKE ALL ON fhir_endpoints_data_exposure FROM PUBLIC;
+
+COMMIT;
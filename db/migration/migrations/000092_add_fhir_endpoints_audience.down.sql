@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP INDEX IF EXISTS fhir_endpoints_audience_audience_idx;
+DROP TABLE IF EXISTS fhir_endpoints_audience;
+
+COMMIT;
@@ -0,0 +1,16 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS fhir_endpoints_audience (
+    url                     VARCHAR(500),
+    requested_fhir_version  VARCHAR(500) NOT NULL DEFAULT 'None',
+    audience                VARCHAR(500) NOT NULL,
+    confidence              NUMERIC (5, 3),
+    signals                 JSONB,
+    created_at              TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at              TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT endpoint_audience PRIMARY KEY (url, requested_fhir_version)
+);
+
+CREATE INDEX IF NOT EXISTS fhir_endpoints_audience_audience_idx ON fhir_endpoints_audience (audience);
+
+COMMIT;
@@ -0,0 +1,9 @@
+BEGIN;
+
+DROP VIEW IF EXISTS shared_host_addresses;
+DROP VIEW IF EXISTS hosting_provider_migrations;
+DROP INDEX IF EXISTS fhir_endpoints_dns_host_idx;
+DROP INDEX IF EXISTS fhir_endpoints_dns_metadata_id_idx;
+DROP TABLE IF EXISTS fhir_endpoints_dns;
+
+COMMIT;
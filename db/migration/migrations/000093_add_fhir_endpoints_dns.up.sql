@@ -0,0 +1,46 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS fhir_endpoints_dns (
+    id                      SERIAL PRIMARY KEY,
+    metadata_id             INT REFERENCES fhir_endpoints_metadata(id) ON DELETE CASCADE,
+    url                     VARCHAR(500),
+    host                    VARCHAR(500),
+    cname_chain             VARCHAR(500)[],
+    addresses               JSONB,
+    hosting_providers       VARCHAR(500)[],
+    supports_ipv6           BOOLEAN,
+    ttl                     INTEGER,
+    error                   VARCHAR(500),
+    created_at              TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS fhir_endpoints_dns_metadata_id_idx ON fhir_endpoints_dns (metadata_id);
+CREATE INDEX IF NOT EXISTS fhir_endpoints_dns_host_idx ON fhir_endpoints_dns (host);
+
+-- Each row is a lookup whose hosting providers differ from the previous successful lookup of the same endpoint
+CREATE or REPLACE VIEW hosting_provider_migrations AS
+SELECT url, host, previous_hosting_providers, hosting_providers, created_at AS migrated_at
+FROM (
+    SELECT url, host, hosting_providers, created_at,
+        LAG(hosting_providers) OVER (PARTITION BY url ORDER BY created_at, id) AS previous_hosting_providers
+    FROM fhir_endpoints_dns
+    WHERE error IS NULL
+) AS lookups
+WHERE previous_hosting_providers IS NOT NULL AND previous_hosting_providers IS DISTINCT FROM hosting_providers;
+
+-- The addresses that the current lookups of more than one endpoint resolved to, with the organizations of those endpoints
+CREATE or REPLACE VIEW shared_host_addresses AS
+SELECT addresses.ip, MAX(addresses.provider) AS hosting_provider,
+    COUNT(DISTINCT endpts_info.url) AS endpoint_count,
+    COUNT(DISTINCT orgs.organization_name) AS organization_count,
+    array_agg(DISTINCT endpts_info.url) AS urls
+FROM fhir_endpoints_info AS endpts_info
+JOIN fhir_endpoints_dns AS dns ON endpts_info.metadata_id = dns.metadata_id
+CROSS JOIN LATERAL jsonb_to_recordset(dns.addresses) AS addresses(ip TEXT, provider TEXT)
+LEFT JOIN fhir_endpoints AS endpts ON endpts_info.url = endpts.url
+LEFT JOIN fhir_endpoint_organizations_map AS org_map ON endpts.id = org_map.id
+LEFT JOIN fhir_endpoint_organizations AS orgs ON org_map.org_database_id = orgs.id
+GROUP BY addresses.ip
+HAVING COUNT(DISTINCT endpts_info.url) > 1;
+
+COMMIT;
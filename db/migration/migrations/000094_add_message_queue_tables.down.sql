@@ -0,0 +1,9 @@
+BEGIN;
+
+DROP INDEX IF EXISTS mq_messages_queue_name_visible_at_idx;
+DROP TABLE IF EXISTS mq_messages;
+DROP TABLE IF EXISTS mq_bindings;
+DROP TABLE IF EXISTS mq_exchanges;
+DROP TABLE IF EXISTS mq_queues;
+
+COMMIT;
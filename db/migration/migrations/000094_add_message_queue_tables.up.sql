@@ -0,0 +1,33 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS mq_queues (
+    name                    VARCHAR(500) PRIMARY KEY,
+    exclusive_owner         VARCHAR(500),
+    created_at              TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS mq_exchanges (
+    name                    VARCHAR(500) PRIMARY KEY,
+    exchange_type           VARCHAR(20) NOT NULL,
+    created_at              TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS mq_bindings (
+    exchange_name           VARCHAR(500) REFERENCES mq_exchanges(name) ON DELETE CASCADE,
+    queue_name              VARCHAR(500) REFERENCES mq_queues(name) ON DELETE CASCADE,
+    routing_key             VARCHAR(500),
+    CONSTRAINT mq_binding PRIMARY KEY (exchange_name, queue_name, routing_key)
+);
+
+CREATE TABLE IF NOT EXISTS mq_messages (
+    id                      BIGSERIAL PRIMARY KEY,
+    queue_name              VARCHAR(500) NOT NULL REFERENCES mq_queues(name) ON DELETE CASCADE,
+    body                    TEXT,
+    visible_at              TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    delivery_count          INTEGER NOT NULL DEFAULT 0,
+    created_at              TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS mq_messages_queue_name_visible_at_idx ON mq_messages (queue_name, visible_at, id);
+
+COMMIT;
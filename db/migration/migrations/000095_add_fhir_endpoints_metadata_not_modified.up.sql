@@ -0,0 +1,48 @@
+BEGIN;
+
+-- 304 Not Modified responses are recorded as 200 responses with not_modified set, so that everything reading
+-- http_response treats them as successful
+ALTER TABLE fhir_endpoints_metadata ADD COLUMN IF NOT EXISTS not_modified BOOLEAN NOT NULL DEFAULT false;
+
+-- The triggers are disabled so that the responses are not counted towards availability again and keep their timestamps
+ALTER TABLE fhir_endpoints_metadata DISABLE TRIGGER update_fhir_endpoint_availability_trigger;
+ALTER TABLE fhir_endpoints_metadata DISABLE TRIGGER set_timestamp_fhir_endpoints_metadata;
+UPDATE fhir_endpoints_metadata SET http_response = 200, not_modified = true WHERE http_response = 304;
+ALTER TABLE fhir_endpoints_metadata ENABLE TRIGGER update_fhir_endpoint_availability_trigger;
+ALTER TABLE fhir_endpoints_metadata ENABLE TRIGGER set_timestamp_fhir_endpoints_metadata;
+
+CREATE OR REPLACE FUNCTION update_fhir_endpoint_availability_info() RETURNS TRIGGER AS $fhir_endpoints_availability$
+    DECLARE
+        okay_count       bigint;
+        all_count        bigint;
+    BEGIN
+        --
+        -- Create or update a row in fhir_endpoint_availabilty with new total http and 200 http count 
+        -- when an endpoint is inserted or updated in fhir_endpoint_info. Also calculate new 
+        -- endpoint availability precentage
+        SELECT http_200_count, http_all_count INTO okay_count, all_count FROM fhir_endpoints_availability WHERE url = NEW.url AND requested_fhir_version = NEW.requested_fhir_version;
+        IF  NOT FOUND THEN
+            IF NEW.http_response = 200 THEN
+                INSERT INTO fhir_endpoints_availability(url, http_200_count, http_all_count, requested_fhir_version) VALUES (NEW.url, 1, 1, NEW.requested_fhir_version);
+                NEW.availability = 1.00;
+                RETURN NEW;
+            ELSE
+                INSERT INTO fhir_endpoints_availability(url, http_200_count, http_all_count, requested_fhir_version) VALUES (NEW.url, 0, 1, NEW.requested_fhir_version);
+                NEW.availability = 0.00;
+                RETURN NEW;
+            END IF;
+        ELSE
+            IF NEW.http_response = 200 THEN
+                UPDATE fhir_endpoints_availability SET http_200_count = okay_count + 1.0, http_all_count = all_count + 1.0 WHERE url = NEW.url AND requested_fhir_version = NEW.requested_fhir_version;
+                NEW.availability := (okay_count + 1.0) / (all_count + 1.0);
+                RETURN NEW;
+            ELSE
+                UPDATE fhir_endpoints_availability SET http_all_count = all_count + 1.0 WHERE url = NEW.url AND requested_fhir_version = NEW.requested_fhir_version;
+                NEW.availability := (okay_count) / (all_count + 1.0);
+                RETURN NEW;
+            END IF;
+        END IF;
+    END;
+$fhir_endpoints_availability$ LANGUAGE plpgsql;
+
+COMMIT;
@@ -0,0 +1,18 @@
+BEGIN;
+
+REVOKE ALL ON fhir_endpoints_data_exposure FROM dataexposure;
+
+DO $$
+BEGIN
+    IF EXISTS (SELECT FROM pg_roles WHERE rolname = 'readonly') THEN
+        GRANT SELECT ON fhir_endpoints_data_exposure TO readonly;
+    END IF;
+    IF EXISTS (SELECT FROM pg_roles WHERE rolname = 'readwrite') THEN
+        GRANT SELECT, INSERT, UPDATE, DELETE ON fhir_endpoints_data_exposure TO readwrite;
+    END IF;
+END
+$$;
+
+DROP ROLE IF EXISTS dataexposure;
+
+COMMIT;
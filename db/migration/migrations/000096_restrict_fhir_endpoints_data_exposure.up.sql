@@ -0,0 +1,22 @@
+BEGIN;
+
+-- The readonly and readwrite roles are granted every table in the schema, including the tables created after them,
+-- so revoking PUBLIC's access to fhir_endpoints_data_exposure did not restrict it. Access is revoked from those roles
+-- and is only given to the roles granted dataexposure.
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT FROM pg_roles WHERE rolname = 'dataexposure') THEN
+        CREATE ROLE dataexposure;
+    END IF;
+    IF EXISTS (SELECT FROM pg_roles WHERE rolname = 'readonly') THEN
+        REVOKE ALL ON fhir_endpoints_data_exposure FROM readonly;
+    END IF;
+    IF EXISTS (SELECT FROM pg_roles WHERE rolname = 'readwrite') THEN
+        REVOKE ALL ON fhir_endpoints_data_exposure FROM readwrite;
+    END IF;
+END
+$$;
+
+GRANT SELECT ON fhir_endpoints_data_exposure TO dataexposure;
+
+COMMIT;
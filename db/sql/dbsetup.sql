@@ -37,7 +37,9 @@ BEGIN
         NEW.created_at IS DISTINCT FROM OLD.created_at OR
         NEW.smart_response::text IS DISTINCT FROM OLD.smart_response::text OR
         NEW.requested_fhir_version IS DISTINCT FROM OLD.requested_fhir_version OR
-        NEW.capability_fhir_version IS DISTINCT FROM OLD.capability_fhir_version
+        NEW.capability_fhir_version IS DISTINCT FROM OLD.capability_fhir_version OR
+        NEW.capability_statement_format IS DISTINCT FROM OLD.capability_statement_format OR
+        NEW.bulk_data::text IS DISTINCT FROM OLD.bulk_data::text
     ) THEN
         INSERT INTO fhir_endpoints_info_history 
         SELECT 'U', now(), user, NEW.*;
@@ -202,7 +204,179 @@ CREATE TABLE fhir_endpoints_metadata (
     smart_http_response     INTEGER,
     requested_fhir_version VARCHAR(500) DEFAULT 'None',
     created_at              TIMESTAMPTZ NOT NULL DEFAULT NOW(),
-    updated_at              TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    updated_at              TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    dns_lookup_seconds      DECIMAL(7,4),
+    tcp_connect_seconds     DECIMAL(7,4),
+    tls_handshake_seconds   DECIMAL(7,4),
+    time_to_first_byte_seconds DECIMAL(7,4),
+    body_transfer_seconds   DECIMAL(7,4),
+    scheduler_wait_seconds  DECIMAL(7,4),
+    error_code              VARCHAR(50),
+    response_headers        JSONB,
+    redirect_chain          JSONB,
+    error_response          JSONB,
+    not_modified            BOOLEAN NOT NULL DEFAULT false
+);
+
+CREATE TABLE fhir_endpoints_tls_info (
+    id                      SERIAL PRIMARY KEY,
+    metadata_id             INT REFERENCES fhir_endpoints_metadata(id) ON DELETE CASCADE,
+    tls_version             VARCHAR(500),
+    cipher_suite            VARCHAR(500),
+    alpn_protocol           VARCHAR(500),
+    leaf_subject            VARCHAR(500),
+    leaf_sans               VARCHAR(500)[],
+    leaf_issuer             VARCHAR(500),
+    not_before              TIMESTAMPTZ,
+    not_after               TIMESTAMPTZ,
+    key_type                VARCHAR(500),
+    key_size                INTEGER,
+    chain_length            INTEGER,
+    chain_verified          BOOLEAN,
+    verification_error      VARCHAR(500),
+    hostname_match          BOOLEAN,
+    self_signed             BOOLEAN,
+    created_at              TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE fhir_endpoints_jwks (
+    id                      SERIAL PRIMARY KEY,
+    metadata_id             INT REFERENCES fhir_endpoints_metadata(id) ON DELETE CASCADE,
+    url                     VARCHAR(500),
+    http_response           INTEGER,
+    error                   VARCHAR(500),
+    keys                    JSONB,
+    created_at              TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE fhir_endpoints_auth_server (
+    id                      SERIAL PRIMARY KEY,
+    metadata_id             INT REFERENCES fhir_endpoints_metadata(id) ON DELETE CASCADE,
+    document_type           VARCHAR(50),
+    url                     VARCHAR(500),
+    requested_issuer        VARCHAR(500),
+    http_response           INTEGER,
+    error                   VARCHAR(500),
+    issuer                  VARCHAR(500),
+    authorization_endpoint  VARCHAR(500),
+    token_endpoint          VARCHAR(500),
+    jwks_uri                VARCHAR(500),
+    created_at              TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE fhir_endpoints_udap (
+    id                                    SERIAL PRIMARY KEY,
+    metadata_id                           INT REFERENCES fhir_endpoints_metadata(id) ON DELETE CASCADE,
+    url                                   VARCHAR(500),
+    http_response                         INTEGER,
+    error                                 VARCHAR(500),
+    versions_supported                    VARCHAR(500)[],
+    profiles_supported                    VARCHAR(500)[],
+    authorization_extensions_supported    VARCHAR(500)[],
+    authorization_extensions_required     VARCHAR(500)[],
+    certifications_supported              VARCHAR(500)[],
+    certifications_required               VARCHAR(500)[],
+    grant_types_supported                 VARCHAR(500)[],
+    scopes_supported                      VARCHAR(500)[],
+    token_endpoint_auth_methods_supported VARCHAR(500)[],
+    token_endpoint_auth_signing_algs      VARCHAR(500)[],
+    registration_signing_algs             VARCHAR(500)[],
+    authorization_endpoint                VARCHAR(500),
+    token_endpoint                        VARCHAR(500),
+    registration_endpoint                 VARCHAR(500),
+    signed_metadata                       JSONB,
+    created_at                            TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE fhir_endpoints_cds_hooks (
+    id                      SERIAL PRIMARY KEY,
+    metadata_id             INT REFERENCES fhir_endpoints_metadata(id) ON DELETE CASCADE,
+    url                     VARCHAR(500),
+    http_response           INTEGER,
+    error                   VARCHAR(500),
+    service_ids             VARCHAR(500)[],
+    hook_types              VARCHAR(500)[],
+    services                JSONB,
+    created_at              TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- The searches are kept after the request's metadata is pruned and are removed separately once they are older
+-- than the data exposure retention period. The table is not included in any view or export, and access to it is
+-- restricted to the dataexposure role in dbusersetup.sql.
+CREATE TABLE fhir_endpoints_data_exposure (
+    id                      SERIAL PRIMARY KEY,
+    metadata_id             INT REFERENCES fhir_endpoints_metadata(id) ON DELETE SET NULL,
+    url                     VARCHAR(500),
+    search                  VARCHAR(500),
+    http_response           INTEGER,
+    resource_type           VARCHAR(500),
+    bundle_total            INTEGER,
+    entry_count             INTEGER,
+    error                   VARCHAR(500),
+    created_at              TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE fhir_endpoints_dns (
+    id                      SERIAL PRIMARY KEY,
+    metadata_id             INT REFERENCES fhir_endpoints_metadata(id) ON DELETE CASCADE,
+    url                     VARCHAR(500),
+    host                    VARCHAR(500),
+    cname_chain             VARCHAR(500)[],
+    addresses               JSONB,
+    hosting_providers       VARCHAR(500)[],
+    supports_ipv6           BOOLEAN,
+    ttl                     INTEGER,
+    error                   VARCHAR(500),
+    created_at              TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE fhir_endpoints_audience (
+    url                     VARCHAR(500),
+    requested_fhir_version  VARCHAR(500) NOT NULL DEFAULT 'None',
+    audience                VARCHAR(500) NOT NULL,
+    confidence              NUMERIC (5, 3),
+    signals                 JSONB,
+    created_at              TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at              TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT endpoint_audience PRIMARY KEY (url, requested_fhir_version)
+);
+
+CREATE TABLE host_circuit_events (
+    id                      SERIAL PRIMARY KEY,
+    host                    VARCHAR(500),
+    from_state              VARCHAR(20),
+    to_state                VARCHAR(20),
+    consecutive_failures    INTEGER,
+    created_at              TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- The tables of the PostgreSQL message queue driver, which is used instead of RabbitMQ when LANTERN_QUEUE_DRIVER is postgres
+CREATE TABLE mq_queues (
+    name                    VARCHAR(500) PRIMARY KEY,
+    exclusive_owner         VARCHAR(500),
+    created_at              TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE mq_exchanges (
+    name                    VARCHAR(500) PRIMARY KEY,
+    exchange_type           VARCHAR(20) NOT NULL,
+    created_at              TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE mq_bindings (
+    exchange_name           VARCHAR(500) REFERENCES mq_exchanges(name) ON DELETE CASCADE,
+    queue_name              VARCHAR(500) REFERENCES mq_queues(name) ON DELETE CASCADE,
+    routing_key             VARCHAR(500),
+    CONSTRAINT mq_binding PRIMARY KEY (exchange_name, queue_name, routing_key)
+);
+
+CREATE TABLE mq_messages (
+    id                      BIGSERIAL PRIMARY KEY,
+    queue_name              VARCHAR(500) NOT NULL REFERENCES mq_queues(name) ON DELETE CASCADE,
+    body                    TEXT,
+    visible_at              TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    delivery_count          INTEGER NOT NULL DEFAULT 0,
+    created_at              TIMESTAMPTZ NOT NULL DEFAULT NOW()
 );
 
 CREATE TABLE validation_results (
@@ -227,6 +401,8 @@ CREATE TABLE fhir_endpoints_info (
     metadata_id             INT REFERENCES fhir_endpoints_metadata(id) ON DELETE SET NULL,
     requested_fhir_version  VARCHAR(500),
     capability_fhir_version VARCHAR(500),
+    capability_statement_format VARCHAR(500),
+    bulk_data               JSONB,
     CONSTRAINT fhir_endpoints_info_unique UNIQUE(url, requested_fhir_version, vendor_id)
 );
 
@@ -250,7 +426,9 @@ CREATE TABLE fhir_endpoints_info_history (
     smart_response          JSON, 
     metadata_id             INT REFERENCES fhir_endpoints_metadata(id) ON DELETE SET NULL,
     requested_fhir_version  VARCHAR(500),
-    capability_fhir_version VARCHAR(500)
+    capability_fhir_version VARCHAR(500),
+    capability_statement_format VARCHAR(500),
+    bulk_data               JSONB
 );
 
 CREATE TABLE endpoint_organization (
@@ -440,6 +618,44 @@ SELECT export_tables.url, export_tables.list_source, export_tables.endpoint_name
 FROM joined_export_tables AS export_tables
 LEFT JOIN list_source_info ON export_tables.list_source = list_source_info.list_source;
 
+-- The developer of each endpoint is the vendor that the capability receiver attributed it to
+CREATE or REPLACE VIEW cds_hooks_export AS
+SELECT endpts_info.url, endpts_info.requested_fhir_version, vendors.name AS vendor_name,
+    cds_hooks.http_response AS cds_hooks_http_response,
+    cds_hooks.error AS cds_hooks_error,
+    COALESCE(jsonb_array_length(cds_hooks.services), 0) AS cds_service_count,
+    cds_hooks.service_ids, cds_hooks.hook_types,
+    cds_hooks.created_at AS cds_hooks_updated
+FROM fhir_endpoints_info AS endpts_info
+LEFT JOIN vendors ON endpts_info.vendor_id = vendors.id
+LEFT JOIN fhir_endpoints_cds_hooks AS cds_hooks ON endpts_info.metadata_id = cds_hooks.metadata_id;
+
+-- Each row is a lookup whose hosting providers differ from the previous successful lookup of the same endpoint
+CREATE or REPLACE VIEW hosting_provider_migrations AS
+SELECT url, host, previous_hosting_providers, hosting_providers, created_at AS migrated_at
+FROM (
+    SELECT url, host, hosting_providers, created_at,
+        LAG(hosting_providers) OVER (PARTITION BY url ORDER BY created_at, id) AS previous_hosting_providers
+    FROM fhir_endpoints_dns
+    WHERE error IS NULL
+) AS lookups
+WHERE previous_hosting_providers IS NOT NULL AND previous_hosting_providers IS DISTINCT FROM hosting_providers;
+
+-- The addresses that the current lookups of more than one endpoint resolved to, with the organizations of those endpoints
+CREATE or REPLACE VIEW shared_host_addresses AS
+SELECT addresses.ip, MAX(addresses.provider) AS hosting_provider,
+    COUNT(DISTINCT endpts_info.url) AS endpoint_count,
+    COUNT(DISTINCT orgs.organization_name) AS organization_count,
+    array_agg(DISTINCT endpts_info.url) AS urls
+FROM fhir_endpoints_info AS endpts_info
+JOIN fhir_endpoints_dns AS dns ON endpts_info.metadata_id = dns.metadata_id
+CROSS JOIN LATERAL jsonb_to_recordset(dns.addresses) AS addresses(ip TEXT, provider TEXT)
+LEFT JOIN fhir_endpoints AS endpts ON endpts_info.url = endpts.url
+LEFT JOIN fhir_endpoint_organizations_map AS org_map ON endpts.id = org_map.id
+LEFT JOIN fhir_endpoint_organizations AS orgs ON org_map.org_database_id = orgs.id
+GROUP BY addresses.ip
+HAVING COUNT(DISTINCT endpts_info.url) > 1;
+
 CREATE or REPLACE VIEW organization_location AS
     SELECT export_tables.url, export_tables.endpoint_names, export_tables.fhir_version,
     export_tables.requested_fhir_version, export_tables.vendor_name, orgs.name AS ORGANIZATION_NAME, orgs.secondary_name AS ORGANIZATION_SECONDARY_NAME,
@@ -465,6 +681,19 @@ CREATE INDEX idx_fhir_endpoints_metadata_url ON fhir_endpoints_metadata(url);
 CREATE INDEX idx_fhir_endpoints_availability_url ON fhir_endpoints_availability(url);
 CREATE INDEX idx_fhir_endpoints_list_source ON fhir_endpoints(list_source);
 
+CREATE INDEX fhir_endpoints_tls_info_metadata_id_idx ON fhir_endpoints_tls_info (metadata_id);
+CREATE INDEX fhir_endpoints_jwks_metadata_id_idx ON fhir_endpoints_jwks (metadata_id);
+CREATE INDEX fhir_endpoints_auth_server_metadata_id_idx ON fhir_endpoints_auth_server (metadata_id);
+CREATE INDEX fhir_endpoints_udap_metadata_id_idx ON fhir_endpoints_udap (metadata_id);
+CREATE INDEX fhir_endpoints_cds_hooks_metadata_id_idx ON fhir_endpoints_cds_hooks (metadata_id);
+CREATE INDEX fhir_endpoints_data_exposure_metadata_id_idx ON fhir_endpoints_data_exposure (metadata_id);
+CREATE INDEX fhir_endpoints_data_exposure_created_at_idx ON fhir_endpoints_data_exposure (created_at);
+CREATE INDEX fhir_endpoints_dns_metadata_id_idx ON fhir_endpoints_dns (metadata_id);
+CREATE INDEX fhir_endpoints_dns_host_idx ON fhir_endpoints_dns (host);
+CREATE INDEX fhir_endpoints_audience_audience_idx ON fhir_endpoints_audience (audience);
+CREATE INDEX host_circuit_events_host_idx ON host_circuit_events (host);
+CREATE INDEX mq_messages_queue_name_visible_at_idx ON mq_messages (queue_name, visible_at, id);
+
 CREATE INDEX vendor_id_idx ON vendors (id);
 CREATE INDEX fhir_endpoints_info_vendor_id_idx ON fhir_endpoints_info (vendor_id);
 CREATE INDEX fhir_endpoints_info_history_vendor_id_idx ON fhir_endpoints_info_history (vendor_id);
@@ -25,6 +25,13 @@ ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT SELECT, INSERT, UPDATE, DELETE O
 GRANT USAGE ON ALL SEQUENCES IN SCHEMA public TO readwrite;
 ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT USAGE ON SEQUENCES TO readwrite; -- grants permissions on new sequences
 
+-- the searches for patient data identify endpoints that expose patient data, so they are left out of the read only
+-- and read/write permissions and are only readable by the users granted dataexposure
+REVOKE ALL ON fhir_endpoints_data_exposure FROM readonly;
+REVOKE ALL ON fhir_endpoints_data_exposure FROM readwrite;
+CREATE ROLE dataexposure;
+GRANT SELECT ON fhir_endpoints_data_exposure TO dataexposure;
+
 \set readonly_user `echo $LANTERN_DBUSER_READONLY`
 \set readonly_pw `echo $LANTERN_DBPASSWORD_READONLY`
 \set readwrite_user `echo $LANTERN_DBUSER_READWRITE`
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/config"
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/helpers"
+	"github.com/onc-healthit/lantern-back-end/lanternmq"
+	"github.com/onc-healthit/lantern-back-end/lanternmq/pkg/accessqueue"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const usage = `usage: main.go <command> <queue> [message id...]
+
+commands:
+  list     lists the messages dead-lettered from the queue
+  inspect  shows the messages with the given IDs, including their bodies
+  requeue  moves the messages with the given IDs, or every message if no IDs are given, back to the queue
+  purge    deletes every message dead-lettered from the queue`
+
+func main() {
+	if len(os.Args) < 3 {
+		log.Fatal(usage)
+	}
+	command := os.Args[1]
+	qName := os.Args[2]
+	ids := os.Args[3:]
+
+	err := config.SetupConfig()
+	helpers.FailOnError("", err)
+
+	mq, ch, err := accessqueue.ConnectToServerAndQueue(viper.GetString("quser"), viper.GetString("qpassword"), viper.GetString("qhost"), viper.GetString("qport"), qName)
+	helpers.FailOnError("", err)
+	defer mq.Close()
+
+	dlq, ok := mq.(lanternmq.DeadLetterQueue)
+	if !ok {
+		log.Fatalf("the %s queue driver does not support dead-lettering", viper.GetString("queue_driver"))
+	}
+
+	switch command {
+	case "list":
+		deadLetters, err := dlq.DeadLetters(ch, qName)
+		helpers.FailOnError("", err)
+		printDeadLetters(deadLetters)
+	case "inspect":
+		if len(ids) == 0 {
+			log.Fatal("ERROR: Missing message IDs to inspect")
+		}
+		deadLetters, err := dlq.DeadLetters(ch, qName)
+		helpers.FailOnError("", err)
+		inspectDeadLetters(deadLetters, ids)
+	case "requeue":
+		count, err := dlq.RequeueDeadLetters(ch, qName, ids)
+		helpers.FailOnError("", err)
+		fmt.Printf("Requeued %d messages to %s\n", count, qName)
+	case "purge":
+		count, err := dlq.PurgeDeadLetters(ch, qName)
+		helpers.FailOnError("", err)
+		fmt.Printf("Deleted %d messages from %s\n", count, lanternmq.DeadLetterQueueName(qName))
+	default:
+		log.Fatal(usage)
+	}
+}
+
+func printDeadLetters(deadLetters []lanternmq.DeadLetter) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tFAILED AT\tATTEMPTS\tERROR")
+	for _, d := range deadLetters {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", d.ID, d.FailedAt.Format(time.RFC3339), d.RetryCount, d.Error)
+	}
+	w.Flush()
+	fmt.Printf("%d dead-lettered messages\n", len(deadLetters))
+}
+
+func inspectDeadLetters(deadLetters []lanternmq.DeadLetter, ids []string) {
+	found := make(map[string]bool)
+	for _, d := range deadLetters {
+		for _, id := range ids {
+			if d.ID != id {
+				continue
+			}
+			found[id] = true
+			fmt.Printf("ID:        %s\n", d.ID)
+			fmt.Printf("Queue:     %s\n", d.Queue)
+			fmt.Printf("Failed at: %s\n", d.FailedAt.Format(time.RFC3339))
+			fmt.Printf("Attempts:  %d\n", d.RetryCount)
+			fmt.Printf("Error:     %s\n", d.Error)
+			fmt.Printf("Body:\n%s\n\n", d.Body)
+		}
+	}
+	for _, id := range ids {
+		if !found[id] {
+			log.Warnf("no dead-lettered message with ID %s", id)
+		}
+	}
+}
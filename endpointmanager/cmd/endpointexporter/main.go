@@ -23,5 +23,9 @@ func main() {
 	sql_query := "COPY (SELECT * FROM endpoint_export) TO '/tmp/export.csv' DELIMITER ',' CSV HEADER;"
 	_, err = store.DB.ExecContext(ctx, sql_query)
 	helpers.FailOnError("Error exporting csv", err)
+	// Copy the CDS Hooks information of each endpoint, with the developer it was attributed to, into a second csv
+	sql_query = "COPY (SELECT * FROM cds_hooks_export) TO '/tmp/cds_hooks_export.csv' DELIMITER ',' CSV HEADER;"
+	_, err = store.DB.ExecContext(ctx, sql_query)
+	helpers.FailOnError("Error exporting CDS Hooks csv", err)
 
 }
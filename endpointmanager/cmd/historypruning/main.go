@@ -32,4 +32,7 @@ func main() {
 	helpers.FailOnError("", err)
 
 	historypruning.PruneInfoHistory(ctx, store, pruningLimit)
+
+	err = historypruning.PruneDataExposureChecks(ctx, store, viper.GetInt("data_exposure_retention"))
+	helpers.FailOnError("", err)
 }
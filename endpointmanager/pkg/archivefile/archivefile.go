@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/lib/pq"
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
 	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager/postgresql"
 	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/helpers"
 	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/workers"
@@ -49,8 +50,17 @@ type smartHTTPResponse struct {
 	ResponseCount int `json:"smart_http_response_count"`
 }
 type responseErrors struct {
-	Error      string `json:"error"`
-	ErrorCount int    `json:"error_count"`
+	Error      string                         `json:"error"`
+	ErrorCode  endpointmanager.QueryErrorCode `json:"error_code"`
+	ErrorCount int                            `json:"error_count"`
+}
+
+// errorKey is what errors are grouped by in the archive. Errors that have been classified are grouped by their
+// code alone, since the messages of errors with the same cause differ in details such as the server's address.
+// Errors recorded before errors were classified have no code and are grouped by their message.
+type errorKey struct {
+	code    endpointmanager.QueryErrorCode
+	message string
 }
 
 // Result is the value that is returned from getting the history data from the
@@ -97,6 +107,7 @@ type metadataEntry struct {
 	HTTPResponse         int
 	SMARTHTTPResponse    int
 	Errors               string
+	ErrorCode            endpointmanager.QueryErrorCode
 	RequestedFhirVersion string
 }
 
@@ -447,7 +458,7 @@ func getMetadata(ctx context.Context, args *map[string]interface{}) error {
 	}
 
 	// Get all rows in the history table between given dates
-	metadataQuery := `SELECT response_time_seconds, http_response, smart_http_response, errors FROM fhir_endpoints_metadata
+	metadataQuery := `SELECT response_time_seconds, http_response, smart_http_response, errors, error_code FROM fhir_endpoints_metadata
 		WHERE updated_at between '` + ha.dateStart + `' AND '` + ha.dateEnd + `' AND url=$1 AND requested_fhir_version=$2 ORDER BY updated_at`
 	metadataRows, err := ha.store.DB.QueryContext(ctx, metadataQuery, ha.fhirURL, ha.requestedFhirVersion)
 	if err != nil {
@@ -464,6 +475,7 @@ func getMetadata(ctx context.Context, args *map[string]interface{}) error {
 	defer metadataRows.Close()
 	for metadataRows.Next() {
 		var e metadataEntry
+		var errorCodeNullable sql.NullString
 
 		e.URL = ha.fhirURL
 		e.RequestedFhirVersion = ha.requestedFhirVersion
@@ -472,7 +484,8 @@ func getMetadata(ctx context.Context, args *map[string]interface{}) error {
 			&e.ResponseTimeSeconds,
 			&e.HTTPResponse,
 			&e.SMARTHTTPResponse,
-			&e.Errors)
+			&e.Errors,
+			&errorCodeNullable)
 		if err != nil {
 			log.Warnf("Error while scanning the rows of the metadata table for URL %s with requested version %s. Error: %s", ha.fhirURL, ha.requestedFhirVersion, err)
 			result := Result{
@@ -484,6 +497,8 @@ func getMetadata(ctx context.Context, args *map[string]interface{}) error {
 			return nil
 		}
 
+		e.ErrorCode = endpointmanager.QueryErrorCode(errorCodeNullable.String)
+
 		history = append(history, e)
 	}
 
@@ -491,7 +506,9 @@ func getMetadata(ctx context.Context, args *map[string]interface{}) error {
 		var respTime []float64
 		httpResponseMap := make(map[int]int)
 		smartHTTPRespMap := make(map[int]int)
-		errorsMap := make(map[string]int)
+		errorsMap := make(map[errorKey]int)
+		// the most recent message of each classified error is kept as an example of the error
+		errorMessages := make(map[errorKey]string)
 		// Keep track of each unique http response, smart http response, and error value
 		// and how many of each unique value there is
 		for _, elem := range history {
@@ -506,11 +523,16 @@ func getMetadata(ctx context.Context, args *map[string]interface{}) error {
 			} else {
 				smartHTTPRespMap[elem.SMARTHTTPResponse] = 1
 			}
-			if val, ok := errorsMap[elem.Errors]; ok {
-				errorsMap[elem.Errors] = val + 1
+			key := errorKey{code: elem.ErrorCode}
+			if elem.ErrorCode == "" {
+				key.message = elem.Errors
+			}
+			if val, ok := errorsMap[key]; ok {
+				errorsMap[key] = val + 1
 			} else {
-				errorsMap[elem.Errors] = 1
+				errorsMap[key] = 1
 			}
+			errorMessages[key] = elem.Errors
 		}
 		// Calculate median of given response times
 		sort.Slice(respTime, func(i, j int) bool {
@@ -546,9 +568,10 @@ func getMetadata(ctx context.Context, args *map[string]interface{}) error {
 			smartHTTPRespArr = append(smartHTTPRespArr, smartResp)
 		}
 		var errorArray []responseErrors
-		for resp, total := range errorsMap {
+		for key, total := range errorsMap {
 			errorResp := responseErrors{
-				Error:      resp,
+				Error:      errorMessages[key],
+				ErrorCode:  key.code,
 				ErrorCount: total,
 			}
 			errorArray = append(errorArray, errorResp)
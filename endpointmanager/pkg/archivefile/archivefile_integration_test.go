@@ -509,6 +509,43 @@ func Test_getMetadata(t *testing.T) {
 		close(resultCh3)
 	}
 
+	// Classified errors are grouped by their code rather than their message
+	refusedMetadata := testMetadata
+	refusedMetadata.Errors = "dial tcp 10.0.0.1:443: connect: connection refused"
+	refusedMetadata.ErrorCode = endpointmanager.ConnectionRefusedCode
+	_, err = store.AddFHIREndpointMetadata(ctx, &refusedMetadata)
+	th.Assert(t, err == nil, err)
+	refusedMetadata.Errors = "dial tcp 10.0.0.2:443: connect: connection refused"
+	_, err = store.AddFHIREndpointMetadata(ctx, &refusedMetadata)
+	th.Assert(t, err == nil, err)
+
+	resultCh6 := make(chan Result)
+	jobArgs6 := make(map[string]interface{})
+	jobArgs6["historyArgs"] = historyArgs{
+		fhirURL:              "http://example.com/DTSU2/",
+		requestedFhirVersion: "None",
+		dateStart:            formatToday,
+		dateEnd:              formatTomorrow,
+		store:                store,
+		result:               resultCh6,
+	}
+
+	go getMetadata(ctx, &jobArgs6)
+
+	for res := range resultCh6 {
+		th.Assert(t, len(res.Summary.Errors) == 2, fmt.Sprintf("Errors should have 2 entries, instead has %d", len(res.Summary.Errors)))
+		for _, respErr := range res.Summary.Errors {
+			if respErr.ErrorCode == endpointmanager.ConnectionRefusedCode {
+				th.Assert(t, respErr.ErrorCount == 2, fmt.Sprintf("Connection refused error count should be 2, is instead %d", respErr.ErrorCount))
+				th.Assert(t, respErr.Error == refusedMetadata.Errors, fmt.Sprintf("Connection refused error should have the most recent message, is instead %s", respErr.Error))
+			} else {
+				th.Assert(t, respErr.Error == "Smart Response Failed", fmt.Sprintf("Unclassified error should be grouped by message, is instead %s", respErr.Error))
+				th.Assert(t, respErr.ErrorCount == 3, fmt.Sprintf("Unclassified error count should be 3, is instead %d", respErr.ErrorCount))
+			}
+		}
+		close(resultCh6)
+	}
+
 	// If the args are not properly formatted
 
 	jobArgs4 := make(map[string]interface{})
@@ -0,0 +1,141 @@
+package capabilityparser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// bulkDataCanonicalBase is the start of the canonical URLs of the artifacts defined by the Bulk Data Access IG
+var bulkDataCanonicalBase = "http://hl7.org/fhir/uv/bulkdata/"
+
+// bulkDataExportOperations are the names of the Bulk Data export operations, and of the operation definitions that
+// define them
+var bulkDataExportOperations = []string{"export", "patient-export", "group-export"}
+
+// GetExportLevels returns the levels at which the capability/conformance statement lists the Bulk Data export
+// operation: "system" for the operations of the server as a whole, and the resource type for the operations of the
+// Patient and Group resources. Each level is listed once, in that order.
+func (cp *baseParser) GetExportLevels() ([]string, error) {
+	found := make(map[string]bool)
+
+	restList, err := cp.GetRest()
+	if err != nil {
+		return nil, err
+	}
+	for _, rest := range restList {
+		operations, err := cp.getOperationList(rest)
+		if err != nil {
+			return nil, err
+		}
+		if containsExportOperation(operations) {
+			found["system"] = true
+		}
+
+		resourceList, err := cp.GetResourceList(rest)
+		if err != nil {
+			return nil, err
+		}
+		for _, resource := range resourceList {
+			resourceType, _ := resource["type"].(string)
+			if resourceType != "Patient" && resourceType != "Group" {
+				continue
+			}
+			operations, err := cp.getOperationList(resource)
+			if err != nil {
+				return nil, err
+			}
+			if containsExportOperation(operations) {
+				found[resourceType] = true
+			}
+		}
+	}
+
+	levels := []string{}
+	for _, level := range []string{"system", "Patient", "Group"} {
+		if found[level] {
+			levels = append(levels, level)
+		}
+	}
+	return levels, nil
+}
+
+// GetBulkDataInstantiates returns the canonical URLs in the capability statement's instantiates field that refer
+// to the Bulk Data Access IG. Conformance statements before STU3 do not have the instantiates field.
+func (cp *baseParser) GetBulkDataInstantiates() ([]string, error) {
+	returnList := []string{}
+
+	instantiates := cp.capStat["instantiates"]
+	if instantiates == nil {
+		return returnList, nil
+	}
+	instantiatesList, ok := instantiates.([]interface{})
+	if !ok {
+		return returnList, fmt.Errorf("unable to cast %s capability statement instantiates value to a []interface{}", cp.version)
+	}
+	for _, canonical := range instantiatesList {
+		canonicalStr, ok := canonical.(string)
+		if !ok {
+			return returnList, fmt.Errorf("unable to cast %s capability statement instantiates array value to a string", cp.version)
+		}
+		if isBulkDataCanonical(canonicalStr) {
+			returnList = append(returnList, canonicalStr)
+		}
+	}
+	return returnList, nil
+}
+
+// getOperationList returns the operations of the given rest or resource element of the capability/conformance statement
+func (cp *baseParser) getOperationList(element map[string]interface{}) ([]map[string]interface{}, error) {
+	var returnList []map[string]interface{}
+
+	operation := element["operation"]
+	if operation == nil {
+		return returnList, nil
+	}
+	operationList, ok := operation.([]interface{})
+	if !ok {
+		return returnList, fmt.Errorf("unable to cast %s capability statement operation list value to an []interface{}", cp.version)
+	}
+	for _, op := range operationList {
+		opMap, ok := op.(map[string]interface{})
+		if !ok {
+			return returnList, fmt.Errorf("unable to cast %s capability statement operation value to a map[string]interface{}", cp.version)
+		}
+		returnList = append(returnList, opMap)
+	}
+	return returnList, nil
+}
+
+// containsExportOperation returns whether one of the operations is a Bulk Data export operation, either by its
+// name or by its definition. The definition is a canonical URL in R4 and a reference in earlier versions.
+func containsExportOperation(operations []map[string]interface{}) bool {
+	for _, operation := range operations {
+		name, _ := operation["name"].(string)
+		name = strings.TrimPrefix(name, "$")
+		for _, exportName := range bulkDataExportOperations {
+			if name == exportName {
+				return true
+			}
+		}
+
+		definition, _ := operation["definition"].(string)
+		if definitionRef, ok := operation["definition"].(map[string]interface{}); ok {
+			definition, _ = definitionRef["reference"].(string)
+		}
+		if isBulkDataCanonical(definition) {
+			definition = strings.SplitN(definition, "|", 2)[0]
+			for _, exportName := range bulkDataExportOperations {
+				if strings.HasSuffix(definition, "/OperationDefinition/"+exportName) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// isBulkDataCanonical returns whether the canonical URL refers to an artifact of the Bulk Data Access IG
+func isBulkDataCanonical(canonical string) bool {
+	canonical = strings.Replace(canonical, "https://", "http://", 1)
+	return strings.HasPrefix(canonical, bulkDataCanonicalBase)
+}
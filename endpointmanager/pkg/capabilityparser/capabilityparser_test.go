@@ -680,6 +680,103 @@ func Test_GetDescription(t *testing.T) {
 	th.Assert(t, actual == expected, fmt.Sprintf("expected %s. received %s.", expected, actual))
 }
 
+func Test_GetExportLevels(t *testing.T) {
+	// no export operations
+
+	cs, err := getDSTU2CapStat()
+	th.Assert(t, err == nil, err)
+
+	levels, err := cs.GetExportLevels()
+	th.Assert(t, err == nil, err)
+	th.Assert(t, levels != nil && len(levels) == 0, fmt.Sprintf("expected no export levels, received %v", levels))
+
+	// export operations at each level, matched by name or by definition
+
+	capStatJSON := []byte(`{
+		"resourceType": "CapabilityStatement",
+		"fhirVersion": "4.0.1",
+		"rest": [{
+			"mode": "server",
+			"resource": [
+				{"type": "Group", "operation": [{"name": "bulk", "definition": "http://hl7.org/fhir/uv/bulkdata/OperationDefinition/group-export|2.0.0"}]},
+				{"type": "Observation", "operation": [{"name": "export"}]},
+				{"type": "Patient", "operation": [{"name": "$export"}]}
+			],
+			"operation": [{"name": "export", "definition": "http://hl7.org/fhir/uv/bulkdata/OperationDefinition/export"}]
+		}]
+	}`)
+	cs, err = NewCapabilityStatement(capStatJSON)
+	th.Assert(t, err == nil, err)
+
+	levels, err = cs.GetExportLevels()
+	th.Assert(t, err == nil, err)
+	th.Assert(t, reflect.DeepEqual(levels, []string{"system", "Patient", "Group"}), fmt.Sprintf("expected system, Patient and Group export levels, received %v", levels))
+
+	// DSTU2 and STU3 operation definitions are references
+
+	capStatJSON = []byte(`{
+		"resourceType": "CapabilityStatement",
+		"fhirVersion": "3.0.1",
+		"rest": [{
+			"mode": "server",
+			"resource": [
+				{"type": "Patient", "operation": [{"name": "everything", "definition": {"reference": "http://hl7.org/fhir/OperationDefinition/Patient-everything"}}, {"name": "bulk", "definition": {"reference": "http://hl7.org/fhir/uv/bulkdata/OperationDefinition/patient-export"}}]}
+			]
+		}]
+	}`)
+	cs, err = NewCapabilityStatement(capStatJSON)
+	th.Assert(t, err == nil, err)
+
+	levels, err = cs.GetExportLevels()
+	th.Assert(t, err == nil, err)
+	th.Assert(t, reflect.DeepEqual(levels, []string{"Patient"}), fmt.Sprintf("expected the Patient export level, received %v", levels))
+
+	// bad format
+
+	capStatJSON = []byte(`{"resourceType": "CapabilityStatement", "fhirVersion": "4.0.1", "rest": [{"operation": "export"}]}`)
+	cs, err = NewCapabilityStatement(capStatJSON)
+	th.Assert(t, err == nil, err)
+
+	_, err = cs.GetExportLevels()
+	th.Assert(t, err != nil, "expected error due to bad format")
+}
+
+func Test_GetBulkDataInstantiates(t *testing.T) {
+	field := "instantiates"
+
+	capStatJSON := []byte(`{
+		"resourceType": "CapabilityStatement",
+		"fhirVersion": "4.0.1",
+		"instantiates": [
+			"http://hl7.org/fhir/uv/bulkdata/CapabilityStatement/bulk-data|2.0.0",
+			"http://hl7.org/fhir/us/core/CapabilityStatement/us-core-server"
+		]
+	}`)
+	cs, err := NewCapabilityStatement(capStatJSON)
+	th.Assert(t, err == nil, err)
+
+	actual, err := cs.GetBulkDataInstantiates()
+	th.Assert(t, err == nil, err)
+	th.Assert(t, reflect.DeepEqual(actual, []string{"http://hl7.org/fhir/uv/bulkdata/CapabilityStatement/bulk-data|2.0.0"}), fmt.Sprintf("expected the Bulk Data capability statement, received %v", actual))
+
+	// bad format
+
+	cs1, err := getBadFormatCapStat(cs, field)
+	th.Assert(t, err == nil, err)
+
+	_, err = cs1.GetBulkDataInstantiates()
+	th.Assert(t, err != nil, "expected error due to bad format")
+
+	// missing field
+
+	cs2, err := deleteFieldFromCapStat(cs, field)
+	th.Assert(t, err == nil, err)
+
+	actual, err = cs2.GetBulkDataInstantiates()
+	th.Assert(t, err == nil, err)
+	th.Assert(t, len(actual) == 0, fmt.Sprintf("expected no instantiates, received %v", actual))
+}
+
 func Test_Equal(t *testing.T) {
 	var cs1 CapabilityStatement
 	var cs2 CapabilityStatement
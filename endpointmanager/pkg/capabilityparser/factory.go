@@ -32,6 +32,8 @@ type CapabilityStatement interface {
 	GetMessagingEndpoint(map[string]interface{}) ([]map[string]interface{}, error)
 	GetDocument() ([]map[string]interface{}, error)
 	GetDescription() (string, error)
+	GetExportLevels() ([]string, error)
+	GetBulkDataInstantiates() ([]string, error)
 
 	Equal(CapabilityStatement) bool
 	EqualIgnore(CapabilityStatement) bool
@@ -0,0 +1,64 @@
+package cdshooksparser
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// CDSService is a single service listed in a CDS Hooks discovery document. The prefetch templates are kept as
+// they are served, keyed by the prefetch key, so that the FHIR queries a service asks for can be analyzed later.
+type CDSService struct {
+	ID          string            `json:"id"`
+	Hook        string            `json:"hook"`
+	Title       string            `json:"title"`
+	Description string            `json:"description"`
+	Prefetch    map[string]string `json:"prefetch"`
+}
+
+// discoveryResponse is the shape of the response to the CDS Hooks discovery endpoint
+type discoveryResponse struct {
+	Services []CDSService `json:"services"`
+}
+
+// ParseDiscovery returns the services listed in a CDS Hooks discovery document. It returns an error if the
+// document is not a JSON object with a services array, since servers that do not support CDS Hooks often answer
+// the discovery request with an HTML page or a FHIR OperationOutcome.
+func ParseDiscovery(respJSON []byte) ([]CDSService, error) {
+	var discovery discoveryResponse
+
+	err := json.Unmarshal(respJSON, &discovery)
+	if err != nil {
+		return nil, errors.Wrap(err, "error unmarshalling CDS Hooks discovery response")
+	}
+	if discovery.Services == nil {
+		return nil, errors.New("the CDS Hooks discovery response does not include a services array")
+	}
+
+	return discovery.Services, nil
+}
+
+// ServiceIDs returns the ids of the services in the order they were listed
+func ServiceIDs(services []CDSService) []string {
+	ids := make([]string, 0, len(services))
+	for _, service := range services {
+		ids = append(ids, service.ID)
+	}
+	return ids
+}
+
+// HookTypes returns the distinct hooks that the services are invoked on, sorted alphabetically
+func HookTypes(services []CDSService) []string {
+	seen := make(map[string]bool)
+	hooks := make([]string, 0, len(services))
+	for _, service := range services {
+		if service.Hook == "" || seen[service.Hook] {
+			continue
+		}
+		seen[service.Hook] = true
+		hooks = append(hooks, service.Hook)
+	}
+	sort.Strings(hooks)
+	return hooks
+}
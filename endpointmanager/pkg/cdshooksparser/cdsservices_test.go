@@ -0,0 +1,68 @@
+package cdshooksparser
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	th "github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/testhelper"
+)
+
+func Test_ParseDiscovery(t *testing.T) {
+	path := filepath.Join("../testdata", "cds_hooks_discovery_response.json")
+	discoveryJSON, err := os.ReadFile(path)
+	th.Assert(t, err == nil, err)
+
+	services, err := ParseDiscovery(discoveryJSON)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, len(services) == 3, fmt.Sprintf("expected 3 services, got %d", len(services)))
+
+	expected := CDSService{
+		ID:          "order-echo",
+		Hook:        "order-select",
+		Title:       "Order Echo CDS Service",
+		Description: "An example of a CDS Service that simply echoes the order(s) being placed",
+		Prefetch: map[string]string{
+			"patient":     "Patient/{{context.patientId}}",
+			"medications": "MedicationRequest?patient={{context.patientId}}",
+		},
+	}
+	th.Assert(t, reflect.DeepEqual(services[1], expected), fmt.Sprintf("expected service %+v, got %+v", expected, services[1]))
+	th.Assert(t, services[2].Prefetch == nil, "expected a service without prefetch templates to have nil prefetch")
+
+	// a server that supports CDS Hooks without any services
+
+	services, err = ParseDiscovery([]byte(`{"services": []}`))
+	th.Assert(t, err == nil, err)
+	th.Assert(t, services != nil && len(services) == 0, fmt.Sprintf("expected an empty list of services, got %+v", services))
+
+	// responses that are not discovery documents
+
+	_, err = ParseDiscovery([]byte(`{"resourceType": "OperationOutcome"}`))
+	th.Assert(t, err != nil, "expected an error for a response without a services array")
+
+	_, err = ParseDiscovery([]byte(`<html><body>Not Found</body></html>`))
+	th.Assert(t, err != nil, "expected an error for a response that is not JSON")
+
+	_, err = ParseDiscovery([]byte(`{"services": [{"id": 1}]}`))
+	th.Assert(t, err != nil, "expected an error for a service id that is not a string")
+}
+
+func Test_HookTypes(t *testing.T) {
+	services := []CDSService{
+		{ID: "static-patient-view", Hook: "patient-view"},
+		{ID: "order-echo", Hook: "order-select"},
+		{ID: "opioid-summary", Hook: "patient-view"},
+		{ID: "no-hook"},
+	}
+
+	hooks := HookTypes(services)
+	th.Assert(t, reflect.DeepEqual(hooks, []string{"order-select", "patient-view"}), fmt.Sprintf("unexpected hook types %v", hooks))
+
+	ids := ServiceIDs(services)
+	th.Assert(t, reflect.DeepEqual(ids, []string{"static-patient-view", "order-echo", "opioid-summary", "no-hook"}), fmt.Sprintf("unexpected service ids %v", ids))
+
+	th.Assert(t, len(HookTypes(nil)) == 0, "expected no hook types for no services")
+}
@@ -59,11 +59,69 @@ func SetupConfig() error {
 	if err != nil {
 		return err
 	}
+	err = viper.BindEnv("queue_driver")
+	if err != nil {
+		return err
+	}
+	err = viper.BindEnv("queue_visibility_timeout") // in seconds
+	if err != nil {
+		return err
+	}
+	err = viper.BindEnv("queue_retry_max_attempts")
+	if err != nil {
+		return err
+	}
+	err = viper.BindEnv("queue_retry_initial_delay") // in seconds
+	if err != nil {
+		return err
+	}
+	err = viper.BindEnv("queue_retry_multiplier")
+	if err != nil {
+		return err
+	}
+	err = viper.BindEnv("queue_retry_max_delay") // in seconds
+	if err != nil {
+		return err
+	}
 	err = viper.BindEnv("capquery_qryintvl") // in minutes
 	if err != nil {
 		return err
 	}
 
+	// Per-host request limits for the capability querier
+	err = viper.BindEnv("query_host_maxconcurrent")
+	if err != nil {
+		return err
+	}
+	err = viper.BindEnv("query_host_qps")
+	if err != nil {
+		return err
+	}
+	err = viper.BindEnv("query_host_breaker_failures")
+	if err != nil {
+		return err
+	}
+	err = viper.BindEnv("query_host_breaker_cooldown") // in seconds
+	if err != nil {
+		return err
+	}
+	err = viper.BindEnv("query_bulkdata_kickoff")
+	if err != nil {
+		return err
+	}
+	err = viper.BindEnv("query_data_exposure_probe")
+	if err != nil {
+		return err
+	}
+	err = viper.BindEnv("query_dns_server")
+	if err != nil {
+		return err
+	}
+	err = viper.BindEnv("query_cloud_ip_ranges_dir")
+	if err != nil {
+		return err
+	}
+
 	// Version Response Queue Setup
 	err = viper.BindEnv("versionsquery_qname")
 	if err != nil {
@@ -89,6 +147,10 @@ func SetupConfig() error {
 	if err != nil {
 		return err
 	}
+	err = viper.BindEnv("data_exposure_retention") // in days
+	if err != nil {
+		return err
+	}
 
 	err = viper.BindEnv("export_numworkers")
 	if err != nil {
@@ -120,13 +182,28 @@ func SetupConfig() error {
 	viper.SetDefault("qpassword", "capabilityquerier")
 	viper.SetDefault("qhost", "localhost")
 	viper.SetDefault("qport", "5672")
+	viper.SetDefault("queue_driver", "rabbitmq")
+	viper.SetDefault("queue_visibility_timeout", 600)
+	viper.SetDefault("queue_retry_max_attempts", 5)
+	viper.SetDefault("queue_retry_initial_delay", 30)
+	viper.SetDefault("queue_retry_multiplier", 2)
+	viper.SetDefault("queue_retry_max_delay", 1800)
 	viper.SetDefault("capquery_qname", "capability-statements")
 	viper.SetDefault("endptinfo_capquery_qname", "endpoints-to-capability")
 	viper.SetDefault("versionsquery_qname", "version-responses")
 	viper.SetDefault("versionsquery_response_qname", "endpoints-to-version-responses")
 	viper.SetDefault("capquery_qryintvl", 1380) // 1380 minutes -> 23 hours.
+	viper.SetDefault("query_host_maxconcurrent", 2)
+	viper.SetDefault("query_host_qps", 2.0)
+	viper.SetDefault("query_host_breaker_failures", 5)
+	viper.SetDefault("query_host_breaker_cooldown", 300) // 300 seconds -> 5 minutes.
+	viper.SetDefault("query_bulkdata_kickoff", false)
+	viper.SetDefault("query_data_exposure_probe", false)
+	viper.SetDefault("query_dns_server", "")
+	viper.SetDefault("query_cloud_ip_ranges_dir", "")
 
 	viper.SetDefault("pruning_threshold", 43800) // 43800 minutes -> 1 month.
+	viper.SetDefault("data_exposure_retention", 30)
 
 	viper.SetDefault("export_numworkers", 25)
 	viper.SetDefault("export_duration", 240)
@@ -0,0 +1,139 @@
+package endpointmanager
+
+import (
+	"math"
+	"strings"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/smartparser"
+)
+
+// Audience is an enum of the users an endpoint's API is meant for
+type Audience string
+
+const (
+	PatientAccessAudience  Audience = "patient_access"  // patients using apps they choose, such as (g)(10) APIs
+	ProviderSystemAudience Audience = "provider_system" // clinicians using EHR launched apps and backend services
+	PayerAudience          Audience = "payer"           // payer APIs such as CARIN Blue Button, PDex and Plan-Net
+	UnknownAudience        Audience = "unknown"         // none of the endpoint's data says who it is meant for
+)
+
+// audiences is the order audiences are picked in when they have the same score
+var audiences = []Audience{PayerAudience, PatientAccessAudience, ProviderSystemAudience}
+
+// AudienceClassification is the audience an endpoint is most likely meant for. Confidence is the share of the
+// weight of all of the signals that point to that audience, from 0 to 1.
+type AudienceClassification struct {
+	Audience   Audience `json:"audience"`
+	Confidence float64  `json:"confidence"`
+	Signals    []string `json:"signals"` // the signals that were found, such as "smart capability: launch-standalone"
+}
+
+// audienceSignal is a value found in an endpoint's data and how strongly it points to an audience
+type audienceSignal struct {
+	audience Audience
+	weight   int
+}
+
+// listSourceSignals are the categories of the lists an endpoint was found on, as saved in list_source_info.
+// Certified API developers are required to support standalone patient launch for their (g)(10) endpoints.
+var listSourceSignals = map[string]audienceSignal{
+	"CHPL":           {PatientAccessAudience, 2},
+	"Payer":          {PayerAudience, 3},
+	"State Medicaid": {PayerAudience, 3},
+}
+
+// smartCapabilitySignals are the SMART capabilities that are mostly served by endpoints for a single audience
+var smartCapabilitySignals = map[string]audienceSignal{
+	"launch-standalone":              {PatientAccessAudience, 1},
+	"permission-patient":             {PatientAccessAudience, 1},
+	"launch-ehr":                     {ProviderSystemAudience, 1},
+	"client-confidential-asymmetric": {ProviderSystemAudience, 1},
+}
+
+// prefixSignal is an audienceSignal for the values that start with prefix
+type prefixSignal struct {
+	prefix string
+	audienceSignal
+}
+
+// profileSignals are the canonical URL prefixes of the implementation guides that are only used by payers
+var profileSignals = []prefixSignal{
+	{"http://hl7.org/fhir/us/carin-bb/", audienceSignal{PayerAudience, 2}},
+	{"http://hl7.org/fhir/us/davinci-pdex/", audienceSignal{PayerAudience, 2}},
+	{"http://hl7.org/fhir/us/davinci-pdex-plan-net/", audienceSignal{PayerAudience, 2}},
+}
+
+// scopeSignals are the prefixes of SMART scopes
+var scopeSignals = []prefixSignal{
+	{"patient/", audienceSignal{PatientAccessAudience, 1}},
+	{"user/", audienceSignal{ProviderSystemAudience, 1}},
+	{"system/", audienceSignal{ProviderSystemAudience, 1}},
+}
+
+// ClassifyAudience returns the audience an endpoint is most likely meant for, given the categories of the lists it
+// was found on, its SMART configuration and the profiles its capability statement declares. Each signal is only
+// counted once, so a capability statement that declares many CARIN Blue Button profiles does not outweigh the other
+// signals. An endpoint without any signals is classified as UnknownAudience with a confidence of 0.
+func ClassifyAudience(listSourceCategories []string, smartConfig *smartparser.SMARTConfiguration, supportedProfiles []SupportedProfile) AudienceClassification {
+	scores := make(map[Audience]int)
+	signals := []string{}
+	found := make(map[string]bool)
+	addSignal := func(name string, signal audienceSignal) {
+		if found[name] {
+			return
+		}
+		found[name] = true
+		scores[signal.audience] += signal.weight
+		signals = append(signals, name)
+	}
+
+	for _, category := range listSourceCategories {
+		if signal, ok := listSourceSignals[category]; ok {
+			addSignal("list source: "+category, signal)
+		}
+	}
+
+	if smartConfig != nil {
+		for _, capability := range smartConfig.Capabilities {
+			if signal, ok := smartCapabilitySignals[capability]; ok {
+				addSignal("smart capability: "+capability, signal)
+			}
+		}
+		for _, scope := range smartConfig.ScopesSupported {
+			for _, signal := range scopeSignals {
+				if strings.HasPrefix(scope, signal.prefix) {
+					addSignal("scope: "+signal.prefix+"*", signal.audienceSignal)
+				}
+			}
+		}
+	}
+
+	for _, profile := range supportedProfiles {
+		for _, signal := range profileSignals {
+			if strings.HasPrefix(profile.ProfileURL, signal.prefix+"StructureDefinition/") {
+				addSignal("profile: "+signal.prefix, signal.audienceSignal)
+			}
+		}
+	}
+
+	total := 0
+	for _, score := range scores {
+		total += score
+	}
+	if total == 0 {
+		return AudienceClassification{Audience: UnknownAudience, Confidence: 0, Signals: signals}
+	}
+
+	best := audiences[0]
+	for _, audience := range audiences[1:] {
+		if scores[audience] > scores[best] {
+			best = audience
+		}
+	}
+
+	return AudienceClassification{
+		Audience:   best,
+		Confidence: math.Round(float64(scores[best])/float64(total)*1000) / 1000,
+		Signals:    signals,
+	}
+}
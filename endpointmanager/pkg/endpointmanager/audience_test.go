@@ -0,0 +1,74 @@
+package endpointmanager
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/smartparser"
+)
+
+func Test_ClassifyAudience(t *testing.T) {
+	patientConfig := &smartparser.SMARTConfiguration{
+		Capabilities:    []string{"launch-standalone", "permission-patient", "client-public"},
+		ScopesSupported: []string{"patient/*.read", "patient/Observation.rs", "openid"},
+	}
+	backendConfig := &smartparser.SMARTConfiguration{
+		Capabilities:    []string{"client-confidential-asymmetric"},
+		ScopesSupported: []string{"system/*.read"},
+	}
+	payerProfiles := []SupportedProfile{
+		{ProfileURL: "http://hl7.org/fhir/us/carin-bb/StructureDefinition/C4BB-ExplanationOfBenefit"},
+		{ProfileURL: "http://hl7.org/fhir/us/carin-bb/StructureDefinition/C4BB-Coverage"},
+		{ProfileURL: "http://hl7.org/fhir/us/davinci-pdex-plan-net/StructureDefinition/plannet-Organization"},
+		{ProfileURL: "http://hl7.org/fhir/us/core/StructureDefinition/us-core-patient"},
+	}
+
+	tests := []struct {
+		name                 string
+		listSourceCategories []string
+		smartConfig          *smartparser.SMARTConfiguration
+		supportedProfiles    []SupportedProfile
+		expected             AudienceClassification
+	}{
+		{"no signals", nil, nil, nil, AudienceClassification{Audience: UnknownAudience, Confidence: 0, Signals: []string{}}},
+		{"unknown list source", []string{"Other"}, nil, nil, AudienceClassification{Audience: UnknownAudience, Confidence: 0, Signals: []string{}}},
+		{"patient access", []string{"CHPL"}, patientConfig, nil, AudienceClassification{
+			Audience:   PatientAccessAudience,
+			Confidence: 1,
+			Signals:    []string{"list source: CHPL", "smart capability: launch-standalone", "smart capability: permission-patient", "scope: patient/*"},
+		}},
+		{"backend services", nil, backendConfig, nil, AudienceClassification{
+			Audience:   ProviderSystemAudience,
+			Confidence: 1,
+			Signals:    []string{"smart capability: client-confidential-asymmetric", "scope: system/*"},
+		}},
+		{"certified endpoint that also supports backend services", []string{"CHPL"}, backendConfig, nil, AudienceClassification{
+			Audience:   PatientAccessAudience,
+			Confidence: 0.5,
+			Signals:    []string{"list source: CHPL", "smart capability: client-confidential-asymmetric", "scope: system/*"},
+		}},
+		{"payer profiles are counted once per implementation guide", []string{"Payer"}, patientConfig, payerProfiles, AudienceClassification{
+			Audience:   PayerAudience,
+			Confidence: 0.7,
+			Signals: []string{"list source: Payer", "smart capability: launch-standalone", "smart capability: permission-patient", "scope: patient/*",
+				"profile: http://hl7.org/fhir/us/carin-bb/", "profile: http://hl7.org/fhir/us/davinci-pdex-plan-net/"},
+		}},
+		{"payer wins a tie", nil, &smartparser.SMARTConfiguration{Capabilities: []string{"launch-standalone", "permission-patient"}}, payerProfiles[:1], AudienceClassification{
+			Audience:   PayerAudience,
+			Confidence: 0.5,
+			Signals:    []string{"smart capability: launch-standalone", "smart capability: permission-patient", "profile: http://hl7.org/fhir/us/carin-bb/"},
+		}},
+		{"state medicaid", []string{"State Medicaid", "State Medicaid"}, nil, nil, AudienceClassification{
+			Audience:   PayerAudience,
+			Confidence: 1,
+			Signals:    []string{"list source: State Medicaid"},
+		}},
+	}
+
+	for _, test := range tests {
+		actual := ClassifyAudience(test.listSourceCategories, test.smartConfig, test.supportedProfiles)
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.expected, actual)
+		}
+	}
+}
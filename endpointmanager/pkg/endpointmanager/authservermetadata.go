@@ -0,0 +1,62 @@
+package endpointmanager
+
+import (
+	"time"
+)
+
+// AuthServerMetadata represents the request for the OpenID Connect or OAuth 2.0 authorization server metadata
+// published by the issuer of a FHIR endpoint's authorization server, and the endpoints that it lists.
+type AuthServerMetadata struct {
+	ID                    int       `json:"-"`
+	DocumentType          string    `json:"documentType"` // openid-configuration or oauth-authorization-server
+	URL                   string    `json:"url"`
+	RequestedIssuer       string    `json:"requestedIssuer"` // the issuer whose metadata was requested
+	HTTPResponse          int       `json:"httpResponse"`
+	Error                 string    `json:"error"` // why the metadata could not be retrieved or parsed. Empty if it was.
+	Issuer                string    `json:"issuer"`
+	AuthorizationEndpoint string    `json:"authorizationEndpoint"`
+	TokenEndpoint         string    `json:"tokenEndpoint"`
+	JWKSURI               string    `json:"jwksUri"`
+	CreatedAt             time.Time `json:"-"`
+}
+
+// Equal checks each field of the two AuthServerMetadatas except for the database ID and CreatedAt fields to see if they are equal.
+func (a *AuthServerMetadata) Equal(a2 *AuthServerMetadata) bool {
+	if a == nil && a2 == nil {
+		return true
+	} else if a == nil {
+		return false
+	} else if a2 == nil {
+		return false
+	}
+
+	if a.DocumentType != a2.DocumentType {
+		return false
+	}
+	if a.URL != a2.URL {
+		return false
+	}
+	if a.RequestedIssuer != a2.RequestedIssuer {
+		return false
+	}
+	if a.HTTPResponse != a2.HTTPResponse {
+		return false
+	}
+	if a.Error != a2.Error {
+		return false
+	}
+	if a.Issuer != a2.Issuer {
+		return false
+	}
+	if a.AuthorizationEndpoint != a2.AuthorizationEndpoint {
+		return false
+	}
+	if a.TokenEndpoint != a2.TokenEndpoint {
+		return false
+	}
+	if a.JWKSURI != a2.JWKSURI {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,67 @@
+package endpointmanager
+
+import (
+	"testing"
+)
+
+func Test_AuthServerMetadataEqual(t *testing.T) {
+	var a1 = &AuthServerMetadata{
+		ID:                    1,
+		DocumentType:          "openid-configuration",
+		URL:                   "https://example.com/.well-known/openid-configuration",
+		RequestedIssuer:       "https://example.com",
+		HTTPResponse:          200,
+		Issuer:                "https://example.com",
+		AuthorizationEndpoint: "https://example.com/authorize",
+		TokenEndpoint:         "https://example.com/token",
+		JWKSURI:               "https://example.com/jwks"}
+
+	var a2 = &AuthServerMetadata{
+		ID:                    2,
+		DocumentType:          "openid-configuration",
+		URL:                   "https://example.com/.well-known/openid-configuration",
+		RequestedIssuer:       "https://example.com",
+		HTTPResponse:          200,
+		Issuer:                "https://example.com",
+		AuthorizationEndpoint: "https://example.com/authorize",
+		TokenEndpoint:         "https://example.com/token",
+		JWKSURI:               "https://example.com/jwks"}
+
+	if !a1.Equal(a2) {
+		t.Errorf("Expected auth server metadata 1 to equal auth server metadata 2. They are not equal.")
+	}
+
+	a2.DocumentType = "oauth-authorization-server"
+	if a1.Equal(a2) {
+		t.Errorf("Did not expect auth server metadata 1 to equal auth server metadata 2. DocumentType should be different. %s vs %s", a1.DocumentType, a2.DocumentType)
+	}
+	a2.DocumentType = a1.DocumentType
+
+	a2.Issuer = "https://other.example.com"
+	if a1.Equal(a2) {
+		t.Errorf("Did not expect auth server metadata 1 to equal auth server metadata 2. Issuer should be different. %s vs %s", a1.Issuer, a2.Issuer)
+	}
+	a2.Issuer = a1.Issuer
+
+	a2.TokenEndpoint = "https://other.example.com/token"
+	if a1.Equal(a2) {
+		t.Errorf("Did not expect auth server metadata 1 to equal auth server metadata 2. TokenEndpoint should be different. %s vs %s", a1.TokenEndpoint, a2.TokenEndpoint)
+	}
+	a2.TokenEndpoint = a1.TokenEndpoint
+
+	a2.Error = "the metadata URL returned HTTP status 404"
+	if a1.Equal(a2) {
+		t.Errorf("Did not expect auth server metadata 1 to equal auth server metadata 2. Error should be different. %s vs %s", a1.Error, a2.Error)
+	}
+	a2.Error = a1.Error
+
+	// test nil
+	a2 = nil
+	if a1.Equal(a2) {
+		t.Errorf("Did not expect auth server metadata 1 to equal nil auth server metadata 2.")
+	}
+	a1 = nil
+	if !a1.Equal(a2) {
+		t.Errorf("Expected nil auth server metadata 1 to equal nil auth server metadata 2.")
+	}
+}
@@ -0,0 +1,62 @@
+package endpointmanager
+
+import (
+	"net/http"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/helpers"
+)
+
+// BulkDataSupport represents what is known about an endpoint's support for the FHIR Bulk Data Access $export
+// operation, both from its capability statement and from the optional unauthenticated kickoff request.
+type BulkDataSupport struct {
+	ExportLevels []string         `json:"exportLevels"` // the levels the export operation is listed at: system, Patient and Group.
+	Instantiates []string         `json:"instantiates"` // the Bulk Data IG capability statements the capability statement instantiates.
+	Kickoff      *BulkDataKickoff `json:"kickoff"`      // nil if the kickoff request was not sent.
+}
+
+// BulkDataKickoff is the result of an unauthenticated $export kickoff request. A 202 means the server accepted an
+// export without authorization; servers that protect the operation respond with 401 or 403, and servers that do
+// not support it respond with 404 or 405. The export itself is never retrieved.
+type BulkDataKickoff struct {
+	URL          string `json:"url"`
+	HTTPResponse int    `json:"httpResponse"`
+	Error        string `json:"error"` // why the kickoff request did not get a response. Empty if it did.
+}
+
+// Supported returns whether the capability statement advertises the export operation or the Bulk Data IG, or the
+// kickoff request was accepted
+func (b *BulkDataSupport) Supported() bool {
+	if b == nil {
+		return false
+	}
+	if len(b.ExportLevels) > 0 || len(b.Instantiates) > 0 {
+		return true
+	}
+	return b.Kickoff != nil && b.Kickoff.HTTPResponse == http.StatusAccepted
+}
+
+// Equal checks each field of the two BulkDataSupports to see if they are equal.
+func (b *BulkDataSupport) Equal(b2 *BulkDataSupport) bool {
+	if b == nil && b2 == nil {
+		return true
+	} else if b == nil {
+		return false
+	} else if b2 == nil {
+		return false
+	}
+
+	if !helpers.StringArraysEqual(b.ExportLevels, b2.ExportLevels) {
+		return false
+	}
+	if !helpers.StringArraysEqual(b.Instantiates, b2.Instantiates) {
+		return false
+	}
+	if (b.Kickoff == nil) != (b2.Kickoff == nil) {
+		return false
+	}
+	if b.Kickoff != nil && *b.Kickoff != *b2.Kickoff {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,80 @@
+package endpointmanager
+
+import (
+	"testing"
+)
+
+func Test_BulkDataSupportEqual(t *testing.T) {
+	var b1 = &BulkDataSupport{
+		ExportLevels: []string{"system", "Patient"},
+		Instantiates: []string{"http://hl7.org/fhir/uv/bulkdata/CapabilityStatement/bulk-data"},
+		Kickoff:      &BulkDataKickoff{URL: "https://example.com/fhir/$export", HTTPResponse: 401}}
+
+	var b2 = &BulkDataSupport{
+		ExportLevels: []string{"Patient", "system"},
+		Instantiates: []string{"http://hl7.org/fhir/uv/bulkdata/CapabilityStatement/bulk-data"},
+		Kickoff:      &BulkDataKickoff{URL: "https://example.com/fhir/$export", HTTPResponse: 401}}
+
+	if !b1.Equal(b2) {
+		t.Errorf("Expected bulk data support 1 to equal bulk data support 2. They are not equal.")
+	}
+
+	b2.ExportLevels = []string{"system"}
+	if b1.Equal(b2) {
+		t.Errorf("Did not expect bulk data support 1 to equal bulk data support 2. ExportLevels should be different. %v vs %v", b1.ExportLevels, b2.ExportLevels)
+	}
+	b2.ExportLevels = b1.ExportLevels
+
+	b2.Instantiates = nil
+	if b1.Equal(b2) {
+		t.Errorf("Did not expect bulk data support 1 to equal bulk data support 2. Instantiates should be different. %v vs %v", b1.Instantiates, b2.Instantiates)
+	}
+	b2.Instantiates = b1.Instantiates
+
+	b2.Kickoff = &BulkDataKickoff{URL: "https://example.com/fhir/$export", HTTPResponse: 202}
+	if b1.Equal(b2) {
+		t.Errorf("Did not expect bulk data support 1 to equal bulk data support 2. Kickoff should be different. %v vs %v", b1.Kickoff, b2.Kickoff)
+	}
+	b2.Kickoff = nil
+	if b1.Equal(b2) {
+		t.Errorf("Did not expect bulk data support 1 to equal bulk data support 2. Kickoff should be nil in one.")
+	}
+	b2.Kickoff = b1.Kickoff
+
+	// test nil
+	b2 = nil
+	if b1.Equal(b2) {
+		t.Errorf("Did not expect bulk data support 1 to equal nil bulk data support 2.")
+	}
+	b1 = nil
+	if !b1.Equal(b2) {
+		t.Errorf("Expected nil bulk data support 1 to equal nil bulk data support 2.")
+	}
+}
+
+func Test_BulkDataSupportSupported(t *testing.T) {
+	var b *BulkDataSupport
+	if b.Supported() {
+		t.Errorf("Did not expect nil bulk data support to be supported")
+	}
+
+	b = &BulkDataSupport{ExportLevels: []string{}, Instantiates: []string{}}
+	if b.Supported() {
+		t.Errorf("Did not expect bulk data support without export operations to be supported")
+	}
+
+	b.Kickoff = &BulkDataKickoff{HTTPResponse: 401}
+	if b.Supported() {
+		t.Errorf("Did not expect a rejected kickoff to count as support")
+	}
+
+	b.Kickoff.HTTPResponse = 202
+	if !b.Supported() {
+		t.Errorf("Expected an accepted kickoff to count as support")
+	}
+
+	b = &BulkDataSupport{ExportLevels: []string{"Group"}}
+	if !b.Supported() {
+		t.Errorf("Expected a listed export operation to count as support")
+	}
+}
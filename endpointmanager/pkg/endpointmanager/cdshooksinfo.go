@@ -0,0 +1,45 @@
+package endpointmanager
+
+import (
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/cdshooksparser"
+)
+
+// CDSHooksInfo represents the request for the CDS Hooks discovery document at cds-services under a FHIR
+// endpoint's base URL, and the clinical decision support services that it lists.
+type CDSHooksInfo struct {
+	ID           int                         `json:"-"`
+	URL          string                      `json:"url"`
+	HTTPResponse int                         `json:"httpResponse"`
+	Error        string                      `json:"error"`    // why the discovery document could not be retrieved or parsed. Empty if it was.
+	Services     []cdshooksparser.CDSService `json:"services"` // nil if the discovery document could not be parsed.
+	CreatedAt    time.Time                   `json:"-"`
+}
+
+// Equal checks each field of the two CDSHooksInfos except for the database ID and CreatedAt fields to see if they are equal.
+func (c *CDSHooksInfo) Equal(c2 *CDSHooksInfo) bool {
+	if c == nil && c2 == nil {
+		return true
+	} else if c == nil {
+		return false
+	} else if c2 == nil {
+		return false
+	}
+
+	if c.URL != c2.URL {
+		return false
+	}
+	if c.HTTPResponse != c2.HTTPResponse {
+		return false
+	}
+	if c.Error != c2.Error {
+		return false
+	}
+	if !cmp.Equal(c.Services, c2.Services) {
+		return false
+	}
+
+	return true
+}
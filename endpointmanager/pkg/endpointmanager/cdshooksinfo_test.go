@@ -0,0 +1,68 @@
+package endpointmanager
+
+import (
+	"testing"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/cdshooksparser"
+)
+
+func Test_CDSHooksInfoEqual(t *testing.T) {
+	var c1 = &CDSHooksInfo{
+		ID:           1,
+		URL:          "https://example.com/fhir/cds-services",
+		HTTPResponse: 200,
+		Services: []cdshooksparser.CDSService{
+			{ID: "static-patient-view", Hook: "patient-view", Prefetch: map[string]string{"patient": "Patient/{{context.patientId}}"}},
+			{ID: "order-echo", Hook: "order-select"},
+		}}
+
+	var c2 = &CDSHooksInfo{
+		ID:           2,
+		URL:          "https://example.com/fhir/cds-services",
+		HTTPResponse: 200,
+		Services: []cdshooksparser.CDSService{
+			{ID: "static-patient-view", Hook: "patient-view", Prefetch: map[string]string{"patient": "Patient/{{context.patientId}}"}},
+			{ID: "order-echo", Hook: "order-select"},
+		}}
+
+	if !c1.Equal(c2) {
+		t.Errorf("Expected CDS Hooks info 1 to equal CDS Hooks info 2. They are not equal.")
+	}
+
+	c2.URL = "https://other.example.com/fhir/cds-services"
+	if c1.Equal(c2) {
+		t.Errorf("Did not expect CDS Hooks info 1 to equal CDS Hooks info 2. URL should be different. %s vs %s", c1.URL, c2.URL)
+	}
+	c2.URL = c1.URL
+
+	c2.HTTPResponse = 404
+	if c1.Equal(c2) {
+		t.Errorf("Did not expect CDS Hooks info 1 to equal CDS Hooks info 2. HTTPResponse should be different. %d vs %d", c1.HTTPResponse, c2.HTTPResponse)
+	}
+	c2.HTTPResponse = c1.HTTPResponse
+
+	c2.Error = "the CDS Hooks discovery response does not include a services array"
+	if c1.Equal(c2) {
+		t.Errorf("Did not expect CDS Hooks info 1 to equal CDS Hooks info 2. Error should be different. %s vs %s", c1.Error, c2.Error)
+	}
+	c2.Error = c1.Error
+
+	c2.Services = []cdshooksparser.CDSService{
+		{ID: "static-patient-view", Hook: "patient-view", Prefetch: map[string]string{"patient": "Patient/{{context.patientId}}?_elements=name"}},
+		{ID: "order-echo", Hook: "order-select"},
+	}
+	if c1.Equal(c2) {
+		t.Errorf("Did not expect CDS Hooks info 1 to equal CDS Hooks info 2. Services should be different. %v vs %v", c1.Services, c2.Services)
+	}
+	c2.Services = c1.Services
+
+	// test nil
+	c2 = nil
+	if c1.Equal(c2) {
+		t.Errorf("Did not expect CDS Hooks info 1 to equal nil CDS Hooks info 2.")
+	}
+	c1 = nil
+	if !c1.Equal(c2) {
+		t.Errorf("Expected nil CDS Hooks info 1 to equal nil CDS Hooks info 2.")
+	}
+}
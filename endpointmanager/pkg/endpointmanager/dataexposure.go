@@ -0,0 +1,32 @@
+package endpointmanager
+
+import (
+	"net/http"
+)
+
+// DataExposureCheck is the result of a search for patient data made without any authorization. Only the shape of
+// the response is kept: the resources it returned are never read or saved.
+type DataExposureCheck struct {
+	Search       string `json:"search"` // the search that was made, such as Patient?_count=1
+	HTTPResponse int    `json:"httpResponse"`
+	ResourceType string `json:"resourceType"` // the resourceType of the response. Empty if the response was not a FHIR resource.
+	Total        *int   `json:"total"`        // the total of the Bundle. nil if the response did not include one.
+	EntryCount   int    `json:"entryCount"`   // the number of entries in the Bundle
+	Error        string `json:"error"`        // why the search did not get a response or could not be parsed. Empty if it was.
+}
+
+// Exposed returns whether the search returned data without authorization
+func (d DataExposureCheck) Exposed() bool {
+	return d.HTTPResponse == http.StatusOK && d.EntryCount > 0
+}
+
+// ExposedSearches returns the searches in checks that returned data without authorization
+func ExposedSearches(checks []DataExposureCheck) []string {
+	var exposed []string
+	for _, check := range checks {
+		if check.Exposed() {
+			exposed = append(exposed, check.Search)
+		}
+	}
+	return exposed
+}
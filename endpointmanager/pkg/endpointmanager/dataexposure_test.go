@@ -0,0 +1,24 @@
+package endpointmanager
+
+import (
+	"testing"
+)
+
+func Test_ExposedSearches(t *testing.T) {
+	total := 1
+	checks := []DataExposureCheck{
+		{Search: "Patient?_count=1", HTTPResponse: 200, ResourceType: "Bundle", Total: &total, EntryCount: 1},
+		{Search: "Observation?_count=1", HTTPResponse: 200, ResourceType: "Bundle", EntryCount: 0},
+		{Search: "Condition?_count=1", HTTPResponse: 401, ResourceType: "OperationOutcome"},
+		{Search: "Encounter?_count=1", Error: "connection refused"},
+	}
+
+	exposed := ExposedSearches(checks)
+	if len(exposed) != 1 || exposed[0] != "Patient?_count=1" {
+		t.Errorf("Expected only the Patient search to be exposed, got %v", exposed)
+	}
+
+	if ExposedSearches(nil) != nil {
+		t.Errorf("Expected no exposed searches when no searches were made")
+	}
+}
@@ -0,0 +1,95 @@
+package endpointmanager
+
+import (
+	"net"
+	"sort"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// DNSInfo represents the DNS lookup of a FHIR endpoint's host made before its capability statement was requested,
+// and the hosting providers that its addresses belong to.
+type DNSInfo struct {
+	ID         int          `json:"-"`
+	Host       string       `json:"host"`
+	CNAMEChain []string     `json:"cnameChain"` // the canonical names the host is an alias of, in the order they were followed
+	Addresses  []DNSAddress `json:"addresses"`  // the addresses of the A and AAAA records
+	TTL        int          `json:"ttl"`        // the smallest TTL, in seconds, of the records that were followed
+	Error      string       `json:"error"`      // why the host could not be resolved. Empty if it was.
+	CreatedAt  time.Time    `json:"-"`
+}
+
+// DNSAddress is an address of a host and the hosting provider it belongs to, if it is in one of the published IP
+// ranges that were loaded
+type DNSAddress struct {
+	IP       string `json:"ip"`
+	Provider string `json:"provider"` // such as AWS, Azure or GCP. Empty if the address is not in a known range.
+	Region   string `json:"region"`
+	Service  string `json:"service"`
+}
+
+// IsIPv6 returns whether the address is an IPv6 address, which means it came from an AAAA record
+func (a DNSAddress) IsIPv6() bool {
+	ip := net.ParseIP(a.IP)
+	return ip != nil && ip.To4() == nil
+}
+
+// SupportsIPv6 returns whether the host has an IPv6 address
+func (d *DNSInfo) SupportsIPv6() bool {
+	if d == nil {
+		return false
+	}
+	for _, address := range d.Addresses {
+		if address.IsIPv6() {
+			return true
+		}
+	}
+	return false
+}
+
+// HostingProviders returns the distinct hosting providers of the host's addresses in alphabetical order
+func (d *DNSInfo) HostingProviders() []string {
+	if d == nil {
+		return nil
+	}
+	found := make(map[string]bool)
+	var providers []string
+	for _, address := range d.Addresses {
+		if address.Provider != "" && !found[address.Provider] {
+			found[address.Provider] = true
+			providers = append(providers, address.Provider)
+		}
+	}
+	sort.Strings(providers)
+	return providers
+}
+
+// Equal checks each field of the two DNSInfos except for the database ID and CreatedAt fields to see if they are equal.
+func (d *DNSInfo) Equal(d2 *DNSInfo) bool {
+	if d == nil && d2 == nil {
+		return true
+	} else if d == nil {
+		return false
+	} else if d2 == nil {
+		return false
+	}
+
+	if d.Host != d2.Host {
+		return false
+	}
+	if !cmp.Equal(d.CNAMEChain, d2.CNAMEChain) {
+		return false
+	}
+	if !cmp.Equal(d.Addresses, d2.Addresses) {
+		return false
+	}
+	if d.TTL != d2.TTL {
+		return false
+	}
+	if d.Error != d2.Error {
+		return false
+	}
+
+	return true
+}
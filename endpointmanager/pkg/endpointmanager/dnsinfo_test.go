@@ -0,0 +1,101 @@
+package endpointmanager
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_DNSInfoEqual(t *testing.T) {
+	var d1 = &DNSInfo{
+		ID:         1,
+		Host:       "fhir.example.com",
+		CNAMEChain: []string{"fhir.example.com.cdn.example.net"},
+		Addresses: []DNSAddress{
+			{IP: "3.5.140.1", Provider: "AWS", Region: "us-east-1", Service: "AMAZON"},
+			{IP: "2600:1f18::1", Provider: "AWS", Region: "us-east-1", Service: "AMAZON"},
+		},
+		TTL: 60}
+
+	var d2 = &DNSInfo{
+		ID:         2,
+		Host:       "fhir.example.com",
+		CNAMEChain: []string{"fhir.example.com.cdn.example.net"},
+		Addresses: []DNSAddress{
+			{IP: "3.5.140.1", Provider: "AWS", Region: "us-east-1", Service: "AMAZON"},
+			{IP: "2600:1f18::1", Provider: "AWS", Region: "us-east-1", Service: "AMAZON"},
+		},
+		TTL: 60}
+
+	if !d1.Equal(d2) {
+		t.Errorf("Expected DNS info 1 to equal DNS info 2. They are not equal.")
+	}
+
+	d2.Host = "other.example.com"
+	if d1.Equal(d2) {
+		t.Errorf("Did not expect DNS info 1 to equal DNS info 2. Host should be different. %s vs %s", d1.Host, d2.Host)
+	}
+	d2.Host = d1.Host
+
+	d2.CNAMEChain = nil
+	if d1.Equal(d2) {
+		t.Errorf("Did not expect DNS info 1 to equal DNS info 2. CNAMEChain should be different. %v vs %v", d1.CNAMEChain, d2.CNAMEChain)
+	}
+	d2.CNAMEChain = d1.CNAMEChain
+
+	d2.Addresses = []DNSAddress{{IP: "20.42.0.1", Provider: "Azure", Region: "eastus", Service: "AzureCloud"}}
+	if d1.Equal(d2) {
+		t.Errorf("Did not expect DNS info 1 to equal DNS info 2. Addresses should be different. %v vs %v", d1.Addresses, d2.Addresses)
+	}
+	d2.Addresses = d1.Addresses
+
+	d2.TTL = 300
+	if d1.Equal(d2) {
+		t.Errorf("Did not expect DNS info 1 to equal DNS info 2. TTL should be different. %d vs %d", d1.TTL, d2.TTL)
+	}
+	d2.TTL = d1.TTL
+
+	d2.Error = "no such host"
+	if d1.Equal(d2) {
+		t.Errorf("Did not expect DNS info 1 to equal DNS info 2. Error should be different. %s vs %s", d1.Error, d2.Error)
+	}
+	d2.Error = d1.Error
+
+	// test nil
+	d2 = nil
+	if d1.Equal(d2) {
+		t.Errorf("Did not expect DNS info 1 to equal nil DNS info 2.")
+	}
+	d1 = nil
+	if !d1.Equal(d2) {
+		t.Errorf("Expected nil DNS info 1 to equal nil DNS info 2.")
+	}
+}
+
+func Test_DNSInfoHostingProviders(t *testing.T) {
+	d := &DNSInfo{
+		Host: "fhir.example.com",
+		Addresses: []DNSAddress{
+			{IP: "34.80.0.1", Provider: "GCP", Region: "asia-east1", Service: "Google Cloud"},
+			{IP: "3.5.140.1", Provider: "AWS", Region: "us-east-1", Service: "AMAZON"},
+			{IP: "3.5.140.2", Provider: "AWS", Region: "us-east-1", Service: "AMAZON"},
+			{IP: "192.0.2.1"},
+		}}
+
+	providers := d.HostingProviders()
+	if !reflect.DeepEqual(providers, []string{"AWS", "GCP"}) {
+		t.Errorf("Expected the hosting providers to be AWS and GCP, got %v", providers)
+	}
+	if d.SupportsIPv6() {
+		t.Errorf("Did not expect a host without IPv6 addresses to support IPv6")
+	}
+
+	d.Addresses = append(d.Addresses, DNSAddress{IP: "2001:db8::1"})
+	if !d.SupportsIPv6() {
+		t.Errorf("Expected a host with an IPv6 address to support IPv6")
+	}
+
+	var nilInfo *DNSInfo
+	if nilInfo.SupportsIPv6() || nilInfo.HostingProviders() != nil {
+		t.Errorf("Expected nil DNS info to have no hosting providers and not support IPv6")
+	}
+}
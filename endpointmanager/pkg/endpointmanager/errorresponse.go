@@ -0,0 +1,76 @@
+package endpointmanager
+
+import (
+	"net/http"
+)
+
+// ErrorResponse is what is kept of a capability statement response with a 4xx or 5xx status. It is used to tell an
+// endpoint whose capability statement requires authorization apart from one that is failing or that is not at the
+// requested base URL.
+type ErrorResponse struct {
+	Kind           ErrorResponseKind `json:"kind"`
+	Body           string            `json:"body"`           // the start of the response body. Long bodies are truncated.
+	Issues         []OutcomeIssue    `json:"issues"`         // the issues of the body if it is an OperationOutcome. nil if it is not.
+	AuthChallenges []AuthChallenge   `json:"authChallenges"` // the challenges of the WWW-Authenticate header. nil if there was none.
+}
+
+// OutcomeIssue is the part of an OperationOutcome issue that describes why a request failed
+type OutcomeIssue struct {
+	Severity    string `json:"severity"`
+	Code        string `json:"code"`
+	Diagnostics string `json:"diagnostics"`
+}
+
+// AuthChallenge is a single challenge of a WWW-Authenticate header, such as
+// Bearer realm="example", error="invalid_token"
+type AuthChallenge struct {
+	Scheme string `json:"scheme"`
+	Realm  string `json:"realm"`
+	Error  string `json:"error"`
+}
+
+// ErrorResponseKind is an enum of the reasons a capability statement request failed with a 4xx or 5xx status
+type ErrorResponseKind string
+
+const (
+	AuthRequiredKind ErrorResponseKind = "auth_required" // the capability statement requires authorization
+	NotFoundKind     ErrorResponseKind = "not_found"     // there is no capability statement at the URL, which is likely not a FHIR base URL
+	ServerErrorKind  ErrorResponseKind = "server_error"  // the server failed to respond with the capability statement
+	ClientErrorKind  ErrorResponseKind = "client_error"  // the server refused the request for another reason
+)
+
+// authIssueCodes are the OperationOutcome issue codes that mean the request was refused for lack of authorization
+var authIssueCodes = map[string]bool{
+	"security":  true,
+	"login":     true,
+	"forbidden": true,
+	"expired":   true,
+	"unknown":   true,
+}
+
+// ClassifyErrorResponse returns the reason a request that returned the given 4xx or 5xx status failed. A 401 or 403
+// status, an authentication challenge or an OperationOutcome with an authorization issue mean that authorization is
+// required, even when the server uses another status.
+func ClassifyErrorResponse(httpResponse int, errorResponse *ErrorResponse) ErrorResponseKind {
+	if httpResponse == http.StatusUnauthorized || httpResponse == http.StatusForbidden || httpResponse == http.StatusProxyAuthRequired {
+		return AuthRequiredKind
+	}
+	if errorResponse != nil {
+		if len(errorResponse.AuthChallenges) > 0 {
+			return AuthRequiredKind
+		}
+		for _, issue := range errorResponse.Issues {
+			if authIssueCodes[issue.Code] {
+				return AuthRequiredKind
+			}
+		}
+	}
+	switch {
+	case httpResponse == http.StatusNotFound || httpResponse == http.StatusGone:
+		return NotFoundKind
+	case httpResponse >= 500:
+		return ServerErrorKind
+	default:
+		return ClientErrorKind
+	}
+}
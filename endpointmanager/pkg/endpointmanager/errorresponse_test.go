@@ -0,0 +1,30 @@
+package endpointmanager
+
+import (
+	"testing"
+)
+
+func Test_ClassifyErrorResponse(t *testing.T) {
+	tests := []struct {
+		name          string
+		httpResponse  int
+		errorResponse *ErrorResponse
+		expected      ErrorResponseKind
+	}{
+		{"unauthorized", 401, nil, AuthRequiredKind},
+		{"forbidden", 403, &ErrorResponse{}, AuthRequiredKind},
+		{"not found", 404, &ErrorResponse{Body: "Not Found"}, NotFoundKind},
+		{"gone", 410, nil, NotFoundKind},
+		{"server error", 500, &ErrorResponse{Issues: []OutcomeIssue{{Severity: "fatal", Code: "exception"}}}, ServerErrorKind},
+		{"bad request", 400, &ErrorResponse{Issues: []OutcomeIssue{{Severity: "error", Code: "invalid"}}}, ClientErrorKind},
+		{"not found with a challenge", 404, &ErrorResponse{AuthChallenges: []AuthChallenge{{Scheme: "Bearer"}}}, AuthRequiredKind},
+		{"bad request with a login issue", 400, &ErrorResponse{Issues: []OutcomeIssue{{Severity: "error", Code: "login"}}}, AuthRequiredKind},
+	}
+
+	for _, test := range tests {
+		actual := ClassifyErrorResponse(test.httpResponse, test.errorResponse)
+		if actual != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, actual)
+		}
+	}
+}
@@ -171,6 +171,45 @@ func NormalizeWellKnownURL(url string) string {
 	return normalized
 }
 
+// Prepends url with https:// and appends with .well-known/udap if needed
+func NormalizeUDAPURL(url string) string {
+	normalized := NormalizeURL(url)
+
+	if !strings.HasSuffix(url, "/.well-known/udap") && !strings.HasSuffix(url, "/.well-known/udap/") {
+		if !strings.HasSuffix(url, "/") {
+			normalized = normalized + "/"
+		}
+		normalized = normalized + ".well-known/udap"
+	}
+	return normalized
+}
+
+// Prepends url with https:// and appends with cds-services if needed
+func NormalizeCDSHooksURL(url string) string {
+	normalized := NormalizeURL(url)
+
+	if !strings.HasSuffix(url, "/cds-services") && !strings.HasSuffix(url, "/cds-services/") {
+		if !strings.HasSuffix(url, "/") {
+			normalized = normalized + "/"
+		}
+		normalized = normalized + "cds-services"
+	}
+	return normalized
+}
+
+// Prepends url with https:// and appends with $export if needed
+func NormalizeExportURL(url string) string {
+	normalized := NormalizeURL(url)
+
+	if !strings.HasSuffix(url, "/$export") && !strings.HasSuffix(url, "/$export/") {
+		if !strings.HasSuffix(url, "/") {
+			normalized = normalized + "/"
+		}
+		normalized = normalized + "$export"
+	}
+	return normalized
+}
+
 // Prepends url with https:// and appends with $versions if needed
 func NormalizeVersionsURL(url string) string {
 	normalized := NormalizeURL(url)
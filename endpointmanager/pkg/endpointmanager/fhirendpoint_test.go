@@ -64,6 +64,42 @@ func Test_FHIREndpoinNormalizeWellKnownURL(t *testing.T) {
 		t.Errorf("Expected foobar.com/.well-known/smart-configuration/ to be normalized to https://foobar.com/.well-known/smart-configuration/")
 	}
 }
+func Test_FHIREndpoinNormalizeUDAPURL(t *testing.T) {
+	if NormalizeUDAPURL("foobar.com") != "https://foobar.com/.well-known/udap" {
+		t.Errorf("Expected foobar.com to be normalized to https://foobar.com/.well-known/udap")
+	}
+	if NormalizeUDAPURL("http://foobar.com/fhir/") != "http://foobar.com/fhir/.well-known/udap" {
+		t.Errorf("Expected http://foobar.com/fhir/ to be normalized to http://foobar.com/fhir/.well-known/udap")
+	}
+	if NormalizeUDAPURL("https://foobar.com/.well-known/udap") != "https://foobar.com/.well-known/udap" {
+		t.Errorf("Expected https://foobar.com/.well-known/udap to be normalized to https://foobar.com/.well-known/udap")
+	}
+	if NormalizeUDAPURL("foobar.com/.well-known/udap/") != "https://foobar.com/.well-known/udap/" {
+		t.Errorf("Expected foobar.com/.well-known/udap/ to be normalized to https://foobar.com/.well-known/udap/")
+	}
+}
+func Test_FHIREndpoinNormalizeCDSHooksURL(t *testing.T) {
+	if NormalizeCDSHooksURL("foobar.com") != "https://foobar.com/cds-services" {
+		t.Errorf("Expected foobar.com to be normalized to https://foobar.com/cds-services")
+	}
+	if NormalizeCDSHooksURL("http://foobar.com/fhir/") != "http://foobar.com/fhir/cds-services" {
+		t.Errorf("Expected http://foobar.com/fhir/ to be normalized to http://foobar.com/fhir/cds-services")
+	}
+	if NormalizeCDSHooksURL("https://foobar.com/cds-services") != "https://foobar.com/cds-services" {
+		t.Errorf("Expected https://foobar.com/cds-services to be normalized to https://foobar.com/cds-services")
+	}
+}
+func Test_FHIREndpoinNormalizeExportURL(t *testing.T) {
+	if NormalizeExportURL("foobar.com") != "https://foobar.com/$export" {
+		t.Errorf("Expected foobar.com to be normalized to https://foobar.com/$export")
+	}
+	if NormalizeExportURL("http://foobar.com/fhir/") != "http://foobar.com/fhir/$export" {
+		t.Errorf("Expected http://foobar.com/fhir/ to be normalized to http://foobar.com/fhir/$export")
+	}
+	if NormalizeExportURL("https://foobar.com/$export") != "https://foobar.com/$export" {
+		t.Errorf("Expected https://foobar.com/$export to be normalized to https://foobar.com/$export")
+	}
+}
 func Test_FHIREndpoinNormalizeURL(t *testing.T) {
 	if NormalizeURL("foobar.com") != "https://foobar.com" {
 		t.Errorf("Expected foobar.com to be normalized to https://foobar.com")
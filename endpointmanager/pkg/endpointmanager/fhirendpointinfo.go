@@ -14,25 +14,27 @@ import (
 // Information about the FHIR API endpoint is populated by the FHIR
 // capability statement found at that endpoint.
 type FHIREndpointInfo struct {
-	ID                       int
-	HealthITProductID        int
-	URL                      string
-	TLSVersion               string
-	MIMETypes                []string
-	VendorID                 int
-	CapabilityStatement      capabilityparser.CapabilityStatement // the JSON representation of the FHIR capability statement
-	CapabilityStatementBytes []byte
-	ValidationID             int
-	CreatedAt                time.Time
-	UpdatedAt                time.Time
-	SMARTResponse            smartparser.SMARTResponse
-	SMARTResponseBytes       []byte
-	IncludedFields           []IncludedField
-	OperationResource        map[string][]string
-	Metadata                 *FHIREndpointMetadata
-	RequestedFhirVersion     string
-	CapabilityFhirVersion    string
-	SupportedProfiles        []SupportedProfile
+	ID                        int
+	HealthITProductID         int
+	URL                       string
+	TLSVersion                string
+	MIMETypes                 []string
+	VendorID                  int
+	CapabilityStatement       capabilityparser.CapabilityStatement // the JSON representation of the FHIR capability statement
+	CapabilityStatementBytes  []byte
+	ValidationID              int
+	CreatedAt                 time.Time
+	UpdatedAt                 time.Time
+	SMARTResponse             smartparser.SMARTResponse
+	SMARTResponseBytes        []byte
+	IncludedFields            []IncludedField
+	OperationResource         map[string][]string
+	Metadata                  *FHIREndpointMetadata
+	RequestedFhirVersion      string
+	CapabilityFhirVersion     string
+	SupportedProfiles         []SupportedProfile
+	CapabilityStatementFormat string           // the format the capability statement was served in, either "json" or "xml"
+	BulkData                  *BulkDataSupport // the endpoint's support for the Bulk Data $export operation
 }
 
 // EqualExcludeMetadata checks each field of the two FHIREndpointInfos except for metadata fields to see if they are equal.
@@ -71,6 +73,13 @@ func (e *FHIREndpointInfo) EqualExcludeMetadata(e2 *FHIREndpointInfo) bool {
 	if e.CapabilityFhirVersion != e2.CapabilityFhirVersion {
 		return false
 	}
+
+	if e.CapabilityStatementFormat != e2.CapabilityStatementFormat {
+		return false
+	}
+	if !e.BulkData.Equal(e2.BulkData) {
+		return false
+	}
 	// because CapabilityStatement is an interface, we need to confirm it's not nil before using the Equal
 	// method.
 	if e.CapabilityStatement != nil && !e.CapabilityStatement.Equal(e2.CapabilityStatement) {
@@ -149,6 +158,34 @@ type Validation struct {
 	Results []Rule
 }
 
+// Equal checks whether the two Validations have the same results. The results may be in any order since the
+// rules of a saved validation are not read back in the order they were added.
+func (v *Validation) Equal(v2 *Validation) bool {
+	if v == nil && v2 == nil {
+		return true
+	} else if v == nil {
+		return false
+	} else if v2 == nil {
+		return false
+	}
+
+	if len(v.Results) != len(v2.Results) {
+		return false
+	}
+	ruleCounts := make(map[Rule]int)
+	for _, rule := range v.Results {
+		ruleCounts[rule]++
+	}
+	for _, rule := range v2.Results {
+		if ruleCounts[rule] == 0 {
+			return false
+		}
+		ruleCounts[rule]--
+	}
+
+	return true
+}
+
 // Rule is the information returned from running the validation rule given by RuleName
 type Rule struct {
 	RuleName  RuleOption
@@ -164,20 +201,46 @@ type Rule struct {
 type RuleOption string
 
 const (
-	CapStatExistRule     RuleOption = "capStatExist"
-	TLSVersion           RuleOption = "tlsVersion"
-	PatResourceExists    RuleOption = "patResourceExists"
-	OtherResourceExists  RuleOption = "otherResourceExists"
-	SmartRespExistsRule  RuleOption = "smartResponse"
-	KindRule             RuleOption = "kindRule"
-	InstanceRule         RuleOption = "instanceRule"
-	MessagingEndptRule   RuleOption = "messagingEndptRule"
-	EndptFunctionRule    RuleOption = "endpointFunctionRule"
-	DescribeEndptRule    RuleOption = "describeEndpointRule"
-	DocumentValidRule    RuleOption = "documentValidRule"
-	UniqueResourcesRule  RuleOption = "uniqueResourcesRule"
-	SearchParamsRule     RuleOption = "searchParamsRule"
-	VersionsResponseRule RuleOption = "versionsResponseRule"
+	CapStatExistRule        RuleOption = "capStatExist"
+	TLSVersion              RuleOption = "tlsVersion"
+	PatResourceExists       RuleOption = "patResourceExists"
+	OtherResourceExists     RuleOption = "otherResourceExists"
+	SmartRespExistsRule     RuleOption = "smartResponse"
+	KindRule                RuleOption = "kindRule"
+	InstanceRule            RuleOption = "instanceRule"
+	MessagingEndptRule      RuleOption = "messagingEndptRule"
+	EndptFunctionRule       RuleOption = "endpointFunctionRule"
+	DescribeEndptRule       RuleOption = "describeEndpointRule"
+	DocumentValidRule       RuleOption = "documentValidRule"
+	UniqueResourcesRule     RuleOption = "uniqueResourcesRule"
+	SearchParamsRule        RuleOption = "searchParamsRule"
+	VersionsResponseRule    RuleOption = "versionsResponseRule"
+	CertExpirationRule      RuleOption = "certificateExpirationRule"
+	CertHostnameRule        RuleOption = "certificateHostnameRule"
+	CertKeyStrengthRule     RuleOption = "certificateKeyStrengthRule"
+	CertSelfSignedRule      RuleOption = "certificateSelfSignedRule"
+	HSTSRule                RuleOption = "hstsRule"
+	CORSRule                RuleOption = "corsRule"
+	ContentTypeRule         RuleOption = "contentTypeRule"
+	RedirectDowngradeRule   RuleOption = "redirectDowngradeRule"
+	RedirectCrossDomainRule RuleOption = "redirectCrossDomainRule"
+	RedirectLoopRule        RuleOption = "redirectLoopRule"
+	SMARTRequiredFieldsRule RuleOption = "smartRequiredFieldsRule"
+	SMARTPKCERule           RuleOption = "smartPkceRule"
+	SMARTLaunchContextRule  RuleOption = "smartLaunchContextRule"
+	SMARTPermissionV2Rule   RuleOption = "smartPermissionV2Rule"
+	SMARTEndpointsHTTPSRule RuleOption = "smartEndpointsHttpsRule"
+	JWKSReachableRule       RuleOption = "jwksReachableRule"
+	JWKSKeyIDRule           RuleOption = "jwksKeyIdRule"
+	JWKSKeyStrengthRule     RuleOption = "jwksKeyStrengthRule"
+	JWKSPrivateKeyRule      RuleOption = "jwksPrivateKeyRule"
+	TokenEndpointRule       RuleOption = "tokenEndpointMatchRule"
+	AuthorizeEndpointRule   RuleOption = "authorizeEndpointMatchRule"
+	UDAPRequiredFieldsRule  RuleOption = "udapRequiredFieldsRule"
+	UDAPSignedMetadataRule  RuleOption = "udapSignedMetadataRule"
+	UDAPSignedEndpointsRule RuleOption = "udapSignedEndpointsRule"
+	DataExposureRule        RuleOption = "dataExposureRule"
+	MetadataPublicRule      RuleOption = "metadataPublicRule"
 )
 
 // compareOperations compares the operation resource fields for an endpoint
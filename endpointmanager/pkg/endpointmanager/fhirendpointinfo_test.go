@@ -345,6 +345,18 @@ func Test_FHIREndpointInfoEqual(t *testing.T) {
 	}
 	endpointInfo2.CapabilityFhirVersion = endpointInfo1.CapabilityFhirVersion
 
+	endpointInfo2.CapabilityStatementFormat = "xml"
+	if endpointInfo1.Equal(endpointInfo2) {
+		t.Errorf("Expect endpointInfo 1 to not equal endpointInfo 2. capability statement formats should be different. %s vs %s", endpointInfo1.CapabilityStatementFormat, endpointInfo2.CapabilityStatementFormat)
+	}
+	endpointInfo2.CapabilityStatementFormat = endpointInfo1.CapabilityStatementFormat
+
+	endpointInfo2.BulkData = &BulkDataSupport{ExportLevels: []string{"system"}}
+	if endpointInfo1.Equal(endpointInfo2) {
+		t.Errorf("Expect endpointInfo 1 to not equal endpointInfo 2. bulk data support should be different. %v vs %v", endpointInfo1.BulkData, endpointInfo2.BulkData)
+	}
+	endpointInfo2.BulkData = endpointInfo1.BulkData
+
 	endpointInfo2.RequestedFhirVersion = "3.0.2"
 	if endpointInfo1.Equal(endpointInfo2) {
 		t.Errorf("Expect endpointInfo 1 to not equal endpointInfo 2. requested fhir versions should be different. %s vs %s", endpointInfo1.RequestedFhirVersion, endpointInfo2.RequestedFhirVersion)
@@ -571,3 +583,39 @@ func Test_FHIREndpointInfoEqual(t *testing.T) {
 		t.Errorf("Nil endpointInfo 1 should equal nil endpointInfo 2.")
 	}
 }
+
+func Test_ValidationEqual(t *testing.T) {
+	validation1 := &Validation{
+		Results: []Rule{
+			{RuleName: CapStatExistRule, Valid: true, Expected: "true", Actual: "true"},
+			{RuleName: DataExposureRule, Valid: true, Expected: "0", Actual: "0"},
+		},
+	}
+	validation2 := &Validation{
+		Results: []Rule{validation1.Results[1], validation1.Results[0]},
+	}
+
+	if !validation1.Equal(validation2) {
+		t.Errorf("Expected validations with the same results in a different order to be equal")
+	}
+
+	validation2.Results[0].Valid = false
+	if validation1.Equal(validation2) {
+		t.Errorf("Did not expect validation1 to equal validation2. The data exposure rule should be different.")
+	}
+
+	validation2.Results = append(validation1.Results, validation1.Results[0])
+	if validation1.Equal(validation2) {
+		t.Errorf("Did not expect validation1 to equal validation2. validation2 should have an extra rule.")
+	}
+
+	validation2 = &Validation{Results: []Rule{validation1.Results[0], validation1.Results[0]}}
+	if validation1.Equal(validation2) {
+		t.Errorf("Did not expect validation1 to equal validation2. validation2 should repeat a rule.")
+	}
+
+	var nilValidation *Validation
+	if validation1.Equal(nilValidation) || nilValidation.Equal(validation1) {
+		t.Errorf("Did not expect a validation to equal nil")
+	}
+}
@@ -9,16 +9,48 @@ import (
 // FHIREndpointMetadata represents information about the request made
 // to the FHIR endpoint's capability statement and it's SMART on FHIR well-known configuration
 type FHIREndpointMetadata struct {
-	ID                   int
-	URL                  string
-	HTTPResponse         int
+	ID           int
+	URL          string
+	HTTPResponse int
+	// whether the endpoint responded 304 Not Modified to a conditional request, which is recorded with an
+	// HTTPResponse of 200 since the saved capability statement is still current
+	NotModified          bool
 	Errors               string
+	ErrorCode            QueryErrorCode // the classification of Errors. Empty if the request did not fail.
 	CreatedAt            time.Time
 	UpdatedAt            time.Time
 	SMARTHTTPResponse    int
 	ResponseTime         float64
 	Availability         float64
 	RequestedFhirVersion string
+	// breakdown of ResponseTime into the phases of the HTTP request, in seconds
+	DNSLookupTime    float64
+	TCPConnectTime   float64
+	TLSHandshakeTime float64
+	TimeToFirstByte  float64
+	BodyTransferTime float64
+	// time the requests spent waiting on the querier's per-host request limits, in seconds
+	SchedulerWaitTime float64
+	TLSInfo           *TLSInfo // the TLS handshake made with the endpoint. nil if the endpoint does not use TLS.
+	// a curated set of the headers of the capability statement response, keyed by header name. Headers with
+	// multiple values have their values joined with ", ".
+	ResponseHeaders map[string]string
+	// the redirects followed while requesting the capability statement. Empty if there were none.
+	RedirectChain []RedirectHop
+	// the body and authentication challenges of a 4xx or 5xx capability statement response. nil otherwise.
+	ErrorResponse *ErrorResponse
+	// the key set advertised by the jwks_uri of the endpoint's SMART configuration. nil if none was advertised.
+	JWKSInfo *JWKSInfo
+	// the OpenID Connect or OAuth 2.0 metadata of the endpoint's authorization server. nil if it was not requested.
+	AuthServerMetadata *AuthServerMetadata
+	// the UDAP metadata published at /.well-known/udap. nil if it was not requested.
+	UDAPInfo *UDAPInfo
+	// the CDS Hooks discovery document published at cds-services. nil if it was not requested.
+	CDSHooksInfo *CDSHooksInfo
+	// the searches for patient data made without authorization. nil if they were not made.
+	DataExposureChecks []DataExposureCheck
+	// the DNS lookup of the endpoint's host. nil if the host was not looked up.
+	DNSInfo *DNSInfo
 }
 
 // Equal checks each field of the two FHIREndpointMetadatass except for the database ID, CreatedAt and UpdatedAt fields to see if they are equal.
@@ -37,12 +69,18 @@ func (e *FHIREndpointMetadata) Equal(e2 *FHIREndpointMetadata) bool {
 	if e.HTTPResponse != e2.HTTPResponse {
 		return false
 	}
+	if e.NotModified != e2.NotModified {
+		return false
+	}
 	if !cmp.Equal(e.Availability, e2.Availability) {
 		return false
 	}
 	if e.Errors != e2.Errors {
 		return false
 	}
+	if e.ErrorCode != e2.ErrorCode {
+		return false
+	}
 	if e.SMARTHTTPResponse != e2.SMARTHTTPResponse {
 		return false
 	}
@@ -52,6 +90,54 @@ func (e *FHIREndpointMetadata) Equal(e2 *FHIREndpointMetadata) bool {
 	if e.RequestedFhirVersion != e2.RequestedFhirVersion {
 		return false
 	}
+	if !cmp.Equal(e.DNSLookupTime, e2.DNSLookupTime) {
+		return false
+	}
+	if !cmp.Equal(e.TCPConnectTime, e2.TCPConnectTime) {
+		return false
+	}
+	if !cmp.Equal(e.TLSHandshakeTime, e2.TLSHandshakeTime) {
+		return false
+	}
+	if !cmp.Equal(e.TimeToFirstByte, e2.TimeToFirstByte) {
+		return false
+	}
+	if !cmp.Equal(e.BodyTransferTime, e2.BodyTransferTime) {
+		return false
+	}
+	if !cmp.Equal(e.SchedulerWaitTime, e2.SchedulerWaitTime) {
+		return false
+	}
+	if !e.TLSInfo.Equal(e2.TLSInfo) {
+		return false
+	}
+	if !cmp.Equal(e.ResponseHeaders, e2.ResponseHeaders) {
+		return false
+	}
+	if !cmp.Equal(e.RedirectChain, e2.RedirectChain) {
+		return false
+	}
+	if !cmp.Equal(e.ErrorResponse, e2.ErrorResponse) {
+		return false
+	}
+	if !e.JWKSInfo.Equal(e2.JWKSInfo) {
+		return false
+	}
+	if !e.AuthServerMetadata.Equal(e2.AuthServerMetadata) {
+		return false
+	}
+	if !e.UDAPInfo.Equal(e2.UDAPInfo) {
+		return false
+	}
+	if !e.CDSHooksInfo.Equal(e2.CDSHooksInfo) {
+		return false
+	}
+	if !cmp.Equal(e.DataExposureChecks, e2.DataExposureChecks) {
+		return false
+	}
+	if !e.DNSInfo.Equal(e2.DNSInfo) {
+		return false
+	}
 
 	return true
 }
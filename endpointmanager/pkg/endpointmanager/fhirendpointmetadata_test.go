@@ -70,6 +70,48 @@ func Test_FHIREndpointMetadataEqual(t *testing.T) {
 	}
 	endpointMetadata2.Errors = endpointMetadata1.Errors
 
+	endpointMetadata2.ErrorCode = TimeoutCode
+	if endpointMetadata1.Equal(endpointMetadata2) {
+		t.Errorf("Did not expect endpointMetadata1 to equal endpointMetadata2. ErrorCode should be different. %s vs %s", endpointMetadata1.ErrorCode, endpointMetadata2.ErrorCode)
+	}
+	endpointMetadata2.ErrorCode = endpointMetadata1.ErrorCode
+
+	endpointMetadata2.ResponseHeaders = map[string]string{"Server": "other"}
+	if endpointMetadata1.Equal(endpointMetadata2) {
+		t.Errorf("Did not expect endpointMetadata1 to equal endpointMetadata2. ResponseHeaders should be different. %v vs %v", endpointMetadata1.ResponseHeaders, endpointMetadata2.ResponseHeaders)
+	}
+	endpointMetadata2.ResponseHeaders = endpointMetadata1.ResponseHeaders
+
+	endpointMetadata2.RedirectChain = []RedirectHop{{URL: "http://www.example.com", Scheme: "http", StatusCode: 301, Location: "https://www.example.com"}}
+	if endpointMetadata1.Equal(endpointMetadata2) {
+		t.Errorf("Did not expect endpointMetadata1 to equal endpointMetadata2. RedirectChain should be different. %v vs %v", endpointMetadata1.RedirectChain, endpointMetadata2.RedirectChain)
+	}
+	endpointMetadata2.RedirectChain = endpointMetadata1.RedirectChain
+
+	endpointMetadata2.ErrorResponse = &ErrorResponse{Kind: AuthRequiredKind, AuthChallenges: []AuthChallenge{{Scheme: "Bearer"}}}
+	if endpointMetadata1.Equal(endpointMetadata2) {
+		t.Errorf("Did not expect endpointMetadata1 to equal endpointMetadata2. ErrorResponse should be different. %v vs %v", endpointMetadata1.ErrorResponse, endpointMetadata2.ErrorResponse)
+	}
+	endpointMetadata2.ErrorResponse = endpointMetadata1.ErrorResponse
+
+	endpointMetadata2.DataExposureChecks = []DataExposureCheck{{Search: "Patient?_count=1", HTTPResponse: 401}}
+	if endpointMetadata1.Equal(endpointMetadata2) {
+		t.Errorf("Did not expect endpointMetadata1 to equal endpointMetadata2. DataExposureChecks should be different. %v vs %v", endpointMetadata1.DataExposureChecks, endpointMetadata2.DataExposureChecks)
+	}
+	endpointMetadata2.DataExposureChecks = endpointMetadata1.DataExposureChecks
+
+	endpointMetadata2.DNSInfo = &DNSInfo{Host: "www.example.com", Addresses: []DNSAddress{{IP: "192.0.2.1"}}, TTL: 60}
+	if endpointMetadata1.Equal(endpointMetadata2) {
+		t.Errorf("Did not expect endpointMetadata1 to equal endpointMetadata2. DNSInfo should be different. %v vs %v", endpointMetadata1.DNSInfo, endpointMetadata2.DNSInfo)
+	}
+	endpointMetadata2.DNSInfo = endpointMetadata1.DNSInfo
+
+	endpointMetadata2.NotModified = true
+	if endpointMetadata1.Equal(endpointMetadata2) {
+		t.Errorf("Did not expect endpointMetadata1 to equal endpointMetadata2. NotModified should be different. %t vs %t", endpointMetadata1.NotModified, endpointMetadata2.NotModified)
+	}
+	endpointMetadata2.NotModified = endpointMetadata1.NotModified
+
 	endpointMetadata2.ResponseTime = 0.234567
 	if endpointMetadata1.Equal(endpointMetadata2) {
 		t.Errorf("Did not expect endpointMetadata1 to equal endpointMetadata2. ResponseTime should be different. %f vs %f", endpointMetadata1.ResponseTime, endpointMetadata2.ResponseTime)
@@ -82,6 +124,18 @@ func Test_FHIREndpointMetadataEqual(t *testing.T) {
 	}
 	endpointMetadata2.RequestedFhirVersion = endpointMetadata1.RequestedFhirVersion
 
+	endpointMetadata2.TimeToFirstByte = 0.5
+	if endpointMetadata1.Equal(endpointMetadata2) {
+		t.Errorf("Did not expect endpointMetadata1 to equal endpointMetadata2. TimeToFirstByte should be different. %f vs %f", endpointMetadata1.TimeToFirstByte, endpointMetadata2.TimeToFirstByte)
+	}
+	endpointMetadata2.TimeToFirstByte = endpointMetadata1.TimeToFirstByte
+
+	endpointMetadata2.SchedulerWaitTime = 1.5
+	if endpointMetadata1.Equal(endpointMetadata2) {
+		t.Errorf("Did not expect endpointMetadata1 to equal endpointMetadata2. SchedulerWaitTime should be different. %f vs %f", endpointMetadata1.SchedulerWaitTime, endpointMetadata2.SchedulerWaitTime)
+	}
+	endpointMetadata2.SchedulerWaitTime = endpointMetadata1.SchedulerWaitTime
+
 	endpointMetadata2 = nil
 	if endpointMetadata1.Equal(endpointMetadata2) {
 		t.Errorf("Did not expect endpointMetadata1 to equal nil endpointMetadata2.")
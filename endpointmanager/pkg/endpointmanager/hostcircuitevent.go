@@ -0,0 +1,25 @@
+package endpointmanager
+
+import "time"
+
+// CircuitState is the state of the circuit breaker the capability querier keeps for each endpoint host.
+type CircuitState string
+
+// The circuit breaker states. Requests are made while the circuit is closed, short-circuited while it is open,
+// and a single trial request is made while it is half-open to check whether the host has recovered.
+const (
+	CircuitClosed   CircuitState = "closed"
+	CircuitOpen     CircuitState = "open"
+	CircuitHalfOpen CircuitState = "half_open"
+)
+
+// HostCircuitEvent records a transition of an endpoint host's circuit breaker. A transition to open marks the start
+// of a host outage and the following transition to closed marks its end.
+type HostCircuitEvent struct {
+	ID                  int
+	Host                string
+	FromState           CircuitState
+	ToState             CircuitState
+	ConsecutiveFailures int // the consecutive failed requests to the host when the transition was made
+	CreatedAt           time.Time
+}
@@ -0,0 +1,55 @@
+package endpointmanager
+
+import (
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// JWKSInfo represents the request for the JSON Web Key Set advertised by the jwks_uri of a FHIR endpoint's SMART
+// configuration, and the keys that were published in it.
+type JWKSInfo struct {
+	ID           int       `json:"-"`
+	URL          string    `json:"url"`
+	HTTPResponse int       `json:"httpResponse"`
+	Error        string    `json:"error"` // why the key set could not be retrieved or parsed. Empty if it was.
+	Keys         []JWK     `json:"keys"`
+	CreatedAt    time.Time `json:"-"`
+}
+
+// JWK is the public information about a single key in a JSON Web Key Set. The key material itself is not kept.
+type JWK struct {
+	KeyType       string `json:"kty"`
+	Algorithm     string `json:"alg"`
+	Use           string `json:"use"`
+	KeyID         string `json:"kid"`
+	Curve         string `json:"crv"`
+	KeySize       int    `json:"keySize"`       // the key size in bits. 0 if the size could not be determined.
+	HasPrivateKey bool   `json:"hasPrivateKey"` // whether the key includes private or symmetric key material.
+}
+
+// Equal checks each field of the two JWKSInfos except for the database ID and CreatedAt fields to see if they are equal.
+func (j *JWKSInfo) Equal(j2 *JWKSInfo) bool {
+	if j == nil && j2 == nil {
+		return true
+	} else if j == nil {
+		return false
+	} else if j2 == nil {
+		return false
+	}
+
+	if j.URL != j2.URL {
+		return false
+	}
+	if j.HTTPResponse != j2.HTTPResponse {
+		return false
+	}
+	if j.Error != j2.Error {
+		return false
+	}
+	if !cmp.Equal(j.Keys, j2.Keys) {
+		return false
+	}
+
+	return true
+}
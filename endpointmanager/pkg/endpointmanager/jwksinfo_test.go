@@ -0,0 +1,57 @@
+package endpointmanager
+
+import (
+	"testing"
+)
+
+func Test_JWKSInfoEqual(t *testing.T) {
+	var j1 = &JWKSInfo{
+		ID:           1,
+		URL:          "https://example.com/jwks",
+		HTTPResponse: 200,
+		Keys: []JWK{
+			{KeyType: "RSA", Algorithm: "RS384", Use: "sig", KeyID: "key-1", KeySize: 2048},
+			{KeyType: "EC", Algorithm: "ES384", Use: "sig", KeyID: "key-2", Curve: "P-384", KeySize: 384},
+		}}
+
+	var j2 = &JWKSInfo{
+		ID:           2,
+		URL:          "https://example.com/jwks",
+		HTTPResponse: 200,
+		Keys: []JWK{
+			{KeyType: "RSA", Algorithm: "RS384", Use: "sig", KeyID: "key-1", KeySize: 2048},
+			{KeyType: "EC", Algorithm: "ES384", Use: "sig", KeyID: "key-2", Curve: "P-384", KeySize: 384},
+		}}
+
+	if !j1.Equal(j2) {
+		t.Errorf("Expected JWKS info 1 to equal JWKS info 2. They are not equal.")
+	}
+
+	j2.URL = "https://other.example.com/jwks"
+	if j1.Equal(j2) {
+		t.Errorf("Did not expect JWKS info 1 to equal JWKS info 2. URL should be different. %s vs %s", j1.URL, j2.URL)
+	}
+	j2.URL = j1.URL
+
+	j2.Error = "unable to reach the JWKS URI"
+	if j1.Equal(j2) {
+		t.Errorf("Did not expect JWKS info 1 to equal JWKS info 2. Error should be different. %s vs %s", j1.Error, j2.Error)
+	}
+	j2.Error = j1.Error
+
+	j2.Keys = []JWK{{KeyType: "RSA", Algorithm: "RS384", Use: "sig", KeyID: "key-1", KeySize: 2048, HasPrivateKey: true}}
+	if j1.Equal(j2) {
+		t.Errorf("Did not expect JWKS info 1 to equal JWKS info 2. Keys should be different. %v vs %v", j1.Keys, j2.Keys)
+	}
+	j2.Keys = j1.Keys
+
+	// test nil
+	j2 = nil
+	if j1.Equal(j2) {
+		t.Errorf("Did not expect JWKS info 1 to equal nil JWKS info 2.")
+	}
+	j1 = nil
+	if !j1.Equal(j2) {
+		t.Errorf("Expected nil JWKS info 1 to equal nil JWKS info 2.")
+	}
+}
@@ -0,0 +1,132 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+)
+
+// prepared statements are left open to be used throughout the execution of the application
+var getListSourceCategoriesStatement *sql.Stmt
+var getEndpointAudienceStatement *sql.Stmt
+var upsertEndpointAudienceStatement *sql.Stmt
+var deleteEndpointAudienceStatement *sql.Stmt
+
+// GetListSourceCategoriesUsingURL gets the distinct categories, such as CHPL or Payer, of the lists the endpoint
+// at url was found on. List sources without a category are left out.
+func (s *Store) GetListSourceCategoriesUsingURL(ctx context.Context, url string) ([]string, error) {
+	rows, err := getListSourceCategoriesStatement.QueryContext(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []string
+	for rows.Next() {
+		var category string
+		err = rows.Scan(&category)
+		if err != nil {
+			return nil, err
+		}
+		categories = append(categories, category)
+	}
+
+	return categories, rows.Err()
+}
+
+// GetEndpointAudience gets the audience the endpoint at url was classified as when requested with the given FHIR
+// version. sql.ErrNoRows is returned if it has not been classified.
+func (s *Store) GetEndpointAudience(ctx context.Context, url string, requestedVersion string) (*endpointmanager.AudienceClassification, error) {
+	var classification endpointmanager.AudienceClassification
+	var audience string
+	var signalsJSON []byte
+
+	row := getEndpointAudienceStatement.QueryRowContext(ctx, url, requestedVersion)
+	err := row.Scan(
+		&audience,
+		&classification.Confidence,
+		&signalsJSON)
+	if err != nil {
+		return nil, err
+	}
+	classification.Audience = endpointmanager.Audience(audience)
+	if signalsJSON != nil {
+		err = json.Unmarshal(signalsJSON, &classification.Signals)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &classification, nil
+}
+
+// UpsertEndpointAudience saves the audience the endpoint at url is classified as when requested with the given FHIR
+// version, replacing any earlier classification.
+func (s *Store) UpsertEndpointAudience(ctx context.Context, url string, requestedVersion string, classification endpointmanager.AudienceClassification) error {
+	signalsJSON, err := json.Marshal(classification.Signals)
+	if err != nil {
+		return err
+	}
+
+	_, err = upsertEndpointAudienceStatement.ExecContext(ctx,
+		url,
+		requestedVersion,
+		string(classification.Audience),
+		classification.Confidence,
+		signalsJSON)
+	return err
+}
+
+// DeleteEndpointAudience deletes the audience the endpoint at url was classified as when requested with the given
+// FHIR version
+func (s *Store) DeleteEndpointAudience(ctx context.Context, url string, requestedVersion string) error {
+	_, err := deleteEndpointAudienceStatement.ExecContext(ctx, url, requestedVersion)
+	return err
+}
+
+func prepareAudienceStatements(s *Store) error {
+	var err error
+	getListSourceCategoriesStatement, err = s.DB.Prepare(`
+		SELECT DISTINCT list_source_info.is_chpl
+		FROM fhir_endpoints
+		JOIN list_source_info ON fhir_endpoints.list_source = list_source_info.list_source
+		WHERE fhir_endpoints.url = $1 AND list_source_info.is_chpl IS NOT NULL
+		ORDER BY list_source_info.is_chpl`)
+	if err != nil {
+		return err
+	}
+	getEndpointAudienceStatement, err = s.DB.Prepare(`
+		SELECT
+			audience,
+			confidence,
+			signals
+		FROM fhir_endpoints_audience WHERE url = $1 AND requested_fhir_version = $2`)
+	if err != nil {
+		return err
+	}
+	upsertEndpointAudienceStatement, err = s.DB.Prepare(`
+		INSERT INTO fhir_endpoints_audience (
+			url,
+			requested_fhir_version,
+			audience,
+			confidence,
+			signals)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (url, requested_fhir_version)
+		DO UPDATE SET
+			audience = EXCLUDED.audience,
+			confidence = EXCLUDED.confidence,
+			signals = EXCLUDED.signals,
+			updated_at = NOW()`)
+	if err != nil {
+		return err
+	}
+	deleteEndpointAudienceStatement, err = s.DB.Prepare(`
+		DELETE FROM fhir_endpoints_audience WHERE url = $1 AND requested_fhir_version = $2`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
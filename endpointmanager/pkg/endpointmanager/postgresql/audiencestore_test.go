@@ -0,0 +1,77 @@
+//go:build integration
+// +build integration
+
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+	th "github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/testhelper"
+)
+
+func Test_PersistEndpointAudience(t *testing.T) {
+	SetupStore()
+	teardown, _ := th.IntegrationDBTestSetup(t, store.DB)
+	defer teardown(t, store.DB)
+
+	var err error
+	ctx := context.Background()
+	url := "https://example.com/fhir"
+
+	// the categories of the lists the endpoint was found on
+	for _, listSource := range []string{"https://example.com/payer-list", "https://example.com/chpl-list", "https://example.com/other-list"} {
+		err = store.AddFHIREndpoint(ctx, &endpointmanager.FHIREndpoint{URL: url, ListSource: listSource})
+		th.Assert(t, err == nil, err)
+	}
+	_, err = store.DB.ExecContext(ctx, "INSERT INTO list_source_info (list_source, is_chpl) VALUES ($1, 'Payer'), ($2, 'CHPL')",
+		"https://example.com/payer-list", "https://example.com/chpl-list")
+	th.Assert(t, err == nil, err)
+
+	categories, err := store.GetListSourceCategoriesUsingURL(ctx, url)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, reflect.DeepEqual(categories, []string{"CHPL", "Payer"}), fmt.Sprintf("expected the CHPL and Payer categories, got %v", categories))
+
+	categories, err = store.GetListSourceCategoriesUsingURL(ctx, "https://other.example.com/fhir")
+	th.Assert(t, err == nil, err)
+	th.Assert(t, categories == nil, fmt.Sprintf("expected no categories for an unknown endpoint, got %v", categories))
+
+	// an endpoint that has not been classified
+	_, err = store.GetEndpointAudience(ctx, url, "None")
+	th.Assert(t, err == sql.ErrNoRows, fmt.Sprintf("expected sql.ErrNoRows, got %v", err))
+
+	classification := endpointmanager.AudienceClassification{
+		Audience:   endpointmanager.PayerAudience,
+		Confidence: 0.6,
+		Signals:    []string{"list source: Payer", "list source: CHPL"},
+	}
+	err = store.UpsertEndpointAudience(ctx, url, "None", classification)
+	th.Assert(t, err == nil, err)
+
+	saved, err := store.GetEndpointAudience(ctx, url, "None")
+	th.Assert(t, err == nil, err)
+	th.Assert(t, reflect.DeepEqual(*saved, classification), fmt.Sprintf("expected %+v, got %+v", classification, *saved))
+
+	// classifying the endpoint again replaces the classification
+	classification = endpointmanager.AudienceClassification{Audience: endpointmanager.UnknownAudience, Confidence: 0, Signals: []string{}}
+	err = store.UpsertEndpointAudience(ctx, url, "None", classification)
+	th.Assert(t, err == nil, err)
+
+	saved, err = store.GetEndpointAudience(ctx, url, "None")
+	th.Assert(t, err == nil, err)
+	th.Assert(t, reflect.DeepEqual(*saved, classification), fmt.Sprintf("expected %+v, got %+v", classification, *saved))
+
+	var count int
+	err = store.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM fhir_endpoints_audience WHERE url = $1", url).Scan(&count)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, count == 1, fmt.Sprintf("expected 1 classification, got %d", count))
+
+	err = store.DeleteEndpointAudience(ctx, url, "None")
+	th.Assert(t, err == nil, err)
+	_, err = store.GetEndpointAudience(ctx, url, "None")
+	th.Assert(t, err == sql.ErrNoRows, fmt.Sprintf("expected sql.ErrNoRows after deleting, got %v", err))
+}
@@ -0,0 +1,116 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+)
+
+// prepared statements are left open to be used throughout the execution of the application
+var addAuthServerMetadataStatement *sql.Stmt
+var getAuthServerMetadataStatement *sql.Stmt
+
+// GetAuthServerMetadataUsingMetadataID gets the AuthServerMetadata recorded for the request with the given metadata id.
+// If there is no AuthServerMetadata for the metadata id, sql.ErrNoRows will be returned.
+func (s *Store) GetAuthServerMetadataUsingMetadataID(ctx context.Context, metadataID int) (*endpointmanager.AuthServerMetadata, error) {
+	var authServer endpointmanager.AuthServerMetadata
+	var errorNullable sql.NullString
+	var issuerNullable sql.NullString
+	var authorizationEndpointNullable sql.NullString
+	var tokenEndpointNullable sql.NullString
+	var jwksURINullable sql.NullString
+
+	row := getAuthServerMetadataStatement.QueryRowContext(ctx, metadataID)
+
+	err := row.Scan(
+		&authServer.ID,
+		&authServer.DocumentType,
+		&authServer.URL,
+		&authServer.RequestedIssuer,
+		&authServer.HTTPResponse,
+		&errorNullable,
+		&issuerNullable,
+		&authorizationEndpointNullable,
+		&tokenEndpointNullable,
+		&jwksURINullable,
+		&authServer.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	authServer.Error = errorNullable.String
+	authServer.Issuer = issuerNullable.String
+	authServer.AuthorizationEndpoint = authorizationEndpointNullable.String
+	authServer.TokenEndpoint = tokenEndpointNullable.String
+	authServer.JWKSURI = jwksURINullable.String
+
+	return &authServer, nil
+}
+
+// AddAuthServerMetadata adds the AuthServerMetadata to the database, linked to the request with the given metadata id.
+func (s *Store) AddAuthServerMetadata(ctx context.Context, a *endpointmanager.AuthServerMetadata, metadataID int) error {
+	row := addAuthServerMetadataStatement.QueryRowContext(ctx,
+		metadataID,
+		a.DocumentType,
+		a.URL,
+		a.RequestedIssuer,
+		a.HTTPResponse,
+		nullableString(a.Error),
+		nullableString(a.Issuer),
+		nullableString(a.AuthorizationEndpoint),
+		nullableString(a.TokenEndpoint),
+		nullableString(a.JWKSURI))
+
+	return row.Scan(&a.ID)
+}
+
+// nullableString returns the string as a sql.NullString that is null when the string is empty, truncated to fit
+// a VARCHAR(500) column
+func nullableString(str string) sql.NullString {
+	if str == "" {
+		return sql.NullString{}
+	}
+	if len(str) > 500 {
+		str = str[:500]
+	}
+	return sql.NullString{String: str, Valid: true}
+}
+
+func prepareAuthServerMetadataStatements(s *Store) error {
+	var err error
+	addAuthServerMetadataStatement, err = s.DB.Prepare(`
+		INSERT INTO fhir_endpoints_auth_server (
+			metadata_id,
+			document_type,
+			url,
+			requested_issuer,
+			http_response,
+			error,
+			issuer,
+			authorization_endpoint,
+			token_endpoint,
+			jwks_uri)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id`)
+	if err != nil {
+		return err
+	}
+	getAuthServerMetadataStatement, err = s.DB.Prepare(`
+		SELECT
+			id,
+			document_type,
+			url,
+			requested_issuer,
+			http_response,
+			error,
+			issuer,
+			authorization_endpoint,
+			token_endpoint,
+			jwks_uri,
+			created_at
+		FROM fhir_endpoints_auth_server WHERE metadata_id = $1`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
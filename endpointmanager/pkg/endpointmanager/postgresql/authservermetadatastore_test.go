@@ -0,0 +1,91 @@
+//go:build integration
+// +build integration
+
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+	th "github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/testhelper"
+)
+
+func Test_PersistAuthServerMetadata(t *testing.T) {
+	SetupStore()
+	teardown, _ := th.IntegrationDBTestSetup(t, store.DB)
+	defer teardown(t, store.DB)
+
+	var err error
+	ctx := context.Background()
+
+	var authServer = &endpointmanager.AuthServerMetadata{
+		DocumentType:          "openid-configuration",
+		URL:                   "https://example.com/.well-known/openid-configuration",
+		RequestedIssuer:       "https://example.com",
+		HTTPResponse:          200,
+		Issuer:                "https://example.com",
+		AuthorizationEndpoint: "https://example.com/authorize",
+		TokenEndpoint:         "https://example.com/token",
+		JWKSURI:               "https://example.com/jwks"}
+
+	var unreachableAuthServer = &endpointmanager.AuthServerMetadata{
+		DocumentType:    "oauth-authorization-server",
+		URL:             "https://other.example.com/.well-known/oauth-authorization-server",
+		RequestedIssuer: "https://other.example.com",
+		HTTPResponse:    404,
+		Error:           "the metadata URL returned HTTP status 404"}
+
+	var endpointMetadata1 = &endpointmanager.FHIREndpointMetadata{
+		URL:                  "example.com/FHIR/DSTU2/",
+		HTTPResponse:         200,
+		Availability:         1.0,
+		RequestedFhirVersion: "None",
+		AuthServerMetadata:   authServer}
+
+	var endpointMetadata2 = &endpointmanager.FHIREndpointMetadata{
+		URL:                  "http://other.example.com/FHIR/DSTU2/",
+		HTTPResponse:         200,
+		Availability:         1.0,
+		RequestedFhirVersion: "None",
+		AuthServerMetadata:   unreachableAuthServer}
+
+	var endpointMetadata3 = &endpointmanager.FHIREndpointMetadata{
+		URL:                  "http://third.example.com/FHIR/DSTU2/",
+		HTTPResponse:         200,
+		Availability:         1.0,
+		RequestedFhirVersion: "None"}
+
+	// the auth server metadata is saved along with the metadata
+	metadataID1, err := store.AddFHIREndpointMetadata(ctx, endpointMetadata1)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, authServer.ID != 0, "expected the auth server metadata ID to be set")
+
+	metadataID2, err := store.AddFHIREndpointMetadata(ctx, endpointMetadata2)
+	th.Assert(t, err == nil, err)
+
+	metadataID3, err := store.AddFHIREndpointMetadata(ctx, endpointMetadata3)
+	th.Assert(t, err == nil, err)
+
+	a1, err := store.GetAuthServerMetadataUsingMetadataID(ctx, metadataID1)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, a1.Equal(authServer), "retrieved auth server metadata is not equal to saved auth server metadata.")
+
+	m1, err := store.GetFHIREndpointMetadata(ctx, metadataID1)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, m1.Equal(endpointMetadata1), "retrieved endpointMetadata is not equal to saved endpointMetadata.")
+
+	// metadata that could not be retrieved
+	a2, err := store.GetAuthServerMetadataUsingMetadataID(ctx, metadataID2)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, a2.Equal(unreachableAuthServer), "retrieved auth server metadata is not equal to saved auth server metadata.")
+
+	// metadata without auth server metadata
+	_, err = store.GetAuthServerMetadataUsingMetadataID(ctx, metadataID3)
+	th.Assert(t, err == sql.ErrNoRows, "expected no auth server metadata for an endpoint that was not checked")
+
+	m3, err := store.GetFHIREndpointMetadata(ctx, metadataID3)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, m3.AuthServerMetadata == nil, "expected the metadata auth server metadata to be nil")
+}
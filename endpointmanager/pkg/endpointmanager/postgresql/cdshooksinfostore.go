@@ -0,0 +1,106 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/lib/pq"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/cdshooksparser"
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+)
+
+// prepared statements are left open to be used throughout the execution of the application
+var addCDSHooksInfoStatement *sql.Stmt
+var getCDSHooksInfoStatement *sql.Stmt
+
+// GetCDSHooksInfoUsingMetadataID gets the CDSHooksInfo recorded for the request with the given metadata id.
+// If there is no CDSHooksInfo for the metadata id, sql.ErrNoRows will be returned.
+func (s *Store) GetCDSHooksInfoUsingMetadataID(ctx context.Context, metadataID int) (*endpointmanager.CDSHooksInfo, error) {
+	var cdsHooksInfo endpointmanager.CDSHooksInfo
+	var errorNullable sql.NullString
+	var servicesJSON []byte
+
+	row := getCDSHooksInfoStatement.QueryRowContext(ctx, metadataID)
+
+	err := row.Scan(
+		&cdsHooksInfo.ID,
+		&cdsHooksInfo.URL,
+		&cdsHooksInfo.HTTPResponse,
+		&errorNullable,
+		&servicesJSON,
+		&cdsHooksInfo.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	cdsHooksInfo.Error = errorNullable.String
+
+	if servicesJSON != nil {
+		err = json.Unmarshal(servicesJSON, &cdsHooksInfo.Services)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &cdsHooksInfo, nil
+}
+
+// AddCDSHooksInfo adds the CDSHooksInfo to the database, linked to the request with the given metadata id. The
+// service ids and hook types are stored in their own columns so that adoption can be queried without the JSON.
+func (s *Store) AddCDSHooksInfo(ctx context.Context, c *endpointmanager.CDSHooksInfo, metadataID int) error {
+	var servicesJSON []byte
+	var serviceIDs []string
+	var hookTypes []string
+	var err error
+	if c.Services != nil {
+		servicesJSON, err = json.Marshal(c.Services)
+		if err != nil {
+			return err
+		}
+		serviceIDs = cdshooksparser.ServiceIDs(c.Services)
+		hookTypes = cdshooksparser.HookTypes(c.Services)
+	}
+
+	row := addCDSHooksInfoStatement.QueryRowContext(ctx,
+		metadataID,
+		c.URL,
+		c.HTTPResponse,
+		nullableString(c.Error),
+		pq.Array(serviceIDs),
+		pq.Array(hookTypes),
+		servicesJSON)
+
+	return row.Scan(&c.ID)
+}
+
+func prepareCDSHooksInfoStatements(s *Store) error {
+	var err error
+	addCDSHooksInfoStatement, err = s.DB.Prepare(`
+		INSERT INTO fhir_endpoints_cds_hooks (
+			metadata_id,
+			url,
+			http_response,
+			error,
+			service_ids,
+			hook_types,
+			services)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id`)
+	if err != nil {
+		return err
+	}
+	getCDSHooksInfoStatement, err = s.DB.Prepare(`
+		SELECT
+			id,
+			url,
+			http_response,
+			error,
+			services,
+			created_at
+		FROM fhir_endpoints_cds_hooks WHERE metadata_id = $1`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+//go:build integration
+// +build integration
+
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/cdshooksparser"
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+	th "github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/testhelper"
+)
+
+func Test_PersistCDSHooksInfo(t *testing.T) {
+	SetupStore()
+	teardown, _ := th.IntegrationDBTestSetup(t, store.DB)
+	defer teardown(t, store.DB)
+
+	var err error
+	ctx := context.Background()
+
+	var cdsHooksInfo = &endpointmanager.CDSHooksInfo{
+		URL:          "https://example.com/fhir/cds-services",
+		HTTPResponse: 200,
+		Services: []cdshooksparser.CDSService{
+			{
+				ID:       "static-patient-view",
+				Hook:     "patient-view",
+				Title:    "Static CDS Service Example",
+				Prefetch: map[string]string{"patientToGreet": "Patient/{{context.patientId}}"},
+			},
+			{ID: "order-echo", Hook: "order-select"},
+			{ID: "opioid-summary", Hook: "patient-view"},
+		}}
+
+	var missingCDSHooksInfo = &endpointmanager.CDSHooksInfo{
+		URL:          "https://other.example.com/fhir/cds-services",
+		HTTPResponse: 404,
+		Error:        "the CDS Hooks discovery URL returned HTTP status 404"}
+
+	var endpointMetadata1 = &endpointmanager.FHIREndpointMetadata{
+		URL:                  "https://example.com/fhir",
+		HTTPResponse:         200,
+		Availability:         1.0,
+		RequestedFhirVersion: "None",
+		CDSHooksInfo:         cdsHooksInfo}
+
+	var endpointMetadata2 = &endpointmanager.FHIREndpointMetadata{
+		URL:                  "https://other.example.com/fhir",
+		HTTPResponse:         200,
+		Availability:         1.0,
+		RequestedFhirVersion: "None",
+		CDSHooksInfo:         missingCDSHooksInfo}
+
+	var endpointMetadata3 = &endpointmanager.FHIREndpointMetadata{
+		URL:                  "https://third.example.com/fhir",
+		HTTPResponse:         200,
+		Availability:         1.0,
+		RequestedFhirVersion: "None"}
+
+	// the CDS Hooks info is saved along with the metadata
+	metadataID1, err := store.AddFHIREndpointMetadata(ctx, endpointMetadata1)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, cdsHooksInfo.ID != 0, "expected the CDS Hooks info ID to be set")
+
+	metadataID2, err := store.AddFHIREndpointMetadata(ctx, endpointMetadata2)
+	th.Assert(t, err == nil, err)
+
+	metadataID3, err := store.AddFHIREndpointMetadata(ctx, endpointMetadata3)
+	th.Assert(t, err == nil, err)
+
+	c1, err := store.GetCDSHooksInfoUsingMetadataID(ctx, metadataID1)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, c1.Equal(cdsHooksInfo), "retrieved CDS Hooks info is not equal to saved CDS Hooks info.")
+
+	m1, err := store.GetFHIREndpointMetadata(ctx, metadataID1)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, m1.Equal(endpointMetadata1), "retrieved endpointMetadata is not equal to saved endpointMetadata.")
+
+	// a discovery document that is not published
+	c2, err := store.GetCDSHooksInfoUsingMetadataID(ctx, metadataID2)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, c2.Equal(missingCDSHooksInfo), "retrieved CDS Hooks info is not equal to saved CDS Hooks info.")
+	th.Assert(t, c2.Services == nil, "expected no services")
+
+	// metadata without CDS Hooks info
+	_, err = store.GetCDSHooksInfoUsingMetadataID(ctx, metadataID3)
+	th.Assert(t, err == sql.ErrNoRows, "expected no CDS Hooks info for an endpoint that was not checked")
+
+	m3, err := store.GetFHIREndpointMetadata(ctx, metadataID3)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, m3.CDSHooksInfo == nil, "expected the metadata CDS Hooks info to be nil")
+
+	// the export lists the services with the developer the endpoint was attributed to
+	var vendor = &endpointmanager.Vendor{
+		Name:          "Example Health",
+		DeveloperCode: "4321",
+		CHPLID:        4321,
+	}
+	err = store.AddVendor(ctx, vendor)
+	th.Assert(t, err == nil, err)
+
+	var endpointInfo = &endpointmanager.FHIREndpointInfo{
+		URL:                  endpointMetadata1.URL,
+		VendorID:             vendor.ID,
+		RequestedFhirVersion: "None",
+		SMARTResponseBytes:   []byte("null"),
+		Metadata:             endpointMetadata1}
+	valResID, err := store.AddValidationResult(ctx)
+	th.Assert(t, err == nil, err)
+	endpointInfo.ValidationID = valResID
+	err = store.AddFHIREndpointInfo(ctx, endpointInfo, metadataID1)
+	th.Assert(t, err == nil, err)
+
+	var vendorName string
+	var serviceCount int
+	var hookTypes []string
+	row := store.DB.QueryRowContext(ctx, "SELECT vendor_name, cds_service_count, hook_types FROM cds_hooks_export WHERE url = $1", endpointMetadata1.URL)
+	err = row.Scan(&vendorName, &serviceCount, pq.Array(&hookTypes))
+	th.Assert(t, err == nil, err)
+	th.Assert(t, vendorName == vendor.Name, fmt.Sprintf("expected vendor %s, got %s", vendor.Name, vendorName))
+	th.Assert(t, serviceCount == 3, fmt.Sprintf("expected 3 services, got %d", serviceCount))
+	th.Assert(t, len(hookTypes) == 2 && hookTypes[0] == "order-select" && hookTypes[1] == "patient-view", fmt.Sprintf("unexpected hook types %v", hookTypes))
+}
@@ -0,0 +1,125 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+)
+
+// prepared statements are left open to be used throughout the execution of the application
+var addDataExposureCheckStatement *sql.Stmt
+var getDataExposureChecksStatement *sql.Stmt
+var pruneDataExposureChecksStatement *sql.Stmt
+
+// GetDataExposureChecksUsingMetadataID gets the unauthenticated searches for patient data made for the request with
+// the given metadata id, in the order they were made. If no searches were made, nil is returned.
+func (s *Store) GetDataExposureChecksUsingMetadataID(ctx context.Context, metadataID int) ([]endpointmanager.DataExposureCheck, error) {
+	rows, err := getDataExposureChecksStatement.QueryContext(ctx, metadataID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var checks []endpointmanager.DataExposureCheck
+	for rows.Next() {
+		var check endpointmanager.DataExposureCheck
+		var resourceTypeNullable sql.NullString
+		var totalNullable sql.NullInt64
+		var errorNullable sql.NullString
+		err = rows.Scan(
+			&check.Search,
+			&check.HTTPResponse,
+			&resourceTypeNullable,
+			&totalNullable,
+			&check.EntryCount,
+			&errorNullable)
+		if err != nil {
+			return nil, err
+		}
+		check.ResourceType = resourceTypeNullable.String
+		if totalNullable.Valid {
+			total := int(totalNullable.Int64)
+			check.Total = &total
+		}
+		check.Error = errorNullable.String
+		checks = append(checks, check)
+	}
+
+	return checks, rows.Err()
+}
+
+// AddDataExposureChecks adds the unauthenticated searches for patient data made for the endpoint at url to the
+// database, linked to the request with the given metadata id. The searches are kept after the request's metadata
+// is pruned, until they are removed by PruneDataExposureChecks.
+func (s *Store) AddDataExposureChecks(ctx context.Context, url string, checks []endpointmanager.DataExposureCheck, metadataID int) error {
+	for _, check := range checks {
+		var totalNullable sql.NullInt64
+		if check.Total != nil {
+			totalNullable.Valid = true
+			totalNullable.Int64 = int64(*check.Total)
+		}
+
+		_, err := addDataExposureCheckStatement.ExecContext(ctx,
+			metadataID,
+			url,
+			check.Search,
+			check.HTTPResponse,
+			nullableString(check.ResourceType),
+			totalNullable,
+			check.EntryCount,
+			nullableString(check.Error))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PruneDataExposureChecks deletes the unauthenticated searches for patient data made before the given time and
+// returns the number of searches that were deleted.
+func (s *Store) PruneDataExposureChecks(ctx context.Context, before time.Time) (int64, error) {
+	result, err := pruneDataExposureChecksStatement.ExecContext(ctx, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func prepareDataExposureStatements(s *Store) error {
+	var err error
+	addDataExposureCheckStatement, err = s.DB.Prepare(`
+		INSERT INTO fhir_endpoints_data_exposure (
+			metadata_id,
+			url,
+			search,
+			http_response,
+			resource_type,
+			bundle_total,
+			entry_count,
+			error)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`)
+	if err != nil {
+		return err
+	}
+	getDataExposureChecksStatement, err = s.DB.Prepare(`
+		SELECT
+			search,
+			http_response,
+			resource_type,
+			bundle_total,
+			entry_count,
+			error
+		FROM fhir_endpoints_data_exposure WHERE metadata_id = $1
+		ORDER BY id`)
+	if err != nil {
+		return err
+	}
+	pruneDataExposureChecksStatement, err = s.DB.Prepare(`
+		DELETE FROM fhir_endpoints_data_exposure WHERE created_at < $1`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+//go:build integration
+// +build integration
+
+package postgresql
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+	th "github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/testhelper"
+)
+
+func Test_PersistDataExposureChecks(t *testing.T) {
+	SetupStore()
+	teardown, _ := th.IntegrationDBTestSetup(t, store.DB)
+	defer teardown(t, store.DB)
+
+	var err error
+	ctx := context.Background()
+
+	total := 1200
+	var checks = []endpointmanager.DataExposureCheck{
+		{Search: "Patient?_count=1", HTTPResponse: 200, ResourceType: "Bundle", Total: &total, EntryCount: 1},
+		{Search: "Observation?_count=1", HTTPResponse: 401, ResourceType: "OperationOutcome"},
+		{Search: "Condition?_count=1", Error: "making the GET request failed"},
+	}
+
+	var endpointMetadata1 = &endpointmanager.FHIREndpointMetadata{
+		URL:                  "https://example.com/fhir",
+		HTTPResponse:         200,
+		Availability:         1.0,
+		RequestedFhirVersion: "None",
+		DataExposureChecks:   checks}
+
+	var endpointMetadata2 = &endpointmanager.FHIREndpointMetadata{
+		URL:                  "https://other.example.com/fhir",
+		HTTPResponse:         200,
+		Availability:         1.0,
+		RequestedFhirVersion: "None"}
+
+	// the searches are saved along with the metadata
+	metadataID1, err := store.AddFHIREndpointMetadata(ctx, endpointMetadata1)
+	th.Assert(t, err == nil, err)
+
+	metadataID2, err := store.AddFHIREndpointMetadata(ctx, endpointMetadata2)
+	th.Assert(t, err == nil, err)
+
+	c1, err := store.GetDataExposureChecksUsingMetadataID(ctx, metadataID1)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, len(c1) == 3, fmt.Sprintf("expected 3 searches, got %d", len(c1)))
+	th.Assert(t, c1[0].Total != nil && *c1[0].Total == 1200, fmt.Sprintf("expected a total of 1200, got %v", c1[0].Total))
+	th.Assert(t, c1[1].Total == nil, fmt.Sprintf("expected no total, got %v", c1[1].Total))
+
+	m1, err := store.GetFHIREndpointMetadata(ctx, metadataID1)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, m1.Equal(endpointMetadata1), "retrieved endpointMetadata is not equal to saved endpointMetadata.")
+
+	// metadata without searches
+	m2, err := store.GetFHIREndpointMetadata(ctx, metadataID2)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, m2.DataExposureChecks == nil, "expected the metadata data exposure checks to be nil")
+
+	// the searches are kept when the metadata is deleted
+	_, err = store.DB.ExecContext(ctx, "DELETE FROM fhir_endpoints_metadata WHERE id = $1", metadataID1)
+	th.Assert(t, err == nil, err)
+	var count int
+	err = store.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM fhir_endpoints_data_exposure WHERE url = $1 AND metadata_id IS NULL", endpointMetadata1.URL).Scan(&count)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, count == 3, fmt.Sprintf("expected 3 searches to be kept, got %d", count))
+
+	// pruning only removes searches made before the cutoff
+	numPruned, err := store.PruneDataExposureChecks(ctx, time.Now().Add(-time.Hour))
+	th.Assert(t, err == nil, err)
+	th.Assert(t, numPruned == 0, fmt.Sprintf("expected no searches to be pruned, got %d", numPruned))
+
+	numPruned, err = store.PruneDataExposureChecks(ctx, time.Now().Add(time.Hour))
+	th.Assert(t, err == nil, err)
+	th.Assert(t, numPruned == 3, fmt.Sprintf("expected 3 searches to be pruned, got %d", numPruned))
+}
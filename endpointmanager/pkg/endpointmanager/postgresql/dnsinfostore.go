@@ -0,0 +1,108 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/lib/pq"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+)
+
+// prepared statements are left open to be used throughout the execution of the application
+var addDNSInfoStatement *sql.Stmt
+var getDNSInfoStatement *sql.Stmt
+
+// GetDNSInfoUsingMetadataID gets the DNSInfo recorded for the request with the given metadata id.
+// If there is no DNSInfo for the metadata id, sql.ErrNoRows will be returned.
+func (s *Store) GetDNSInfoUsingMetadataID(ctx context.Context, metadataID int) (*endpointmanager.DNSInfo, error) {
+	var dnsInfo endpointmanager.DNSInfo
+	var errorNullable sql.NullString
+	var addressesJSON []byte
+
+	row := getDNSInfoStatement.QueryRowContext(ctx, metadataID)
+
+	err := row.Scan(
+		&dnsInfo.ID,
+		&dnsInfo.Host,
+		pq.Array(&dnsInfo.CNAMEChain),
+		&addressesJSON,
+		&dnsInfo.TTL,
+		&errorNullable,
+		&dnsInfo.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	dnsInfo.Error = errorNullable.String
+
+	if addressesJSON != nil {
+		err = json.Unmarshal(addressesJSON, &dnsInfo.Addresses)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &dnsInfo, nil
+}
+
+// AddDNSInfo adds the DNSInfo of the request to url to the database, linked to the request with the given metadata
+// id. The hosting providers and IPv6 support are stored in their own columns so that they can be queried without
+// the JSON.
+func (s *Store) AddDNSInfo(ctx context.Context, url string, d *endpointmanager.DNSInfo, metadataID int) error {
+	var addressesJSON []byte
+	var err error
+	if d.Addresses != nil {
+		addressesJSON, err = json.Marshal(d.Addresses)
+		if err != nil {
+			return err
+		}
+	}
+
+	row := addDNSInfoStatement.QueryRowContext(ctx,
+		metadataID,
+		url,
+		d.Host,
+		pq.Array(d.CNAMEChain),
+		addressesJSON,
+		pq.Array(d.HostingProviders()),
+		d.SupportsIPv6(),
+		d.TTL,
+		nullableString(d.Error))
+
+	return row.Scan(&d.ID)
+}
+
+func prepareDNSInfoStatements(s *Store) error {
+	var err error
+	addDNSInfoStatement, err = s.DB.Prepare(`
+		INSERT INTO fhir_endpoints_dns (
+			metadata_id,
+			url,
+			host,
+			cname_chain,
+			addresses,
+			hosting_providers,
+			supports_ipv6,
+			ttl,
+			error)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id`)
+	if err != nil {
+		return err
+	}
+	getDNSInfoStatement, err = s.DB.Prepare(`
+		SELECT
+			id,
+			host,
+			cname_chain,
+			addresses,
+			ttl,
+			error,
+			created_at
+		FROM fhir_endpoints_dns WHERE metadata_id = $1`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+//go:build integration
+// +build integration
+
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+	th "github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/testhelper"
+)
+
+func Test_PersistDNSInfo(t *testing.T) {
+	SetupStore()
+	teardown, _ := th.IntegrationDBTestSetup(t, store.DB)
+	defer teardown(t, store.DB)
+
+	var err error
+	ctx := context.Background()
+
+	var awsDNSInfo = &endpointmanager.DNSInfo{
+		Host:       "example.com",
+		CNAMEChain: []string{"example.com.edge.example.net"},
+		Addresses: []endpointmanager.DNSAddress{
+			{IP: "3.5.140.10", Provider: "AWS", Region: "us-east-1", Service: "AMAZON"},
+			{IP: "2600:1f18::1", Provider: "AWS", Region: "us-east-1", Service: "EC2"},
+		},
+		TTL: 60}
+
+	var azureDNSInfo = &endpointmanager.DNSInfo{
+		Host:       "example.com",
+		CNAMEChain: []string{},
+		Addresses: []endpointmanager.DNSAddress{
+			{IP: "20.42.26.5", Provider: "Azure", Region: "eastus", Service: "AzureAppService"},
+		},
+		TTL: 300}
+
+	var sharedDNSInfo = &endpointmanager.DNSInfo{
+		Host:       "other.example.com",
+		CNAMEChain: []string{},
+		Addresses: []endpointmanager.DNSAddress{
+			{IP: "20.42.26.5", Provider: "Azure", Region: "eastus", Service: "AzureAppService"},
+		},
+		TTL: 300}
+
+	var missingDNSInfo = &endpointmanager.DNSInfo{
+		Host:       "missing.example.com",
+		CNAMEChain: []string{},
+		Addresses:  []endpointmanager.DNSAddress{},
+		Error:      "no such host missing.example.com"}
+
+	var endpointMetadata1 = &endpointmanager.FHIREndpointMetadata{
+		URL:                  "https://example.com/fhir",
+		HTTPResponse:         200,
+		Availability:         1.0,
+		RequestedFhirVersion: "None",
+		DNSInfo:              awsDNSInfo}
+
+	var endpointMetadata2 = &endpointmanager.FHIREndpointMetadata{
+		URL:                  "https://missing.example.com/fhir",
+		HTTPResponse:         0,
+		Availability:         0.0,
+		RequestedFhirVersion: "None",
+		DNSInfo:              missingDNSInfo}
+
+	var endpointMetadata3 = &endpointmanager.FHIREndpointMetadata{
+		URL:                  "https://third.example.com/fhir",
+		HTTPResponse:         200,
+		Availability:         1.0,
+		RequestedFhirVersion: "None"}
+
+	// the DNS info is saved along with the metadata
+	metadataID1, err := store.AddFHIREndpointMetadata(ctx, endpointMetadata1)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, awsDNSInfo.ID != 0, "expected the DNS info ID to be set")
+
+	metadataID2, err := store.AddFHIREndpointMetadata(ctx, endpointMetadata2)
+	th.Assert(t, err == nil, err)
+
+	metadataID3, err := store.AddFHIREndpointMetadata(ctx, endpointMetadata3)
+	th.Assert(t, err == nil, err)
+
+	d1, err := store.GetDNSInfoUsingMetadataID(ctx, metadataID1)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, d1.Equal(awsDNSInfo), fmt.Sprintf("retrieved DNS info %+v is not equal to saved DNS info %+v.", d1, awsDNSInfo))
+
+	m1, err := store.GetFHIREndpointMetadata(ctx, metadataID1)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, m1.Equal(endpointMetadata1), "retrieved endpointMetadata is not equal to saved endpointMetadata.")
+
+	var hostingProviders []string
+	var supportsIPv6 bool
+	row := store.DB.QueryRowContext(ctx, "SELECT hosting_providers, supports_ipv6 FROM fhir_endpoints_dns WHERE metadata_id = $1", metadataID1)
+	err = row.Scan(pq.Array(&hostingProviders), &supportsIPv6)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, len(hostingProviders) == 1 && hostingProviders[0] == "AWS", fmt.Sprintf("expected the hosting providers [AWS], got %v", hostingProviders))
+	th.Assert(t, supportsIPv6, "expected the host to support IPv6")
+
+	// a host that could not be resolved
+	d2, err := store.GetDNSInfoUsingMetadataID(ctx, metadataID2)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, d2.Equal(missingDNSInfo), "retrieved DNS info is not equal to saved DNS info.")
+
+	// metadata without DNS info
+	_, err = store.GetDNSInfoUsingMetadataID(ctx, metadataID3)
+	th.Assert(t, err == sql.ErrNoRows, "expected no DNS info for an endpoint that was not looked up")
+
+	m3, err := store.GetFHIREndpointMetadata(ctx, metadataID3)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, m3.DNSInfo == nil, "expected the metadata DNS info to be nil")
+
+	// a later lookup of the first endpoint that resolved to another hosting provider is listed as a migration
+	var endpointMetadata4 = &endpointmanager.FHIREndpointMetadata{
+		URL:                  endpointMetadata1.URL,
+		HTTPResponse:         200,
+		Availability:         1.0,
+		RequestedFhirVersion: "None",
+		DNSInfo:              azureDNSInfo}
+	metadataID4, err := store.AddFHIREndpointMetadata(ctx, endpointMetadata4)
+	th.Assert(t, err == nil, err)
+
+	var previousProviders []string
+	var currentProviders []string
+	row = store.DB.QueryRowContext(ctx, "SELECT previous_hosting_providers, hosting_providers FROM hosting_provider_migrations WHERE url = $1", endpointMetadata1.URL)
+	err = row.Scan(pq.Array(&previousProviders), pq.Array(&currentProviders))
+	th.Assert(t, err == nil, err)
+	th.Assert(t, len(previousProviders) == 1 && previousProviders[0] == "AWS", fmt.Sprintf("expected the previous hosting providers [AWS], got %v", previousProviders))
+	th.Assert(t, len(currentProviders) == 1 && currentProviders[0] == "Azure", fmt.Sprintf("expected the hosting providers [Azure], got %v", currentProviders))
+
+	// the address is shared with another endpoint once both endpoints' current lookups resolved to it
+	var endpointMetadata5 = &endpointmanager.FHIREndpointMetadata{
+		URL:                  "https://other.example.com/fhir",
+		HTTPResponse:         200,
+		Availability:         1.0,
+		RequestedFhirVersion: "None",
+		DNSInfo:              sharedDNSInfo}
+	metadataID5, err := store.AddFHIREndpointMetadata(ctx, endpointMetadata5)
+	th.Assert(t, err == nil, err)
+
+	valResID, err := store.AddValidationResult(ctx)
+	th.Assert(t, err == nil, err)
+	for url, metadataID := range map[string]int{endpointMetadata4.URL: metadataID4, endpointMetadata5.URL: metadataID5} {
+		var endpointInfo = &endpointmanager.FHIREndpointInfo{
+			URL:                  url,
+			RequestedFhirVersion: "None",
+			SMARTResponseBytes:   []byte("null"),
+			ValidationID:         valResID}
+		err = store.AddFHIREndpointInfo(ctx, endpointInfo, metadataID)
+		th.Assert(t, err == nil, err)
+	}
+
+	var endpointCount int
+	var provider string
+	row = store.DB.QueryRowContext(ctx, "SELECT endpoint_count, hosting_provider FROM shared_host_addresses WHERE ip = $1", "20.42.26.5")
+	err = row.Scan(&endpointCount, &provider)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, endpointCount == 2, fmt.Sprintf("expected the address to be shared by 2 endpoints, got %d", endpointCount))
+	th.Assert(t, provider == "Azure", fmt.Sprintf("expected the hosting provider Azure, got %s", provider))
+}
@@ -55,6 +55,8 @@ func (s *Store) GetFHIREndpointInfo(ctx context.Context, id int) (*endpointmanag
 	var healthitProductIDNullable sql.NullInt64
 	var validationResultIDNullable sql.NullInt64
 	var vendorIDNullable sql.NullInt64
+	var capabilityStatementFormatNullable sql.NullString
+	var bulkDataJSON []byte
 	var smartResponseJSON []byte
 	var operResourceJSON []byte
 	var metadataID int
@@ -77,7 +79,9 @@ func (s *Store) GetFHIREndpointInfo(ctx context.Context, id int) (*endpointmanag
 		validation_result_id,
 		metadata_id,
 		requested_fhir_version,
-		capability_fhir_version
+		capability_fhir_version,
+		capability_statement_format,
+		bulk_data
 	FROM fhir_endpoints_info WHERE id=$1`
 	row := s.DB.QueryRowContext(ctx, sqlStatementInfo, id)
 
@@ -98,7 +102,9 @@ func (s *Store) GetFHIREndpointInfo(ctx context.Context, id int) (*endpointmanag
 		&validationResultIDNullable,
 		&metadataID,
 		&endpointInfo.RequestedFhirVersion,
-		&endpointInfo.CapabilityFhirVersion)
+		&endpointInfo.CapabilityFhirVersion,
+		&capabilityStatementFormatNullable,
+		&bulkDataJSON)
 	if err != nil {
 		return nil, err
 	}
@@ -114,6 +120,14 @@ func (s *Store) GetFHIREndpointInfo(ctx context.Context, id int) (*endpointmanag
 	endpointInfo.HealthITProductID = ints[0]
 	endpointInfo.VendorID = ints[1]
 	endpointInfo.ValidationID = ints[2]
+	endpointInfo.CapabilityStatementFormat = capabilityStatementFormatNullable.String
+
+	if bulkDataJSON != nil {
+		err = json.Unmarshal(bulkDataJSON, &endpointInfo.BulkData)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	if includedFieldsJSON != nil {
 		err = json.Unmarshal(includedFieldsJSON, &endpointInfo.IncludedFields)
@@ -172,7 +186,9 @@ func (s *Store) GetFHIREndpointInfosUsingURL(ctx context.Context, url string) ([
 		supported_profiles,
 		metadata_id,
 		requested_fhir_version,
-		capability_fhir_version
+		capability_fhir_version,
+		capability_statement_format,
+		bulk_data
 	FROM fhir_endpoints_info WHERE fhir_endpoints_info.url = $1`
 
 	rows, err := s.DB.QueryContext(ctx, sqlStatementInfo, url)
@@ -188,6 +204,8 @@ func (s *Store) GetFHIREndpointInfosUsingURL(ctx context.Context, url string) ([
 		var healthitProductIDNullable sql.NullInt64
 		var validationResultIDNullable sql.NullInt64
 		var vendorIDNullable sql.NullInt64
+		var capabilityStatementFormatNullable sql.NullString
+		var bulkDataJSON []byte
 		var smartResponseJSON []byte
 		var metadataID int
 
@@ -208,7 +226,9 @@ func (s *Store) GetFHIREndpointInfosUsingURL(ctx context.Context, url string) ([
 			&supportedProfilesJSON,
 			&metadataID,
 			&endpointInfo.RequestedFhirVersion,
-			&endpointInfo.CapabilityFhirVersion)
+			&endpointInfo.CapabilityFhirVersion,
+			&capabilityStatementFormatNullable,
+			&bulkDataJSON)
 		if err != nil {
 			return nil, err
 		}
@@ -224,6 +244,14 @@ func (s *Store) GetFHIREndpointInfosUsingURL(ctx context.Context, url string) ([
 		endpointInfo.HealthITProductID = ints[0]
 		endpointInfo.VendorID = ints[1]
 		endpointInfo.ValidationID = ints[2]
+		endpointInfo.CapabilityStatementFormat = capabilityStatementFormatNullable.String
+
+		if bulkDataJSON != nil {
+			err = json.Unmarshal(bulkDataJSON, &endpointInfo.BulkData)
+			if err != nil {
+				return nil, err
+			}
+		}
 
 		if includedFieldsJSON != nil {
 			err = json.Unmarshal(includedFieldsJSON, &endpointInfo.IncludedFields)
@@ -275,6 +303,8 @@ func (s *Store) GetFHIREndpointInfoUsingURLAndRequestedVersion(ctx context.Conte
 	var healthitProductIDNullable sql.NullInt64
 	var validationResultIDNullable sql.NullInt64
 	var vendorIDNullable sql.NullInt64
+	var capabilityStatementFormatNullable sql.NullString
+	var bulkDataJSON []byte
 	var smartResponseJSON []byte
 	var operResourceJSON []byte
 	var metadataID int
@@ -297,7 +327,9 @@ func (s *Store) GetFHIREndpointInfoUsingURLAndRequestedVersion(ctx context.Conte
 		validation_result_id,
 		metadata_id,
 		requested_fhir_version,
-		capability_fhir_version
+		capability_fhir_version,
+		capability_statement_format,
+		bulk_data
 	FROM fhir_endpoints_info WHERE fhir_endpoints_info.url = $1 AND fhir_endpoints_info.requested_fhir_version = $2 LIMIT 1`
 
 	row := s.DB.QueryRowContext(ctx, sqlStatementInfo, url, requestedVersion)
@@ -319,7 +351,9 @@ func (s *Store) GetFHIREndpointInfoUsingURLAndRequestedVersion(ctx context.Conte
 		&validationResultIDNullable,
 		&metadataID,
 		&endpointInfo.RequestedFhirVersion,
-		&endpointInfo.CapabilityFhirVersion)
+		&endpointInfo.CapabilityFhirVersion,
+		&capabilityStatementFormatNullable,
+		&bulkDataJSON)
 	if err != nil {
 		return nil, err
 	}
@@ -335,6 +369,14 @@ func (s *Store) GetFHIREndpointInfoUsingURLAndRequestedVersion(ctx context.Conte
 	endpointInfo.HealthITProductID = ints[0]
 	endpointInfo.VendorID = ints[1]
 	endpointInfo.ValidationID = ints[2]
+	endpointInfo.CapabilityStatementFormat = capabilityStatementFormatNullable.String
+
+	if bulkDataJSON != nil {
+		err = json.Unmarshal(bulkDataJSON, &endpointInfo.BulkData)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	if includedFieldsJSON != nil {
 		err = json.Unmarshal(includedFieldsJSON, &endpointInfo.IncludedFields)
@@ -413,6 +455,14 @@ func (s *Store) AddFHIREndpointInfo(ctx context.Context, e *endpointmanager.FHIR
 		return err
 	}
 
+	var bulkDataJSON []byte
+	if e.BulkData != nil {
+		bulkDataJSON, err = json.Marshal(e.BulkData)
+		if err != nil {
+			return err
+		}
+	}
+
 	var smartResponseJSON []byte
 	if e.SMARTResponseBytes != nil {
 		smartResponseJSON = safeJSONOrNull(e.SMARTResponseBytes)
@@ -436,7 +486,9 @@ func (s *Store) AddFHIREndpointInfo(ctx context.Context, e *endpointmanager.FHIR
 		nullableInts[2],
 		metadataID,
 		e.RequestedFhirVersion,
-		e.CapabilityFhirVersion)
+		e.CapabilityFhirVersion,
+		e.CapabilityStatementFormat,
+		bulkDataJSON)
 
 	err = row.Scan(&e.ID)
 
@@ -475,6 +527,14 @@ func (s *Store) UpdateFHIREndpointInfo(ctx context.Context, e *endpointmanager.F
 		return err
 	}
 
+	var bulkDataJSON []byte
+	if e.BulkData != nil {
+		bulkDataJSON, err = json.Marshal(e.BulkData)
+		if err != nil {
+			return err
+		}
+	}
+
 	var smartResponseJSON []byte
 	if e.SMARTResponseBytes != nil {
 		smartResponseJSON = safeJSONOrNull(e.SMARTResponseBytes)
@@ -505,6 +565,8 @@ func (s *Store) UpdateFHIREndpointInfo(ctx context.Context, e *endpointmanager.F
 		metadataID,
 		e.RequestedFhirVersion,
 		e.CapabilityFhirVersion,
+		e.CapabilityStatementFormat,
+		bulkDataJSON,
 		e.ID)
 
 	return err
@@ -561,6 +623,8 @@ func (s *Store) GetFHIREndpointInfosByURLWithDifferentRequestedVersion(ctx conte
 		var healthitProductIDNullable sql.NullInt64
 		var validationResultIDNullable sql.NullInt64
 		var vendorIDNullable sql.NullInt64
+		var capabilityStatementFormatNullable sql.NullString
+		var bulkDataJSON []byte
 		var smartResponseJSON []byte
 		var metadataID int
 
@@ -581,7 +645,9 @@ func (s *Store) GetFHIREndpointInfosByURLWithDifferentRequestedVersion(ctx conte
 			&supportedProfilesJSON,
 			&metadataID,
 			&endpointInfo.RequestedFhirVersion,
-			&endpointInfo.CapabilityFhirVersion)
+			&endpointInfo.CapabilityFhirVersion,
+			&capabilityStatementFormatNullable,
+			&bulkDataJSON)
 		if err != nil {
 			return nil, err
 		}
@@ -597,6 +663,14 @@ func (s *Store) GetFHIREndpointInfosByURLWithDifferentRequestedVersion(ctx conte
 		endpointInfo.HealthITProductID = ints[0]
 		endpointInfo.VendorID = ints[1]
 		endpointInfo.ValidationID = ints[2]
+		endpointInfo.CapabilityStatementFormat = capabilityStatementFormatNullable.String
+
+		if bulkDataJSON != nil {
+			err = json.Unmarshal(bulkDataJSON, &endpointInfo.BulkData)
+			if err != nil {
+				return nil, err
+			}
+		}
 
 		if includedFieldsJSON != nil {
 			err = json.Unmarshal(includedFieldsJSON, &endpointInfo.IncludedFields)
@@ -649,8 +723,10 @@ func prepareFHIREndpointInfoStatements(s *Store) error {
 			validation_result_id,
 			metadata_id,
 			requested_fhir_version,
-			capability_fhir_version)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+			capability_fhir_version,
+			capability_statement_format,
+			bulk_data)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
 		RETURNING id`)
 	if err != nil {
 		return err
@@ -671,8 +747,10 @@ func prepareFHIREndpointInfoStatements(s *Store) error {
 			validation_result_id = $11,
 			metadata_id = $12,
 			requested_fhir_version = $13,
-			capability_fhir_version = $14		
-		WHERE id = $15`)
+			capability_fhir_version = $14,
+			capability_statement_format = $15,
+			bulk_data = $16
+		WHERE id = $17`)
 	if err != nil {
 		return err
 	}
@@ -714,7 +792,9 @@ func prepareFHIREndpointInfoStatements(s *Store) error {
 		supported_profiles,
 		metadata_id,
 		requested_fhir_version,
-		capability_fhir_version
+		capability_fhir_version,
+		capability_statement_format,
+		bulk_data
 		FROM fhir_endpoints_info WHERE fhir_endpoints_info.url = $1 AND NOT (fhir_endpoints_info.requested_fhir_version = ANY (string_to_array($2,',','')))`)
 	if err != nil {
 		return err
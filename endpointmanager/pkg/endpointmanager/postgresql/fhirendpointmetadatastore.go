@@ -3,6 +3,7 @@ package postgresql
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 
 	log "github.com/sirupsen/logrus"
 
@@ -27,12 +28,34 @@ func (s *Store) GetFHIREndpointMetadata(ctx context.Context, metadataID int) (*e
 		response_time_seconds,
 		smart_http_response,
 		requested_fhir_version,
+		dns_lookup_seconds,
+		tcp_connect_seconds,
+		tls_handshake_seconds,
+		time_to_first_byte_seconds,
+		body_transfer_seconds,
+		scheduler_wait_seconds,
+		error_code,
+		response_headers,
+		redirect_chain,
+		error_response,
+		not_modified,
 		updated_at,
 		created_at 
 	FROM fhir_endpoints_metadata WHERE id=$1;`
 
 	row := s.DB.QueryRowContext(ctx, sqlStatementMetadata, metadataID)
 
+	var dnsLookupNullable sql.NullFloat64
+	var tcpConnectNullable sql.NullFloat64
+	var tlsHandshakeNullable sql.NullFloat64
+	var timeToFirstByteNullable sql.NullFloat64
+	var bodyTransferNullable sql.NullFloat64
+	var schedulerWaitNullable sql.NullFloat64
+	var errorCodeNullable sql.NullString
+	var responseHeadersJSON []byte
+	var redirectChainJSON []byte
+	var errorResponseJSON []byte
+
 	err := row.Scan(
 		&endpointMetadata.URL,
 		&endpointMetadata.HTTPResponse,
@@ -41,12 +64,103 @@ func (s *Store) GetFHIREndpointMetadata(ctx context.Context, metadataID int) (*e
 		&endpointMetadata.ResponseTime,
 		&endpointMetadata.SMARTHTTPResponse,
 		&endpointMetadata.RequestedFhirVersion,
+		&dnsLookupNullable,
+		&tcpConnectNullable,
+		&tlsHandshakeNullable,
+		&timeToFirstByteNullable,
+		&bodyTransferNullable,
+		&schedulerWaitNullable,
+		&errorCodeNullable,
+		&responseHeadersJSON,
+		&redirectChainJSON,
+		&errorResponseJSON,
+		&endpointMetadata.NotModified,
 		&endpointMetadata.UpdatedAt,
 		&endpointMetadata.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
 
+	// metadata entries added before the timings were collected do not have them
+	endpointMetadata.DNSLookupTime = dnsLookupNullable.Float64
+	endpointMetadata.TCPConnectTime = tcpConnectNullable.Float64
+	endpointMetadata.TLSHandshakeTime = tlsHandshakeNullable.Float64
+	endpointMetadata.TimeToFirstByte = timeToFirstByteNullable.Float64
+	endpointMetadata.BodyTransferTime = bodyTransferNullable.Float64
+	endpointMetadata.SchedulerWaitTime = schedulerWaitNullable.Float64
+	endpointMetadata.ErrorCode = endpointmanager.QueryErrorCode(errorCodeNullable.String)
+	if responseHeadersJSON != nil {
+		err = json.Unmarshal(responseHeadersJSON, &endpointMetadata.ResponseHeaders)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if redirectChainJSON != nil {
+		err = json.Unmarshal(redirectChainJSON, &endpointMetadata.RedirectChain)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if errorResponseJSON != nil {
+		err = json.Unmarshal(errorResponseJSON, &endpointMetadata.ErrorResponse)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	endpointMetadata.TLSInfo, err = s.GetTLSInfoUsingMetadataID(ctx, metadataID)
+	if err == sql.ErrNoRows {
+		endpointMetadata.TLSInfo = nil
+		err = nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	endpointMetadata.JWKSInfo, err = s.GetJWKSInfoUsingMetadataID(ctx, metadataID)
+	if err == sql.ErrNoRows {
+		endpointMetadata.JWKSInfo = nil
+		err = nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	endpointMetadata.AuthServerMetadata, err = s.GetAuthServerMetadataUsingMetadataID(ctx, metadataID)
+	if err == sql.ErrNoRows {
+		endpointMetadata.AuthServerMetadata = nil
+		err = nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	endpointMetadata.UDAPInfo, err = s.GetUDAPInfoUsingMetadataID(ctx, metadataID)
+	if err == sql.ErrNoRows {
+		endpointMetadata.UDAPInfo = nil
+		err = nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	endpointMetadata.CDSHooksInfo, err = s.GetCDSHooksInfoUsingMetadataID(ctx, metadataID)
+	if err == sql.ErrNoRows {
+		endpointMetadata.CDSHooksInfo = nil
+		err = nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	endpointMetadata.DNSInfo, err = s.GetDNSInfoUsingMetadataID(ctx, metadataID)
+	if err == sql.ErrNoRows {
+		endpointMetadata.DNSInfo = nil
+		err = nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	endpointMetadata.DataExposureChecks, err = s.GetDataExposureChecksUsingMetadataID(ctx, metadataID)
+	if err != nil {
+		return nil, err
+	}
+
 	return &endpointMetadata, err
 }
 
@@ -67,6 +181,34 @@ func (s *Store) AddFHIREndpointMetadata(ctx context.Context, e *endpointmanager.
 		e.Errors = e.Errors[:maxErrorLen]
 	}
 
+	var errorCodeNullable sql.NullString
+	if e.ErrorCode != "" {
+		errorCodeNullable.Valid = true
+		errorCodeNullable.String = string(e.ErrorCode)
+	}
+
+	var responseHeadersJSON []byte
+	if e.ResponseHeaders != nil {
+		responseHeadersJSON, err = json.Marshal(e.ResponseHeaders)
+		if err != nil {
+			return metadataID, err
+		}
+	}
+	var redirectChainJSON []byte
+	if e.RedirectChain != nil {
+		redirectChainJSON, err = json.Marshal(e.RedirectChain)
+		if err != nil {
+			return metadataID, err
+		}
+	}
+	var errorResponseJSON []byte
+	if e.ErrorResponse != nil {
+		errorResponseJSON, err = json.Marshal(e.ErrorResponse)
+		if err != nil {
+			return metadataID, err
+		}
+	}
+
 	row := addFHIREndpointMetadataStatement.QueryRowContext(ctx,
 		e.URL,
 		e.HTTPResponse,
@@ -74,9 +216,69 @@ func (s *Store) AddFHIREndpointMetadata(ctx context.Context, e *endpointmanager.
 		e.Errors,
 		e.ResponseTime,
 		e.SMARTHTTPResponse,
-		e.RequestedFhirVersion)
+		e.RequestedFhirVersion,
+		e.DNSLookupTime,
+		e.TCPConnectTime,
+		e.TLSHandshakeTime,
+		e.TimeToFirstByte,
+		e.BodyTransferTime,
+		e.SchedulerWaitTime,
+		errorCodeNullable,
+		responseHeadersJSON,
+		redirectChainJSON,
+		errorResponseJSON,
+		e.NotModified)
 
 	err = row.Scan(&metadataID)
+	if err != nil {
+		return metadataID, err
+	}
+
+	if e.TLSInfo != nil {
+		err = s.AddTLSInfo(ctx, e.TLSInfo, metadataID)
+		if err != nil {
+			return metadataID, err
+		}
+	}
+
+	if e.JWKSInfo != nil {
+		err = s.AddJWKSInfo(ctx, e.JWKSInfo, metadataID)
+		if err != nil {
+			return metadataID, err
+		}
+	}
+
+	if e.AuthServerMetadata != nil {
+		err = s.AddAuthServerMetadata(ctx, e.AuthServerMetadata, metadataID)
+		if err != nil {
+			return metadataID, err
+		}
+	}
+
+	if e.UDAPInfo != nil {
+		err = s.AddUDAPInfo(ctx, e.UDAPInfo, metadataID)
+		if err != nil {
+			return metadataID, err
+		}
+	}
+
+	if e.CDSHooksInfo != nil {
+		err = s.AddCDSHooksInfo(ctx, e.CDSHooksInfo, metadataID)
+		if err != nil {
+			return metadataID, err
+		}
+	}
+
+	if e.DNSInfo != nil {
+		err = s.AddDNSInfo(ctx, e.URL, e.DNSInfo, metadataID)
+		if err != nil {
+			return metadataID, err
+		}
+	}
+
+	if e.DataExposureChecks != nil {
+		err = s.AddDataExposureChecks(ctx, e.URL, e.DataExposureChecks, metadataID)
+	}
 
 	return metadataID, err
 }
@@ -91,8 +293,19 @@ func prepareFHIREndpointMetadataStatements(s *Store) error {
 			errors,
 			response_time_seconds,
 			smart_http_response,
-			requested_fhir_version)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+			requested_fhir_version,
+			dns_lookup_seconds,
+			tcp_connect_seconds,
+			tls_handshake_seconds,
+			time_to_first_byte_seconds,
+			body_transfer_seconds,
+			scheduler_wait_seconds,
+			error_code,
+			response_headers,
+			redirect_chain,
+			error_response,
+			not_modified)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)
 		RETURNING id`)
 	return err
 }
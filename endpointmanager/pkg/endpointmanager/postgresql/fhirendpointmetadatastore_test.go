@@ -37,7 +37,13 @@ func Test_PersistFHIREndpointMetadata(t *testing.T) {
 	var endpointMetadata1 = &endpointmanager.FHIREndpointMetadata{
 		URL:                  "example.com/FHIR/DSTU2/",
 		HTTPResponse:         200,
+		NotModified:          true,
 		Errors:               "Example Error",
+		ErrorCode:            endpointmanager.UnknownErrorCode,
+		ResponseHeaders:      map[string]string{"Content-Type": "application/json+fhir", "Strict-Transport-Security": "max-age=31536000"},
+		DNSLookupTime:        0.0125,
+		BodyTransferTime:     0.25,
+		SchedulerWaitTime:    1.5,
 		SMARTHTTPResponse:    0,
 		Availability:         1.0,
 		RequestedFhirVersion: "None"}
@@ -46,6 +52,8 @@ func Test_PersistFHIREndpointMetadata(t *testing.T) {
 		URL:                  "other.example.com/FHIR/DSTU2/",
 		HTTPResponse:         404,
 		Errors:               "Example Error 2",
+		ErrorCode:            endpointmanager.HTTPStatusCode,
+		RedirectChain:        []endpointmanager.RedirectHop{{URL: "http://other.example.com/FHIR/DSTU2/metadata", Scheme: "http", StatusCode: 301, Location: "https://other.example.com/FHIR/DSTU2/metadata"}},
 		SMARTHTTPResponse:    0,
 		Availability:         0,
 		RequestedFhirVersion: "None"}
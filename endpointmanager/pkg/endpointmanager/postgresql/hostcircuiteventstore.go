@@ -0,0 +1,79 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+)
+
+// prepared statements are left open to be used throughout the execution of the application
+var addHostCircuitEventStatement *sql.Stmt
+var getHostCircuitEventsStatement *sql.Stmt
+
+// GetHostCircuitEventsUsingHost gets the circuit breaker transitions recorded for the given host, oldest first.
+func (s *Store) GetHostCircuitEventsUsingHost(ctx context.Context, host string) ([]endpointmanager.HostCircuitEvent, error) {
+	rows, err := getHostCircuitEventsStatement.QueryContext(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []endpointmanager.HostCircuitEvent
+	for rows.Next() {
+		var event endpointmanager.HostCircuitEvent
+		err = rows.Scan(
+			&event.ID,
+			&event.Host,
+			&event.FromState,
+			&event.ToState,
+			&event.ConsecutiveFailures,
+			&event.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+// AddHostCircuitEvent adds the HostCircuitEvent to the database.
+func (s *Store) AddHostCircuitEvent(ctx context.Context, e *endpointmanager.HostCircuitEvent) error {
+	row := addHostCircuitEventStatement.QueryRowContext(ctx,
+		e.Host,
+		e.FromState,
+		e.ToState,
+		e.ConsecutiveFailures)
+
+	return row.Scan(&e.ID, &e.CreatedAt)
+}
+
+func prepareHostCircuitEventStatements(s *Store) error {
+	var err error
+	addHostCircuitEventStatement, err = s.DB.Prepare(`
+		INSERT INTO host_circuit_events (
+			host,
+			from_state,
+			to_state,
+			consecutive_failures)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`)
+	if err != nil {
+		return err
+	}
+	getHostCircuitEventsStatement, err = s.DB.Prepare(`
+		SELECT
+			id,
+			host,
+			from_state,
+			to_state,
+			consecutive_failures,
+			created_at
+		FROM host_circuit_events WHERE host = $1
+		ORDER BY created_at, id`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
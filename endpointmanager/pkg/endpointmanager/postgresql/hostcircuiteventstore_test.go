@@ -0,0 +1,67 @@
+//go:build integration
+// +build integration
+
+package postgresql
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+	th "github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/testhelper"
+)
+
+func Test_PersistHostCircuitEvent(t *testing.T) {
+	SetupStore()
+	teardown, _ := th.IntegrationDBTestSetup(t, store.DB)
+	defer teardown(t, store.DB)
+
+	var err error
+	ctx := context.Background()
+
+	var opened = &endpointmanager.HostCircuitEvent{
+		Host:                "fhir.example.com",
+		FromState:           endpointmanager.CircuitClosed,
+		ToState:             endpointmanager.CircuitOpen,
+		ConsecutiveFailures: 5}
+
+	var halfOpened = &endpointmanager.HostCircuitEvent{
+		Host:                "fhir.example.com",
+		FromState:           endpointmanager.CircuitOpen,
+		ToState:             endpointmanager.CircuitHalfOpen,
+		ConsecutiveFailures: 5}
+
+	var otherHost = &endpointmanager.HostCircuitEvent{
+		Host:                "other.example.com",
+		FromState:           endpointmanager.CircuitClosed,
+		ToState:             endpointmanager.CircuitOpen,
+		ConsecutiveFailures: 3}
+
+	// add events
+
+	err = store.AddHostCircuitEvent(ctx, opened)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, opened.ID != 0, "expected the event ID to be set")
+	th.Assert(t, !opened.CreatedAt.IsZero(), "expected the event creation time to be set")
+
+	err = store.AddHostCircuitEvent(ctx, halfOpened)
+	th.Assert(t, err == nil, err)
+
+	err = store.AddHostCircuitEvent(ctx, otherHost)
+	th.Assert(t, err == nil, err)
+
+	// retrieve events
+
+	events, err := store.GetHostCircuitEventsUsingHost(ctx, "fhir.example.com")
+	th.Assert(t, err == nil, err)
+	th.Assert(t, len(events) == 2, fmt.Sprintf("expected 2 events for the host, got %d", len(events)))
+	th.Assert(t, events[0].ID == opened.ID, "expected the events to be ordered oldest first")
+	th.Assert(t, events[0].ToState == endpointmanager.CircuitOpen, fmt.Sprintf("expected the first event to open the circuit, got %s", events[0].ToState))
+	th.Assert(t, events[1].FromState == endpointmanager.CircuitOpen && events[1].ToState == endpointmanager.CircuitHalfOpen, fmt.Sprintf("expected the second event to half-open the circuit, got %+v", events[1]))
+	th.Assert(t, events[0].ConsecutiveFailures == 5, fmt.Sprintf("expected 5 consecutive failures, got %d", events[0].ConsecutiveFailures))
+
+	events, err = store.GetHostCircuitEventsUsingHost(ctx, "missing.example.com")
+	th.Assert(t, err == nil, err)
+	th.Assert(t, len(events) == 0, fmt.Sprintf("expected no events for a host without transitions, got %d", len(events)))
+}
@@ -0,0 +1,103 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+)
+
+// prepared statements are left open to be used throughout the execution of the application
+var addJWKSInfoStatement *sql.Stmt
+var getJWKSInfoStatement *sql.Stmt
+
+// GetJWKSInfoUsingMetadataID gets the JWKSInfo recorded for the request with the given metadata id.
+// If there is no JWKSInfo for the metadata id, sql.ErrNoRows will be returned.
+func (s *Store) GetJWKSInfoUsingMetadataID(ctx context.Context, metadataID int) (*endpointmanager.JWKSInfo, error) {
+	var jwksInfo endpointmanager.JWKSInfo
+	var errorNullable sql.NullString
+	var keysJSON []byte
+
+	row := getJWKSInfoStatement.QueryRowContext(ctx, metadataID)
+
+	err := row.Scan(
+		&jwksInfo.ID,
+		&jwksInfo.URL,
+		&jwksInfo.HTTPResponse,
+		&errorNullable,
+		&keysJSON,
+		&jwksInfo.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	jwksInfo.Error = errorNullable.String
+
+	if keysJSON != nil {
+		err = json.Unmarshal(keysJSON, &jwksInfo.Keys)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &jwksInfo, nil
+}
+
+// AddJWKSInfo adds the JWKSInfo to the database, linked to the request with the given metadata id.
+func (s *Store) AddJWKSInfo(ctx context.Context, j *endpointmanager.JWKSInfo, metadataID int) error {
+	var errorNullable sql.NullString
+	if j.Error != "" {
+		errorNullable.Valid = true
+		errorNullable.String = j.Error
+		if len(errorNullable.String) > 500 {
+			errorNullable.String = errorNullable.String[:500]
+		}
+	}
+
+	var keysJSON []byte
+	var err error
+	if j.Keys != nil {
+		keysJSON, err = json.Marshal(j.Keys)
+		if err != nil {
+			return err
+		}
+	}
+
+	row := addJWKSInfoStatement.QueryRowContext(ctx,
+		metadataID,
+		j.URL,
+		j.HTTPResponse,
+		errorNullable,
+		keysJSON)
+
+	return row.Scan(&j.ID)
+}
+
+func prepareJWKSInfoStatements(s *Store) error {
+	var err error
+	addJWKSInfoStatement, err = s.DB.Prepare(`
+		INSERT INTO fhir_endpoints_jwks (
+			metadata_id,
+			url,
+			http_response,
+			error,
+			keys)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id`)
+	if err != nil {
+		return err
+	}
+	getJWKSInfoStatement, err = s.DB.Prepare(`
+		SELECT
+			id,
+			url,
+			http_response,
+			error,
+			keys,
+			created_at
+		FROM fhir_endpoints_jwks WHERE metadata_id = $1`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+//go:build integration
+// +build integration
+
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+	th "github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/testhelper"
+)
+
+func Test_PersistJWKSInfo(t *testing.T) {
+	SetupStore()
+	teardown, _ := th.IntegrationDBTestSetup(t, store.DB)
+	defer teardown(t, store.DB)
+
+	var err error
+	ctx := context.Background()
+
+	var jwksInfo = &endpointmanager.JWKSInfo{
+		URL:          "https://example.com/jwks",
+		HTTPResponse: 200,
+		Keys: []endpointmanager.JWK{
+			{KeyType: "RSA", Algorithm: "RS384", Use: "sig", KeyID: "key-1", KeySize: 2048},
+			{KeyType: "EC", Algorithm: "ES384", Use: "sig", Curve: "P-384", KeySize: 384, HasPrivateKey: true},
+		}}
+
+	var unreachableJWKSInfo = &endpointmanager.JWKSInfo{
+		URL:   "https://other.example.com/jwks",
+		Error: "making the GET request to https://other.example.com/jwks failed"}
+
+	var endpointMetadata1 = &endpointmanager.FHIREndpointMetadata{
+		URL:                  "example.com/FHIR/DSTU2/",
+		HTTPResponse:         200,
+		Availability:         1.0,
+		RequestedFhirVersion: "None",
+		JWKSInfo:             jwksInfo}
+
+	var endpointMetadata2 = &endpointmanager.FHIREndpointMetadata{
+		URL:                  "http://other.example.com/FHIR/DSTU2/",
+		HTTPResponse:         200,
+		Availability:         1.0,
+		RequestedFhirVersion: "None",
+		JWKSInfo:             unreachableJWKSInfo}
+
+	var endpointMetadata3 = &endpointmanager.FHIREndpointMetadata{
+		URL:                  "http://third.example.com/FHIR/DSTU2/",
+		HTTPResponse:         200,
+		Availability:         1.0,
+		RequestedFhirVersion: "None"}
+
+	// the JWKS info is saved along with the metadata
+	metadataID1, err := store.AddFHIREndpointMetadata(ctx, endpointMetadata1)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, jwksInfo.ID != 0, "expected the JWKS info ID to be set")
+
+	metadataID2, err := store.AddFHIREndpointMetadata(ctx, endpointMetadata2)
+	th.Assert(t, err == nil, err)
+
+	metadataID3, err := store.AddFHIREndpointMetadata(ctx, endpointMetadata3)
+	th.Assert(t, err == nil, err)
+
+	j1, err := store.GetJWKSInfoUsingMetadataID(ctx, metadataID1)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, j1.Equal(jwksInfo), "retrieved JWKS info is not equal to saved JWKS info.")
+
+	m1, err := store.GetFHIREndpointMetadata(ctx, metadataID1)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, m1.Equal(endpointMetadata1), "retrieved endpointMetadata is not equal to saved endpointMetadata.")
+
+	// a key set that could not be retrieved
+	j2, err := store.GetJWKSInfoUsingMetadataID(ctx, metadataID2)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, j2.Equal(unreachableJWKSInfo), "retrieved JWKS info is not equal to saved JWKS info.")
+
+	// metadata without JWKS info
+	_, err = store.GetJWKSInfoUsingMetadataID(ctx, metadataID3)
+	th.Assert(t, err == sql.ErrNoRows, "expected no JWKS info for an endpoint that does not advertise a jwks_uri")
+
+	m3, err := store.GetFHIREndpointMetadata(ctx, metadataID3)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, m3.JWKSInfo == nil, "expected the metadata JWKS info to be nil")
+}
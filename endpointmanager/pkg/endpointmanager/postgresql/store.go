@@ -54,6 +54,42 @@ func NewStore(host string, port int, user string, password string, dbname string
 	if err != nil {
 		return nil, err
 	}
+	err = prepareTLSInfoStatements(&store)
+	if err != nil {
+		return nil, err
+	}
+	err = prepareJWKSInfoStatements(&store)
+	if err != nil {
+		return nil, err
+	}
+	err = prepareAuthServerMetadataStatements(&store)
+	if err != nil {
+		return nil, err
+	}
+	err = prepareUDAPInfoStatements(&store)
+	if err != nil {
+		return nil, err
+	}
+	err = prepareCDSHooksInfoStatements(&store)
+	if err != nil {
+		return nil, err
+	}
+	err = prepareDNSInfoStatements(&store)
+	if err != nil {
+		return nil, err
+	}
+	err = prepareDataExposureStatements(&store)
+	if err != nil {
+		return nil, err
+	}
+	err = prepareAudienceStatements(&store)
+	if err != nil {
+		return nil, err
+	}
+	err = prepareHostCircuitEventStatements(&store)
+	if err != nil {
+		return nil, err
+	}
 	err = prepareValidationStatements(&store)
 	if err != nil {
 		return nil, err
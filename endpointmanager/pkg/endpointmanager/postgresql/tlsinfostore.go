@@ -0,0 +1,131 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+)
+
+// prepared statements are left open to be used throughout the execution of the application
+var addTLSInfoStatement *sql.Stmt
+var getTLSInfoStatement *sql.Stmt
+
+// GetTLSInfoUsingMetadataID gets the TLSInfo recorded for the request with the given metadata id.
+// If there is no TLSInfo for the metadata id, sql.ErrNoRows will be returned.
+func (s *Store) GetTLSInfoUsingMetadataID(ctx context.Context, metadataID int) (*endpointmanager.TLSInfo, error) {
+	var tlsInfo endpointmanager.TLSInfo
+	var verificationErrorNullable sql.NullString
+
+	row := getTLSInfoStatement.QueryRowContext(ctx, metadataID)
+
+	err := row.Scan(
+		&tlsInfo.ID,
+		&tlsInfo.TLSVersion,
+		&tlsInfo.CipherSuite,
+		&tlsInfo.ALPNProtocol,
+		&tlsInfo.LeafSubject,
+		pq.Array(&tlsInfo.LeafSANs),
+		&tlsInfo.LeafIssuer,
+		&tlsInfo.NotBefore,
+		&tlsInfo.NotAfter,
+		&tlsInfo.KeyType,
+		&tlsInfo.KeySize,
+		&tlsInfo.ChainLength,
+		&tlsInfo.ChainVerified,
+		&verificationErrorNullable,
+		&tlsInfo.HostnameMatch,
+		&tlsInfo.SelfSigned,
+		&tlsInfo.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	tlsInfo.VerificationError = verificationErrorNullable.String
+
+	return &tlsInfo, nil
+}
+
+// AddTLSInfo adds the TLSInfo to the database, linked to the request with the given metadata id.
+func (s *Store) AddTLSInfo(ctx context.Context, t *endpointmanager.TLSInfo, metadataID int) error {
+	var verificationErrorNullable sql.NullString
+	if t.VerificationError != "" {
+		verificationErrorNullable.Valid = true
+		verificationErrorNullable.String = t.VerificationError
+		if len(verificationErrorNullable.String) > 500 {
+			verificationErrorNullable.String = verificationErrorNullable.String[:500]
+		}
+	}
+
+	row := addTLSInfoStatement.QueryRowContext(ctx,
+		metadataID,
+		t.TLSVersion,
+		t.CipherSuite,
+		t.ALPNProtocol,
+		t.LeafSubject,
+		pq.Array(t.LeafSANs),
+		t.LeafIssuer,
+		t.NotBefore,
+		t.NotAfter,
+		t.KeyType,
+		t.KeySize,
+		t.ChainLength,
+		t.ChainVerified,
+		verificationErrorNullable,
+		t.HostnameMatch,
+		t.SelfSigned)
+
+	return row.Scan(&t.ID)
+}
+
+func prepareTLSInfoStatements(s *Store) error {
+	var err error
+	addTLSInfoStatement, err = s.DB.Prepare(`
+		INSERT INTO fhir_endpoints_tls_info (
+			metadata_id,
+			tls_version,
+			cipher_suite,
+			alpn_protocol,
+			leaf_subject,
+			leaf_sans,
+			leaf_issuer,
+			not_before,
+			not_after,
+			key_type,
+			key_size,
+			chain_length,
+			chain_verified,
+			verification_error,
+			hostname_match,
+			self_signed)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+		RETURNING id`)
+	if err != nil {
+		return err
+	}
+	getTLSInfoStatement, err = s.DB.Prepare(`
+		SELECT
+			id,
+			tls_version,
+			cipher_suite,
+			alpn_protocol,
+			leaf_subject,
+			leaf_sans,
+			leaf_issuer,
+			not_before,
+			not_after,
+			key_type,
+			key_size,
+			chain_length,
+			chain_verified,
+			verification_error,
+			hostname_match,
+			self_signed,
+			created_at
+		FROM fhir_endpoints_tls_info WHERE metadata_id = $1`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
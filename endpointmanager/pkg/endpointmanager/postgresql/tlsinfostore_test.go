@@ -0,0 +1,77 @@
+//go:build integration
+// +build integration
+
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+	th "github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/testhelper"
+)
+
+func Test_PersistTLSInfo(t *testing.T) {
+	SetupStore()
+	teardown, _ := th.IntegrationDBTestSetup(t, store.DB)
+	defer teardown(t, store.DB)
+
+	var err error
+	ctx := context.Background()
+
+	var tlsInfo = &endpointmanager.TLSInfo{
+		TLSVersion:        "TLS 1.2",
+		CipherSuite:       "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+		ALPNProtocol:      "h2",
+		LeafSubject:       "CN=example.com",
+		LeafSANs:          []string{"example.com", "www.example.com"},
+		LeafIssuer:        "CN=Example CA",
+		NotBefore:         time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:          time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC),
+		KeyType:           "RSA",
+		KeySize:           2048,
+		ChainLength:       2,
+		ChainVerified:     false,
+		VerificationError: "x509: certificate has expired or is not yet valid",
+		HostnameMatch:     true,
+		SelfSigned:        false}
+
+	var endpointMetadata1 = &endpointmanager.FHIREndpointMetadata{
+		URL:                  "example.com/FHIR/DSTU2/",
+		HTTPResponse:         200,
+		Availability:         1.0,
+		RequestedFhirVersion: "None",
+		TLSInfo:              tlsInfo}
+
+	var endpointMetadata2 = &endpointmanager.FHIREndpointMetadata{
+		URL:                  "http://other.example.com/FHIR/DSTU2/",
+		HTTPResponse:         200,
+		Availability:         1.0,
+		RequestedFhirVersion: "None"}
+
+	// the TLS info is saved along with the metadata
+	metadataID1, err := store.AddFHIREndpointMetadata(ctx, endpointMetadata1)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, tlsInfo.ID != 0, "expected the TLS info ID to be set")
+
+	metadataID2, err := store.AddFHIREndpointMetadata(ctx, endpointMetadata2)
+	th.Assert(t, err == nil, err)
+
+	t1, err := store.GetTLSInfoUsingMetadataID(ctx, metadataID1)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, t1.Equal(tlsInfo), "retrieved TLS info is not equal to saved TLS info.")
+
+	m1, err := store.GetFHIREndpointMetadata(ctx, metadataID1)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, m1.Equal(endpointMetadata1), "retrieved endpointMetadata is not equal to saved endpointMetadata.")
+
+	// metadata without TLS info
+	_, err = store.GetTLSInfoUsingMetadataID(ctx, metadataID2)
+	th.Assert(t, err == sql.ErrNoRows, "expected no TLS info for an endpoint that does not use TLS")
+
+	m2, err := store.GetFHIREndpointMetadata(ctx, metadataID2)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, m2.TLSInfo == nil, "expected the metadata TLS info to be nil")
+}
@@ -0,0 +1,158 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/lib/pq"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+)
+
+// prepared statements are left open to be used throughout the execution of the application
+var addUDAPInfoStatement *sql.Stmt
+var getUDAPInfoStatement *sql.Stmt
+
+// GetUDAPInfoUsingMetadataID gets the UDAPInfo recorded for the request with the given metadata id.
+// If there is no UDAPInfo for the metadata id, sql.ErrNoRows will be returned.
+func (s *Store) GetUDAPInfoUsingMetadataID(ctx context.Context, metadataID int) (*endpointmanager.UDAPInfo, error) {
+	var udapInfo endpointmanager.UDAPInfo
+	var errorNullable sql.NullString
+	var authorizationEndpointNullable sql.NullString
+	var tokenEndpointNullable sql.NullString
+	var registrationEndpointNullable sql.NullString
+	var signedMetadataJSON []byte
+
+	row := getUDAPInfoStatement.QueryRowContext(ctx, metadataID)
+
+	err := row.Scan(
+		&udapInfo.ID,
+		&udapInfo.URL,
+		&udapInfo.HTTPResponse,
+		&errorNullable,
+		pq.Array(&udapInfo.VersionsSupported),
+		pq.Array(&udapInfo.ProfilesSupported),
+		pq.Array(&udapInfo.AuthorizationExtensionsSupported),
+		pq.Array(&udapInfo.AuthorizationExtensionsRequired),
+		pq.Array(&udapInfo.CertificationsSupported),
+		pq.Array(&udapInfo.CertificationsRequired),
+		pq.Array(&udapInfo.GrantTypesSupported),
+		pq.Array(&udapInfo.ScopesSupported),
+		pq.Array(&udapInfo.TokenEndpointAuthMethodsSupported),
+		pq.Array(&udapInfo.TokenEndpointAuthSigningAlgs),
+		pq.Array(&udapInfo.RegistrationSigningAlgs),
+		&authorizationEndpointNullable,
+		&tokenEndpointNullable,
+		&registrationEndpointNullable,
+		&signedMetadataJSON,
+		&udapInfo.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	udapInfo.Error = errorNullable.String
+	udapInfo.AuthorizationEndpoint = authorizationEndpointNullable.String
+	udapInfo.TokenEndpoint = tokenEndpointNullable.String
+	udapInfo.RegistrationEndpoint = registrationEndpointNullable.String
+
+	if signedMetadataJSON != nil {
+		err = json.Unmarshal(signedMetadataJSON, &udapInfo.SignedMetadata)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &udapInfo, nil
+}
+
+// AddUDAPInfo adds the UDAPInfo to the database, linked to the request with the given metadata id.
+func (s *Store) AddUDAPInfo(ctx context.Context, u *endpointmanager.UDAPInfo, metadataID int) error {
+	var signedMetadataJSON []byte
+	var err error
+	if u.SignedMetadata != nil {
+		signedMetadataJSON, err = json.Marshal(u.SignedMetadata)
+		if err != nil {
+			return err
+		}
+	}
+
+	row := addUDAPInfoStatement.QueryRowContext(ctx,
+		metadataID,
+		u.URL,
+		u.HTTPResponse,
+		nullableString(u.Error),
+		pq.Array(u.VersionsSupported),
+		pq.Array(u.ProfilesSupported),
+		pq.Array(u.AuthorizationExtensionsSupported),
+		pq.Array(u.AuthorizationExtensionsRequired),
+		pq.Array(u.CertificationsSupported),
+		pq.Array(u.CertificationsRequired),
+		pq.Array(u.GrantTypesSupported),
+		pq.Array(u.ScopesSupported),
+		pq.Array(u.TokenEndpointAuthMethodsSupported),
+		pq.Array(u.TokenEndpointAuthSigningAlgs),
+		pq.Array(u.RegistrationSigningAlgs),
+		nullableString(u.AuthorizationEndpoint),
+		nullableString(u.TokenEndpoint),
+		nullableString(u.RegistrationEndpoint),
+		signedMetadataJSON)
+
+	return row.Scan(&u.ID)
+}
+
+func prepareUDAPInfoStatements(s *Store) error {
+	var err error
+	addUDAPInfoStatement, err = s.DB.Prepare(`
+		INSERT INTO fhir_endpoints_udap (
+			metadata_id,
+			url,
+			http_response,
+			error,
+			versions_supported,
+			profiles_supported,
+			authorization_extensions_supported,
+			authorization_extensions_required,
+			certifications_supported,
+			certifications_required,
+			grant_types_supported,
+			scopes_supported,
+			token_endpoint_auth_methods_supported,
+			token_endpoint_auth_signing_algs,
+			registration_signing_algs,
+			authorization_endpoint,
+			token_endpoint,
+			registration_endpoint,
+			signed_metadata)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)
+		RETURNING id`)
+	if err != nil {
+		return err
+	}
+	getUDAPInfoStatement, err = s.DB.Prepare(`
+		SELECT
+			id,
+			url,
+			http_response,
+			error,
+			versions_supported,
+			profiles_supported,
+			authorization_extensions_supported,
+			authorization_extensions_required,
+			certifications_supported,
+			certifications_required,
+			grant_types_supported,
+			scopes_supported,
+			token_endpoint_auth_methods_supported,
+			token_endpoint_auth_signing_algs,
+			registration_signing_algs,
+			authorization_endpoint,
+			token_endpoint,
+			registration_endpoint,
+			signed_metadata,
+			created_at
+		FROM fhir_endpoints_udap WHERE metadata_id = $1`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
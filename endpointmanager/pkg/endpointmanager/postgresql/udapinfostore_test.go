@@ -0,0 +1,112 @@
+//go:build integration
+// +build integration
+
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+	th "github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/testhelper"
+)
+
+func Test_PersistUDAPInfo(t *testing.T) {
+	SetupStore()
+	teardown, _ := th.IntegrationDBTestSetup(t, store.DB)
+	defer teardown(t, store.DB)
+
+	var err error
+	ctx := context.Background()
+	issuedAt := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	var udapInfo = &endpointmanager.UDAPInfo{
+		URL:                               "https://example.com/fhir/.well-known/udap",
+		HTTPResponse:                      200,
+		VersionsSupported:                 []string{"1"},
+		ProfilesSupported:                 []string{"udap_dcr", "udap_authn", "udap_authz"},
+		AuthorizationExtensionsSupported:  []string{"hl7-b2b"},
+		AuthorizationExtensionsRequired:   []string{},
+		CertificationsSupported:           []string{},
+		GrantTypesSupported:               []string{"authorization_code", "client_credentials"},
+		TokenEndpointAuthMethodsSupported: []string{"private_key_jwt"},
+		TokenEndpointAuthSigningAlgs:      []string{"RS256"},
+		RegistrationSigningAlgs:           []string{"RS256"},
+		AuthorizationEndpoint:             "https://example.com/authorize",
+		TokenEndpoint:                     "https://example.com/token",
+		RegistrationEndpoint:              "https://example.com/register",
+		SignedMetadata: &endpointmanager.UDAPSignedMetadata{
+			Algorithm:      "RS256",
+			Issuer:         "https://example.com/fhir",
+			Subject:        "https://example.com/fhir",
+			IssuedAt:       issuedAt,
+			ExpiresAt:      issuedAt.Add(time.Hour),
+			TokenEndpoint:  "https://example.com/token",
+			ChainLength:    2,
+			LeafSANURIs:    []string{"https://example.com/fhir"},
+			LeafNotAfter:   issuedAt.AddDate(1, 0, 0),
+			SignatureValid: true,
+		}}
+
+	var missingUDAPInfo = &endpointmanager.UDAPInfo{
+		URL:          "https://other.example.com/fhir/.well-known/udap",
+		HTTPResponse: 404,
+		Error:        "the UDAP metadata URL returned HTTP status 404"}
+
+	var endpointMetadata1 = &endpointmanager.FHIREndpointMetadata{
+		URL:                  "example.com/FHIR/DSTU2/",
+		HTTPResponse:         200,
+		Availability:         1.0,
+		RequestedFhirVersion: "None",
+		UDAPInfo:             udapInfo}
+
+	var endpointMetadata2 = &endpointmanager.FHIREndpointMetadata{
+		URL:                  "http://other.example.com/FHIR/DSTU2/",
+		HTTPResponse:         200,
+		Availability:         1.0,
+		RequestedFhirVersion: "None",
+		UDAPInfo:             missingUDAPInfo}
+
+	var endpointMetadata3 = &endpointmanager.FHIREndpointMetadata{
+		URL:                  "http://third.example.com/FHIR/DSTU2/",
+		HTTPResponse:         200,
+		Availability:         1.0,
+		RequestedFhirVersion: "None"}
+
+	// the UDAP info is saved along with the metadata
+	metadataID1, err := store.AddFHIREndpointMetadata(ctx, endpointMetadata1)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, udapInfo.ID != 0, "expected the UDAP info ID to be set")
+
+	metadataID2, err := store.AddFHIREndpointMetadata(ctx, endpointMetadata2)
+	th.Assert(t, err == nil, err)
+
+	metadataID3, err := store.AddFHIREndpointMetadata(ctx, endpointMetadata3)
+	th.Assert(t, err == nil, err)
+
+	u1, err := store.GetUDAPInfoUsingMetadataID(ctx, metadataID1)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, u1.Equal(udapInfo), "retrieved UDAP info is not equal to saved UDAP info.")
+	th.Assert(t, u1.CertificationsSupported != nil, "expected an empty list to be kept as an empty list")
+	th.Assert(t, u1.CertificationsRequired == nil, "expected a missing list to be kept as nil")
+
+	m1, err := store.GetFHIREndpointMetadata(ctx, metadataID1)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, m1.Equal(endpointMetadata1), "retrieved endpointMetadata is not equal to saved endpointMetadata.")
+
+	// metadata that is not published
+	u2, err := store.GetUDAPInfoUsingMetadataID(ctx, metadataID2)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, u2.Equal(missingUDAPInfo), "retrieved UDAP info is not equal to saved UDAP info.")
+	th.Assert(t, u2.SignedMetadata == nil, "expected no signed metadata")
+
+	// metadata without UDAP info
+	_, err = store.GetUDAPInfoUsingMetadataID(ctx, metadataID3)
+	th.Assert(t, err == sql.ErrNoRows, "expected no UDAP info for an endpoint that was not checked")
+
+	m3, err := store.GetFHIREndpointMetadata(ctx, metadataID3)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, m3.UDAPInfo == nil, "expected the metadata UDAP info to be nil")
+}
@@ -0,0 +1,24 @@
+package endpointmanager
+
+// QueryErrorCode is a stable code classifying why a request to a FHIR endpoint failed. The code is recorded
+// alongside the request's error message so that failures can be grouped without matching on the message.
+type QueryErrorCode string
+
+// The codes that a failed request can be classified as. A request that did not fail has no code.
+const (
+	DNSNotFoundCode       QueryErrorCode = "dns_not_found"
+	DNSFailureCode        QueryErrorCode = "dns_failure"
+	ConnectionRefusedCode QueryErrorCode = "connection_refused"
+	ConnectionResetCode   QueryErrorCode = "connection_reset"
+	TimeoutCode           QueryErrorCode = "timeout"
+	TLSHandshakeCode      QueryErrorCode = "tls_handshake_failure"
+	BadCertificateCode    QueryErrorCode = "bad_certificate"
+	HTTPStatusCode        QueryErrorCode = "http_error_status"
+	HTMLResponseCode      QueryErrorCode = "non_fhir_html"
+	JSONParseCode         QueryErrorCode = "json_parse_failure"
+	XMLParseCode          QueryErrorCode = "xml_parse_failure"
+	RedirectLoopCode      QueryErrorCode = "redirect_loop"
+	CircuitOpenCode       QueryErrorCode = "circuit_open"
+	SchedulerTimeoutCode  QueryErrorCode = "scheduler_timeout"
+	UnknownErrorCode      QueryErrorCode = "unknown"
+)
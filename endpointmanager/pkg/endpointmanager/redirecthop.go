@@ -0,0 +1,10 @@
+package endpointmanager
+
+// RedirectHop is a redirect response received while requesting a FHIR endpoint. The hops of a request are
+// recorded in the order they were received.
+type RedirectHop struct {
+	URL        string `json:"url"`        // the URL that responded with the redirect
+	Scheme     string `json:"scheme"`     // the scheme of URL, for example "https"
+	StatusCode int    `json:"statusCode"` // the redirect's HTTP status, for example 301
+	Location   string `json:"location"`   // the Location header of the redirect, as sent by the server
+}
@@ -0,0 +1,88 @@
+package endpointmanager
+
+import (
+	"time"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/helpers"
+)
+
+// TLSInfo represents the TLS handshake made with a FHIR endpoint and the certificate the endpoint presented
+// during that handshake.
+type TLSInfo struct {
+	ID                int       `json:"-"`
+	TLSVersion        string    `json:"tlsVersion"`
+	CipherSuite       string    `json:"cipherSuite"`
+	ALPNProtocol      string    `json:"alpnProtocol"` // the application protocol negotiated with ALPN. For example, "h2".
+	LeafSubject       string    `json:"leafSubject"`
+	LeafSANs          []string  `json:"leafSANs"` // the DNS names and IP addresses in the leaf certificate's subject alternative names.
+	LeafIssuer        string    `json:"leafIssuer"`
+	NotBefore         time.Time `json:"notBefore"`
+	NotAfter          time.Time `json:"notAfter"`
+	KeyType           string    `json:"keyType"` // the leaf certificate's public key algorithm. For example, "RSA".
+	KeySize           int       `json:"keySize"` // the leaf certificate's public key size in bits.
+	ChainLength       int       `json:"chainLength"`
+	ChainVerified     bool      `json:"chainVerified"` // whether the presented chain verified against the system roots.
+	VerificationError string    `json:"verificationError"`
+	HostnameMatch     bool      `json:"hostnameMatch"` // whether the leaf certificate is valid for the endpoint's host name.
+	SelfSigned        bool      `json:"selfSigned"`
+	CreatedAt         time.Time `json:"-"`
+}
+
+// Equal checks each field of the two TLSInfos except for the database ID and CreatedAt fields to see if they are equal.
+func (t *TLSInfo) Equal(t2 *TLSInfo) bool {
+	if t == nil && t2 == nil {
+		return true
+	} else if t == nil {
+		return false
+	} else if t2 == nil {
+		return false
+	}
+
+	if t.TLSVersion != t2.TLSVersion {
+		return false
+	}
+	if t.CipherSuite != t2.CipherSuite {
+		return false
+	}
+	if t.ALPNProtocol != t2.ALPNProtocol {
+		return false
+	}
+	if t.LeafSubject != t2.LeafSubject {
+		return false
+	}
+	if !helpers.StringArraysEqual(t.LeafSANs, t2.LeafSANs) {
+		return false
+	}
+	if t.LeafIssuer != t2.LeafIssuer {
+		return false
+	}
+	if !t.NotBefore.Equal(t2.NotBefore) {
+		return false
+	}
+	if !t.NotAfter.Equal(t2.NotAfter) {
+		return false
+	}
+	if t.KeyType != t2.KeyType {
+		return false
+	}
+	if t.KeySize != t2.KeySize {
+		return false
+	}
+	if t.ChainLength != t2.ChainLength {
+		return false
+	}
+	if t.ChainVerified != t2.ChainVerified {
+		return false
+	}
+	if t.VerificationError != t2.VerificationError {
+		return false
+	}
+	if t.HostnameMatch != t2.HostnameMatch {
+		return false
+	}
+	if t.SelfSigned != t2.SelfSigned {
+		return false
+	}
+
+	return true
+}
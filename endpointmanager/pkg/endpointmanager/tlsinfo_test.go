@@ -0,0 +1,95 @@
+package endpointmanager
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_TLSInfoEqual(t *testing.T) {
+	notBefore := time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)
+	notAfter := time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	var t1 = &TLSInfo{
+		ID:            1,
+		TLSVersion:    "TLS 1.2",
+		CipherSuite:   "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+		ALPNProtocol:  "h2",
+		LeafSubject:   "CN=example.com",
+		LeafSANs:      []string{"example.com", "www.example.com"},
+		LeafIssuer:    "CN=Example CA",
+		NotBefore:     notBefore,
+		NotAfter:      notAfter,
+		KeyType:       "RSA",
+		KeySize:       2048,
+		ChainLength:   2,
+		ChainVerified: true,
+		HostnameMatch: true,
+		SelfSigned:    false}
+
+	var t2 = &TLSInfo{
+		ID:            2,
+		TLSVersion:    "TLS 1.2",
+		CipherSuite:   "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+		ALPNProtocol:  "h2",
+		LeafSubject:   "CN=example.com",
+		LeafSANs:      []string{"www.example.com", "example.com"},
+		LeafIssuer:    "CN=Example CA",
+		NotBefore:     notBefore,
+		NotAfter:      notAfter,
+		KeyType:       "RSA",
+		KeySize:       2048,
+		ChainLength:   2,
+		ChainVerified: true,
+		HostnameMatch: true,
+		SelfSigned:    false}
+
+	if !t1.Equal(t2) {
+		t.Errorf("Expected TLS info 1 to equal TLS info 2. They are not equal.")
+	}
+
+	t2.CipherSuite = "other"
+	if t1.Equal(t2) {
+		t.Errorf("Did not expect TLS info 1 to equal TLS info 2. CipherSuite should be different. %s vs %s", t1.CipherSuite, t2.CipherSuite)
+	}
+	t2.CipherSuite = t1.CipherSuite
+
+	t2.LeafSANs = []string{"example.com"}
+	if t1.Equal(t2) {
+		t.Errorf("Did not expect TLS info 1 to equal TLS info 2. LeafSANs should be different. %v vs %v", t1.LeafSANs, t2.LeafSANs)
+	}
+	t2.LeafSANs = t1.LeafSANs
+
+	t2.NotAfter = notAfter.Add(time.Hour)
+	if t1.Equal(t2) {
+		t.Errorf("Did not expect TLS info 1 to equal TLS info 2. NotAfter should be different. %s vs %s", t1.NotAfter, t2.NotAfter)
+	}
+	t2.NotAfter = t1.NotAfter
+
+	t2.KeySize = 1024
+	if t1.Equal(t2) {
+		t.Errorf("Did not expect TLS info 1 to equal TLS info 2. KeySize should be different. %d vs %d", t1.KeySize, t2.KeySize)
+	}
+	t2.KeySize = t1.KeySize
+
+	t2.ChainVerified = false
+	if t1.Equal(t2) {
+		t.Errorf("Did not expect TLS info 1 to equal TLS info 2. ChainVerified should be different. %t vs %t", t1.ChainVerified, t2.ChainVerified)
+	}
+	t2.ChainVerified = t1.ChainVerified
+
+	t2.SelfSigned = true
+	if t1.Equal(t2) {
+		t.Errorf("Did not expect TLS info 1 to equal TLS info 2. SelfSigned should be different. %t vs %t", t1.SelfSigned, t2.SelfSigned)
+	}
+	t2.SelfSigned = t1.SelfSigned
+
+	// test nil
+	t2 = nil
+	if t1.Equal(t2) {
+		t.Errorf("Did not expect TLS info 1 to equal nil TLS info 2.")
+	}
+	t1 = nil
+	if !t1.Equal(t2) {
+		t.Errorf("Expected nil TLS info 1 to equal nil TLS info 2.")
+	}
+}
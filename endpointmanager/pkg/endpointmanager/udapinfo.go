@@ -0,0 +1,123 @@
+package endpointmanager
+
+import (
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/helpers"
+)
+
+// UDAPInfo represents the request for the UDAP metadata published at /.well-known/udap under a FHIR endpoint's
+// base URL, and the profiles, grant types and endpoints that it advertises. The lists are nil when the metadata
+// does not include the field, and empty when it includes the field without any values.
+type UDAPInfo struct {
+	ID                                int                 `json:"-"`
+	URL                               string              `json:"url"`
+	HTTPResponse                      int                 `json:"httpResponse"`
+	Error                             string              `json:"error"` // why the metadata could not be retrieved or parsed. Empty if it was.
+	VersionsSupported                 []string            `json:"versionsSupported"`
+	ProfilesSupported                 []string            `json:"profilesSupported"`
+	AuthorizationExtensionsSupported  []string            `json:"authorizationExtensionsSupported"`
+	AuthorizationExtensionsRequired   []string            `json:"authorizationExtensionsRequired"`
+	CertificationsSupported           []string            `json:"certificationsSupported"`
+	CertificationsRequired            []string            `json:"certificationsRequired"`
+	GrantTypesSupported               []string            `json:"grantTypesSupported"`
+	ScopesSupported                   []string            `json:"scopesSupported"`
+	TokenEndpointAuthMethodsSupported []string            `json:"tokenEndpointAuthMethodsSupported"`
+	TokenEndpointAuthSigningAlgs      []string            `json:"tokenEndpointAuthSigningAlgs"`
+	RegistrationSigningAlgs           []string            `json:"registrationSigningAlgs"`
+	AuthorizationEndpoint             string              `json:"authorizationEndpoint"`
+	TokenEndpoint                     string              `json:"tokenEndpoint"`
+	RegistrationEndpoint              string              `json:"registrationEndpoint"`
+	SignedMetadata                    *UDAPSignedMetadata `json:"signedMetadata"` // nil if the metadata does not include signed_metadata.
+	CreatedAt                         time.Time           `json:"-"`
+}
+
+// UDAPSignedMetadata is the header and claims of the signed_metadata JWT in a UDAP metadata document, and the
+// certificate that signed it. The certificate chain is not checked against a trust anchor; SignatureValid only
+// records whether the JWT was signed by the key of the first certificate in its x5c chain.
+type UDAPSignedMetadata struct {
+	Algorithm             string    `json:"alg"`
+	Issuer                string    `json:"iss"`
+	Subject               string    `json:"sub"`
+	IssuedAt              time.Time `json:"iat"`
+	ExpiresAt             time.Time `json:"exp"`
+	AuthorizationEndpoint string    `json:"authorizationEndpoint"`
+	TokenEndpoint         string    `json:"tokenEndpoint"`
+	RegistrationEndpoint  string    `json:"registrationEndpoint"`
+	ChainLength           int       `json:"chainLength"` // the number of certificates in the x5c header.
+	LeafSubject           string    `json:"leafSubject"`
+	LeafIssuer            string    `json:"leafIssuer"`
+	LeafSANURIs           []string  `json:"leafSANURIs"` // the URIs in the signing certificate's subject alternative names.
+	LeafNotAfter          time.Time `json:"leafNotAfter"`
+	SignatureValid        bool      `json:"signatureValid"`
+	Error                 string    `json:"error"` // why the JWT could not be parsed or verified. Empty if it was.
+}
+
+// Equal checks each field of the two UDAPInfos except for the database ID and CreatedAt fields to see if they are equal.
+func (u *UDAPInfo) Equal(u2 *UDAPInfo) bool {
+	if u == nil && u2 == nil {
+		return true
+	} else if u == nil {
+		return false
+	} else if u2 == nil {
+		return false
+	}
+
+	if u.URL != u2.URL {
+		return false
+	}
+	if u.HTTPResponse != u2.HTTPResponse {
+		return false
+	}
+	if u.Error != u2.Error {
+		return false
+	}
+	if !helpers.StringArraysEqual(u.VersionsSupported, u2.VersionsSupported) {
+		return false
+	}
+	if !helpers.StringArraysEqual(u.ProfilesSupported, u2.ProfilesSupported) {
+		return false
+	}
+	if !helpers.StringArraysEqual(u.AuthorizationExtensionsSupported, u2.AuthorizationExtensionsSupported) {
+		return false
+	}
+	if !helpers.StringArraysEqual(u.AuthorizationExtensionsRequired, u2.AuthorizationExtensionsRequired) {
+		return false
+	}
+	if !helpers.StringArraysEqual(u.CertificationsSupported, u2.CertificationsSupported) {
+		return false
+	}
+	if !helpers.StringArraysEqual(u.CertificationsRequired, u2.CertificationsRequired) {
+		return false
+	}
+	if !helpers.StringArraysEqual(u.GrantTypesSupported, u2.GrantTypesSupported) {
+		return false
+	}
+	if !helpers.StringArraysEqual(u.ScopesSupported, u2.ScopesSupported) {
+		return false
+	}
+	if !helpers.StringArraysEqual(u.TokenEndpointAuthMethodsSupported, u2.TokenEndpointAuthMethodsSupported) {
+		return false
+	}
+	if !helpers.StringArraysEqual(u.TokenEndpointAuthSigningAlgs, u2.TokenEndpointAuthSigningAlgs) {
+		return false
+	}
+	if !helpers.StringArraysEqual(u.RegistrationSigningAlgs, u2.RegistrationSigningAlgs) {
+		return false
+	}
+	if u.AuthorizationEndpoint != u2.AuthorizationEndpoint {
+		return false
+	}
+	if u.TokenEndpoint != u2.TokenEndpoint {
+		return false
+	}
+	if u.RegistrationEndpoint != u2.RegistrationEndpoint {
+		return false
+	}
+	if !cmp.Equal(u.SignedMetadata, u2.SignedMetadata) {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,96 @@
+package endpointmanager
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_UDAPInfoEqual(t *testing.T) {
+	issuedAt := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	var u1 = &UDAPInfo{
+		ID:                    1,
+		URL:                   "https://example.com/fhir/.well-known/udap",
+		HTTPResponse:          200,
+		VersionsSupported:     []string{"1"},
+		ProfilesSupported:     []string{"udap_dcr", "udap_authn", "udap_authz"},
+		GrantTypesSupported:   []string{"authorization_code", "client_credentials"},
+		TokenEndpoint:         "https://example.com/token",
+		RegistrationEndpoint:  "https://example.com/register",
+		AuthorizationEndpoint: "https://example.com/authorize",
+		SignedMetadata: &UDAPSignedMetadata{
+			Algorithm:      "RS256",
+			Issuer:         "https://example.com/fhir",
+			Subject:        "https://example.com/fhir",
+			IssuedAt:       issuedAt,
+			ExpiresAt:      issuedAt.Add(time.Hour),
+			ChainLength:    2,
+			LeafSANURIs:    []string{"https://example.com/fhir"},
+			SignatureValid: true,
+		}}
+
+	var u2 = &UDAPInfo{
+		ID:                    2,
+		URL:                   "https://example.com/fhir/.well-known/udap",
+		HTTPResponse:          200,
+		VersionsSupported:     []string{"1"},
+		ProfilesSupported:     []string{"udap_authz", "udap_dcr", "udap_authn"},
+		GrantTypesSupported:   []string{"authorization_code", "client_credentials"},
+		TokenEndpoint:         "https://example.com/token",
+		RegistrationEndpoint:  "https://example.com/register",
+		AuthorizationEndpoint: "https://example.com/authorize",
+		SignedMetadata: &UDAPSignedMetadata{
+			Algorithm:      "RS256",
+			Issuer:         "https://example.com/fhir",
+			Subject:        "https://example.com/fhir",
+			IssuedAt:       issuedAt.In(time.Local),
+			ExpiresAt:      issuedAt.Add(time.Hour),
+			ChainLength:    2,
+			LeafSANURIs:    []string{"https://example.com/fhir"},
+			SignatureValid: true,
+		}}
+
+	if !u1.Equal(u2) {
+		t.Errorf("Expected UDAP info 1 to equal UDAP info 2. They are not equal.")
+	}
+
+	u2.ProfilesSupported = []string{"udap_dcr"}
+	if u1.Equal(u2) {
+		t.Errorf("Did not expect UDAP info 1 to equal UDAP info 2. ProfilesSupported should be different. %v vs %v", u1.ProfilesSupported, u2.ProfilesSupported)
+	}
+	u2.ProfilesSupported = u1.ProfilesSupported
+
+	u2.GrantTypesSupported = []string{"client_credentials"}
+	if u1.Equal(u2) {
+		t.Errorf("Did not expect UDAP info 1 to equal UDAP info 2. GrantTypesSupported should be different. %v vs %v", u1.GrantTypesSupported, u2.GrantTypesSupported)
+	}
+	u2.GrantTypesSupported = u1.GrantTypesSupported
+
+	u2.TokenEndpoint = "https://other.example.com/token"
+	if u1.Equal(u2) {
+		t.Errorf("Did not expect UDAP info 1 to equal UDAP info 2. TokenEndpoint should be different. %s vs %s", u1.TokenEndpoint, u2.TokenEndpoint)
+	}
+	u2.TokenEndpoint = u1.TokenEndpoint
+
+	signedMetadata := *u1.SignedMetadata
+	signedMetadata.SignatureValid = false
+	u2.SignedMetadata = &signedMetadata
+	if u1.Equal(u2) {
+		t.Errorf("Did not expect UDAP info 1 to equal UDAP info 2. SignedMetadata should be different. %+v vs %+v", u1.SignedMetadata, u2.SignedMetadata)
+	}
+	u2.SignedMetadata = nil
+	if u1.Equal(u2) {
+		t.Errorf("Did not expect UDAP info 1 to equal UDAP info 2 without signed metadata.")
+	}
+	u2.SignedMetadata = u1.SignedMetadata
+
+	// test nil
+	u2 = nil
+	if u1.Equal(u2) {
+		t.Errorf("Did not expect UDAP info 1 to equal nil UDAP info 2.")
+	}
+	u1 = nil
+	if !u1.Equal(u2) {
+		t.Errorf("Expected nil UDAP info 1 to equal nil UDAP info 2.")
+	}
+}
@@ -0,0 +1,336 @@
+package fhirxml
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// The FHIR XML and JSON mapping rules are described at https://www.hl7.org/fhir/json.html and
+// https://www.hl7.org/fhir/xml.html. The XML representation does not carry the cardinality or the
+// primitive type of an element, so the lists below record that information for the elements that
+// appear in conformance and capability statements across DSTU2, STU3 and R4.
+
+// repeatingElements are elements that are always represented as JSON arrays regardless of how many
+// times they appear in the XML document
+var repeatingElements = map[string]bool{
+	"extension":           true,
+	"modifierExtension":   true,
+	"contained":           true,
+	"contact":             true,
+	"telecom":             true,
+	"useContext":          true,
+	"jurisdiction":        true,
+	"instantiates":        true,
+	"imports":             true,
+	"format":              true,
+	"patchFormat":         true,
+	"implementationGuide": true,
+	"rest":                true,
+	"interaction":         true,
+	"searchParam":         true,
+	"operation":           true,
+	"compartment":         true,
+	"messaging":           true,
+	"document":            true,
+	"endpoint":            true,
+	"supportedMessage":    true,
+	"event":               true,
+	"supportedProfile":    true,
+	"referencePolicy":     true,
+	"searchInclude":       true,
+	"searchRevInclude":    true,
+	"service":             true,
+	"certificate":         true,
+	"coding":              true,
+	"chain":               true,
+	"target":              true,
+	"modifier":            true,
+	"given":               true,
+	"prefix":              true,
+	"suffix":              true,
+	"line":                true,
+}
+
+// repeatingChildren are elements whose cardinality depends on their parent element, keyed by
+// "parent.child". The DSTU2 Conformance and STU3 CapabilityStatement resources have a list of
+// profiles at the root while rest.resource.profile is a single reference, and
+// Bundle.entry.resource is a single resource. DSTU2 also lists the transaction interactions and
+// document mailboxes of each rest entry.
+var repeatingChildren = map[string]bool{
+	"Conformance.profile":         true,
+	"CapabilityStatement.profile": true,
+	"rest.resource":               true,
+	"rest.transaction":            true,
+	"rest.documentMailbox":        true,
+}
+
+var booleanElements = map[string]bool{
+	"experimental":      true,
+	"lockedDate":        true,
+	"readHistory":       true,
+	"updateCreate":      true,
+	"conditionalCreate": true,
+	"conditionalUpdate": true,
+	"cors":              true,
+	"valueBoolean":      true,
+}
+
+var integerElements = map[string]bool{
+	"reliableCache":    true,
+	"valueInteger":     true,
+	"valueUnsignedInt": true,
+	"valuePositiveInt": true,
+	"valueInteger64":   true,
+}
+
+var decimalElements = map[string]bool{
+	"valueDecimal": true,
+}
+
+// element is a node of the parsed XML document
+type element struct {
+	name     string
+	attrs    map[string]string
+	children []*element
+	// raw holds the unparsed XHTML for narrative div elements
+	raw string
+}
+
+// IsXML returns true if the given response body looks like an XML document rather than JSON.
+func IsXML(body []byte) bool {
+	trimmed := bytes.TrimLeftFunc(body, unicode.IsSpace)
+	return len(trimmed) > 0 && trimmed[0] == '<'
+}
+
+// ToInterface converts a FHIR resource in the XML format into the map[string]interface{} that would
+// be produced by unmarshalling the same resource in the JSON format.
+func ToInterface(xmlBytes []byte) (map[string]interface{}, error) {
+	var resource map[string]interface{}
+
+	jsonBytes, err := ToJSON(xmlBytes)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(jsonBytes, &resource)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to unmarshal converted FHIR JSON")
+	}
+	return resource, nil
+}
+
+// ToJSON converts a FHIR resource in the XML format into the FHIR JSON format.
+func ToJSON(xmlBytes []byte) ([]byte, error) {
+	root, err := parse(xmlBytes)
+	if err != nil {
+		return nil, err
+	}
+	if root == nil {
+		return nil, errors.New("XML document does not contain a FHIR resource")
+	}
+	return json.Marshal(convertResource(root))
+}
+
+func parse(xmlBytes []byte) (*element, error) {
+	var root *element
+	var stack []*element
+
+	decoder := xml.NewDecoder(bytes.NewReader(xmlBytes))
+	for {
+		offset := decoder.InputOffset()
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to parse FHIR XML document")
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			elem := &element{
+				name:  t.Name.Local,
+				attrs: make(map[string]string),
+			}
+			for _, attr := range t.Attr {
+				if attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns" {
+					continue
+				}
+				elem.attrs[attr.Name.Local] = attr.Value
+			}
+
+			if len(stack) == 0 {
+				if root != nil {
+					return nil, errors.New("FHIR XML document has more than one root element")
+				}
+				root = elem
+			} else {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, elem)
+			}
+
+			// Narrative is kept as the original XHTML string
+			if elem.name == "div" {
+				err = decoder.Skip()
+				if err != nil {
+					return nil, errors.Wrap(err, "unable to parse FHIR XML narrative")
+				}
+				elem.raw = string(xmlBytes[offset:decoder.InputOffset()])
+				continue
+			}
+			stack = append(stack, elem)
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+
+	return root, nil
+}
+
+// convertResource converts a resource element, adding the resourceType property that JSON uses
+// in place of the XML root element name
+func convertResource(elem *element) map[string]interface{} {
+	obj := convertObject(elem)
+	obj["resourceType"] = elem.name
+	return obj
+}
+
+func convertObject(elem *element) map[string]interface{} {
+	obj := make(map[string]interface{})
+
+	if id, ok := elem.attrs["id"]; ok {
+		obj["id"] = id
+	}
+	if url, ok := elem.attrs["url"]; ok {
+		obj["url"] = url
+	}
+
+	// group the children by name while keeping the document order of the names
+	var names []string
+	grouped := make(map[string][]*element)
+	for _, child := range elem.children {
+		if _, ok := grouped[child.name]; !ok {
+			names = append(names, child.name)
+		}
+		grouped[child.name] = append(grouped[child.name], child)
+	}
+
+	for _, name := range names {
+		children := grouped[name]
+		asArray := len(children) > 1 || repeatingElements[name] || repeatingChildren[elem.name+"."+name]
+
+		var values []interface{}
+		var primitiveExts []interface{}
+		hasPrimitiveExt := false
+		for _, child := range children {
+			value, primitiveExt := convertElement(child)
+			values = append(values, value)
+			if primitiveExt != nil {
+				hasPrimitiveExt = true
+				primitiveExts = append(primitiveExts, primitiveExt)
+			} else {
+				primitiveExts = append(primitiveExts, nil)
+			}
+		}
+
+		if asArray {
+			obj[name] = values
+			if hasPrimitiveExt {
+				obj["_"+name] = primitiveExts
+			}
+		} else {
+			if values[0] != nil {
+				obj[name] = values[0]
+			}
+			if hasPrimitiveExt {
+				obj["_"+name] = primitiveExts[0]
+			}
+		}
+	}
+
+	return obj
+}
+
+// convertElement returns the JSON value for the element along with the JSON object holding the
+// id and extensions of a primitive element, if there are any
+func convertElement(elem *element) (interface{}, map[string]interface{}) {
+	if elem.name == "div" {
+		return elem.raw, nil
+	}
+
+	if value, ok := elem.attrs["value"]; ok {
+		var primitiveExt map[string]interface{}
+		if len(elem.children) > 0 || elem.attrs["id"] != "" {
+			primitiveExt = convertObject(&element{name: elem.name, attrs: idOnly(elem.attrs), children: elem.children})
+		}
+		return primitiveValue(elem.name, value), primitiveExt
+	}
+
+	// contained resources and bundle entry resources wrap a single resource element
+	if len(elem.children) == 1 && len(elem.attrs) == 0 && isResourceName(elem.children[0].name) {
+		return convertResource(elem.children[0]), nil
+	}
+
+	// a primitive with only extensions and no value
+	if isPrimitiveWithoutValue(elem) {
+		return nil, convertObject(elem)
+	}
+
+	return convertObject(elem), nil
+}
+
+func idOnly(attrs map[string]string) map[string]string {
+	result := make(map[string]string)
+	if id, ok := attrs["id"]; ok {
+		result["id"] = id
+	}
+	return result
+}
+
+func isResourceName(name string) bool {
+	return len(name) > 0 && unicode.IsUpper(rune(name[0]))
+}
+
+func isPrimitiveWithoutValue(elem *element) bool {
+	if len(elem.children) == 0 {
+		return false
+	}
+	if _, ok := elem.attrs["url"]; ok {
+		return false
+	}
+	for _, child := range elem.children {
+		if child.name != "extension" {
+			return false
+		}
+	}
+	return booleanElements[elem.name] || integerElements[elem.name] || decimalElements[elem.name]
+}
+
+func primitiveValue(name string, value string) interface{} {
+	trimmed := strings.TrimSpace(value)
+	if booleanElements[name] {
+		if b, err := strconv.ParseBool(trimmed); err == nil {
+			return b
+		}
+	}
+	if integerElements[name] {
+		if i, err := strconv.ParseInt(trimmed, 10, 64); err == nil {
+			return i
+		}
+	}
+	if decimalElements[name] {
+		// keep the precision of the original decimal
+		if _, err := strconv.ParseFloat(trimmed, 64); err == nil {
+			return json.Number(trimmed)
+		}
+	}
+	return value
+}
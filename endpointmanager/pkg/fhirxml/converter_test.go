@@ -0,0 +1,117 @@
+package fhirxml
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/capabilityparser"
+	th "github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/testhelper"
+)
+
+func Test_IsXML(t *testing.T) {
+	th.Assert(t, IsXML([]byte("<?xml version=\"1.0\"?><CapabilityStatement/>")), "expected XML declaration to be detected as XML")
+	th.Assert(t, IsXML([]byte("\n  <CapabilityStatement/>")), "expected leading whitespace to be ignored")
+	th.Assert(t, !IsXML([]byte("{\"resourceType\": \"CapabilityStatement\"}")), "did not expect JSON to be detected as XML")
+	th.Assert(t, !IsXML([]byte("")), "did not expect empty body to be detected as XML")
+}
+
+func Test_ToInterface(t *testing.T) {
+	path := filepath.Join("../testdata", "hapi_capability_r4.xml")
+	xmlBytes, err := os.ReadFile(path)
+	th.Assert(t, err == nil, err)
+
+	capInt, err := ToInterface(xmlBytes)
+	th.Assert(t, err == nil, err)
+
+	th.Assert(t, capInt["resourceType"] == "CapabilityStatement", fmt.Sprintf("expected resourceType CapabilityStatement, got %v", capInt["resourceType"]))
+	th.Assert(t, capInt["id"] == "example", fmt.Sprintf("expected id example, got %v", capInt["id"]))
+	th.Assert(t, capInt["fhirVersion"] == "4.0.1", fmt.Sprintf("expected fhirVersion 4.0.1, got %v", capInt["fhirVersion"]))
+	th.Assert(t, capInt["experimental"] == false, fmt.Sprintf("expected experimental to be the boolean false, got %v", capInt["experimental"]))
+
+	// format repeats in the document and must be an array
+	formats, ok := capInt["format"].([]interface{})
+	th.Assert(t, ok, "expected format to be an array")
+	th.Assert(t, len(formats) == 2, fmt.Sprintf("expected 2 formats, got %d", len(formats)))
+
+	// rest appears once but is always an array
+	rest, ok := capInt["rest"].([]interface{})
+	th.Assert(t, ok, "expected rest to be an array")
+	th.Assert(t, len(rest) == 1, fmt.Sprintf("expected 1 rest entry, got %d", len(rest)))
+
+	restMap := rest[0].(map[string]interface{})
+	security := restMap["security"].(map[string]interface{})
+	th.Assert(t, security["cors"] == true, fmt.Sprintf("expected cors to be the boolean true, got %v", security["cors"]))
+	extensions := security["extension"].([]interface{})
+	oauth := extensions[0].(map[string]interface{})
+	th.Assert(t, oauth["url"] == "http://fhir-registry.smarthealthit.org/StructureDefinition/oauth-uris", "expected extension url attribute to be converted")
+	nested := oauth["extension"].([]interface{})
+	th.Assert(t, len(nested) == 2, fmt.Sprintf("expected 2 nested extensions, got %d", len(nested)))
+	token := nested[0].(map[string]interface{})
+	th.Assert(t, token["valueUri"] == "https://example.com/oauth/token", fmt.Sprintf("unexpected token uri %v", token["valueUri"]))
+
+	// rest.resource.profile is a single value in R4
+	resources := restMap["resource"].([]interface{})
+	resource := resources[0].(map[string]interface{})
+	_, isArray := resource["profile"].([]interface{})
+	th.Assert(t, !isArray, "expected rest.resource.profile to be a single value")
+	interactions := resource["interaction"].([]interface{})
+	th.Assert(t, len(interactions) == 2, fmt.Sprintf("expected 2 interactions, got %d", len(interactions)))
+
+	// primitive extensions are moved to the underscore property
+	statusExt, ok := capInt["_status"].(map[string]interface{})
+	th.Assert(t, ok, "expected status extension to be converted to _status")
+	th.Assert(t, capInt["status"] == "active", fmt.Sprintf("expected status active, got %v", capInt["status"]))
+	th.Assert(t, len(statusExt["extension"].([]interface{})) == 1, "expected one extension on status")
+
+	// narrative is kept as XHTML
+	text := capInt["text"].(map[string]interface{})
+	th.Assert(t, text["div"] == "<div xmlns=\"http://www.w3.org/1999/xhtml\"><p>Example server</p></div>", fmt.Sprintf("unexpected narrative %v", text["div"]))
+
+	// the converted statement can be used by the capability parser
+	cs, err := capabilityparser.NewCapabilityStatementFromInterface(capInt)
+	th.Assert(t, err == nil, err)
+	kind, err := cs.GetKind()
+	th.Assert(t, err == nil, err)
+	th.Assert(t, kind == "instance", fmt.Sprintf("expected kind instance, got %s", kind))
+	software, err := cs.GetSoftwareName()
+	th.Assert(t, err == nil, err)
+	th.Assert(t, software == "Example FHIR Server", fmt.Sprintf("unexpected software name %s", software))
+
+	// contained resources are wrapped in a contained element
+	capInt, err = ToInterface([]byte(`<Conformance xmlns="http://hl7.org/fhir"><contained><Organization><id value="org1"/></Organization></contained><profile><reference value="a"/></profile><fhirVersion value="1.0.2"/></Conformance>`))
+	th.Assert(t, err == nil, err)
+	contained := capInt["contained"].([]interface{})
+	org := contained[0].(map[string]interface{})
+	th.Assert(t, org["resourceType"] == "Organization", fmt.Sprintf("expected contained Organization, got %v", org["resourceType"]))
+	_, isArray = capInt["profile"].([]interface{})
+	th.Assert(t, isArray, "expected DSTU2 Conformance.profile to be an array")
+
+	// the STU3 CapabilityStatement also has a list of profiles at the root
+	capInt, err = ToInterface([]byte(`<CapabilityStatement xmlns="http://hl7.org/fhir"><fhirVersion value="3.0.2"/><profile><reference value="StructureDefinition/a"/></profile></CapabilityStatement>`))
+	th.Assert(t, err == nil, err)
+	profiles, ok := capInt["profile"].([]interface{})
+	th.Assert(t, ok, fmt.Sprintf("expected STU3 CapabilityStatement.profile to be an array, got %v", capInt["profile"]))
+	th.Assert(t, len(profiles) == 1, fmt.Sprintf("expected 1 profile, got %d", len(profiles)))
+	profile := profiles[0].(map[string]interface{})
+	th.Assert(t, profile["reference"] == "StructureDefinition/a", fmt.Sprintf("unexpected profile %v", profile))
+
+	// DSTU2 rest.transaction and rest.documentMailbox are arrays even when they appear once
+	capInt, err = ToInterface([]byte(`<Conformance xmlns="http://hl7.org/fhir"><fhirVersion value="1.0.2"/><rest><mode value="server"/><transaction><code value="transaction"/></transaction><documentMailbox value="http://example.com/mailbox"/></rest></Conformance>`))
+	th.Assert(t, err == nil, err)
+	restMap = capInt["rest"].([]interface{})[0].(map[string]interface{})
+	transactions, ok := restMap["transaction"].([]interface{})
+	th.Assert(t, ok, fmt.Sprintf("expected DSTU2 rest.transaction to be an array, got %v", restMap["transaction"]))
+	th.Assert(t, len(transactions) == 1, fmt.Sprintf("expected 1 transaction, got %d", len(transactions)))
+	mailboxes, ok := restMap["documentMailbox"].([]interface{})
+	th.Assert(t, ok, fmt.Sprintf("expected DSTU2 rest.documentMailbox to be an array, got %v", restMap["documentMailbox"]))
+	th.Assert(t, mailboxes[0] == "http://example.com/mailbox", fmt.Sprintf("unexpected document mailbox %v", mailboxes[0]))
+
+	// invalid XML
+	_, err = ToInterface([]byte("<CapabilityStatement><fhirVersion value=\"4.0.1\"></CapabilityStatement>"))
+	th.Assert(t, err != nil, "expected an error for malformed XML")
+
+	_, err = ToInterface([]byte(""))
+	th.Assert(t, err != nil, "expected an error for an empty document")
+}
@@ -0,0 +1,26 @@
+package historypruning
+
+import (
+	"context"
+	"time"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager/postgresql"
+	log "github.com/sirupsen/logrus"
+)
+
+// PruneDataExposureChecks deletes the unauthenticated searches for patient data that were made more than
+// retentionDays days ago. The searches are kept for their own retention period rather than with the info history
+// because they identify endpoints that expose patient data. A retentionDays of 0 or less keeps all of them.
+func PruneDataExposureChecks(ctx context.Context, store *postgresql.Store, retentionDays int) error {
+	if retentionDays <= 0 {
+		return nil
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -retentionDays)
+	numPruned, err := store.PruneDataExposureChecks(ctx, cutoff)
+	if err != nil {
+		return err
+	}
+	log.Infof("Pruned %d data exposure searches made before %s", numPruned, cutoff.Format(time.RFC3339))
+	return nil
+}
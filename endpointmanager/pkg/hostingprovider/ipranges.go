@@ -0,0 +1,172 @@
+package hostingprovider
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Range is a block of IP addresses that a hosting provider publishes as belonging to one of its regions or services
+type Range struct {
+	Prefix   *net.IPNet
+	Provider string
+	Region   string
+	Service  string
+}
+
+// Ranges is the set of published IP ranges that addresses are attributed to hosting providers with
+type Ranges struct {
+	// sorted from the longest prefix to the shortest so that the most specific range is found first
+	ranges []Range
+}
+
+// rangesFile is the union of the fields of the AWS ip-ranges.json, Azure ServiceTags and GCP cloud.json files.
+// Each provider uses a different set of fields, which is how the format of a file is told apart.
+type rangesFile struct {
+	Prefixes []struct {
+		IPPrefix   string `json:"ip_prefix"`
+		IPv4Prefix string `json:"ipv4Prefix"`
+		IPv6Prefix string `json:"ipv6Prefix"`
+		Region     string `json:"region"`
+		Service    string `json:"service"`
+		Scope      string `json:"scope"`
+	} `json:"prefixes"`
+	IPv6Prefixes []struct {
+		IPv6Prefix string `json:"ipv6_prefix"`
+		Region     string `json:"region"`
+		Service    string `json:"service"`
+	} `json:"ipv6_prefixes"`
+	Values []struct {
+		Name       string `json:"name"`
+		Properties struct {
+			Region          string   `json:"region"`
+			SystemService   string   `json:"systemService"`
+			AddressPrefixes []string `json:"addressPrefixes"`
+		} `json:"properties"`
+	} `json:"values"`
+}
+
+const (
+	AWS   = "AWS"
+	Azure = "Azure"
+	GCP   = "GCP"
+)
+
+// ParseRanges returns the IP ranges in a file published by AWS, Azure or GCP. The provider is recognized from the
+// fields the file uses. An error is returned if the file is not in one of these formats or has an invalid prefix.
+func ParseRanges(rangesJSON []byte) ([]Range, error) {
+	var file rangesFile
+	err := json.Unmarshal(rangesJSON, &file)
+	if err != nil {
+		return nil, errors.Wrap(err, "error unmarshalling IP ranges file")
+	}
+
+	var ranges []Range
+	addRange := func(prefix string, provider string, region string, service string) error {
+		_, ipNet, err := net.ParseCIDR(prefix)
+		if err != nil {
+			return errors.Wrapf(err, "invalid %s IP range", provider)
+		}
+		ranges = append(ranges, Range{Prefix: ipNet, Provider: provider, Region: region, Service: service})
+		return nil
+	}
+
+	for _, prefix := range file.Prefixes {
+		switch {
+		case prefix.IPPrefix != "":
+			err = addRange(prefix.IPPrefix, AWS, prefix.Region, prefix.Service)
+		case prefix.IPv4Prefix != "":
+			err = addRange(prefix.IPv4Prefix, GCP, prefix.Scope, prefix.Service)
+		case prefix.IPv6Prefix != "":
+			err = addRange(prefix.IPv6Prefix, GCP, prefix.Scope, prefix.Service)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, prefix := range file.IPv6Prefixes {
+		err = addRange(prefix.IPv6Prefix, AWS, prefix.Region, prefix.Service)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, value := range file.Values {
+		service := value.Properties.SystemService
+		if service == "" {
+			service = value.Name
+		}
+		for _, prefix := range value.Properties.AddressPrefixes {
+			err = addRange(prefix, Azure, value.Properties.Region, service)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if ranges == nil {
+		return nil, errors.New("the file is not an AWS, Azure or GCP IP ranges file")
+	}
+	return ranges, nil
+}
+
+// NewRanges returns the Ranges that contain all of the given ranges
+func NewRanges(ranges []Range) *Ranges {
+	sorted := make([]Range, len(ranges))
+	copy(sorted, ranges)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		iOnes, _ := sorted[i].Prefix.Mask.Size()
+		jOnes, _ := sorted[j].Prefix.Mask.Size()
+		return iOnes > jOnes
+	})
+	return &Ranges{ranges: sorted}
+}
+
+// LoadRangesDir reads every .json file in dir as an IP ranges file. The files are named however they were
+// downloaded, since the provider of each file is recognized from its content.
+func LoadRangesDir(dir string) (*Ranges, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var ranges []Range
+	for _, path := range paths {
+		rangesJSON, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		fileRanges, err := ParseRanges(rangesJSON)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error loading IP ranges file %s", path)
+		}
+		ranges = append(ranges, fileRanges...)
+	}
+
+	return NewRanges(ranges), nil
+}
+
+// Lookup returns the most specific range that contains ip. The second return value is false if ip is not in any
+// of the ranges.
+func (r *Ranges) Lookup(ip net.IP) (Range, bool) {
+	if r == nil || ip == nil {
+		return Range{}, false
+	}
+	for _, ipRange := range r.ranges {
+		if ipRange.Prefix.Contains(ip) {
+			return ipRange, true
+		}
+	}
+	return Range{}, false
+}
+
+// Len returns the number of ranges
+func (r *Ranges) Len() int {
+	if r == nil {
+		return 0
+	}
+	return len(r.ranges)
+}
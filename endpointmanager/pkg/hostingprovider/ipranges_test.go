@@ -0,0 +1,99 @@
+package hostingprovider
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	th "github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/testhelper"
+)
+
+var rangesFiles = []string{"aws_ip_ranges.json", "azure_service_tags.json", "gcp_cloud.json"}
+
+func Test_ParseRanges(t *testing.T) {
+	expectedCounts := map[string]int{
+		"aws_ip_ranges.json":      3,
+		"azure_service_tags.json": 3,
+		"gcp_cloud.json":          2,
+	}
+	expectedProviders := map[string]string{
+		"aws_ip_ranges.json":      AWS,
+		"azure_service_tags.json": Azure,
+		"gcp_cloud.json":          GCP,
+	}
+
+	for _, name := range rangesFiles {
+		rangesJSON, err := os.ReadFile(filepath.Join("../testdata", name))
+		th.Assert(t, err == nil, err)
+
+		ranges, err := ParseRanges(rangesJSON)
+		th.Assert(t, err == nil, err)
+		th.Assert(t, len(ranges) == expectedCounts[name], fmt.Sprintf("expected %d ranges in %s, got %d", expectedCounts[name], name, len(ranges)))
+		for _, ipRange := range ranges {
+			th.Assert(t, ipRange.Provider == expectedProviders[name], fmt.Sprintf("expected the ranges in %s to belong to %s, got %s", name, expectedProviders[name], ipRange.Provider))
+		}
+	}
+
+	// a JSON file that is not an IP ranges file
+	_, err := ParseRanges([]byte(`{"resourceType": "CapabilityStatement"}`))
+	th.Assert(t, err != nil, "expected an error for a file that is not an IP ranges file")
+
+	// an invalid prefix
+	_, err = ParseRanges([]byte(`{"prefixes": [{"ip_prefix": "3.5.140.0/33", "region": "us-east-1", "service": "AMAZON"}]}`))
+	th.Assert(t, err != nil, "expected an error for an invalid prefix")
+
+	_, err = ParseRanges([]byte(`not json`))
+	th.Assert(t, err != nil, "expected an error for a file that is not JSON")
+}
+
+func Test_LoadRangesDir(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range rangesFiles {
+		rangesJSON, err := os.ReadFile(filepath.Join("../testdata", name))
+		th.Assert(t, err == nil, err)
+		err = os.WriteFile(filepath.Join(dir, name), rangesJSON, 0644)
+		th.Assert(t, err == nil, err)
+	}
+
+	ranges, err := LoadRangesDir(dir)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, ranges.Len() == 8, fmt.Sprintf("expected 8 ranges, got %d", ranges.Len()))
+
+	cases := []struct {
+		ip       string
+		found    bool
+		provider string
+		region   string
+		service  string
+	}{
+		// the most specific range is used
+		{"3.5.140.10", true, AWS, "ap-northeast-2", "S3"},
+		{"3.5.141.10", true, AWS, "ap-northeast-2", "AMAZON"},
+		{"2600:1f18::1", true, AWS, "us-east-1", "EC2"},
+		{"20.42.26.5", true, Azure, "eastus", "AzureAppService"},
+		{"20.42.100.5", true, Azure, "eastus", "AzureCloud.eastus"},
+		{"2603:1030:210::1", true, Azure, "eastus", "AzureCloud.eastus"},
+		{"34.81.0.1", true, GCP, "asia-east1", "Google Cloud"},
+		{"2600:1900:4010::1", true, GCP, "europe-west1", "Google Cloud"},
+		{"192.0.2.1", false, "", "", ""},
+	}
+	for _, c := range cases {
+		ipRange, found := ranges.Lookup(net.ParseIP(c.ip))
+		th.Assert(t, found == c.found, fmt.Sprintf("expected %s to be found: %t, got %t", c.ip, c.found, found))
+		th.Assert(t, ipRange.Provider == c.provider && ipRange.Region == c.region && ipRange.Service == c.service,
+			fmt.Sprintf("expected %s to be in %s %s %s, got %+v", c.ip, c.provider, c.region, c.service, ipRange))
+	}
+
+	// a file that is not an IP ranges file
+	err = os.WriteFile(filepath.Join(dir, "capability.json"), []byte(`{"resourceType": "CapabilityStatement"}`), 0644)
+	th.Assert(t, err == nil, err)
+	_, err = LoadRangesDir(dir)
+	th.Assert(t, err != nil, "expected an error for a directory with a file that is not an IP ranges file")
+
+	// no ranges loaded
+	var nilRanges *Ranges
+	_, found := nilRanges.Lookup(net.ParseIP("3.5.140.10"))
+	th.Assert(t, !found, "did not expect an address to be found without any ranges")
+}
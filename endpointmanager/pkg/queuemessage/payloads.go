@@ -0,0 +1,94 @@
+package queuemessage
+
+import (
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+)
+
+// Endpoint is the payload of the messages that the endpoint manager sends with each endpoint whose $versions
+// operation should be queried.
+type Endpoint struct {
+	URL string `json:"url"`
+}
+
+func (Endpoint) requiredFields() []string {
+	return []string{"url"}
+}
+
+// VersionsResponse is the payload of the messages that the capability querier sends with the $versions response of
+// an endpoint. It includes the URL of the FHIR API, any errors from making the $versions request, and the $versions
+// response itself.
+type VersionsResponse struct {
+	URL              string      `json:"url"`
+	Err              string      `json:"err"`
+	VersionsResponse interface{} `json:"versionsResponse"`
+}
+
+func (VersionsResponse) requiredFields() []string {
+	return []string{"url"}
+}
+
+// CapabilityQuery is the payload of the messages that the capability receiver sends for each FHIR version that an
+// endpoint supports, which the capability querier requests the capability statement of. A RequestVersion of "None"
+// requests the capability statement without a FHIR version.
+type CapabilityQuery struct {
+	URL            string `json:"url"`
+	RequestVersion string `json:"requestVersion"`
+	DefaultVersion string `json:"defaultVersion"`
+}
+
+func (CapabilityQuery) requiredFields() []string {
+	return []string{"url"}
+}
+
+// CapabilityResponse is the payload of the messages that the capability querier sends with the capability
+// statement of an endpoint. It includes the URL of the FHIR API, any errors from making the FHIR API request along
+// with their classification, the MIME type, the TLS version, and the capability statement itself.
+type CapabilityResponse struct {
+	URL                       string                              `json:"url"`
+	Err                       string                              `json:"err"`
+	ErrorCode                 endpointmanager.QueryErrorCode      `json:"errorCode"`
+	MIMETypes                 []string                            `json:"mimeTypes"`
+	TLSVersion                string                              `json:"tlsVersion"`
+	HTTPResponse              int                                 `json:"httpResponse"`
+	CapabilityStatement       interface{}                         `json:"capabilityStatement"`
+	CapabilityStatementBytes  []byte                              `json:"capabilityStatementBytes"`
+	SMARTHTTPResponse         int                                 `json:"smarthttpResponse"`
+	SMARTResp                 interface{}                         `json:"smartResp"`
+	SMARTRespBytes            []byte                              `json:"smartRespBytes"`
+	ResponseTime              float64                             `json:"responseTime"`
+	RequestedFhirVersion      string                              `json:"requestedFhirVersion"`
+	DefaultFhirVersion        string                              `json:"defaultFhirVersion"`
+	CapabilityStatementFormat string                              `json:"capabilityStatementFormat"`
+	ResponseTimings           ResponseTimings                     `json:"responseTimings"`
+	TLSInfo                   *endpointmanager.TLSInfo            `json:"tlsInfo"`
+	ResponseHeaders           map[string]string                   `json:"responseHeaders"`
+	RedirectChain             []endpointmanager.RedirectHop       `json:"redirectChain"`
+	ErrorResponse             *endpointmanager.ErrorResponse      `json:"errorResponse"`
+	JWKSInfo                  *endpointmanager.JWKSInfo           `json:"jwksInfo"`
+	AuthServerMetadata        *endpointmanager.AuthServerMetadata `json:"authServerMetadata"`
+	UDAPInfo                  *endpointmanager.UDAPInfo           `json:"udapInfo"`
+	CDSHooksInfo              *endpointmanager.CDSHooksInfo       `json:"cdsHooksInfo"`
+	BulkDataKickoff           *endpointmanager.BulkDataKickoff    `json:"bulkDataKickoff"`
+	DataExposureChecks        []endpointmanager.DataExposureCheck `json:"dataExposureChecks"`
+	DNSInfo                   *endpointmanager.DNSInfo            `json:"dnsInfo"`
+}
+
+// The fields that have been sent by every version of the capability querier. The fields added since then are left
+// empty when they are missing.
+func (CapabilityResponse) requiredFields() []string {
+	return []string{"url", "err", "tlsVersion", "httpResponse", "smarthttpResponse", "responseTime", "requestedFhirVersion", "defaultFhirVersion"}
+}
+
+// ResponseTimings is the breakdown of the time spent in each phase of an HTTP request, in seconds. Phases that did
+// not happen, such as DNS lookup and TLS handshake on a reused connection, are 0.
+type ResponseTimings struct {
+	DNSLookup    float64 `json:"dnsLookup"`
+	TCPConnect   float64 `json:"tcpConnect"`
+	TLSHandshake float64 `json:"tlsHandshake"`
+	// TimeToFirstByte is the time between the request being written and the first byte of the response,
+	// which is the time the server spent processing the request
+	TimeToFirstByte float64 `json:"timeToFirstByte"`
+	BodyTransfer    float64 `json:"bodyTransfer"`
+	// SchedulerWait is the time spent waiting on the HostScheduler before the requests could be made
+	SchedulerWait float64 `json:"schedulerWait"`
+}
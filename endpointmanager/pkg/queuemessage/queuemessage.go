@@ -0,0 +1,264 @@
+// Package queuemessage defines the messages that the Lantern services send each other on the message queues.
+// Each message is an Envelope holding a typed payload along with the schema version it was written with, so that
+// the services reading a queue can be deployed separately from the services writing to it.
+package queuemessage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SchemaVersion is the schema version of the messages written by this package. It is only incremented for changes
+// that the readers of the previous version can't read, such as renaming or removing a field or changing its type,
+// and each increment needs an entry in upgrades. Adding a field doesn't change the schema version because readers
+// ignore the fields they don't know about.
+const SchemaVersion = 1
+
+// legacySchemaVersion is the schema version given to the messages that were sent before the envelope was added:
+// bare endpoint URLs, the "FINISHED" string, and payloads that aren't wrapped in an envelope.
+const legacySchemaVersion = 0
+
+// legacyFinished is what was sent in place of an endpoint URL once all of the endpoints of a run had been sent.
+const legacyFinished = "FINISHED"
+
+// The types of messages sent on the queues.
+const (
+	// TypeEndpoint messages carry an Endpoint from the endpoint manager to the capability querier.
+	TypeEndpoint = "endpoint"
+	// TypeVersionsResponse messages carry a VersionsResponse from the capability querier to the capability receiver.
+	TypeVersionsResponse = "versions-response"
+	// TypeCapabilityQuery messages carry a CapabilityQuery from the capability receiver to the capability querier.
+	TypeCapabilityQuery = "capability-query"
+	// TypeCapabilityResponse messages carry a CapabilityResponse from the capability querier to the capability
+	// receiver.
+	TypeCapabilityResponse = "capability-response"
+	// TypeRunFinished messages have no payload and follow the last endpoint of a run. Each service passes them on
+	// to the next queue of the run. They may be read from any queue regardless of the type of message expected.
+	TypeRunFinished = "run-finished"
+)
+
+// The services that produce messages.
+const (
+	ProducerEndpointManager    = "endpointmanager"
+	ProducerCapabilityQuerier  = "capabilityquerier"
+	ProducerCapabilityReceiver = "capabilityreceiver"
+)
+
+// Envelope is a message sent on a queue. The payload is kept as raw JSON until it is decoded with DecodePayload.
+type Envelope struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Type          string `json:"type"`
+	// MessageID identifies the message. Messages sent before the envelope was added have no ID.
+	MessageID string `json:"messageId"`
+	// RunID identifies the daily querying run that the message belongs to. It is set by the endpoint manager and
+	// copied to the messages sent as a result of each message.
+	RunID     string          `json:"runId"`
+	Producer  string          `json:"producer"`
+	Timestamp time.Time       `json:"timestamp"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+}
+
+// SchemaVersionError is returned when a message was written with a schema version that the reading service
+// doesn't know how to read.
+type SchemaVersionError struct {
+	MessageID string
+	Type      string
+	Producer  string
+	Version   int
+}
+
+func (e *SchemaVersionError) Error() string {
+	if e.Version > SchemaVersion {
+		return fmt.Sprintf("%s message %s from %s has schema version %d, but this service only reads schema versions up to %d and needs to be upgraded",
+			e.Type, e.MessageID, e.Producer, e.Version, SchemaVersion)
+	}
+	return fmt.Sprintf("%s message %s from %s has schema version %d, which this service can't read",
+		e.Type, e.MessageID, e.Producer, e.Version)
+}
+
+// MessageTypeError is returned when a message isn't the type of message expected on the queue it was read from.
+type MessageTypeError struct {
+	MessageID string
+	Expected  string
+	Actual    string
+}
+
+func (e *MessageTypeError) Error() string {
+	return fmt.Sprintf("expected a %s message, got %s message %s", e.Expected, e.Actual, e.MessageID)
+}
+
+// upgrades holds the functions that convert an envelope from each older schema version to the next version. Decode
+// applies them in order until the envelope is at SchemaVersion, so that messages that are still on the queues or
+// that come from services that haven't been upgraded yet can be read.
+var upgrades = map[int]func(env *Envelope) error{
+	legacySchemaVersion: upgradeLegacy,
+}
+
+// Encode wraps 'payload' in an envelope of the current schema version with a new message ID and returns the
+// envelope as JSON. 'payload' may be nil for messages without a payload.
+func Encode(msgType string, producer string, runID string, payload interface{}) ([]byte, error) {
+	env := Envelope{
+		SchemaVersion: SchemaVersion,
+		Type:          msgType,
+		MessageID:     NewID(),
+		RunID:         runID,
+		Producer:      producer,
+		Timestamp:     time.Now().UTC(),
+	}
+	if payload != nil {
+		payloadJSON, err := json.Marshal(payload)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to marshal %s message payload", msgType)
+		}
+		env.Payload = payloadJSON
+	}
+	return json.Marshal(env)
+}
+
+// EncodeRunFinished returns the JSON of a message that marks the end of the run 'runID'.
+func EncodeRunFinished(producer string, runID string) ([]byte, error) {
+	return Encode(TypeRunFinished, producer, runID, nil)
+}
+
+// Decode parses a message read from a queue that carries messages of type 'expectedType' and upgrades it to the
+// current schema version. Messages that aren't in an envelope are read as messages of 'expectedType' with schema
+// version 0. A SchemaVersionError is returned for messages written with a newer schema version, and a
+// MessageTypeError for messages of another type. Run finished messages are returned whatever type is expected.
+func Decode(message []byte, expectedType string) (*Envelope, error) {
+	env, err := parseEnvelope(message, expectedType)
+	if err != nil {
+		return nil, err
+	}
+
+	for env.SchemaVersion < SchemaVersion {
+		upgrade, ok := upgrades[env.SchemaVersion]
+		if !ok {
+			return nil, &SchemaVersionError{MessageID: env.MessageID, Type: env.Type, Producer: env.Producer, Version: env.SchemaVersion}
+		}
+		err = upgrade(env)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to upgrade %s message %s from schema version %d", env.Type, env.MessageID, env.SchemaVersion)
+		}
+		env.SchemaVersion++
+	}
+	if env.SchemaVersion > SchemaVersion {
+		return nil, &SchemaVersionError{MessageID: env.MessageID, Type: env.Type, Producer: env.Producer, Version: env.SchemaVersion}
+	}
+
+	if env.Type != expectedType && env.Type != TypeRunFinished {
+		return nil, &MessageTypeError{MessageID: env.MessageID, Expected: expectedType, Actual: env.Type}
+	}
+	return env, nil
+}
+
+// parseEnvelope parses the envelope of a message, or wraps a message sent before the envelope was added in a
+// legacy envelope
+func parseEnvelope(message []byte, expectedType string) (*Envelope, error) {
+	message = bytes.TrimSpace(message)
+
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(message, &fields)
+	if err != nil {
+		// a bare endpoint URL
+		payload, err := json.Marshal(string(message))
+		if err != nil {
+			return nil, err
+		}
+		return &Envelope{SchemaVersion: legacySchemaVersion, Type: expectedType, Payload: payload}, nil
+	}
+
+	if _, ok := fields["schemaVersion"]; !ok {
+		return &Envelope{SchemaVersion: legacySchemaVersion, Type: expectedType, Payload: message}, nil
+	}
+
+	var env Envelope
+	err = json.Unmarshal(message, &env)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse message envelope")
+	}
+	return &env, nil
+}
+
+// upgradeLegacy converts a message sent before the envelope was added. The payloads of the messages that were JSON
+// objects are unchanged. Bare endpoint URLs become Endpoint payloads, and "FINISHED" in place of a URL becomes a
+// run finished message.
+func upgradeLegacy(env *Envelope) error {
+	var url string
+	err := json.Unmarshal(env.Payload, &url)
+	if err != nil {
+		var fields map[string]interface{}
+		err = json.Unmarshal(env.Payload, &fields)
+		if err != nil {
+			return err
+		}
+		url, _ = fields["url"].(string)
+		if url == legacyFinished {
+			env.Type = TypeRunFinished
+			env.Payload = nil
+		}
+		return nil
+	}
+
+	if url == legacyFinished {
+		env.Type = TypeRunFinished
+		env.Payload = nil
+		return nil
+	}
+	if env.Type != TypeEndpoint {
+		return fmt.Errorf("a %s message must be a JSON object", env.Type)
+	}
+	env.Payload, err = json.Marshal(Endpoint{URL: url})
+	return err
+}
+
+// requiredFielder is implemented by the payloads that can't be read without certain fields
+type requiredFielder interface {
+	requiredFields() []string
+}
+
+// DecodePayload parses the payload of the envelope into 'payload', which should be a pointer to the payload type
+// of the envelope's message type. An error is returned if a field that the payload requires is missing or null.
+func (env *Envelope) DecodePayload(payload interface{}) error {
+	if len(env.Payload) == 0 {
+		return fmt.Errorf("%s message %s has no payload", env.Type, env.MessageID)
+	}
+
+	err := json.Unmarshal(env.Payload, payload)
+	if err != nil {
+		return errors.Wrapf(err, "unable to parse the payload of %s message %s", env.Type, env.MessageID)
+	}
+
+	required, ok := payload.(requiredFielder)
+	if !ok {
+		return nil
+	}
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(env.Payload, &fields)
+	if err != nil {
+		return errors.Wrapf(err, "unable to parse the payload of %s message %s", env.Type, env.MessageID)
+	}
+	for _, name := range required.requiredFields() {
+		value, ok := fields[name]
+		if !ok || bytes.Equal(value, []byte("null")) {
+			return fmt.Errorf("%s message %s is missing the required field %s", env.Type, env.MessageID, name)
+		}
+	}
+	return nil
+}
+
+// NewID returns a random ID for a message or a run
+func NewID() string {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 10)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,134 @@
+package queuemessage
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager"
+	th "github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/testhelper"
+)
+
+func Test_EncodeAndDecode(t *testing.T) {
+	query := CapabilityQuery{URL: "http://example.com/fhir", RequestVersion: "4.0.1", DefaultVersion: "1.0.2"}
+	message, err := Encode(TypeCapabilityQuery, ProducerCapabilityReceiver, "run-1", query)
+	th.Assert(t, err == nil, err)
+
+	env, err := Decode(message, TypeCapabilityQuery)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, env.SchemaVersion == SchemaVersion, fmt.Sprintf("expected schema version %d, got %d", SchemaVersion, env.SchemaVersion))
+	th.Assert(t, env.Type == TypeCapabilityQuery, fmt.Sprintf("expected type %s, got %s", TypeCapabilityQuery, env.Type))
+	th.Assert(t, env.MessageID != "", "expected the message to have an ID")
+	th.Assert(t, env.RunID == "run-1", fmt.Sprintf("expected run ID run-1, got %s", env.RunID))
+	th.Assert(t, env.Producer == ProducerCapabilityReceiver, fmt.Sprintf("expected producer %s, got %s", ProducerCapabilityReceiver, env.Producer))
+	th.Assert(t, !env.Timestamp.IsZero(), "expected the message to have a timestamp")
+
+	var decoded CapabilityQuery
+	err = env.DecodePayload(&decoded)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, decoded == query, fmt.Sprintf("expected %+v, got %+v", query, decoded))
+
+	// each message gets its own ID
+	other, err := Encode(TypeCapabilityQuery, ProducerCapabilityReceiver, "run-1", query)
+	th.Assert(t, err == nil, err)
+	otherEnv, err := Decode(other, TypeCapabilityQuery)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, otherEnv.MessageID != env.MessageID, "expected each message to have a different ID")
+
+	// run finished messages are read from any queue
+	message, err = EncodeRunFinished(ProducerEndpointManager, "run-1")
+	th.Assert(t, err == nil, err)
+	env, err = Decode(message, TypeEndpoint)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, env.Type == TypeRunFinished, fmt.Sprintf("expected type %s, got %s", TypeRunFinished, env.Type))
+	err = env.DecodePayload(&Endpoint{})
+	th.Assert(t, err != nil, "expected an error decoding the payload of a run finished message")
+}
+
+func Test_DecodeLegacy(t *testing.T) {
+	// bare endpoint URL
+	env, err := Decode([]byte("http://example.com/fhir"), TypeEndpoint)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, env.SchemaVersion == SchemaVersion, fmt.Sprintf("expected the message to be upgraded to schema version %d, got %d", SchemaVersion, env.SchemaVersion))
+	var endpt Endpoint
+	err = env.DecodePayload(&endpt)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, endpt.URL == "http://example.com/fhir", fmt.Sprintf("expected URL http://example.com/fhir, got %s", endpt.URL))
+
+	// FINISHED in place of an endpoint URL
+	env, err = Decode([]byte("FINISHED"), TypeEndpoint)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, env.Type == TypeRunFinished, fmt.Sprintf("expected type %s, got %s", TypeRunFinished, env.Type))
+
+	// JSON objects
+	env, err = Decode([]byte(`{"url":"http://example.com/fhir","requestVersion":"None","defaultVersion":""}`), TypeCapabilityQuery)
+	th.Assert(t, err == nil, err)
+	var query CapabilityQuery
+	err = env.DecodePayload(&query)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, query.URL == "http://example.com/fhir" && query.RequestVersion == "None", fmt.Sprintf("unexpected capability query %+v", query))
+
+	env, err = Decode([]byte(`{"url":"FINISHED","err":"","versionsResponse":null}`), TypeVersionsResponse)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, env.Type == TypeRunFinished, fmt.Sprintf("expected type %s, got %s", TypeRunFinished, env.Type))
+
+	// only endpoint messages were sent as bare strings
+	_, err = Decode([]byte("http://example.com/fhir"), TypeCapabilityQuery)
+	th.Assert(t, err != nil, "expected an error decoding a bare string as a capability query")
+}
+
+func Test_DecodeMismatch(t *testing.T) {
+	// newer schema version
+	message := []byte(`{"schemaVersion":2,"type":"endpoint","messageId":"abc","producer":"endpointmanager","payload":{"uri":"http://example.com/fhir"}}`)
+	_, err := Decode(message, TypeEndpoint)
+	versionErr, ok := err.(*SchemaVersionError)
+	th.Assert(t, ok, fmt.Sprintf("expected a SchemaVersionError, got %v", err))
+	th.Assert(t, versionErr.Version == 2, fmt.Sprintf("expected version 2, got %d", versionErr.Version))
+	th.Assert(t, strings.Contains(err.Error(), "needs to be upgraded"), fmt.Sprintf("expected the error to say the service needs to be upgraded, got %s", err))
+
+	// another message type
+	message, err = Encode(TypeEndpoint, ProducerEndpointManager, "run-1", Endpoint{URL: "http://example.com/fhir"})
+	th.Assert(t, err == nil, err)
+	_, err = Decode(message, TypeCapabilityQuery)
+	_, ok = err.(*MessageTypeError)
+	th.Assert(t, ok, fmt.Sprintf("expected a MessageTypeError, got %v", err))
+
+	// not JSON inside the envelope
+	_, err = Decode([]byte(`{"schemaVersion":"1"}`), TypeEndpoint)
+	th.Assert(t, err != nil, "expected an error parsing an envelope with a string schema version")
+}
+
+func Test_DecodePayloadRequiredFields(t *testing.T) {
+	resp := CapabilityResponse{
+		URL:          "http://example.com/fhir",
+		ErrorCode:    endpointmanager.ConnectionRefusedCode,
+		HTTPResponse: 200,
+	}
+	message, err := Encode(TypeCapabilityResponse, ProducerCapabilityQuerier, "run-1", resp)
+	th.Assert(t, err == nil, err)
+	env, err := Decode(message, TypeCapabilityResponse)
+	th.Assert(t, err == nil, err)
+	var decoded CapabilityResponse
+	err = env.DecodePayload(&decoded)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, decoded.ErrorCode == endpointmanager.ConnectionRefusedCode, fmt.Sprintf("expected error code %s, got %s", endpointmanager.ConnectionRefusedCode, decoded.ErrorCode))
+
+	// a null required field
+	var fields map[string]interface{}
+	err = json.Unmarshal(env.Payload, &fields)
+	th.Assert(t, err == nil, err)
+	fields["err"] = nil
+	env.Payload, err = json.Marshal(fields)
+	th.Assert(t, err == nil, err)
+	err = env.DecodePayload(&decoded)
+	th.Assert(t, err != nil && strings.Contains(err.Error(), "required field err"), fmt.Sprintf("expected an error about the missing err field, got %v", err))
+
+	// a missing optional field
+	fields["err"] = ""
+	delete(fields, "dnsInfo")
+	env.Payload, err = json.Marshal(fields)
+	th.Assert(t, err == nil, err)
+	err = env.DecodePayload(&decoded)
+	th.Assert(t, err == nil, err)
+}
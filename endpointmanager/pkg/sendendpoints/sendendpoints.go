@@ -8,10 +8,12 @@ import (
 
 	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/endpointmanager/postgresql"
 	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/historypruning"
+	"github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/queuemessage"
 
 	"github.com/onc-healthit/lantern-back-end/lanternmq"
 	"github.com/onc-healthit/lantern-back-end/lanternmq/pkg/accessqueue"
 	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
 )
 
 // GetEnptsAndSend gets the current list of endpoints from the database and sends each one to the given queue
@@ -50,7 +52,9 @@ func GetEnptsAndSend(
 		log.Infof("Waiting for %d minutes before processing endpoints", int(durationToSleep.Minutes()))
 		time.Sleep(durationToSleep)
 
-		log.Info("Starting daily querying process")
+		// Every message sent as a result of this run carries its ID
+		runID := queuemessage.NewID()
+		log.Infof("Starting daily querying process, run %s", runID)
 
 		// Set the process completion status to false to indicate that the process is in progress
 		err = store.UpdateProcessCompletionStatus(ctx, "false")
@@ -63,7 +67,8 @@ func GetEnptsAndSend(
 			errs <- err
 		}
 
-		// Shuffle Endpoints So that We Are Not Querying As Rapidly
+		// Shuffle endpoints so that endpoints on the same host are spread through the queue. The capability querier
+		// limits the rate of requests made to each host.
 		rand.Shuffle(len(listOfEndpoints), func(i, j int) {
 			listOfEndpoints[i], listOfEndpoints[j] = listOfEndpoints[j], listOfEndpoints[i]
 		})
@@ -72,16 +77,14 @@ func GetEnptsAndSend(
 			if i%10 == 0 {
 				log.Infof("Processed %d/%d messages", i, len(listOfEndpoints))
 			}
-			// Add a short time buffer as we enqueue items
-			time.Sleep(time.Duration(500 * time.Millisecond))
-			err = accessqueue.SendToQueue(ctx, endpt.URL, mq, channelID, qName)
+			err = sendMessage(ctx, queuemessage.TypeEndpoint, runID, queuemessage.Endpoint{URL: endpt.URL}, mq, channelID, qName)
 			if err != nil {
 				errs <- err
 			}
 		}
 
 		if len(listOfEndpoints) != 0 {
-			err = accessqueue.SendToQueue(ctx, "FINISHED", mq, channelID, qName)
+			err = sendMessage(ctx, queuemessage.TypeRunFinished, runID, nil, mq, channelID, qName)
 			if err != nil {
 				errs <- err
 			}
@@ -109,6 +112,15 @@ func GetEnptsAndSend(
 	}
 }
 
+// sendMessage wraps the payload in a message of type 'msgType' for the run 'runID' and sends it to the given queue
+func sendMessage(ctx context.Context, msgType string, runID string, payload interface{}, mq *lanternmq.MessageQueue, channelID *lanternmq.ChannelID, qName string) error {
+	msgBytes, err := queuemessage.Encode(msgType, queuemessage.ProducerEndpointManager, runID, payload)
+	if err != nil {
+		return err
+	}
+	return accessqueue.SendToQueue(ctx, string(msgBytes), mq, channelID, qName)
+}
+
 func HistoryPruning(
 	ctx context.Context,
 	wg *sync.WaitGroup,
@@ -121,6 +133,10 @@ func HistoryPruning(
 	for {
 		log.Info("Starting history pruning")
 		historypruning.PruneInfoHistory(ctx, store, true)
+		err := historypruning.PruneDataExposureChecks(ctx, store, viper.GetInt("data_exposure_retention"))
+		if err != nil {
+			log.Warnf("Pruning the data exposure searches failed: %s", err)
+		}
 
 		log.Infof("History Pruning complete. Waiting %d minutes", qInterval)
 		time.Sleep(time.Duration(qInterval) * time.Minute)
@@ -100,7 +100,7 @@ func TestMain(m *testing.M) {
 // 	time.Sleep(10 * time.Second)
 // 	count, err := aq.QueueCount(queueName, channel)
 // 	th.Assert(t, err == nil, err)
-// 	// Expect 4 messages: 3 endpoints and the "FINISHED" message
+// 	// Expect 4 messages: 3 endpoints and the run finished message
 // 	th.Assert(t, count == 4, fmt.Sprintf("expected there to be 4 messages in the queue, instead got %d", count))
 // 	wg.Done()
 // }
@@ -0,0 +1,70 @@
+package smartparser
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// SMARTConfiguration is the typed representation of the fields of a SMART configuration document that are
+// defined by SMART App Launch 2.x. Fields that are missing from the document are left as their zero values, so
+// a nil slice means the field was not served while an empty slice means it was served without any values.
+type SMARTConfiguration struct {
+	Issuer                        string   `json:"issuer"`
+	JWKSURI                       string   `json:"jwks_uri"`
+	AuthorizationEndpoint         string   `json:"authorization_endpoint"`
+	TokenEndpoint                 string   `json:"token_endpoint"`
+	RegistrationEndpoint          string   `json:"registration_endpoint"`
+	IntrospectionEndpoint         string   `json:"introspection_endpoint"`
+	RevocationEndpoint            string   `json:"revocation_endpoint"`
+	Capabilities                  []string `json:"capabilities"`
+	ScopesSupported               []string `json:"scopes_supported"`
+	GrantTypesSupported           []string `json:"grant_types_supported"`
+	CodeChallengeMethodsSupported []string `json:"code_challenge_methods_supported"`
+}
+
+// NewSMARTConfiguration creates a SMARTConfiguration from a SMART configuration JSON byte array. It returns an
+// error if one of the typed fields has the wrong JSON type.
+func NewSMARTConfiguration(respJSON []byte) (*SMARTConfiguration, error) {
+	var config SMARTConfiguration
+
+	err := json.Unmarshal(respJSON, &config)
+	if err != nil {
+		return nil, errors.Wrap(err, "error unmarshalling SMART configuration")
+	}
+
+	return &config, nil
+}
+
+// GetConfiguration returns the typed representation of the smart response
+func (resp *Response) GetConfiguration() (*SMARTConfiguration, error) {
+	respJSON, err := resp.GetJSON()
+	if err != nil {
+		return nil, err
+	}
+	return NewSMARTConfiguration(respJSON)
+}
+
+// HasCapability returns whether the SMART configuration lists the given capability
+func (config *SMARTConfiguration) HasCapability(capability string) bool {
+	return containsString(config.Capabilities, capability)
+}
+
+// SupportsGrantType returns whether the SMART configuration lists the given grant type
+func (config *SMARTConfiguration) SupportsGrantType(grantType string) bool {
+	return containsString(config.GrantTypesSupported, grantType)
+}
+
+// SupportsCodeChallengeMethod returns whether the SMART configuration lists the given PKCE code challenge method
+func (config *SMARTConfiguration) SupportsCodeChallengeMethod(method string) bool {
+	return containsString(config.CodeChallengeMethodsSupported, method)
+}
+
+func containsString(list []string, str string) bool {
+	for _, item := range list {
+		if item == str {
+			return true
+		}
+	}
+	return false
+}
@@ -12,6 +12,7 @@ type SMARTResponse interface {
 	Equal(SMARTResponse) bool
 	EqualIgnore(SMARTResponse, []string) bool
 	GetJSON() ([]byte, error)
+	GetConfiguration() (*SMARTConfiguration, error)
 }
 
 // Response is a structure containing the Smart Response map interface
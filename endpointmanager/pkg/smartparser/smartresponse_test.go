@@ -1,6 +1,7 @@
 package smartparser
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
@@ -218,3 +219,29 @@ func Test_SMARTResponseEqualIgnore(t *testing.T) {
 	equal = SMARTResponse1.EqualIgnore(SMARTResponse2, ignoredFields)
 	th.Assert(t, equal, "expected equality comparison of SMART responses to be true since they only differ by ignored fields")
 }
+
+func Test_GetConfiguration(t *testing.T) {
+	path := filepath.Join("../testdata", "authorization_cerner_smart_response.json")
+	smartResponseJSON, err := os.ReadFile(path)
+	th.Assert(t, err == nil, err)
+
+	smartResponse, err := NewSMARTResp(smartResponseJSON)
+	th.Assert(t, err == nil, err)
+
+	config, err := smartResponse.GetConfiguration()
+	th.Assert(t, err == nil, err)
+	th.Assert(t, config.TokenEndpoint == "https://authorization.cerner.com/tenants/ec2458f2-1e24-41c8-b71b-0e701af7583d/protocols/oauth2/profiles/smart-v1/token", fmt.Sprintf("unexpected token endpoint %s", config.TokenEndpoint))
+	th.Assert(t, config.IntrospectionEndpoint == "https://authorization.cerner.com/tokeninfo", fmt.Sprintf("unexpected introspection endpoint %s", config.IntrospectionEndpoint))
+	th.Assert(t, config.HasCapability("launch-ehr"), "expected launch-ehr capability")
+	th.Assert(t, !config.HasCapability("launch-fake"), "did not expect launch-fake capability")
+	th.Assert(t, config.SupportsCodeChallengeMethod("S256"), "expected S256 code challenge method")
+	th.Assert(t, len(config.ScopesSupported) == 117, fmt.Sprintf("expected 117 scopes, got %d", len(config.ScopesSupported)))
+
+	// fields that are not served are nil
+	th.Assert(t, config.GrantTypesSupported == nil, fmt.Sprintf("expected no grant types, got %v", config.GrantTypesSupported))
+	th.Assert(t, config.RevocationEndpoint == "", fmt.Sprintf("expected no revocation endpoint, got %s", config.RevocationEndpoint))
+
+	// fields with the wrong type can not be parsed
+	_, err = NewSMARTConfiguration([]byte(`{"capabilities": "launch-ehr"}`))
+	th.Assert(t, err != nil, "expected error parsing capabilities that are not a list")
+}
@@ -76,7 +76,7 @@ type MessageQueue interface {
 	// does not exist.
 	DeclareQueue(chID ChannelID, qName string) error
 	// PublishToQueue sends 'message' to the queue with name 'qName' over the channel with ID
-	// 'chID'.
+	// 'chID', and returns once the queuing service has accepted the message.
 	PublishToQueue(chID ChannelID, qName string, message string) error
 	// ConsumeFromQueue returns an instance of Messages, which acts like the receiving channel
 	// for any messages that present on queue 'qName' on the channel with ID 'chID'.
@@ -0,0 +1,510 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/onc-healthit/lantern-back-end/lanternmq"
+)
+
+// Ensure MessageQueue implements lanternmq.MessageQueue.
+var _ lanternmq.MessageQueue = &MessageQueue{}
+
+// Ensure Messages implements lanternmq.Messages.
+var _ lanternmq.Messages = &Messages{}
+
+// DefaultBroker is the broker used by MessageQueues that were not created with NewMessageQueue, so that every
+// MessageQueue in a process shares the same queues and exchanges.
+var DefaultBroker = NewBroker()
+
+// Broker holds the queues and exchanges that MessageQueues connected to it send and receive messages through. It
+// plays the role of the RabbitMQ service.
+type Broker struct {
+	mu        sync.Mutex
+	cond      *sync.Cond
+	queues    map[string]*queue
+	exchanges map[string]*exchange
+}
+
+// queue holds the messages that are ready to be delivered to its consumers. A message that is delivered is
+// removed from the queue, and it is put back at the front if its consumer is canceled before acknowledging it.
+type queue struct {
+	name     string
+	messages [][]byte
+	// owner is the MessageQueue that declared an exclusive queue. The queue is deleted when its owner is closed.
+	owner *MessageQueue
+}
+
+type exchange struct {
+	name         string
+	exchangeType string
+	bindings     []binding
+}
+
+type binding struct {
+	qName      string
+	routingKey string
+}
+
+// NewBroker returns a Broker without any queues or exchanges
+func NewBroker() *Broker {
+	b := &Broker{
+		queues:    make(map[string]*queue),
+		exchanges: make(map[string]*exchange),
+	}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// MessageCount returns the number of messages on the queue with name 'qName' that are ready to be delivered,
+// which does not include messages that have been delivered but not yet acknowledged.
+func (b *Broker) MessageCount(qName string) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q, ok := b.queues[qName]
+	if !ok {
+		return -1, fmt.Errorf("queue %s does not exist", qName)
+	}
+	return len(q.messages), nil
+}
+
+// MessageQueue is an in-process implementation of the lanternmq.MessageQueue interface that behaves like the
+// RabbitMQ implementation without needing a RabbitMQ service, which makes it suitable for tests and for running
+// all of the Lantern services in a single process. It allows the user to:
+// * connect to a broker
+// * create a channel for that broker
+// * state how many messages a consumer can have delivered but not yet acknowledged
+// * declare a queue, and send and receive from that queue
+// * declare an exchange, and send and receive from that exchange
+//   - potential exchange options are: 'direct', 'topic', and 'fanout'
+//
+// * close the MessageQueue, which includes canceling its consumers and deleting the exclusive queues it declared.
+//
+// Messages are not persisted and are lost when the process exits.
+type MessageQueue struct {
+	broker    *Broker
+	connected bool
+	channels  []*channel
+}
+
+// channel holds the consumers created on it and the prefetch count that they are created with
+type channel struct {
+	prefetch  int
+	consumers []*consumer
+	closed    bool
+}
+
+// consumer delivers the messages of a queue one at a time to its deliveries channel. It takes a message off the
+// queue only while it has fewer than prefetch unacknowledged messages, or whenever it is ready if prefetch is 0.
+type consumer struct {
+	q          *queue
+	prefetch   int
+	unacked    int
+	canceled   bool
+	done       chan struct{}
+	deliveries chan *delivery
+}
+
+type delivery struct {
+	body     []byte
+	consumer *consumer
+	acked    bool
+}
+
+// Messages wraps the delivery channel of a consumer.
+type Messages struct {
+	broker   *Broker
+	consumer *consumer
+}
+
+// NewMessageQueue returns a MessageQueue that connects to 'broker'.
+func NewMessageQueue(broker *Broker) *MessageQueue {
+	return &MessageQueue{broker: broker}
+}
+
+// lock locks the broker that the MessageQueue is connected to. An error is returned if it has not connected to one.
+func (mq *MessageQueue) lock() error {
+	if mq.broker == nil {
+		return errors.New("connection must exist before using a channel")
+	}
+	mq.broker.mu.Lock()
+	return nil
+}
+
+// getChannel retrieves the channel provided by `id` by casting `id` back to an integer and retrieving the channel
+// at the corresponding index of MessageQueue.channels array. It must be called while the broker is locked.
+func (mq *MessageQueue) getChannel(id lanternmq.ChannelID) (*channel, error) {
+	idInt, ok := id.(int)
+	if !ok {
+		return nil, errors.New("ChannelID not of correct type")
+	}
+	if idInt < 0 || idInt >= len(mq.channels) {
+		return nil, errors.New("no channel with the requested ID was found")
+	}
+	ch := mq.channels[idInt]
+	if ch.closed {
+		return nil, errors.New("the channel with the requested ID is closed")
+	}
+	return ch, nil
+}
+
+// Connect connects to the MessageQueue's broker, or to DefaultBroker if the MessageQueue was not created with
+// NewMessageQueue. The credentials and location are ignored.
+func (mq *MessageQueue) Connect(username string, password string, host string, port string) error {
+	if mq.broker == nil {
+		mq.broker = DefaultBroker
+	}
+	mq.broker.mu.Lock()
+	defer mq.broker.mu.Unlock()
+
+	mq.connected = true
+	return nil
+}
+
+// CreateChannel creates a channel to the broker that has already been connected to. If the broker has not been
+// connected to already, an error is thrown. The channel's ID is returned.
+func (mq *MessageQueue) CreateChannel() (lanternmq.ChannelID, error) {
+	if mq.broker == nil {
+		return "", errors.New("connection must exist before creating a channel")
+	}
+	mq.broker.mu.Lock()
+	defer mq.broker.mu.Unlock()
+
+	if !mq.connected {
+		return "", errors.New("connection must exist before creating a channel")
+	}
+	mq.channels = append(mq.channels, &channel{})
+	return lanternmq.ChannelID(len(mq.channels) - 1), nil
+}
+
+// NumConcurrentMsgs defines how many messages each consumer created on the channel afterwards can have delivered
+// but not yet acknowledged, in the same way as RabbitMQ's per-consumer prefetch count. 0 means no limit.
+func (mq *MessageQueue) NumConcurrentMsgs(chID lanternmq.ChannelID, num int) error {
+	err := mq.lock()
+	if err != nil {
+		return err
+	}
+	defer mq.broker.mu.Unlock()
+
+	ch, err := mq.getChannel(chID)
+	if err != nil {
+		return err
+	}
+	if num < 0 {
+		return errors.New("unable to set the number of concurrent messages that can be handled")
+	}
+	ch.prefetch = num
+	return nil
+}
+
+// QueueExists checks whether or not a queue already exists. If so, it returns (true, nil). If not,
+// it returns (false, nil). If an error is encountered, it returns (false, err).
+func (mq *MessageQueue) QueueExists(chID lanternmq.ChannelID, qName string) (bool, error) {
+	err := mq.lock()
+	if err != nil {
+		return false, err
+	}
+	defer mq.broker.mu.Unlock()
+
+	_, err = mq.getChannel(chID)
+	if err != nil {
+		return false, err
+	}
+	_, ok := mq.broker.queues[qName]
+	return ok, nil
+}
+
+// DeclareQueue creates a queue with the given name on the broker if one does not exist.
+func (mq *MessageQueue) DeclareQueue(chID lanternmq.ChannelID, qName string) error {
+	err := mq.lock()
+	if err != nil {
+		return err
+	}
+	defer mq.broker.mu.Unlock()
+
+	_, err = mq.getChannel(chID)
+	if err != nil {
+		return err
+	}
+	mq.broker.declareQueue(qName, nil)
+	return nil
+}
+
+// declareQueue creates the queue with name 'qName' if it does not exist. It must be called while the broker is
+// locked.
+func (b *Broker) declareQueue(qName string, owner *MessageQueue) {
+	if _, ok := b.queues[qName]; !ok {
+		b.queues[qName] = &queue{name: qName, owner: owner}
+	}
+}
+
+// PublishToQueue publishes 'message' on the queue with name 'qName'. As with RabbitMQ, a message published to a
+// queue that does not exist is dropped.
+func (mq *MessageQueue) PublishToQueue(chID lanternmq.ChannelID, qName string, message string) error {
+	return mq.PublishToExchange(chID, "", qName, message)
+}
+
+// ConsumeFromQueue opens a receive channel for the messages on the queue with name 'qName'. The messages are
+// delivered until the consumer is canceled by ProcessMessages returning or by the MessageQueue being closed.
+func (mq *MessageQueue) ConsumeFromQueue(chID lanternmq.ChannelID, qName string) (lanternmq.Messages, error) {
+	err := mq.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer mq.broker.mu.Unlock()
+
+	ch, err := mq.getChannel(chID)
+	if err != nil {
+		return nil, err
+	}
+	q, ok := mq.broker.queues[qName]
+	if !ok {
+		return nil, fmt.Errorf("queue %s does not exist", qName)
+	}
+
+	c := &consumer{
+		q:          q,
+		prefetch:   ch.prefetch,
+		done:       make(chan struct{}),
+		deliveries: make(chan *delivery),
+	}
+	ch.consumers = append(ch.consumers, c)
+	go mq.broker.deliver(c)
+
+	return &Messages{broker: mq.broker, consumer: c}, nil
+}
+
+// deliver sends the messages of the consumer's queue to its deliveries channel until the consumer is canceled,
+// and then closes the deliveries channel.
+func (b *Broker) deliver(c *consumer) {
+	defer close(c.deliveries)
+
+	for {
+		b.mu.Lock()
+		for !c.canceled && (len(c.q.messages) == 0 || (c.prefetch > 0 && c.unacked >= c.prefetch)) {
+			b.cond.Wait()
+		}
+		if c.canceled {
+			b.mu.Unlock()
+			return
+		}
+		body := c.q.messages[0]
+		c.q.messages = c.q.messages[1:]
+		c.unacked++
+		b.mu.Unlock()
+
+		select {
+		case c.deliveries <- &delivery{body: body, consumer: c}:
+		case <-c.done:
+			// the message was never received, so it goes back to the front of the queue for another consumer
+			b.mu.Lock()
+			c.q.messages = append([][]byte{body}, c.q.messages...)
+			c.unacked--
+			b.cond.Broadcast()
+			b.mu.Unlock()
+			return
+		}
+	}
+}
+
+// ack acknowledges the delivery, which lets its consumer take another message off the queue
+func (b *Broker) ack(d *delivery) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if d.acked {
+		return
+	}
+	d.acked = true
+	d.consumer.unacked--
+	b.cond.Broadcast()
+}
+
+// cancel stops the consumer from taking messages off its queue. It must be called while the broker is locked.
+func (b *Broker) cancel(c *consumer) {
+	if c.canceled {
+		return
+	}
+	c.canceled = true
+	close(c.done)
+	b.cond.Broadcast()
+}
+
+// ProcessMessages takes 'msgs', which wraps the delivery channel of a consumer, and provides each message along
+// with 'args' to the lanternmq.MessageHandler 'handler'. Each message is acknowledged after it is processed. If
+// there's an error processing a message, the error is sent to the 'errs' channel. When 'ctx' is done, the consumer
+// is canceled and ProcessMessages returns.
+// ProcessMessages should be called as a goroutine. Example:
+//
+//	go mq.ProcessMessages(ctx, msgs, handler, nil, errs)
+func (mq *MessageQueue) ProcessMessages(ctx context.Context, msgs lanternmq.Messages, handler lanternmq.MessageHandler, args *map[string]interface{}, errs chan<- error) {
+	msgsd, ok := msgs.(*Messages)
+	if !ok {
+		errs <- errors.New("the messages are of the wrong type")
+		return
+	}
+
+	defer func() {
+		msgsd.broker.mu.Lock()
+		msgsd.broker.cancel(msgsd.consumer)
+		msgsd.broker.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case d, ok := <-msgsd.consumer.deliveries:
+			if !ok {
+				return
+			}
+			err := handler(d.body, args)
+			if err != nil {
+				errs <- err
+			}
+			msgsd.broker.ack(d)
+		}
+	}
+}
+
+// DeclareExchange creates an exchange named 'name' of type 'exchangeType' if one does not exist. The exchange
+// types 'direct', 'topic' and 'fanout' are supported. As with RabbitMQ, declaring an existing exchange with a
+// different type is an error.
+func (mq *MessageQueue) DeclareExchange(chID lanternmq.ChannelID, name string, exchangeType string) error {
+	err := mq.lock()
+	if err != nil {
+		return err
+	}
+	defer mq.broker.mu.Unlock()
+
+	_, err = mq.getChannel(chID)
+	if err != nil {
+		return err
+	}
+	if !lanternmq.SupportedExchangeType(exchangeType) {
+		return errors.New("unable to declare target")
+	}
+	if ex, ok := mq.broker.exchanges[name]; ok {
+		if ex.exchangeType != exchangeType {
+			return errors.New("unable to declare target")
+		}
+		return nil
+	}
+	mq.broker.exchanges[name] = &exchange{name: name, exchangeType: exchangeType}
+	return nil
+}
+
+// PublishToExchange sends 'message' to the exchange 'name' with routing key 'routingKey', which puts the message
+// on each queue bound to the exchange with a matching routing key. The exchange "" is the default exchange, which
+// routes the message to the queue named 'routingKey'.
+func (mq *MessageQueue) PublishToExchange(chID lanternmq.ChannelID, name string, routingKey string, message string) error {
+	err := mq.lock()
+	if err != nil {
+		return err
+	}
+	defer mq.broker.mu.Unlock()
+
+	_, err = mq.getChannel(chID)
+	if err != nil {
+		return err
+	}
+
+	var qNames []string
+	if name == "" {
+		qNames = []string{routingKey}
+	} else {
+		ex, ok := mq.broker.exchanges[name]
+		if !ok {
+			return fmt.Errorf("unable to publish to target %s with routing key %s", name, routingKey)
+		}
+		qNames = ex.route(routingKey)
+	}
+
+	for _, qName := range qNames {
+		if q, ok := mq.broker.queues[qName]; ok {
+			q.messages = append(q.messages, []byte(message))
+		}
+	}
+	mq.broker.cond.Broadcast()
+	return nil
+}
+
+// route returns the names of the queues bound to the exchange that a message with the routing key is put on
+func (ex *exchange) route(routingKey string) []string {
+	var qNames []string
+	found := make(map[string]bool)
+	for _, b := range ex.bindings {
+		if lanternmq.RoutingKeyMatches(ex.exchangeType, b.routingKey, routingKey) && !found[b.qName] {
+			found[b.qName] = true
+			qNames = append(qNames, b.qName)
+		}
+	}
+	return qNames
+}
+
+// DeclareExchangeReceiveQueue creates a queue named 'qName' to receive messages from the exchange named
+// 'exchangeName' with routing key 'routingKey'. As with RabbitMQ, the queue is exclusive to the MessageQueue and is
+// deleted when the MessageQueue is closed.
+func (mq *MessageQueue) DeclareExchangeReceiveQueue(chID lanternmq.ChannelID, exchangeName string, qName string, routingKey string) error {
+	err := mq.lock()
+	if err != nil {
+		return err
+	}
+	defer mq.broker.mu.Unlock()
+
+	_, err = mq.getChannel(chID)
+	if err != nil {
+		return err
+	}
+	ex, ok := mq.broker.exchanges[exchangeName]
+	if !ok {
+		return fmt.Errorf("unable to bind queue %s to target %s with routing key %s", qName, exchangeName, routingKey)
+	}
+	if q, ok := mq.broker.queues[qName]; ok && q.owner != nil && q.owner != mq {
+		return fmt.Errorf("unable to create queue: queue %s is exclusive to another connection", qName)
+	}
+
+	mq.broker.declareQueue(qName, mq)
+	for _, b := range ex.bindings {
+		if b.qName == qName && b.routingKey == routingKey {
+			return nil
+		}
+	}
+	ex.bindings = append(ex.bindings, binding{qName: qName, routingKey: routingKey})
+	return nil
+}
+
+// Close cancels the consumers of each channel that's been created and deletes the exclusive queues that the
+// MessageQueue declared.
+func (mq *MessageQueue) Close() {
+	if mq.broker == nil {
+		return
+	}
+	mq.broker.mu.Lock()
+	defer mq.broker.mu.Unlock()
+
+	for _, ch := range mq.channels {
+		for _, c := range ch.consumers {
+			mq.broker.cancel(c)
+		}
+		ch.closed = true
+	}
+	for qName, q := range mq.broker.queues {
+		if q.owner == mq {
+			delete(mq.broker.queues, qName)
+			for _, ex := range mq.broker.exchanges {
+				bindings := ex.bindings[:0]
+				for _, b := range ex.bindings {
+					if b.qName != qName {
+						bindings = append(bindings, b)
+					}
+				}
+				ex.bindings = bindings
+			}
+		}
+	}
+	mq.connected = false
+}
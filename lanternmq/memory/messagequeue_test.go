@@ -0,0 +1,351 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	th "github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/testhelper"
+	"github.com/onc-healthit/lantern-back-end/lanternmq"
+)
+
+// connect returns a MessageQueue connected to the broker and a channel created on it
+func connect(t *testing.T, broker *Broker) (*MessageQueue, lanternmq.ChannelID) {
+	mq := NewMessageQueue(broker)
+	err := mq.Connect("guest", "guest", "localhost", "5672")
+	th.Assert(t, err == nil, err)
+	ch, err := mq.CreateChannel()
+	th.Assert(t, err == nil, err)
+	t.Cleanup(mq.Close)
+	return mq, ch
+}
+
+// received collects the messages that a handler is given
+type received struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (r *received) handler(msg []byte, _ *map[string]interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages = append(r.messages, string(msg))
+	return nil
+}
+
+// wait waits until the handler has been given n messages and returns them
+func (r *received) wait(t *testing.T, n int) []string {
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		r.mu.Lock()
+		messages := append([]string{}, r.messages...)
+		r.mu.Unlock()
+		if len(messages) >= n || time.Now().After(deadline) {
+			return messages
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// waitForCount waits until the queue has count ready messages and returns the last count seen
+func waitForCount(t *testing.T, broker *Broker, qName string, count int) int {
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		n, err := broker.MessageCount(qName)
+		th.Assert(t, err == nil, err)
+		if n == count || time.Now().After(deadline) {
+			return n
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func Test_Queue(t *testing.T) {
+	broker := NewBroker()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sender, sendCh := connect(t, broker)
+	receiver, receiveCh := connect(t, broker)
+
+	// the queue does not exist until it is declared
+	exists, err := sender.QueueExists(sendCh, "queue")
+	th.Assert(t, err == nil, err)
+	th.Assert(t, !exists, "did not expect the queue to exist before it was declared")
+	_, err = receiver.ConsumeFromQueue(receiveCh, "queue")
+	th.Assert(t, err != nil, "expected an error consuming from a queue that does not exist")
+
+	err = sender.DeclareQueue(sendCh, "queue")
+	th.Assert(t, err == nil, err)
+	exists, err = receiver.QueueExists(receiveCh, "queue")
+	th.Assert(t, err == nil, err)
+	th.Assert(t, exists, "expected the queue declared by another MessageQueue to exist")
+
+	// messages published before the consumer starts are kept
+	for i := 1; i <= 3; i++ {
+		err = sender.PublishToQueue(sendCh, "queue", fmt.Sprintf("message %d", i))
+		th.Assert(t, err == nil, err)
+	}
+	count, err := broker.MessageCount("queue")
+	th.Assert(t, err == nil, err)
+	th.Assert(t, count == 3, fmt.Sprintf("expected 3 messages on the queue, got %d", count))
+
+	// messages published to a queue that does not exist are dropped
+	err = sender.PublishToQueue(sendCh, "other queue", "dropped")
+	th.Assert(t, err == nil, err)
+
+	msgs, err := receiver.ConsumeFromQueue(receiveCh, "queue")
+	th.Assert(t, err == nil, err)
+	var r received
+	errs := make(chan error)
+	go receiver.ProcessMessages(ctx, msgs, r.handler, nil, errs)
+
+	err = sender.PublishToQueue(sendCh, "queue", "message 4")
+	th.Assert(t, err == nil, err)
+
+	messages := r.wait(t, 4)
+	expected := []string{"message 1", "message 2", "message 3", "message 4"}
+	th.Assert(t, strings.Join(messages, ",") == strings.Join(expected, ","), fmt.Sprintf("expected the messages %v in order, got %v", expected, messages))
+	count = waitForCount(t, broker, "queue", 0)
+	th.Assert(t, count == 0, fmt.Sprintf("expected no messages left on the queue, got %d", count))
+}
+
+func Test_ProcessMessagesErrors(t *testing.T) {
+	broker := NewBroker()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mq, ch := connect(t, broker)
+	err := mq.DeclareQueue(ch, "queue")
+	th.Assert(t, err == nil, err)
+	msgs, err := mq.ConsumeFromQueue(ch, "queue")
+	th.Assert(t, err == nil, err)
+
+	errs := make(chan error)
+	go mq.ProcessMessages(ctx, msgs, func(msg []byte, _ *map[string]interface{}) error {
+		return fmt.Errorf("unable to handle %s", msg)
+	}, nil, errs)
+
+	err = mq.PublishToQueue(ch, "queue", "message")
+	th.Assert(t, err == nil, err)
+	select {
+	case err = <-errs:
+		th.Assert(t, err.Error() == "unable to handle message", fmt.Sprintf("expected the handler's error, got %s", err))
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the handler's error to be sent to the errors channel")
+	}
+
+	// messages of another implementation
+	go mq.ProcessMessages(ctx, "not messages", nil, nil, errs)
+	select {
+	case err = <-errs:
+		th.Assert(t, err != nil, "expected an error for messages of the wrong type")
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected an error for messages of the wrong type")
+	}
+}
+
+func Test_Exchanges(t *testing.T) {
+	broker := NewBroker()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sender, sendCh := connect(t, broker)
+
+	err := sender.DeclareExchange(sendCh, "headers", "headers")
+	th.Assert(t, err != nil, "expected an error declaring an exchange of an unsupported type")
+	err = sender.PublishToExchange(sendCh, "topic", "a.b", "message")
+	th.Assert(t, err != nil, "expected an error publishing to an exchange that does not exist")
+
+	err = sender.DeclareExchange(sendCh, "topic", "topic")
+	th.Assert(t, err == nil, err)
+	err = sender.DeclareExchange(sendCh, "topic", "topic")
+	th.Assert(t, err == nil, err)
+	err = sender.DeclareExchange(sendCh, "topic", "fanout")
+	th.Assert(t, err != nil, "expected an error declaring an existing exchange with a different type")
+	err = sender.DeclareExchange(sendCh, "fanout", "fanout")
+	th.Assert(t, err == nil, err)
+	err = sender.DeclareExchange(sendCh, "direct", "direct")
+	th.Assert(t, err == nil, err)
+
+	cases := []struct {
+		exchange   string
+		routingKey string
+		sent       []string
+		expected   []string
+	}{
+		{"topic", "versions.*", []string{"versions.request", "versions.response", "versions", "capability.request"}, []string{"versions.request", "versions.response"}},
+		{"topic", "#.response", []string{"versions.response", "response", "a.b.response", "response.a"}, []string{"a.b.response", "response", "versions.response"}},
+		{"fanout", "ignored", []string{"a", "b.c"}, []string{"a", "b.c"}},
+		{"direct", "capability", []string{"capability", "capability.request"}, []string{"capability"}},
+	}
+	for i, c := range cases {
+		receiver, receiveCh := connect(t, broker)
+		qName := fmt.Sprintf("%s receiver %d", c.exchange, i)
+		err = receiver.DeclareExchangeReceiveQueue(receiveCh, c.exchange, qName, c.routingKey)
+		th.Assert(t, err == nil, err)
+		msgs, err := receiver.ConsumeFromQueue(receiveCh, qName)
+		th.Assert(t, err == nil, err)
+		var r received
+		go receiver.ProcessMessages(ctx, msgs, r.handler, nil, make(chan error))
+
+		for _, routingKey := range c.sent {
+			err = sender.PublishToExchange(sendCh, c.exchange, routingKey, routingKey)
+			th.Assert(t, err == nil, err)
+		}
+		// the message sent afterwards is only received to know that all of the others were routed
+		err = sender.PublishToQueue(sendCh, qName, "done")
+		th.Assert(t, err == nil, err)
+		messages := r.wait(t, len(c.expected)+1)
+		th.Assert(t, len(messages) > 0 && messages[len(messages)-1] == "done", fmt.Sprintf("expected the last message to be done, got %v", messages))
+		messages = messages[:len(messages)-1]
+		sort.Strings(messages)
+		th.Assert(t, strings.Join(messages, ",") == strings.Join(c.expected, ","), fmt.Sprintf("expected %s with %s to route %v, got %v", c.exchange, c.routingKey, c.expected, messages))
+	}
+
+	// the exchange receive queue is deleted when its MessageQueue is closed
+	receiver, receiveCh := connect(t, broker)
+	err = receiver.DeclareExchangeReceiveQueue(receiveCh, "fanout", "exclusive", "")
+	th.Assert(t, err == nil, err)
+	other, otherCh := connect(t, broker)
+	err = other.DeclareExchangeReceiveQueue(otherCh, "fanout", "exclusive", "")
+	th.Assert(t, err != nil, "expected an error declaring a queue that is exclusive to another MessageQueue")
+	receiver.Close()
+	exists, err := sender.QueueExists(sendCh, "exclusive")
+	th.Assert(t, err == nil, err)
+	th.Assert(t, !exists, "expected the exchange receive queue to be deleted when its MessageQueue was closed")
+	_, err = receiver.QueueExists(receiveCh, "exclusive")
+	th.Assert(t, err != nil, "expected an error using a channel of a closed MessageQueue")
+}
+
+func Test_NumConcurrentMsgs(t *testing.T) {
+	for _, prefetch := range []int{1, 2} {
+		broker := NewBroker()
+		ctx, cancel := context.WithCancel(context.Background())
+
+		mq, ch := connect(t, broker)
+		err := mq.NumConcurrentMsgs(ch, prefetch)
+		th.Assert(t, err == nil, err)
+		err = mq.DeclareQueue(ch, "queue")
+		th.Assert(t, err == nil, err)
+		for i := 0; i < 5; i++ {
+			err = mq.PublishToQueue(ch, "queue", fmt.Sprintf("message %d", i))
+			th.Assert(t, err == nil, err)
+		}
+
+		// the handler blocks on the first message, so the consumer only takes as many messages off the queue as
+		// it is allowed to have unacknowledged
+		msgs, err := mq.ConsumeFromQueue(ch, "queue")
+		th.Assert(t, err == nil, err)
+		handling := make(chan bool)
+		release := make(chan bool)
+		go mq.ProcessMessages(ctx, msgs, func(msg []byte, _ *map[string]interface{}) error {
+			select {
+			case handling <- true:
+			case <-ctx.Done():
+				return nil
+			}
+			select {
+			case <-release:
+			case <-ctx.Done():
+			}
+			return nil
+		}, nil, make(chan error))
+
+		<-handling
+		waitForCount(t, broker, "queue", 5-prefetch)
+		// give the consumer time to take more messages off the queue than it is allowed to
+		time.Sleep(20 * time.Millisecond)
+		count, err := broker.MessageCount("queue")
+		th.Assert(t, err == nil, err)
+		th.Assert(t, count == 5-prefetch, fmt.Sprintf("expected %d messages left on the queue with a prefetch of %d, got %d", 5-prefetch, prefetch, count))
+
+		// acknowledging the message lets the consumer take the next one
+		release <- true
+		<-handling
+		count = waitForCount(t, broker, "queue", 4-prefetch)
+		th.Assert(t, count == 4-prefetch, fmt.Sprintf("expected %d messages left on the queue after an acknowledgement, got %d", 4-prefetch, count))
+
+		cancel()
+	}
+
+	mq, ch := connect(t, NewBroker())
+	err := mq.NumConcurrentMsgs(ch, -1)
+	th.Assert(t, err != nil, "expected an error for a negative number of concurrent messages")
+	err = mq.NumConcurrentMsgs("channel", 1)
+	th.Assert(t, err != nil, "expected an error for a channel ID of the wrong type")
+}
+
+func Test_ProcessMessagesContextCanceled(t *testing.T) {
+	broker := NewBroker()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	mq, ch := connect(t, broker)
+	err := mq.DeclareQueue(ch, "queue")
+	th.Assert(t, err == nil, err)
+	msgs, err := mq.ConsumeFromQueue(ch, "queue")
+	th.Assert(t, err == nil, err)
+
+	var r received
+	done := make(chan bool)
+	go func() {
+		mq.ProcessMessages(ctx, msgs, r.handler, nil, make(chan error))
+		done <- true
+	}()
+
+	err = mq.PublishToQueue(ch, "queue", "before")
+	th.Assert(t, err == nil, err)
+	messages := r.wait(t, 1)
+	th.Assert(t, len(messages) == 1, fmt.Sprintf("expected 1 message before the context was canceled, got %v", messages))
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected ProcessMessages to return when the context was canceled")
+	}
+
+	// messages published after the consumer was canceled stay on the queue for another consumer
+	err = mq.PublishToQueue(ch, "queue", "after")
+	th.Assert(t, err == nil, err)
+	count := waitForCount(t, broker, "queue", 1)
+	th.Assert(t, count == 1, fmt.Sprintf("expected the message to stay on the queue, got %d messages", count))
+
+	msgs, err = mq.ConsumeFromQueue(ch, "queue")
+	th.Assert(t, err == nil, err)
+	var r2 received
+	go mq.ProcessMessages(context.Background(), msgs, r2.handler, nil, make(chan error))
+	messages = r2.wait(t, 1)
+	th.Assert(t, len(messages) == 1 && messages[0] == "after", fmt.Sprintf("expected the message published after the cancellation, got %v", messages))
+	th.Assert(t, len(r.wait(t, 1)) == 1, "did not expect the canceled consumer to receive more messages")
+}
+
+func Test_DefaultBroker(t *testing.T) {
+	sender := &MessageQueue{}
+	_, err := sender.CreateChannel()
+	th.Assert(t, err != nil, "expected an error creating a channel before connecting")
+	_, err = sender.QueueExists(0, "queue")
+	th.Assert(t, err != nil, "expected an error using a channel before connecting")
+
+	err = sender.Connect("guest", "guest", "localhost", "5672")
+	th.Assert(t, err == nil, err)
+	defer sender.Close()
+	sendCh, err := sender.CreateChannel()
+	th.Assert(t, err == nil, err)
+	err = sender.DeclareQueue(sendCh, "default broker queue")
+	th.Assert(t, err == nil, err)
+
+	receiver := &MessageQueue{}
+	err = receiver.Connect("guest", "guest", "localhost", "5672")
+	th.Assert(t, err == nil, err)
+	defer receiver.Close()
+	receiveCh, err := receiver.CreateChannel()
+	th.Assert(t, err == nil, err)
+	exists, err := receiver.QueueExists(receiveCh, "default broker queue")
+	th.Assert(t, err == nil, err)
+	th.Assert(t, exists, "expected MessageQueues that were not given a broker to share the default broker")
+}
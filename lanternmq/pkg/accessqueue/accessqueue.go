@@ -3,18 +3,43 @@ package accessqueue
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/onc-healthit/lantern-back-end/lanternmq"
+	"github.com/onc-healthit/lantern-back-end/lanternmq/memory"
+	"github.com/onc-healthit/lantern-back-end/lanternmq/postgres"
 	"github.com/onc-healthit/lantern-back-end/lanternmq/rabbitmq"
 	"github.com/pkg/errors"
+	"github.com/spf13/viper"
 	"github.com/streadway/amqp"
 )
 
 // ConnectToServerAndQueue creates a connection to an exchange at the given location with the given credentials.
-// then connects to the queue with the given queue name
+// then connects to the queue with the given queue name. The queue driver is chosen with the 'queue_driver'
+// setting:
+// * rabbitmq: the RabbitMQ service at the given location. This is the default. Messages that fail to be processed
+// are retried and dead-lettered as configured by the 'queue_retry_*' settings.
+// * postgres: the queue tables of the Lantern database. The database settings are used to connect instead of the
+// given location and credentials.
+// * memory: memory.DefaultBroker, which is shared by every service in the process. The location and credentials are
+// ignored and messages are lost when the process exits.
 func ConnectToServerAndQueue(qUser, qPassword, qHost, qPort, qName string) (lanternmq.MessageQueue, lanternmq.ChannelID, error) {
-	mq := &rabbitmq.MessageQueue{}
-	err := mq.Connect(qUser, qPassword, qHost, qPort)
+	var mq lanternmq.MessageQueue
+	var err error
+	switch driver := viper.GetString("queue_driver"); driver {
+	case "", "rabbitmq":
+		mq = &rabbitmq.MessageQueue{RetryPolicy: RetryPolicy()}
+		err = mq.Connect(qUser, qPassword, qHost, qPort)
+	case "postgres":
+		visibilityTimeout := time.Duration(viper.GetInt("queue_visibility_timeout")) * time.Second
+		mq = postgres.NewMessageQueue(viper.GetString("dbname"), viper.GetString("dbsslmode"), visibilityTimeout)
+		err = mq.Connect(viper.GetString("dbuser"), viper.GetString("dbpassword"), viper.GetString("dbhost"), viper.GetString("dbport"))
+	case "memory":
+		mq = memory.NewMessageQueue(memory.DefaultBroker)
+		err = mq.Connect(qUser, qPassword, qHost, qPort)
+	default:
+		return nil, nil, errors.Errorf("unknown queue driver %s", driver)
+	}
 	if err != nil {
 		return nil, nil, err
 	}
@@ -25,6 +50,23 @@ func ConnectToServerAndQueue(qUser, qPassword, qHost, qPort, qName string) (lant
 	return ConnectToQueue(mq, ch, qName)
 }
 
+// RetryPolicy returns the policy for retrying messages that fail to be processed, which is configured by the
+// 'queue_retry_max_attempts', 'queue_retry_initial_delay' and 'queue_retry_max_delay' settings (in seconds) and the
+// 'queue_retry_multiplier' setting. If 'queue_retry_max_attempts' is not positive, messages are not retried and nil
+// is returned.
+func RetryPolicy() *lanternmq.RetryPolicy {
+	maxAttempts := viper.GetInt("queue_retry_max_attempts")
+	if maxAttempts <= 0 {
+		return nil
+	}
+	return &lanternmq.RetryPolicy{
+		MaxAttempts:  maxAttempts,
+		InitialDelay: time.Duration(viper.GetInt("queue_retry_initial_delay")) * time.Second,
+		Multiplier:   viper.GetFloat64("queue_retry_multiplier"),
+		MaxDelay:     time.Duration(viper.GetInt("queue_retry_max_delay")) * time.Second,
+	}
+}
+
 // ConnectToQueue uses the given connection to connect to the queue with the given queue name
 func ConnectToQueue(mq lanternmq.MessageQueue, ch lanternmq.ChannelID, qName string) (lanternmq.MessageQueue, lanternmq.ChannelID, error) {
 	exists, err := mq.QueueExists(ch, qName)
@@ -32,13 +74,40 @@ func ConnectToQueue(mq lanternmq.MessageQueue, ch lanternmq.ChannelID, qName str
 		return nil, nil, err
 	}
 	if !exists {
-		return nil, nil, errors.Errorf("queue %s does not exist", qName)
+		// RabbitMQ queues are declared by its definitions file. The PostgreSQL and in-memory queues have no such
+		// file, so they are declared by the first service that connects to them.
+		switch declarer := mq.(type) {
+		case *postgres.MessageQueue:
+			err = declarer.DeclareQueue(ch, qName)
+		case *memory.MessageQueue:
+			err = declarer.DeclareQueue(ch, qName)
+		default:
+			return nil, nil, errors.Errorf("queue %s does not exist", qName)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if rabbitMQ, ok := mq.(*rabbitmq.MessageQueue); ok && rabbitMQ.RetryPolicy != nil {
+		// messages published to a queue that doesn't exist are dropped, so make sure that failed messages have
+		// somewhere to go
+		for _, name := range append(lanternmq.RetryQueueNames(qName), lanternmq.DeadLetterQueueName(qName)) {
+			exists, err = mq.QueueExists(ch, name)
+			if err != nil {
+				return nil, nil, err
+			}
+			if !exists {
+				return nil, nil, errors.Errorf("queue %s does not exist", name)
+			}
+		}
 	}
 
 	return mq, ch, nil
 }
 
-// SendToQueue publishes a message to the given queue
+// SendToQueue publishes a message to the given queue. It returns once the queueing service has accepted the
+// message, so a nil error means that the message won't be lost if the service restarts.
 func SendToQueue(
 	ctx context.Context,
 	message string,
@@ -2,12 +2,16 @@ package accessqueue
 
 import (
 	"context"
+	"fmt"
 	"testing"
+	"time"
 
 	th "github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/testhelper"
 	"github.com/onc-healthit/lantern-back-end/lanternmq"
+	"github.com/onc-healthit/lantern-back-end/lanternmq/memory"
 	"github.com/onc-healthit/lantern-back-end/lanternmq/mock"
 	"github.com/pkg/errors"
+	"github.com/spf13/viper"
 )
 
 func Test_SendToQueue(t *testing.T) {
@@ -40,3 +44,57 @@ func Test_SendToQueue(t *testing.T) {
 	err = SendToQueue(ctx, message, &mq, &ch, queueName)
 	th.Assert(t, errors.Cause(err) == context.Canceled, "expected persistProducts to error out due to context ending")
 }
+
+func Test_ConnectToServerAndQueueUnknownDriver(t *testing.T) {
+	driver := viper.GetString("queue_driver")
+	defer viper.Set("queue_driver", driver)
+
+	viper.Set("queue_driver", "kafka")
+	_, _, err := ConnectToServerAndQueue("user", "pass", "localhost", "5672", "queue name")
+	th.Assert(t, err != nil, "expected an error for an unknown queue driver")
+	th.Assert(t, err.Error() == "unknown queue driver kafka", fmt.Sprintf("unexpected error %s", err))
+}
+
+func Test_ConnectToServerAndQueueMemory(t *testing.T) {
+	driver := viper.GetString("queue_driver")
+	defer viper.Set("queue_driver", driver)
+
+	viper.Set("queue_driver", "memory")
+	qName := "accessqueue-memory-test"
+
+	// the queue is declared by the first service that connects to it
+	sender, senderCh, err := ConnectToServerAndQueue("user", "pass", "localhost", "5672", qName)
+	th.Assert(t, err == nil, err)
+	defer sender.Close()
+	_, ok := sender.(*memory.MessageQueue)
+	th.Assert(t, ok, fmt.Sprintf("expected an in-memory message queue, got %T", sender))
+
+	// a second service connects to the same queue
+	receiver, receiverCh, err := ConnectToServerAndQueue("user", "pass", "localhost", "5672", qName)
+	th.Assert(t, err == nil, err)
+	defer receiver.Close()
+
+	err = SendToQueue(context.Background(), "this is a message", &sender, &senderCh, qName)
+	th.Assert(t, err == nil, err)
+	count, err := memory.DefaultBroker.MessageCount(qName)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, count == 1, fmt.Sprintf("expected 1 message in the queue, got %d", count))
+
+	msgs, err := receiver.ConsumeFromQueue(receiverCh, qName)
+	th.Assert(t, err == nil, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	received := make(chan string, 1)
+	handler := func(message []byte, args *map[string]interface{}) error {
+		received <- string(message)
+		return nil
+	}
+	go receiver.ProcessMessages(ctx, msgs, handler, nil, make(chan error))
+
+	select {
+	case message := <-received:
+		th.Assert(t, message == "this is a message", fmt.Sprintf("expected the sent message, got %s", message))
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the message to be received")
+	}
+}
@@ -0,0 +1,572 @@
+package postgres
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/onc-healthit/lantern-back-end/lanternmq"
+)
+
+// Ensure MessageQueue implements lanternmq.MessageQueue.
+var _ lanternmq.MessageQueue = &MessageQueue{}
+
+// Ensure Messages implements lanternmq.Messages.
+var _ lanternmq.Messages = &Messages{}
+
+// notifyChannel is the channel that the name of a queue is sent on when a message is put on the queue
+const notifyChannel = "lantern_mq"
+
+// pollInterval is how often a consumer without a notification checks its queue. Notifications are not sent when
+// a message's visibility timeout expires, and they are lost while the listener is reconnecting.
+var pollInterval = 5 * time.Second
+
+// MessageQueue implements the lanternmq.MessageQueue interface with tables in the Lantern PostgreSQL database, so
+// that Lantern can run without a RabbitMQ service. It allows the user to:
+// * connect to the database
+// * create a channel
+// * state how many messages a consumer can have delivered but not yet acknowledged
+// * declare a queue, and send and receive from that queue
+// * declare an exchange, and send and receive from that exchange
+//   - potential exchange options are: 'direct', 'topic', and 'fanout'
+//
+// * close the MessageQueue, which includes canceling its consumers, deleting the exclusive queues it declared and
+// closing its connections to the database.
+//
+// Consumers claim messages with SELECT ... FOR UPDATE SKIP LOCKED, so several processes can consume from the same
+// queue, and they are woken up with LISTEN/NOTIFY when messages are published. A claimed message is hidden from
+// other consumers for the visibility timeout and is deleted when it is acknowledged. If it is not acknowledged in
+// time, for example because its consumer's process stopped, it is delivered again.
+type MessageQueue struct {
+	dbName            string
+	sslMode           string
+	visibilityTimeout time.Duration
+	// owner identifies the MessageQueue as the owner of the exclusive queues it declares
+	owner string
+
+	db       *sql.DB
+	listener *pq.Listener
+
+	mu        sync.Mutex
+	channels  []*channel
+	consumers []*consumer
+}
+
+// channel holds the prefetch count that consumers created on it are created with
+type channel struct {
+	prefetch int
+	closed   bool
+}
+
+// consumer delivers the messages of a queue one at a time to its deliveries channel. It claims a message only while
+// it has fewer than prefetch unacknowledged messages, or whenever it is ready if prefetch is 0.
+type consumer struct {
+	qName      string
+	prefetch   int
+	unacked    int
+	canceled   bool
+	wake       chan struct{}
+	done       chan struct{}
+	deliveries chan *delivery
+}
+
+type delivery struct {
+	id       int64
+	body     []byte
+	err      error
+	consumer *consumer
+}
+
+// Messages wraps the delivery channel of a consumer.
+type Messages struct {
+	consumer *consumer
+}
+
+// NewMessageQueue returns a MessageQueue that uses the tables of the database 'dbName', connecting with the
+// sslmode 'sslMode'. Messages that are not acknowledged within 'visibilityTimeout' of being delivered are delivered
+// again.
+func NewMessageQueue(dbName string, sslMode string, visibilityTimeout time.Duration) *MessageQueue {
+	return &MessageQueue{dbName: dbName, sslMode: sslMode, visibilityTimeout: visibilityTimeout}
+}
+
+// getChannel retrieves the channel provided by `id` by casting `id` back to an integer and retrieving the channel
+// at the corresponding index of MessageQueue.channels array.
+func (mq *MessageQueue) getChannel(id lanternmq.ChannelID) (*channel, error) {
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+
+	idInt, ok := id.(int)
+	if !ok {
+		return nil, errors.New("ChannelID not of correct type")
+	}
+	if idInt < 0 || idInt >= len(mq.channels) {
+		return nil, errors.New("no channel with the requested ID was found")
+	}
+	ch := mq.channels[idInt]
+	if ch.closed {
+		return nil, errors.New("the channel with the requested ID is closed")
+	}
+	return ch, nil
+}
+
+// Connect opens a connection to the database at the given location with the given credentials, and a listener for
+// the notifications of published messages.
+func (mq *MessageQueue) Connect(username string, password string, host string, port string) error {
+	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+		host, port, username, password, mq.dbName, mq.sslMode)
+	db, err := sql.Open("postgres", connStr)
+	if err != nil {
+		return errors.New("unable to connect to message queue")
+	}
+	err = db.Ping()
+	if err != nil {
+		db.Close()
+		return errors.New("unable to connect to message queue")
+	}
+
+	listener := pq.NewListener(connStr, time.Second, time.Minute, nil)
+	err = listener.Listen(notifyChannel)
+	if err != nil {
+		listener.Close()
+		db.Close()
+		return fmt.Errorf("unable to listen for messages: %s", err.Error())
+	}
+
+	owner := make([]byte, 8)
+	_, err = rand.Read(owner)
+	if err != nil {
+		listener.Close()
+		db.Close()
+		return err
+	}
+
+	mq.db = db
+	mq.listener = listener
+	mq.owner = hex.EncodeToString(owner)
+	go mq.dispatchNotifications()
+
+	return nil
+}
+
+// dispatchNotifications wakes up the consumers of each queue that a message is published on. A nil notification
+// means the listener reconnected and notifications may have been missed, so every consumer is woken up.
+func (mq *MessageQueue) dispatchNotifications() {
+	for n := range mq.listener.Notify {
+		mq.mu.Lock()
+		for _, c := range mq.consumers {
+			if n == nil || n.Extra == c.qName {
+				c.signal()
+			}
+		}
+		mq.mu.Unlock()
+	}
+}
+
+// signal wakes up the consumer if it is waiting for a message or for an acknowledgement
+func (c *consumer) signal() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// CreateChannel creates a channel for the database that has already been connected to. If the database has not
+// been connected to already, an error is thrown. The channel's ID is returned.
+func (mq *MessageQueue) CreateChannel() (lanternmq.ChannelID, error) {
+	if mq.db == nil {
+		return "", errors.New("connection must exist before creating a channel")
+	}
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+
+	mq.channels = append(mq.channels, &channel{})
+	return lanternmq.ChannelID(len(mq.channels) - 1), nil
+}
+
+// NumConcurrentMsgs defines how many messages each consumer created on the channel afterwards can have delivered
+// but not yet acknowledged, in the same way as RabbitMQ's per-consumer prefetch count. 0 means no limit.
+func (mq *MessageQueue) NumConcurrentMsgs(chID lanternmq.ChannelID, num int) error {
+	ch, err := mq.getChannel(chID)
+	if err != nil {
+		return err
+	}
+	if num < 0 {
+		return errors.New("unable to set the number of concurrent messages that can be handled")
+	}
+	mq.mu.Lock()
+	ch.prefetch = num
+	mq.mu.Unlock()
+	return nil
+}
+
+// QueueExists checks whether or not a queue already exists. If so, it returns (true, nil). If not,
+// it returns (false, nil). If an error is encountered, it returns (false, err).
+func (mq *MessageQueue) QueueExists(chID lanternmq.ChannelID, qName string) (bool, error) {
+	_, err := mq.getChannel(chID)
+	if err != nil {
+		return false, err
+	}
+
+	var exists bool
+	row := mq.db.QueryRow("SELECT EXISTS (SELECT 1 FROM mq_queues WHERE name = $1)", qName)
+	err = row.Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("error determining if queue exists: %s", err.Error())
+	}
+	return exists, nil
+}
+
+// DeclareQueue creates a queue with the given name if one does not exist.
+func (mq *MessageQueue) DeclareQueue(chID lanternmq.ChannelID, qName string) error {
+	_, err := mq.getChannel(chID)
+	if err != nil {
+		return err
+	}
+
+	_, err = mq.db.Exec("INSERT INTO mq_queues (name) VALUES ($1) ON CONFLICT (name) DO NOTHING", qName)
+	if err != nil {
+		return fmt.Errorf("unable to create queue: %s", err.Error())
+	}
+	return nil
+}
+
+// PublishToQueue publishes 'message' on the queue with name 'qName'. As with RabbitMQ, a message published to a
+// queue that does not exist is dropped.
+func (mq *MessageQueue) PublishToQueue(chID lanternmq.ChannelID, qName string, message string) error {
+	_, err := mq.getChannel(chID)
+	if err != nil {
+		return err
+	}
+	return mq.publish([]string{qName}, message)
+}
+
+// publish puts 'message' on each of the queues that exists and notifies their consumers. The notifications are
+// sent when the statement commits.
+func (mq *MessageQueue) publish(qNames []string, message string) error {
+	if len(qNames) == 0 {
+		return nil
+	}
+	_, err := mq.db.Exec(`
+		WITH inserted AS (
+			INSERT INTO mq_messages (queue_name, body)
+			SELECT name, $2 FROM mq_queues WHERE name = ANY($1)
+			RETURNING queue_name)
+		SELECT pg_notify($3, queue_name) FROM (SELECT DISTINCT queue_name FROM inserted) AS queues`,
+		pq.Array(qNames), message, notifyChannel)
+	if err != nil {
+		return fmt.Errorf("unable to publish message: %s", err.Error())
+	}
+	return nil
+}
+
+// ConsumeFromQueue opens a receive channel for the messages on the queue with name 'qName'. The messages are
+// delivered until the consumer is canceled by ProcessMessages returning or by the MessageQueue being closed.
+func (mq *MessageQueue) ConsumeFromQueue(chID lanternmq.ChannelID, qName string) (lanternmq.Messages, error) {
+	ch, err := mq.getChannel(chID)
+	if err != nil {
+		return nil, err
+	}
+	exists, err := mq.QueueExists(chID, qName)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("queue %s does not exist", qName)
+	}
+
+	mq.mu.Lock()
+	c := &consumer{
+		qName:      qName,
+		prefetch:   ch.prefetch,
+		wake:       make(chan struct{}, 1),
+		done:       make(chan struct{}),
+		deliveries: make(chan *delivery),
+	}
+	mq.consumers = append(mq.consumers, c)
+	mq.mu.Unlock()
+
+	go mq.deliver(c)
+
+	return &Messages{consumer: c}, nil
+}
+
+// deliver claims the messages of the consumer's queue and sends them to its deliveries channel until the consumer
+// is canceled, and then closes the deliveries channel.
+func (mq *MessageQueue) deliver(c *consumer) {
+	defer close(c.deliveries)
+
+	for {
+		mq.mu.Lock()
+		full := c.prefetch > 0 && c.unacked >= c.prefetch
+		mq.mu.Unlock()
+		if full {
+			select {
+			case <-c.wake:
+				continue
+			case <-c.done:
+				return
+			}
+		}
+
+		d := &delivery{consumer: c}
+		row := mq.db.QueryRow(`
+			UPDATE mq_messages SET visible_at = NOW() + make_interval(secs => $2), delivery_count = delivery_count + 1
+			WHERE id = (
+				SELECT id FROM mq_messages WHERE queue_name = $1 AND visible_at <= NOW()
+				ORDER BY id LIMIT 1 FOR UPDATE SKIP LOCKED)
+			RETURNING id, body`,
+			c.qName, mq.visibilityTimeout.Seconds())
+		err := row.Scan(&d.id, &d.body)
+		if err == sql.ErrNoRows {
+			select {
+			case <-c.wake:
+			case <-time.After(pollInterval):
+			case <-c.done:
+				return
+			}
+			continue
+		} else if err != nil {
+			d.err = fmt.Errorf("unable to receive message from queue %s: %s", c.qName, err.Error())
+		} else {
+			mq.mu.Lock()
+			c.unacked++
+			mq.mu.Unlock()
+		}
+
+		select {
+		case c.deliveries <- d:
+		case <-c.done:
+			if d.err == nil {
+				// the message was never received, so it is made visible again for another consumer
+				mq.release(d)
+			}
+			return
+		}
+		if d.err != nil {
+			select {
+			case <-time.After(pollInterval):
+			case <-c.done:
+				return
+			}
+		}
+	}
+}
+
+// ack deletes the delivered message, which lets its consumer claim another one
+func (mq *MessageQueue) ack(d *delivery) error {
+	_, err := mq.db.Exec("DELETE FROM mq_messages WHERE id = $1", d.id)
+
+	mq.mu.Lock()
+	d.consumer.unacked--
+	d.consumer.signal()
+	mq.mu.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("unable to acknowledge message: %s", err.Error())
+	}
+	return nil
+}
+
+// release makes a claimed message visible again and notifies the other consumers of its queue
+func (mq *MessageQueue) release(d *delivery) {
+	_, _ = mq.db.Exec(`
+		WITH released AS (
+			UPDATE mq_messages SET visible_at = NOW() WHERE id = $1 RETURNING queue_name)
+		SELECT pg_notify($2, queue_name) FROM released`,
+		d.id, notifyChannel)
+
+	mq.mu.Lock()
+	d.consumer.unacked--
+	mq.mu.Unlock()
+}
+
+// cancel stops the consumer from claiming messages. It must be called while mq.mu is locked.
+func (mq *MessageQueue) cancel(c *consumer) {
+	if c.canceled {
+		return
+	}
+	c.canceled = true
+	close(c.done)
+	for i, other := range mq.consumers {
+		if other == c {
+			mq.consumers = append(mq.consumers[:i], mq.consumers[i+1:]...)
+			break
+		}
+	}
+}
+
+// ProcessMessages takes 'msgs', which wraps the delivery channel of a consumer, and provides each message along
+// with 'args' to the lanternmq.MessageHandler 'handler'. Each message is acknowledged after it is processed. If
+// there's an error processing or acknowledging a message, the error is sent to the 'errs' channel. When 'ctx' is
+// done, the consumer is canceled and ProcessMessages returns.
+// ProcessMessages should be called as a goroutine. Example:
+//
+//	go mq.ProcessMessages(ctx, msgs, handler, nil, errs)
+func (mq *MessageQueue) ProcessMessages(ctx context.Context, msgs lanternmq.Messages, handler lanternmq.MessageHandler, args *map[string]interface{}, errs chan<- error) {
+	msgsd, ok := msgs.(*Messages)
+	if !ok {
+		errs <- errors.New("the messages are of the wrong type")
+		return
+	}
+
+	defer func() {
+		mq.mu.Lock()
+		mq.cancel(msgsd.consumer)
+		mq.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case d, ok := <-msgsd.consumer.deliveries:
+			if !ok {
+				return
+			}
+			if d.err != nil {
+				errs <- d.err
+				continue
+			}
+			err := handler(d.body, args)
+			if err != nil {
+				errs <- err
+			}
+			err = mq.ack(d)
+			if err != nil {
+				errs <- err
+			}
+		}
+	}
+}
+
+// DeclareExchange creates an exchange named 'name' of type 'exchangeType' if one does not exist. The exchange
+// types 'direct', 'topic' and 'fanout' are supported. As with RabbitMQ, declaring an existing exchange with a
+// different type is an error.
+func (mq *MessageQueue) DeclareExchange(chID lanternmq.ChannelID, name string, exchangeType string) error {
+	_, err := mq.getChannel(chID)
+	if err != nil {
+		return err
+	}
+	if !lanternmq.SupportedExchangeType(exchangeType) {
+		return errors.New("unable to declare target")
+	}
+
+	_, err = mq.db.Exec("INSERT INTO mq_exchanges (name, exchange_type) VALUES ($1, $2) ON CONFLICT (name) DO NOTHING", name, exchangeType)
+	if err != nil {
+		return errors.New("unable to declare target")
+	}
+	var existingType string
+	err = mq.db.QueryRow("SELECT exchange_type FROM mq_exchanges WHERE name = $1", name).Scan(&existingType)
+	if err != nil || existingType != exchangeType {
+		return errors.New("unable to declare target")
+	}
+	return nil
+}
+
+// PublishToExchange sends 'message' to the exchange 'name' with routing key 'routingKey', which puts the message
+// on each queue bound to the exchange with a matching routing key. The exchange "" is the default exchange, which
+// routes the message to the queue named 'routingKey'.
+func (mq *MessageQueue) PublishToExchange(chID lanternmq.ChannelID, name string, routingKey string, message string) error {
+	_, err := mq.getChannel(chID)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return mq.publish([]string{routingKey}, message)
+	}
+
+	var exchangeType string
+	err = mq.db.QueryRow("SELECT exchange_type FROM mq_exchanges WHERE name = $1", name).Scan(&exchangeType)
+	if err != nil {
+		return fmt.Errorf("unable to publish to target %s with routing key %s", name, routingKey)
+	}
+
+	rows, err := mq.db.Query("SELECT queue_name, routing_key FROM mq_bindings WHERE exchange_name = $1", name)
+	if err != nil {
+		return fmt.Errorf("unable to publish to target %s with routing key %s", name, routingKey)
+	}
+	defer rows.Close()
+
+	var qNames []string
+	for rows.Next() {
+		var qName, bindingKey string
+		err = rows.Scan(&qName, &bindingKey)
+		if err != nil {
+			return fmt.Errorf("unable to publish to target %s with routing key %s", name, routingKey)
+		}
+		if lanternmq.RoutingKeyMatches(exchangeType, bindingKey, routingKey) {
+			qNames = append(qNames, qName)
+		}
+	}
+	if rows.Err() != nil {
+		return fmt.Errorf("unable to publish to target %s with routing key %s", name, routingKey)
+	}
+
+	return mq.publish(qNames, message)
+}
+
+// DeclareExchangeReceiveQueue creates a queue named 'qName' to receive messages from the exchange named
+// 'exchangeName' with routing key 'routingKey'. As with RabbitMQ, the queue is exclusive to the MessageQueue and is
+// deleted when the MessageQueue is closed.
+func (mq *MessageQueue) DeclareExchangeReceiveQueue(chID lanternmq.ChannelID, exchangeName string, qName string, routingKey string) error {
+	_, err := mq.getChannel(chID)
+	if err != nil {
+		return err
+	}
+
+	var exchangeExists bool
+	err = mq.db.QueryRow("SELECT EXISTS (SELECT 1 FROM mq_exchanges WHERE name = $1)", exchangeName).Scan(&exchangeExists)
+	if err != nil || !exchangeExists {
+		return fmt.Errorf("unable to bind queue %s to target %s with routing key %s", qName, exchangeName, routingKey)
+	}
+
+	_, err = mq.db.Exec("INSERT INTO mq_queues (name, exclusive_owner) VALUES ($1, $2) ON CONFLICT (name) DO NOTHING", qName, mq.owner)
+	if err != nil {
+		return fmt.Errorf("unable to create queue: %s", err.Error())
+	}
+	var owner sql.NullString
+	err = mq.db.QueryRow("SELECT exclusive_owner FROM mq_queues WHERE name = $1", qName).Scan(&owner)
+	if err != nil {
+		return fmt.Errorf("unable to create queue: %s", err.Error())
+	}
+	if owner.Valid && owner.String != mq.owner {
+		return fmt.Errorf("unable to create queue: queue %s is exclusive to another connection", qName)
+	}
+
+	_, err = mq.db.Exec(`
+		INSERT INTO mq_bindings (exchange_name, queue_name, routing_key) VALUES ($1, $2, $3)
+		ON CONFLICT (exchange_name, queue_name, routing_key) DO NOTHING`,
+		exchangeName, qName, routingKey)
+	if err != nil {
+		return fmt.Errorf("unable to bind queue %s to target %s with routing key %s", qName, exchangeName, routingKey)
+	}
+	return nil
+}
+
+// Close cancels the consumers of each channel that's been created, deletes the exclusive queues that the
+// MessageQueue declared along with their messages, and closes the connections to the database. Messages that were
+// delivered but not yet acknowledged are delivered again once their visibility timeout expires.
+func (mq *MessageQueue) Close() {
+	mq.mu.Lock()
+	for len(mq.consumers) > 0 {
+		mq.cancel(mq.consumers[0])
+	}
+	for _, ch := range mq.channels {
+		ch.closed = true
+	}
+	mq.mu.Unlock()
+
+	if mq.db != nil {
+		_, _ = mq.db.Exec("DELETE FROM mq_queues WHERE exclusive_owner = $1", mq.owner)
+		mq.db.Close()
+	}
+	if mq.listener != nil {
+		mq.listener.Close()
+	}
+}
@@ -0,0 +1,216 @@
+//go:build integration
+// +build integration
+
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	th "github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/testhelper"
+	"github.com/onc-healthit/lantern-back-end/lanternmq"
+	"github.com/spf13/viper"
+)
+
+func TestMain(m *testing.M) {
+	err := setupConfigForTests()
+	if err != nil {
+		panic(err)
+	}
+
+	hap := th.HostAndPort{Host: viper.GetString("dbhost"), Port: viper.GetString("dbport")}
+	err = th.CheckResources(hap)
+	if err != nil {
+		panic(err)
+	}
+
+	os.Exit(m.Run())
+}
+
+func Test_PublishAndConsumeFromQueue(t *testing.T) {
+	mq, chID := connect(t, time.Minute)
+	defer mq.Close()
+
+	qName := "test-pg-queue"
+	err := mq.DeclareQueue(chID, qName)
+	th.Assert(t, err == nil, err)
+	defer deleteQueue(t, qName)
+
+	exists, err := mq.QueueExists(chID, qName)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, exists, "expected the queue to exist")
+
+	for i := 0; i < 3; i++ {
+		err = mq.PublishToQueue(chID, qName, fmt.Sprintf("message %d", i))
+		th.Assert(t, err == nil, err)
+	}
+
+	received := receive(t, mq, chID, qName, 3)
+	for i, msg := range received {
+		th.Assert(t, msg == fmt.Sprintf("message %d", i), fmt.Sprintf("expected 'message %d', got '%s'", i, msg))
+	}
+
+	// acknowledged messages are deleted
+	th.Assert(t, countMessages(t, mq.db, qName) == 0, "expected the acknowledged messages to be deleted")
+}
+
+func Test_VisibilityTimeout(t *testing.T) {
+	mq, chID := connect(t, time.Second)
+	defer mq.Close()
+
+	qName := "test-pg-visibility"
+	err := mq.DeclareQueue(chID, qName)
+	th.Assert(t, err == nil, err)
+	defer deleteQueue(t, qName)
+
+	err = mq.PublishToQueue(chID, qName, "message")
+	th.Assert(t, err == nil, err)
+
+	// claim the message as a consumer that stopped before acknowledging it would have
+	var id int64
+	row := mq.db.QueryRow(`
+		UPDATE mq_messages SET visible_at = NOW() + INTERVAL '1 second', delivery_count = delivery_count + 1
+		WHERE queue_name = $1 RETURNING id`, qName)
+	err = row.Scan(&id)
+	th.Assert(t, err == nil, err)
+
+	received := receive(t, mq, chID, qName, 1)
+	th.Assert(t, received[0] == "message", fmt.Sprintf("expected 'message', got '%s'", received[0]))
+
+	var count int
+	err = mq.db.QueryRow("SELECT COUNT(*) FROM mq_messages WHERE id = $1", id).Scan(&count)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, count == 0, "expected the redelivered message to be acknowledged")
+}
+
+func Test_PublishToExchange(t *testing.T) {
+	mq, chID := connect(t, time.Minute)
+	defer mq.Close()
+
+	exName := "test-pg-exchange"
+	err := mq.DeclareExchange(chID, exName, "topic")
+	th.Assert(t, err == nil, err)
+	defer deleteExchange(t, exName)
+
+	// redeclaring with another type fails
+	err = mq.DeclareExchange(chID, exName, "fanout")
+	th.Assert(t, err != nil, "expected an error redeclaring the exchange with another type")
+
+	err = mq.DeclareExchangeReceiveQueue(chID, exName, "test-pg-logs", "logs.*")
+	th.Assert(t, err == nil, err)
+	err = mq.DeclareExchangeReceiveQueue(chID, exName, "test-pg-all", "#")
+	th.Assert(t, err == nil, err)
+
+	err = mq.PublishToExchange(chID, exName, "logs.error", "error message")
+	th.Assert(t, err == nil, err)
+	err = mq.PublishToExchange(chID, exName, "metrics.cpu", "metrics message")
+	th.Assert(t, err == nil, err)
+
+	th.Assert(t, countMessages(t, mq.db, "test-pg-logs") == 1, "expected one message on the logs queue")
+	th.Assert(t, countMessages(t, mq.db, "test-pg-all") == 2, "expected two messages on the catch-all queue")
+
+	received := receive(t, mq, chID, "test-pg-logs", 1)
+	th.Assert(t, received[0] == "error message", fmt.Sprintf("expected 'error message', got '%s'", received[0]))
+
+	// the exclusive queues are deleted when the MessageQueue is closed
+	mq.Close()
+	var count int
+	err = openDB(t).QueryRow("SELECT COUNT(*) FROM mq_queues WHERE name IN ('test-pg-logs', 'test-pg-all')").Scan(&count)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, count == 0, fmt.Sprintf("expected the exclusive queues to be deleted, %d remain", count))
+}
+
+func connect(t *testing.T, visibilityTimeout time.Duration) (*MessageQueue, lanternmq.ChannelID) {
+	mq := NewMessageQueue(viper.GetString("dbname"), viper.GetString("dbsslmode"), visibilityTimeout)
+	err := mq.Connect(viper.GetString("dbuser"), viper.GetString("dbpassword"), viper.GetString("dbhost"), viper.GetString("dbport"))
+	th.Assert(t, err == nil, err)
+	chID, err := mq.CreateChannel()
+	th.Assert(t, err == nil, err)
+	return mq, chID
+}
+
+func openDB(t *testing.T) *sql.DB {
+	psqlInfo := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+		viper.GetString("dbhost"), viper.GetString("dbport"), viper.GetString("dbuser"),
+		viper.GetString("dbpassword"), viper.GetString("dbname"), viper.GetString("dbsslmode"))
+	db, err := sql.Open("postgres", psqlInfo)
+	th.Assert(t, err == nil, err)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// receive consumes 'num' messages from the queue and returns them in the order they were received
+func receive(t *testing.T, mq *MessageQueue, chID lanternmq.ChannelID, qName string, num int) []string {
+	msgs, err := mq.ConsumeFromQueue(chID, qName)
+	th.Assert(t, err == nil, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	received := make(chan string, num)
+	errs := make(chan error, num)
+	handler := func(msg []byte, _ *map[string]interface{}) error {
+		received <- string(msg)
+		return nil
+	}
+	go mq.ProcessMessages(ctx, msgs, handler, nil, errs)
+
+	var result []string
+	for len(result) < num {
+		select {
+		case msg := <-received:
+			result = append(result, msg)
+		case err := <-errs:
+			t.Fatal(err)
+		case <-time.After(10 * time.Second):
+			t.Fatalf("expected %d messages, received %d", num, len(result))
+		}
+	}
+	// give ProcessMessages time to acknowledge the last message
+	time.Sleep(100 * time.Millisecond)
+	return result
+}
+
+func countMessages(t *testing.T, db *sql.DB, qName string) int {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM mq_messages WHERE queue_name = $1", qName).Scan(&count)
+	th.Assert(t, err == nil, err)
+	return count
+}
+
+// deleteQueue deletes the queue along with its messages. The MessageQueue may be closed already.
+func deleteQueue(t *testing.T, qName string) {
+	_, err := openDB(t).Exec("DELETE FROM mq_queues WHERE name = $1", qName)
+	th.Assert(t, err == nil, err)
+}
+
+// deleteExchange deletes the exchange along with its bindings
+func deleteExchange(t *testing.T, name string) {
+	_, err := openDB(t).Exec("DELETE FROM mq_exchanges WHERE name = $1", name)
+	th.Assert(t, err == nil, err)
+}
+
+func setupConfigForTests() error {
+	viper.SetEnvPrefix("lantern_test")
+	viper.AutomaticEnv()
+
+	for _, key := range []string{"dbhost", "dbport", "dbuser", "dbpassword", "dbname", "dbsslmode"} {
+		err := viper.BindEnv(key)
+		if err != nil {
+			return err
+		}
+	}
+
+	viper.SetDefault("dbhost", "localhost")
+	viper.SetDefault("dbport", "5432")
+	viper.SetDefault("dbuser", "lantern")
+	viper.SetDefault("dbpassword", "postgrespassword")
+	viper.SetDefault("dbname", "lantern_test")
+	viper.SetDefault("dbsslmode", "disable")
+
+	return nil
+}
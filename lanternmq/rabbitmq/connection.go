@@ -0,0 +1,361 @@
+package rabbitmq
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/onc-healthit/lantern-back-end/lanternmq"
+	log "github.com/sirupsen/logrus"
+	"github.com/streadway/amqp"
+)
+
+// reconnectDelay is how long to wait before the first attempt to reconnect to the RabbitMQ service. The delay is
+// doubled after each failed attempt up to maxReconnectDelay.
+var reconnectDelay = time.Second
+var maxReconnectDelay = 30 * time.Second
+
+// confirmTimeout is how long to wait for the RabbitMQ service to confirm a published message, and how long a
+// publish waits for the connection to be recovered before trying again.
+var confirmTimeout = 30 * time.Second
+
+// publishAttempts is how many times a message is published before giving up when the connection is lost.
+const publishAttempts = 3
+
+// amqpConnection is the part of *amqp.Connection that the MessageQueue uses, so that the tests can stand in for
+// the RabbitMQ service.
+type amqpConnection interface {
+	Channel() (*amqp.Channel, error)
+	NotifyClose(receiver chan *amqp.Error) chan *amqp.Error
+	IsClosed() bool
+	Close() error
+}
+
+// dialAMQP opens a connection to the RabbitMQ service at 'url'. It is replaced in the tests.
+var dialAMQP = func(url string) (amqpConnection, error) {
+	return amqp.Dial(url)
+}
+
+// channel is a channel to the RabbitMQ service that is reopened with the same settings and consumers when it or
+// the connection is lost.
+type channel struct {
+	// publishMu allows one message at a time to be published on the channel, so that each confirmation is
+	// matched with the message that it confirms.
+	publishMu sync.Mutex
+	// current is the open AMQP channel. It is guarded by MessageQueue.mu.
+	current   *confirmChannel
+	prefetch  int
+	consumers []*consumer
+}
+
+// confirmChannel is an AMQP channel in confirm mode along with the confirmations of the messages published on it.
+type confirmChannel struct {
+	*amqp.Channel
+	// publish publishes a message on the channel. It is the channel's Publish method outside of the tests.
+	publish  func(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+	confirms chan amqp.Confirmation
+	// published is the number of messages published on the channel, which is the delivery tag of the last one.
+	// It is guarded by channel.publishMu.
+	published uint64
+}
+
+// consumer delivers the messages of a queue to ProcessMessages. Its deliveries channel stays the same when the
+// consumer is resubscribed after the connection is lost.
+type consumer struct {
+	queue      string
+	deliveries chan amqp.Delivery
+}
+
+// declaration is a queue, exchange or binding that's been declared, which is declared again after reconnecting so
+// that the queues that are only declared by the services exist on the RabbitMQ service that is reconnected to.
+type declaration struct {
+	key     string
+	declare func(ch *amqp.Channel) error
+}
+
+// dial opens a connection to the RabbitMQ service and returns the channel that the connection's error is sent on
+// when it's lost. It must be called while mq.mu is locked.
+func (mq *MessageQueue) dial() (chan *amqp.Error, error) {
+	conn, err := dialAMQP(mq.url)
+	if err != nil {
+		return nil, err
+	}
+	mq.connection = conn
+	return conn.NotifyClose(make(chan *amqp.Error, 1)), nil
+}
+
+// watchConnection reconnects to the RabbitMQ service when the connection is lost, unless the MessageQueue has
+// been closed.
+func (mq *MessageQueue) watchConnection(closes chan *amqp.Error) {
+	amqpErr := <-closes
+
+	mq.mu.Lock()
+	if mq.closed {
+		mq.mu.Unlock()
+		return
+	}
+	mq.connected = make(chan struct{})
+	mq.mu.Unlock()
+
+	log.Warnf("lost connection to message queue: %v", amqpErr)
+
+	delay := reconnectDelay
+	for {
+		select {
+		case <-mq.done:
+			return
+		case <-time.After(delay):
+		}
+
+		err := mq.reconnect()
+		if err == nil {
+			log.Info("reconnected to message queue")
+			return
+		}
+		log.Warnf("unable to reconnect to message queue, trying again in %s: %s", delay, err)
+
+		delay *= 2
+		if delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+// reconnect opens a new connection to the RabbitMQ service, declares the queues, exchanges and bindings that had
+// been declared again, and reopens each channel along with its consumers.
+func (mq *MessageQueue) reconnect() error {
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+	if mq.closed {
+		return nil
+	}
+
+	closes, err := mq.dial()
+	if err != nil {
+		return err
+	}
+
+	err = mq.redeclare()
+	if err == nil {
+		for _, c := range mq.channels {
+			err = mq.openChannel(c)
+			if err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		mq.connection.Close()
+		return err
+	}
+
+	go mq.watchConnection(closes)
+	close(mq.connected)
+	return nil
+}
+
+// redeclare declares each queue, exchange and binding that's been declared on a temporary channel. It must be
+// called while mq.mu is locked.
+func (mq *MessageQueue) redeclare() error {
+	if len(mq.declarations) == 0 {
+		return nil
+	}
+
+	ch, err := mq.connection.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	for _, d := range mq.declarations {
+		err = d.declare(ch)
+		if err != nil {
+			return fmt.Errorf("unable to declare %s: %s", d.key, err.Error())
+		}
+	}
+	return nil
+}
+
+// addDeclaration records a declaration so that it's declared again after reconnecting
+func (mq *MessageQueue) addDeclaration(key string, declare func(ch *amqp.Channel) error) {
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+	for _, d := range mq.declarations {
+		if d.key == key {
+			return
+		}
+	}
+	mq.declarations = append(mq.declarations, declaration{key: key, declare: declare})
+}
+
+// openChannel opens a new AMQP channel for 'c' in confirm mode with the channel's prefetch count and subscribes
+// the channel's consumers again. It must be called while mq.mu is locked.
+func (mq *MessageQueue) openChannel(c *channel) error {
+	ch, err := mq.connection.Channel()
+	if err != nil {
+		return err
+	}
+
+	if c.prefetch > 0 {
+		err = ch.Qos(c.prefetch, prefetchSize0, globalFalse)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = ch.Confirm(noWaitFalse)
+	if err != nil {
+		return err
+	}
+	// only one message at a time is waiting for a confirmation, but a confirmation that arrives after its
+	// publish timed out has to fit as well
+	confirms := ch.NotifyPublish(make(chan amqp.Confirmation, 2))
+	closes := ch.NotifyClose(make(chan *amqp.Error, 1))
+	c.current = &confirmChannel{Channel: ch, publish: ch.Publish, confirms: confirms}
+
+	for _, cons := range c.consumers {
+		deliveries, err := ch.Consume(
+			cons.queue,
+			"", // consumer
+			autoAckFalse,
+			exclusiveFalse,
+			noLocalFalse,
+			noWaitFalse,
+			nil, // args
+		)
+		if err != nil {
+			return err
+		}
+		mq.forward(cons, deliveries)
+	}
+
+	go mq.watchChannel(c, c.current, closes)
+	return nil
+}
+
+// watchChannel reopens the channel when its AMQP channel 'cc' is closed by an error, such as declaring a queue
+// that doesn't exist. Channels that are closed along with the connection are reopened when reconnecting.
+func (mq *MessageQueue) watchChannel(c *channel, cc *confirmChannel, closes chan *amqp.Error) {
+	amqpErr := <-closes
+	if amqpErr == nil {
+		return
+	}
+
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+	err := mq.reopenChannel(c, cc)
+	if err != nil {
+		log.Warnf("unable to reopen channel to message queue: %s", err)
+	}
+}
+
+// reopenChannel opens a new AMQP channel for 'c' if its AMQP channel is still 'cc', and the connection is open. It
+// must be called while mq.mu is locked.
+func (mq *MessageQueue) reopenChannel(c *channel, cc *confirmChannel) error {
+	if mq.closed || c.current != cc || mq.connection.IsClosed() {
+		return nil
+	}
+	return mq.openChannel(c)
+}
+
+// forward sends the deliveries of an AMQP consumer to the consumer's deliveries channel until the AMQP consumer
+// is closed or the MessageQueue is closed. It must be called while mq.mu is locked.
+func (mq *MessageQueue) forward(cons *consumer, deliveries <-chan amqp.Delivery) {
+	mq.forwarders.Add(1)
+	go func() {
+		defer mq.forwarders.Done()
+		for d := range deliveries {
+			select {
+			case cons.deliveries <- d:
+			case <-mq.done:
+				return
+			}
+		}
+	}()
+}
+
+// current returns the open AMQP channel of 'c'
+func (mq *MessageQueue) current(c *channel) *confirmChannel {
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+	return c.current
+}
+
+// publish publishes 'msg' to the exchange 'exchange' with the routing key 'key' over the channel with ID 'chID',
+// and returns once the RabbitMQ service has confirmed that it accepted the message. If the message can't be
+// published because the connection was lost, it is published again once the connection has been recovered.
+func (mq *MessageQueue) publish(chID lanternmq.ChannelID, exchange string, key string, msg amqp.Publishing) error {
+	c, err := mq.getChannel(chID)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = mq.publishAndConfirm(c, exchange, key, msg)
+		if err == nil || attempt == publishAttempts || !mq.waitForConnection() {
+			return err
+		}
+	}
+}
+
+// publishAndConfirm publishes 'msg' on the current AMQP channel of 'c' and waits for its confirmation
+func (mq *MessageQueue) publishAndConfirm(c *channel, exchange string, key string, msg amqp.Publishing) error {
+	c.publishMu.Lock()
+	defer c.publishMu.Unlock()
+
+	cc := mq.current(c)
+	err := cc.publish(
+		exchange,
+		key,
+		mandatoryFalse,
+		immediateFalse,
+		msg)
+	if err != nil {
+		return err
+	}
+	cc.published++
+
+	timeout := time.After(confirmTimeout)
+	for {
+		select {
+		case confirmation, ok := <-cc.confirms:
+			if !ok {
+				return errors.New("channel was closed before the message was confirmed")
+			}
+			if confirmation.DeliveryTag < cc.published {
+				// the confirmation of a message whose publish timed out
+				continue
+			}
+			if !confirmation.Ack {
+				return errors.New("message was not accepted by the message queue")
+			}
+			return nil
+		case <-timeout:
+			return errors.New("timed out waiting for the message queue to confirm the message")
+		}
+	}
+}
+
+// waitForConnection gives the connection time to be found lost, and then waits until it's been recovered. It
+// returns false if the connection wasn't recovered within confirmTimeout or the MessageQueue was closed.
+func (mq *MessageQueue) waitForConnection() bool {
+	select {
+	case <-mq.done:
+		return false
+	case <-time.After(reconnectDelay):
+	}
+
+	mq.mu.Lock()
+	connected := mq.connected
+	mq.mu.Unlock()
+
+	select {
+	case <-connected:
+		return true
+	case <-mq.done:
+		return false
+	case <-time.After(confirmTimeout):
+		return false
+	}
+}
@@ -0,0 +1,222 @@
+package rabbitmq
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	th "github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/testhelper"
+	"github.com/streadway/amqp"
+)
+
+// fakeConnection stands in for a connection to the RabbitMQ service
+type fakeConnection struct {
+	mu     sync.Mutex
+	closes chan *amqp.Error
+	closed bool
+}
+
+func (fc *fakeConnection) Channel() (*amqp.Channel, error) {
+	return nil, errors.New("the fake connection has no channels")
+}
+
+func (fc *fakeConnection) NotifyClose(receiver chan *amqp.Error) chan *amqp.Error {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.closes = receiver
+	return receiver
+}
+
+func (fc *fakeConnection) IsClosed() bool {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.closed
+}
+
+func (fc *fakeConnection) Close() error {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.closed = true
+	return nil
+}
+
+// confirmWith returns a channel whose publish sends 'confirmations' once the message has been published
+func confirmWith(confirmations ...amqp.Confirmation) *channel {
+	cc := &confirmChannel{confirms: make(chan amqp.Confirmation, len(confirmations)+1)}
+	cc.publish = func(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+		for _, confirmation := range confirmations {
+			cc.confirms <- confirmation
+		}
+		return nil
+	}
+	return &channel{current: cc}
+}
+
+func Test_publishAndConfirm(t *testing.T) {
+	defaultConfirmTimeout := confirmTimeout
+	defer func() { confirmTimeout = defaultConfirmTimeout }()
+	confirmTimeout = 50 * time.Millisecond
+
+	mq := &MessageQueue{}
+	msg := amqp.Publishing{Body: []byte("message")}
+
+	// accepted
+	c := confirmWith(amqp.Confirmation{DeliveryTag: 1, Ack: true})
+	err := mq.publishAndConfirm(c, "", "test-queue", msg)
+	th.Assert(t, err == nil, err)
+	th.Assert(t, c.current.published == 1, fmt.Sprintf("expected 1 published message, got %d", c.current.published))
+
+	// not accepted
+	c = confirmWith(amqp.Confirmation{DeliveryTag: 1, Ack: false})
+	err = mq.publishAndConfirm(c, "", "test-queue", msg)
+	th.Assert(t, err != nil && strings.Contains(err.Error(), "not accepted"), fmt.Sprintf("expected an error saying the message was not accepted, got %v", err))
+
+	// not confirmed in time
+	c = confirmWith()
+	err = mq.publishAndConfirm(c, "", "test-queue", msg)
+	th.Assert(t, err != nil && strings.Contains(err.Error(), "timed out"), fmt.Sprintf("expected an error saying the confirmation timed out, got %v", err))
+
+	// the confirmation of the message that timed out arrives before the confirmation of the next message, and is
+	// not mistaken for it
+	c = &channel{current: &confirmChannel{confirms: make(chan amqp.Confirmation, 2), published: 1}}
+	c.current.publish = func(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+		c.current.confirms <- amqp.Confirmation{DeliveryTag: 1, Ack: false}
+		c.current.confirms <- amqp.Confirmation{DeliveryTag: 2, Ack: true}
+		return nil
+	}
+	err = mq.publishAndConfirm(c, "", "test-queue", msg)
+	th.Assert(t, err == nil, fmt.Sprintf("expected the late confirmation of the earlier message to be skipped, got %v", err))
+	th.Assert(t, c.current.published == 2, fmt.Sprintf("expected 2 published messages, got %d", c.current.published))
+
+	// the channel is closed before the message is confirmed
+	c = &channel{current: &confirmChannel{confirms: make(chan amqp.Confirmation)}}
+	c.current.publish = func(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+		close(c.current.confirms)
+		return nil
+	}
+	err = mq.publishAndConfirm(c, "", "test-queue", msg)
+	th.Assert(t, err != nil && strings.Contains(err.Error(), "closed"), fmt.Sprintf("expected an error saying the channel was closed, got %v", err))
+
+	// the message can't be published
+	c = &channel{current: &confirmChannel{confirms: make(chan amqp.Confirmation)}}
+	c.current.publish = func(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+		return amqp.ErrClosed
+	}
+	err = mq.publishAndConfirm(c, "", "test-queue", msg)
+	th.Assert(t, err == amqp.ErrClosed, fmt.Sprintf("expected the publishing error, got %v", err))
+	th.Assert(t, c.current.published == 0, fmt.Sprintf("did not expect a message that wasn't published to be counted, got %d", c.current.published))
+}
+
+// fakeDialer fails the first 'failures' attempts to connect and then connects to a fakeConnection. It records
+// when each attempt was made.
+type fakeDialer struct {
+	mu        sync.Mutex
+	failures  int
+	attempts  []time.Time
+	conn      *fakeConnection
+	connected chan struct{}
+}
+
+func (fd *fakeDialer) dial(url string) (amqpConnection, error) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	fd.attempts = append(fd.attempts, time.Now())
+	if len(fd.attempts) <= fd.failures {
+		return nil, errors.New("connection refused")
+	}
+	close(fd.connected)
+	return fd.conn, nil
+}
+
+// setReconnectDelays shortens the delays between attempts to reconnect for the duration of a test
+func setReconnectDelays(t *testing.T, delay time.Duration, maxDelay time.Duration, dial func(url string) (amqpConnection, error)) {
+	defaultDelay, defaultMaxDelay, defaultDial := reconnectDelay, maxReconnectDelay, dialAMQP
+	t.Cleanup(func() {
+		reconnectDelay, maxReconnectDelay, dialAMQP = defaultDelay, defaultMaxDelay, defaultDial
+	})
+	reconnectDelay, maxReconnectDelay, dialAMQP = delay, maxDelay, dial
+}
+
+func Test_watchConnection(t *testing.T) {
+	fd := &fakeDialer{failures: 4, conn: &fakeConnection{}, connected: make(chan struct{})}
+	setReconnectDelays(t, 20*time.Millisecond, 40*time.Millisecond, fd.dial)
+
+	mq := &MessageQueue{done: make(chan struct{})}
+	defer close(mq.done)
+	closes := make(chan *amqp.Error, 1)
+	lost := time.Now()
+	closes <- amqp.ErrClosed
+	go mq.watchConnection(closes)
+
+	select {
+	case <-fd.connected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the connection to be recovered")
+	}
+
+	// the MessageQueue is connected again and watches the new connection
+	mq.mu.Lock()
+	connected := mq.connected
+	conn := mq.connection
+	mq.mu.Unlock()
+	select {
+	case <-connected:
+	case <-time.After(time.Second):
+		t.Fatal("expected the MessageQueue to be marked as connected")
+	}
+	th.Assert(t, conn == fd.conn, "expected the MessageQueue to use the new connection")
+	fd.conn.mu.Lock()
+	th.Assert(t, fd.conn.closes != nil, "expected the new connection to be watched")
+	fd.conn.mu.Unlock()
+
+	// the delay doubles after each failed attempt up to the maximum delay
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	th.Assert(t, len(fd.attempts) == 5, fmt.Sprintf("expected 5 attempts to connect, got %d", len(fd.attempts)))
+	expected := []time.Duration{20 * time.Millisecond, 40 * time.Millisecond, 40 * time.Millisecond, 40 * time.Millisecond, 40 * time.Millisecond}
+	previous := lost
+	for i, attempt := range fd.attempts {
+		waited := attempt.Sub(previous)
+		th.Assert(t, waited >= expected[i], fmt.Sprintf("expected attempt %d to wait at least %s, waited %s", i+1, expected[i], waited))
+		previous = attempt
+	}
+	// without the maximum the last attempt would have waited 320ms
+	last := fd.attempts[4].Sub(fd.attempts[3])
+	th.Assert(t, last < 300*time.Millisecond, fmt.Sprintf("expected the delay to be limited to the maximum delay, waited %s", last))
+}
+
+func Test_watchConnectionClosed(t *testing.T) {
+	fd := &fakeDialer{failures: 1000, conn: &fakeConnection{}, connected: make(chan struct{})}
+	setReconnectDelays(t, 10*time.Millisecond, 10*time.Millisecond, fd.dial)
+
+	// a MessageQueue that has been closed doesn't reconnect
+	mq := &MessageQueue{done: make(chan struct{}), closed: true}
+	closes := make(chan *amqp.Error, 1)
+	closes <- amqp.ErrClosed
+	mq.watchConnection(closes)
+	fd.mu.Lock()
+	th.Assert(t, len(fd.attempts) == 0, fmt.Sprintf("did not expect a closed MessageQueue to reconnect, got %d attempts", len(fd.attempts)))
+	fd.mu.Unlock()
+
+	// closing the MessageQueue stops the attempts to reconnect
+	mq = &MessageQueue{done: make(chan struct{})}
+	closes <- amqp.ErrClosed
+	stopped := make(chan struct{})
+	go func() {
+		mq.watchConnection(closes)
+		close(stopped)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(mq.done)
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected closing the MessageQueue to stop the attempts to reconnect")
+	}
+	fd.mu.Lock()
+	th.Assert(t, len(fd.attempts) > 0, "expected the MessageQueue to try to reconnect before it was closed")
+	fd.mu.Unlock()
+}
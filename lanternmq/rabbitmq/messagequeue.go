@@ -2,8 +2,13 @@ package rabbitmq
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/onc-healthit/lantern-back-end/lanternmq"
 	"github.com/streadway/amqp"
@@ -29,6 +34,9 @@ const prefetchSize0 int = 0
 // Ensure MessageQueue implements lanternmq.MessageQueue.
 var _ lanternmq.MessageQueue = &MessageQueue{}
 
+// Ensure MessageQueue implements lanternmq.DeadLetterQueue.
+var _ lanternmq.DeadLetterQueue = &MessageQueue{}
+
 // Ensure Messages implements lanternmq.Messages.
 var _ lanternmq.Messages = &Messages{}
 
@@ -42,21 +50,46 @@ var _ lanternmq.Messages = &Messages{}
 //   - potential exchange options are: 'direct', 'topic', 'headers', and 'fanout'
 //
 // * close the MessageQueue, which includes closing all channels and the connection to the underlying service.
+//
+// If the connection is lost, for example because the RabbitMQ service restarted, the MessageQueue reconnects with
+// an increasing delay between attempts. It then declares the queues, exchanges and bindings it had declared again,
+// reopens its channels and resubscribes its consumers, whose Messages keep delivering. A channel that is closed by
+// an error is reopened in the same way. Messages are published with publisher confirms, so publishing returns once
+// the RabbitMQ service has accepted the message, and a message that couldn't be published because the connection
+// was lost is published again once it has been recovered.
+//
+// If RetryPolicy is set, a message whose handler returns an error is put on the retry queue for its delay of the
+// queue it was consumed from, which sends it back to that queue once the delay expires. After the policy's maximum
+// number of attempts it is put on the queue's dead-letter queue instead. The retry and dead-letter queues are not
+// declared by the MessageQueue and must already exist; see lanternmq.RetryQueueNames and
+// lanternmq.DeadLetterQueueName.
 type MessageQueue struct {
-	connection *amqp.Connection
-	channels   []*amqp.Channel
+	RetryPolicy *lanternmq.RetryPolicy
+
+	url          string
+	mu           sync.Mutex
+	connection   amqpConnection
+	connected    chan struct{} // closed while the connection is open
+	done         chan struct{} // closed when the MessageQueue is closed
+	closed       bool
+	channels     []*channel
+	declarations []declaration
+	forwarders   sync.WaitGroup
 }
 
-// Messages wraps the delivery channel.
+// Messages wraps the delivery channel of a consumer along with the ID of the channel and the name of the queue
+// that it consumes from.
 type Messages struct {
 	deliveryChannel <-chan amqp.Delivery
+	chID            lanternmq.ChannelID
+	queue           string
 }
 
 // addChannel adds the given channel to the MessageQueue.channels array and returns the
-// index to that array casted to a lanternmq.ChannelID.
-func (mq *MessageQueue) addChannel(ch *amqp.Channel) (lanternmq.ChannelID, error) {
+// index to that array casted to a lanternmq.ChannelID. It must be called while mq.mu is locked.
+func (mq *MessageQueue) addChannel(ch *channel) (lanternmq.ChannelID, error) {
 	if mq.channels == nil {
-		mq.channels = []*amqp.Channel{}
+		mq.channels = []*channel{}
 	}
 	mq.channels = append(mq.channels, ch)
 	index := len(mq.channels) - 1
@@ -67,11 +100,13 @@ func (mq *MessageQueue) addChannel(ch *amqp.Channel) (lanternmq.ChannelID, error
 
 // getChannel retrieves the channel provided by `id` by casting `id` back to an integer and
 // retrieving the channel at the corresponding index of MessageQueue.channels array.
-func (mq *MessageQueue) getChannel(id lanternmq.ChannelID) (*amqp.Channel, error) {
+func (mq *MessageQueue) getChannel(id lanternmq.ChannelID) (*channel, error) {
 	idInt, ok := id.(int)
 	if !ok {
 		return nil, errors.New("ChannelID not of correct type")
 	}
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
 	if idInt >= len(mq.channels) {
 		return nil, errors.New("no channel with the requested ID was found")
 	}
@@ -79,28 +114,38 @@ func (mq *MessageQueue) getChannel(id lanternmq.ChannelID) (*amqp.Channel, error
 	return ch, nil
 }
 
-// Connect creates a connection to a RabbitMQ service.
+// Connect creates a connection to a RabbitMQ service, which is reconnected to if the connection is lost.
 func (mq *MessageQueue) Connect(username string, password string, host string, port string) error {
-	s := fmt.Sprintf("amqp://%s:%s@%s:%s/", username, password, host, port)
-	conn, err := amqp.Dial(s)
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+
+	mq.url = fmt.Sprintf("amqp://%s:%s@%s:%s/", username, password, host, port)
+	closes, err := mq.dial()
 	if err != nil {
-		err = errors.New("unable to connect to message queue")
+		return errors.New("unable to connect to message queue")
 	}
-	mq.connection = conn
+	mq.connected = make(chan struct{})
+	close(mq.connected)
+	mq.done = make(chan struct{})
+	go mq.watchConnection(closes)
 
-	return err
+	return nil
 }
 
 // CreateChannel creates a channel to the RabbitMQ service that has already been connected to.
 // If the RabbitMQ service has not been connected to already, an error is thrown.
 // The channel's ID is returned.
 func (mq *MessageQueue) CreateChannel() (lanternmq.ChannelID, error) {
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+
 	var err error
 	if mq.connection == nil {
 		err = errors.New("connection must exist before creating a channel")
 		return "", err
 	}
-	ch, err := mq.connection.Channel()
+	ch := &channel{}
+	err = mq.openChannel(ch)
 	if err != nil {
 		err = errors.New("unable to create channel")
 		return "", err
@@ -117,7 +162,10 @@ func (mq *MessageQueue) NumConcurrentMsgs(chID lanternmq.ChannelID, num int) err
 		return err
 	}
 
-	err = ch.Qos(
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+	ch.prefetch = num
+	err = ch.current.Qos(
 		num,
 		prefetchSize0,
 		globalFalse,
@@ -137,7 +185,8 @@ func (mq *MessageQueue) QueueExists(chID lanternmq.ChannelID, qName string) (boo
 		return false, err
 	}
 
-	_, err = ch.QueueDeclarePassive(
+	cc := mq.current(ch)
+	_, err = cc.QueueDeclarePassive(
 		qName,
 		durableTrue,
 		deleteWhenUnusedFalse,
@@ -148,6 +197,13 @@ func (mq *MessageQueue) QueueExists(chID lanternmq.ChannelID, qName string) (boo
 	if err != nil {
 		amqperr, ok := err.(*amqp.Error)
 		if ok && amqperr.Code == 404 {
+			// RabbitMQ closes the channel when a queue isn't found, so reopen it before it's used again
+			mq.mu.Lock()
+			defer mq.mu.Unlock()
+			err = mq.reopenChannel(ch, cc)
+			if err != nil {
+				return false, fmt.Errorf("unable to reopen channel: %s", err.Error())
+			}
 			return false, nil
 		}
 		err = fmt.Errorf("error determining if queue exists: %s", err.Error())
@@ -164,29 +220,37 @@ func (mq *MessageQueue) QueueExists(chID lanternmq.ChannelID, qName string) (boo
 // * exclusive: false
 // * noWait: false
 // * args: nil
+//
+// The queue is declared again after reconnecting.
 func (mq *MessageQueue) DeclareQueue(chID lanternmq.ChannelID, qName string) error {
 	ch, err := mq.getChannel(chID)
 	if err != nil {
 		return err
 	}
 
-	_, err = ch.QueueDeclare(
-		qName,
-		durableTrue,
-		deleteWhenUnusedFalse,
-		exclusiveFalse,
-		noWaitFalse,
-		nil, // args
-	)
+	declareQueue := func(amqpCh *amqp.Channel) error {
+		_, err := amqpCh.QueueDeclare(
+			qName,
+			durableTrue,
+			deleteWhenUnusedFalse,
+			exclusiveFalse,
+			noWaitFalse,
+			nil, // args
+		)
+		return err
+	}
+	err = declareQueue(mq.current(ch).Channel)
 	if err != nil {
 		err = fmt.Errorf("unable to create queue: %s", err.Error())
 		return err
 	}
+	mq.addDeclaration("queue "+qName, declareQueue)
 	return err
 }
 
 // PublishToQueue publishes 'message' on the queue with name 'qName' over the channenl with ID 'chID'
-// by calling the RabbitMQ Publish method with the following arguments:
+// and waits for the RabbitMQ service to confirm that it accepted the message. It calls the RabbitMQ Publish method
+// with the following arguments:
 // exchange: ""
 // key: qName
 // mandatory: false
@@ -197,22 +261,15 @@ func (mq *MessageQueue) DeclareQueue(chID lanternmq.ChannelID, qName string) err
 //	ContentType: "text/plain"
 //	Body: []byte(message)
 func (mq *MessageQueue) PublishToQueue(chID lanternmq.ChannelID, qName string, message string) error {
-	ch, err := mq.getChannel(chID)
-	if err != nil {
-		return err
-	}
-
-	err = ch.Publish(
+	return mq.publish(
+		chID,
 		"", // exchange
 		qName,
-		mandatoryFalse,
-		immediateFalse,
 		amqp.Publishing{
 			DeliveryMode: deliveryMode,
 			ContentType:  contentTypePlainText,
 			Body:         []byte(message),
 		})
-	return err
 }
 
 // ConsumeFromQueue opens a receive channel for amqp.Delivery objects for the queue with name 'qName'
@@ -225,13 +282,18 @@ func (mq *MessageQueue) PublishToQueue(chID lanternmq.ChannelID, qName string, m
 // noLocal: false
 // noWait: false
 // args: nil
+//
+// The consumer is subscribed again when the channel is reopened, and the receive channel is closed when the
+// MessageQueue is closed.
 func (mq *MessageQueue) ConsumeFromQueue(chID lanternmq.ChannelID, qName string) (lanternmq.Messages, error) {
 	ch, err := mq.getChannel(chID)
 	if err != nil {
 		return nil, err
 	}
 
-	deliveryChannel, err := ch.Consume(
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+	deliveryChannel, err := ch.current.Consume(
 		qName,
 		"", // consumer
 		autoAckFalse,
@@ -240,15 +302,22 @@ func (mq *MessageQueue) ConsumeFromQueue(chID lanternmq.ChannelID, qName string)
 		noWaitFalse,
 		nil, // args
 	)
-	msgs := Messages{deliveryChannel: deliveryChannel}
+	if err != nil {
+		return nil, err
+	}
+	cons := &consumer{queue: qName, deliveries: make(chan amqp.Delivery)}
+	ch.consumers = append(ch.consumers, cons)
+	mq.forward(cons, deliveryChannel)
 
-	return &msgs, err
+	msgs := Messages{deliveryChannel: cons.deliveries, chID: chID, queue: qName}
+	return &msgs, nil
 }
 
 // ProcessMessages takes 'msgs', which wraps a receive channel for amqp.Delivery objects, and processes each Delivery
 // object by retrieving the message from the Delivery object and providing that along with 'args' to the
 // lanternmq.MessageHandler 'handler'. An acknowledgement is sent to the sender after each message is processed.
-// If there's an error processing a message, the error is sent to the 'errs' channel.
+// If there's an error processing a message, the error is sent to the 'errs' channel. If the MessageQueue has a
+// RetryPolicy, the message is also retried after a delay or dead-lettered, and the error sent to 'errs' says which.
 // ProcessMessages should be called as a goroutine. Example:
 //
 //	go mq.ProcessMessages(msgs, handler, nil, errs)
@@ -266,6 +335,10 @@ func (mq *MessageQueue) ProcessMessages(ctx context.Context, msgs lanternmq.Mess
 			// ok
 		}
 		err := handler(d.Body, args)
+		if err != nil && mq.RetryPolicy != nil {
+			errs <- mq.retryOrDeadLetter(msgsd, d, err)
+			continue
+		}
 		if err != nil {
 			errs <- err
 		}
@@ -276,6 +349,85 @@ func (mq *MessageQueue) ProcessMessages(ctx context.Context, msgs lanternmq.Mess
 	}
 }
 
+// retryOrDeadLetter moves the delivery, whose handler failed with 'handlerErr', to the retry queue of the delay
+// for its number of failures, or to the dead-letter queue once it has failed the maximum number of attempts. The
+// delivery is acknowledged once it has been moved. If it can't be moved, it is put back on its queue instead so
+// that it isn't lost. The returned error describes what happened to the message.
+func (mq *MessageQueue) retryOrDeadLetter(msgs *Messages, d amqp.Delivery, handlerErr error) error {
+	failures := retryCount(d.Headers) + 1
+
+	publishing := amqp.Publishing{
+		Headers: amqp.Table{
+			lanternmq.HeaderRetryCount: int32(failures),
+			lanternmq.HeaderError:      handlerErr.Error(),
+		},
+		DeliveryMode: deliveryMode,
+		ContentType:  contentTypePlainText,
+		Body:         d.Body,
+	}
+
+	var qName string
+	var result error
+	if mq.RetryPolicy.ShouldRetry(failures) {
+		delay := lanternmq.RetryDelay(mq.RetryPolicy.Delay(failures))
+		qName = lanternmq.RetryQueueName(msgs.queue, delay)
+		result = fmt.Errorf("attempt %d of %d to process message from queue %s failed, retrying in %s: %s",
+			failures, mq.RetryPolicy.MaxAttempts, msgs.queue, delay, handlerErr)
+	} else {
+		qName = lanternmq.DeadLetterQueueName(msgs.queue)
+		publishing.Headers[lanternmq.HeaderOriginalQueue] = msgs.queue
+		publishing.Headers[lanternmq.HeaderFailedAt] = time.Now().UTC().Format(time.RFC3339)
+		publishing.MessageId = newMessageID()
+		result = fmt.Errorf("message from queue %s failed %d times and was moved to queue %s: %s",
+			msgs.queue, failures, qName, handlerErr)
+	}
+
+	err := mq.publish(
+		msgs.chID,
+		"", // exchange
+		qName,
+		publishing)
+	if err != nil {
+		nackErr := d.Nack(false, true)
+		if nackErr != nil {
+			return fmt.Errorf("unable to publish to queue %s or to requeue message after error: %s", qName, handlerErr)
+		}
+		return fmt.Errorf("unable to publish to queue %s, requeued message after error: %s", qName, handlerErr)
+	}
+
+	err = d.Ack(false)
+	if err != nil {
+		return err
+	}
+	return result
+}
+
+// retryCount returns the number of failed attempts recorded in the headers of a message
+func retryCount(headers amqp.Table) int {
+	switch count := headers[lanternmq.HeaderRetryCount].(type) {
+	case int:
+		return count
+	case int16:
+		return int(count)
+	case int32:
+		return int(count)
+	case int64:
+		return int(count)
+	default:
+		return 0
+	}
+}
+
+// newMessageID returns a random ID that identifies a dead-lettered message
+func newMessageID() string {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 10)
+	}
+	return hex.EncodeToString(b)
+}
+
 // DeclareExchange creates a target named 'name' and exchangeType 'exchangeType' over the channel with ID 'chID'.
 // It uses RabbitMQ's ExchangeDeclare method with the following arguments:
 // name: name
@@ -285,30 +437,38 @@ func (mq *MessageQueue) ProcessMessages(ctx context.Context, msgs lanternmq.Mess
 // internal: false
 // noWait: false
 // args: nil
+//
+// The exchange is declared again after reconnecting.
 func (mq *MessageQueue) DeclareExchange(chID lanternmq.ChannelID, name string, exchangeType string) error {
 	ch, err := mq.getChannel(chID)
 	if err != nil {
 		return err
 	}
 
-	err = ch.ExchangeDeclare(
-		name,
-		exchangeType,
-		durableTrue,
-		autoDeleteFalse,
-		internalFalse,
-		noWaitFalse,
-		nil, // args
-	)
+	declareExchange := func(amqpCh *amqp.Channel) error {
+		return amqpCh.ExchangeDeclare(
+			name,
+			exchangeType,
+			durableTrue,
+			autoDeleteFalse,
+			internalFalse,
+			noWaitFalse,
+			nil, // args
+		)
+	}
+	err = declareExchange(mq.current(ch).Channel)
 	if err != nil {
 		err = errors.New("unable to declare target")
+		return err
 	}
+	mq.addDeclaration("exchange "+name, declareExchange)
 
 	return err
 }
 
-// PublishToExchange sends 'message' to the exchange 'name' over the channel with ID 'chID' with routing key 'routingKey'. It
-// uses RabbitMQ's Publish method with the following arguments:
+// PublishToExchange sends 'message' to the exchange 'name' over the channel with ID 'chID' with routing key 'routingKey'
+// and waits for the RabbitMQ service to confirm that it accepted the message. It uses RabbitMQ's Publish method with
+// the following arguments:
 // exchange: name
 // key: routingKey
 // mandatory: false
@@ -318,22 +478,16 @@ func (mq *MessageQueue) DeclareExchange(chID lanternmq.ChannelID, name string, e
 //	ContentType: "text/plain"
 //	Body: []byte(message)
 func (mq *MessageQueue) PublishToExchange(chID lanternmq.ChannelID, name string, routingKey string, message string) error {
-	ch, err := mq.getChannel(chID)
-	if err != nil {
-		return err
-	}
-
-	err = ch.Publish(
+	err := mq.publish(
+		chID,
 		name,
 		routingKey,
-		mandatoryFalse,
-		immediateFalse,
 		amqp.Publishing{
 			ContentType: contentTypePlainText,
 			Body:        []byte(message),
 		})
 	if err != nil {
-		err = fmt.Errorf("unable to publish to target %s with routing key %s", name, routingKey)
+		err = fmt.Errorf("unable to publish to target %s with routing key %s: %s", name, routingKey, err.Error())
 	}
 
 	return err
@@ -355,49 +509,203 @@ func (mq *MessageQueue) PublishToExchange(chID lanternmq.ChannelID, name string,
 // exchange: exchangeName
 // noWait: false
 // args: nil
+//
+// The exclusive queue is deleted by RabbitMQ when the connection is lost, so it is declared and bound again after
+// reconnecting.
 func (mq *MessageQueue) DeclareExchangeReceiveQueue(chID lanternmq.ChannelID, exchangeName string, qName string, routingKey string) error {
 	ch, err := mq.getChannel(chID)
 	if err != nil {
 		return err
 	}
 
-	_, err = ch.QueueDeclare(
-		qName,
-		durableFalse,
-		deleteWhenUnusedFalse,
-		exclusiveTrue,
-		noWaitFalse,
-		nil, // args
-	)
+	declareQueue := func(amqpCh *amqp.Channel) error {
+		_, err := amqpCh.QueueDeclare(
+			qName,
+			durableFalse,
+			deleteWhenUnusedFalse,
+			exclusiveTrue,
+			noWaitFalse,
+			nil, // args
+		)
+		return err
+	}
+	bindQueue := func(amqpCh *amqp.Channel) error {
+		return amqpCh.QueueBind(
+			qName,
+			routingKey,
+			exchangeName,
+			noWaitFalse,
+			nil, // args
+		)
+	}
+
+	amqpCh := mq.current(ch).Channel
+	err = declareQueue(amqpCh)
 	if err != nil {
 		err = fmt.Errorf("unable to create queue: %s", err.Error())
 		return err
 	}
 
-	err = ch.QueueBind(
-		qName,
-		routingKey,
-		exchangeName,
-		noWaitFalse,
-		nil, // args
-	)
+	err = bindQueue(amqpCh)
 	if err != nil {
 		err = fmt.Errorf("unable to bind queue %s to target %s with routing key %s", qName, exchangeName, routingKey)
 		return err
 	}
 
+	mq.addDeclaration("exclusive queue "+qName, declareQueue)
+	mq.addDeclaration(fmt.Sprintf("binding of queue %s to target %s with routing key %s", qName, exchangeName, routingKey), bindQueue)
 	return err
 }
 
+// DeadLetters returns the messages on the dead-letter queue of the queue 'qName' over the channel with ID 'chID'.
+// The messages are received with RabbitMQ's Get method and are then all rejected with requeue set to true, which
+// leaves them on the dead-letter queue.
+func (mq *MessageQueue) DeadLetters(chID lanternmq.ChannelID, qName string) ([]lanternmq.DeadLetter, error) {
+	ch, err := mq.getChannel(chID)
+	if err != nil {
+		return nil, err
+	}
+
+	cc := mq.current(ch)
+	deliveries, err := getAll(cc.Channel, lanternmq.DeadLetterQueueName(qName))
+	if err != nil {
+		return nil, err
+	}
+	if len(deliveries) == 0 {
+		return []lanternmq.DeadLetter{}, nil
+	}
+
+	err = cc.Nack(deliveries[len(deliveries)-1].DeliveryTag, true, true)
+	if err != nil {
+		return nil, fmt.Errorf("unable to return messages to queue %s: %s", lanternmq.DeadLetterQueueName(qName), err.Error())
+	}
+
+	deadLetters := make([]lanternmq.DeadLetter, len(deliveries))
+	for i, d := range deliveries {
+		deadLetters[i] = toDeadLetter(d)
+	}
+	return deadLetters, nil
+}
+
+// RequeueDeadLetters publishes the messages on the dead-letter queue of the queue 'qName' whose IDs are in 'ids'
+// back to 'qName' over the channel with ID 'chID', without their retry headers, and removes them from the
+// dead-letter queue. If 'ids' is empty, every message is requeued. The other messages are left on the dead-letter
+// queue. The number of requeued messages is returned.
+func (mq *MessageQueue) RequeueDeadLetters(chID lanternmq.ChannelID, qName string, ids []string) (int, error) {
+	ch, err := mq.getChannel(chID)
+	if err != nil {
+		return 0, err
+	}
+
+	cc := mq.current(ch)
+	deliveries, err := getAll(cc.Channel, lanternmq.DeadLetterQueueName(qName))
+	if err != nil {
+		return 0, err
+	}
+
+	requeue := make(map[string]bool)
+	for _, id := range ids {
+		requeue[id] = true
+	}
+
+	count := 0
+	for _, d := range deliveries {
+		if len(ids) > 0 && !requeue[d.MessageId] {
+			err = d.Nack(false, true)
+		} else {
+			err = mq.publish(
+				chID,
+				"", // exchange
+				qName,
+				amqp.Publishing{
+					DeliveryMode: deliveryMode,
+					ContentType:  contentTypePlainText,
+					Body:         d.Body,
+				})
+			if err == nil {
+				err = d.Ack(false)
+				count++
+			}
+		}
+		if err != nil {
+			// leave the messages that haven't been handled on the dead-letter queue
+			_ = cc.Nack(deliveries[len(deliveries)-1].DeliveryTag, true, true)
+			return count, fmt.Errorf("unable to requeue messages to queue %s: %s", qName, err.Error())
+		}
+	}
+
+	return count, nil
+}
+
+// PurgeDeadLetters deletes the messages on the dead-letter queue of the queue 'qName' over the channel with ID
+// 'chID' using RabbitMQ's QueuePurge method, and returns how many were deleted.
+func (mq *MessageQueue) PurgeDeadLetters(chID lanternmq.ChannelID, qName string) (int, error) {
+	ch, err := mq.getChannel(chID)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := mq.current(ch).QueuePurge(lanternmq.DeadLetterQueueName(qName), noWaitFalse)
+	if err != nil {
+		err = fmt.Errorf("unable to purge queue %s: %s", lanternmq.DeadLetterQueueName(qName), err.Error())
+	}
+	return count, err
+}
+
+// getAll receives every message on the queue 'qName' without acknowledging them
+func getAll(ch *amqp.Channel, qName string) ([]amqp.Delivery, error) {
+	var deliveries []amqp.Delivery
+	for {
+		d, ok, err := ch.Get(qName, autoAckFalse)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get messages from queue %s: %s", qName, err.Error())
+		}
+		if !ok {
+			return deliveries, nil
+		}
+		deliveries = append(deliveries, d)
+	}
+}
+
+// toDeadLetter reads the dead-lettering headers of the delivery
+func toDeadLetter(d amqp.Delivery) lanternmq.DeadLetter {
+	deadLetter := lanternmq.DeadLetter{
+		ID:         d.MessageId,
+		Body:       d.Body,
+		RetryCount: retryCount(d.Headers),
+	}
+	deadLetter.Queue, _ = d.Headers[lanternmq.HeaderOriginalQueue].(string)
+	deadLetter.Error, _ = d.Headers[lanternmq.HeaderError].(string)
+	failedAt, _ := d.Headers[lanternmq.HeaderFailedAt].(string)
+	deadLetter.FailedAt, _ = time.Parse(time.RFC3339, failedAt)
+	return deadLetter
+}
+
 // Close closes each channel that's been created, and then closes the connection to the underlying RabbitMQ
-// message service.
+// message service. The connection is not recovered afterwards, and the receive channels of the consumers are
+// closed.
 func (mq *MessageQueue) Close() {
-	if mq.channels != nil {
-		for _, ch := range mq.channels {
-			ch.Close()
-		}
+	mq.mu.Lock()
+	if mq.closed {
+		mq.mu.Unlock()
+		return
+	}
+	mq.closed = true
+	if mq.done != nil {
+		close(mq.done)
+	}
+	for _, ch := range mq.channels {
+		ch.current.Close()
 	}
 	if mq.connection != nil {
 		mq.connection.Close()
 	}
+	mq.mu.Unlock()
+
+	mq.forwarders.Wait()
+	for _, ch := range mq.channels {
+		for _, cons := range ch.consumers {
+			close(cons.deliveries)
+		}
+	}
 }
@@ -0,0 +1,131 @@
+package rabbitmq
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	th "github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/testhelper"
+	"github.com/onc-healthit/lantern-back-end/lanternmq"
+	"github.com/streadway/amqp"
+)
+
+// publishedMessage is a message published on a fakeChannel
+type publishedMessage struct {
+	key string
+	msg amqp.Publishing
+}
+
+// fakeChannel stands in for an AMQP channel in confirm mode. It records the messages published on it and confirms
+// each one with 'ack'.
+type fakeChannel struct {
+	published []publishedMessage
+	ack       bool
+}
+
+func (fc *fakeChannel) confirmChannel() *confirmChannel {
+	cc := &confirmChannel{confirms: make(chan amqp.Confirmation, 2)}
+	cc.publish = func(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+		fc.published = append(fc.published, publishedMessage{key: key, msg: msg})
+		cc.confirms <- amqp.Confirmation{DeliveryTag: uint64(len(fc.published)), Ack: fc.ack}
+		return nil
+	}
+	return cc
+}
+
+// fakeAcknowledger records how a delivery was acknowledged
+type fakeAcknowledger struct {
+	acked   bool
+	nacked  bool
+	requeue bool
+}
+
+func (a *fakeAcknowledger) Ack(tag uint64, multiple bool) error {
+	a.acked = true
+	return nil
+}
+
+func (a *fakeAcknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	a.nacked = true
+	a.requeue = requeue
+	return nil
+}
+
+func (a *fakeAcknowledger) Reject(tag uint64, requeue bool) error {
+	return a.Nack(tag, false, requeue)
+}
+
+// newTestMessageQueue returns a MessageQueue with the retry policy 'policy' and a single channel on 'fc'. The
+// MessageQueue is closed so that publishing doesn't wait for the connection to be recovered.
+func newTestMessageQueue(policy *lanternmq.RetryPolicy, fc *fakeChannel) *MessageQueue {
+	done := make(chan struct{})
+	close(done)
+	return &MessageQueue{
+		RetryPolicy: policy,
+		done:        done,
+		channels:    []*channel{{current: fc.confirmChannel()}},
+	}
+}
+
+func Test_retryOrDeadLetter(t *testing.T) {
+	policy := &lanternmq.RetryPolicy{MaxAttempts: 3, InitialDelay: 45 * time.Second, Multiplier: 2, MaxDelay: time.Hour}
+	fc := &fakeChannel{ack: true}
+	mq := newTestMessageQueue(policy, fc)
+	msgs := &Messages{chID: 0, queue: "test-queue"}
+	handlerErr := errors.New("handler failed")
+
+	// the first failure waits on the retry queue of the delay rounded up to the nearest retry delay
+	ack := &fakeAcknowledger{}
+	d := amqp.Delivery{Acknowledger: ack, DeliveryTag: 1, Body: []byte("message")}
+	err := mq.retryOrDeadLetter(msgs, d, handlerErr)
+	th.Assert(t, err != nil, "expected an error describing the retry")
+	th.Assert(t, len(fc.published) == 1, fmt.Sprintf("expected 1 published message, got %d", len(fc.published)))
+	retry := fc.published[0]
+	th.Assert(t, retry.key == "test-queue.retry.60s", fmt.Sprintf("expected the message to be published to test-queue.retry.60s, got %s", retry.key))
+	th.Assert(t, retry.msg.Expiration == "", fmt.Sprintf("did not expect the message to have its own expiration, got %s", retry.msg.Expiration))
+	th.Assert(t, retryCount(retry.msg.Headers) == 1, fmt.Sprintf("expected a retry count of 1, got %d", retryCount(retry.msg.Headers)))
+	th.Assert(t, retry.msg.Headers[lanternmq.HeaderError] == handlerErr.Error(), fmt.Sprintf("expected the error header %s, got %v", handlerErr, retry.msg.Headers[lanternmq.HeaderError]))
+	th.Assert(t, string(retry.msg.Body) == "message", fmt.Sprintf("expected the body to be kept, got %s", retry.msg.Body))
+	th.Assert(t, ack.acked && !ack.nacked, "expected the delivery to be acknowledged once it was retried")
+
+	// the second failure waits twice as long
+	ack = &fakeAcknowledger{}
+	d = amqp.Delivery{Acknowledger: ack, DeliveryTag: 2, Body: retry.msg.Body, Headers: retry.msg.Headers}
+	_ = mq.retryOrDeadLetter(msgs, d, handlerErr)
+	retry = fc.published[1]
+	th.Assert(t, retry.key == "test-queue.retry.120s", fmt.Sprintf("expected the message to be published to test-queue.retry.120s, got %s", retry.key))
+	th.Assert(t, retryCount(retry.msg.Headers) == 2, fmt.Sprintf("expected a retry count of 2, got %d", retryCount(retry.msg.Headers)))
+
+	// the last failure is dead-lettered
+	ack = &fakeAcknowledger{}
+	d = amqp.Delivery{Acknowledger: ack, DeliveryTag: 3, Body: retry.msg.Body, Headers: retry.msg.Headers}
+	err = mq.retryOrDeadLetter(msgs, d, handlerErr)
+	th.Assert(t, err != nil, "expected an error describing the dead-lettering")
+	deadLetter := fc.published[2]
+	th.Assert(t, deadLetter.key == "test-queue.dead-letter", fmt.Sprintf("expected the message to be published to test-queue.dead-letter, got %s", deadLetter.key))
+	th.Assert(t, deadLetter.msg.MessageId != "", "expected the dead-lettered message to have an ID")
+	th.Assert(t, ack.acked, "expected the delivery to be acknowledged once it was dead-lettered")
+
+	dl := toDeadLetter(amqp.Delivery{MessageId: deadLetter.msg.MessageId, Body: deadLetter.msg.Body, Headers: deadLetter.msg.Headers})
+	th.Assert(t, dl.Queue == "test-queue", fmt.Sprintf("expected the original queue test-queue, got %s", dl.Queue))
+	th.Assert(t, dl.RetryCount == 3, fmt.Sprintf("expected a retry count of 3, got %d", dl.RetryCount))
+	th.Assert(t, dl.Error == handlerErr.Error(), fmt.Sprintf("expected the error %s, got %s", handlerErr, dl.Error))
+	th.Assert(t, !dl.FailedAt.IsZero(), "expected the dead-lettered message to have a failure time")
+}
+
+func Test_retryOrDeadLetterPublishFailure(t *testing.T) {
+	policy := &lanternmq.RetryPolicy{MaxAttempts: 3, InitialDelay: 30 * time.Second, Multiplier: 2}
+	fc := &fakeChannel{ack: false}
+	mq := newTestMessageQueue(policy, fc)
+	msgs := &Messages{chID: 0, queue: "test-queue"}
+
+	// a message that the message queue doesn't accept is put back on its queue rather than lost
+	ack := &fakeAcknowledger{}
+	d := amqp.Delivery{Acknowledger: ack, DeliveryTag: 1, Body: []byte("message")}
+	err := mq.retryOrDeadLetter(msgs, d, errors.New("handler failed"))
+	th.Assert(t, err != nil, "expected an error when the message could not be retried")
+	th.Assert(t, len(fc.published) == 1 && fc.published[0].key == "test-queue.retry.30s", fmt.Sprintf("expected one attempt to publish to test-queue.retry.30s, got %v", fc.published))
+	th.Assert(t, ack.nacked && ack.requeue, "expected the delivery to be requeued")
+	th.Assert(t, !ack.acked, "did not expect the delivery to be acknowledged")
+}
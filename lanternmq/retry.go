@@ -0,0 +1,130 @@
+package lanternmq
+
+import (
+	"fmt"
+	"time"
+)
+
+// Headers that carry the retry state of a message. They are kept when a message is delayed for a retry and are
+// added when a message is dead-lettered.
+const (
+	// HeaderRetryCount is the number of times processing the message has failed.
+	HeaderRetryCount = "x-lantern-retry-count"
+	// HeaderError is the error of the last failed attempt to process the message.
+	HeaderError = "x-lantern-error"
+	// HeaderOriginalQueue is the queue that the message was consumed from before it was dead-lettered.
+	HeaderOriginalQueue = "x-lantern-original-queue"
+	// HeaderFailedAt is when the message was dead-lettered, formatted as RFC 3339.
+	HeaderFailedAt = "x-lantern-failed-at"
+)
+
+// RetryPolicy defines how ProcessMessages handles a message whose handler returns an error. The message is
+// redelivered after an exponentially increasing delay until it has failed MaxAttempts times, and is then moved to
+// the dead-letter queue of the queue it was consumed from.
+type RetryPolicy struct {
+	// MaxAttempts is the number of times a message is processed before it is dead-lettered.
+	MaxAttempts int
+	// InitialDelay is the delay before the first retry.
+	InitialDelay time.Duration
+	// Multiplier is what the delay is multiplied by after each retry. A multiplier less than 1 is treated as 1.
+	Multiplier float64
+	// MaxDelay is the longest delay between retries. 0 means no limit.
+	MaxDelay time.Duration
+}
+
+// Delay returns how long to wait before retrying a message that has failed 'failures' times.
+func (p RetryPolicy) Delay(failures int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	delay := float64(p.InitialDelay)
+	for i := 1; i < failures; i++ {
+		delay *= multiplier
+		if p.MaxDelay > 0 && delay >= float64(p.MaxDelay) {
+			return p.MaxDelay
+		}
+	}
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		return p.MaxDelay
+	}
+	return time.Duration(delay)
+}
+
+// ShouldRetry returns whether a message that has failed 'failures' times should be retried rather than
+// dead-lettered.
+func (p RetryPolicy) ShouldRetry(failures int) bool {
+	return failures < p.MaxAttempts
+}
+
+// RetryDelays are the delays that messages wait on a retry queue for before they are retried, from shortest to
+// longest. RabbitMQ only expires the message at the front of a queue, so each delay has its own retry queue whose
+// messages all expire after the same time, and a message is never held up behind one with a longer delay. They
+// match the delays of the default policy, and the delays of other policies are rounded up to the nearest of them.
+var RetryDelays = []time.Duration{
+	30 * time.Second,
+	time.Minute,
+	2 * time.Minute,
+	4 * time.Minute,
+	8 * time.Minute,
+	16 * time.Minute,
+	30 * time.Minute,
+}
+
+// RetryDelay returns the shortest of RetryDelays that is at least 'delay', or the longest of RetryDelays if
+// 'delay' is longer than all of them.
+func RetryDelay(delay time.Duration) time.Duration {
+	for _, retryDelay := range RetryDelays {
+		if retryDelay >= delay {
+			return retryDelay
+		}
+	}
+	return RetryDelays[len(RetryDelays)-1]
+}
+
+// RetryQueueName returns the name of the queue that messages from the queue 'qName' wait on before they are
+// retried after the delay 'delay', which should be one of RetryDelays. The messages expire back to 'qName' when
+// the delay is over.
+func RetryQueueName(qName string, delay time.Duration) string {
+	return fmt.Sprintf("%s.retry.%ds", qName, int64(delay/time.Second))
+}
+
+// RetryQueueNames returns the names of the retry queues of the queue 'qName', one for each of RetryDelays.
+func RetryQueueNames(qName string) []string {
+	names := make([]string, len(RetryDelays))
+	for i, delay := range RetryDelays {
+		names[i] = RetryQueueName(qName, delay)
+	}
+	return names
+}
+
+// DeadLetterQueueName returns the name of the queue that messages from the queue 'qName' are moved to after they
+// have failed the maximum number of attempts.
+func DeadLetterQueueName(qName string) string {
+	return qName + ".dead-letter"
+}
+
+// DeadLetter is a message that was moved to a dead-letter queue.
+type DeadLetter struct {
+	ID         string
+	Queue      string
+	Body       []byte
+	Error      string
+	RetryCount int
+	FailedAt   time.Time
+}
+
+// DeadLetterQueue is implemented by the MessageQueues that support dead-lettering, and allows the messages that
+// were dead-lettered from a queue to be looked at and retried.
+type DeadLetterQueue interface {
+	// DeadLetters returns the messages on the dead-letter queue of the queue 'qName' without removing them.
+	DeadLetters(chID ChannelID, qName string) ([]DeadLetter, error)
+	// RequeueDeadLetters moves the dead-lettered messages of the queue 'qName' with the given IDs back to
+	// 'qName' with their retry counts reset. If no IDs are given, every message is moved. The number of
+	// messages moved is returned.
+	RequeueDeadLetters(chID ChannelID, qName string, ids []string) (int, error)
+	// PurgeDeadLetters deletes the messages on the dead-letter queue of the queue 'qName' and returns how
+	// many were deleted.
+	PurgeDeadLetters(chID ChannelID, qName string) (int, error)
+}
@@ -0,0 +1,101 @@
+package lanternmq
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	th "github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/testhelper"
+)
+
+func Test_RetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, InitialDelay: 10 * time.Second, Multiplier: 2, MaxDelay: time.Minute}
+
+	expected := []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, time.Minute, time.Minute}
+	for i, delay := range expected {
+		actual := policy.Delay(i + 1)
+		th.Assert(t, actual == delay, fmt.Sprintf("expected the delay after %d failures to be %s, got %s", i+1, delay, actual))
+	}
+
+	// no maximum delay
+	policy.MaxDelay = 0
+	th.Assert(t, policy.Delay(5) == 160*time.Second, fmt.Sprintf("expected a delay of 2m40s, got %s", policy.Delay(5)))
+
+	// the delay does not shrink with a multiplier less than 1
+	policy.Multiplier = 0
+	th.Assert(t, policy.Delay(3) == 10*time.Second, fmt.Sprintf("expected a delay of 10s, got %s", policy.Delay(3)))
+
+	policy.MaxAttempts = 3
+	th.Assert(t, policy.ShouldRetry(2), "expected a message that failed twice to be retried")
+	th.Assert(t, !policy.ShouldRetry(3), "expected a message that failed three times to be dead-lettered")
+}
+
+func Test_RetryDelay(t *testing.T) {
+	cases := map[time.Duration]time.Duration{
+		0:                  30 * time.Second,
+		10 * time.Second:   30 * time.Second,
+		30 * time.Second:   30 * time.Second,
+		45 * time.Second:   time.Minute,
+		4 * time.Minute:    4 * time.Minute,
+		20 * time.Minute:   30 * time.Minute,
+		2 * time.Hour:      30 * time.Minute,
+		1800 * time.Second: 30 * time.Minute,
+	}
+	for delay, expected := range cases {
+		actual := RetryDelay(delay)
+		th.Assert(t, actual == expected, fmt.Sprintf("expected a delay of %s to wait for %s, got %s", delay, expected, actual))
+	}
+
+	// the delays of the default policy each have their own retry queue
+	policy := RetryPolicy{MaxAttempts: 8, InitialDelay: 30 * time.Second, Multiplier: 2, MaxDelay: 30 * time.Minute}
+	for failures := 1; failures < policy.MaxAttempts; failures++ {
+		delay := policy.Delay(failures)
+		th.Assert(t, RetryDelay(delay) == delay, fmt.Sprintf("expected the default delay %s to be one of the retry delays", delay))
+	}
+
+	th.Assert(t, RetryQueueName("test-queue", 2*time.Minute) == "test-queue.retry.120s", fmt.Sprintf("unexpected retry queue name %s", RetryQueueName("test-queue", 2*time.Minute)))
+	names := RetryQueueNames("test-queue")
+	th.Assert(t, len(names) == len(RetryDelays), fmt.Sprintf("expected %d retry queues, got %d", len(RetryDelays), len(names)))
+	th.Assert(t, names[0] == "test-queue.retry.30s", fmt.Sprintf("expected the first retry queue to be test-queue.retry.30s, got %s", names[0]))
+}
+
+func Test_RetryQueueDefinitions(t *testing.T) {
+	definitionsJSON, err := os.ReadFile("definitions.json")
+	th.Assert(t, err == nil, err)
+
+	var definitions struct {
+		Queues []struct {
+			Name      string                 `json:"name"`
+			Arguments map[string]interface{} `json:"arguments"`
+		} `json:"queues"`
+	}
+	err = json.Unmarshal(definitionsJSON, &definitions)
+	th.Assert(t, err == nil, err)
+
+	queues := map[string]map[string]interface{}{}
+	for _, q := range definitions.Queues {
+		queues[q.Name] = q.Arguments
+	}
+
+	// the services' users can't declare queues, so each queue's retry and dead-letter queues must be defined
+	for name := range queues {
+		if strings.Contains(name, ".retry") || strings.HasSuffix(name, ".dead-letter") {
+			continue
+		}
+		_, ok := queues[DeadLetterQueueName(name)]
+		th.Assert(t, ok, fmt.Sprintf("expected queue %s to be defined", DeadLetterQueueName(name)))
+
+		for _, delay := range RetryDelays {
+			retryName := RetryQueueName(name, delay)
+			args, ok := queues[retryName]
+			th.Assert(t, ok, fmt.Sprintf("expected queue %s to be defined", retryName))
+			th.Assert(t, args["x-dead-letter-exchange"] == "", fmt.Sprintf("expected queue %s to dead-letter to the default exchange, got %v", retryName, args["x-dead-letter-exchange"]))
+			th.Assert(t, args["x-dead-letter-routing-key"] == name, fmt.Sprintf("expected queue %s to dead-letter to %s, got %v", retryName, name, args["x-dead-letter-routing-key"]))
+			ttl, _ := args["x-message-ttl"].(float64)
+			th.Assert(t, time.Duration(ttl)*time.Millisecond == delay, fmt.Sprintf("expected queue %s to have a message TTL of %s, got %v", retryName, delay, args["x-message-ttl"]))
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package lanternmq
+
+import "strings"
+
+// RoutingKeyMatches returns whether a message published with 'routingKey' to an exchange of type 'exchangeType' is
+// routed to a queue bound to the exchange with 'bindingKey'. It follows RabbitMQ's rules for the 'direct', 'topic'
+// and 'fanout' exchange types, which are the types that the implementations without a RabbitMQ service support:
+//   - fanout: every bound queue receives the message
+//   - direct: the binding key must equal the routing key
+//   - topic: the keys are split into words by '.', and in the binding key '*' matches exactly one word and '#'
+//     matches zero or more words
+func RoutingKeyMatches(exchangeType string, bindingKey string, routingKey string) bool {
+	switch exchangeType {
+	case "fanout":
+		return true
+	case "direct":
+		return bindingKey == routingKey
+	case "topic":
+		return topicMatches(strings.Split(bindingKey, "."), strings.Split(routingKey, "."))
+	default:
+		return false
+	}
+}
+
+// SupportedExchangeType returns whether RoutingKeyMatches can route messages for the exchange type
+func SupportedExchangeType(exchangeType string) bool {
+	return exchangeType == "fanout" || exchangeType == "direct" || exchangeType == "topic"
+}
+
+func topicMatches(pattern []string, words []string) bool {
+	if len(pattern) == 0 {
+		return len(words) == 0
+	}
+	switch pattern[0] {
+	case "#":
+		for i := 0; i <= len(words); i++ {
+			if topicMatches(pattern[1:], words[i:]) {
+				return true
+			}
+		}
+		return false
+	case "*":
+		return len(words) > 0 && topicMatches(pattern[1:], words[1:])
+	default:
+		return len(words) > 0 && pattern[0] == words[0] && topicMatches(pattern[1:], words[1:])
+	}
+}
@@ -0,0 +1,39 @@
+package lanternmq
+
+import (
+	"fmt"
+	"testing"
+
+	th "github.com/onc-healthit/lantern-back-end/endpointmanager/pkg/testhelper"
+)
+
+func Test_RoutingKeyMatches(t *testing.T) {
+	cases := []struct {
+		pattern string
+		key     string
+		matches bool
+	}{
+		{"a.b", "a.b", true},
+		{"a.b", "a.c", false},
+		{"a.*", "a.b", true},
+		{"a.*", "a", false},
+		{"a.*", "a.b.c", false},
+		{"*.b.*", "a.b.c", true},
+		{"#", "a.b.c", true},
+		{"#", "", true},
+		{"a.#", "a", true},
+		{"a.#", "a.b.c", true},
+		{"a.#.c", "a.c", true},
+		{"a.#.c", "a.b.b.c", true},
+		{"a.#.c", "a.b.d", false},
+	}
+	for _, c := range cases {
+		matches := RoutingKeyMatches("topic", c.pattern, c.key)
+		th.Assert(t, matches == c.matches, fmt.Sprintf("expected %s to match %s: %t, got %t", c.pattern, c.key, c.matches, matches))
+	}
+
+	th.Assert(t, RoutingKeyMatches("fanout", "a", "b"), "expected a fanout exchange to route every message")
+	th.Assert(t, RoutingKeyMatches("direct", "a.b", "a.b"), "expected a direct exchange to route a message with the binding key")
+	th.Assert(t, !RoutingKeyMatches("direct", "a.*", "a.b"), "did not expect a direct exchange to match wildcards")
+	th.Assert(t, !RoutingKeyMatches("headers", "a", "a"), "did not expect an unsupported exchange type to route messages")
+}